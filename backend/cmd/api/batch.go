@@ -0,0 +1,265 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/chefgoldbloom/pnctool/backend/internal/data"
+	"github.com/chefgoldbloom/pnctool/backend/internal/jsonpatch"
+	"github.com/chefgoldbloom/pnctool/backend/internal/validator"
+)
+
+// maxBatchOperations caps the size of a single batch request.
+const maxBatchOperations = 100
+
+// batchOperation is one entry in a "POST /v1/batch" request. Data is the camera for
+// create, and a JSON Merge Patch for update. Version, if given, must match the stored
+// record for update and delete.
+type batchOperation struct {
+	Op       string          `json:"op"`
+	Resource string          `json:"resource"`
+	ID       int64           `json:"id"`
+	Version  *int32          `json:"version"`
+	Data     json.RawMessage `json:"data"`
+}
+
+// batchResult reports the outcome of one operation, using the status code and error
+// format the equivalent single request would have produced.
+type batchResult struct {
+	Index  int          `json:"index"`
+	Op     string       `json:"op"`
+	Status int          `json:"status"`
+	Camera *data.Camera `json:"camera,omitempty"`
+	Code   string       `json:"code,omitempty"`
+	Error  any          `json:"error,omitempty"`
+}
+
+// batchError is an operation failure which should be reported in its result rather
+// than failing the whole request.
+type batchError struct {
+	status  int
+	code    string
+	message any
+}
+
+func (e *batchError) Error() string {
+	return fmt.Sprintf("%d %s: %v", e.status, e.code, e.message)
+}
+
+// errBatchAborted rolls back an atomic batch after one of its operations failed.
+var errBatchAborted = errors.New("batch aborted")
+
+// batchHandler handles "POST /v1/batch". All operations run in one transaction. By
+// default the batch is atomic: the first failed operation rolls everything back and
+// the remaining operations are not attempted. With ?atomic=false each operation runs
+// under its own savepoint, failed operations are undone individually and the rest are
+// committed.
+func (app *application) batchHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Operations []batchOperation `json:"operations"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+	atomic := true
+	if s := r.URL.Query().Get("atomic"); s != "" {
+		atomic, err = strconv.ParseBool(s)
+		v.CheckCode(err == nil, "atomic", validator.CodeInvalid, "must be true or false")
+	}
+	v.CheckCode(len(input.Operations) > 0, "operations", validator.CodeRequired, "must contain at least one operation")
+	v.CheckCode(len(input.Operations) <= maxBatchOperations, "operations", validator.CodeOutOfRange, fmt.Sprintf("must not contain more than %d operations", maxBatchOperations))
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v)
+		return
+	}
+
+	results := make([]batchResult, len(input.Operations))
+	changed := make([]*data.Camera, len(input.Operations))
+	failed := -1
+
+	err = app.models.Tx.InTx(r.Context(), func(tx data.Tx) error {
+		for i, op := range input.Operations {
+			results[i] = batchResult{Index: i, Op: op.Op}
+
+			if !atomic {
+				if err := tx.Savepoint("batch_op"); err != nil {
+					return err
+				}
+			}
+
+			camera, status, err := runBatchOperation(tx, op)
+
+			var opErr *batchError
+			switch {
+			case err == nil:
+				results[i].Status, changed[i] = status, camera
+				if op.Op != "delete" {
+					results[i].Camera = camera
+				}
+				continue
+			case !errors.As(err, &opErr):
+				return err
+			}
+
+			results[i].Status, results[i].Code, results[i].Error = opErr.status, opErr.code, opErr.message
+			if atomic {
+				failed = i
+				return errBatchAborted
+			}
+			if err := tx.RollbackTo("batch_op"); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil && !errors.Is(err, errBatchAborted) {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	committed := failed < 0
+	if committed {
+		for i, camera := range changed {
+			if camera != nil {
+				app.publish(batchEventTypes[input.Operations[i].Op], camera)
+			}
+		}
+	} else {
+		for i := range results {
+			if i == failed {
+				continue
+			}
+			results[i] = batchResult{
+				Index:  i,
+				Op:     input.Operations[i].Op,
+				Status: http.StatusFailedDependency,
+				Code:   codeBatchRolledBack,
+				Error:  fmt.Sprintf("not applied because operation %d failed", failed),
+			}
+		}
+	}
+
+	status := http.StatusOK
+	if !committed {
+		status = http.StatusConflict
+	}
+	err = app.writeJSON(w, status, envelope{"committed": committed, "atomic": atomic, "results": results}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// batchEventTypes is the event published for each committed operation.
+var batchEventTypes = map[string]string{
+	"create": data.EventCameraCreated,
+	"update": data.EventCameraUpdated,
+	"delete": data.EventCameraDeleted,
+}
+
+// runBatchOperation applies a single operation and returns the affected camera, as
+// it was before a delete, and the status code a single request would have returned. Client errors are returned
+// as *batchError; anything else is a server error which aborts the batch.
+func runBatchOperation(tx data.Tx, op batchOperation) (*data.Camera, int, error) {
+	if op.Resource != "cameras" {
+		return nil, 0, &batchError{http.StatusUnprocessableEntity, codeValidationFailed, map[string]string{"resource": "must be one of: cameras"}}
+	}
+	cameras := tx.Cameras()
+
+	switch op.Op {
+	case "create":
+		var input struct {
+			Name       string `json:"name"`
+			MacAddress string `json:"mac_address"`
+			SiteName   string `json:"site_name"`
+			ModelNo    string `json:"model_no"`
+			Address    string `json:"address"`
+		}
+		if err := decodeJSON(op.Data, &input); err != nil {
+			return nil, 0, &batchError{http.StatusBadRequest, codeBadRequest, err.Error()}
+		}
+		camera := &data.Camera{Name: input.Name, MacAddress: input.MacAddress, SiteName: input.SiteName, ModelNo: input.ModelNo, Address: input.Address}
+
+		v := validator.New()
+		if data.ValidateCamera(v, camera); !v.Valid() {
+			return nil, 0, &batchError{http.StatusUnprocessableEntity, codeValidationFailed, v.Errors}
+		}
+		if err := cameras.Insert(camera); err != nil {
+			return nil, 0, err
+		}
+		return camera, http.StatusCreated, nil
+
+	case "update":
+		camera, err := loadBatchCamera(cameras, op)
+		if err != nil {
+			return nil, 0, err
+		}
+		doc, err := json.Marshal(camera)
+		if err != nil {
+			return nil, 0, err
+		}
+		doc, err = jsonpatch.MergePatch(doc, op.Data)
+		if err != nil {
+			return nil, 0, &batchError{http.StatusBadRequest, codeBadRequest, err.Error()}
+		}
+		updated, err := cameraFromDocument(camera, doc)
+		if err != nil {
+			return nil, 0, &batchError{http.StatusBadRequest, codeBadRequest, err.Error()}
+		}
+
+		v := validator.New()
+		validateReadOnlyFields(v, camera, updated)
+		if data.ValidateCamera(v, updated); !v.Valid() {
+			return nil, 0, &batchError{http.StatusUnprocessableEntity, codeValidationFailed, v.Errors}
+		}
+		err = cameras.Update(updated)
+		if errors.Is(err, data.ErrEditConflict) {
+			return nil, 0, &batchError{http.StatusConflict, codeEditConflict, "the camera was modified during this operation"}
+		}
+		if err != nil {
+			return nil, 0, err
+		}
+		return updated, http.StatusOK, nil
+
+	case "delete":
+		camera, err := loadBatchCamera(cameras, op)
+		if err != nil {
+			return nil, 0, err
+		}
+		err = cameras.DeleteVersion(camera.ID, camera.Version)
+		if errors.Is(err, data.ErrEditConflict) {
+			return nil, 0, &batchError{http.StatusConflict, codeEditConflict, "the camera was modified during this operation"}
+		}
+		if err != nil {
+			return nil, 0, err
+		}
+		return camera, http.StatusOK, nil
+
+	default:
+		return nil, 0, &batchError{http.StatusUnprocessableEntity, codeValidationFailed, map[string]string{"op": "must be one of: create, update, delete"}}
+	}
+}
+
+// loadBatchCamera fetches the camera an update or delete refers to and checks the
+// operation's version against it.
+func loadBatchCamera(cameras data.CameraRepository, op batchOperation) (*data.Camera, error) {
+	camera, err := cameras.Get(op.ID)
+	switch {
+	case errors.Is(err, data.ErrRecordNotFound):
+		return nil, &batchError{http.StatusNotFound, codeNotFound, "the requested resource could not be found"}
+	case err != nil:
+		return nil, err
+	}
+	if op.Version != nil && *op.Version != camera.Version {
+		message := fmt.Sprintf("camera %d is at version %d, not %d", camera.ID, camera.Version, *op.Version)
+		return nil, &batchError{http.StatusConflict, codeEditConflict, message}
+	}
+	return camera, nil
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/chefgoldbloom/pnctool/backend/internal/data"
+)
+
+func countCameras(t *testing.T, app *application) int {
+	t.Helper()
+
+	_, metadata, err := app.models.Cameras.GetAll(data.CameraFilter{}, data.Projection{}, data.Filters{Page: 1, PageSize: 100, Sort: "id", SortSafelist: []string{"id"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return metadata.TotalRecords
+}
+
+func TestBatch(t *testing.T) {
+	app := newTestApplication(t)
+	routes := app.routes()
+	existing := createCamera(t, routes, validCameraJSON)
+	doomed := createCamera(t, routes, `{"name":"doomed","mac_address":"ACCC8E000009","site_name":"NYC-5th-OPS"}`)
+
+	body := fmt.Sprintf(`{"operations":[
+		{"op":"create","resource":"cameras","data":{"name":"new","mac_address":"ACCC8E000002","site_name":"BOS-Main-GLH","address":"10.0.0.7"}},
+		{"op":"update","resource":"cameras","id":%d,"version":1,"data":{"site_name":"BOS-Main-GLH"}},
+		{"op":"delete","resource":"cameras","id":%d}
+	]}`, existing.ID, doomed.ID)
+
+	res := do(t, routes, http.MethodPost, "/v1/batch", body)
+	if res.status != http.StatusOK {
+		t.Fatalf("status = %d; body = %v", res.status, res.body)
+	}
+	var results []batchResult
+	res.decode(t, "results", &results)
+	if len(results) != 3 || results[0].Status != http.StatusCreated || results[1].Status != http.StatusOK || results[2].Status != http.StatusOK {
+		t.Fatalf("results = %+v", results)
+	}
+	if results[0].Camera.Address != "10.0.0.7" {
+		t.Errorf("created camera = %+v; want address 10.0.0.7", results[0].Camera)
+	}
+	if results[1].Camera.SiteName != "BOS-Main-GLH" || results[1].Camera.Version != 2 {
+		t.Errorf("updated camera = %+v", results[1].Camera)
+	}
+	if n := countCameras(t, app); n != 2 {
+		t.Errorf("cameras = %d; want 2", n)
+	}
+}
+
+func TestBatchAtomicRollback(t *testing.T) {
+	app := newTestApplication(t)
+	routes := app.routes()
+	existing := createCamera(t, routes, validCameraJSON)
+
+	body := fmt.Sprintf(`{"operations":[
+		{"op":"create","resource":"cameras","data":{"name":"new","mac_address":"ACCC8E000002","site_name":"BOS-Main-GLH"}},
+		{"op":"update","resource":"cameras","id":%d,"version":7,"data":{"name":"stale"}},
+		{"op":"delete","resource":"cameras","id":%d}
+	]}`, existing.ID, existing.ID)
+
+	res := do(t, routes, http.MethodPost, "/v1/batch", body)
+	if res.status != http.StatusConflict {
+		t.Fatalf("status = %d; body = %v", res.status, res.body)
+	}
+	var results []batchResult
+	res.decode(t, "results", &results)
+	want := []int{http.StatusFailedDependency, http.StatusConflict, http.StatusFailedDependency}
+	for i, r := range results {
+		if r.Status != want[i] {
+			t.Errorf("result %d status = %d; want %d", i, r.Status, want[i])
+		}
+	}
+
+	if n := countCameras(t, app); n != 1 {
+		t.Errorf("cameras = %d; want 1 (create should be rolled back)", n)
+	}
+	if camera, _ := app.models.Cameras.Get(existing.ID); camera.Name != existing.Name {
+		t.Errorf("camera was modified: %+v", camera)
+	}
+}
+
+func TestBatchNonAtomic(t *testing.T) {
+	app := newTestApplication(t)
+	routes := app.routes()
+
+	body := `{"operations":[
+		{"op":"create","resource":"cameras","data":{"name":"ok","mac_address":"ACCC8E000002","site_name":"BOS-Main-GLH"}},
+		{"op":"create","resource":"cameras","data":{"name":""}},
+		{"op":"delete","resource":"cameras","id":99},
+		{"op":"create","resource":"sites","data":{}},
+		{"op":"create","resource":"cameras","data":{"name":"ok2","mac_address":"ACCC8E000003","site_name":"BOS-Main-GLH"}}
+	]}`
+
+	res := do(t, routes, http.MethodPost, "/v1/batch?atomic=false", body)
+	if res.status != http.StatusOK {
+		t.Fatalf("status = %d; body = %v", res.status, res.body)
+	}
+	var results []batchResult
+	res.decode(t, "results", &results)
+	want := []int{http.StatusCreated, http.StatusUnprocessableEntity, http.StatusNotFound, http.StatusUnprocessableEntity, http.StatusCreated}
+	for i, r := range results {
+		if r.Status != want[i] {
+			t.Errorf("result %d status = %d; want %d", i, r.Status, want[i])
+		}
+	}
+	if n := countCameras(t, app); n != 2 {
+		t.Errorf("cameras = %d; want 2", n)
+	}
+}
+
+func TestBatchValidation(t *testing.T) {
+	routes := newTestApplication(t).routes()
+
+	tests := []struct {
+		name, url, body string
+		status          int
+	}{
+		{"empty", "/v1/batch", `{"operations":[]}`, http.StatusUnprocessableEntity},
+		{"bad atomic", "/v1/batch?atomic=maybe", `{"operations":[{"op":"delete","resource":"cameras","id":1}]}`, http.StatusUnprocessableEntity},
+		{"malformed", "/v1/batch", `{"operations":`, http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if res := do(t, routes, http.MethodPost, tt.url, tt.body); res.status != tt.status {
+				t.Errorf("status = %d; want %d", res.status, tt.status)
+			}
+		})
+	}
+}
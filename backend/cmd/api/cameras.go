@@ -1,11 +1,15 @@
 package main
 
 import (
+	"encoding/json"
 	"errors"
 	"fmt"
 	"net/http"
+	"net/url"
 
 	"github.com/chefgoldbloom/pnctool/backend/internal/data"
+	"github.com/chefgoldbloom/pnctool/backend/internal/jsonpatch"
+	"github.com/chefgoldbloom/pnctool/backend/internal/query"
 	"github.com/chefgoldbloom/pnctool/backend/internal/validator"
 )
 
@@ -17,6 +21,7 @@ func (app *application) createCameraHandler(w http.ResponseWriter, r *http.Reque
 		MacAddress string `json:"mac_address"`
 		SiteName   string `json:"site_name"`
 		ModelNo    string `json:"model_no"`
+		Address    string `json:"address"`
 	}
 
 	err := app.readJSON(w, r, &input)
@@ -29,24 +34,28 @@ func (app *application) createCameraHandler(w http.ResponseWriter, r *http.Reque
 		MacAddress: input.MacAddress,
 		SiteName:   input.SiteName,
 		ModelNo:    input.ModelNo,
+		Address:    input.Address,
 	}
 	v := validator.New()
 	if data.ValidateCamera(v, camera); !v.Valid() {
-		app.failedValidationResponse(w, r, v.Errors)
+		app.failedValidationResponse(w, r, v)
 		return
 	}
 
 	err = app.models.Cameras.Insert(camera)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
+		return
 	}
+	app.publish(data.EventCameraCreated, camera)
 
-	// Make a Location header to let the client know resource's url
-	headers := make(http.Header)
+	// Make a Location header to let the client know resource's url, and an ETag
+	// the client can send back in If-Match when it edits the camera
+	headers := etagHeader(camera)
 	headers.Set("Location", fmt.Sprintf("/v1/cameras/%d", camera.ID))
 
 	// Write JSON response with a 201 Created status code, the camera data
-	// in the response body, and the Location header.
+	// in the response body, and the Location and ETag headers.
 	err = app.writeJSON(w, http.StatusCreated, envelope{"camera": camera}, headers)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
@@ -63,7 +72,14 @@ func (app *application) showCameraHandler(w http.ResponseWriter, r *http.Request
 		return
 	}
 
-	camera, err := app.models.Cameras.Get(id)
+	projection := app.readProjection(r.URL.Query())
+	v := validator.New()
+	if data.ValidateProjection(v, projection); !v.Valid() {
+		app.failedValidationResponse(w, r, v)
+		return
+	}
+
+	camera, err := app.models.Cameras.GetProjected(id, projection)
 	if err != nil {
 		switch {
 		case errors.Is(err, data.ErrRecordNotFound):
@@ -74,64 +90,164 @@ func (app *application) showCameraHandler(w http.ResponseWriter, r *http.Request
 		return
 	}
 
-	err = app.writeJSON(w, http.StatusOK, envelope{"camera": camera}, nil)
+	// Let clients revalidate a cached copy without downloading it again
+	etag := representationETag(camera, projection)
+	if ifNoneMatchHits(r, etag) {
+		app.notModifiedResponse(w, etag)
+		return
+	}
+
+	headers := make(http.Header)
+	headers.Set("ETag", etag)
+	err = app.writeJSON(w, http.StatusOK, envelope{"camera": renderCamera(camera, projection)}, headers)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 	}
 }
 
+// updateCameraHandler handles "PATCH /v1/cameras/:id". The body is applied to the
+// camera's JSON representation as a JSON Merge Patch (application/json or
+// application/merge-patch+json) or a JSON Patch (application/json-patch+json), so
+// every writable Camera field is patchable without handler changes.
 func (app *application) updateCameraHandler(w http.ResponseWriter, r *http.Request) {
-	id, err := app.readIDParam(r)
+	camera, ok := app.loadCameraForWrite(w, r)
+	if !ok {
+		return
+	}
+
+	var apply func(doc, patch []byte) ([]byte, error)
+	switch requestMediaType(r) {
+	case "", "application/json", mergePatchContentType:
+		apply = jsonpatch.MergePatch
+	case jsonPatchContentType:
+		apply = jsonpatch.Apply
+	default:
+		app.unsupportedMediaTypeResponse(w, r)
+		return
+	}
+
+	var patch json.RawMessage
+	err := app.readJSON(w, r, &patch)
 	if err != nil {
-		app.notFoundResponse(w, r)
+		app.badRequestResponse(w, r, err)
+		return
 	}
 
-	camera, err := app.models.Cameras.Get(id)
+	doc, err := json.Marshal(camera)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	doc, err = apply(doc, patch)
 	if err != nil {
 		switch {
-		case errors.Is(err, data.ErrRecordNotFound):
-			app.notFoundResponse(w, r)
+		case errors.Is(err, jsonpatch.ErrTestFailed):
+			app.patchTestFailedResponse(w, r, err)
 		default:
-			app.serverErrorResponse(w, r, err)
+			app.badRequestResponse(w, r, err)
 		}
 		return
 	}
 
-	var input struct {
-		Name       *string `json:"name"`
-		MacAddress *string `json:"mac_address"`
-		SiteName   *string `json:"site_name"`
-		ModelNo    *string `json:"model_no"`
+	updated, err := cameraFromDocument(camera, doc)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	app.saveCamera(w, r, camera, updated)
+}
+
+// replaceCameraHandler handles "PUT /v1/cameras/:id". The body is a complete camera
+// representation; omitted writable fields are reset to their zero value. Read-only
+// fields may be omitted but must match the stored camera if given.
+func (app *application) replaceCameraHandler(w http.ResponseWriter, r *http.Request) {
+	camera, ok := app.loadCameraForWrite(w, r)
+	if !ok {
+		return
 	}
 
-	err = app.readJSON(w, r, &input)
+	var input map[string]json.RawMessage
+	err := app.readJSON(w, r, &input)
 	if err != nil {
 		app.badRequestResponse(w, r, err)
+		return
 	}
 
-	if input.Name != nil {
-		camera.Name = *input.Name
+	current, err := cameraDocument(camera)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	for _, field := range readOnlyCameraFields {
+		if _, ok := input[field]; !ok {
+			input[field] = current[field]
+		}
+	}
+
+	doc, err := json.Marshal(input)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	updated, err := cameraFromDocument(camera, doc)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
 	}
-	if input.MacAddress != nil {
-		camera.MacAddress = *input.MacAddress
+
+	app.saveCamera(w, r, camera, updated)
+}
+
+// loadCameraForWrite fetches the camera named in the URL for an update and checks the
+// request's If-Match precondition against it. It sends the error response itself and
+// returns false if the handler should stop.
+func (app *application) loadCameraForWrite(w http.ResponseWriter, r *http.Request) (*data.Camera, bool) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return nil, false
 	}
-	if input.SiteName != nil {
-		camera.SiteName = *input.SiteName
 
+	camera, err := app.models.Cameras.Get(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return nil, false
 	}
-	if input.ModelNo != nil {
-		camera.ModelNo = *input.ModelNo
+
+	// If the client says which version it edited, refuse to apply the change to
+	// any other version
+	if ifMatchFails(r, camera) {
+		app.preconditionFailedResponse(w, r)
+		return nil, false
 	}
+	return camera, true
+}
 
+// saveCamera validates updated against the stored camera, writes it with the
+// versioned Update and sends the response.
+func (app *application) saveCamera(w http.ResponseWriter, r *http.Request, current, updated *data.Camera) {
 	v := validator.New()
-	if data.ValidateCamera(v, camera); !v.Valid() {
-		app.failedValidationResponse(w, r, v.Errors)
+	validateReadOnlyFields(v, current, updated)
+	if data.ValidateCamera(v, updated); !v.Valid() {
+		app.failedValidationResponse(w, r, v)
 		return
 	}
 
-	err = app.models.Cameras.Update(camera)
+	// Update is versioned, so a write which lands between our Get and Update is
+	// still caught. Conditional requests report that as a failed precondition.
+	err := app.models.Cameras.Update(updated)
 	if err != nil {
 		switch {
+		case errors.Is(err, data.ErrEditConflict) && r.Header.Get("If-Match") != "":
+			app.preconditionFailedResponse(w, r)
 		case errors.Is(err, data.ErrEditConflict):
 			app.editConflictResponse(w, r)
 		default:
@@ -139,8 +255,9 @@ func (app *application) updateCameraHandler(w http.ResponseWriter, r *http.Reque
 		}
 		return
 	}
+	app.publish(data.EventCameraUpdated, updated)
 
-	err = app.writeJSON(w, http.StatusOK, envelope{"camera": camera}, nil)
+	err = app.writeJSON(w, http.StatusOK, envelope{"camera": updated}, etagHeader(updated))
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 	}
@@ -152,67 +269,148 @@ func (app *application) deleteCameraHandler(w http.ResponseWriter, r *http.Reque
 		app.notFoundResponse(w, r)
 		return
 	}
-	err = app.models.Cameras.Delete(id)
+
+	// Unconditional deletes remove whatever version is stored. The camera is read
+	// first either way, for the event.
+	var camera *data.Camera
+	if r.Header.Get("If-Match") == "" {
+		camera, err = app.models.Cameras.Get(id)
+		if err == nil {
+			err = app.models.Cameras.Delete(id)
+		}
+	} else {
+		camera, err = app.deleteCameraIfMatch(r, id)
+	}
 	if err != nil {
 		switch {
 		case errors.Is(err, data.ErrRecordNotFound):
 			app.notFoundResponse(w, r)
+		case errors.Is(err, data.ErrEditConflict):
+			app.preconditionFailedResponse(w, r)
 		default:
 			app.serverErrorResponse(w, r, err)
 		}
 		return
 	}
+	app.publish(data.EventCameraDeleted, camera)
+
 	err = app.writeJSON(w, http.StatusOK, envelope{"message": "camera successfully deleted"}, nil)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 	}
 }
 
-func (app *application) listCamerasHandler(w http.ResponseWriter, r *http.Request) {
-	// Embed Filters struct
-	var input struct {
-		Name       string
-		MacAddress string
-		ModelNo    string
-		SiteName   string
-		data.Filters
+// deleteCameraIfMatch deletes the camera only if its current version satisfies the
+// request's If-Match header, and returns the deleted camera. The delete itself is
+// versioned, so a concurrent edit after the check still yields ErrEditConflict.
+func (app *application) deleteCameraIfMatch(r *http.Request, id int64) (*data.Camera, error) {
+	camera, err := app.models.Cameras.Get(id)
+	if err != nil {
+		return nil, err
+	}
+	if ifMatchFails(r, camera) {
+		return nil, data.ErrEditConflict
 	}
+	return camera, app.models.Cameras.DeleteVersion(id, camera.Version)
+}
 
+func (app *application) listCamerasHandler(w http.ResponseWriter, r *http.Request) {
 	// init new Validator instance
 	v := validator.New()
 
-	// Call r.URL.Query() to get url.Values map
-	qs := r.URL.Query()
+	input, err := app.readCameraListInput(r.URL.Query(), v)
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v)
+		return
+	}
+	var qerr *query.Error
+	if errors.As(err, &qerr) {
+		app.invalidQueryResponse(w, r, qerr)
+		return
+	}
+
+	app.listCameras(w, r, input)
+}
 
-	// Use helpers to extract information, falling back to defaults if needed
-	input.Name = app.readString(qs, "name", "")
-	input.MacAddress = app.readString(qs, "mac_address", "")
-	input.ModelNo = app.readString(qs, "model_no", "")
-	input.SiteName = app.readString(qs, "site_name", "")
+// cameraListInput is the parsed query string of a camera listing.
+type cameraListInput struct {
+	data.CameraFilter
+	data.Projection
+	data.Filters
+}
+
+// readCameraListInput reads a camera listing's query string. Failed checks are
+// recorded in v, and a q= expression which doesn't parse is returned as a
+// *query.Error.
+func (app *application) readCameraListInput(qs url.Values, v *validator.Validator) (cameraListInput, error) {
+	var input cameraListInput
+
+	filter, err := app.readCameraFilter(qs, v)
+	input.CameraFilter = filter
+
+	// Read the sparse fieldset and related resources to embed
+	input.Projection = app.readProjection(qs)
 
 	// Read page and page_size into Filter
 	input.Filters.Page = app.readInt(qs, "page", 1, v)
 	input.Filters.PageSize = app.readInt(qs, "page_size", 20, v)
-	input.Filters.Sort = app.readString(qs, "sort", "id")
+	// Searches are ranked best match first unless another sort is asked for
+	defaultSort := "id"
+	if input.Search != "" {
+		defaultSort = "-relevance"
+	}
+	input.Filters.Sort = app.readString(qs, "sort", defaultSort)
 
 	input.Filters.SortSafelist = []string{"id", "name", "mac_address", "model_no", "site_name", "-id", "-name", "-model_no", "-site_name"}
+	if input.Search != "" {
+		input.Filters.SortSafelist = append(input.Filters.SortSafelist, "relevance", "-relevance")
+	}
 
-	if data.ValidateFilters(v, input.Filters); !v.Valid() {
-		app.failedValidationResponse(w, r, v.Errors)
-		return
+	data.ValidateProjection(v, input.Projection)
+	data.ValidateFilters(v, input.Filters)
+	return input, err
+}
+
+// readCameraFilter reads the filters shared by every endpoint which selects cameras:
+// name, mac_address, model_no, site_name, status, search and q. Failed checks are recorded in
+// v, and a q= expression which doesn't parse is returned as a *query.Error.
+func (app *application) readCameraFilter(qs url.Values, v *validator.Validator) (data.CameraFilter, error) {
+	var filter data.CameraFilter
+
+	// Use helpers to extract information, falling back to defaults if needed
+	filter.Name = app.readString(qs, "name", "")
+	filter.MacAddress = app.readString(qs, "mac_address", "")
+	filter.ModelNo = app.readString(qs, "model_no", "")
+	filter.SiteName = app.readString(qs, "site_name", "")
+	filter.Status = app.readString(qs, "status", "")
+	if filter.Status != "" {
+		data.ValidateStatus(v, filter.Status)
+	}
+	filter.Search = app.readString(qs, "search", "")
+	if filter.Search != "" {
+		data.ValidateSearch(v, filter.Search)
 	}
 
-	if !v.Valid() {
-		app.failedValidationResponse(w, r, v.Errors)
-		return
+	// Parse the q= filter expression, if any
+	if q := app.readString(qs, "q", ""); q != "" {
+		cq, err := data.ParseCameraQuery(q)
+		if err != nil {
+			return filter, err
+		}
+		filter.Query = cq
 	}
-	cameras, err := app.models.Cameras.GetAll(input.Name, input.MacAddress, input.ModelNo, input.SiteName, input.Filters)
+	return filter, nil
+}
+
+// listCameras writes the page of cameras selected by input.
+func (app *application) listCameras(w http.ResponseWriter, r *http.Request, input cameraListInput) {
+	cameras, metadata, err := app.models.Cameras.GetAll(input.CameraFilter, input.Projection, input.Filters)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 		return
 	}
 
-	err = app.writeJSON(w, http.StatusOK, envelope{"cameras": cameras}, nil)
+	err = app.writeJSON(w, http.StatusOK, envelope{"cameras": renderCameras(cameras, input.Projection), "metadata": metadata}, nil)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 	}
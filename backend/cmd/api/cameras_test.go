@@ -0,0 +1,540 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/chefgoldbloom/pnctool/backend/internal/data"
+)
+
+func TestCreateCamera(t *testing.T) {
+	routes := newTestApplication(t).routes()
+
+	tests := []struct {
+		name   string
+		body   string
+		status int
+		fields []string
+	}{
+		{"valid", validCameraJSON, http.StatusCreated, nil},
+		{"empty body", "", http.StatusBadRequest, nil},
+		{"malformed", `{"name":`, http.StatusBadRequest, nil},
+		{"unknown field", `{"serial":"x"}`, http.StatusBadRequest, nil},
+		{"two values", validCameraJSON + validCameraJSON, http.StatusBadRequest, nil},
+		{"wrong type", `{"name":1}`, http.StatusBadRequest, nil},
+		{"invalid", `{"mac_address":"ACCC8E","site_name":"NYC"}`, http.StatusUnprocessableEntity, []string{"name", "mac_address", "site_name"}},
+		{"address", `{"name":"gate","mac_address":"ACCC8E000002","site_name":"NYC-5th-OPS","address":"10.0.0.7:8080"}`, http.StatusCreated, nil},
+		{"bad address", `{"name":"gate","mac_address":"ACCC8E000002","site_name":"NYC-5th-OPS","address":"cam 7/admin"}`, http.StatusUnprocessableEntity, []string{"address"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			res := do(t, routes, http.MethodPost, "/v1/cameras", tt.body)
+			if res.status != tt.status {
+				t.Fatalf("status = %d; want %d; body = %v", res.status, tt.status, res.body)
+			}
+
+			switch tt.status {
+			case http.StatusCreated:
+				var camera data.Camera
+				res.decode(t, "camera", &camera)
+				if camera.ID < 1 || camera.Version != 1 || camera.CreatedAt.IsZero() {
+					t.Errorf("camera = %+v", camera)
+				}
+				if loc := res.header.Get("Location"); loc != fmt.Sprintf("/v1/cameras/%d", camera.ID) {
+					t.Errorf("Location = %q", loc)
+				}
+			case http.StatusUnprocessableEntity:
+				var errs map[string]string
+				res.decode(t, "error", &errs)
+				for _, field := range tt.fields {
+					if errs[field] == "" {
+						t.Errorf("no error for %q in %v", field, errs)
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestShowCamera(t *testing.T) {
+	routes := newTestApplication(t).routes()
+	camera := createCamera(t, routes, validCameraJSON)
+
+	tests := []struct {
+		name   string
+		url    string
+		status int
+	}{
+		{"existing", fmt.Sprintf("/v1/cameras/%d", camera.ID), http.StatusOK},
+		{"missing", "/v1/cameras/999", http.StatusNotFound},
+		{"zero", "/v1/cameras/0", http.StatusNotFound},
+		{"negative", "/v1/cameras/-1", http.StatusNotFound},
+		{"not a number", "/v1/cameras/abc", http.StatusNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			res := do(t, routes, http.MethodGet, tt.url, "")
+			if res.status != tt.status {
+				t.Fatalf("status = %d; want %d", res.status, tt.status)
+			}
+			if tt.status == http.StatusOK {
+				var got data.Camera
+				res.decode(t, "camera", &got)
+				if got != camera {
+					t.Errorf("camera = %+v; want %+v", got, camera)
+				}
+			}
+		})
+	}
+}
+
+func TestUpdateCamera(t *testing.T) {
+	routes := newTestApplication(t).routes()
+	camera := createCamera(t, routes, validCameraJSON)
+	url := fmt.Sprintf("/v1/cameras/%d", camera.ID)
+
+	res := do(t, routes, http.MethodPatch, url, `{"name":"lobby-west","model_no":"P3265"}`)
+	if res.status != http.StatusOK {
+		t.Fatalf("status = %d; body = %v", res.status, res.body)
+	}
+	var updated data.Camera
+	res.decode(t, "camera", &updated)
+	if updated.Name != "lobby-west" || updated.ModelNo != "P3265" || updated.SiteName != camera.SiteName {
+		t.Errorf("updated = %+v", updated)
+	}
+	if updated.Version != camera.Version+1 {
+		t.Errorf("version = %d; want %d", updated.Version, camera.Version+1)
+	}
+
+	tests := []struct {
+		name   string
+		url    string
+		body   string
+		status int
+	}{
+		{"missing", "/v1/cameras/999", `{"name":"x"}`, http.StatusNotFound},
+		{"bad id", "/v1/cameras/abc", `{"name":"x"}`, http.StatusNotFound},
+		{"malformed", url, `{"name":`, http.StatusBadRequest},
+		{"unknown field", url, `{"username":"admin"}`, http.StatusBadRequest},
+		{"invalid", url, `{"mac_address":"short"}`, http.StatusUnprocessableEntity},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			res := do(t, routes, http.MethodPatch, tt.url, tt.body)
+			if res.status != tt.status {
+				t.Fatalf("status = %d; want %d; body = %v", res.status, tt.status, res.body)
+			}
+		})
+	}
+}
+
+func TestDeleteCamera(t *testing.T) {
+	routes := newTestApplication(t).routes()
+	camera := createCamera(t, routes, validCameraJSON)
+	url := fmt.Sprintf("/v1/cameras/%d", camera.ID)
+
+	if res := do(t, routes, http.MethodDelete, url, ""); res.status != http.StatusOK {
+		t.Fatalf("delete: status = %d", res.status)
+	}
+	if res := do(t, routes, http.MethodDelete, url, ""); res.status != http.StatusNotFound {
+		t.Errorf("second delete: status = %d; want %d", res.status, http.StatusNotFound)
+	}
+	if res := do(t, routes, http.MethodGet, url, ""); res.status != http.StatusNotFound {
+		t.Errorf("show after delete: status = %d; want %d", res.status, http.StatusNotFound)
+	}
+}
+
+func TestListCamerasByStatus(t *testing.T) {
+	app := newTestApplication(t)
+	routes := app.routes()
+
+	for i := 0; i < 3; i++ {
+		createCamera(t, routes, fmt.Sprintf(`{"name":"cam-%d","mac_address":"ACCC8E00000%d","site_name":"NYC-5th-OPS","address":"10.0.0.%d"}`, i, i, i))
+	}
+	checked := time.Now()
+	app.models.Statuses.Record(1, &data.CameraStatus{Status: data.StatusOnline, LastSeenAt: &checked, CheckedAt: checked})
+	app.models.Statuses.Record(2, &data.CameraStatus{Status: data.StatusOffline, CheckedAt: checked})
+
+	tests := []struct {
+		url    string
+		status int
+		names  string
+	}{
+		{"/v1/cameras?status=online", http.StatusOK, "[cam-0]"},
+		{"/v1/cameras?status=Offline", http.StatusOK, "[cam-1]"},
+		{"/v1/cameras?status=unknown", http.StatusOK, "[cam-2]"},
+		{"/v1/cameras?q=" + url.QueryEscape("NOT status:online"), http.StatusOK, "[cam-1 cam-2]"},
+		{"/v1/cameras?status=asleep", http.StatusUnprocessableEntity, ""},
+	}
+
+	for _, tt := range tests {
+		res := do(t, routes, http.MethodGet, tt.url, "")
+		if res.status != tt.status {
+			t.Errorf("%s: status = %d; want %d", tt.url, res.status, tt.status)
+			continue
+		}
+		if tt.status != http.StatusOK {
+			continue
+		}
+		var cameras []data.Camera
+		res.decode(t, "cameras", &cameras)
+		var names []string
+		for _, c := range cameras {
+			names = append(names, c.Name)
+		}
+		if fmt.Sprint(names) != tt.names {
+			t.Errorf("%s: names = %v; want %s", tt.url, names, tt.names)
+		}
+	}
+
+	// include=status embeds the last check
+	res := do(t, routes, http.MethodGet, "/v1/cameras/2?include=status", "")
+	var camera data.Camera
+	res.decode(t, "camera", &camera)
+	if camera.Status == nil || camera.Status.Status != data.StatusOffline || camera.Status.LastSeenAt != nil {
+		t.Errorf("status = %+v; want offline, never seen", camera.Status)
+	}
+}
+
+func TestListCameras(t *testing.T) {
+	routes := newTestApplication(t).routes()
+
+	sites := []string{"NYC-5th-OPS", "NYC-5th-OPS", "BOS-Main-GLH", "NYC-5th-OPS", "BOS-Main-GLH"}
+	for i, site := range sites {
+		createCamera(t, routes, fmt.Sprintf(`{"name":"cam-%d","mac_address":"ACCC8E00000%d","site_name":%q}`, i, i, site))
+	}
+
+	tests := []struct {
+		name     string
+		url      string
+		status   int
+		names    []string
+		lastPage int
+	}{
+		{"all", "/v1/cameras", http.StatusOK, []string{"cam-0", "cam-1", "cam-2", "cam-3", "cam-4"}, 1},
+		{"site filter", "/v1/cameras?site_name=bos-main-glh", http.StatusOK, []string{"cam-2", "cam-4"}, 1},
+		{"sort desc", "/v1/cameras?sort=-name&page_size=2", http.StatusOK, []string{"cam-4", "cam-3"}, 3},
+		{"second page", "/v1/cameras?page=2&page_size=2", http.StatusOK, []string{"cam-2", "cam-3"}, 3},
+		{"past the end", "/v1/cameras?page=9&page_size=2", http.StatusOK, []string{}, 3},
+		{"no match", "/v1/cameras?name=nope", http.StatusOK, []string{}, 0},
+		{"bad page", "/v1/cameras?page=abc", http.StatusUnprocessableEntity, nil, 0},
+		{"bad page size", "/v1/cameras?page_size=101", http.StatusUnprocessableEntity, nil, 0},
+		{"bad sort", "/v1/cameras?sort=password", http.StatusUnprocessableEntity, nil, 0},
+		{"query", "/v1/cameras?q=" + url.QueryEscape("site_name:NYC-* (name:cam-0 OR name:cam-3)"), http.StatusOK, []string{"cam-0", "cam-3"}, 1},
+		{"query and filter", "/v1/cameras?site_name=BOS-Main-GLH&q=" + url.QueryEscape("NOT name:*2"), http.StatusOK, []string{"cam-4"}, 1},
+		{"query comparison", "/v1/cameras?q=" + url.QueryEscape("id:>=4 version:1"), http.StatusOK, []string{"cam-3", "cam-4"}, 1},
+		{"bad query", "/v1/cameras?q=" + url.QueryEscape("name:a OR"), http.StatusUnprocessableEntity, nil, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			res := do(t, routes, http.MethodGet, tt.url, "")
+			if res.status != tt.status {
+				t.Fatalf("status = %d; want %d; body = %v", res.status, tt.status, res.body)
+			}
+			if tt.status != http.StatusOK {
+				return
+			}
+
+			var cameras []data.Camera
+			res.decode(t, "cameras", &cameras)
+			names := []string{}
+			for _, c := range cameras {
+				names = append(names, c.Name)
+			}
+			if fmt.Sprint(names) != fmt.Sprint(tt.names) {
+				t.Errorf("names = %v; want %v", names, tt.names)
+			}
+
+			var metadata data.Metadata
+			res.decode(t, "metadata", &metadata)
+			if metadata.LastPage != tt.lastPage {
+				t.Errorf("last_page = %d; want %d", metadata.LastPage, tt.lastPage)
+			}
+		})
+	}
+}
+
+func TestProblemJSON(t *testing.T) {
+	routes := newTestApplication(t).routes()
+
+	res := do(t, routes, http.MethodPost, "/v1/cameras", `{}`, "Accept", problemContentType)
+	if res.status != http.StatusUnprocessableEntity {
+		t.Fatalf("status = %d", res.status)
+	}
+
+	var code string
+	res.decode(t, "code", &code)
+	if code != codeValidationFailed {
+		t.Errorf("code = %q; want %q", code, codeValidationFailed)
+	}
+
+	var errs []fieldError
+	res.decode(t, "errors", &errs)
+	got := map[string]string{}
+	for _, fe := range errs {
+		got[fe.Field] = fe.Code
+	}
+	if got["name"] != "required" || got["mac_address"] != "bad_length" || got["site_name"] != "bad_format" {
+		t.Errorf("field codes = %v", got)
+	}
+}
+
+func TestInvalidQuery(t *testing.T) {
+	routes := newTestApplication(t).routes()
+
+	res := do(t, routes, http.MethodGet, "/v1/cameras?q="+url.QueryEscape("name:a serial:1"), "", "Accept", problemContentType)
+	if res.status != http.StatusUnprocessableEntity {
+		t.Fatalf("status = %d", res.status)
+	}
+
+	var (
+		code     string
+		position int
+	)
+	res.decode(t, "code", &code)
+	res.decode(t, "position", &position)
+	if code != codeInvalidQuery || position != 8 {
+		t.Errorf("code = %q, position = %d; want %q, 8", code, position, codeInvalidQuery)
+	}
+}
+
+func TestConditionalRequests(t *testing.T) {
+	routes := newTestApplication(t).routes()
+	camera := createCamera(t, routes, validCameraJSON)
+	url := fmt.Sprintf("/v1/cameras/%d", camera.ID)
+	etag := cameraETag(&camera)
+
+	res := do(t, routes, http.MethodGet, url, "")
+	if res.header.Get("ETag") != etag {
+		t.Fatalf("ETag = %q; want %q", res.header.Get("ETag"), etag)
+	}
+
+	if res := do(t, routes, http.MethodGet, url, "", "If-None-Match", etag); res.status != http.StatusNotModified {
+		t.Errorf("If-None-Match current: status = %d; want 304", res.status)
+	}
+	if res := do(t, routes, http.MethodGet, url, "", "If-None-Match", `W/`+etag); res.status != http.StatusNotModified {
+		t.Errorf("If-None-Match weak: status = %d; want 304", res.status)
+	}
+
+	// Two technicians load version 1. The first edit wins, the second is refused.
+	res = do(t, routes, http.MethodPatch, url, `{"name":"first"}`, "If-Match", etag)
+	if res.status != http.StatusOK {
+		t.Fatalf("first edit: status = %d", res.status)
+	}
+	newETag := res.header.Get("ETag")
+	if newETag == etag || newETag == "" {
+		t.Errorf("ETag after edit = %q", newETag)
+	}
+	if res := do(t, routes, http.MethodPatch, url, `{"name":"second"}`, "If-Match", etag); res.status != http.StatusPreconditionFailed {
+		t.Errorf("stale edit: status = %d; want 412", res.status)
+	}
+	if res := do(t, routes, http.MethodGet, url, "", "If-None-Match", etag); res.status != http.StatusOK {
+		t.Errorf("If-None-Match stale: status = %d; want 200", res.status)
+	}
+
+	if res := do(t, routes, http.MethodDelete, url, "", "If-Match", etag); res.status != http.StatusPreconditionFailed {
+		t.Errorf("stale delete: status = %d; want 412", res.status)
+	}
+	if res := do(t, routes, http.MethodDelete, url, "", "If-Match", `"x", `+newETag); res.status != http.StatusOK {
+		t.Errorf("current delete: status = %d; want 200", res.status)
+	}
+}
+
+func TestConditionalRequestsWithProjection(t *testing.T) {
+	app := newTestApplication(t)
+	routes := app.routes()
+	camera := createCamera(t, routes, validCameraJSON)
+	url := fmt.Sprintf("/v1/cameras/%d", camera.ID)
+
+	checked := time.Now().Add(-time.Minute)
+	app.models.Statuses.Record(camera.ID, &data.CameraStatus{Status: data.StatusOnline, LastSeenAt: &checked, CheckedAt: checked})
+
+	full := do(t, routes, http.MethodGet, url, "").header.Get("ETag")
+	sparse := do(t, routes, http.MethodGet, url+"?fields=name,site_name", "").header.Get("ETag")
+	reordered := do(t, routes, http.MethodGet, url+"?fields=site_name,name", "").header.Get("ETag")
+	if sparse == full || !strings.HasPrefix(sparse, "W/") {
+		t.Errorf("sparse ETag = %q; full = %q", sparse, full)
+	}
+	if reordered != sparse {
+		t.Errorf("reordered fields ETag = %q; want %q", reordered, sparse)
+	}
+	if res := do(t, routes, http.MethodGet, url+"?fields=name,site_name", "", "If-None-Match", full); res.status != http.StatusOK {
+		t.Errorf("sparse with full ETag: status = %d; want 200", res.status)
+	}
+	if res := do(t, routes, http.MethodPatch, url, `{"name":"x"}`, "If-Match", sparse); res.status != http.StatusPreconditionFailed {
+		t.Errorf("edit with weak ETag: status = %d; want 412", res.status)
+	}
+
+	res := do(t, routes, http.MethodGet, url+"?include=status", "")
+	etag := res.header.Get("ETag")
+	if res := do(t, routes, http.MethodGet, url+"?include=status", "", "If-None-Match", etag); res.status != http.StatusNotModified {
+		t.Errorf("unchanged status: status = %d; want 304", res.status)
+	}
+
+	// The poller records a new check. The version doesn't change, but the cached
+	// status is stale.
+	checked = time.Now()
+	app.models.Statuses.Record(camera.ID, &data.CameraStatus{Status: data.StatusOffline, CheckedAt: checked})
+
+	res = do(t, routes, http.MethodGet, url+"?include=status", "", "If-None-Match", etag)
+	if res.status != http.StatusOK {
+		t.Fatalf("changed status: status = %d; want 200", res.status)
+	}
+	var got data.Camera
+	res.decode(t, "camera", &got)
+	if got.Version != camera.Version || got.Status == nil || got.Status.Status != data.StatusOffline {
+		t.Errorf("camera = %+v, status = %+v; want version %d, offline", got, got.Status, camera.Version)
+	}
+	if res.header.Get("ETag") == etag {
+		t.Errorf("ETag unchanged after status change: %q", etag)
+	}
+}
+
+func TestPatchFormats(t *testing.T) {
+	routes := newTestApplication(t).routes()
+
+	tests := []struct {
+		name        string
+		contentType string
+		body        string
+		status      int
+		wantName    string
+		wantModel   string
+	}{
+		{"plain json", "application/json", `{"name":"lobby-west"}`, http.StatusOK, "lobby-west", "P3245"},
+		{"merge patch", mergePatchContentType, `{"name":"lobby-west","model_no":null}`, http.StatusOK, "lobby-west", ""},
+		{"json patch", jsonPatchContentType, `[{"op":"test","path":"/version","value":1},{"op":"replace","path":"/name","value":"lobby-west"}]`, http.StatusOK, "lobby-west", "P3245"},
+		{"json patch copy", jsonPatchContentType + "; charset=utf-8", `[{"op":"copy","from":"/name","path":"/model_no"}]`, http.StatusOK, "lobby-east", "lobby-east"},
+		{"failed test", jsonPatchContentType, `[{"op":"test","path":"/version","value":7},{"op":"replace","path":"/name","value":"x"}]`, http.StatusConflict, "", ""},
+		{"missing path", jsonPatchContentType, `[{"op":"remove","path":"/nope"}]`, http.StatusBadRequest, "", ""},
+		{"unknown member", jsonPatchContentType, `[{"op":"add","path":"/password","value":"x"}]`, http.StatusBadRequest, "", ""},
+		{"read only", mergePatchContentType, `{"version":9}`, http.StatusUnprocessableEntity, "", ""},
+		{"read only removed", jsonPatchContentType, `[{"op":"remove","path":"/id"}]`, http.StatusUnprocessableEntity, "", ""},
+		{"invalid", mergePatchContentType, `{"name":null}`, http.StatusUnprocessableEntity, "", ""},
+		{"unsupported", "text/plain", `name=x`, http.StatusUnsupportedMediaType, "", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			camera := createCamera(t, routes, validCameraJSON)
+			url := fmt.Sprintf("/v1/cameras/%d", camera.ID)
+
+			res := do(t, routes, http.MethodPatch, url, tt.body, "Content-Type", tt.contentType)
+			if res.status != tt.status {
+				t.Fatalf("status = %d; want %d; body = %v", res.status, tt.status, res.body)
+			}
+			if tt.status != http.StatusOK {
+				return
+			}
+
+			var updated data.Camera
+			res.decode(t, "camera", &updated)
+			if updated.Name != tt.wantName || updated.ModelNo != tt.wantModel || updated.Version != 2 {
+				t.Errorf("updated = %+v", updated)
+			}
+		})
+	}
+}
+
+func TestReplaceCamera(t *testing.T) {
+	routes := newTestApplication(t).routes()
+	camera := createCamera(t, routes, validCameraJSON)
+	url := fmt.Sprintf("/v1/cameras/%d", camera.ID)
+
+	res := do(t, routes, http.MethodPut, url, `{"name":"gate","mac_address":"ACCC8E0000FF","site_name":"BOS-Main-GLH"}`)
+	if res.status != http.StatusOK {
+		t.Fatalf("status = %d; body = %v", res.status, res.body)
+	}
+	var replaced data.Camera
+	res.decode(t, "camera", &replaced)
+	if replaced.Name != "gate" || replaced.SiteName != "BOS-Main-GLH" || replaced.ModelNo != "" || replaced.ID != camera.ID || replaced.Version != 2 {
+		t.Errorf("replaced = %+v", replaced)
+	}
+
+	tests := []struct {
+		name   string
+		body   string
+		status int
+	}{
+		{"missing required", `{"name":"gate"}`, http.StatusUnprocessableEntity},
+		{"matching read only", fmt.Sprintf(`{"id":%d,"version":2,"name":"gate","mac_address":"ACCC8E0000FF","site_name":"BOS-Main-GLH"}`, camera.ID), http.StatusOK},
+		{"changed read only", `{"id":99,"name":"gate","mac_address":"ACCC8E0000FF","site_name":"BOS-Main-GLH"}`, http.StatusUnprocessableEntity},
+		{"unknown field", `{"serial":"x"}`, http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			res := do(t, routes, http.MethodPut, url, tt.body)
+			if res.status != tt.status {
+				t.Errorf("status = %d; want %d; body = %v", res.status, tt.status, res.body)
+			}
+		})
+	}
+}
+
+func TestCameraProjection(t *testing.T) {
+	routes := newTestApplication(t).routes()
+	camera := createCamera(t, routes, validCameraJSON)
+	url := fmt.Sprintf("/v1/cameras/%d", camera.ID)
+
+	tests := []struct {
+		name   string
+		url    string
+		status int
+		keys   []string
+	}{
+		{"full", url, http.StatusOK, []string{"address", "created_at", "id", "mac_address", "model_no", "name", "site_name", "version"}},
+		{"sparse", url + "?fields=name", http.StatusOK, []string{"id", "name"}},
+		{"sparse include", url + "?fields=name,site_name&include=site", http.StatusOK, []string{"id", "name", "site", "site_name"}},
+		{"include only", url + "?include=site", http.StatusOK, []string{"address", "created_at", "id", "mac_address", "model_no", "name", "site", "site_name", "version"}},
+		{"list sparse", "/v1/cameras?fields=mac_address", http.StatusOK, []string{"id", "mac_address"}},
+		{"unknown field", url + "?fields=password", http.StatusUnprocessableEntity, nil},
+		{"unknown include", "/v1/cameras?include=vendor", http.StatusUnprocessableEntity, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			res := do(t, routes, http.MethodGet, tt.url, "")
+			if res.status != tt.status {
+				t.Fatalf("status = %d; want %d; body = %v", res.status, tt.status, res.body)
+			}
+			if tt.status != http.StatusOK {
+				return
+			}
+
+			var got map[string]json.RawMessage
+			if _, ok := res.body["cameras"]; ok {
+				var cameras []map[string]json.RawMessage
+				res.decode(t, "cameras", &cameras)
+				got = cameras[0]
+			} else {
+				res.decode(t, "camera", &got)
+			}
+			keys := make([]string, 0, len(got))
+			for k := range got {
+				keys = append(keys, k)
+			}
+			slices.Sort(keys)
+			if !slices.Equal(keys, tt.keys) {
+				t.Errorf("keys = %v; want %v", keys, tt.keys)
+			}
+		})
+	}
+
+	// The site is described from its name when there's no sites row for it.
+	res := do(t, routes, http.MethodGet, url+"?include=site", "")
+	var withSite data.Camera
+	res.decode(t, "camera", &withSite)
+	if withSite.Site == nil || withSite.Site.City != "NYC" || withSite.Site.OfficeType != "OPS" {
+		t.Errorf("site = %+v", withSite.Site)
+	}
+}
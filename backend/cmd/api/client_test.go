@@ -0,0 +1,120 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/chefgoldbloom/pnctool/backend/internal/data"
+	"github.com/chefgoldbloom/pnctool/backend/pkg/client"
+)
+
+// TestClientAgainstHandlers drives pkg/client against the real handlers, so the SDK
+// and the API can't drift apart.
+func TestClientAgainstHandlers(t *testing.T) {
+	srv := httptest.NewServer(newTestApplication(t).routes())
+	defer srv.Close()
+
+	ctx := context.Background()
+	c, err := client.New(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	created, err := c.CreateCamera(ctx, client.CameraInput{Name: "lobby-east", MacAddress: "ACCC8E000001", SiteName: "NYC-5th-OPS"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := c.GetCamera(ctx, created.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if *got != *created {
+		t.Errorf("GetCamera = %+v; want %+v", got, created)
+	}
+
+	name := "lobby-west"
+	updated, err := c.UpdateCameraVersion(ctx, created.ID, created.Version, client.CameraPatch{Name: &name})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if updated.Name != name || updated.Version != created.Version+1 {
+		t.Errorf("updated = %+v", updated)
+	}
+
+	_, err = c.UpdateCameraVersion(ctx, created.ID, created.Version, client.CameraPatch{Name: &name})
+	if !errors.Is(err, client.ErrEditConflict) {
+		t.Errorf("stale update: err = %v; want ErrEditConflict", err)
+	}
+
+	_, err = c.CreateCamera(ctx, client.CameraInput{})
+	var apiErr *client.APIError
+	if !errors.As(err, &apiErr) || !errors.Is(err, client.ErrValidation) || apiErr.FieldCodes["name"] != "required" {
+		t.Errorf("invalid create: err = %v", err)
+	}
+
+	for i := 0; i < 4; i++ {
+		if _, err := c.CreateCamera(ctx, client.CameraInput{Name: "spare", MacAddress: "ACCC8E00000F", SiteName: "BOS-Main-GLH"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	count := 0
+	it := c.Cameras(ctx, client.ListOptions{PageSize: 2})
+	for it.Next() {
+		count++
+	}
+	if err := it.Err(); err != nil || count != 5 {
+		t.Errorf("iterated %d cameras, err = %v; want 5", count, err)
+	}
+
+	found, _, err := c.ListCameras(ctx, client.ListOptions{Search: "lobby", Query: "site_name:NYC-*"})
+	if err != nil || len(found) != 1 || found[0].ID != created.ID || found[0].Search == nil {
+		t.Errorf("search = %+v, err = %v", found, err)
+	}
+	suggestions, err := c.Suggest(ctx, "spa", 5)
+	if err != nil || len(suggestions) != 1 || suggestions[0].Cameras != 4 {
+		t.Errorf("suggest = %+v, err = %v", suggestions, err)
+	}
+
+	if err := c.DeleteCamera(ctx, created.ID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.GetCamera(ctx, created.ID); !errors.Is(err, client.ErrNotFound) {
+		t.Errorf("get deleted: err = %v; want ErrNotFound", err)
+	}
+}
+
+// Routes which need to know who is asking accept the SDK's WithUser and WithTeam.
+func TestClientIdentity(t *testing.T) {
+	srv := httptest.NewServer(newTestApplication(t).routes())
+	defer srv.Close()
+	ctx := context.Background()
+
+	anonymous, err := client.New(srv.URL, client.WithToken("s3cret"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = anonymous.Do(ctx, http.MethodGet, "/v1/views", nil, nil, nil, nil)
+	var apiErr *client.APIError
+	if !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusUnauthorized {
+		t.Fatalf("anonymous: err = %v; want 401", err)
+	}
+
+	c, err := client.New(srv.URL, client.WithUser("ana"), client.WithTeam("east"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var created struct {
+		View data.View `json:"view"`
+	}
+	body := map[string]any{"name": "lobbies", "visibility": "team", "params": map[string]any{"name": "lobby"}}
+	if _, err := c.Do(ctx, http.MethodPost, "/v1/views", nil, body, nil, &created); err != nil {
+		t.Fatal(err)
+	}
+	if created.View.Owner != "ana" || created.View.Team != "east" {
+		t.Errorf("created view = %+v; want owned by ana in east", created.View)
+	}
+}
@@ -0,0 +1,31 @@
+package main
+
+import (
+	"context"
+	"net/http"
+)
+
+// contextKey is a private type for the keys this package stores in request contexts.
+type contextKey string
+
+const identityContextKey = contextKey("identity")
+
+// identity is who a request was made by. There's no authentication in this service
+// yet: the user and team are taken from the X-User and X-Team headers, which the
+// authenticating proxy in front of the API is trusted to set.
+type identity struct {
+	User string
+	Team string
+}
+
+func (app *application) contextSetIdentity(r *http.Request, id identity) *http.Request {
+	ctx := context.WithValue(r.Context(), identityContextKey, id)
+	return r.WithContext(ctx)
+}
+
+// contextGetIdentity returns the request's identity. Requests which didn't pass
+// through the identify middleware are anonymous.
+func (app *application) contextGetIdentity(r *http.Request) identity {
+	id, _ := r.Context().Value(identityContextKey).(identity)
+	return id
+}
@@ -2,9 +2,50 @@ package main
 
 import (
 	"fmt"
+	"mime"
 	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/chefgoldbloom/pnctool/backend/internal/query"
+	"github.com/chefgoldbloom/pnctool/backend/internal/validator"
+)
+
+// Stable, machine-readable error codes. These are included in both the legacy and
+// the problem+json error formats and must not change once published.
+const (
+	codeServerError      = "server_error"
+	codeNotFound         = "not_found"
+	codeMethodNotAllowed = "method_not_allowed"
+	codeBadRequest       = "bad_request"
+	codeValidationFailed = "validation_failed"
+	codeEditConflict     = "edit_conflict"
+	codePrecondition     = "precondition_failed"
+	codeUnsupportedMedia = "unsupported_media_type"
+	codePatchTestFailed  = "patch_test_failed"
+	codeIdempotencyReuse = "idempotency_key_reused"
+	codeIdempotencyBusy  = "idempotency_key_in_progress"
+	codeBatchRolledBack  = "batch_rolled_back"
+	codeInvalidQuery     = "invalid_query"
+	codeAuthRequired     = "authentication_required"
+	codeForbidden        = "forbidden"
+	codeResourceInUse    = "resource_in_use"
 )
 
+// problemTypePrefix is prepended to an error code to build the RFC 7807 "type" member.
+const problemTypePrefix = "urn:pnctool:problem:"
+
+// problemContentType is the media type for RFC 7807 problem details documents.
+const problemContentType = "application/problem+json"
+
+// fieldError describes a single failed validation check in a problem+json response.
+type fieldError struct {
+	Field  string `json:"field"`
+	Code   string `json:"code"`
+	Detail string `json:"detail"`
+}
+
 // The logError() method is a generic helper for logging an error message along
 // with the current request method and URL as attributes in the log entry.
 func (app *application) logError(r *http.Request, err error) {
@@ -16,9 +57,55 @@ func (app *application) logError(r *http.Request, err error) {
 	app.logger.Error(err.Error(), "method", method, "uri", uri)
 }
 
-func (app *application) errorResponse(w http.ResponseWriter, r *http.Request, status int, message any) {
-	env := envelope{"error": message}
-	err := app.writeJSON(w, status, env, nil)
+// wantsProblemJSON reports whether the client listed application/problem+json in its
+// Accept header, other than with q=0. Clients that don't ask for it, including those
+// accepting */*, keep getting the legacy format.
+func wantsProblemJSON(r *http.Request) bool {
+	for _, accept := range r.Header.Values("Accept") {
+		for _, part := range strings.Split(accept, ",") {
+			mediaType, params, err := mime.ParseMediaType(strings.TrimSpace(part))
+			if err != nil || mediaType != problemContentType {
+				continue
+			}
+			if q, err := strconv.ParseFloat(params["q"], 64); err == nil && q == 0 {
+				continue
+			}
+			return true
+		}
+	}
+	return false
+}
+
+// errorResponse sends an error to the client in the format it asked for. The legacy
+// format is {"error": message, "code": code}; the problem format is an RFC 7807 problem
+// details document. A non-string message is only used by the legacy format, problem
+// responses carry extra members through the extra envelope instead.
+func (app *application) errorResponse(w http.ResponseWriter, r *http.Request, status int, code string, message any, extra envelope) {
+	var (
+		env     envelope
+		headers http.Header
+	)
+
+	if wantsProblemJSON(r) {
+		env = envelope{
+			"type":     problemTypePrefix + code,
+			"title":    http.StatusText(status),
+			"status":   status,
+			"instance": r.URL.RequestURI(),
+			"code":     code,
+		}
+		if detail, ok := message.(string); ok {
+			env["detail"] = detail
+		}
+		for k, v := range extra {
+			env[k] = v
+		}
+		headers = http.Header{"Content-Type": []string{problemContentType}}
+	} else {
+		env = envelope{"error": message, "code": code}
+	}
+
+	err := app.writeJSON(w, status, env, headers)
 	if err != nil {
 		app.logError(r, err)
 		w.WriteHeader(500)
@@ -29,28 +116,95 @@ func (app *application) serverErrorResponse(w http.ResponseWriter, r *http.Reque
 	app.logError(r, err)
 
 	message := "the server encountered a problem and could not process your request"
-	app.errorResponse(w, r, http.StatusInternalServerError, message)
+	app.errorResponse(w, r, http.StatusInternalServerError, codeServerError, message, nil)
 }
 
 func (app *application) notFoundResponse(w http.ResponseWriter, r *http.Request) {
 	message := "the requested resource could not be found"
-	app.errorResponse(w, r, http.StatusNotFound, message)
+	app.errorResponse(w, r, http.StatusNotFound, codeNotFound, message, nil)
 }
 
 func (app *application) methodNotAllowedResponse(w http.ResponseWriter, r *http.Request) {
 	message := fmt.Sprintf("the %s method is not supported for this resource", r.Method)
-	app.errorResponse(w, r, http.StatusMethodNotAllowed, message)
+	app.errorResponse(w, r, http.StatusMethodNotAllowed, codeMethodNotAllowed, message, nil)
 }
 
 func (app *application) badRequestResponse(w http.ResponseWriter, r *http.Request, err error) {
-	app.errorResponse(w, r, http.StatusBadRequest, err.Error())
+	app.errorResponse(w, r, http.StatusBadRequest, codeBadRequest, err.Error(), nil)
 }
 
-func (app *application) failedValidationResponse(w http.ResponseWriter, r *http.Request, errors map[string]string) {
-	app.errorResponse(w, r, http.StatusUnprocessableEntity, errors)
+// failedValidationResponse reports every failed check in v. Legacy clients get the
+// field -> message map they always have; problem clients get one entry per field
+// with its validation code.
+func (app *application) failedValidationResponse(w http.ResponseWriter, r *http.Request, v *validator.Validator) {
+	fields := make([]string, 0, len(v.Errors))
+	for field := range v.Errors {
+		fields = append(fields, field)
+	}
+	sort.Strings(fields)
+
+	fieldErrors := make([]fieldError, 0, len(fields))
+	for _, field := range fields {
+		fieldErrors = append(fieldErrors, fieldError{Field: field, Code: v.Code(field), Detail: v.Errors[field]})
+	}
+
+	extra := envelope{
+		"detail": "one or more fields failed validation",
+		"errors": fieldErrors,
+	}
+	app.errorResponse(w, r, http.StatusUnprocessableEntity, codeValidationFailed, v.Errors, extra)
 }
 
 func (app *application) editConflictResponse(w http.ResponseWriter, r *http.Request) {
 	message := "there was an edit conflict during this operation, please try again"
-	app.errorResponse(w, r, http.StatusConflict, message)
+	app.errorResponse(w, r, http.StatusConflict, codeEditConflict, message, nil)
+}
+
+func (app *application) preconditionFailedResponse(w http.ResponseWriter, r *http.Request) {
+	message := "the resource has been modified since you last fetched it, please fetch it again"
+	app.errorResponse(w, r, http.StatusPreconditionFailed, codePrecondition, message, nil)
+}
+
+func (app *application) unsupportedMediaTypeResponse(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Accept-Patch", acceptPatch)
+	message := fmt.Sprintf("the %q content type is not supported for this resource", r.Header.Get("Content-Type"))
+	app.errorResponse(w, r, http.StatusUnsupportedMediaType, codeUnsupportedMedia, message, nil)
+}
+
+// patchTestFailedResponse reports a JSON Patch "test" operation which didn't match the
+// current resource, so none of the patch was applied.
+func (app *application) patchTestFailedResponse(w http.ResponseWriter, r *http.Request, err error) {
+	app.errorResponse(w, r, http.StatusConflict, codePatchTestFailed, err.Error(), nil)
+}
+
+func (app *application) idempotencyKeyReusedResponse(w http.ResponseWriter, r *http.Request) {
+	message := "this Idempotency-Key has already been used for a different request"
+	app.errorResponse(w, r, http.StatusUnprocessableEntity, codeIdempotencyReuse, message, nil)
+}
+
+func (app *application) idempotencyInProgressResponse(w http.ResponseWriter, r *http.Request) {
+	message := "a request with this Idempotency-Key is still being processed, please retry later"
+	app.errorResponse(w, r, http.StatusConflict, codeIdempotencyBusy, message, nil)
+}
+
+// invalidQueryResponse reports a q= expression which couldn't be parsed. Problem
+// clients also get the 1-based character position of the error.
+func (app *application) invalidQueryResponse(w http.ResponseWriter, r *http.Request, err *query.Error) {
+	app.errorResponse(w, r, http.StatusUnprocessableEntity, codeInvalidQuery, "invalid q parameter "+err.Error(), envelope{"position": err.Pos})
+}
+
+func (app *application) authenticationRequiredResponse(w http.ResponseWriter, r *http.Request) {
+	message := "you must identify yourself with the X-User header to access this resource"
+	app.errorResponse(w, r, http.StatusUnauthorized, codeAuthRequired, message, nil)
+}
+
+func (app *application) notPermittedResponse(w http.ResponseWriter, r *http.Request) {
+	message := "you don't have permission to change this resource"
+	app.errorResponse(w, r, http.StatusForbidden, codeForbidden, message, nil)
+}
+
+// resourceInUseResponse reports a resource which can't be deleted while something
+// else refers to it.
+func (app *application) resourceInUseResponse(w http.ResponseWriter, r *http.Request, message string) {
+	app.errorResponse(w, r, http.StatusConflict, codeResourceInUse, message, nil)
 }
@@ -0,0 +1,39 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestWantsProblemJSON(t *testing.T) {
+	tests := []struct {
+		accept []string
+		want   bool
+	}{
+		{nil, false},
+		{[]string{"application/json"}, false},
+		{[]string{"*/*"}, false},
+		{[]string{"application/*"}, false},
+		{[]string{"application/problem+json"}, true},
+		{[]string{"Application/Problem+JSON"}, true},
+		{[]string{"application/json, application/problem+json"}, true},
+		{[]string{"application/json", "application/problem+json"}, true},
+		{[]string{"application/problem+json;q=0.5, */*;q=0.1"}, true},
+		{[]string{"application/problem+json; q=1.0"}, true},
+		{[]string{"application/problem+json;q=0"}, false},
+		{[]string{"application/problem+json;q=0.000, application/json"}, false},
+		{[]string{"application/problem+json;q=high"}, true},
+		{[]string{"application/problem+json/x"}, false},
+	}
+
+	for _, tt := range tests {
+		r := httptest.NewRequest(http.MethodGet, "/v1/cameras", nil)
+		for _, accept := range tt.accept {
+			r.Header.Add("Accept", accept)
+		}
+		if got := wantsProblemJSON(r); got != tt.want {
+			t.Errorf("Accept %q: wantsProblemJSON = %t; want %t", tt.accept, got, tt.want)
+		}
+	}
+}
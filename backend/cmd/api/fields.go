@@ -0,0 +1,51 @@
+package main
+
+import (
+	"encoding/json"
+	"net/url"
+	"slices"
+
+	"github.com/chefgoldbloom/pnctool/backend/internal/data"
+)
+
+// readProjection reads the fields= sparse fieldset and include= related resources
+// from the query string. Both are comma-separated lists.
+func (app *application) readProjection(qs url.Values) data.Projection {
+	return data.Projection{
+		Fields:  app.readCSV(qs, "fields", nil),
+		Include: app.readCSV(qs, "include", nil),
+	}
+}
+
+// renderCamera returns the representation of camera for a projection. Without a
+// sparse fieldset that's the camera itself; with one, only the requested fields, the
+// id, any included resources and the search match are kept.
+func renderCamera(camera *data.Camera, p data.Projection) any {
+	if len(p.Fields) == 0 {
+		return camera
+	}
+
+	js, err := json.Marshal(camera)
+	if err != nil {
+		// Camera always marshals; fall back to the full representation regardless.
+		return camera
+	}
+	var full map[string]json.RawMessage
+	json.Unmarshal(js, &full)
+
+	sparse := make(map[string]json.RawMessage, len(p.Fields)+len(p.Include)+1)
+	for name, value := range full {
+		if name == "id" || name == "search" || slices.Contains(p.Fields, name) || slices.Contains(p.Include, name) {
+			sparse[name] = value
+		}
+	}
+	return sparse
+}
+
+func renderCameras(cameras []*data.Camera, p data.Projection) []any {
+	out := make([]any, len(cameras))
+	for i, camera := range cameras {
+		out[i] = renderCamera(camera, p)
+	}
+	return out
+}
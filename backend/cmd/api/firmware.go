@@ -0,0 +1,233 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/chefgoldbloom/pnctool/backend/internal/data"
+	"github.com/chefgoldbloom/pnctool/backend/internal/validator"
+)
+
+// listFirmwareCatalogHandler for the "GET /v1/firmware-catalog" endpoint.
+func (app *application) listFirmwareCatalogHandler(w http.ResponseWriter, r *http.Request) {
+	entries, err := app.models.FirmwareCatalog.GetAll()
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"firmware_catalog": entries}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// createFirmwareCatalogEntryHandler for the "POST /v1/firmware-catalog" endpoint sets
+// the firmware a camera model should run.
+func (app *application) createFirmwareCatalogEntryHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		ModelNo            string `json:"model_no"`
+		RecommendedVersion string `json:"recommended_version"`
+		MinimumVersion     string `json:"minimum_version"`
+		Notes              string `json:"notes"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	entry := &data.FirmwareCatalogEntry{
+		ModelNo:            input.ModelNo,
+		RecommendedVersion: input.RecommendedVersion,
+		MinimumVersion:     input.MinimumVersion,
+		Notes:              input.Notes,
+	}
+
+	v := validator.New()
+	if data.ValidateFirmwareCatalogEntry(v, entry); !v.Valid() {
+		app.failedValidationResponse(w, r, v)
+		return
+	}
+
+	err = app.models.FirmwareCatalog.Insert(entry)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrDuplicateModelNo):
+			v.AddErrorCode("model_no", validator.CodeDuplicate, "the catalog already has an entry for this model")
+			app.failedValidationResponse(w, r, v)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	headers := make(http.Header)
+	headers.Set("Location", fmt.Sprintf("/v1/firmware-catalog/%d", entry.ID))
+
+	err = app.writeJSON(w, http.StatusCreated, envelope{"firmware_catalog_entry": entry}, headers)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// showFirmwareCatalogEntryHandler for the "GET /v1/firmware-catalog/:id" endpoint.
+func (app *application) showFirmwareCatalogEntryHandler(w http.ResponseWriter, r *http.Request) {
+	entry, ok := app.loadFirmwareCatalogEntry(w, r)
+	if !ok {
+		return
+	}
+
+	err := app.writeJSON(w, http.StatusOK, envelope{"firmware_catalog_entry": entry}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// updateFirmwareCatalogEntryHandler for the "PATCH /v1/firmware-catalog/:id"
+// endpoint.
+func (app *application) updateFirmwareCatalogEntryHandler(w http.ResponseWriter, r *http.Request) {
+	entry, ok := app.loadFirmwareCatalogEntry(w, r)
+	if !ok {
+		return
+	}
+
+	var input struct {
+		ModelNo            *string `json:"model_no"`
+		RecommendedVersion *string `json:"recommended_version"`
+		MinimumVersion     *string `json:"minimum_version"`
+		Notes              *string `json:"notes"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	if input.ModelNo != nil {
+		entry.ModelNo = *input.ModelNo
+	}
+	if input.RecommendedVersion != nil {
+		entry.RecommendedVersion = *input.RecommendedVersion
+	}
+	if input.MinimumVersion != nil {
+		entry.MinimumVersion = *input.MinimumVersion
+	}
+	if input.Notes != nil {
+		entry.Notes = *input.Notes
+	}
+
+	v := validator.New()
+	if data.ValidateFirmwareCatalogEntry(v, entry); !v.Valid() {
+		app.failedValidationResponse(w, r, v)
+		return
+	}
+
+	err = app.models.FirmwareCatalog.Update(entry)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrEditConflict):
+			app.editConflictResponse(w, r)
+		case errors.Is(err, data.ErrDuplicateModelNo):
+			v.AddErrorCode("model_no", validator.CodeDuplicate, "the catalog already has an entry for this model")
+			app.failedValidationResponse(w, r, v)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"firmware_catalog_entry": entry}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// deleteFirmwareCatalogEntryHandler for the "DELETE /v1/firmware-catalog/:id"
+// endpoint. Cameras of the model become uncatalogued.
+func (app *application) deleteFirmwareCatalogEntryHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	err = app.models.FirmwareCatalog.Delete(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"message": "firmware catalog entry successfully deleted"}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// loadFirmwareCatalogEntry fetches the catalog entry named in the URL, sending a 404
+// if there's no such entry.
+func (app *application) loadFirmwareCatalogEntry(w http.ResponseWriter, r *http.Request) (*data.FirmwareCatalogEntry, bool) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return nil, false
+	}
+
+	entry, err := app.models.FirmwareCatalog.Get(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return nil, false
+	}
+	return entry, true
+}
+
+// showCameraFirmwareHandler for the "GET /v1/cameras/:id/firmware" endpoint returns
+// the firmware the camera last reported, null if it hasn't reported any, and every
+// change of firmware seen, oldest first.
+func (app *application) showCameraFirmwareHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	_, err = app.models.Cameras.Get(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	firmware, err := app.models.Firmware.Get(id)
+	if err != nil && !errors.Is(err, data.ErrRecordNotFound) {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	history, err := app.models.Firmware.History(id)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"firmware": firmware, "history": history}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
@@ -0,0 +1,239 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/chefgoldbloom/pnctool/backend/internal/data"
+)
+
+func TestFirmwareCatalog(t *testing.T) {
+	app := newTestApplication(t)
+	routes := app.routes()
+
+	res := do(t, routes, http.MethodPost, "/v1/firmware-catalog", `{"model_no":"P3245-LV","recommended_version":"10.12.114","minimum_version":"10.9","notes":"CVE-2025-0001"}`, "X-User", "ana")
+	if res.status != http.StatusCreated || res.header.Get("Location") != "/v1/firmware-catalog/1" {
+		t.Fatalf("create: status = %d, location = %q; body = %v", res.status, res.header.Get("Location"), res.body)
+	}
+	var entry data.FirmwareCatalogEntry
+	res.decode(t, "firmware_catalog_entry", &entry)
+	if entry.ModelNo != "P3245-LV" || entry.MinimumVersion != "10.9" || entry.Version != 1 {
+		t.Errorf("created entry = %+v", entry)
+	}
+
+	tests := []struct {
+		name, method, url, body string
+		status                  int
+		field                   string
+	}{
+		{"duplicate", http.MethodPost, "/v1/firmware-catalog", `{"model_no":"p3245-lv","recommended_version":"11.0"}`, http.StatusUnprocessableEntity, "model_no"},
+		{"bad version", http.MethodPost, "/v1/firmware-catalog", `{"model_no":"XNV-6080","recommended_version":"latest"}`, http.StatusUnprocessableEntity, "recommended_version"},
+		{"minimum after recommended", http.MethodPatch, "/v1/firmware-catalog/1", `{"minimum_version":"11.0"}`, http.StatusUnprocessableEntity, "minimum_version"},
+		{"missing", http.MethodGet, "/v1/firmware-catalog/9", "", http.StatusNotFound, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			res := do(t, routes, tt.method, tt.url, tt.body, "X-User", "ana")
+			if res.status != tt.status {
+				t.Fatalf("status = %d; want %d; body = %v", res.status, tt.status, res.body)
+			}
+			if tt.field != "" {
+				var errs map[string]string
+				res.decode(t, "error", &errs)
+				if _, ok := errs[tt.field]; !ok {
+					t.Errorf("errors = %v; want one for %s", errs, tt.field)
+				}
+			}
+		})
+	}
+
+	// Anyone may read the catalog, but changing it takes an identity.
+	for _, w := range []struct{ method, url, body string }{
+		{http.MethodPost, "/v1/firmware-catalog", `{"model_no":"XNV-6080","recommended_version":"2.21.02"}`},
+		{http.MethodPatch, "/v1/firmware-catalog/1", `{"recommended_version":"1.0"}`},
+		{http.MethodDelete, "/v1/firmware-catalog/1", ""},
+	} {
+		if res := do(t, routes, w.method, w.url, w.body); res.status != http.StatusUnauthorized {
+			t.Errorf("anonymous %s %s: status = %d; want 401", w.method, w.url, res.status)
+		}
+	}
+
+	res = do(t, routes, http.MethodPatch, "/v1/firmware-catalog/1", `{"recommended_version":"11.1.66"}`, "X-User", "ana")
+	if res.status != http.StatusOK {
+		t.Fatalf("update: status = %d; body = %v", res.status, res.body)
+	}
+	res.decode(t, "firmware_catalog_entry", &entry)
+	if entry.RecommendedVersion != "11.1.66" || entry.Notes != "CVE-2025-0001" || entry.Version != 2 {
+		t.Errorf("updated entry = %+v", entry)
+	}
+
+	do(t, routes, http.MethodPost, "/v1/firmware-catalog", `{"model_no":"XNV-6080","recommended_version":"2.21.02"}`, "X-User", "ana")
+	var entries []data.FirmwareCatalogEntry
+	do(t, routes, http.MethodGet, "/v1/firmware-catalog", "").decode(t, "firmware_catalog", &entries)
+	if len(entries) != 2 || entries[0].ModelNo != "P3245-LV" || entries[1].ModelNo != "XNV-6080" {
+		t.Errorf("catalog = %+v", entries)
+	}
+
+	if res := do(t, routes, http.MethodDelete, "/v1/firmware-catalog/1", "", "X-User", "ana"); res.status != http.StatusOK {
+		t.Errorf("delete: status = %d", res.status)
+	}
+	if res := do(t, routes, http.MethodGet, "/v1/firmware-catalog/1", ""); res.status != http.StatusNotFound {
+		t.Errorf("show after delete: status = %d; want 404", res.status)
+	}
+}
+
+func TestCameraFirmware(t *testing.T) {
+	app := newTestApplication(t)
+	routes := app.routes()
+	camera := createCamera(t, routes, validCameraJSON)
+	url := fmt.Sprintf("/v1/cameras/%d/firmware", camera.ID)
+
+	// A camera which hasn't reported its firmware has none, and no history.
+	res := do(t, routes, http.MethodGet, url, "")
+	if res.status != http.StatusOK || string(res.body["firmware"]) != "null" || string(res.body["history"]) != "[]" {
+		t.Fatalf("status = %d; body = %v", res.status, res.body)
+	}
+
+	at := time.Date(2026, 3, 2, 9, 0, 0, 0, time.UTC)
+	for i, firmware := range []string{"10.9.2", "10.9.2", "10.12.114"} {
+		reading := &data.CameraFirmware{Model: "P3245-LV", Firmware: firmware, CollectedAt: at.Add(time.Duration(i) * time.Hour)}
+		if _, err := app.models.Firmware.Record(camera.ID, reading); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	res = do(t, routes, http.MethodGet, url, "")
+	var (
+		firmware data.CameraFirmware
+		history  []data.FirmwareChange
+	)
+	res.decode(t, "firmware", &firmware)
+	res.decode(t, "history", &history)
+	if firmware.Firmware != "10.12.114" || !firmware.CollectedAt.Equal(at.Add(2*time.Hour)) {
+		t.Errorf("firmware = %+v", firmware)
+	}
+	if len(history) != 2 || history[0].Firmware != "10.9.2" || history[1].Firmware != "10.12.114" {
+		t.Errorf("history = %+v", history)
+	}
+
+	if res := do(t, routes, http.MethodGet, "/v1/cameras/99/firmware", ""); res.status != http.StatusNotFound {
+		t.Errorf("missing camera: status = %d; want 404", res.status)
+	}
+}
+
+// complianceSeed has three cameras at two sites, each having reported different
+// firmware, and a catalog entry for their model.
+var complianceSeed = testSeed{
+	cameras: []string{
+		`{"name":"lobby","mac_address":"ACCC8E000001","site_name":"NYC-5th-GLH","model_no":"P3245-LV"}`,
+		`{"name":"dock","mac_address":"ACCC8E000002","site_name":"NYC-5th-GLH","model_no":"P3245-LV"}`,
+		`{"name":"gate","mac_address":"ACCC8E000003","site_name":"BOS-Main-OPS","model_no":"P3245-LV"}`,
+	},
+	firmware: []seedRecord[data.CameraFirmware]{
+		{1, data.CameraFirmware{Model: "P3245-LV", Firmware: "10.12.114", CollectedAt: time.Date(2026, 3, 2, 9, 0, 0, 0, time.UTC)}},
+		{2, data.CameraFirmware{Model: "P3245-LV", Firmware: "10.10.1", CollectedAt: time.Date(2026, 3, 2, 9, 0, 0, 0, time.UTC)}},
+		{3, data.CameraFirmware{Model: "P3245-LV", Firmware: "9.80.1", CollectedAt: time.Date(2026, 3, 2, 9, 0, 0, 0, time.UTC)}},
+	},
+	posts: [][2]string{
+		{"/v1/firmware-catalog", `{"model_no":"P3245-LV","recommended_version":"10.12.114","minimum_version":"10.9"}`},
+	},
+}
+
+func TestFirmwareComplianceReport(t *testing.T) {
+	routes := newSeededApplication(t, complianceSeed)
+
+	listed := func(report data.FirmwareComplianceReport) string {
+		var got []string
+		for _, site := range report.Sites {
+			for _, c := range site.Cameras {
+				got = append(got, fmt.Sprintf("%s:%s:%s", site.SiteName, c.Name, c.Compliance))
+			}
+		}
+		return fmt.Sprint(got)
+	}
+
+	tests := []struct {
+		url   string
+		total int
+		want  string
+	}{
+		{"/v1/reports/firmware-compliance", 3, "[BOS-Main-OPS:gate:vulnerable NYC-5th-GLH:dock:outdated]"},
+		{"/v1/reports/firmware-compliance?site=nyc-5th-glh", 2, "[NYC-5th-GLH:dock:outdated]"},
+		{"/v1/reports/firmware-compliance?compliance=current", 3, "[NYC-5th-GLH:lobby:current]"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.url, func(t *testing.T) {
+			res := do(t, routes, http.MethodGet, tt.url, "")
+			if res.status != http.StatusOK {
+				t.Fatalf("status = %d; body = %v", res.status, res.body)
+			}
+			var report data.FirmwareComplianceReport
+			res.decode(t, "report", &report)
+			if report.Totals.Total != tt.total {
+				t.Errorf("total = %d; want %d", report.Totals.Total, tt.total)
+			}
+			if got := listed(report); got != tt.want {
+				t.Errorf("listed = %s; want %s", got, tt.want)
+			}
+		})
+	}
+
+	var report data.FirmwareComplianceReport
+	do(t, routes, http.MethodGet, "/v1/reports/firmware-compliance", "").decode(t, "report", &report)
+	if nyc := report.Sites[1]; nyc.Total != 2 || nyc.Current != 1 || nyc.Outdated != 1 {
+		t.Errorf("NYC-5th-GLH counts = %+v", nyc.FirmwareCounts)
+	}
+
+	if res := do(t, routes, http.MethodGet, "/v1/reports/firmware-compliance?compliance=current,great", ""); res.status != http.StatusUnprocessableEntity {
+		t.Errorf("unknown compliance: status = %d; want 422", res.status)
+	}
+}
+
+func TestFirmwareComplianceReportCSV(t *testing.T) {
+	routes := newSeededApplication(t, complianceSeed)
+
+	r := httptest.NewRequest(http.MethodGet, "/v1/reports/firmware-compliance", nil)
+	r.Header.Set("Accept", "text/csv")
+	rr := httptest.NewRecorder()
+	routes.ServeHTTP(rr, r)
+
+	if rr.Code != http.StatusOK || !strings.HasPrefix(rr.Header().Get("Content-Type"), "text/csv") {
+		t.Fatalf("status = %d; content type = %q", rr.Code, rr.Header().Get("Content-Type"))
+	}
+	records, err := csv.NewReader(rr.Body).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 3 {
+		t.Fatalf("got %d rows; want a header and two cameras", len(records))
+	}
+	if got := strings.Join(records[1], ","); got != "BOS-Main-OPS,3,gate,P3245-LV,9.80.1,2026-03-02T09:00:00Z,vulnerable,10.9,10.12.114" {
+		t.Errorf("first row = %s", got)
+	}
+}
+
+// The compliance values documented in openapi.json must be the ones the report uses.
+func TestFirmwareComplianceSafelistDocumented(t *testing.T) {
+	var doc struct {
+		Components struct {
+			Schemas map[string]struct {
+				Properties map[string]struct {
+					Enum []string `json:"enum"`
+				} `json:"properties"`
+			} `json:"schemas"`
+		} `json:"components"`
+	}
+	if err := json.Unmarshal(openAPISpec, &doc); err != nil {
+		t.Fatal(err)
+	}
+	enum := doc.Components.Schemas["CameraFirmwareCompliance"].Properties["compliance"].Enum
+	if fmt.Sprint(enum) != fmt.Sprint(data.FirmwareComplianceSafelist) {
+		t.Errorf("documented compliance values = %v; want %v", enum, data.FirmwareComplianceSafelist)
+	}
+}
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"bytes"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -9,7 +10,9 @@ import (
 	"net/url"
 	"strconv"
 	"strings"
+	"time"
 
+	"github.com/chefgoldbloom/pnctool/backend/internal/data"
 	"github.com/chefgoldbloom/pnctool/backend/internal/validator"
 	"github.com/julienschmidt/httprouter"
 )
@@ -58,9 +61,11 @@ func (app *application) writeJSON(w http.ResponseWriter, status int, data envelo
 		w.Header()[k] = v
 	}
 
-	// Add the "Content-Type: application/json" header, then write the status code and
-	// JSON response.
-	w.Header().Set("Content-Type", "application/json")
+	// Add the "Content-Type: application/json" header unless the caller supplied a
+	// more specific JSON media type, then write the status code and JSON response.
+	if w.Header().Get("Content-Type") == "" {
+		w.Header().Set("Content-Type", "application/json")
+	}
 	w.WriteHeader(status)
 	w.Write(js)
 	return nil
@@ -80,34 +85,7 @@ func (app *application) readJSON(w http.ResponseWriter, r *http.Request, dest an
 	// Decode the request body to the destination
 	err := dec.Decode(dest)
 	if err != nil {
-		var syntaxError *json.SyntaxError
-		var unmarshalTypeError *json.UnmarshalTypeError
-		var invalidUnmarshalError *json.InvalidUnmarshalError
-		var maxBytesError *http.MaxBytesError
-
-		switch {
-		case errors.As(err, &syntaxError):
-			return fmt.Errorf("body contains badly-formed JSON (at character %d)", syntaxError.Offset)
-		case errors.Is(err, io.ErrUnexpectedEOF):
-			return errors.New("body contains badly formed JSON")
-		case errors.As(err, &unmarshalTypeError):
-			if unmarshalTypeError.Field != "" {
-				return fmt.Errorf("body contains incorrect JSON type for field %q", unmarshalTypeError.Field)
-			}
-			return fmt.Errorf("body contains incorrect JSON type (at character %d)", unmarshalTypeError.Offset)
-		case errors.Is(err, io.EOF):
-			return errors.New("body must not be empty")
-		case strings.HasPrefix(err.Error(), "json: unknown field"):
-			fieldName := strings.TrimPrefix(err.Error(), "json: unknown field ")
-			return fmt.Errorf("body contains unknown key %s", fieldName)
-		case errors.As(err, &maxBytesError):
-			return fmt.Errorf("body must not be larger than %d bytes", maxBytesError.Limit)
-		case errors.As(err, &invalidUnmarshalError):
-			panic(err)
-
-		default:
-			return err
-		}
+		return jsonError(err)
 	}
 	// Call Decode() again using an empty struct pointer.  If request.Body contains more than one JSON value
 	// return custom error.
@@ -118,6 +96,52 @@ func (app *application) readJSON(w http.ResponseWriter, r *http.Request, dest an
 	return nil
 }
 
+// decodeJSON strictly decodes an in-memory JSON document, such as the result of
+// applying a patch, reporting problems the same way readJSON() does.
+func decodeJSON(js []byte, dest any) error {
+	dec := json.NewDecoder(bytes.NewReader(js))
+	dec.DisallowUnknownFields()
+
+	err := dec.Decode(dest)
+	if err != nil {
+		return jsonError(err)
+	}
+	return nil
+}
+
+// jsonError translates the errors returned by json.Decoder into messages which are
+// safe and useful to send back to the client.
+func jsonError(err error) error {
+	var syntaxError *json.SyntaxError
+	var unmarshalTypeError *json.UnmarshalTypeError
+	var invalidUnmarshalError *json.InvalidUnmarshalError
+	var maxBytesError *http.MaxBytesError
+
+	switch {
+	case errors.As(err, &syntaxError):
+		return fmt.Errorf("body contains badly-formed JSON (at character %d)", syntaxError.Offset)
+	case errors.Is(err, io.ErrUnexpectedEOF):
+		return errors.New("body contains badly formed JSON")
+	case errors.As(err, &unmarshalTypeError):
+		if unmarshalTypeError.Field != "" {
+			return fmt.Errorf("body contains incorrect JSON type for field %q", unmarshalTypeError.Field)
+		}
+		return fmt.Errorf("body contains incorrect JSON type (at character %d)", unmarshalTypeError.Offset)
+	case errors.Is(err, io.EOF):
+		return errors.New("body must not be empty")
+	case strings.HasPrefix(err.Error(), "json: unknown field"):
+		fieldName := strings.TrimPrefix(err.Error(), "json: unknown field ")
+		return fmt.Errorf("body contains unknown key %s", fieldName)
+	case errors.As(err, &maxBytesError):
+		return fmt.Errorf("body must not be larger than %d bytes", maxBytesError.Limit)
+	case errors.As(err, &invalidUnmarshalError):
+		panic(err)
+
+	default:
+		return err
+	}
+}
+
 func (app *application) readString(qs url.Values, key string, defaultValue string) string {
 	s := qs.Get(key)
 	if s == "" {
@@ -134,6 +158,20 @@ func (app *application) readCSV(qs url.Values, key string, defaultValue []string
 	return strings.Split(csv, ",")
 }
 
+// readDate reads a YYYY-MM-DD date as midnight UTC.
+func (app *application) readDate(qs url.Values, key string, defaultValue time.Time, v *validator.Validator) time.Time {
+	s := qs.Get(key)
+	if s == "" {
+		return defaultValue
+	}
+	t, err := time.Parse(time.DateOnly, s)
+	if err != nil {
+		v.AddErrorCode(key, validator.CodeBadFormat, "must be a date in YYYY-MM-DD format")
+		return defaultValue
+	}
+	return t
+}
+
 func (app *application) readInt(qs url.Values, key string, defaultValue int, v *validator.Validator) int {
 	s := qs.Get(key)
 	if s == "" {
@@ -141,8 +179,51 @@ func (app *application) readInt(qs url.Values, key string, defaultValue int, v *
 	}
 	i, err := strconv.Atoi(s)
 	if err != nil {
-		v.AddError(key, "must be an integer value")
+		v.AddErrorCode(key, validator.CodeNotInteger, "must be an integer value")
 		return defaultValue
 	}
 	return i
 }
+
+func (app *application) readFloat(qs url.Values, key string, defaultValue float64, v *validator.Validator) float64 {
+	s := qs.Get(key)
+	if s == "" {
+		return defaultValue
+	}
+	f, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		v.AddErrorCode(key, validator.CodeBadFormat, "must be a number")
+		return defaultValue
+	}
+	return f
+}
+
+// readDuration reads a duration such as 90m or 2h45m.
+func (app *application) readDuration(qs url.Values, key string, defaultValue time.Duration, v *validator.Validator) time.Duration {
+	s := qs.Get(key)
+	if s == "" {
+		return defaultValue
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil {
+		v.AddErrorCode(key, validator.CodeBadFormat, "must be a duration such as 90m or 2h45m")
+		return defaultValue
+	}
+	return d
+}
+
+// publish publishes an event about camera, with the camera as its data. The change
+// it reports has already been made, so a failure is logged rather than failing the
+// request.
+func (app *application) publish(eventType string, camera *data.Camera) {
+	if app.events == nil {
+		return
+	}
+	event, err := data.NewEvent(eventType, camera, camera, time.Now())
+	if err == nil {
+		err = app.events.Publish(event)
+	}
+	if err != nil {
+		app.logger.Error("publishing event", "type", eventType, "camera_id", camera.ID, "error", err)
+	}
+}
@@ -0,0 +1,289 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"io/fs"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/chefgoldbloom/pnctool/backend/internal/data"
+)
+
+const (
+	// maxIdempotencyKeyLength bounds the client-chosen key; UUIDs are 36 bytes.
+	maxIdempotencyKeyLength = 255
+
+	// maxBufferedBody is how much of a request body the middleware keeps in memory
+	// while hashing it; the rest is spooled to a temporary file.
+	maxBufferedBody = 1_048_576
+
+	// idempotencyWait is how long a retry waits for another instance to finish the
+	// original request before giving up with 409 Conflict.
+	idempotencyWait = 10 * time.Second
+)
+
+// replayedHeaders are the response headers stored with an idempotent response and
+// sent again when it is replayed.
+var replayedHeaders = []string{"Content-Type", "Location", "ETag"}
+
+// keyedMutex serializes work per key. The zero value is ready to use.
+type keyedMutex struct {
+	mu    sync.Mutex
+	locks map[string]*keyedLock
+}
+
+type keyedLock struct {
+	sync.Mutex
+	refs int
+}
+
+// lock blocks until key is free and returns the function which releases it.
+func (km *keyedMutex) lock(key string) func() {
+	km.mu.Lock()
+	if km.locks == nil {
+		km.locks = make(map[string]*keyedLock)
+	}
+	l, ok := km.locks[key]
+	if !ok {
+		l = &keyedLock{}
+		km.locks[key] = l
+	}
+	l.refs++
+	km.mu.Unlock()
+
+	l.Lock()
+	return func() {
+		l.Unlock()
+		km.mu.Lock()
+		l.refs--
+		if l.refs == 0 {
+			delete(km.locks, key)
+		}
+		km.mu.Unlock()
+	}
+}
+
+// recordingResponseWriter passes a response through to the client while keeping a
+// copy of the status and body.
+type recordingResponseWriter struct {
+	http.ResponseWriter
+	status int
+	body   bytes.Buffer
+}
+
+func (rw *recordingResponseWriter) WriteHeader(status int) {
+	if rw.status == 0 {
+		rw.status = status
+	}
+	rw.ResponseWriter.WriteHeader(status)
+}
+
+func (rw *recordingResponseWriter) Write(b []byte) (int, error) {
+	if rw.status == 0 {
+		rw.status = http.StatusOK
+	}
+	rw.body.Write(b)
+	return rw.ResponseWriter.Write(b)
+}
+
+// Unwrap lets http.ResponseController reach the underlying ResponseWriter, so
+// handlers can still set deadlines and flush.
+func (rw *recordingResponseWriter) Unwrap() http.ResponseWriter {
+	return rw.ResponseWriter
+}
+
+// idempotency is middleware which makes POST requests carrying an Idempotency-Key
+// header safe to retry. Keys belong to the user sending them, so one user's stored
+// response is never replayed to another. The first request with a key runs normally and its response
+// is stored for cfg.idempotency.ttl; retries with the same key and body get the
+// stored response replayed instead of running the handler again. Reusing a key with
+// a different body is a 422. Requests with the same key are serialized, so a retry
+// which races the original waits for it rather than running twice. Server errors
+// aren't stored, so a retry after a 5xx runs the handler again. A key held by a
+// request which never finished, because its instance crashed, is taken over by a
+// retry once cfg.idempotency.lease has passed.
+func (app *application) idempotency(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		key := r.Header.Get("Idempotency-Key")
+		if r.Method != http.MethodPost || key == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if len(key) > maxIdempotencyKeyLength {
+			app.badRequestResponse(w, r, errors.New("Idempotency-Key header must not be more than 255 bytes long"))
+			return
+		}
+
+		// The whole body is hashed, so a retry must match all of it, and kept so the
+		// handler can read it again.
+		hash := sha256.New()
+		hash.Write([]byte(r.Method + " " + r.URL.RequestURI() + "\n"))
+		body, err := app.spoolBody(w, r, hash)
+		if err != nil {
+			// Errors with the temporary file are ours; the rest are reading the body.
+			var pathError *fs.PathError
+			switch {
+			case errors.As(err, &pathError):
+				app.serverErrorResponse(w, r, err)
+			default:
+				app.badRequestResponse(w, r, err)
+			}
+			return
+		}
+		defer body.Close()
+		r.Body = body
+
+		now := time.Now()
+		rec := &data.IdempotencyRecord{
+			Key:            key,
+			Method:         r.Method,
+			Path:           r.URL.Path,
+			User:           app.contextGetIdentity(r).User,
+			RequestHash:    hex.EncodeToString(hash.Sum(nil)),
+			ExpiresAt:      now.Add(app.cfg.idempotency.ttl),
+			LeaseExpiresAt: now.Add(app.cfg.idempotency.lease),
+		}
+
+		unlock := app.idempotencyLocks.lock(rec.Method + " " + rec.Path + " " + rec.User + " " + rec.Key)
+		defer unlock()
+
+		deadline := time.Now().Add(idempotencyWait)
+		for {
+			existing, err := app.models.IdempotencyKeys.Reserve(rec)
+			if err != nil {
+				app.serverErrorResponse(w, r, err)
+				return
+			}
+
+			switch {
+			case existing == nil:
+				app.runIdempotent(w, r, next, rec)
+				return
+			case existing.RequestHash != rec.RequestHash:
+				app.idempotencyKeyReusedResponse(w, r)
+				return
+			case existing.Completed():
+				replayResponse(w, existing)
+				return
+			}
+
+			// Another instance is still processing the original request.
+			if time.Now().After(deadline) {
+				app.idempotencyInProgressResponse(w, r)
+				return
+			}
+			select {
+			case <-r.Context().Done():
+				return
+			case <-time.After(100 * time.Millisecond):
+			}
+		}
+	})
+}
+
+// spooledBody is a request body read ahead of the handler: its first part in memory,
+// any more in a temporary file, and then anything past the largest body accepted.
+type spooledBody struct {
+	io.Reader
+	file *os.File
+}
+
+// Close removes the temporary file, if there is one. The server closes the request's
+// own body.
+func (b *spooledBody) Close() error {
+	if b.file == nil {
+		return nil
+	}
+	b.file.Close()
+	return os.Remove(b.file.Name())
+}
+
+// spoolBody reads r's body into h and returns it to be read again. Up to
+// maxBufferedBody bytes are kept in memory. Only firmware image uploads are any
+// bigger, so the rest is spooled to a temporary file, up to their size limit and
+// under their deadline; what's past the limit is left for the handler to reject.
+func (app *application) spoolBody(w http.ResponseWriter, r *http.Request, h io.Writer) (*spooledBody, error) {
+	head, err := io.ReadAll(io.TeeReader(io.LimitReader(r.Body, maxBufferedBody+1), h))
+	if err != nil {
+		return nil, err
+	}
+	if len(head) <= maxBufferedBody {
+		return &spooledBody{Reader: bytes.NewReader(head)}, nil
+	}
+
+	rc := http.NewResponseController(w)
+	if err := rc.SetReadDeadline(time.Now().Add(app.cfg.upgrades.uploadTimeout)); err != nil && !errors.Is(err, http.ErrNotSupported) {
+		return nil, err
+	}
+
+	f, err := os.CreateTemp("", "pnc-body-*")
+	if err != nil {
+		return nil, err
+	}
+	body := &spooledBody{file: f}
+	limit := max(app.cfg.upgrades.maxImageSize, maxBufferedBody) + 1 - int64(len(head))
+	_, err = io.Copy(f, io.TeeReader(io.LimitReader(r.Body, limit), h))
+	if err == nil {
+		_, err = f.Seek(0, io.SeekStart)
+	}
+	if err != nil {
+		body.Close()
+		return nil, err
+	}
+	body.Reader = io.MultiReader(bytes.NewReader(head), f, r.Body)
+	return body, nil
+}
+
+// runIdempotent runs the handler for a freshly reserved key and stores its response.
+func (app *application) runIdempotent(w http.ResponseWriter, r *http.Request, next http.Handler, rec *data.IdempotencyRecord) {
+	rw := &recordingResponseWriter{ResponseWriter: w}
+
+	// Release the key if the handler panics, so the client can retry.
+	completed := false
+	defer func() {
+		if !completed {
+			if err := app.models.IdempotencyKeys.Release(rec); err != nil {
+				app.logError(r, err)
+			}
+		}
+	}()
+
+	next.ServeHTTP(rw, r)
+
+	if rw.status == 0 || rw.status >= http.StatusInternalServerError {
+		return
+	}
+
+	rec.Status = rw.status
+	rec.Body = rw.body.Bytes()
+	rec.Header = make(http.Header)
+	for _, name := range replayedHeaders {
+		if v := w.Header().Values(name); len(v) > 0 {
+			rec.Header[name] = v
+		}
+	}
+
+	if err := app.models.IdempotencyKeys.Complete(rec); err != nil {
+		// The client already has its response; a retry will just run again.
+		app.logError(r, err)
+		return
+	}
+	completed = true
+}
+
+func replayResponse(w http.ResponseWriter, rec *data.IdempotencyRecord) {
+	for name, values := range rec.Header {
+		for _, v := range values {
+			w.Header().Add(name, v)
+		}
+	}
+	w.Header().Set("Idempotent-Replayed", "true")
+	w.WriteHeader(rec.Status)
+	w.Write(rec.Body)
+}
@@ -0,0 +1,171 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/chefgoldbloom/pnctool/backend/internal/data"
+)
+
+func TestIdempotencyKey(t *testing.T) {
+	app := newTestApplication(t)
+	routes := app.routes()
+
+	first := do(t, routes, http.MethodPost, "/v1/cameras", validCameraJSON, "Idempotency-Key", "key-1")
+	if first.status != http.StatusCreated {
+		t.Fatalf("first: status = %d", first.status)
+	}
+	var created data.Camera
+	first.decode(t, "camera", &created)
+
+	retry := do(t, routes, http.MethodPost, "/v1/cameras", validCameraJSON, "Idempotency-Key", "key-1")
+	if retry.status != http.StatusCreated || retry.header.Get("Idempotent-Replayed") != "true" {
+		t.Fatalf("retry: status = %d, replayed = %q", retry.status, retry.header.Get("Idempotent-Replayed"))
+	}
+	var replayed data.Camera
+	retry.decode(t, "camera", &replayed)
+	if replayed != created {
+		t.Errorf("replayed = %+v; want %+v", replayed, created)
+	}
+	if retry.header.Get("Location") != first.header.Get("Location") || retry.header.Get("ETag") != first.header.Get("ETag") {
+		t.Errorf("replayed headers = %v; want %v", retry.header, first.header)
+	}
+
+	other := do(t, routes, http.MethodPost, "/v1/cameras", `{"name":"other","mac_address":"ACCC8E000002","site_name":"NYC-5th-OPS"}`, "Idempotency-Key", "key-1")
+	if other.status != http.StatusUnprocessableEntity {
+		t.Errorf("reused key: status = %d; want 422", other.status)
+	}
+
+	// Validation failures are stored and replayed too: the request was processed.
+	for i := 0; i < 2; i++ {
+		if res := do(t, routes, http.MethodPost, "/v1/cameras", `{}`, "Idempotency-Key", "key-2"); res.status != http.StatusUnprocessableEntity {
+			t.Errorf("invalid body attempt %d: status = %d; want 422", i, res.status)
+		}
+	}
+
+	_, metadata, _ := app.models.Cameras.GetAll(data.CameraFilter{}, data.Projection{}, data.Filters{Page: 1, PageSize: 20, Sort: "id", SortSafelist: []string{"id"}})
+	if metadata.TotalRecords != 1 {
+		t.Errorf("cameras created = %d; want 1", metadata.TotalRecords)
+	}
+}
+
+func TestIdempotencyKeyConcurrent(t *testing.T) {
+	app := newTestApplication(t)
+	routes := app.routes()
+
+	const requests = 10
+	var (
+		wg  sync.WaitGroup
+		mu  sync.Mutex
+		ids = map[string]int{}
+	)
+	for i := 0; i < requests; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			res := do(t, routes, http.MethodPost, "/v1/cameras", validCameraJSON, "Idempotency-Key", "same-key")
+			mu.Lock()
+			ids[fmt.Sprintf("%d %s", res.status, res.header.Get("Location"))]++
+			mu.Unlock()
+		}()
+	}
+	wg.Wait()
+
+	if len(ids) != 1 || ids["201 /v1/cameras/1"] != requests {
+		t.Errorf("responses = %v; want %d identical 201s for camera 1", ids, requests)
+	}
+}
+
+func TestIdempotencyKeyAbandoned(t *testing.T) {
+	app := newTestApplication(t)
+	routes := app.routes()
+
+	// An instance reserved the key and crashed before storing a response.
+	abandoned := &data.IdempotencyRecord{
+		Key:            "key-1",
+		Method:         http.MethodPost,
+		Path:           "/v1/cameras",
+		RequestHash:    "crashed",
+		ExpiresAt:      time.Now().Add(time.Hour),
+		LeaseExpiresAt: time.Now().Add(-time.Second),
+	}
+	if _, err := app.models.IdempotencyKeys.Reserve(abandoned); err != nil {
+		t.Fatal(err)
+	}
+
+	start := time.Now()
+	res := do(t, routes, http.MethodPost, "/v1/cameras", validCameraJSON, "Idempotency-Key", "key-1")
+	if res.status != http.StatusCreated || res.header.Get("Idempotent-Replayed") != "" {
+		t.Fatalf("retry: status = %d, replayed = %q; want a fresh 201", res.status, res.header.Get("Idempotent-Replayed"))
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("retry waited %v for the abandoned request", elapsed)
+	}
+
+	// The new response is stored under the key as usual.
+	if res := do(t, routes, http.MethodPost, "/v1/cameras", validCameraJSON, "Idempotency-Key", "key-1"); res.header.Get("Idempotent-Replayed") != "true" {
+		t.Errorf("second retry: status = %d; want a replay", res.status)
+	}
+}
+
+// Bodies bigger than the middleware buffers are hashed in full, so images which only
+// differ after their first megabyte can't replay each other's upload.
+func TestIdempotencyKeyLargeBody(t *testing.T) {
+	app := newTestApplication(t)
+	app.cfg.upgrades.maxImageSize = 4 << 20
+	routes := app.routes()
+
+	image := bytes.Repeat([]byte("x"), 2<<20)
+	url := "/v1/firmware-images?model_no=P3245-LV&firmware=11.1.66"
+	upload := func(image []byte) testResponse {
+		return do(t, routes, http.MethodPost, url, string(image), "X-User", "ana", "Idempotency-Key", "upload-1")
+	}
+
+	first := upload(image)
+	if first.status != http.StatusCreated {
+		t.Fatalf("first: status = %d; body = %v", first.status, first.body)
+	}
+	var uploaded data.FirmwareImage
+	first.decode(t, "firmware_image", &uploaded)
+	if uploaded.Size != int64(len(image)) {
+		t.Errorf("uploaded %d bytes; want %d", uploaded.Size, len(image))
+	}
+	if retry := upload(image); retry.status != http.StatusCreated || retry.header.Get("Idempotent-Replayed") != "true" {
+		t.Errorf("retry: status = %d, replayed = %q", retry.status, retry.header.Get("Idempotent-Replayed"))
+	}
+
+	other := bytes.Clone(image)
+	other[len(other)-1] = 'y'
+	if res := upload(other); res.status != http.StatusUnprocessableEntity {
+		t.Errorf("other image: status = %d; want 422", res.status)
+	}
+}
+
+// Keys belong to the user sending them, so a user reusing another's key gets a
+// response of their own rather than a replay of the other's, secrets and all.
+func TestIdempotencyKeyPerUser(t *testing.T) {
+	routes := newTestApplication(t).routes()
+
+	create := func(user string) data.Webhook {
+		res := do(t, routes, http.MethodPost, "/v1/webhooks", `{"url":"https://example.com/hook"}`, "X-User", user, "Idempotency-Key", "hook-1")
+		if res.status != http.StatusCreated || res.header.Get("Idempotent-Replayed") != "" {
+			t.Fatalf("%s: status = %d, replayed = %q; want a fresh 201", user, res.status, res.header.Get("Idempotent-Replayed"))
+		}
+		var webhook data.Webhook
+		res.decode(t, "webhook", &webhook)
+		return webhook
+	}
+
+	ana, ben := create("ana"), create("ben")
+	if ana.ID == ben.ID || ana.Secret == ben.Secret {
+		t.Errorf("ben got ana's webhook: %+v and %+v", ana, ben)
+	}
+
+	if res := do(t, routes, http.MethodPost, "/v1/webhooks", `{"url":"https://example.com/hook"}`, "X-User", "ana", "Idempotency-Key", "hook-1"); res.header.Get("Idempotent-Replayed") != "true" {
+		t.Errorf("ana's retry: status = %d; want a replay", res.status)
+	}
+}
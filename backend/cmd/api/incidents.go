@@ -0,0 +1,204 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/chefgoldbloom/pnctool/backend/internal/data"
+	"github.com/chefgoldbloom/pnctool/backend/internal/validator"
+)
+
+// listIncidentsHandler for the "GET /v1/incidents" endpoint. Incidents can be
+// filtered by site, camera_id, state (a comma-separated list), and by age with
+// min_age and max_age, durations since they were opened. The newest come first.
+func (app *application) listIncidentsHandler(w http.ResponseWriter, r *http.Request) {
+	v := validator.New()
+	qs := r.URL.Query()
+
+	var filter data.IncidentFilter
+	filter.SiteName = app.readString(qs, "site", "")
+	filter.CameraID = int64(app.readInt(qs, "camera_id", 0, v))
+	filter.States = app.readCSV(qs, "state", nil)
+	minAge := app.readDuration(qs, "min_age", 0, v)
+	maxAge := app.readDuration(qs, "max_age", 0, v)
+
+	now := time.Now()
+	if minAge > 0 {
+		filter.OpenedBefore = now.Add(-minAge)
+	}
+	if maxAge > 0 {
+		filter.OpenedAfter = now.Add(-maxAge)
+	}
+
+	filters := data.Filters{
+		Page:         app.readInt(qs, "page", 1, v),
+		PageSize:     app.readInt(qs, "page_size", 20, v),
+		Sort:         app.readString(qs, "sort", "-opened_at"),
+		SortSafelist: []string{"id", "opened_at", "-id", "-opened_at"},
+	}
+
+	for _, state := range filter.States {
+		v.CheckCode(validator.PermittedValue(state, data.IncidentStateSafelist...), "state", validator.CodeNotPermitted, "must be one of: "+strings.Join(data.IncidentStateSafelist, ", "))
+	}
+	v.CheckCode(minAge >= 0, "min_age", validator.CodeOutOfRange, "must not be negative")
+	v.CheckCode(maxAge >= 0, "max_age", validator.CodeOutOfRange, "must not be negative")
+	v.CheckCode(maxAge == 0 || maxAge >= minAge, "max_age", validator.CodeOutOfRange, "must not be less than min_age")
+	if data.ValidateFilters(v, filters); !v.Valid() {
+		app.failedValidationResponse(w, r, v)
+		return
+	}
+
+	incidents, metadata, err := app.models.Incidents.GetAll(filter, filters)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"incidents": incidents, "metadata": metadata}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// showIncidentHandler for the "GET /v1/incidents/:id" endpoint returns the incident
+// with its notes.
+func (app *application) showIncidentHandler(w http.ResponseWriter, r *http.Request) {
+	incident, ok := app.loadIncident(w, r)
+	if !ok {
+		return
+	}
+
+	err := app.writeJSON(w, http.StatusOK, envelope{"incident": incident}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// updateIncidentHandler for the "PATCH /v1/incidents/:id" endpoint acknowledges,
+// resolves or assigns an incident on behalf of the caller.
+func (app *application) updateIncidentHandler(w http.ResponseWriter, r *http.Request) {
+	incident, ok := app.loadIncident(w, r)
+	if !ok {
+		return
+	}
+
+	var input struct {
+		State    *string `json:"state"`
+		Assignee *string `json:"assignee"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+	if input.State != nil {
+		if data.ValidateIncidentState(v, incident.State, *input.State); !v.Valid() {
+			app.failedValidationResponse(w, r, v)
+			return
+		}
+		incident.SetState(*input.State, app.contextGetIdentity(r).User, time.Now())
+	}
+	if input.Assignee != nil {
+		incident.Assignee = *input.Assignee
+	}
+
+	if data.ValidateIncident(v, incident); !v.Valid() {
+		app.failedValidationResponse(w, r, v)
+		return
+	}
+
+	err = app.models.Incidents.Update(incident)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrEditConflict):
+			app.editConflictResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"incident": incident}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// createIncidentNoteHandler for the "POST /v1/incidents/:id/notes" endpoint adds a
+// note by the caller to an incident.
+func (app *application) createIncidentNoteHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	var input struct {
+		Body string `json:"body"`
+	}
+
+	err = app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	note := &data.IncidentNote{
+		IncidentID: id,
+		Author:     app.contextGetIdentity(r).User,
+		Body:       input.Body,
+	}
+
+	v := validator.New()
+	if data.ValidateIncidentNote(v, note); !v.Valid() {
+		app.failedValidationResponse(w, r, v)
+		return
+	}
+
+	err = app.models.Incidents.AddNote(note)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	headers := make(http.Header)
+	headers.Set("Location", fmt.Sprintf("/v1/incidents/%d", id))
+
+	err = app.writeJSON(w, http.StatusCreated, envelope{"note": note}, headers)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// loadIncident fetches the incident named by the request's id parameter, sending a
+// 404 if there's no such incident.
+func (app *application) loadIncident(w http.ResponseWriter, r *http.Request) (*data.Incident, bool) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return nil, false
+	}
+
+	incident, err := app.models.Incidents.Get(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return nil, false
+	}
+	return incident, true
+}
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/chefgoldbloom/pnctool/backend/internal/data"
+)
+
+// incidentSeed has an incident opened an hour ago for a camera at NYC-5th-GLH and
+// one opened a day ago at BOS-Main-OPS.
+var incidentSeed = testSeed{
+	cameras: []string{
+		`{"name":"Lobby","mac_address":"ACCC8E000001","site_name":"NYC-5th-GLH"}`,
+		`{"name":"Gate","mac_address":"ACCC8E000002","site_name":"BOS-Main-OPS"}`,
+	},
+	incidents: []seedRecord[time.Time]{
+		{1, time.Now().Add(-time.Hour)},
+		{2, time.Now().Add(-24 * time.Hour)},
+	},
+}
+
+func TestListIncidents(t *testing.T) {
+	routes := newSeededApplication(t, incidentSeed)
+
+	tests := []struct {
+		url    string
+		status int
+		want   string
+	}{
+		{"/v1/incidents", http.StatusOK, "[1 2]"},
+		{"/v1/incidents?sort=opened_at", http.StatusOK, "[2 1]"},
+		{"/v1/incidents?site=bos-main-ops", http.StatusOK, "[2]"},
+		{"/v1/incidents?camera_id=1", http.StatusOK, "[1]"},
+		{"/v1/incidents?state=open,acknowledged", http.StatusOK, "[1 2]"},
+		{"/v1/incidents?state=resolved", http.StatusOK, "[]"},
+		{"/v1/incidents?min_age=2h", http.StatusOK, "[2]"},
+		{"/v1/incidents?max_age=2h", http.StatusOK, "[1]"},
+		{"/v1/incidents?state=closed", http.StatusUnprocessableEntity, ""},
+		{"/v1/incidents?min_age=1d", http.StatusUnprocessableEntity, ""},
+		{"/v1/incidents?min_age=2h&max_age=1h", http.StatusUnprocessableEntity, ""},
+		{"/v1/incidents?sort=camera_id", http.StatusUnprocessableEntity, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.url, func(t *testing.T) {
+			res := do(t, routes, http.MethodGet, tt.url, "")
+			if res.status != tt.status {
+				t.Fatalf("status = %d; want %d; body = %v", res.status, tt.status, res.body)
+			}
+			if tt.status != http.StatusOK {
+				return
+			}
+			var incidents []data.Incident
+			res.decode(t, "incidents", &incidents)
+			ids := []int64{}
+			for _, incident := range incidents {
+				ids = append(ids, incident.ID)
+			}
+			if fmt.Sprint(ids) != tt.want {
+				t.Errorf("incidents = %v; want %s", ids, tt.want)
+			}
+		})
+	}
+}
+
+func TestUpdateIncident(t *testing.T) {
+	routes := newSeededApplication(t, incidentSeed)
+
+	tests := []struct {
+		name   string
+		user   string
+		body   string
+		status int
+		state  string
+	}{
+		{"anonymous", "", `{"state":"acknowledged"}`, http.StatusUnauthorized, ""},
+		{"acknowledge", "alice", `{"state":"acknowledged","assignee":"bob"}`, http.StatusOK, data.IncidentAcknowledged},
+		{"reopen", "alice", `{"state":"open"}`, http.StatusUnprocessableEntity, ""},
+		{"bad assignee", "alice", fmt.Sprintf(`{"assignee":"%0101d"}`, 0), http.StatusUnprocessableEntity, ""},
+		{"resolve", "bob", `{"state":"resolved"}`, http.StatusOK, data.IncidentResolved},
+		{"acknowledge resolved", "alice", `{"state":"acknowledged"}`, http.StatusUnprocessableEntity, ""},
+	}
+
+	for _, tt := range tests {
+		res := do(t, routes, http.MethodPatch, "/v1/incidents/1", tt.body, "X-User", tt.user)
+		if res.status != tt.status {
+			t.Fatalf("%s: status = %d; want %d; body = %v", tt.name, res.status, tt.status, res.body)
+		}
+		if tt.status != http.StatusOK {
+			continue
+		}
+		var incident data.Incident
+		res.decode(t, "incident", &incident)
+		if incident.State != tt.state {
+			t.Errorf("%s: state = %s; want %s", tt.name, incident.State, tt.state)
+		}
+	}
+
+	res := do(t, routes, http.MethodGet, "/v1/incidents/1", "")
+	var incident data.Incident
+	res.decode(t, "incident", &incident)
+	if incident.AcknowledgedBy != "alice" || incident.AcknowledgedAt == nil || incident.ResolvedBy != "bob" || incident.ResolvedAt == nil || incident.Assignee != "bob" {
+		t.Errorf("incident = %+v; want acknowledged by alice, resolved by bob and assigned to bob", incident)
+	}
+
+	if res := do(t, routes, http.MethodPatch, "/v1/incidents/9", `{"state":"resolved"}`, "X-User", "alice"); res.status != http.StatusNotFound {
+		t.Errorf("missing incident: status = %d; want %d", res.status, http.StatusNotFound)
+	}
+}
+
+func TestIncidentNotes(t *testing.T) {
+	routes := newSeededApplication(t, incidentSeed)
+
+	tests := []struct {
+		url    string
+		user   string
+		body   string
+		status int
+	}{
+		{"/v1/incidents/2/notes", "alice", `{"body":"power cycled the switch"}`, http.StatusCreated},
+		{"/v1/incidents/2/notes", "bob", `{"body":"still down"}`, http.StatusCreated},
+		{"/v1/incidents/2/notes", "", `{"body":"anonymous"}`, http.StatusUnauthorized},
+		{"/v1/incidents/2/notes", "alice", `{"body":" "}`, http.StatusUnprocessableEntity},
+		{"/v1/incidents/9/notes", "alice", `{"body":"lost"}`, http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		if res := do(t, routes, http.MethodPost, tt.url, tt.body, "X-User", tt.user); res.status != tt.status {
+			t.Errorf("POST %s %s: status = %d; want %d; body = %v", tt.url, tt.body, res.status, tt.status, res.body)
+		}
+	}
+
+	var incident data.Incident
+	do(t, routes, http.MethodGet, "/v1/incidents/2", "").decode(t, "incident", &incident)
+	if len(incident.Notes) != 2 || incident.Notes[0].Author != "alice" || incident.Notes[1].Body != "still down" {
+		t.Errorf("notes = %+v", incident.Notes)
+	}
+}
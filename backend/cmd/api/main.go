@@ -4,13 +4,19 @@ import (
 	"context"
 	"database/sql"
 	"flag"
-	"fmt"
 	"log/slog"
-	"net/http"
 	"os"
+	"sync"
 	"time"
 
+	"github.com/chefgoldbloom/pnctool/backend/internal/artifact"
 	"github.com/chefgoldbloom/pnctool/backend/internal/data"
+	"github.com/chefgoldbloom/pnctool/backend/internal/device"
+	"github.com/chefgoldbloom/pnctool/backend/internal/events"
+	"github.com/chefgoldbloom/pnctool/backend/internal/inventory"
+	"github.com/chefgoldbloom/pnctool/backend/internal/monitor"
+	"github.com/chefgoldbloom/pnctool/backend/internal/upgrade"
+	"github.com/chefgoldbloom/pnctool/backend/internal/webhook"
 	_ "github.com/lib/pq"
 )
 
@@ -33,15 +39,66 @@ type config struct {
 		maxIdleConns int
 		maxIdleTime  time.Duration
 	}
+	idempotency struct {
+		ttl   time.Duration
+		lease time.Duration
+	}
+	status struct {
+		probe       string
+		interval    time.Duration
+		maxBackoff  time.Duration
+		timeout     time.Duration
+		concurrency int
+	}
+	incidents struct {
+		openAfter   int
+		flapWindow  time.Duration
+		flapChanges int
+	}
+	webhooks struct {
+		timeout     time.Duration
+		maxAttempts int
+		backoff     time.Duration
+		concurrency int
+	}
+	stream struct {
+		keepAlive time.Duration
+	}
+	firmware struct {
+		interval    time.Duration
+		timeout     time.Duration
+		concurrency int
+	}
+	upgrades struct {
+		artifactDir    string
+		maxImageSize   int64
+		uploadTimeout  time.Duration
+		concurrency    int
+		infoTimeout    time.Duration
+		upgradeTimeout time.Duration
+		verifyTimeout  time.Duration
+		pollInterval   time.Duration
+	}
 }
 
 // Define an application struct to hold the dependencies for our HTTP handlers, helpers,
 // and middleware. At the moment this only contains a copy of the config struct and a
 // logger, but it will grow to include a lot more as our build progresses.
 type application struct {
-	cfg    config
-	logger *slog.Logger
-	models data.Models
+	cfg              config
+	logger           *slog.Logger
+	models           data.Models
+	idempotencyLocks keyedMutex
+	devices          *device.Registry
+	poller           *monitor.Poller
+	collector        *inventory.Collector
+	artifacts        *artifact.Store
+	upgrades         *upgrade.Runner
+	events           events.Publisher
+	webhooks         *webhook.Dispatcher
+	stream           *events.Hub
+	listener         *events.Listener
+	wg               sync.WaitGroup
 }
 
 // Instantiate Models
@@ -59,6 +116,32 @@ func main() {
 	flag.IntVar(&cfg.db.maxOpenConns, "db-max-open-conns", 25, "PostgreSQL max open connections")
 	flag.IntVar(&cfg.db.maxIdleConns, "db-max-idle-conns", 25, "PostgreSQL max idle connections")
 	flag.DurationVar(&cfg.db.maxIdleTime, "db-max-idle-time", 15*time.Minute, "PostgreSQL max idle time")
+	flag.DurationVar(&cfg.idempotency.ttl, "idempotency-ttl", 24*time.Hour, "How long Idempotency-Key responses are kept for replay")
+	flag.DurationVar(&cfg.idempotency.lease, "idempotency-lease", 15*time.Minute, "How long an unfinished Idempotency-Key request holds its key before a retry may take it over; must outlast the slowest request")
+	flag.StringVar(&cfg.status.probe, "status-probe", "http", "How camera reachability is checked -- (icmp|tcp|http)")
+	flag.DurationVar(&cfg.status.interval, "status-interval", monitor.DefaultConfig.Interval, "How often each camera's status is checked, or 0 to disable polling")
+	flag.DurationVar(&cfg.status.maxBackoff, "status-max-backoff", monitor.DefaultConfig.MaxBackoff, "Longest interval between checks of an offline camera")
+	flag.DurationVar(&cfg.status.timeout, "status-timeout", monitor.DefaultConfig.Timeout, "Timeout for one status check")
+	flag.IntVar(&cfg.status.concurrency, "status-concurrency", monitor.DefaultConfig.Concurrency, "Status checks in flight at once")
+	flag.IntVar(&cfg.incidents.openAfter, "incident-open-after", monitor.DefaultConfig.OpenAfter, "Failed status checks in a row before an incident is opened")
+	flag.DurationVar(&cfg.incidents.flapWindow, "incident-flap-window", monitor.DefaultConfig.FlapWindow, "How long a camera going up or down counts towards flapping")
+	flag.IntVar(&cfg.incidents.flapChanges, "incident-flap-changes", monitor.DefaultConfig.FlapChanges, "Times a camera goes up or down within the flap window before incidents are suppressed")
+	flag.DurationVar(&cfg.webhooks.timeout, "webhook-timeout", webhook.DefaultConfig.Timeout, "Timeout for one webhook delivery attempt")
+	flag.IntVar(&cfg.webhooks.maxAttempts, "webhook-max-attempts", webhook.DefaultConfig.MaxAttempts, "Attempts at a webhook delivery before it is dead")
+	flag.DurationVar(&cfg.webhooks.backoff, "webhook-backoff", webhook.DefaultConfig.Backoff, "Wait before retrying a failed webhook delivery, doubled for each retry after")
+	flag.IntVar(&cfg.webhooks.concurrency, "webhook-concurrency", webhook.DefaultConfig.Concurrency, "Webhook deliveries in flight at once")
+	flag.DurationVar(&cfg.firmware.interval, "firmware-interval", inventory.DefaultConfig.Interval, "How often each camera's firmware is collected, or 0 to disable collection")
+	flag.DurationVar(&cfg.firmware.timeout, "firmware-timeout", inventory.DefaultConfig.Timeout, "Timeout for collecting one camera's firmware")
+	flag.IntVar(&cfg.firmware.concurrency, "firmware-concurrency", inventory.DefaultConfig.Concurrency, "Cameras asked for their firmware at once")
+	flag.StringVar(&cfg.upgrades.artifactDir, "artifact-dir", "./artifacts", "Directory uploaded firmware images are kept in")
+	flag.Int64Var(&cfg.upgrades.maxImageSize, "firmware-max-image-size", 512<<20, "Largest firmware image which can be uploaded, in bytes")
+	flag.DurationVar(&cfg.upgrades.uploadTimeout, "firmware-upload-timeout", 10*time.Minute, "Timeout for uploading one firmware image")
+	flag.IntVar(&cfg.upgrades.concurrency, "upgrade-concurrency", upgrade.DefaultConfig.Concurrency, "Camera upgrades in flight at once, across every campaign")
+	flag.DurationVar(&cfg.upgrades.infoTimeout, "upgrade-info-timeout", upgrade.DefaultConfig.Timeout, "Timeout for reading a camera's firmware before and after its upgrade")
+	flag.DurationVar(&cfg.upgrades.upgradeTimeout, "upgrade-timeout", upgrade.DefaultConfig.UpgradeTimeout, "Timeout for sending a firmware image to one camera")
+	flag.DurationVar(&cfg.upgrades.verifyTimeout, "upgrade-verify-timeout", upgrade.DefaultConfig.VerifyTimeout, "How long an upgraded camera has to come back on the new firmware")
+	flag.DurationVar(&cfg.upgrades.pollInterval, "upgrade-poll-interval", upgrade.DefaultConfig.PollInterval, "Interval between checks of an upgraded camera's firmware")
+	flag.DurationVar(&cfg.stream.keepAlive, "stream-keepalive", 15*time.Second, "Interval between keep-alive comments on an idle event stream")
 
 	flag.Parse()
 
@@ -80,29 +163,78 @@ func main() {
 	// Declare an instance of the application struct, containing the config struct and
 	// the logger.
 	app := &application{
-		cfg:    cfg,
-		logger: logger,
-		models: data.NewModels(db),
+		cfg:     cfg,
+		logger:  logger,
+		models:  data.NewModels(db),
+		devices: device.NewRegistry(device.NewClient(cfg.status.timeout)),
 	}
 
-	// Declare a HTTP server which listens on the port provided in the config struct,
-	// uses the servemux we created above as the handler, has some sensible timeout
-	// settings and writes any log messages to the structured logger at Error level.
-	srv := &http.Server{
-		Addr:         fmt.Sprintf(":%d", cfg.port),
-		Handler:      app.routes(),
-		IdleTimeout:  time.Minute,
-		ReadTimeout:  5 * time.Second,
-		WriteTimeout: 10 * time.Second,
-		ErrorLog:     slog.NewLogLogger(logger.Handler(), slog.LevelError),
+	// Events are logged and then queued for the webhooks subscribed to them
+	bus := events.NewBus(app.models.Events)
+	app.events = bus
+	app.webhooks = webhook.New(app.models.Webhooks, logger, webhook.Config{
+		Timeout:     cfg.webhooks.timeout,
+		Concurrency: cfg.webhooks.concurrency,
+		MaxAttempts: cfg.webhooks.maxAttempts,
+		Backoff:     cfg.webhooks.backoff,
+	})
+	bus.Subscribe(app.webhooks.Enqueue)
+
+	// Every instance hears about the events published by any of them, to pass on to
+	// clients streaming events and to deliver webhooks queued elsewhere straight away
+	app.stream = events.NewHub()
+	app.listener = events.NewListener(cfg.db.dsn, app.models.Events, logger)
+	app.listener.Subscribe(app.stream.Publish)
+	app.listener.Subscribe(func(*data.Event) { app.webhooks.Wake() })
+
+	// Poll camera status in the background unless it has been turned off
+	if cfg.status.interval > 0 {
+		prober, err := monitor.NewProber(cfg.status.probe, app.devices)
+		if err != nil {
+			logger.Error(err.Error())
+			os.Exit(1)
+		}
+		app.poller = monitor.New(app.models.Statuses, app.models.Incidents, app.events, prober, logger, monitor.Config{
+			Interval:    cfg.status.interval,
+			MaxBackoff:  cfg.status.maxBackoff,
+			Timeout:     cfg.status.timeout,
+			Concurrency: cfg.status.concurrency,
+			Jitter:      monitor.DefaultConfig.Jitter,
+			OpenAfter:   cfg.incidents.openAfter,
+			FlapWindow:  cfg.incidents.flapWindow,
+			FlapChanges: cfg.incidents.flapChanges,
+		})
 	}
 
-	// Start the HTTP server.
-	logger.Info("starting server", "addr", srv.Addr, "env", cfg.env)
-	err = srv.ListenAndServe()
-	logger.Error(err.Error())
-	os.Exit(1)
+	// Collect camera firmware in the background unless it has been turned off
+	if cfg.firmware.interval > 0 {
+		app.collector = inventory.New(app.models.Statuses, app.models.Firmware, app.events, app.devices, logger, inventory.Config{
+			Interval:    cfg.firmware.interval,
+			Timeout:     cfg.firmware.timeout,
+			Concurrency: cfg.firmware.concurrency,
+		})
+	}
 
+	// Upgrade campaigns install images from the artifact store in the background
+	app.artifacts, err = artifact.NewStore(cfg.upgrades.artifactDir)
+	if err != nil {
+		logger.Error(err.Error())
+		os.Exit(1)
+	}
+	app.upgrades = upgrade.New(app.models.Upgrades, app.models.Firmware, app.artifacts, app.devices, app.events, logger, upgrade.Config{
+		Concurrency:    cfg.upgrades.concurrency,
+		Timeout:        cfg.upgrades.infoTimeout,
+		UpgradeTimeout: cfg.upgrades.upgradeTimeout,
+		VerifyTimeout:  cfg.upgrades.verifyTimeout,
+		PollInterval:   cfg.upgrades.pollInterval,
+	})
+
+	// Start the HTTP server, which returns once it has shut down gracefully.
+	err = app.serve()
+	if err != nil {
+		logger.Error(err.Error())
+		os.Exit(1)
+	}
 }
 
 func openDB(cfg config) (*sql.DB, error) {
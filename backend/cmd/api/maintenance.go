@@ -0,0 +1,109 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/chefgoldbloom/pnctool/backend/internal/data"
+	"github.com/chefgoldbloom/pnctool/backend/internal/validator"
+)
+
+// listMaintenanceWindowsHandler for the "GET /v1/maintenance-windows" endpoint returns
+// the windows applying to site, or every window if site is empty, overlapping the
+// from and to dates inclusive. Without dates every window is returned.
+func (app *application) listMaintenanceWindowsHandler(w http.ResponseWriter, r *http.Request) {
+	v := validator.New()
+	qs := r.URL.Query()
+
+	site := app.readString(qs, "site", "")
+	from := app.readDate(qs, "from", time.Time{}, v)
+	to := app.readDate(qs, "to", time.Date(9999, 12, 30, 0, 0, 0, 0, time.UTC), v).AddDate(0, 0, 1)
+	v.CheckCode(to.After(from), "to", validator.CodeOutOfRange, "must not be before from")
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v)
+		return
+	}
+
+	windows, err := app.models.Maintenance.GetAll(site, from, to)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"maintenance_windows": windows}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// createMaintenanceWindowHandler for the "POST /v1/maintenance-windows" endpoint. The
+// caller is recorded as the window's creator.
+func (app *application) createMaintenanceWindowHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		SiteName string    `json:"site_name"`
+		StartsAt time.Time `json:"starts_at"`
+		EndsAt   time.Time `json:"ends_at"`
+		Reason   string    `json:"reason"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	window := &data.MaintenanceWindow{
+		CreatedBy: app.contextGetIdentity(r).User,
+		SiteName:  input.SiteName,
+		StartsAt:  input.StartsAt,
+		EndsAt:    input.EndsAt,
+		Reason:    input.Reason,
+	}
+
+	v := validator.New()
+	if data.ValidateMaintenanceWindow(v, window); !v.Valid() {
+		app.failedValidationResponse(w, r, v)
+		return
+	}
+
+	err = app.models.Maintenance.Insert(window)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	headers := make(http.Header)
+	headers.Set("Location", fmt.Sprintf("/v1/maintenance-windows/%d", window.ID))
+
+	err = app.writeJSON(w, http.StatusCreated, envelope{"maintenance_window": window}, headers)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// deleteMaintenanceWindowHandler for the "DELETE /v1/maintenance-windows/:id" endpoint.
+func (app *application) deleteMaintenanceWindowHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	err = app.models.Maintenance.Delete(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"message": "maintenance window successfully deleted"}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
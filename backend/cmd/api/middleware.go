@@ -3,6 +3,7 @@ package main
 import (
 	"fmt"
 	"net/http"
+	"strings"
 )
 
 // recoverPanic is middleware wrapping the router that ensures we send a 500 Internal Server Error
@@ -18,3 +19,25 @@ func (app *application) recoverPanic(next http.Handler) http.Handler {
 		next.ServeHTTP(w, r)
 	})
 }
+
+// identify records the X-User and X-Team headers as the request's identity.
+func (app *application) identify(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := identity{
+			User: strings.TrimSpace(r.Header.Get("X-User")),
+			Team: strings.TrimSpace(r.Header.Get("X-Team")),
+		}
+		next.ServeHTTP(w, app.contextSetIdentity(r, id))
+	})
+}
+
+// requireUser rejects anonymous requests with 401 Unauthorized.
+func (app *application) requireUser(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if app.contextGetIdentity(r).User == "" {
+			app.authenticationRequiredResponse(w, r)
+			return
+		}
+		next.ServeHTTP(w, r)
+	}
+}
@@ -0,0 +1,267 @@
+package main
+
+import (
+	"encoding/json"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/chefgoldbloom/pnctool/backend/internal/data"
+)
+
+// spec is the subset of the OpenAPI document that the drift tests look at.
+type spec struct {
+	Info struct {
+		Version string `json:"version"`
+	} `json:"info"`
+	Paths      map[string]map[string]json.RawMessage `json:"paths"`
+	Components struct {
+		Schemas map[string]schema `json:"schemas"`
+	} `json:"components"`
+}
+
+type schema struct {
+	Required   []string                   `json:"required"`
+	Properties map[string]json.RawMessage `json:"properties"`
+}
+
+var pathParamRxp = regexp.MustCompile(`:([a-zA-Z_]+)`)
+
+func loadSpec(t *testing.T) spec {
+	t.Helper()
+
+	var s spec
+	if err := json.Unmarshal(openAPISpec, &s); err != nil {
+		t.Fatalf("openapi.json is not valid JSON: %v", err)
+	}
+	return s
+}
+
+// registeredRoutes parses routes.go and returns every "METHOD /path" registered on the
+// router, with httprouter's :param segments rewritten to OpenAPI's {param}.
+func registeredRoutes(t *testing.T) []string {
+	t.Helper()
+
+	f, err := parser.ParseFile(token.NewFileSet(), "routes.go", nil, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var routes []string
+	ast.Inspect(f, func(n ast.Node) bool {
+		call, ok := n.(*ast.CallExpr)
+		if !ok || len(call.Args) < 3 {
+			return true
+		}
+		sel, ok := call.Fun.(*ast.SelectorExpr)
+		if !ok || (sel.Sel.Name != "HandlerFunc" && sel.Sel.Name != "Handler") {
+			return true
+		}
+		if recv, ok := sel.X.(*ast.Ident); !ok || recv.Name != "router" {
+			return true
+		}
+		method, ok := call.Args[0].(*ast.SelectorExpr)
+		if !ok {
+			t.Fatalf("route method must be an http.Method* constant")
+		}
+		lit, ok := call.Args[1].(*ast.BasicLit)
+		if !ok {
+			t.Fatalf("route path must be a string literal")
+		}
+		path, err := strconv.Unquote(lit.Value)
+		if err != nil {
+			t.Fatal(err)
+		}
+		path = pathParamRxp.ReplaceAllString(path, "{$1}")
+		routes = append(routes, strings.ToUpper(strings.TrimPrefix(method.Sel.Name, "Method"))+" "+path)
+		return true
+	})
+
+	sort.Strings(routes)
+	return routes
+}
+
+func documentedRoutes(s spec) []string {
+	var routes []string
+	for path, item := range s.Paths {
+		for method := range item {
+			if method == "parameters" || method == "summary" || method == "description" {
+				continue
+			}
+			routes = append(routes, strings.ToUpper(method)+" "+path)
+		}
+	}
+	sort.Strings(routes)
+	return routes
+}
+
+func TestOpenAPIRoutesMatchRouter(t *testing.T) {
+	s := loadSpec(t)
+
+	registered := registeredRoutes(t)
+	documented := documentedRoutes(s)
+
+	if !reflect.DeepEqual(registered, documented) {
+		t.Errorf("routes.go and openapi.json disagree\nregistered: %v\ndocumented: %v", registered, documented)
+	}
+
+	if s.Info.Version != version {
+		t.Errorf("openapi.json info.version = %q; want %q", s.Info.Version, version)
+	}
+}
+
+// jsonFields returns the JSON member names produced by encoding a value of type typ.
+func jsonFields(typ reflect.Type) []string {
+	var fields []string
+	for i := 0; i < typ.NumField(); i++ {
+		field := typ.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+		name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+		switch name {
+		case "-":
+			continue
+		case "":
+			name = field.Name
+		}
+		fields = append(fields, name)
+	}
+	sort.Strings(fields)
+	return fields
+}
+
+func schemaFields(sc schema) []string {
+	var fields []string
+	for name := range sc.Properties {
+		fields = append(fields, name)
+	}
+	sort.Strings(fields)
+	return fields
+}
+
+func TestOpenAPICameraSchemaMatchesStruct(t *testing.T) {
+	s := loadSpec(t)
+
+	want := jsonFields(reflect.TypeOf(data.Camera{}))
+	got := schemaFields(s.Components.Schemas["Camera"])
+
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Camera schema properties = %v; data.Camera JSON fields = %v", got, want)
+	}
+}
+
+// assertEnvelope checks that body decodes to an object with exactly the properties
+// of the named schema, and that every required property is present.
+func assertEnvelope(t *testing.T, s spec, name string, body []byte) {
+	t.Helper()
+
+	sc, ok := s.Components.Schemas[name]
+	if !ok {
+		t.Fatalf("schema %q not found in openapi.json", name)
+	}
+
+	var got map[string]json.RawMessage
+	if err := json.Unmarshal(body, &got); err != nil {
+		t.Fatalf("response is not a JSON object: %v\n%s", err, body)
+	}
+
+	for member := range got {
+		if _, ok := sc.Properties[member]; !ok {
+			t.Errorf("response member %q is not documented in the %s schema", member, name)
+		}
+	}
+	for _, member := range sc.Required {
+		if _, ok := got[member]; !ok {
+			t.Errorf("required member %q missing from %s response", member, name)
+		}
+	}
+}
+
+func TestOpenAPIEnvelopes(t *testing.T) {
+	s := loadSpec(t)
+	app := newTestApplication(t)
+	routes := app.routes()
+
+	tests := []struct {
+		name    string
+		method  string
+		url     string
+		body    string
+		accept  string
+		status  int
+		schema  string
+		content string
+	}{
+		{"healthcheck", http.MethodGet, "/v1/healthcheck", "", "", http.StatusOK, "HealthcheckEnvelope", "application/json"},
+		{"not found", http.MethodGet, "/v1/nope", "", "", http.StatusNotFound, "Error", "application/json"},
+		{"not found problem", http.MethodGet, "/v1/nope", "", problemContentType, http.StatusNotFound, "Problem", problemContentType},
+		{"method not allowed", http.MethodPut, "/v1/healthcheck", "", "", http.StatusMethodNotAllowed, "Error", "application/json"},
+		{"bad request", http.MethodPost, "/v1/cameras", "{", "", http.StatusBadRequest, "Error", "application/json"},
+		{"validation", http.MethodPost, "/v1/cameras", "{}", "", http.StatusUnprocessableEntity, "Error", "application/json"},
+		{"validation problem", http.MethodPost, "/v1/cameras", "{}", problemContentType, http.StatusUnprocessableEntity, "Problem", problemContentType},
+		{"list validation", http.MethodGet, "/v1/cameras?page=0", "", "", http.StatusUnprocessableEntity, "Error", "application/json"},
+		{"create", http.MethodPost, "/v1/cameras", validCameraJSON, "", http.StatusCreated, "CameraEnvelope", "application/json"},
+		{"show", http.MethodGet, "/v1/cameras/1", "", "", http.StatusOK, "CameraEnvelope", "application/json"},
+		{"list", http.MethodGet, "/v1/cameras", "", "", http.StatusOK, "CamerasEnvelope", "application/json"},
+		{"search", http.MethodGet, "/v1/cameras?search=lobby", "", "", http.StatusOK, "CamerasEnvelope", "application/json"},
+		{"suggest", http.MethodGet, "/v1/search/suggest?q=lob", "", "", http.StatusOK, "SuggestionsEnvelope", "application/json"},
+		{"stats", http.MethodGet, "/v1/stats/cameras?group_by=site_name", "", "", http.StatusOK, "StatsEnvelope", "application/json"},
+		{"time series", http.MethodGet, "/v1/stats/cameras?interval=week", "", "", http.StatusOK, "StatsEnvelope", "application/json"},
+		{"update", http.MethodPatch, "/v1/cameras/1", `{"name":"lobby-west"}`, "", http.StatusOK, "CameraEnvelope", "application/json"},
+		{"availability", http.MethodGet, "/v1/reports/availability", "", "", http.StatusOK, "AvailabilityReportEnvelope", "application/json"},
+		{"create maintenance", http.MethodPost, "/v1/maintenance-windows", `{"starts_at":"2026-03-07T22:00:00Z","ends_at":"2026-03-08T02:00:00Z"}`, "", http.StatusCreated, "MaintenanceWindowEnvelope", "application/json"},
+		{"list maintenance", http.MethodGet, "/v1/maintenance-windows", "", "", http.StatusOK, "MaintenanceWindowsEnvelope", "application/json"},
+		{"incidents", http.MethodGet, "/v1/incidents", "", "", http.StatusOK, "IncidentsEnvelope", "application/json"},
+		{"create firmware catalog entry", http.MethodPost, "/v1/firmware-catalog", `{"model_no":"P3245","recommended_version":"10.12.114"}`, "", http.StatusCreated, "FirmwareCatalogEntryEnvelope", "application/json"},
+		{"firmware catalog", http.MethodGet, "/v1/firmware-catalog", "", "", http.StatusOK, "FirmwareCatalogEnvelope", "application/json"},
+		{"camera firmware", http.MethodGet, "/v1/cameras/1/firmware", "", "", http.StatusOK, "CameraFirmwareEnvelope", "application/json"},
+		{"firmware compliance", http.MethodGet, "/v1/reports/firmware-compliance", "", "", http.StatusOK, "FirmwareComplianceReportEnvelope", "application/json"},
+		{"stream validation", http.MethodGet, "/v1/events/stream?type=camera.exploded", "", "", http.StatusUnprocessableEntity, "Error", "application/json"},
+		{"delete", http.MethodDelete, "/v1/cameras/1", "", "", http.StatusOK, "MessageEnvelope", "application/json"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(tt.method, tt.url, strings.NewReader(tt.body))
+			// Endpoints which don't need an identity ignore it.
+			r.Header.Set("X-User", "ana")
+			if tt.accept != "" {
+				r.Header.Set("Accept", tt.accept)
+			}
+			rr := httptest.NewRecorder()
+
+			routes.ServeHTTP(rr, r)
+
+			if rr.Code != tt.status {
+				t.Fatalf("status = %d; want %d\n%s", rr.Code, tt.status, rr.Body)
+			}
+			if ct := rr.Header().Get("Content-Type"); ct != tt.content {
+				t.Errorf("Content-Type = %q; want %q", ct, tt.content)
+			}
+			assertEnvelope(t, s, tt.schema, rr.Body.Bytes())
+		})
+	}
+}
+
+func TestOpenAPIHandler(t *testing.T) {
+	app := newTestApplication(t)
+
+	rr := httptest.NewRecorder()
+	app.routes().ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/v1/openapi.json", nil))
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("status = %d; want %d", rr.Code, http.StatusOK)
+	}
+	if !json.Valid(rr.Body.Bytes()) {
+		t.Error("served document is not valid JSON")
+	}
+}
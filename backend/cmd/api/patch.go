@@ -0,0 +1,70 @@
+package main
+
+import (
+	"encoding/json"
+	"mime"
+	"net/http"
+
+	"github.com/chefgoldbloom/pnctool/backend/internal/data"
+	"github.com/chefgoldbloom/pnctool/backend/internal/validator"
+)
+
+// Media types accepted by PATCH endpoints, advertised through the Accept-Patch header.
+const (
+	mergePatchContentType = "application/merge-patch+json"
+	jsonPatchContentType  = "application/json-patch+json"
+	acceptPatch           = mergePatchContentType + ", " + jsonPatchContentType
+)
+
+// readOnlyCameraFields are the members of a camera's JSON representation which are set
+// by the server and can't be changed by PATCH or PUT.
+var readOnlyCameraFields = []string{"id", "created_at", "version"}
+
+// requestMediaType returns the media type of the request's Content-Type header
+// without parameters, or "" if there is none.
+func requestMediaType(r *http.Request) string {
+	ct := r.Header.Get("Content-Type")
+	if ct == "" {
+		return ""
+	}
+	mediaType, _, err := mime.ParseMediaType(ct)
+	if err != nil {
+		return ct
+	}
+	return mediaType
+}
+
+// cameraDocument returns the camera's JSON representation split into members.
+func cameraDocument(camera *data.Camera) (map[string]json.RawMessage, error) {
+	js, err := json.Marshal(camera)
+	if err != nil {
+		return nil, err
+	}
+	var doc map[string]json.RawMessage
+	err = json.Unmarshal(js, &doc)
+	return doc, err
+}
+
+// cameraFromDocument decodes a complete camera JSON representation, such as a patched
+// copy of current, into a new Camera. Fields which aren't part of the representation
+// (the device credentials) are carried over from current.
+func cameraFromDocument(current *data.Camera, doc []byte) (*data.Camera, error) {
+	var camera data.Camera
+	err := decodeJSON(doc, &camera)
+	if err != nil {
+		return nil, err
+	}
+	camera.Username = current.Username
+	camera.Password = current.Password
+	// Embedded related resources are read-only views, never part of an update.
+	camera.Site, camera.Model, camera.Status, camera.Search = nil, nil, nil, nil
+	return &camera, nil
+}
+
+// validateReadOnlyFields checks that a patch or replacement left the server-managed
+// fields alone.
+func validateReadOnlyFields(v *validator.Validator, current, updated *data.Camera) {
+	v.CheckCode(updated.ID == current.ID, "id", validator.CodeReadOnly, "cannot be changed")
+	v.CheckCode(updated.CreatedAt.Equal(current.CreatedAt), "created_at", validator.CodeReadOnly, "cannot be changed")
+	v.CheckCode(updated.Version == current.Version, "version", validator.CodeReadOnly, "cannot be changed")
+}
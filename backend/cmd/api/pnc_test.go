@@ -0,0 +1,227 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/chefgoldbloom/pnctool/backend/internal/data"
+)
+
+// The pnc command is built once per test run and driven against the real handlers,
+// so the CLI and the API can't drift apart. The binary is removed by TestMain.
+var (
+	pncOnce sync.Once
+	pncPath string
+	pncErr  error
+	pncDir  string
+)
+
+func TestMain(m *testing.M) {
+	code := m.Run()
+	if pncDir != "" {
+		os.RemoveAll(pncDir)
+	}
+	os.Exit(code)
+}
+
+// buildPnc returns the path of the pnc binary, building it on first use.
+func buildPnc(t *testing.T) string {
+	t.Helper()
+
+	if testing.Short() {
+		t.Skip("skipping pnc build in short mode")
+	}
+	pncOnce.Do(func() {
+		pncDir, pncErr = os.MkdirTemp("", "pnctool-pnc-")
+		if pncErr != nil {
+			return
+		}
+		pncPath = filepath.Join(pncDir, "pnc")
+		if runtime.GOOS == "windows" {
+			pncPath += ".exe"
+		}
+		out, err := exec.Command("go", "build", "-o", pncPath, "../pnc").CombinedOutput()
+		if err != nil {
+			pncErr = errors.New(err.Error() + "\n" + string(out))
+		}
+	})
+	if pncErr != nil {
+		t.Fatalf("building pnc: %v", pncErr)
+	}
+	return pncPath
+}
+
+// pncResult is the outcome of one pnc invocation.
+type pncResult struct {
+	stdout string
+	stderr string
+	code   int
+}
+
+// newPnc starts the application's routes on a test server and returns a function
+// which runs pnc against it with a config file of its own.
+func newPnc(t *testing.T) func(stdin string, args ...string) pncResult {
+	t.Helper()
+
+	bin := buildPnc(t)
+	srv := httptest.NewServer(newTestApplication(t).routes())
+	t.Cleanup(srv.Close)
+	config := filepath.Join(t.TempDir(), "config.json")
+
+	return func(stdin string, args ...string) pncResult {
+		t.Helper()
+
+		cmd := exec.Command(bin, args...)
+		cmd.Env = append(os.Environ(), "PNC_CONFIG="+config, "PNC_URL="+srv.URL, "PNC_PROFILE=", "PNC_TOKEN=", "PNC_USER=", "PNC_TEAM=")
+		cmd.Stdin = strings.NewReader(stdin)
+		var stdout, stderr bytes.Buffer
+		cmd.Stdout, cmd.Stderr = &stdout, &stderr
+
+		res := pncResult{}
+		err := cmd.Run()
+		var exitErr *exec.ExitError
+		switch {
+		case errors.As(err, &exitErr):
+			res.code = exitErr.ExitCode()
+		case err != nil:
+			t.Fatal(err)
+		}
+		res.stdout, res.stderr = stdout.String(), stderr.String()
+		return res
+	}
+}
+
+// cameras decodes pnc's --output json.
+func (res pncResult) cameras(t *testing.T) []data.Camera {
+	t.Helper()
+
+	var cameras []data.Camera
+	if err := json.Unmarshal([]byte(res.stdout), &cameras); err != nil {
+		t.Fatalf("output is not a JSON array of cameras: %v\n%s", err, res.stdout)
+	}
+	return cameras
+}
+
+func TestPncCameras(t *testing.T) {
+	pnc := newPnc(t)
+
+	res := pnc("", "cameras", "add", "--name", "lobby-east", "--mac", "ACCC8E000001", "--site", "NYC-5th-OPS", "--model", "P3245", "--address", "10.0.0.7")
+	if res.code != 0 {
+		t.Fatalf("add: exit %d\n%s", res.code, res.stderr)
+	}
+	if !strings.HasPrefix(res.stdout, "ID  NAME") || !strings.Contains(res.stdout, "lobby-east") {
+		t.Errorf("add table output =\n%s", res.stdout)
+	}
+	pnc("", "cameras", "add", "--name", "dock", "--mac", "ACCC8E000002", "--site", "BOS-Main-GLH", "-o", "json")
+
+	res = pnc("", "cameras", "add", "--name", "gate", "--mac", "ACCC8E", "--site", "NYC")
+	if res.code != 1 || !strings.Contains(res.stderr, "mac_address") {
+		t.Errorf("invalid add: exit %d\n%s", res.code, res.stderr)
+	}
+
+	tests := []struct {
+		args  []string
+		names string
+	}{
+		{[]string{"cameras", "list", "-o", "json"}, "[lobby-east dock]"},
+		{[]string{"cameras", "list", "--site", "BOS-Main-GLH", "-o", "json"}, "[dock]"},
+		{[]string{"cameras", "list", "--query", "model_no:P32*", "-o", "json"}, "[lobby-east]"},
+		{[]string{"cameras", "list", "--sort", "-id", "--limit", "1", "-o", "json"}, "[dock]"},
+	}
+	for _, tt := range tests {
+		res := pnc("", tt.args...)
+		if res.code != 0 {
+			t.Errorf("%v: exit %d\n%s", tt.args, res.code, res.stderr)
+			continue
+		}
+		var names []string
+		for _, c := range res.cameras(t) {
+			names = append(names, c.Name)
+		}
+		if fmt.Sprint(names) != tt.names {
+			t.Errorf("%v: names = %v; want %s", tt.args, names, tt.names)
+		}
+	}
+
+	res = pnc("", "cameras", "list", "-o", "csv")
+	if lines := strings.Split(strings.TrimSpace(res.stdout), "\n"); len(lines) != 3 || lines[0] != "id,name,mac_address,site_name,model_no,version,created_at" {
+		t.Errorf("list csv output =\n%s", res.stdout)
+	}
+
+	// Only the flags given are sent, so the model survives a rename.
+	res = pnc("", "cameras", "edit", "1", "--name", "lobby-west", "-o", "json")
+	if res.code != 0 {
+		t.Fatalf("edit: exit %d\n%s", res.code, res.stderr)
+	}
+	if cameras := res.cameras(t); len(cameras) != 1 || cameras[0].Name != "lobby-west" || cameras[0].ModelNo != "P3245" || cameras[0].Version != 2 {
+		t.Errorf("edited = %+v", cameras)
+	}
+	if res := pnc("", "cameras", "edit", "--model", "", "1", "-o", "json"); res.code != 0 || res.cameras(t)[0].ModelNo != "" {
+		t.Errorf("clear model: exit %d\n%s%s", res.code, res.stdout, res.stderr)
+	}
+	if res := pnc("", "cameras", "edit", "99", "--name", "x"); res.code != 1 {
+		t.Errorf("edit missing camera: exit %d; want 1", res.code)
+	}
+	if res := pnc("", "cameras", "edit", "--name", "x"); res.code != 1 || !strings.Contains(res.stderr, "missing argument") {
+		t.Errorf("edit without id: exit %d\n%s", res.code, res.stderr)
+	}
+	if res := pnc("", "cameras", "frobnicate"); res.code != 2 {
+		t.Errorf("unknown subcommand: exit %d; want 2", res.code)
+	}
+}
+
+func TestPncImport(t *testing.T) {
+	pnc := newPnc(t)
+
+	file := filepath.Join(t.TempDir(), "cameras.csv")
+	csv := "name, mac_address, site_name, address\n" +
+		"lobby-east,ACCC8E000001,NYC-5th-OPS,10.0.0.7\n" +
+		"gate,ACCC8E,NYC-5th-OPS,\n" +
+		"dock,ACCC8E000002,BOS-Main-GLH,\n"
+	if err := os.WriteFile(file, []byte(csv), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	// The bad row is reported and skipped; the others are still created.
+	res := pnc("", "cameras", "import", file, "-o", "json")
+	if res.code != 1 || !strings.Contains(res.stderr, "line 3:") || !strings.Contains(res.stderr, "1 of 3 rows failed") {
+		t.Errorf("import: exit %d\n%s", res.code, res.stderr)
+	}
+	created := res.cameras(t)
+	if len(created) != 2 || created[0].Name != "lobby-east" || created[0].Address != "10.0.0.7" || created[1].Name != "dock" {
+		t.Errorf("imported = %+v", created)
+	}
+
+	// "-" reads standard input.
+	res = pnc("name,mac_address,site_name\nspare,ACCC8E000003,BOS-Main-GLH\n", "cameras", "import", "-", "-o", "csv")
+	if res.code != 0 || !strings.Contains(res.stdout, "spare") {
+		t.Errorf("import from stdin: exit %d\n%s%s", res.code, res.stdout, res.stderr)
+	}
+
+	tests := []struct {
+		name, csv, err string
+	}{
+		{"unknown column", "name,serial\nx,y\n", `unknown CSV column "serial"`},
+		{"empty", "", "reading CSV header"},
+	}
+	for _, tt := range tests {
+		res := pnc(tt.csv, "cameras", "import", "-")
+		if res.code != 1 || !strings.Contains(res.stderr, tt.err) {
+			t.Errorf("%s: exit %d\n%s", tt.name, res.code, res.stderr)
+		}
+	}
+
+	if n := len(pnc("", "cameras", "list", "-o", "json").cameras(t)); n != 3 {
+		t.Errorf("cameras = %d; want 3", n)
+	}
+}
@@ -0,0 +1,199 @@
+package main
+
+import (
+	"encoding/csv"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/chefgoldbloom/pnctool/backend/internal/data"
+	"github.com/chefgoldbloom/pnctool/backend/internal/validator"
+)
+
+// availabilityReportHandler for the "GET /v1/reports/availability" endpoint reports
+// the availability of each camera at site, or at every site, and of each site as a
+// whole, between the from and to dates inclusive. The current month is the default.
+// Maintenance windows are left out unless maintenance=include. With format=csv, or
+// an Accept header asking for text/csv, the report is a CSV table instead.
+func (app *application) availabilityReportHandler(w http.ResponseWriter, r *http.Request) {
+	v := validator.New()
+	qs := r.URL.Query()
+
+	now := time.Now().UTC()
+	month := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC)
+
+	site := app.readString(qs, "site", "")
+	from := app.readDate(qs, "from", month, v)
+	to := app.readDate(qs, "to", month.AddDate(0, 1, -1), v).AddDate(0, 0, 1)
+	target := app.readFloat(qs, "target", data.DefaultAvailabilityTarget, v)
+	maintenance := app.readString(qs, "maintenance", "exclude")
+	format := app.readString(qs, "format", "json")
+
+	data.ValidateAvailabilityReport(v, from, to, target)
+	v.CheckCode(validator.PermittedValue(maintenance, "exclude", "include"), "maintenance", validator.CodeNotPermitted, "must be exclude or include")
+	v.CheckCode(validator.PermittedValue(format, "json", "csv"), "format", validator.CodeNotPermitted, "must be json or csv")
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v)
+		return
+	}
+
+	histories, err := app.models.Statuses.History(site, from, to)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	var windows []*data.MaintenanceWindow
+	if maintenance == "exclude" {
+		windows, err = app.models.Maintenance.GetAll(site, from, to)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+	}
+
+	report := data.NewAvailabilityReport(histories, windows, from, to, now, target)
+
+	if format == "csv" || wantsCSV(r) {
+		err = writeAvailabilityCSV(w, report)
+	} else {
+		err = app.writeJSON(w, http.StatusOK, envelope{"report": report}, nil)
+	}
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// wantsCSV reports whether the client listed text/csv in its Accept header.
+func wantsCSV(r *http.Request) bool {
+	for _, accept := range r.Header.Values("Accept") {
+		for _, part := range strings.Split(accept, ",") {
+			mediaType, _, err := mime.ParseMediaType(strings.TrimSpace(part))
+			if err == nil && mediaType == "text/csv" {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// availabilityColumns heads the CSV report. Site rows leave the camera columns
+// empty and camera rows leave cameras empty.
+var availabilityColumns = []string{
+	"scope", "site_name", "camera_id", "camera_name", "cameras",
+	"availability", "meets_target", "up_seconds", "down_seconds", "unknown_seconds",
+	"maintenance_seconds", "outages", "mttr_seconds",
+}
+
+// writeAvailabilityCSV writes the report as one table, the sites first and then the
+// cameras.
+func writeAvailabilityCSV(w http.ResponseWriter, report *data.AvailabilityReport) error {
+	w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+	w.WriteHeader(http.StatusOK)
+
+	cw := csv.NewWriter(w)
+	cw.Write(availabilityColumns)
+	for _, s := range report.Sites {
+		cw.Write(append([]string{"site", s.SiteName, "", "", strconv.Itoa(s.Cameras)}, availabilityFields(&s.AvailabilityStats)...))
+	}
+	for _, c := range report.Cameras {
+		cw.Write(append([]string{"camera", c.SiteName, strconv.FormatInt(c.CameraID, 10), c.Name, ""}, availabilityFields(&c.AvailabilityStats)...))
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+func availabilityFields(a *data.AvailabilityStats) []string {
+	fields := []string{"", ""}
+	if a.Availability != nil {
+		fields[0] = strconv.FormatFloat(*a.Availability, 'f', -1, 64)
+		fields[1] = strconv.FormatBool(*a.MeetsTarget)
+	}
+	mttr := ""
+	if a.MTTRSeconds != nil {
+		mttr = strconv.FormatFloat(*a.MTTRSeconds, 'f', -1, 64)
+	}
+	return append(fields,
+		strconv.FormatInt(a.UpSeconds, 10),
+		strconv.FormatInt(a.DownSeconds, 10),
+		strconv.FormatInt(a.UnknownSeconds, 10),
+		strconv.FormatInt(a.MaintenanceSeconds, 10),
+		strconv.Itoa(a.Outages),
+		mttr,
+	)
+}
+
+// firmwareComplianceReportHandler for the "GET /v1/reports/firmware-compliance"
+// endpoint rates the firmware of each camera at site, or at every site, against the
+// firmware catalog. Every camera is counted, site by site, but only those with one
+// of the compliance values asked for are listed: the vulnerable and outdated ones by
+// default. With format=csv, or an Accept header asking for text/csv, the listed
+// cameras are a CSV table instead.
+func (app *application) firmwareComplianceReportHandler(w http.ResponseWriter, r *http.Request) {
+	v := validator.New()
+	qs := r.URL.Query()
+
+	site := app.readString(qs, "site", "")
+	listed := app.readCSV(qs, "compliance", data.DefaultFirmwareCompliance)
+	format := app.readString(qs, "format", "json")
+
+	data.ValidateFirmwareComplianceReport(v, listed)
+	v.CheckCode(validator.PermittedValue(format, "json", "csv"), "format", validator.CodeNotPermitted, "must be json or csv")
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v)
+		return
+	}
+
+	inventory, err := app.models.Firmware.Inventory(site)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	catalog, err := app.models.FirmwareCatalog.GetAll()
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	report := data.NewFirmwareComplianceReport(inventory, catalog, listed)
+
+	if format == "csv" || wantsCSV(r) {
+		err = writeFirmwareComplianceCSV(w, report)
+	} else {
+		err = app.writeJSON(w, http.StatusOK, envelope{"report": report}, nil)
+	}
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// firmwareComplianceColumns heads the CSV report.
+var firmwareComplianceColumns = []string{
+	"site_name", "camera_id", "camera_name", "model_no", "firmware", "collected_at",
+	"compliance", "minimum_version", "recommended_version",
+}
+
+// writeFirmwareComplianceCSV writes the listed cameras as one table, site by site.
+func writeFirmwareComplianceCSV(w http.ResponseWriter, report *data.FirmwareComplianceReport) error {
+	w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+	w.WriteHeader(http.StatusOK)
+
+	cw := csv.NewWriter(w)
+	cw.Write(firmwareComplianceColumns)
+	for _, s := range report.Sites {
+		for _, c := range s.Cameras {
+			collectedAt := ""
+			if c.CollectedAt != nil {
+				collectedAt = c.CollectedAt.UTC().Format(time.RFC3339)
+			}
+			cw.Write([]string{
+				c.SiteName, strconv.FormatInt(c.CameraID, 10), c.Name, c.ModelNo, c.Firmware, collectedAt,
+				c.Compliance, c.MinimumVersion, c.RecommendedVersion,
+			})
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
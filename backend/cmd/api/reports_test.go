@@ -0,0 +1,179 @@
+package main
+
+import (
+	"encoding/csv"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/chefgoldbloom/pnctool/backend/internal/data"
+)
+
+// reportSeed has two cameras at one site, the first down from 02:00 to 03:00 on 1
+// March 2026, and a maintenance window for the site covering that hour.
+var reportSeed = testSeed{
+	cameras: []string{
+		`{"name":"Lobby","mac_address":"ACCC8E000001","site_name":"NYC-5th-GLH"}`,
+		`{"name":"Dock","mac_address":"ACCC8E000002","site_name":"NYC-5th-GLH"}`,
+	},
+	statuses: []seedRecord[data.CameraStatus]{
+		{1, data.CameraStatus{Status: data.StatusOnline, CheckedAt: time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC)}},
+		{2, data.CameraStatus{Status: data.StatusOnline, CheckedAt: time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC)}},
+		{1, data.CameraStatus{Status: data.StatusOffline, CheckedAt: time.Date(2026, 3, 1, 2, 0, 0, 0, time.UTC)}},
+		{1, data.CameraStatus{Status: data.StatusOnline, CheckedAt: time.Date(2026, 3, 1, 3, 0, 0, 0, time.UTC)}},
+	},
+	posts: [][2]string{
+		{"/v1/maintenance-windows", `{"site_name":"NYC-5th-GLH","starts_at":"2026-03-01T01:30:00Z","ends_at":"2026-03-01T03:00:00Z","reason":"switch upgrade"}`},
+	},
+}
+
+func TestAvailabilityReport(t *testing.T) {
+	routes := newSeededApplication(t, reportSeed)
+
+	tests := []struct {
+		url          string
+		availability float64
+		outages      int
+	}{
+		{"/v1/reports/availability?from=2026-03-01&to=2026-03-01", 100, 0},
+		{"/v1/reports/availability?from=2026-03-01&to=2026-03-01&maintenance=include", 97.917, 1},
+		{"/v1/reports/availability?site=nyc-5th-glh&from=2026-03-01&to=2026-03-02&maintenance=include", 98.958, 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.url, func(t *testing.T) {
+			res := do(t, routes, http.MethodGet, tt.url, "")
+			if res.status != http.StatusOK {
+				t.Fatalf("status = %d; body = %v", res.status, res.body)
+			}
+			var report data.AvailabilityReport
+			res.decode(t, "report", &report)
+			if len(report.Sites) != 1 || len(report.Cameras) != 2 {
+				t.Fatalf("report = %+v; want one site and two cameras", report)
+			}
+			site := report.Sites[0]
+			if site.Availability == nil || *site.Availability != tt.availability || site.Outages != tt.outages {
+				t.Errorf("site = %+v; want availability %v with %d outages", site, tt.availability, tt.outages)
+			}
+		})
+	}
+}
+
+func TestAvailabilityReportValidation(t *testing.T) {
+	routes := newTestApplication(t).routes()
+
+	for _, url := range []string{
+		"/v1/reports/availability?from=2026-03-02&to=2026-03-01",
+		"/v1/reports/availability?from=2025-01-01&to=2026-03-01",
+		"/v1/reports/availability?from=March",
+		"/v1/reports/availability?target=101",
+		"/v1/reports/availability?target=high",
+		"/v1/reports/availability?maintenance=skip",
+		"/v1/reports/availability?format=xml",
+	} {
+		if res := do(t, routes, http.MethodGet, url, ""); res.status != http.StatusUnprocessableEntity {
+			t.Errorf("%s: status = %d; want %d", url, res.status, http.StatusUnprocessableEntity)
+		}
+	}
+}
+
+func TestAvailabilityReportCSV(t *testing.T) {
+	routes := newSeededApplication(t, reportSeed)
+
+	for _, tt := range []struct {
+		url, accept string
+	}{
+		{"/v1/reports/availability?from=2026-03-01&to=2026-03-01&format=csv", ""},
+		{"/v1/reports/availability?from=2026-03-01&to=2026-03-01", "text/csv, application/json;q=0.5"},
+	} {
+		r := httptest.NewRequest(http.MethodGet, tt.url, nil)
+		if tt.accept != "" {
+			r.Header.Set("Accept", tt.accept)
+		}
+		rr := httptest.NewRecorder()
+		routes.ServeHTTP(rr, r)
+
+		if rr.Code != http.StatusOK {
+			t.Fatalf("status = %d; want %d", rr.Code, http.StatusOK)
+		}
+		if ct := rr.Header().Get("Content-Type"); ct != "text/csv; charset=utf-8" {
+			t.Errorf("Content-Type = %q", ct)
+		}
+		records, err := csv.NewReader(rr.Body).ReadAll()
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := []string{
+			strings.Join(availabilityColumns, ","),
+			"site,NYC-5th-GLH,,,2,100,true,162000,0,0,10800,0,",
+			"camera,NYC-5th-GLH,1,Lobby,,100,true,81000,0,0,5400,0,",
+			"camera,NYC-5th-GLH,2,Dock,,100,true,81000,0,0,5400,0,",
+		}
+		if len(records) != len(want) {
+			t.Fatalf("got %d rows; want %d: %q", len(records), len(want), records)
+		}
+		for i, record := range records {
+			if got := strings.Join(record, ","); got != want[i] {
+				t.Errorf("row %d = %s; want %s", i, got, want[i])
+			}
+		}
+	}
+}
+
+func TestMaintenanceWindows(t *testing.T) {
+	routes := newTestApplication(t).routes()
+
+	tests := []struct {
+		body   string
+		status int
+	}{
+		{`{"site_name":"NYC-5th-GLH","starts_at":"2026-03-07T22:00:00Z","ends_at":"2026-03-08T02:00:00Z","reason":"switch upgrade"}`, http.StatusCreated},
+		{`{"starts_at":"2026-04-01T00:00:00Z","ends_at":"2026-04-01T01:00:00Z"}`, http.StatusCreated},
+		{`{"site_name":"Lobby","starts_at":"2026-03-07T22:00:00Z","ends_at":"2026-03-08T02:00:00Z"}`, http.StatusUnprocessableEntity},
+		{`{"starts_at":"2026-03-08T02:00:00Z","ends_at":"2026-03-07T22:00:00Z"}`, http.StatusUnprocessableEntity},
+		{`{"ends_at":"2026-03-08T02:00:00Z"}`, http.StatusUnprocessableEntity},
+		{`{"starts_at":"tomorrow"}`, http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		if res := do(t, routes, http.MethodPost, "/v1/maintenance-windows", tt.body, "X-User", "ana"); res.status != tt.status {
+			t.Errorf("POST %s: status = %d; want %d; body = %v", tt.body, res.status, tt.status, res.body)
+		}
+	}
+
+	list := func(url string) []data.MaintenanceWindow {
+		t.Helper()
+		res := do(t, routes, http.MethodGet, url, "")
+		if res.status != http.StatusOK {
+			t.Fatalf("GET %s: status = %d; body = %v", url, res.status, res.body)
+		}
+		var windows []data.MaintenanceWindow
+		res.decode(t, "maintenance_windows", &windows)
+		return windows
+	}
+	if got := list("/v1/maintenance-windows"); len(got) != 2 || got[0].CreatedBy != "ana" {
+		t.Errorf("all windows = %+v; want 2 created by ana", got)
+	}
+	if got := list("/v1/maintenance-windows?site=BOS-Main-OPS"); len(got) != 1 || got[0].ID != 2 {
+		t.Errorf("windows for BOS-Main-OPS = %+v; want only the global window", got)
+	}
+	if got := list("/v1/maintenance-windows?from=2026-03-08&to=2026-03-31"); len(got) != 1 || got[0].ID != 1 {
+		t.Errorf("windows from 8 March = %+v; want window 1", got)
+	}
+
+	// Anyone may list windows, but scheduling or removing one takes an identity.
+	if res := do(t, routes, http.MethodPost, "/v1/maintenance-windows", tests[0].body); res.status != http.StatusUnauthorized {
+		t.Errorf("anonymous create: status = %d; want 401", res.status)
+	}
+	if res := do(t, routes, http.MethodDelete, "/v1/maintenance-windows/1", ""); res.status != http.StatusUnauthorized {
+		t.Errorf("anonymous delete: status = %d; want 401", res.status)
+	}
+
+	if res := do(t, routes, http.MethodDelete, "/v1/maintenance-windows/1", "", "X-User", "ana"); res.status != http.StatusOK {
+		t.Errorf("delete: status = %d", res.status)
+	}
+	if res := do(t, routes, http.MethodDelete, "/v1/maintenance-windows/1", "", "X-User", "ana"); res.status != http.StatusNotFound {
+		t.Errorf("second delete: status = %d; want %d", res.status, http.StatusNotFound)
+	}
+}
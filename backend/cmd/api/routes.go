@@ -15,12 +15,78 @@ func (app *application) routes() http.Handler {
 
 	router.HandlerFunc(http.MethodGet, "/v1/healthcheck", app.healthcheckHandler)
 
+	// API description and viewer
+	router.HandlerFunc(http.MethodGet, "/v1/openapi.json", app.openAPIHandler)
+	router.HandlerFunc(http.MethodGet, "/v1/docs", app.docsHandler)
+
 	// Endpoints for cameras
 	router.HandlerFunc(http.MethodGet, "/v1/cameras", app.listCamerasHandler)
 	router.HandlerFunc(http.MethodPost, "/v1/cameras", app.createCameraHandler)
 	router.HandlerFunc(http.MethodGet, "/v1/cameras/:id", app.showCameraHandler)
 	router.HandlerFunc(http.MethodPatch, "/v1/cameras/:id", app.updateCameraHandler)
+	router.HandlerFunc(http.MethodPut, "/v1/cameras/:id", app.replaceCameraHandler)
 	router.HandlerFunc(http.MethodDelete, "/v1/cameras/:id", app.deleteCameraHandler)
 
-	return app.recoverPanic(router)
+	// Typeahead for the search box
+	router.HandlerFunc(http.MethodGet, "/v1/search/suggest", app.suggestHandler)
+	router.HandlerFunc(http.MethodGet, "/v1/stats/cameras", app.cameraStatsHandler)
+
+	// Saved camera listings
+	router.HandlerFunc(http.MethodGet, "/v1/views", app.requireUser(app.listViewsHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/views", app.requireUser(app.createViewHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/views/:id", app.requireUser(app.showViewHandler))
+	router.HandlerFunc(http.MethodPatch, "/v1/views/:id", app.requireUser(app.updateViewHandler))
+	router.HandlerFunc(http.MethodDelete, "/v1/views/:id", app.requireUser(app.deleteViewHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/views/:id/cameras", app.requireUser(app.viewCamerasHandler))
+
+	// Uptime reporting
+	router.HandlerFunc(http.MethodGet, "/v1/reports/availability", app.availabilityReportHandler)
+	router.HandlerFunc(http.MethodGet, "/v1/maintenance-windows", app.listMaintenanceWindowsHandler)
+	router.HandlerFunc(http.MethodPost, "/v1/maintenance-windows", app.requireUser(app.createMaintenanceWindowHandler))
+	router.HandlerFunc(http.MethodDelete, "/v1/maintenance-windows/:id", app.requireUser(app.deleteMaintenanceWindowHandler))
+
+	// Camera outages
+	router.HandlerFunc(http.MethodGet, "/v1/incidents", app.listIncidentsHandler)
+	router.HandlerFunc(http.MethodGet, "/v1/incidents/:id", app.showIncidentHandler)
+	router.HandlerFunc(http.MethodPatch, "/v1/incidents/:id", app.requireUser(app.updateIncidentHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/incidents/:id/notes", app.requireUser(app.createIncidentNoteHandler))
+
+	// Outbound webhooks
+	router.HandlerFunc(http.MethodGet, "/v1/webhooks", app.requireUser(app.listWebhooksHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/webhooks", app.requireUser(app.createWebhookHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/webhooks/:id", app.requireUser(app.showWebhookHandler))
+	router.HandlerFunc(http.MethodPatch, "/v1/webhooks/:id", app.requireUser(app.updateWebhookHandler))
+	router.HandlerFunc(http.MethodDelete, "/v1/webhooks/:id", app.requireUser(app.deleteWebhookHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/webhooks/:id/ping", app.requireUser(app.pingWebhookHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/webhook-deliveries", app.requireUser(app.listWebhookDeliveriesHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/webhook-deliveries/:id", app.requireUser(app.showWebhookDeliveryHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/webhook-deliveries/:id/redeliver", app.requireUser(app.redeliverWebhookHandler))
+
+	// Firmware inventory and compliance
+	router.HandlerFunc(http.MethodGet, "/v1/cameras/:id/firmware", app.showCameraFirmwareHandler)
+	router.HandlerFunc(http.MethodGet, "/v1/firmware-catalog", app.listFirmwareCatalogHandler)
+	router.HandlerFunc(http.MethodPost, "/v1/firmware-catalog", app.requireUser(app.createFirmwareCatalogEntryHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/firmware-catalog/:id", app.showFirmwareCatalogEntryHandler)
+	router.HandlerFunc(http.MethodPatch, "/v1/firmware-catalog/:id", app.requireUser(app.updateFirmwareCatalogEntryHandler))
+	router.HandlerFunc(http.MethodDelete, "/v1/firmware-catalog/:id", app.requireUser(app.deleteFirmwareCatalogEntryHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/reports/firmware-compliance", app.firmwareComplianceReportHandler)
+
+	// Firmware upgrade campaigns
+	router.HandlerFunc(http.MethodGet, "/v1/firmware-images", app.requireUser(app.listFirmwareImagesHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/firmware-images", app.requireUser(app.uploadFirmwareImageHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/firmware-images/:id", app.requireUser(app.showFirmwareImageHandler))
+	router.HandlerFunc(http.MethodDelete, "/v1/firmware-images/:id", app.requireUser(app.deleteFirmwareImageHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/upgrade-campaigns", app.requireUser(app.listUpgradeCampaignsHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/upgrade-campaigns", app.requireUser(app.createUpgradeCampaignHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/upgrade-campaigns/:id", app.requireUser(app.showUpgradeCampaignHandler))
+	router.HandlerFunc(http.MethodPatch, "/v1/upgrade-campaigns/:id", app.requireUser(app.updateUpgradeCampaignHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/upgrade-campaigns/:id/targets", app.requireUser(app.listUpgradeTargetsHandler))
+
+	// Live camera events
+	router.HandlerFunc(http.MethodGet, "/v1/events/stream", app.streamEventsHandler)
+
+	// Mixed operations in one transaction
+	router.HandlerFunc(http.MethodPost, "/v1/batch", app.batchHandler)
+
+	return app.recoverPanic(app.identify(app.idempotency(router)))
 }
@@ -0,0 +1,34 @@
+package main
+
+import (
+	"net/http"
+
+	"github.com/chefgoldbloom/pnctool/backend/internal/data"
+	"github.com/chefgoldbloom/pnctool/backend/internal/validator"
+)
+
+// suggestHandler returns typeahead suggestions for the "GET /v1/search/suggest"
+// endpoint: camera names, sites and models matching what has been typed so far.
+func (app *application) suggestHandler(w http.ResponseWriter, r *http.Request) {
+	v := validator.New()
+	qs := r.URL.Query()
+
+	prefix := app.readString(qs, "q", "")
+	limit := app.readInt(qs, "limit", 10, v)
+
+	if data.ValidateSuggest(v, prefix, limit); !v.Valid() {
+		app.failedValidationResponse(w, r, v)
+		return
+	}
+
+	suggestions, err := app.models.Cameras.Suggest(prefix, limit)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"suggestions": suggestions}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
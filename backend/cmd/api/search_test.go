@@ -0,0 +1,116 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"testing"
+
+	"github.com/chefgoldbloom/pnctool/backend/internal/data"
+)
+
+func TestSearchCameras(t *testing.T) {
+	routes := newTestApplication(t).routes()
+
+	for _, body := range []string{
+		`{"name":"Lobby East","mac_address":"ACCC8E000001","site_name":"NYC-5th-OPS","model_no":"P3245"}`,
+		`{"name":"Loading Dock","mac_address":"ACCC8E00AB12","site_name":"NYC-5th-OPS","model_no":"M1065"}`,
+		`{"name":"Gate","mac_address":"ACCC8E000003","site_name":"Lobbyton-Main-GLH","model_no":"P3245"}`,
+	} {
+		createCamera(t, routes, body)
+	}
+
+	tests := []struct {
+		name   string
+		search string
+		sort   string
+		status int
+		names  []string
+	}{
+		{"words", "lobby east", "", http.StatusOK, []string{"Lobby East"}},
+		{"abbreviated", "lob-e", "", http.StatusOK, []string{"Lobby East"}},
+		{"ranked", "lobby", "", http.StatusOK, []string{"Lobby East", "Gate"}},
+		{"other sort", "lobby", "-id", http.StatusOK, []string{"Gate", "Lobby East"}},
+		{"partial mac", "8e00ab", "", http.StatusOK, []string{"Loading Dock"}},
+		{"no match", "parking", "", http.StatusOK, []string{}},
+		{"no terms", "--", "", http.StatusUnprocessableEntity, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			qs := url.Values{"search": {tt.search}}
+			if tt.sort != "" {
+				qs.Set("sort", tt.sort)
+			}
+			res := do(t, routes, http.MethodGet, "/v1/cameras?"+qs.Encode(), "")
+			if res.status != tt.status {
+				t.Fatalf("status = %d; want %d; body = %v", res.status, tt.status, res.body)
+			}
+			if tt.status != http.StatusOK {
+				return
+			}
+
+			var cameras []data.Camera
+			res.decode(t, "cameras", &cameras)
+			names := []string{}
+			for _, c := range cameras {
+				names = append(names, c.Name)
+				if c.Search == nil || c.Search.Score <= 0 {
+					t.Errorf("%s: search = %+v", c.Name, c.Search)
+				}
+			}
+			if fmt.Sprint(names) != fmt.Sprint(tt.names) {
+				t.Errorf("names = %v; want %v", names, tt.names)
+			}
+		})
+	}
+
+	res := do(t, routes, http.MethodGet, "/v1/cameras?search=lobby&fields=name", "")
+	var cameras []data.Camera
+	res.decode(t, "cameras", &cameras)
+	if len(cameras) == 0 || cameras[0].Search == nil || cameras[0].Search.Highlight["name"] != "<mark>Lobby</mark> East" {
+		t.Errorf("highlight = %+v", cameras)
+	}
+
+	if res := do(t, routes, http.MethodGet, "/v1/cameras?sort=relevance", ""); res.status != http.StatusUnprocessableEntity {
+		t.Errorf("relevance without search: status = %d; want %d", res.status, http.StatusUnprocessableEntity)
+	}
+}
+
+func TestSuggest(t *testing.T) {
+	routes := newTestApplication(t).routes()
+	createCamera(t, routes, `{"name":"Lobby East","mac_address":"ACCC8E000001","site_name":"NYC-5th-OPS","model_no":"P3245"}`)
+	createCamera(t, routes, `{"name":"Dock","mac_address":"ACCC8E000002","site_name":"Lobbyton-Main-GLH","model_no":"P3245"}`)
+
+	tests := []struct {
+		url    string
+		status int
+		want   []data.Suggestion
+	}{
+		{"/v1/search/suggest?q=lob", http.StatusOK, []data.Suggestion{
+			{Text: "Lobby East", Kind: "name", Cameras: 1},
+			{Text: "Lobbyton-Main-GLH", Kind: "site", Cameras: 1},
+		}},
+		{"/v1/search/suggest?q=p32&limit=1", http.StatusOK, []data.Suggestion{{Text: "P3245", Kind: "model", Cameras: 2}}},
+		{"/v1/search/suggest?q=zzz", http.StatusOK, []data.Suggestion{}},
+		{"/v1/search/suggest", http.StatusUnprocessableEntity, nil},
+		{"/v1/search/suggest?q=lob&limit=26", http.StatusUnprocessableEntity, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.url, func(t *testing.T) {
+			res := do(t, routes, http.MethodGet, tt.url, "")
+			if res.status != tt.status {
+				t.Fatalf("status = %d; want %d; body = %v", res.status, tt.status, res.body)
+			}
+			if tt.status != http.StatusOK {
+				return
+			}
+			var got []data.Suggestion
+			res.decode(t, "suggestions", &got)
+			if fmt.Sprint(got) != fmt.Sprint(tt.want) {
+				t.Errorf("suggestions = %v; want %v", got, tt.want)
+			}
+		})
+	}
+}
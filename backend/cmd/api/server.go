@@ -0,0 +1,113 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+)
+
+// serve runs the HTTP server and the background workers until the process receives
+// SIGINT or SIGTERM. In-flight requests are given up to 30 seconds to complete, and
+// the workers are stopped and waited for, before serve returns.
+func (app *application) serve() error {
+	srv := &http.Server{
+		Addr:         fmt.Sprintf(":%d", app.cfg.port),
+		Handler:      app.routes(),
+		IdleTimeout:  time.Minute,
+		ReadTimeout:  5 * time.Second,
+		WriteTimeout: 10 * time.Second,
+		ErrorLog:     slog.NewLogLogger(app.logger.Handler(), slog.LevelError),
+	}
+
+	// Event streams never finish on their own, so end them when shutdown begins
+	// rather than leaving Shutdown waiting on them.
+	srv.RegisterOnShutdown(app.stream.Close)
+
+	// The workers run until ctx is cancelled on shutdown.
+	ctx, stopWorkers := context.WithCancel(context.Background())
+	defer stopWorkers()
+	app.startWorkers(ctx)
+
+	shutdownError := make(chan error)
+
+	go func() {
+		quit := make(chan os.Signal, 1)
+		signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
+		s := <-quit
+
+		app.logger.Info("shutting down server", "signal", s.String())
+
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancel()
+
+		err := srv.Shutdown(shutdownCtx)
+
+		// Stop the workers whether or not the server shut down cleanly, and wait for
+		// them so nothing is writing to the database when main closes it.
+		app.logger.Info("stopping background workers")
+		stopWorkers()
+		app.wg.Wait()
+
+		shutdownError <- err
+	}()
+
+	app.logger.Info("starting server", "addr", srv.Addr, "env", app.cfg.env)
+
+	err := srv.ListenAndServe()
+	if !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+
+	err = <-shutdownError
+	if err != nil {
+		return err
+	}
+
+	app.logger.Info("stopped server", "addr", srv.Addr)
+	return nil
+}
+
+// startWorkers starts the background workers, which stop when ctx is cancelled.
+func (app *application) startWorkers(ctx context.Context) {
+	if app.poller != nil {
+		app.wg.Add(1)
+		go func() {
+			defer app.wg.Done()
+			app.poller.Run(ctx)
+		}()
+	}
+	if app.collector != nil {
+		app.wg.Add(1)
+		go func() {
+			defer app.wg.Done()
+			app.collector.Run(ctx)
+		}()
+	}
+	if app.webhooks != nil {
+		app.wg.Add(1)
+		go func() {
+			defer app.wg.Done()
+			app.webhooks.Run(ctx)
+		}()
+	}
+	if app.upgrades != nil {
+		app.wg.Add(1)
+		go func() {
+			defer app.wg.Done()
+			app.upgrades.Run(ctx)
+		}()
+	}
+	if app.listener != nil {
+		app.wg.Add(1)
+		go func() {
+			defer app.wg.Done()
+			app.listener.Run(ctx)
+		}()
+	}
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/chefgoldbloom/pnctool/backend/internal/data"
+	"github.com/chefgoldbloom/pnctool/backend/internal/query"
+	"github.com/chefgoldbloom/pnctool/backend/internal/validator"
+)
+
+// cameraStatsHandler counts cameras for the "GET /v1/stats/cameras" endpoint. With
+// group_by it counts cameras per group, optionally only the top N; with interval=week
+// it counts cameras added per week between from and to, the last 12 weeks by default.
+// Both take the same filters as the camera listing.
+func (app *application) cameraStatsHandler(w http.ResponseWriter, r *http.Request) {
+	v := validator.New()
+	qs := r.URL.Query()
+
+	filter, err := app.readCameraFilter(qs, v)
+	groupBy := app.readString(qs, "group_by", "")
+	interval := app.readString(qs, "interval", "")
+	top := app.readInt(qs, "top", 0, v)
+	to := app.readDate(qs, "to", time.Now().UTC(), v)
+	from := app.readDate(qs, "from", to.AddDate(0, 0, -7*11), v)
+
+	switch interval {
+	case "":
+		data.ValidateGroupStats(v, groupBy, top)
+	case "week":
+		v.CheckCode(groupBy == "", "group_by", validator.CodeNotPermitted, "cannot be combined with interval")
+		data.ValidateTimeSeries(v, from, to)
+	default:
+		v.AddErrorCode("interval", validator.CodeNotPermitted, "must be week")
+	}
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v)
+		return
+	}
+	var qerr *query.Error
+	if errors.As(err, &qerr) {
+		app.invalidQueryResponse(w, r, qerr)
+		return
+	}
+
+	var stats any
+	if interval == "week" {
+		stats, err = app.models.Cameras.CountAddedByWeek(filter, from, to)
+	} else {
+		stats, err = app.models.Cameras.CountBy(filter, groupBy, top)
+	}
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"stats": stats}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/chefgoldbloom/pnctool/backend/internal/data"
+)
+
+func TestCameraStats(t *testing.T) {
+	routes := newTestApplication(t).routes()
+
+	for _, body := range []string{
+		`{"name":"Lobby","mac_address":"ACCC8E000001","site_name":"NYC-5th-GLH","model_no":"P3245"}`,
+		`{"name":"Dock","mac_address":"ACCC8E000002","site_name":"NYC-5th-GLH","model_no":"P3265"}`,
+		`{"name":"Gate","mac_address":"ACCC8E000003","site_name":"BOS-Main-OPS","model_no":"P3245"}`,
+	} {
+		createCamera(t, routes, body)
+	}
+
+	tests := []struct {
+		url    string
+		status int
+		groups string
+		other  string
+	}{
+		{"/v1/stats/cameras?group_by=site_name", http.StatusOK, "[{NYC-5th-GLH 2 66.67} {BOS-Main-OPS 1 33.33}]", "<nil>"},
+		{"/v1/stats/cameras?group_by=office_type&model_no=p3245", http.StatusOK, "[{GLH 1 50} {OPS 1 50}]", "<nil>"},
+		{"/v1/stats/cameras?group_by=model_no&top=1", http.StatusOK, "[{P3245 2 66.67}]", "&{1 1 33.33}"},
+		{"/v1/stats/cameras?group_by=status&q=site_name:NYC-*", http.StatusOK, "[{unknown 2 100}]", "<nil>"},
+		{"/v1/stats/cameras?group_by=vendor&search=parking", http.StatusOK, "[]", "<nil>"},
+		{"/v1/stats/cameras", http.StatusUnprocessableEntity, "", ""},
+		{"/v1/stats/cameras?group_by=serial", http.StatusUnprocessableEntity, "", ""},
+		{"/v1/stats/cameras?group_by=site_name&top=-1", http.StatusUnprocessableEntity, "", ""},
+		{"/v1/stats/cameras?group_by=site_name&q=serial:1", http.StatusUnprocessableEntity, "", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.url, func(t *testing.T) {
+			res := do(t, routes, http.MethodGet, tt.url, "")
+			if res.status != tt.status {
+				t.Fatalf("status = %d; want %d; body = %v", res.status, tt.status, res.body)
+			}
+			if tt.status != http.StatusOK {
+				return
+			}
+			var stats data.GroupStats
+			res.decode(t, "stats", &stats)
+			if fmt.Sprint(stats.Groups) != tt.groups || fmt.Sprint(stats.Other) != tt.other {
+				t.Errorf("stats = %v %v; want %s %s", stats.Groups, stats.Other, tt.groups, tt.other)
+			}
+		})
+	}
+}
+
+func TestCameraStatsTimeSeries(t *testing.T) {
+	routes := newTestApplication(t).routes()
+	createCamera(t, routes, validCameraJSON)
+
+	res := do(t, routes, http.MethodGet, "/v1/stats/cameras?interval=week", "")
+	if res.status != http.StatusOK {
+		t.Fatalf("status = %d; body = %v", res.status, res.body)
+	}
+	var series data.TimeSeries
+	res.decode(t, "stats", &series)
+	if len(series.Series) != 12 {
+		t.Fatalf("series has %d weeks; want 12", len(series.Series))
+	}
+	last := series.Series[11]
+	if last.Week.Weekday() != time.Monday || last.Added != 1 || last.Total != 1 || series.Series[0].Total != 0 {
+		t.Errorf("series = %+v", series.Series)
+	}
+
+	tests := []struct {
+		url    string
+		status int
+		weeks  int
+	}{
+		{"/v1/stats/cameras?interval=week&from=2026-01-01&to=2026-01-31", http.StatusOK, 5},
+		{"/v1/stats/cameras?interval=week&from=2026-01-05&to=2026-01-05", http.StatusOK, 1},
+		{"/v1/stats/cameras?interval=week&from=2026-02-01&to=2026-01-01", http.StatusUnprocessableEntity, 0},
+		{"/v1/stats/cameras?interval=week&from=2000-01-01&to=2026-01-01", http.StatusUnprocessableEntity, 0},
+		{"/v1/stats/cameras?interval=week&from=01/01/2026", http.StatusUnprocessableEntity, 0},
+		{"/v1/stats/cameras?interval=week&group_by=site_name", http.StatusUnprocessableEntity, 0},
+		{"/v1/stats/cameras?interval=day", http.StatusUnprocessableEntity, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.url, func(t *testing.T) {
+			res := do(t, routes, http.MethodGet, tt.url, "")
+			if res.status != tt.status {
+				t.Fatalf("status = %d; want %d; body = %v", res.status, tt.status, res.body)
+			}
+			if tt.status != http.StatusOK {
+				return
+			}
+			var series data.TimeSeries
+			res.decode(t, "stats", &series)
+			if len(series.Series) != tt.weeks {
+				t.Errorf("series has %d weeks; want %d", len(series.Series), tt.weeks)
+			}
+		})
+	}
+}
@@ -0,0 +1,188 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/chefgoldbloom/pnctool/backend/internal/data"
+	"github.com/chefgoldbloom/pnctool/backend/internal/events"
+	"github.com/chefgoldbloom/pnctool/backend/internal/validator"
+)
+
+const (
+	// streamBuffer is how many live events a stream can fall behind by before it's
+	// dropped from the hub and has to catch up from the event log.
+	streamBuffer = 64
+	// streamPage is how many events are read from the log at a time when catching up.
+	streamPage = 100
+	// streamWriteTimeout replaces the server's WriteTimeout for each write to a
+	// stream, which would otherwise end it ten seconds after it started.
+	streamWriteTimeout = 10 * time.Second
+	// streamRetry is how long clients are told to wait before reconnecting.
+	streamRetry = 3 * time.Second
+)
+
+// streamEventsHandler for the "GET /v1/events/stream" endpoint sends camera events as
+// Server-Sent Events, each with the event's ID, its type as the event name, and the
+// event as JSON data. Events can be filtered by site and type (a comma-separated
+// list).
+//
+// A client which reconnects with the Last-Event-ID header, or the last_event_id
+// parameter, first gets the events it missed from the event log. Idle streams get a
+// comment every -stream-keepalive so that proxies don't close them.
+func (app *application) streamEventsHandler(w http.ResponseWriter, r *http.Request) {
+	v := validator.New()
+	qs := r.URL.Query()
+
+	var filter data.EventFilter
+	filter.SiteName = app.readString(qs, "site", "")
+	filter.Types = app.readCSV(qs, "type", data.EventTypeSafelist)
+	lastID := int64(app.readInt(qs, "last_event_id", 0, v))
+
+	if header := r.Header.Get("Last-Event-ID"); header != "" {
+		id, err := strconv.ParseInt(header, 10, 64)
+		if err != nil || id < 0 {
+			app.badRequestResponse(w, r, errors.New("Last-Event-ID header must be an event ID"))
+			return
+		}
+		lastID = id
+	}
+
+	for _, eventType := range filter.Types {
+		v.CheckCode(validator.PermittedValue(eventType, data.EventTypeSafelist...), "type", validator.CodeNotPermitted, "must be one of: "+strings.Join(data.EventTypeSafelist, ", "))
+	}
+	v.CheckCode(lastID >= 0, "last_event_id", validator.CodeOutOfRange, "must not be negative")
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v)
+		return
+	}
+
+	s := &eventStream{
+		w:      w,
+		rc:     http.NewResponseController(w),
+		filter: filter,
+		lastID: lastID,
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	if err := s.write(fmt.Sprintf("retry: %d\n\n", streamRetry.Milliseconds())); err != nil {
+		return
+	}
+
+	keepAlive := time.NewTicker(app.cfg.stream.keepAlive)
+	defer keepAlive.Stop()
+
+	// Subscribe before catching up, so nothing is missed in between, and skip the
+	// live events which were already sent from the log. A stream which falls behind
+	// goes back to the log.
+	for {
+		sub := app.stream.Subscribe(streamBuffer)
+		err := s.catchUp(app.models.Events)
+		if err != nil {
+			sub.Close()
+			app.logError(r, err)
+			return
+		}
+		if s.err != nil {
+			sub.Close()
+			return
+		}
+
+		lagged := s.follow(r, sub, s.lastID, keepAlive.C)
+		sub.Close()
+		if !lagged {
+			return
+		}
+	}
+}
+
+// eventStream is an open event stream and the last event sent on it.
+type eventStream struct {
+	w      http.ResponseWriter
+	rc     *http.ResponseController
+	filter data.EventFilter
+	lastID int64
+	err    error // the first write which failed, after which the stream is done
+}
+
+// catchUp sends the events in the log after the last one sent. It returns an error
+// if the log couldn't be read; a failed write is left in s.err.
+func (s *eventStream) catchUp(log data.EventRepository) error {
+	for {
+		events, err := log.After(s.lastID, s.filter, streamPage)
+		if err != nil {
+			return err
+		}
+		for _, event := range events {
+			if s.send(event) != nil {
+				return nil
+			}
+		}
+		if len(events) < streamPage {
+			return nil
+		}
+	}
+}
+
+// follow sends live events with IDs after caughtUp until the client goes away, a
+// write fails or the subscription ends. It reports whether the subscription ended
+// because the stream fell behind, rather than because the server is shutting down.
+func (s *eventStream) follow(r *http.Request, sub *events.Subscription, caughtUp int64, keepAlive <-chan time.Time) bool {
+	for {
+		select {
+		case event, ok := <-sub.C:
+			if !ok {
+				return sub.Lagged()
+			}
+			if event.ID <= caughtUp || !s.filter.Matches(event) {
+				continue
+			}
+			if s.send(event) != nil {
+				return false
+			}
+		case <-keepAlive:
+			if s.write(": keep-alive\n\n") != nil {
+				return false
+			}
+		case <-r.Context().Done():
+			return false
+		}
+	}
+}
+
+// send writes the event and records it as the last one sent.
+func (s *eventStream) send(event *data.Event) error {
+	js, err := json.Marshal(event)
+	if err != nil {
+		s.err = err
+		return err
+	}
+	if err := s.write(fmt.Sprintf("id: %d\nevent: %s\ndata: %s\n\n", event.ID, event.Type, js)); err != nil {
+		return err
+	}
+	s.lastID = max(s.lastID, event.ID)
+	return nil
+}
+
+// write sends msg to the client straight away, giving it streamWriteTimeout.
+func (s *eventStream) write(msg string) error {
+	err := s.rc.SetWriteDeadline(time.Now().Add(streamWriteTimeout))
+	if err == nil || errors.Is(err, http.ErrNotSupported) {
+		_, err = s.w.Write([]byte(msg))
+	}
+	if err == nil {
+		err = s.rc.Flush()
+	}
+	if err != nil && s.err == nil {
+		s.err = err
+	}
+	return err
+}
@@ -0,0 +1,207 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/chefgoldbloom/pnctool/backend/internal/data"
+)
+
+// sseMessage is one message read from an event stream.
+type sseMessage struct {
+	id, event, data, retry, comment string
+}
+
+// readMessage reads the next message from an event stream, comments included.
+func readMessage(t *testing.T, r *bufio.Reader) sseMessage {
+	t.Helper()
+
+	var msg sseMessage
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			t.Fatalf("reading event stream: %v", err)
+		}
+		line = strings.TrimSuffix(line, "\n")
+		if line == "" {
+			return msg
+		}
+		if comment, ok := strings.CutPrefix(line, ":"); ok {
+			msg.comment = strings.TrimSpace(comment)
+			continue
+		}
+		field, value, _ := strings.Cut(line, ": ")
+		switch field {
+		case "id":
+			msg.id = value
+		case "event":
+			msg.event = value
+		case "data":
+			msg.data = value
+		case "retry":
+			msg.retry = value
+		}
+	}
+}
+
+// nextEvent reads the next event from an event stream, skipping anything else.
+func nextEvent(t *testing.T, r *bufio.Reader) (sseMessage, data.Event) {
+	t.Helper()
+
+	for {
+		msg := readMessage(t, r)
+		if msg.event == "" {
+			continue
+		}
+		var event data.Event
+		if err := json.Unmarshal([]byte(msg.data), &event); err != nil {
+			t.Fatalf("event data %q: %v", msg.data, err)
+		}
+		return msg, event
+	}
+}
+
+// openStream connects to the event stream on srv and returns a reader for it, past
+// the initial retry message.
+func openStream(t *testing.T, srv *httptest.Server, query string, headers ...string) *bufio.Reader {
+	t.Helper()
+
+	req, err := http.NewRequest(http.MethodGet, srv.URL+"/v1/events/stream"+query, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i+1 < len(headers); i += 2 {
+		req.Header.Set(headers[i], headers[i+1])
+	}
+	client := &http.Client{Timeout: 5 * time.Second}
+	res, err := client.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { res.Body.Close() })
+
+	if res.StatusCode != http.StatusOK || res.Header.Get("Content-Type") != "text/event-stream" {
+		t.Fatalf("status = %d; content type = %q", res.StatusCode, res.Header.Get("Content-Type"))
+	}
+	r := bufio.NewReader(res.Body)
+	if msg := readMessage(t, r); msg.retry != "3000" {
+		t.Fatalf("first message = %+v; want the retry interval", msg)
+	}
+	return r
+}
+
+func TestEventStream(t *testing.T) {
+	app := newTestApplication(t)
+	routes := app.routes()
+
+	// Streams outlive the server's WriteTimeout.
+	srv := httptest.NewUnstartedServer(routes)
+	srv.Config.WriteTimeout = 100 * time.Millisecond
+	srv.Start()
+	t.Cleanup(srv.Close)
+
+	nyc := createCamera(t, routes, validCameraJSON)
+	createCamera(t, routes, `{"name":"bos-lobby","mac_address":"ACCC8E000002","site_name":"BOS-Main-GLH"}`)
+	do(t, routes, http.MethodPatch, fmt.Sprintf("/v1/cameras/%d", nyc.ID), `{"name":"lobby-west"}`)
+
+	t.Run("catch up and follow", func(t *testing.T) {
+		r := openStream(t, srv, "?site=nyc-5th-ops")
+
+		msg, event := nextEvent(t, r)
+		if msg.id != "1" || msg.event != data.EventCameraCreated || event.ID != 1 || event.CameraID != nyc.ID || event.SiteName != "NYC-5th-OPS" {
+			t.Errorf("first event = %+v, %+v; want camera %d created", msg, event, nyc.ID)
+		}
+		var camera data.Camera
+		if err := json.Unmarshal(event.Data, &camera); err != nil || camera.Name != "lobby-east" {
+			t.Errorf("first event data = %s; want the camera", event.Data)
+		}
+		if msg, _ := nextEvent(t, r); msg.id != "3" || msg.event != data.EventCameraUpdated {
+			t.Errorf("second event = %+v; want 3, camera.updated", msg)
+		}
+
+		time.Sleep(3 * srv.Config.WriteTimeout)
+		do(t, routes, http.MethodDelete, fmt.Sprintf("/v1/cameras/%d", nyc.ID), "")
+		if msg, _ := nextEvent(t, r); msg.id != "4" || msg.event != data.EventCameraDeleted {
+			t.Errorf("live event = %+v; want 4, camera.deleted", msg)
+		}
+	})
+
+	t.Run("resume", func(t *testing.T) {
+		r := openStream(t, srv, "?type=camera.created,camera.deleted", "Last-Event-ID", "1")
+		if msg, _ := nextEvent(t, r); msg.id != "2" || msg.event != data.EventCameraCreated {
+			t.Errorf("first event = %+v; want 2, camera.created", msg)
+		}
+		if msg, _ := nextEvent(t, r); msg.id != "4" || msg.event != data.EventCameraDeleted {
+			t.Errorf("second event = %+v; want 4, camera.deleted", msg)
+		}
+
+		// The header wins over the parameter.
+		r = openStream(t, srv, "?last_event_id=1", "Last-Event-ID", "3")
+		if msg, _ := nextEvent(t, r); msg.id != "4" {
+			t.Errorf("first event = %+v; want 4", msg)
+		}
+	})
+
+	t.Run("pings", func(t *testing.T) {
+		r := openStream(t, srv, "?last_event_id=4")
+		ping := &data.Event{Type: data.EventWebhookPing, OccurredAt: time.Now()}
+		if err := app.models.Events.Insert(ping); err != nil {
+			t.Fatal(err)
+		}
+		createCamera(t, routes, `{"name":"new","mac_address":"ACCC8E000003","site_name":"NYC-5th-OPS"}`)
+		if msg, _ := nextEvent(t, r); msg.id != "6" || msg.event != data.EventCameraCreated {
+			t.Errorf("event = %+v; want 6, skipping the webhook ping", msg)
+		}
+	})
+
+	t.Run("invalid", func(t *testing.T) {
+		tests := []struct {
+			name, url, lastEventID string
+			status                 int
+		}{
+			{"type", "/v1/events/stream?type=camera.offline,webhook.ping", "", http.StatusUnprocessableEntity},
+			{"last_event_id", "/v1/events/stream?last_event_id=-1", "", http.StatusUnprocessableEntity},
+			{"Last-Event-ID", "/v1/events/stream", "abc", http.StatusBadRequest},
+		}
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				if res := do(t, routes, http.MethodGet, tt.url, "", "Last-Event-ID", tt.lastEventID); res.status != tt.status {
+					t.Errorf("status = %d; want %d; body = %v", res.status, tt.status, res.body)
+				}
+			})
+		}
+	})
+
+	t.Run("shutdown", func(t *testing.T) {
+		r := openStream(t, srv, "")
+		app.stream.Close()
+		for {
+			if _, err := r.ReadString('\n'); err != nil {
+				if !errors.Is(err, io.EOF) {
+					t.Errorf("stream ended with %v; want EOF", err)
+				}
+				return
+			}
+		}
+	})
+}
+
+func TestEventStreamKeepAlive(t *testing.T) {
+	app := newTestApplication(t)
+	app.cfg.stream.keepAlive = 20 * time.Millisecond
+	srv := httptest.NewServer(app.routes())
+	t.Cleanup(srv.Close)
+
+	r := openStream(t, srv, "")
+	if msg := readMessage(t, r); msg.comment != "keep-alive" {
+		t.Errorf("message on an idle stream = %+v; want a keep-alive comment", msg)
+	}
+}
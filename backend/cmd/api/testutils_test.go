@@ -0,0 +1,167 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/chefgoldbloom/pnctool/backend/internal/artifact"
+	"github.com/chefgoldbloom/pnctool/backend/internal/data"
+	"github.com/chefgoldbloom/pnctool/backend/internal/events"
+	"github.com/chefgoldbloom/pnctool/backend/internal/webhook"
+)
+
+const validCameraJSON = `{"name":"lobby-east","mac_address":"ACCC8E000001","site_name":"NYC-5th-OPS","model_no":"P3245"}`
+
+// newTestApplication returns an application backed by in-memory models, so handler
+// tests run without a database.
+func newTestApplication(t *testing.T) *application {
+	t.Helper()
+
+	cfg := config{env: "testing"}
+	cfg.idempotency.ttl = time.Hour
+	cfg.idempotency.lease = time.Minute
+	cfg.stream.keepAlive = time.Minute
+	cfg.upgrades.maxImageSize = 1 << 20
+	cfg.upgrades.uploadTimeout = time.Minute
+
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	models := data.NewMemoryModels()
+
+	// Deliveries are queued as in production, but only made when a test calls
+	// Dispatch.
+	bus := events.NewBus(models.Events)
+	dispatcher := webhook.New(models.Webhooks, logger, webhook.Config{Timeout: time.Second})
+	bus.Subscribe(dispatcher.Enqueue)
+
+	// There's no database to announce events, so the hub hears them from the bus.
+	hub := events.NewHub()
+	bus.Subscribe(hub.Publish)
+
+	artifacts, err := artifact.NewStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return &application{
+		cfg:       cfg,
+		logger:    logger,
+		models:    models,
+		events:    bus,
+		webhooks:  dispatcher,
+		stream:    hub,
+		artifacts: artifacts,
+	}
+}
+
+// testResponse is a recorded response with its body decoded as a JSON object.
+type testResponse struct {
+	status int
+	header http.Header
+	body   map[string]json.RawMessage
+}
+
+// do sends a request through the application's routes and records the response.
+func do(t *testing.T, h http.Handler, method, url, body string, headers ...string) testResponse {
+	t.Helper()
+
+	r := httptest.NewRequest(method, url, strings.NewReader(body))
+	for i := 0; i+1 < len(headers); i += 2 {
+		r.Header.Set(headers[i], headers[i+1])
+	}
+	rr := httptest.NewRecorder()
+	h.ServeHTTP(rr, r)
+
+	res := testResponse{status: rr.Code, header: rr.Header()}
+	if rr.Body.Len() > 0 && strings.Contains(rr.Header().Get("Content-Type"), "json") {
+		if err := json.Unmarshal(rr.Body.Bytes(), &res.body); err != nil {
+			t.Fatalf("%s %s: response is not a JSON object: %v\n%s", method, url, err, rr.Body)
+		}
+	}
+	return res
+}
+
+// decode unmarshals the named member of the response body into dest.
+func (res testResponse) decode(t *testing.T, member string, dest any) {
+	t.Helper()
+
+	raw, ok := res.body[member]
+	if !ok {
+		t.Fatalf("response has no %q member: %v", member, res.body)
+	}
+	if err := json.Unmarshal(raw, dest); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// createCamera creates a camera through the API and returns it.
+func createCamera(t *testing.T, h http.Handler, body string) data.Camera {
+	t.Helper()
+
+	res := do(t, h, http.MethodPost, "/v1/cameras", body)
+	if res.status != http.StatusCreated {
+		t.Fatalf("create camera: status = %d; body = %v", res.status, res.body)
+	}
+	var camera data.Camera
+	res.decode(t, "camera", &camera)
+	return camera
+}
+
+// seedRecord is something recorded for the camera with the given ID.
+type seedRecord[T any] struct {
+	cameraID int64
+	record   T
+}
+
+// testSeed is the state a handler test starts from. newSeededApplication sets it up
+// in field order.
+type testSeed struct {
+	// cameras are the bodies of requests creating cameras through the API, so the
+	// first camera has ID 1.
+	cameras []string
+	// statuses, firmware and incidents are recorded straight into the models, as
+	// the API has no way to create them. Incidents are opened at the given time
+	// after three failed checks.
+	statuses  []seedRecord[data.CameraStatus]
+	firmware  []seedRecord[data.CameraFirmware]
+	incidents []seedRecord[time.Time]
+	// posts are URLs and request bodies, sent by ana, that must each create something.
+	posts [][2]string
+}
+
+// newSeededApplication returns the routes of a test application set up with seed.
+func newSeededApplication(t *testing.T, seed testSeed) http.Handler {
+	t.Helper()
+
+	app := newTestApplication(t)
+	routes := app.routes()
+	for _, body := range seed.cameras {
+		createCamera(t, routes, body)
+	}
+	for _, s := range seed.statuses {
+		if _, err := app.models.Statuses.Record(s.cameraID, &s.record); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, f := range seed.firmware {
+		if _, err := app.models.Firmware.Record(f.cameraID, &f.record); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, i := range seed.incidents {
+		if _, _, err := app.models.Incidents.Open(i.cameraID, 3, i.record); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, p := range seed.posts {
+		if res := do(t, routes, http.MethodPost, p[0], p[1], "X-User", "ana"); res.status != http.StatusCreated {
+			t.Fatalf("POST %s: status = %d; body = %v", p[0], res.status, res.body)
+		}
+	}
+	return routes
+}
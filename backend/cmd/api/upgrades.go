@@ -0,0 +1,469 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/chefgoldbloom/pnctool/backend/internal/data"
+	"github.com/chefgoldbloom/pnctool/backend/internal/query"
+	"github.com/chefgoldbloom/pnctool/backend/internal/validator"
+)
+
+// listFirmwareImagesHandler for the "GET /v1/firmware-images" endpoint, newest first.
+func (app *application) listFirmwareImagesHandler(w http.ResponseWriter, r *http.Request) {
+	images, err := app.models.FirmwareImages.GetAll()
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"firmware_images": images}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// uploadFirmwareImageHandler for the "POST /v1/firmware-images" endpoint. The request
+// body is the image file itself, and model_no, firmware and filename are given in
+// the query string. Images are far bigger than JSON bodies, so the upload gets its
+// own size limit and longer deadlines than the server's.
+func (app *application) uploadFirmwareImageHandler(w http.ResponseWriter, r *http.Request) {
+	qs := r.URL.Query()
+	image := &data.FirmwareImage{
+		UploadedBy: app.contextGetIdentity(r).User,
+		ModelNo:    app.readString(qs, "model_no", ""),
+		Firmware:   app.readString(qs, "firmware", ""),
+		Filename:   app.readString(qs, "filename", ""),
+	}
+
+	v := validator.New()
+	if data.ValidateFirmwareImage(v, image); !v.Valid() {
+		app.failedValidationResponse(w, r, v)
+		return
+	}
+
+	// Without its own deadlines the upload is cut off by the server's. Test recorders
+	// can't set them, but have no deadlines to begin with, so that's only logged.
+	rc := http.NewResponseController(w)
+	deadline := time.Now().Add(app.cfg.upgrades.uploadTimeout)
+	if err := errors.Join(rc.SetReadDeadline(deadline), rc.SetWriteDeadline(deadline)); err != nil {
+		if !errors.Is(err, http.ErrNotSupported) {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+		app.logError(r, fmt.Errorf("extending the upload's deadlines: %w", err))
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, app.cfg.upgrades.maxImageSize)
+	digest, size, err := app.artifacts.Put(r.Body)
+	if err != nil {
+		var maxBytesError *http.MaxBytesError
+		switch {
+		case errors.As(err, &maxBytesError):
+			app.badRequestResponse(w, r, fmt.Errorf("body must not be larger than %d bytes", maxBytesError.Limit))
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	image.SHA256, image.Size = digest, size
+
+	if size == 0 {
+		app.removeArtifact(digest)
+		v.AddErrorCode("body", validator.CodeRequired, "must contain the firmware image")
+		app.failedValidationResponse(w, r, v)
+		return
+	}
+
+	err = app.models.FirmwareImages.Insert(image)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrDuplicateFirmwareImage):
+			// The file is the one already uploaded, so it stays.
+			v.AddErrorCode("body", validator.CodeDuplicate, "this image has already been uploaded")
+			app.failedValidationResponse(w, r, v)
+		default:
+			app.removeArtifact(digest)
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	headers := make(http.Header)
+	headers.Set("Location", fmt.Sprintf("/v1/firmware-images/%d", image.ID))
+
+	err = app.writeJSON(w, http.StatusCreated, envelope{"firmware_image": image}, headers)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// showFirmwareImageHandler for the "GET /v1/firmware-images/:id" endpoint.
+func (app *application) showFirmwareImageHandler(w http.ResponseWriter, r *http.Request) {
+	image, ok := app.loadFirmwareImage(w, r)
+	if !ok {
+		return
+	}
+
+	err := app.writeJSON(w, http.StatusOK, envelope{"firmware_image": image}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// deleteFirmwareImageHandler for the "DELETE /v1/firmware-images/:id" endpoint
+// deletes an image no campaign refers to, and its file.
+func (app *application) deleteFirmwareImageHandler(w http.ResponseWriter, r *http.Request) {
+	image, ok := app.loadFirmwareImage(w, r)
+	if !ok {
+		return
+	}
+
+	err := app.models.FirmwareImages.Delete(image.ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		case errors.Is(err, data.ErrFirmwareImageInUse):
+			app.resourceInUseResponse(w, r, "the firmware image is used by an upgrade campaign and cannot be deleted")
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	app.removeArtifact(image.SHA256)
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"message": "firmware image successfully deleted"}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// loadFirmwareImage fetches the image named by the request's id parameter, sending
+// a 404 if there's no such image.
+func (app *application) loadFirmwareImage(w http.ResponseWriter, r *http.Request) (*data.FirmwareImage, bool) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return nil, false
+	}
+
+	image, err := app.models.FirmwareImages.Get(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return nil, false
+	}
+	return image, true
+}
+
+// removeArtifact deletes a file from the artifact store. A file left behind only
+// wastes space, so failures are logged rather than reported.
+func (app *application) removeArtifact(digest string) {
+	if err := app.artifacts.Remove(digest); err != nil {
+		app.logger.Error("removing artifact", "sha256", digest, "error", err)
+	}
+}
+
+// listUpgradeCampaignsHandler for the "GET /v1/upgrade-campaigns" endpoint, newest
+// first, each with its progress.
+func (app *application) listUpgradeCampaignsHandler(w http.ResponseWriter, r *http.Request) {
+	campaigns, err := app.models.Upgrades.GetAll()
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"upgrade_campaigns": campaigns}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// createUpgradeCampaignHandler for the "POST /v1/upgrade-campaigns" endpoint starts
+// rolling an image out to the cameras of its model which the selection matches now.
+// Cameras added later aren't included.
+func (app *application) createUpgradeCampaignHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Name            string          `json:"name"`
+		ImageID         int64           `json:"image_id"`
+		Selection       data.ViewParams `json:"selection"`
+		WaveSize        *int            `json:"wave_size"`
+		SiteConcurrency *int            `json:"site_concurrency"`
+		MaxFailures     *int            `json:"max_failures"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	campaign := &data.UpgradeCampaign{
+		CreatedBy:       app.contextGetIdentity(r).User,
+		Name:            input.Name,
+		WaveSize:        10,
+		SiteConcurrency: 1,
+	}
+	if input.WaveSize != nil {
+		campaign.WaveSize = *input.WaveSize
+	}
+	if input.SiteConcurrency != nil {
+		campaign.SiteConcurrency = *input.SiteConcurrency
+	}
+	if input.MaxFailures != nil {
+		campaign.MaxFailures = *input.MaxFailures
+	}
+
+	v := validator.New()
+	filter, selection := app.checkUpgradeSelection(v, input.Selection)
+	campaign.Selection = selection
+	if data.ValidateUpgradeCampaign(v, campaign); !v.Valid() {
+		app.failedValidationResponse(w, r, v)
+		return
+	}
+
+	image, err := app.models.FirmwareImages.Get(input.ImageID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			v.AddErrorCode("image_id", validator.CodeInvalid, "must be the id of an uploaded firmware image")
+			app.failedValidationResponse(w, r, v)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	campaign.Image = *image
+
+	// Only cameras of the image's model are upgraded, whatever else is selected.
+	if filter.ModelNo != "" && !strings.EqualFold(filter.ModelNo, image.ModelNo) {
+		v.AddErrorCode("selection.model_no", validator.CodeNotPermitted, "must be the image's model, "+image.ModelNo)
+		app.failedValidationResponse(w, r, v)
+		return
+	}
+	filter.ModelNo = image.ModelNo
+
+	cameras, err := app.selectCameras(filter)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	if len(cameras) == 0 {
+		v.AddErrorCode("selection", validator.CodeInvalid, "must match at least one camera of the image's model")
+		app.failedValidationResponse(w, r, v)
+		return
+	}
+
+	err = app.models.Upgrades.Insert(campaign, cameras)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	app.wakeUpgrades()
+
+	headers := make(http.Header)
+	headers.Set("Location", fmt.Sprintf("/v1/upgrade-campaigns/%d", campaign.ID))
+
+	err = app.writeJSON(w, http.StatusCreated, envelope{"upgrade_campaign": campaign}, headers)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// showUpgradeCampaignHandler for the "GET /v1/upgrade-campaigns/:id" endpoint.
+func (app *application) showUpgradeCampaignHandler(w http.ResponseWriter, r *http.Request) {
+	campaign, ok := app.loadUpgradeCampaign(w, r)
+	if !ok {
+		return
+	}
+
+	err := app.writeJSON(w, http.StatusOK, envelope{"upgrade_campaign": campaign}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// updateUpgradeCampaignHandler for the "PATCH /v1/upgrade-campaigns/:id" endpoint
+// pauses, resumes or cancels a campaign on behalf of the caller, and changes its name
+// and limits. Upgrades in flight when a campaign is paused or cancelled finish. A
+// halted campaign is resumed by raising max_failures past the failures so far.
+func (app *application) updateUpgradeCampaignHandler(w http.ResponseWriter, r *http.Request) {
+	campaign, ok := app.loadUpgradeCampaign(w, r)
+	if !ok {
+		return
+	}
+
+	var input struct {
+		Name            *string `json:"name"`
+		State           *string `json:"state"`
+		SiteConcurrency *int    `json:"site_concurrency"`
+		MaxFailures     *int    `json:"max_failures"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+	if input.State != nil {
+		if data.ValidateUpgradeCampaignState(v, campaign.State, *input.State); !v.Valid() {
+			app.failedValidationResponse(w, r, v)
+			return
+		}
+		verb := map[string]string{data.CampaignRunning: "resumed", data.CampaignPaused: "paused", data.CampaignCancelled: "cancelled"}[*input.State]
+		campaign.SetState(*input.State, verb+" by "+app.contextGetIdentity(r).User, time.Now())
+	}
+	if input.Name != nil {
+		campaign.Name = *input.Name
+	}
+	if input.SiteConcurrency != nil {
+		campaign.SiteConcurrency = *input.SiteConcurrency
+	}
+	if input.MaxFailures != nil {
+		campaign.MaxFailures = *input.MaxFailures
+	}
+
+	if data.ValidateUpgradeCampaign(v, campaign); !v.Valid() {
+		app.failedValidationResponse(w, r, v)
+		return
+	}
+
+	err = app.models.Upgrades.Update(campaign)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrEditConflict):
+			app.editConflictResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	app.wakeUpgrades()
+
+	// A resumed campaign may have been halted or completed straight away, so it's
+	// read back to show where it ended up.
+	campaign, err = app.models.Upgrades.Get(campaign.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"upgrade_campaign": campaign}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// listUpgradeTargetsHandler for the "GET /v1/upgrade-campaigns/:id/targets" endpoint
+// lists a campaign's cameras in the order they're upgraded, optionally filtered by
+// state (a comma-separated list).
+func (app *application) listUpgradeTargetsHandler(w http.ResponseWriter, r *http.Request) {
+	campaign, ok := app.loadUpgradeCampaign(w, r)
+	if !ok {
+		return
+	}
+
+	v := validator.New()
+	states := app.readCSV(r.URL.Query(), "state", nil)
+	for _, state := range states {
+		v.CheckCode(validator.PermittedValue(state, data.TargetStateSafelist...), "state", validator.CodeNotPermitted, "must be one of: "+strings.Join(data.TargetStateSafelist, ", "))
+	}
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v)
+		return
+	}
+
+	targets, err := app.models.Upgrades.Targets(campaign.ID, states)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"targets": targets}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// loadUpgradeCampaign fetches the campaign named by the request's id parameter,
+// sending a 404 if there's no such campaign.
+func (app *application) loadUpgradeCampaign(w http.ResponseWriter, r *http.Request) (*data.UpgradeCampaign, bool) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return nil, false
+	}
+
+	campaign, err := app.models.Upgrades.Get(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return nil, false
+	}
+	return campaign, true
+}
+
+// checkUpgradeSelection reads a campaign's selection as camera filters, recording
+// failures in v as "selection.<name>", and returns the filter with the selection in
+// canonical form, the way checkViewParams does for views.
+func (app *application) checkUpgradeSelection(v *validator.Validator, selection data.ViewParams) (data.CameraFilter, data.ViewParams) {
+	canonical := data.ViewParams{}
+	for key, value := range selection {
+		if value != "" {
+			canonical[key] = value
+		}
+	}
+
+	lv := validator.New()
+	filter, err := app.readCameraFilter(canonical.Values(), lv)
+	for field, message := range lv.Errors {
+		v.AddErrorCode("selection."+field, lv.Code(field), message)
+	}
+	var qerr *query.Error
+	if errors.As(err, &qerr) {
+		v.AddErrorCode("selection.q", validator.CodeBadFormat, qerr.Error())
+	}
+
+	if filter.Query != nil {
+		canonical["q"] = filter.Query.String()
+	}
+	return filter, canonical
+}
+
+// selectCameras returns every camera filter matches, in ID order.
+func (app *application) selectCameras(filter data.CameraFilter) ([]*data.Camera, error) {
+	var selected []*data.Camera
+	filters := data.Filters{Page: 1, PageSize: 100, Sort: "id", SortSafelist: []string{"id"}}
+	for {
+		cameras, metadata, err := app.models.Cameras.GetAll(filter, data.Projection{}, filters)
+		if err != nil {
+			return nil, err
+		}
+		selected = append(selected, cameras...)
+		if filters.Page >= metadata.LastPage {
+			return selected, nil
+		}
+		filters.Page++
+	}
+}
+
+// wakeUpgrades has the runner look for cameras to upgrade straight away.
+func (app *application) wakeUpgrades() {
+	if app.upgrades != nil {
+		app.upgrades.Wake()
+	}
+}
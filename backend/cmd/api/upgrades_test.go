@@ -0,0 +1,276 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/chefgoldbloom/pnctool/backend/internal/artifact"
+	"github.com/chefgoldbloom/pnctool/backend/internal/data"
+)
+
+// uploadFirmwareImage uploads contents as an image of the given model and firmware
+// and returns it.
+func uploadFirmwareImage(t *testing.T, h http.Handler, modelNo, firmware, contents string) data.FirmwareImage {
+	t.Helper()
+
+	url := fmt.Sprintf("/v1/firmware-images?model_no=%s&firmware=%s&filename=%s.bin", modelNo, firmware, modelNo)
+	res := do(t, h, http.MethodPost, url, contents, "X-User", "ana", "Content-Type", "application/octet-stream")
+	if res.status != http.StatusCreated {
+		t.Fatalf("upload firmware image: status = %d; body = %v", res.status, res.body)
+	}
+	var image data.FirmwareImage
+	res.decode(t, "firmware_image", &image)
+	return image
+}
+
+// slowReader returns its first fast bytes straight away and then pauses before
+// each chunk of the rest.
+type slowReader struct {
+	data  []byte
+	fast  int // bytes left to return without a pause
+	chunk int
+	pause time.Duration
+}
+
+func (r *slowReader) Read(p []byte) (int, error) {
+	if len(r.data) == 0 {
+		return 0, io.EOF
+	}
+	if r.fast == 0 {
+		time.Sleep(r.pause)
+		r.fast = r.chunk
+	}
+	n := copy(p[:min(r.fast, len(p))], r.data)
+	r.data, r.fast = r.data[n:], r.fast-n
+	return n, nil
+}
+
+// validationErrors returns the fields of a failed validation response.
+func validationErrors(t *testing.T, res testResponse) map[string]string {
+	t.Helper()
+
+	if res.status != http.StatusUnprocessableEntity {
+		t.Fatalf("status = %d; want 422; body = %v", res.status, res.body)
+	}
+	var errs map[string]string
+	res.decode(t, "error", &errs)
+	return errs
+}
+
+func TestFirmwareImages(t *testing.T) {
+	app := newTestApplication(t)
+	routes := app.routes()
+
+	if res := do(t, routes, http.MethodGet, "/v1/firmware-images", ""); res.status != http.StatusUnauthorized {
+		t.Errorf("anonymous list: status = %d; want 401", res.status)
+	}
+
+	image := uploadFirmwareImage(t, routes, "P3245-LV", "11.1.66", "11.1.66\n")
+	if image.UploadedBy != "ana" || image.Size != 8 || image.Filename != "P3245-LV.bin" ||
+		image.SHA256 != "177399776f1271ec665ccbd75eb2364dba563a8c42d2fde84b83aaeae0469af0" {
+		t.Errorf("uploaded image = %+v", image)
+	}
+	f, err := app.artifacts.Open(image.SHA256)
+	if err != nil {
+		t.Fatalf("image not in the artifact store: %v", err)
+	}
+	f.Close()
+
+	tests := []struct {
+		name, url, body string
+		field           string
+	}{
+		{"missing details", "/v1/firmware-images", "11.1.66", "firmware"},
+		{"bad version", "/v1/firmware-images?model_no=P3245-LV&firmware=latest", "11.1.66", "firmware"},
+		{"empty", "/v1/firmware-images?model_no=P3245-LV&firmware=11.1.67", "", "body"},
+		{"duplicate", "/v1/firmware-images?model_no=P3245-LV&firmware=11.1.66", "11.1.66\n", "body"},
+	}
+	for _, tt := range tests {
+		errs := validationErrors(t, do(t, routes, http.MethodPost, tt.url, tt.body, "X-User", "ana"))
+		if _, ok := errs[tt.field]; !ok {
+			t.Errorf("%s: errors = %v; want one on %s", tt.name, errs, tt.field)
+		}
+	}
+	res := do(t, routes, http.MethodPost, "/v1/firmware-images?model_no=P3245-LV&firmware=11.1.67", strings.Repeat("x", 1<<20+1), "X-User", "ana")
+	if res.status != http.StatusBadRequest {
+		t.Errorf("too large: status = %d; want 400", res.status)
+	}
+
+	var images []data.FirmwareImage
+	do(t, routes, http.MethodGet, "/v1/firmware-images", "", "X-User", "ana").decode(t, "firmware_images", &images)
+	if len(images) != 1 || images[0].ID != image.ID {
+		t.Errorf("listed images = %+v; want only the one uploaded", images)
+	}
+	if res := do(t, routes, http.MethodGet, "/v1/firmware-images/99", "", "X-User", "ana"); res.status != http.StatusNotFound {
+		t.Errorf("show missing: status = %d; want 404", res.status)
+	}
+
+	// An image can't be deleted while a campaign uses it.
+	createCamera(t, routes, `{"name":"lobby","mac_address":"ACCC8E000001","site_name":"NYC-5th-OPS","model_no":"P3245-LV","address":"10.0.0.1"}`)
+	res = do(t, routes, http.MethodPost, "/v1/upgrade-campaigns", fmt.Sprintf(`{"name":"spring","image_id":%d}`, image.ID), "X-User", "ana")
+	if res.status != http.StatusCreated {
+		t.Fatalf("create campaign: status = %d; body = %v", res.status, res.body)
+	}
+	url := fmt.Sprintf("/v1/firmware-images/%d", image.ID)
+	res = do(t, routes, http.MethodDelete, url, "", "X-User", "ana")
+	var code string
+	res.decode(t, "code", &code)
+	if res.status != http.StatusConflict || code != "resource_in_use" {
+		t.Errorf("delete in use: status = %d, code %s; want 409 resource_in_use", res.status, code)
+	}
+
+	other := uploadFirmwareImage(t, routes, "P3245-LV", "11.1.70", "11.1.70\n")
+	if res := do(t, routes, http.MethodDelete, fmt.Sprintf("/v1/firmware-images/%d", other.ID), "", "X-User", "ana"); res.status != http.StatusOK {
+		t.Errorf("delete: status = %d; want 200", res.status)
+	}
+	if _, err := app.artifacts.Open(other.SHA256); !errors.Is(err, artifact.ErrNotFound) {
+		t.Errorf("deleted image's file: %v; want it removed", err)
+	}
+}
+
+func TestUpgradeCampaigns(t *testing.T) {
+	routes := newTestApplication(t).routes()
+
+	for _, body := range []string{
+		`{"name":"lobby","mac_address":"ACCC8E000001","site_name":"NYC-5th-OPS","model_no":"P3245-LV","address":"10.0.0.1"}`,
+		`{"name":"hall","mac_address":"ACCC8E000002","site_name":"NYC-5th-OPS","model_no":"P3245-LV","address":"10.0.0.2"}`,
+		`{"name":"gate","mac_address":"ACCC8E000003","site_name":"BOS-Main-OPS","model_no":"P3245-LV","address":"10.0.1.1"}`,
+		`{"name":"dome","mac_address":"ACCC8E000004","site_name":"NYC-5th-OPS","model_no":"P1375","address":"10.0.0.3"}`,
+	} {
+		createCamera(t, routes, body)
+	}
+	image := uploadFirmwareImage(t, routes, "P3245-LV", "11.1.66", "11.1.66\n")
+
+	tests := []struct {
+		name, body string
+		field      string
+	}{
+		{"missing name", fmt.Sprintf(`{"image_id":%d}`, image.ID), "name"},
+		{"bad limits", fmt.Sprintf(`{"name":"spring","image_id":%d,"wave_size":0,"site_concurrency":101}`, image.ID), "wave_size"},
+		{"missing image", `{"name":"spring","image_id":99}`, "image_id"},
+		{"another model", fmt.Sprintf(`{"name":"spring","image_id":%d,"selection":{"model_no":"P1375"}}`, image.ID), "selection.model_no"},
+		{"no cameras", fmt.Sprintf(`{"name":"spring","image_id":%d,"selection":{"site_name":"LAX-1-OPS"}}`, image.ID), "selection"},
+		{"bad q", fmt.Sprintf(`{"name":"spring","image_id":%d,"selection":{"q":"name =="}}`, image.ID), "selection.q"},
+		{"unknown selection", fmt.Sprintf(`{"name":"spring","image_id":%d,"selection":{"sort":"name"}}`, image.ID), "selection"},
+	}
+	for _, tt := range tests {
+		errs := validationErrors(t, do(t, routes, http.MethodPost, "/v1/upgrade-campaigns", tt.body, "X-User", "ana"))
+		if _, ok := errs[tt.field]; !ok {
+			t.Errorf("%s: errors = %v; want one on %s", tt.name, errs, tt.field)
+		}
+	}
+
+	// The selection is narrowed to the image's model, so dome isn't included.
+	res := do(t, routes, http.MethodPost, "/v1/upgrade-campaigns", fmt.Sprintf(`{"name":"spring","image_id":%d,"selection":{"site_name":"NYC-5th-OPS"},"wave_size":1}`, image.ID), "X-User", "ana")
+	if res.status != http.StatusCreated {
+		t.Fatalf("create: status = %d; body = %v", res.status, res.body)
+	}
+	var campaign data.UpgradeCampaign
+	res.decode(t, "upgrade_campaign", &campaign)
+	want := data.UpgradeProgress{Total: 2, Pending: 2, Wave: 1, Waves: 2}
+	if campaign.State != data.CampaignRunning || campaign.CreatedBy != "ana" || campaign.Image.ID != image.ID ||
+		campaign.SiteConcurrency != 1 || campaign.MaxFailures != 0 || campaign.Progress != want {
+		t.Errorf("created campaign = %+v; want running with progress %+v", campaign, want)
+	}
+	url := fmt.Sprintf("/v1/upgrade-campaigns/%d", campaign.ID)
+	if loc := res.header.Get("Location"); loc != url {
+		t.Errorf("Location = %q; want %q", loc, url)
+	}
+
+	var targets []data.UpgradeTarget
+	do(t, routes, http.MethodGet, url+"/targets?state=pending,upgrading", "", "X-User", "ana").decode(t, "targets", &targets)
+	if len(targets) != 2 || targets[0].Name != "lobby" || targets[0].Wave != 1 || targets[1].Name != "hall" || targets[1].Wave != 2 {
+		t.Errorf("targets = %+v; want lobby then hall", targets)
+	}
+	if errs := validationErrors(t, do(t, routes, http.MethodGet, url+"/targets?state=broken", "", "X-User", "ana")); errs["state"] == "" {
+		t.Errorf("targets?state=broken: errors = %v", errs)
+	}
+
+	updates := []struct {
+		name, body string
+		status     int
+		state      string
+	}{
+		{"pause", `{"state":"paused"}`, http.StatusOK, data.CampaignPaused},
+		{"complete by hand", `{"state":"completed"}`, http.StatusUnprocessableEntity, ""},
+		{"resume with limits", `{"state":"running","site_concurrency":2,"max_failures":1}`, http.StatusOK, data.CampaignRunning},
+		{"bad limit", `{"site_concurrency":0}`, http.StatusUnprocessableEntity, ""},
+		{"cancel", `{"state":"cancelled"}`, http.StatusOK, data.CampaignCancelled},
+		{"resume cancelled", `{"state":"running"}`, http.StatusUnprocessableEntity, ""},
+	}
+	for _, tt := range updates {
+		res := do(t, routes, http.MethodPatch, url, tt.body, "X-User", "ana")
+		if res.status != tt.status {
+			t.Errorf("%s: status = %d; want %d; body = %v", tt.name, res.status, tt.status, res.body)
+			continue
+		}
+		if tt.status == http.StatusOK {
+			var got data.UpgradeCampaign
+			res.decode(t, "upgrade_campaign", &got)
+			if got.State != tt.state {
+				t.Errorf("%s: state = %s; want %s", tt.name, got.State, tt.state)
+			}
+		}
+	}
+
+	do(t, routes, http.MethodGet, url, "", "X-User", "ana").decode(t, "upgrade_campaign", &campaign)
+	want = data.UpgradeProgress{Total: 2, Skipped: 2, Wave: 0, Waves: 2}
+	if campaign.StateReason != "cancelled by ana" || campaign.FinishedAt == nil || campaign.SiteConcurrency != 2 || campaign.Progress != want {
+		t.Errorf("cancelled campaign = %+v; want progress %+v", campaign, want)
+	}
+
+	var campaigns []data.UpgradeCampaign
+	do(t, routes, http.MethodGet, "/v1/upgrade-campaigns", "", "X-User", "ana").decode(t, "upgrade_campaigns", &campaigns)
+	if len(campaigns) != 1 || campaigns[0].ID != campaign.ID {
+		t.Errorf("listed campaigns = %+v", campaigns)
+	}
+	if res := do(t, routes, http.MethodGet, "/v1/upgrade-campaigns/99", "", "X-User", "ana"); res.status != http.StatusNotFound {
+		t.Errorf("show missing: status = %d; want 404", res.status)
+	}
+}
+
+// An upload slower than the server's ReadTimeout still arrives, with or without an
+// Idempotency-Key.
+func TestFirmwareImageSlowUpload(t *testing.T) {
+	app := newTestApplication(t)
+	app.cfg.upgrades.maxImageSize = 4 << 20
+	srv := httptest.NewUnstartedServer(app.routes())
+	srv.Config.ReadTimeout = 200 * time.Millisecond
+	srv.Start()
+	t.Cleanup(srv.Close)
+
+	for i, key := range []string{"", "upload-1"} {
+		image := bytes.Repeat([]byte{byte('a' + i)}, 2<<20)
+		body := &slowReader{data: image, fast: 1<<20 + 1, chunk: 128 << 10, pause: 50 * time.Millisecond}
+		req, err := http.NewRequest(http.MethodPost, srv.URL+"/v1/firmware-images?model_no=P3245-LV&firmware=11.1.6"+fmt.Sprint(i), body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.ContentLength = int64(len(image))
+		req.Header.Set("X-User", "ana")
+		if key != "" {
+			req.Header.Set("Idempotency-Key", key)
+		}
+
+		res, err := srv.Client().Do(req)
+		if err != nil {
+			t.Fatalf("key %q: %v", key, err)
+		}
+		var got struct {
+			Image data.FirmwareImage `json:"firmware_image"`
+		}
+		err = json.NewDecoder(res.Body).Decode(&got)
+		res.Body.Close()
+		if res.StatusCode != http.StatusCreated || err != nil || got.Image.Size != int64(len(image)) {
+			t.Errorf("key %q: status = %d, image %+v, %v; want all %d bytes uploaded", key, res.StatusCode, got.Image, err, len(image))
+		}
+	}
+}
@@ -0,0 +1,302 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/chefgoldbloom/pnctool/backend/internal/data"
+	"github.com/chefgoldbloom/pnctool/backend/internal/query"
+	"github.com/chefgoldbloom/pnctool/backend/internal/validator"
+)
+
+// listViewsHandler for the "GET /v1/views" endpoint returns the caller's views and
+// those shared with their team.
+func (app *application) listViewsHandler(w http.ResponseWriter, r *http.Request) {
+	id := app.contextGetIdentity(r)
+
+	views, err := app.models.Views.GetAllFor(id.User, id.Team)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	for _, view := range views {
+		if err := view.Upgrade(); err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"views": views}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// createViewHandler for the "POST /v1/views" endpoint saves a camera listing.
+func (app *application) createViewHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Name       string          `json:"name"`
+		Visibility string          `json:"visibility"`
+		Params     data.ViewParams `json:"params"`
+		Pinned     bool            `json:"pinned"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	id := app.contextGetIdentity(r)
+	view := &data.View{
+		Owner:      id.User,
+		Team:       id.Team,
+		Name:       input.Name,
+		Visibility: input.Visibility,
+		Params:     input.Params,
+		Syntax:     data.ViewSyntaxVersion,
+		Pinned:     input.Pinned,
+	}
+	if view.Visibility == "" {
+		view.Visibility = data.ViewPrivate
+	}
+
+	v := validator.New()
+	if view.Params = app.checkViewParams(v, view.Params); !v.Valid() {
+		app.failedValidationResponse(w, r, v)
+		return
+	}
+	if data.ValidateView(v, view); !v.Valid() {
+		app.failedValidationResponse(w, r, v)
+		return
+	}
+
+	err = app.models.Views.Insert(view)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrDuplicateViewName):
+			v.AddErrorCode("name", validator.CodeDuplicate, "you already have a view with this name")
+			app.failedValidationResponse(w, r, v)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	headers := make(http.Header)
+	headers.Set("Location", fmt.Sprintf("/v1/views/%d", view.ID))
+
+	err = app.writeJSON(w, http.StatusCreated, envelope{"view": view}, headers)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// showViewHandler for the "GET /v1/views/:id" endpoint.
+func (app *application) showViewHandler(w http.ResponseWriter, r *http.Request) {
+	view, ok := app.loadView(w, r)
+	if !ok {
+		return
+	}
+
+	err := app.writeJSON(w, http.StatusOK, envelope{"view": view}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// updateViewHandler for the "PATCH /v1/views/:id" endpoint. Only the owner can change
+// a view.
+func (app *application) updateViewHandler(w http.ResponseWriter, r *http.Request) {
+	view, ok := app.loadOwnView(w, r)
+	if !ok {
+		return
+	}
+
+	var input struct {
+		Name       *string         `json:"name"`
+		Visibility *string         `json:"visibility"`
+		Params     data.ViewParams `json:"params"`
+		Pinned     *bool           `json:"pinned"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	if input.Name != nil {
+		view.Name = *input.Name
+	}
+	if input.Visibility != nil {
+		view.Visibility = *input.Visibility
+		// A view is shared with whichever team its owner is in when they share it
+		view.Team = app.contextGetIdentity(r).Team
+	}
+	if input.Params != nil {
+		view.Params = input.Params
+	}
+	if input.Pinned != nil {
+		view.Pinned = *input.Pinned
+	}
+
+	v := validator.New()
+	if view.Params = app.checkViewParams(v, view.Params); !v.Valid() {
+		app.failedValidationResponse(w, r, v)
+		return
+	}
+	if data.ValidateView(v, view); !v.Valid() {
+		app.failedValidationResponse(w, r, v)
+		return
+	}
+
+	err = app.models.Views.Update(view)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrDuplicateViewName):
+			v.AddErrorCode("name", validator.CodeDuplicate, "you already have a view with this name")
+			app.failedValidationResponse(w, r, v)
+		case errors.Is(err, data.ErrEditConflict):
+			app.editConflictResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"view": view}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// deleteViewHandler for the "DELETE /v1/views/:id" endpoint.
+func (app *application) deleteViewHandler(w http.ResponseWriter, r *http.Request) {
+	view, ok := app.loadOwnView(w, r)
+	if !ok {
+		return
+	}
+
+	err := app.models.Views.Delete(view.ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"message": "view successfully deleted"}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// viewCamerasHandler for the "GET /v1/views/:id/cameras" endpoint runs a saved
+// listing. The page and page_size of the request override the view's.
+func (app *application) viewCamerasHandler(w http.ResponseWriter, r *http.Request) {
+	view, ok := app.loadView(w, r)
+	if !ok {
+		return
+	}
+
+	qs := view.Params.Values()
+	for _, key := range []string{"page", "page_size"} {
+		if value := r.URL.Query().Get(key); value != "" {
+			qs.Set(key, value)
+		}
+	}
+
+	v := validator.New()
+	input, err := app.readCameraListInput(qs, v)
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v)
+		return
+	}
+	var qerr *query.Error
+	if errors.As(err, &qerr) {
+		app.invalidQueryResponse(w, r, qerr)
+		return
+	}
+
+	app.listCameras(w, r, input)
+}
+
+// loadView fetches the view named in the URL, upgraded to the current parameter
+// syntax. Views the caller can't see are reported as not found. It writes the error
+// response itself and reports whether the caller should continue.
+func (app *application) loadView(w http.ResponseWriter, r *http.Request) (*data.View, bool) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return nil, false
+	}
+
+	view, err := app.models.Views.Get(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return nil, false
+	}
+
+	caller := app.contextGetIdentity(r)
+	if !view.VisibleTo(caller.User, caller.Team) {
+		app.notFoundResponse(w, r)
+		return nil, false
+	}
+
+	if err := view.Upgrade(); err != nil {
+		app.serverErrorResponse(w, r, err)
+		return nil, false
+	}
+	return view, true
+}
+
+// loadOwnView is loadView for changes: views shared with the caller, but owned by
+// somebody else, are forbidden.
+func (app *application) loadOwnView(w http.ResponseWriter, r *http.Request) (*data.View, bool) {
+	view, ok := app.loadView(w, r)
+	if !ok {
+		return nil, false
+	}
+	if view.Owner != app.contextGetIdentity(r).User {
+		app.notPermittedResponse(w, r)
+		return nil, false
+	}
+	return view, true
+}
+
+// checkViewParams runs a view's parameters through the camera listing, recording
+// failures in v as "params.<name>", and returns them in canonical form: empty values
+// dropped and q= rewritten the way the current parser prints it.
+func (app *application) checkViewParams(v *validator.Validator, params data.ViewParams) data.ViewParams {
+	canonical := data.ViewParams{}
+	for key, value := range params {
+		if value != "" {
+			canonical[key] = value
+		}
+	}
+
+	lv := validator.New()
+	input, err := app.readCameraListInput(canonical.Values(), lv)
+	for field, message := range lv.Errors {
+		v.AddErrorCode("params."+field, lv.Code(field), message)
+	}
+	var qerr *query.Error
+	if errors.As(err, &qerr) {
+		v.AddErrorCode("params.q", validator.CodeBadFormat, qerr.Error())
+	}
+
+	if input.Query != nil {
+		canonical["q"] = input.Query.String()
+	}
+	return canonical
+}
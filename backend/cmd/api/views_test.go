@@ -0,0 +1,134 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/chefgoldbloom/pnctool/backend/internal/data"
+)
+
+// createView saves a view as user in team and returns it.
+func createView(t *testing.T, h http.Handler, user, team, body string) data.View {
+	t.Helper()
+
+	res := do(t, h, http.MethodPost, "/v1/views", body, "X-User", user, "X-Team", team)
+	if res.status != http.StatusCreated {
+		t.Fatalf("create view: status = %d; body = %v", res.status, res.body)
+	}
+	var view data.View
+	res.decode(t, "view", &view)
+	return view
+}
+
+func TestViews(t *testing.T) {
+	routes := newTestApplication(t).routes()
+	for i, site := range []string{"NYC-5th-GLH", "NYC-5th-OPS", "BOS-Main-GLH"} {
+		createCamera(t, routes, fmt.Sprintf(`{"name":"cam-%d","mac_address":"ACCC8E00000%d","site_name":%q,"model_no":"P3245"}`, i, i, site))
+	}
+
+	glh := createView(t, routes, "ana", "east", `{"name":"GLH","visibility":"team","params":{"q":"site_name:*-glh  model_no:P32*","sort":"-name","fields":"name"}}`)
+	if glh.Owner != "ana" || glh.Team != "east" || glh.Syntax != data.ViewSyntaxVersion || glh.Params["q"] != "site_name:*-glh AND model_no:P32*" {
+		t.Errorf("created view = %+v", glh)
+	}
+	mine := createView(t, routes, "ana", "east", `{"name":"Mine","params":{"site_name":"NYC-5th-OPS"},"pinned":true}`)
+	url := fmt.Sprintf("/v1/views/%d", glh.ID)
+
+	t.Run("run", func(t *testing.T) {
+		res := do(t, routes, http.MethodGet, url+"/cameras?page_size=1", "", "X-User", "ben", "X-Team", "east")
+		if res.status != http.StatusOK {
+			t.Fatalf("status = %d; body = %v", res.status, res.body)
+		}
+		var cameras []map[string]any
+		var metadata data.Metadata
+		res.decode(t, "cameras", &cameras)
+		res.decode(t, "metadata", &metadata)
+		if len(cameras) != 1 || cameras[0]["name"] != "cam-2" || len(cameras[0]) != 2 || metadata.TotalRecords != 2 {
+			t.Errorf("cameras = %v; metadata = %+v", cameras, metadata)
+		}
+	})
+
+	t.Run("visibility", func(t *testing.T) {
+		tests := []struct {
+			name, method, url, user, team string
+			status                        int
+		}{
+			{"anonymous", http.MethodGet, url, "", "", http.StatusUnauthorized},
+			{"owner", http.MethodGet, url, "ana", "east", http.StatusOK},
+			{"team member", http.MethodGet, url, "ben", "east", http.StatusOK},
+			{"other team", http.MethodGet, url, "cy", "west", http.StatusNotFound},
+			{"private", http.MethodGet, fmt.Sprintf("/v1/views/%d", mine.ID), "ben", "east", http.StatusNotFound},
+			{"team member edit", http.MethodDelete, url, "ben", "east", http.StatusForbidden},
+		}
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				res := do(t, routes, tt.method, tt.url, "", "X-User", tt.user, "X-Team", tt.team)
+				if res.status != tt.status {
+					t.Errorf("status = %d; want %d", res.status, tt.status)
+				}
+			})
+		}
+	})
+
+	t.Run("list", func(t *testing.T) {
+		listNames := func(user, team string) []string {
+			res := do(t, routes, http.MethodGet, "/v1/views", "", "X-User", user, "X-Team", team)
+			var views []data.View
+			res.decode(t, "views", &views)
+			names := []string{}
+			for _, v := range views {
+				names = append(names, v.Name)
+			}
+			return names
+		}
+		if got := fmt.Sprint(listNames("ana", "east")); got != "[Mine GLH]" {
+			t.Errorf("ana's views = %s; want pinned Mine first", got)
+		}
+		if got := fmt.Sprint(listNames("ben", "east")); got != "[GLH]" {
+			t.Errorf("ben's views = %s", got)
+		}
+	})
+
+	t.Run("pin", func(t *testing.T) {
+		res := do(t, routes, http.MethodPatch, url, `{"pinned":true}`, "X-User", "ana", "X-Team", "east")
+		if res.status != http.StatusOK {
+			t.Fatalf("status = %d; body = %v", res.status, res.body)
+		}
+		res = do(t, routes, http.MethodGet, fmt.Sprintf("/v1/views/%d", mine.ID), "", "X-User", "ana")
+		var view data.View
+		res.decode(t, "view", &view)
+		if view.Pinned {
+			t.Errorf("pinning GLH left Mine pinned")
+		}
+	})
+
+	t.Run("invalid", func(t *testing.T) {
+		tests := []struct {
+			name, body, field string
+		}{
+			{"no name", `{"params":{}}`, "name"},
+			{"duplicate name", `{"name":"GLH"}`, "name"},
+			{"bad query", `{"name":"x","params":{"q":"name:a OR"}}`, "params.q"},
+			{"bad sort", `{"name":"x","params":{"sort":"password"}}`, "params.sort"},
+			{"unknown param", `{"name":"x","params":{"page":"2"}}`, "params"},
+			{"team without team", `{"name":"x","visibility":"team"}`, "visibility"},
+		}
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				team := "east"
+				if tt.name == "team without team" {
+					team = ""
+				}
+				res := do(t, routes, http.MethodPost, "/v1/views", tt.body, "X-User", "ana", "X-Team", team)
+				if res.status != http.StatusUnprocessableEntity {
+					t.Fatalf("status = %d; body = %v", res.status, res.body)
+				}
+				var errs map[string]string
+				res.decode(t, "error", &errs)
+				if errs[tt.field] == "" {
+					t.Errorf("errors = %v; want one for %s", errs, tt.field)
+				}
+			})
+		}
+	})
+}
@@ -0,0 +1,366 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/chefgoldbloom/pnctool/backend/internal/data"
+	"github.com/chefgoldbloom/pnctool/backend/internal/validator"
+)
+
+// listWebhooksHandler for the "GET /v1/webhooks" endpoint. Secrets aren't shown.
+func (app *application) listWebhooksHandler(w http.ResponseWriter, r *http.Request) {
+	webhooks, err := app.models.Webhooks.GetAll()
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	for _, webhook := range webhooks {
+		webhook.Secret = ""
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"webhooks": webhooks}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// createWebhookHandler for the "POST /v1/webhooks" endpoint subscribes a URL to
+// events. A secret is generated unless one is given, and this is the only response
+// which shows it.
+func (app *application) createWebhookHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		URL         string   `json:"url"`
+		Secret      string   `json:"secret"`
+		EventTypes  []string `json:"event_types"`
+		Description string   `json:"description"`
+		Active      *bool    `json:"active"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	webhook := &data.Webhook{
+		URL:         input.URL,
+		Secret:      input.Secret,
+		EventTypes:  input.EventTypes,
+		Description: input.Description,
+		Active:      input.Active == nil || *input.Active,
+	}
+	if webhook.EventTypes == nil {
+		webhook.EventTypes = []string{}
+	}
+	if webhook.Secret == "" {
+		webhook.Secret, err = generateSecret()
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+	}
+
+	v := validator.New()
+	if data.ValidateWebhook(v, webhook); !v.Valid() {
+		app.failedValidationResponse(w, r, v)
+		return
+	}
+
+	err = app.models.Webhooks.Insert(webhook)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	headers := make(http.Header)
+	headers.Set("Location", fmt.Sprintf("/v1/webhooks/%d", webhook.ID))
+
+	err = app.writeJSON(w, http.StatusCreated, envelope{"webhook": webhook}, headers)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// showWebhookHandler for the "GET /v1/webhooks/:id" endpoint.
+func (app *application) showWebhookHandler(w http.ResponseWriter, r *http.Request) {
+	webhook, ok := app.loadWebhook(w, r)
+	if !ok {
+		return
+	}
+	webhook.Secret = ""
+
+	err := app.writeJSON(w, http.StatusOK, envelope{"webhook": webhook}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// updateWebhookHandler for the "PATCH /v1/webhooks/:id" endpoint. Setting secret
+// rotates it; deliveries already queued are signed with the new one.
+func (app *application) updateWebhookHandler(w http.ResponseWriter, r *http.Request) {
+	webhook, ok := app.loadWebhook(w, r)
+	if !ok {
+		return
+	}
+
+	var input struct {
+		URL         *string  `json:"url"`
+		Secret      *string  `json:"secret"`
+		EventTypes  []string `json:"event_types"`
+		Description *string  `json:"description"`
+		Active      *bool    `json:"active"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	if input.URL != nil {
+		webhook.URL = *input.URL
+	}
+	if input.Secret != nil {
+		webhook.Secret = *input.Secret
+	}
+	if input.EventTypes != nil {
+		webhook.EventTypes = input.EventTypes
+	}
+	if input.Description != nil {
+		webhook.Description = *input.Description
+	}
+	if input.Active != nil {
+		webhook.Active = *input.Active
+	}
+
+	v := validator.New()
+	if data.ValidateWebhook(v, webhook); !v.Valid() {
+		app.failedValidationResponse(w, r, v)
+		return
+	}
+
+	err = app.models.Webhooks.Update(webhook)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrEditConflict):
+			app.editConflictResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	webhook.Secret = ""
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"webhook": webhook}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// deleteWebhookHandler for the "DELETE /v1/webhooks/:id" endpoint. Its deliveries go
+// with it.
+func (app *application) deleteWebhookHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	err = app.models.Webhooks.Delete(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"message": "webhook successfully deleted"}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// pingWebhookHandler for the "POST /v1/webhooks/:id/ping" endpoint queues a
+// webhook.ping event for the webhook alone, whatever it's subscribed to, so a
+// receiver can be tested. The delivery is made in the background.
+func (app *application) pingWebhookHandler(w http.ResponseWriter, r *http.Request) {
+	webhook, ok := app.loadWebhook(w, r)
+	if !ok {
+		return
+	}
+
+	payload, err := json.Marshal(map[string]int64{"webhook_id": webhook.ID})
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	event := &data.Event{Type: data.EventWebhookPing, OccurredAt: time.Now().Truncate(time.Second), Data: payload}
+
+	// The ping goes straight into the log rather than through the bus, which would
+	// send it to every webhook.
+	err = app.models.Events.Insert(event)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	delivery, err := app.models.Webhooks.EnqueueTo(webhook.ID, event)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	app.wakeWebhooks()
+
+	app.writeDeliveryAccepted(w, r, delivery)
+}
+
+// listWebhookDeliveriesHandler for the "GET /v1/webhook-deliveries" endpoint, newest
+// first. state=dead lists the dead letters.
+func (app *application) listWebhookDeliveriesHandler(w http.ResponseWriter, r *http.Request) {
+	v := validator.New()
+	qs := r.URL.Query()
+
+	var filter data.DeliveryFilter
+	filter.WebhookID = int64(app.readInt(qs, "webhook_id", 0, v))
+	filter.State = app.readString(qs, "state", "")
+
+	filters := data.Filters{
+		Page:         app.readInt(qs, "page", 1, v),
+		PageSize:     app.readInt(qs, "page_size", 20, v),
+		Sort:         app.readString(qs, "sort", "-id"),
+		SortSafelist: []string{"id", "-id"},
+	}
+
+	if filter.State != "" {
+		v.CheckCode(validator.PermittedValue(filter.State, data.DeliveryStateSafelist...), "state", validator.CodeNotPermitted, "must be one of: "+strings.Join(data.DeliveryStateSafelist, ", "))
+	}
+	if data.ValidateFilters(v, filters); !v.Valid() {
+		app.failedValidationResponse(w, r, v)
+		return
+	}
+
+	deliveries, metadata, err := app.models.Webhooks.GetAllDeliveries(filter, filters)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"deliveries": deliveries, "metadata": metadata}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// showWebhookDeliveryHandler for the "GET /v1/webhook-deliveries/:id" endpoint.
+func (app *application) showWebhookDeliveryHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	delivery, err := app.models.Webhooks.GetDelivery(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"delivery": delivery}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// redeliverWebhookHandler for the "POST /v1/webhook-deliveries/:id/redeliver"
+// endpoint queues a delivery again, with a fresh set of attempts. It's how dead
+// letters are retried once the receiver is fixed.
+func (app *application) redeliverWebhookHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	delivery, err := app.models.Webhooks.Redeliver(id, time.Now())
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	app.wakeWebhooks()
+
+	app.writeDeliveryAccepted(w, r, delivery)
+}
+
+// writeDeliveryAccepted sends 202 Accepted for a queued delivery, with a Location
+// header to follow its progress.
+func (app *application) writeDeliveryAccepted(w http.ResponseWriter, r *http.Request, delivery *data.WebhookDelivery) {
+	headers := make(http.Header)
+	headers.Set("Location", fmt.Sprintf("/v1/webhook-deliveries/%d", delivery.ID))
+
+	err := app.writeJSON(w, http.StatusAccepted, envelope{"delivery": delivery}, headers)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// wakeWebhooks has the dispatcher make newly queued deliveries straight away.
+func (app *application) wakeWebhooks() {
+	if app.webhooks != nil {
+		app.webhooks.Wake()
+	}
+}
+
+// loadWebhook fetches the webhook named in the URL, sending a 404 if there's no such
+// webhook.
+func (app *application) loadWebhook(w http.ResponseWriter, r *http.Request) (*data.Webhook, bool) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return nil, false
+	}
+
+	webhook, err := app.models.Webhooks.Get(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return nil, false
+	}
+	return webhook, true
+}
+
+// generateSecret returns a random secret for signing deliveries.
+func generateSecret() (string, error) {
+	b := make([]byte, 24)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return "whsec_" + hex.EncodeToString(b), nil
+}
@@ -0,0 +1,193 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"slices"
+	"testing"
+
+	"github.com/chefgoldbloom/pnctool/backend/internal/data"
+	"github.com/chefgoldbloom/pnctool/backend/internal/webhook/webhooktest"
+)
+
+const testWebhookSecret = "whsec_0123456789abcdef"
+
+// createWebhook subscribes url to the given event types and returns the webhook.
+func createWebhook(t *testing.T, h http.Handler, body string) data.Webhook {
+	t.Helper()
+
+	res := do(t, h, http.MethodPost, "/v1/webhooks", body, "X-User", "ana")
+	if res.status != http.StatusCreated {
+		t.Fatalf("create webhook: status = %d; body = %v", res.status, res.body)
+	}
+	var webhook data.Webhook
+	res.decode(t, "webhook", &webhook)
+	return webhook
+}
+
+// eventTypes returns the X-PNC-Event header of each delivery, sorted, since
+// deliveries are made concurrently.
+func eventTypes(deliveries []webhooktest.Delivery) []string {
+	types := []string{}
+	for _, d := range deliveries {
+		types = append(types, d.Event)
+	}
+	slices.Sort(types)
+	return types
+}
+
+func TestWebhooks(t *testing.T) {
+	routes := newTestApplication(t).routes()
+
+	if res := do(t, routes, http.MethodGet, "/v1/webhooks", ""); res.status != http.StatusUnauthorized {
+		t.Errorf("anonymous list: status = %d; want 401", res.status)
+	}
+
+	generated := createWebhook(t, routes, `{"url":"https://example.com/hook","event_types":["camera.offline"]}`)
+	if len(generated.Secret) != len("whsec_")+48 || !generated.Active || generated.Version != 1 {
+		t.Errorf("created webhook = %+v; want an active webhook with a generated secret", generated)
+	}
+	given := createWebhook(t, routes, fmt.Sprintf(`{"url":"https://example.com/other","secret":%q,"active":false}`, testWebhookSecret))
+	if given.Secret != testWebhookSecret || given.Active || len(given.EventTypes) != 0 {
+		t.Errorf("created webhook = %+v; want the given secret, inactive", given)
+	}
+
+	// The secret is only shown when the webhook is created.
+	res := do(t, routes, http.MethodGet, fmt.Sprintf("/v1/webhooks/%d", generated.ID), "", "X-User", "ana")
+	if _, ok := res.body["webhook"]; res.status != http.StatusOK || !ok {
+		t.Fatalf("show: status = %d; body = %v", res.status, res.body)
+	}
+	var shown map[string]any
+	res.decode(t, "webhook", &shown)
+	if _, ok := shown["secret"]; ok {
+		t.Errorf("shown webhook includes its secret: %v", shown)
+	}
+	var listed []map[string]any
+	do(t, routes, http.MethodGet, "/v1/webhooks", "", "X-User", "ana").decode(t, "webhooks", &listed)
+	if len(listed) != 2 || listed[0]["secret"] != nil || listed[1]["secret"] != nil {
+		t.Errorf("listed webhooks = %v; want two without secrets", listed)
+	}
+
+	tests := []struct {
+		name, method, url, body string
+		status                  int
+	}{
+		{"create invalid", http.MethodPost, "/v1/webhooks", `{"url":"ftp://example.com","event_types":["camera.exploded"]}`, http.StatusUnprocessableEntity},
+		{"create ping subscription", http.MethodPost, "/v1/webhooks", `{"url":"https://example.com","event_types":["webhook.ping"]}`, http.StatusUnprocessableEntity},
+		{"update", http.MethodPatch, fmt.Sprintf("/v1/webhooks/%d", generated.ID), `{"description":"paging","event_types":["camera.offline","camera.online"]}`, http.StatusOK},
+		{"update short secret", http.MethodPatch, fmt.Sprintf("/v1/webhooks/%d", generated.ID), `{"secret":"short"}`, http.StatusUnprocessableEntity},
+		{"update missing", http.MethodPatch, "/v1/webhooks/99", `{"active":false}`, http.StatusNotFound},
+		{"delete", http.MethodDelete, fmt.Sprintf("/v1/webhooks/%d", given.ID), "", http.StatusOK},
+		{"delete again", http.MethodDelete, fmt.Sprintf("/v1/webhooks/%d", given.ID), "", http.StatusNotFound},
+		{"ping missing", http.MethodPost, "/v1/webhooks/99/ping", "", http.StatusNotFound},
+		{"bad state", http.MethodGet, "/v1/webhook-deliveries?state=lost", "", http.StatusUnprocessableEntity},
+		{"missing delivery", http.MethodGet, "/v1/webhook-deliveries/99", "", http.StatusNotFound},
+		{"redeliver missing", http.MethodPost, "/v1/webhook-deliveries/99/redeliver", "", http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			res := do(t, routes, tt.method, tt.url, tt.body, "X-User", "ana")
+			if res.status != tt.status {
+				t.Errorf("status = %d; want %d; body = %v", res.status, tt.status, res.body)
+			}
+		})
+	}
+
+	var updated data.Webhook
+	do(t, routes, http.MethodGet, fmt.Sprintf("/v1/webhooks/%d", generated.ID), "", "X-User", "ana").decode(t, "webhook", &updated)
+	if updated.Description != "paging" || len(updated.EventTypes) != 2 || updated.Version != 2 {
+		t.Errorf("updated webhook = %+v", updated)
+	}
+}
+
+func TestWebhookDeliveries(t *testing.T) {
+	app := newTestApplication(t)
+	routes := app.routes()
+	receiver := webhooktest.NewReceiver(testWebhookSecret)
+	defer receiver.Close()
+
+	webhook := createWebhook(t, routes, fmt.Sprintf(`{"url":%q,"secret":%q}`, receiver.URL, testWebhookSecret))
+	dispatch := func() {
+		t.Helper()
+		if _, err := app.webhooks.Dispatch(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Camera changes made through the API are delivered, signed.
+	camera := createCamera(t, routes, validCameraJSON)
+	do(t, routes, http.MethodPatch, fmt.Sprintf("/v1/cameras/%d", camera.ID), `{"name":"lobby-west"}`)
+	do(t, routes, http.MethodDelete, fmt.Sprintf("/v1/cameras/%d", camera.ID), "")
+	dispatch()
+	got := receiver.Deliveries()
+	if fmt.Sprint(eventTypes(got)) != "[camera.created camera.deleted camera.updated]" {
+		t.Fatalf("receiver got %v", eventTypes(got))
+	}
+	for _, d := range got {
+		if !d.Signed || d.Status != http.StatusNoContent {
+			t.Errorf("delivery %s = %+v; want signed and accepted", d.ID, d)
+		}
+	}
+
+	// So are changes made in a batch, once it's done.
+	body := `{"operations":[
+		{"op":"create","resource":"cameras","data":{"name":"new","mac_address":"ACCC8E000002","site_name":"BOS-Main-GLH"}},
+		{"op":"update","resource":"cameras","id":2,"version":1,"data":{"site_name":"BOS-Main-OPS"}}
+	]}`
+	if res := do(t, routes, http.MethodPost, "/v1/batch", body); res.status != http.StatusOK {
+		t.Fatalf("batch: status = %d; body = %v", res.status, res.body)
+	}
+	dispatch()
+	if got := eventTypes(receiver.Deliveries()[3:]); fmt.Sprint(got) != "[camera.created camera.updated]" {
+		t.Errorf("batch delivered %v", got)
+	}
+
+	// A ping goes out whatever the webhook is subscribed to.
+	do(t, routes, http.MethodPatch, fmt.Sprintf("/v1/webhooks/%d", webhook.ID), `{"event_types":["camera.offline"]}`, "X-User", "ana")
+	res := do(t, routes, http.MethodPost, fmt.Sprintf("/v1/webhooks/%d/ping", webhook.ID), "", "X-User", "ana")
+	var ping data.WebhookDelivery
+	res.decode(t, "delivery", &ping)
+	if res.status != http.StatusAccepted || res.header.Get("Location") != fmt.Sprintf("/v1/webhook-deliveries/%d", ping.ID) ||
+		ping.EventType != data.EventWebhookPing || ping.State != data.DeliveryPending {
+		t.Fatalf("ping: status = %d; location = %q; delivery = %+v", res.status, res.header.Get("Location"), ping)
+	}
+	createCamera(t, routes, `{"name":"ignored","mac_address":"ACCC8E000003","site_name":"NYC-5th-OPS"}`)
+	dispatch()
+	if got := receiver.Deliveries(); len(got) != 6 || got[5].Event != data.EventWebhookPing {
+		t.Errorf("receiver got %v; want only the ping since the update", eventTypes(got))
+	}
+	var delivered data.WebhookDelivery
+	do(t, routes, http.MethodGet, fmt.Sprintf("/v1/webhook-deliveries/%d", ping.ID), "", "X-User", "ana").decode(t, "delivery", &delivered)
+	if delivered.State != data.DeliveryDelivered || delivered.Attempts != 1 {
+		t.Errorf("ping delivery = %+v; want delivered", delivered)
+	}
+
+	// A delivery which runs out of attempts is a dead letter until it's redelivered.
+	dead := &data.WebhookDelivery{}
+	*dead = delivered
+	dead.State, dead.Attempts, dead.DeliveredAt, dead.NextAttemptAt = data.DeliveryDead, 8, nil, nil
+	if err := app.models.Webhooks.SaveAttempt(dead); err != nil {
+		t.Fatal(err)
+	}
+	var deliveries []data.WebhookDelivery
+	var metadata data.Metadata
+	res = do(t, routes, http.MethodGet, "/v1/webhook-deliveries?state=dead", "", "X-User", "ana")
+	res.decode(t, "deliveries", &deliveries)
+	res.decode(t, "metadata", &metadata)
+	if len(deliveries) != 1 || deliveries[0].ID != ping.ID || metadata.TotalRecords != 1 {
+		t.Errorf("dead letters = %+v; metadata = %+v", deliveries, metadata)
+	}
+	res = do(t, routes, http.MethodPost, fmt.Sprintf("/v1/webhook-deliveries/%d/redeliver", ping.ID), "", "X-User", "ana")
+	var redelivered data.WebhookDelivery
+	res.decode(t, "delivery", &redelivered)
+	if res.status != http.StatusAccepted || redelivered.State != data.DeliveryPending || redelivered.Attempts != 0 {
+		t.Errorf("redeliver: status = %d; delivery = %+v", res.status, redelivered)
+	}
+
+	// Newest first by default.
+	do(t, routes, http.MethodGet, fmt.Sprintf("/v1/webhook-deliveries?webhook_id=%d", webhook.ID), "", "X-User", "ana").decode(t, "deliveries", &deliveries)
+	if len(deliveries) != 6 || deliveries[0].ID != ping.ID {
+		t.Errorf("deliveries = %d, first %d; want 6, the ping first", len(deliveries), deliveries[0].ID)
+	}
+}
@@ -0,0 +1,391 @@
+package main
+
+import (
+	"context"
+	"encoding/csv"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/chefgoldbloom/pnctool/backend/pkg/client"
+)
+
+const camerasUsage = `Usage: pnc cameras <subcommand> [flags]
+
+Subcommands:
+  list              list cameras (--name, --mac, --model, --site, --status, --query, --search, --sort, --limit)
+  show ID           show a single camera
+  add               create a camera (--name, --mac, --site, --model, --address)
+  edit ID           change a camera (--name, --mac, --site, --model, --address)
+  delete ID         delete a camera
+  import FILE.csv   create a camera for each row (name,mac_address,site_name,model_no,address)
+
+Every subcommand accepts --profile, --url, --token, --user, --team and --output
+(table|json|csv). Adding, editing, deleting and importing cameras work without a
+user, but other parts of the API need one.
+`
+
+// connFlags are the flags shared by every subcommand that talks to the API.
+type connFlags struct {
+	profile string
+	url     string
+	token   string
+	user    string
+	team    string
+	output  string
+}
+
+func (c *cli) newFlagSet(name string) (*flag.FlagSet, *connFlags) {
+	fset := flag.NewFlagSet(name, flag.ContinueOnError)
+	fset.SetOutput(c.stderr)
+
+	var cf connFlags
+	fset.StringVar(&cf.profile, "profile", os.Getenv("PNC_PROFILE"), "config profile to use")
+	fset.StringVar(&cf.url, "url", os.Getenv("PNC_URL"), "API base URL (overrides the profile)")
+	fset.StringVar(&cf.token, "token", os.Getenv("PNC_TOKEN"), "bearer token (overrides the profile)")
+	fset.StringVar(&cf.user, "user", os.Getenv("PNC_USER"), "user to act as, sent as X-User (overrides the profile)")
+	fset.StringVar(&cf.team, "team", os.Getenv("PNC_TEAM"), "team to act for, sent as X-Team (overrides the profile)")
+	fset.StringVar(&cf.output, "output", "table", "output format: table, json or csv")
+	fset.StringVar(&cf.output, "o", "table", "shorthand for --output")
+	return fset, &cf
+}
+
+// client builds an API client from the selected profile, letting --url, --token,
+// --user and --team override it.
+func (c *cli) client(cf *connFlags) (*client.Client, error) {
+	cfg, err := loadConfig(c.configPath)
+	if err != nil {
+		return nil, err
+	}
+
+	name := cf.profile
+	if name == "" {
+		name = cfg.Current
+	}
+	p, ok := cfg.Profiles[name]
+	if name != "" && !ok && cf.url == "" {
+		return nil, fmt.Errorf("profile %q does not exist", name)
+	}
+	if cf.url != "" {
+		p.URL = cf.url
+	}
+	if cf.token != "" {
+		p.Token = cf.token
+	}
+	if cf.user != "" {
+		p.User = cf.user
+	}
+	if cf.team != "" {
+		p.Team = cf.team
+	}
+	if p.URL == "" {
+		p.URL = "http://localhost:4001"
+	}
+
+	opts := []client.Option{client.WithUserAgent("pnc")}
+	if p.Token != "" {
+		opts = append(opts, client.WithToken(p.Token))
+	}
+	if p.User != "" {
+		opts = append(opts, client.WithUser(p.User))
+	}
+	if p.Team != "" {
+		opts = append(opts, client.WithTeam(p.Team))
+	}
+	return client.New(p.URL, opts...)
+}
+
+// parseWithID parses fset from args and returns the single positional argument. Flags
+// may come before and after the positional argument, so both
+// "pnc cameras edit 12 --name x" and "pnc cameras edit --name x 12 -o json" work.
+func parseWithID(fset *flag.FlagSet, args []string) (string, error) {
+	// Parse stops at the first non-flag argument, so pick each one off and parse
+	// whatever follows it.
+	var positional []string
+	for {
+		if err := fset.Parse(args); err != nil {
+			return "", err
+		}
+		if fset.NArg() == 0 {
+			break
+		}
+		positional = append(positional, fset.Arg(0))
+		args = fset.Args()[1:]
+	}
+	switch len(positional) {
+	case 0:
+		return "", fmt.Errorf("%s: missing argument", fset.Name())
+	case 1:
+		return positional[0], nil
+	default:
+		return "", fmt.Errorf("%s: unexpected argument %q", fset.Name(), positional[1])
+	}
+}
+
+func parseCameraID(s string) (int64, error) {
+	id, err := strconv.ParseInt(s, 10, 64)
+	if err != nil || id < 1 {
+		return 0, fmt.Errorf("invalid camera id %q", s)
+	}
+	return id, nil
+}
+
+func (c *cli) cameras(ctx context.Context, args []string) error {
+	if len(args) == 0 {
+		fmt.Fprint(c.stderr, camerasUsage)
+		return errUsage
+	}
+
+	switch args[0] {
+	case "list", "ls":
+		return c.camerasList(ctx, args[1:])
+	case "show", "get":
+		return c.camerasShow(ctx, args[1:])
+	case "add", "create":
+		return c.camerasAdd(ctx, args[1:])
+	case "edit", "update":
+		return c.camerasEdit(ctx, args[1:])
+	case "delete", "rm":
+		return c.camerasDelete(ctx, args[1:])
+	case "import":
+		return c.camerasImport(ctx, args[1:])
+	default:
+		fmt.Fprintf(c.stderr, "pnc: unknown cameras subcommand %q\n\n%s", args[0], camerasUsage)
+		return errUsage
+	}
+}
+
+func (c *cli) camerasList(ctx context.Context, args []string) error {
+	fset, cf := c.newFlagSet("cameras list")
+	var opts client.ListOptions
+	fset.StringVar(&opts.Name, "name", "", "filter by exact name")
+	fset.StringVar(&opts.MacAddress, "mac", "", "filter by MAC address")
+	fset.StringVar(&opts.ModelNo, "model", "", "filter by model number")
+	fset.StringVar(&opts.SiteName, "site", "", "filter by site name")
+	fset.StringVar(&opts.Status, "status", "", "filter by last polled status (online|offline|unauthorized|unknown)")
+	fset.StringVar(&opts.Query, "query", "", "filter expression, e.g. 'model_no:P32* NOT status:online'")
+	fset.StringVar(&opts.Search, "search", "", "fuzzy search across name, site, model and MAC, best match first")
+	fset.StringVar(&opts.Sort, "sort", "", "sort field, prefix with - for descending")
+	limit := fset.Int("limit", 0, "maximum number of cameras to show (0 for all)")
+	if err := fset.Parse(args); err != nil {
+		return err
+	}
+
+	api, err := c.client(cf)
+	if err != nil {
+		return err
+	}
+
+	opts.PageSize = 100
+	var cameras []*client.Camera
+	it := api.Cameras(ctx, opts)
+	for it.Next() {
+		cameras = append(cameras, it.Camera())
+		if *limit > 0 && len(cameras) >= *limit {
+			break
+		}
+	}
+	if err := it.Err(); err != nil {
+		return err
+	}
+	return writeCameras(c.stdout, cf.output, cameras)
+}
+
+func (c *cli) camerasShow(ctx context.Context, args []string) error {
+	fset, cf := c.newFlagSet("cameras show")
+	arg, err := parseWithID(fset, args)
+	if err != nil {
+		return err
+	}
+	id, err := parseCameraID(arg)
+	if err != nil {
+		return err
+	}
+
+	api, err := c.client(cf)
+	if err != nil {
+		return err
+	}
+	camera, err := api.GetCamera(ctx, id)
+	if err != nil {
+		return err
+	}
+	return writeCameras(c.stdout, cf.output, []*client.Camera{camera})
+}
+
+func (c *cli) camerasAdd(ctx context.Context, args []string) error {
+	fset, cf := c.newFlagSet("cameras add")
+	var input client.CameraInput
+	fset.StringVar(&input.Name, "name", "", "camera name (required)")
+	fset.StringVar(&input.MacAddress, "mac", "", "12 character MAC address (required)")
+	fset.StringVar(&input.SiteName, "site", "", "site name, e.g. NYC-5th-OPS (required)")
+	fset.StringVar(&input.ModelNo, "model", "", "model number")
+	fset.StringVar(&input.Address, "address", "", "host, host:port or URL of the camera's management API")
+	if err := fset.Parse(args); err != nil {
+		return err
+	}
+
+	api, err := c.client(cf)
+	if err != nil {
+		return err
+	}
+	camera, err := api.CreateCamera(ctx, input)
+	if err != nil {
+		return err
+	}
+	return writeCameras(c.stdout, cf.output, []*client.Camera{camera})
+}
+
+func (c *cli) camerasEdit(ctx context.Context, args []string) error {
+	fset, cf := c.newFlagSet("cameras edit")
+	name := fset.String("name", "", "new camera name")
+	mac := fset.String("mac", "", "new MAC address")
+	site := fset.String("site", "", "new site name")
+	model := fset.String("model", "", "new model number")
+	address := fset.String("address", "", "new management address")
+	arg, err := parseWithID(fset, args)
+	if err != nil {
+		return err
+	}
+	id, err := parseCameraID(arg)
+	if err != nil {
+		return err
+	}
+
+	// Only send the flags which were actually given, so "--model ''" can clear a
+	// value while an omitted flag leaves it alone.
+	var patch client.CameraPatch
+	fset.Visit(func(f *flag.Flag) {
+		switch f.Name {
+		case "name":
+			patch.Name = name
+		case "mac":
+			patch.MacAddress = mac
+		case "site":
+			patch.SiteName = site
+		case "model":
+			patch.ModelNo = model
+		case "address":
+			patch.Address = address
+		}
+	})
+
+	api, err := c.client(cf)
+	if err != nil {
+		return err
+	}
+	camera, err := api.UpdateCamera(ctx, id, patch)
+	if err != nil {
+		return err
+	}
+	return writeCameras(c.stdout, cf.output, []*client.Camera{camera})
+}
+
+func (c *cli) camerasDelete(ctx context.Context, args []string) error {
+	fset, cf := c.newFlagSet("cameras delete")
+	arg, err := parseWithID(fset, args)
+	if err != nil {
+		return err
+	}
+	id, err := parseCameraID(arg)
+	if err != nil {
+		return err
+	}
+
+	api, err := c.client(cf)
+	if err != nil {
+		return err
+	}
+	if err := api.DeleteCamera(ctx, id); err != nil {
+		return err
+	}
+	fmt.Fprintf(c.stderr, "camera %d deleted\n", id)
+	return nil
+}
+
+// camerasImport creates one camera per CSV row. The first row must be a header naming
+// the columns; unknown columns are an error so typos don't silently drop data. Rows
+// which fail are reported and skipped, and the command fails if any row failed.
+func (c *cli) camerasImport(ctx context.Context, args []string) error {
+	fset, cf := c.newFlagSet("cameras import")
+	arg, err := parseWithID(fset, args)
+	if err != nil {
+		return err
+	}
+
+	var in io.Reader = os.Stdin
+	if arg != "-" {
+		f, err := os.Open(arg)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		in = f
+	}
+
+	api, err := c.client(cf)
+	if err != nil {
+		return err
+	}
+
+	r := csv.NewReader(in)
+	r.TrimLeadingSpace = true
+	header, err := r.Read()
+	if err != nil {
+		return fmt.Errorf("reading CSV header: %w", err)
+	}
+	cols := map[string]int{}
+	for i, h := range header {
+		h = strings.ToLower(strings.TrimSpace(h))
+		switch h {
+		case "name", "mac_address", "site_name", "model_no", "address":
+			cols[h] = i
+		default:
+			return fmt.Errorf("unknown CSV column %q", h)
+		}
+	}
+	field := func(rec []string, name string) string {
+		if i, ok := cols[name]; ok && i < len(rec) {
+			return strings.TrimSpace(rec[i])
+		}
+		return ""
+	}
+
+	var created []*client.Camera
+	failed := 0
+	for line := 2; ; line++ {
+		rec, err := r.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return err
+		}
+
+		camera, err := api.CreateCamera(ctx, client.CameraInput{
+			Name:       field(rec, "name"),
+			MacAddress: field(rec, "mac_address"),
+			SiteName:   field(rec, "site_name"),
+			ModelNo:    field(rec, "model_no"),
+			Address:    field(rec, "address"),
+		})
+		if err != nil {
+			failed++
+			fmt.Fprintf(c.stderr, "line %d: %v\n", line, err)
+			continue
+		}
+		created = append(created, camera)
+	}
+
+	if err := writeCameras(c.stdout, cf.output, created); err != nil {
+		return err
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d of %d rows failed to import", failed, failed+len(created))
+	}
+	return nil
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"flag"
+	"io"
+	"testing"
+)
+
+func TestParseWithID(t *testing.T) {
+	tests := []struct {
+		name string
+		args []string
+		id   string
+		flag string
+		err  bool
+	}{
+		{"id first", []string{"12", "--name", "x"}, "12", "x", false},
+		{"id last", []string{"--name", "x", "12"}, "12", "x", false},
+		{"id between flags", []string{"--output", "json", "12", "--name", "x"}, "12", "x", false},
+		{"id only", []string{"12"}, "12", "", false},
+		{"missing", []string{"--name", "x"}, "", "", true},
+		{"none", nil, "", "", true},
+		{"two ids", []string{"12", "--name", "x", "13"}, "", "", true},
+		{"unknown flag", []string{"12", "--colour", "red"}, "", "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fset := flag.NewFlagSet("cameras edit", flag.ContinueOnError)
+			fset.SetOutput(io.Discard)
+			name := fset.String("name", "", "")
+			fset.String("output", "", "")
+
+			id, err := parseWithID(fset, tt.args)
+			if tt.err {
+				if err == nil {
+					t.Fatalf("parseWithID(%q) = %q; want an error", tt.args, id)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if id != tt.id || *name != tt.flag {
+				t.Errorf("parseWithID(%q) = %q, --name %q; want %q, %q", tt.args, id, *name, tt.id, tt.flag)
+			}
+		})
+	}
+}
+
+func TestParseCameraID(t *testing.T) {
+	if id, err := parseCameraID("12"); err != nil || id != 12 {
+		t.Errorf("parseCameraID(12) = %d, %v", id, err)
+	}
+	for _, s := range []string{"0", "-1", "twelve", ""} {
+		if _, err := parseCameraID(s); err == nil {
+			t.Errorf("parseCameraID(%q): want an error", s)
+		}
+	}
+}
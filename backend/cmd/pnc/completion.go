@@ -0,0 +1,110 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+)
+
+const bashCompletion = `# bash completion for pnc. Load with: source <(pnc completion bash)
+_pnc() {
+	local cur prev words cword
+	_init_completion 2>/dev/null || {
+		cur="${COMP_WORDS[COMP_CWORD]}"
+		prev="${COMP_WORDS[COMP_CWORD-1]}"
+		words=("${COMP_WORDS[@]}")
+		cword=$COMP_CWORD
+	}
+
+	case "$prev" in
+	--output|-o)
+		COMPREPLY=($(compgen -W "table json csv" -- "$cur"))
+		return
+		;;
+	--profile)
+		COMPREPLY=($(compgen -W "$(pnc profile list 2>/dev/null | awk 'NR>1 {print ($1 == "*") ? $2 : $1}')" -- "$cur"))
+		return
+		;;
+	import)
+		COMPREPLY=($(compgen -f -- "$cur"))
+		return
+		;;
+	esac
+
+	case "$cword" in
+	1)
+		COMPREPLY=($(compgen -W "cameras profile completion help" -- "$cur"))
+		;;
+	2)
+		case "${words[1]}" in
+		cameras) COMPREPLY=($(compgen -W "list show add edit delete import" -- "$cur")) ;;
+		profile) COMPREPLY=($(compgen -W "list add use remove" -- "$cur")) ;;
+		completion) COMPREPLY=($(compgen -W "bash zsh" -- "$cur")) ;;
+		esac
+		;;
+	*)
+		case "${words[1]}" in
+		cameras) COMPREPLY=($(compgen -W "--profile --url --token --user --team --output --name --mac --site --model --address --status --query --search --sort --limit" -- "$cur")) ;;
+		profile) COMPREPLY=($(compgen -W "--url --token --user --team" -- "$cur")) ;;
+		esac
+		;;
+	esac
+}
+complete -F _pnc pnc
+`
+
+const zshCompletion = `#compdef pnc
+# zsh completion for pnc. Load with: source <(pnc completion zsh)
+_pnc() {
+	local -a commands
+	case $CURRENT in
+	2)
+		commands=(cameras profile completion help)
+		_describe 'command' commands
+		;;
+	3)
+		case $words[2] in
+		cameras) commands=(list show add edit delete import) ;;
+		profile) commands=(list add use remove) ;;
+		completion) commands=(bash zsh) ;;
+		esac
+		_describe 'subcommand' commands
+		;;
+	*)
+		_arguments \
+			'--profile[config profile]:profile:' \
+			'--url[API base URL]:url:' \
+			'--token[bearer token]:token:' \
+			'--user[user to act as]:user:' \
+			'--team[team to act for]:team:' \
+			'--output[output format]:format:(table json csv)' \
+			'--name[camera name]:name:' \
+			'--mac[MAC address]:mac:' \
+			'--site[site name]:site:' \
+			'--model[model number]:model:' \
+			'--address[management address]:address:' \
+			'--status[polled status]:status:(online offline unauthorized unknown)' \
+			'--query[filter expression]:query:' \
+			'--search[fuzzy search]:search:' \
+			'--sort[sort field]:sort:' \
+			'--limit[maximum results]:limit:' \
+			'*:file:_files'
+		;;
+	esac
+}
+compdef _pnc pnc
+`
+
+func (c *cli) completion(args []string) error {
+	if len(args) != 1 {
+		return errors.New("completion: expected a shell name (bash or zsh)")
+	}
+	switch args[0] {
+	case "bash":
+		fmt.Fprint(c.stdout, bashCompletion)
+	case "zsh":
+		fmt.Fprint(c.stdout, zshCompletion)
+	default:
+		return fmt.Errorf("completion: unsupported shell %q", args[0])
+	}
+	return nil
+}
@@ -0,0 +1,150 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"text/tabwriter"
+)
+
+// Profile is a named API server, the token used to talk to it, and the user and
+// team the server is told requests come from.
+type Profile struct {
+	URL   string `json:"url"`
+	Token string `json:"token,omitempty"`
+	User  string `json:"user,omitempty"`
+	Team  string `json:"team,omitempty"`
+}
+
+// Config is the on-disk configuration file. It holds tokens, so it is written with
+// 0600 permissions.
+type Config struct {
+	Current  string             `json:"current"`
+	Profiles map[string]Profile `json:"profiles"`
+}
+
+// defaultConfigPath returns $PNC_CONFIG, or pnc/config.json in the user's config
+// directory.
+func defaultConfigPath() (string, error) {
+	if p := os.Getenv("PNC_CONFIG"); p != "" {
+		return p, nil
+	}
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "pnc", "config.json"), nil
+}
+
+// loadConfig reads the config file. A missing file is not an error and yields an
+// empty config.
+func loadConfig(path string) (*Config, error) {
+	cfg := &Config{Profiles: map[string]Profile{}}
+
+	b, err := os.ReadFile(path)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return cfg, nil
+		}
+		return nil, err
+	}
+	if err := json.Unmarshal(b, cfg); err != nil {
+		return nil, fmt.Errorf("reading %s: %w", path, err)
+	}
+	if cfg.Profiles == nil {
+		cfg.Profiles = map[string]Profile{}
+	}
+	return cfg, nil
+}
+
+func (cfg *Config) save(path string) error {
+	b, err := json.MarshalIndent(cfg, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(b, '\n'), 0o600)
+}
+
+func (c *cli) profile(args []string) error {
+	if len(args) == 0 {
+		fmt.Fprintln(c.stderr, "Usage: pnc profile (list | add NAME --url URL [--token TOKEN] [--user USER] [--team TEAM] | use NAME | remove NAME)")
+		return errUsage
+	}
+
+	cfg, err := loadConfig(c.configPath)
+	if err != nil {
+		return err
+	}
+
+	switch args[0] {
+	case "list", "ls":
+		names := make([]string, 0, len(cfg.Profiles))
+		for name := range cfg.Profiles {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+
+		tw := tabwriter.NewWriter(c.stdout, 0, 8, 2, ' ', 0)
+		fmt.Fprintln(tw, "CURRENT\tNAME\tUSER\tURL")
+		for _, name := range names {
+			current := ""
+			if name == cfg.Current {
+				current = "*"
+			}
+			p := cfg.Profiles[name]
+			fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", current, name, p.User, p.URL)
+		}
+		return tw.Flush()
+
+	case "add", "set":
+		fset := flag.NewFlagSet("profile add", flag.ContinueOnError)
+		fset.SetOutput(c.stderr)
+		url := fset.String("url", "", "API base URL, e.g. http://localhost:4001")
+		token := fset.String("token", "", "bearer token")
+		user := fset.String("user", "", "user to act as, sent as X-User")
+		team := fset.String("team", "", "team to act for, sent as X-Team")
+		name, err := parseWithID(fset, args[1:])
+		if err != nil {
+			return err
+		}
+		if *url == "" {
+			return errors.New("profile add: --url is required")
+		}
+		cfg.Profiles[name] = Profile{URL: *url, Token: *token, User: *user, Team: *team}
+		if cfg.Current == "" {
+			cfg.Current = name
+		}
+		return cfg.save(c.configPath)
+
+	case "use":
+		if len(args) != 2 {
+			return errors.New("profile use: expected a profile name")
+		}
+		if _, ok := cfg.Profiles[args[1]]; !ok {
+			return fmt.Errorf("profile %q does not exist", args[1])
+		}
+		cfg.Current = args[1]
+		return cfg.save(c.configPath)
+
+	case "remove", "rm":
+		if len(args) != 2 {
+			return errors.New("profile remove: expected a profile name")
+		}
+		delete(cfg.Profiles, args[1])
+		if cfg.Current == args[1] {
+			cfg.Current = ""
+		}
+		return cfg.save(c.configPath)
+
+	default:
+		return fmt.Errorf("profile: unknown subcommand %q", args[0])
+	}
+}
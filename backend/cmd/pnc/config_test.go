@@ -0,0 +1,154 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+// newTestCLI returns a cli writing to buffers, with its config file in a temporary
+// directory which doesn't exist yet.
+func newTestCLI(t *testing.T) (*cli, *bytes.Buffer, *bytes.Buffer) {
+	t.Helper()
+
+	var stdout, stderr bytes.Buffer
+	c := &cli{
+		stdout:     &stdout,
+		stderr:     &stderr,
+		configPath: filepath.Join(t.TempDir(), "pnc", "config.json"),
+	}
+	return c, &stdout, &stderr
+}
+
+func TestConfigSaveLoad(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "pnc", "config.json")
+
+	// A missing file is an empty config.
+	cfg, err := loadConfig(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Current != "" || cfg.Profiles == nil || len(cfg.Profiles) != 0 {
+		t.Fatalf("missing config = %+v", cfg)
+	}
+
+	cfg.Current = "prod"
+	cfg.Profiles["prod"] = Profile{URL: "https://pnc.example.internal", Token: "s3cret"}
+	if err := cfg.save(path); err != nil {
+		t.Fatal(err)
+	}
+
+	// The file holds tokens, so only the owner may read it.
+	if runtime.GOOS != "windows" {
+		info, err := os.Stat(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if perm := info.Mode().Perm(); perm != 0o600 {
+			t.Errorf("config permissions = %o; want 600", perm)
+		}
+	}
+
+	got, err := loadConfig(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Current != "prod" || got.Profiles["prod"] != cfg.Profiles["prod"] {
+		t.Errorf("loaded config = %+v; want %+v", got, cfg)
+	}
+
+	if err := os.WriteFile(path, []byte("{"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := loadConfig(path); err == nil || !strings.Contains(err.Error(), path) {
+		t.Errorf("corrupt config: err = %v; want one naming the file", err)
+	}
+}
+
+func TestProfileCommands(t *testing.T) {
+	c, stdout, _ := newTestCLI(t)
+	ctx := context.Background()
+
+	for _, args := range [][]string{
+		{"profile", "add", "dev", "--url", "http://localhost:4001"},
+		{"profile", "add", "--url", "https://pnc.example.internal", "--token", "s3cret", "prod", "--user", "ana", "--team", "east"},
+		{"profile", "use", "prod"},
+	} {
+		if err := c.run(ctx, args); err != nil {
+			t.Fatalf("%v: %v", args, err)
+		}
+	}
+
+	cfg, err := loadConfig(c.configPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Current != "prod" || cfg.Profiles["prod"] != (Profile{URL: "https://pnc.example.internal", Token: "s3cret", User: "ana", Team: "east"}) || cfg.Profiles["dev"].URL != "http://localhost:4001" {
+		t.Errorf("config = %+v", cfg)
+	}
+
+	if err := c.run(ctx, []string{"profile", "list"}); err != nil {
+		t.Fatal(err)
+	}
+	want := "CURRENT  NAME  USER  URL\n         dev         http://localhost:4001\n*        prod  ana   https://pnc.example.internal\n"
+	if stdout.String() != want {
+		t.Errorf("profile list =\n%s\nwant\n%s", stdout, want)
+	}
+
+	tests := []struct {
+		args []string
+		err  string
+	}{
+		{[]string{"profile", "add", "staging"}, "--url is required"},
+		{[]string{"profile", "use", "staging"}, `profile "staging" does not exist`},
+		{[]string{"profile", "rename", "dev"}, "unknown subcommand"},
+	}
+	for _, tt := range tests {
+		if err := c.run(ctx, tt.args); err == nil || !strings.Contains(err.Error(), tt.err) {
+			t.Errorf("%v: err = %v; want %q", tt.args, err, tt.err)
+		}
+	}
+
+	// Removing the current profile leaves none selected.
+	if err := c.run(ctx, []string{"profile", "remove", "prod"}); err != nil {
+		t.Fatal(err)
+	}
+	cfg, _ = loadConfig(c.configPath)
+	if _, ok := cfg.Profiles["prod"]; ok || cfg.Current != "" {
+		t.Errorf("config after remove = %+v", cfg)
+	}
+}
+
+// The profile's user and team go with every request, unless overridden by flags.
+func TestProfileIdentity(t *testing.T) {
+	var got []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = append(got, r.Header.Get("X-User")+"/"+r.Header.Get("X-Team"))
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"cameras":[],"metadata":{}}`))
+	}))
+	defer srv.Close()
+
+	t.Setenv("PNC_USER", "")
+	t.Setenv("PNC_TEAM", "")
+	c, _, _ := newTestCLI(t)
+	ctx := context.Background()
+	for _, args := range [][]string{
+		{"profile", "add", "test", "--url", srv.URL, "--user", "ana", "--team", "east"},
+		{"cameras", "list"},
+		{"cameras", "list", "--user", "ben"},
+	} {
+		if err := c.run(ctx, args); err != nil {
+			t.Fatalf("%v: %v", args, err)
+		}
+	}
+	if want := []string{"ana/east", "ben/east"}; strings.Join(got, " ") != strings.Join(want, " ") {
+		t.Errorf("identities sent = %v; want %v", got, want)
+	}
+}
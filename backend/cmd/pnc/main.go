@@ -0,0 +1,87 @@
+// Command pnc is a command-line client for the pnctool camera API.
+//
+//	pnc cameras list --site NYC-5th-OPS
+//	pnc cameras add --name lobby-east --mac ACCC8E000001 --site NYC-5th-OPS
+//	pnc cameras edit 12 --name lobby-west
+//	pnc cameras import cameras.csv
+//	pnc profile add prod --url https://pnc.example.internal --token ... --user ana
+//	pnc completion bash
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+)
+
+const usage = `Usage: pnc <command> [arguments]
+
+Commands:
+  cameras     list, show, add, edit, delete and import cameras
+  profile     manage server profiles (list, add, use, remove)
+  completion  print a shell completion script (bash, zsh)
+  help        show this help
+
+Run "pnc <command> -h" for the flags each command accepts.
+`
+
+// errUsage is returned by commands which were invoked incorrectly. The usage text has
+// already been printed, so main only needs to set the exit status.
+var errUsage = errors.New("usage")
+
+// cli holds the streams and config location used by every command, so commands can
+// be exercised without touching the real terminal or home directory.
+type cli struct {
+	stdout     io.Writer
+	stderr     io.Writer
+	configPath string
+}
+
+func main() {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	configPath, err := defaultConfigPath()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "pnc:", err)
+		os.Exit(1)
+	}
+
+	c := &cli{stdout: os.Stdout, stderr: os.Stderr, configPath: configPath}
+
+	err = c.run(ctx, os.Args[1:])
+	switch {
+	case err == nil:
+	case errors.Is(err, errUsage), errors.Is(err, flag.ErrHelp):
+		os.Exit(2)
+	default:
+		fmt.Fprintln(os.Stderr, "pnc:", err)
+		os.Exit(1)
+	}
+}
+
+func (c *cli) run(ctx context.Context, args []string) error {
+	if len(args) == 0 {
+		fmt.Fprint(c.stderr, usage)
+		return errUsage
+	}
+
+	switch args[0] {
+	case "cameras", "camera":
+		return c.cameras(ctx, args[1:])
+	case "profile", "profiles":
+		return c.profile(args[1:])
+	case "completion":
+		return c.completion(args[1:])
+	case "help", "-h", "--help":
+		fmt.Fprint(c.stdout, usage)
+		return nil
+	default:
+		fmt.Fprintf(c.stderr, "pnc: unknown command %q\n\n%s", args[0], usage)
+		return errUsage
+	}
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"text/tabwriter"
+	"time"
+
+	"github.com/chefgoldbloom/pnctool/backend/pkg/client"
+)
+
+var cameraColumns = []string{"id", "name", "mac_address", "site_name", "model_no", "version", "created_at"}
+
+func cameraRow(c *client.Camera) []string {
+	return []string{
+		strconv.FormatInt(c.ID, 10),
+		c.Name,
+		c.MacAddress,
+		c.SiteName,
+		c.ModelNo,
+		strconv.Itoa(int(c.Version)),
+		c.CreatedAt.Format(time.RFC3339),
+	}
+}
+
+// writeCameras renders cameras as an aligned table, a JSON array or CSV with a header
+// row.
+func writeCameras(w io.Writer, format string, cameras []*client.Camera) error {
+	switch format {
+	case "json":
+		if cameras == nil {
+			cameras = []*client.Camera{}
+		}
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(cameras)
+
+	case "csv":
+		cw := csv.NewWriter(w)
+		cw.Write(cameraColumns)
+		for _, c := range cameras {
+			cw.Write(cameraRow(c))
+		}
+		cw.Flush()
+		return cw.Error()
+
+	case "table", "":
+		tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+		fmt.Fprintln(tw, "ID\tNAME\tMAC\tSITE\tMODEL\tVERSION")
+		for _, c := range cameras {
+			fmt.Fprintf(tw, "%d\t%s\t%s\t%s\t%s\t%d\n", c.ID, c.Name, c.MacAddress, c.SiteName, c.ModelNo, c.Version)
+		}
+		return tw.Flush()
+
+	default:
+		return fmt.Errorf("unknown output format %q (want table, json or csv)", format)
+	}
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/chefgoldbloom/pnctool/backend/pkg/client"
+)
+
+func TestWriteCameras(t *testing.T) {
+	created := time.Date(2026, 3, 2, 9, 0, 0, 0, time.UTC)
+	cameras := []*client.Camera{
+		{ID: 1, CreatedAt: created, Name: "lobby-east", MacAddress: "ACCC8E000001", SiteName: "NYC-5th-OPS", ModelNo: "P3245", Version: 2},
+		{ID: 12, CreatedAt: created, Name: "dock, rear", MacAddress: "ACCC8E000002", SiteName: "BOS-Main-GLH", Version: 1},
+	}
+
+	tests := []struct {
+		format string
+		want   string
+	}{
+		{"table", "ID  NAME        MAC           SITE          MODEL  VERSION\n" +
+			"1   lobby-east  ACCC8E000001  NYC-5th-OPS   P3245  2\n" +
+			"12  dock, rear  ACCC8E000002  BOS-Main-GLH         1\n"},
+		{"csv", "id,name,mac_address,site_name,model_no,version,created_at\n" +
+			"1,lobby-east,ACCC8E000001,NYC-5th-OPS,P3245,2,2026-03-02T09:00:00Z\n" +
+			"12,\"dock, rear\",ACCC8E000002,BOS-Main-GLH,,1,2026-03-02T09:00:00Z\n"},
+	}
+	for _, tt := range tests {
+		var buf bytes.Buffer
+		if err := writeCameras(&buf, tt.format, cameras); err != nil {
+			t.Fatal(err)
+		}
+		if buf.String() != tt.want {
+			t.Errorf("%s output =\n%s\nwant\n%s", tt.format, buf.String(), tt.want)
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := writeCameras(&buf, "json", cameras); err != nil {
+		t.Fatal(err)
+	}
+	var got []*client.Camera
+	if err := json.Unmarshal(buf.Bytes(), &got); err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 2 || *got[1] != *cameras[1] {
+		t.Errorf("json output = %s", buf.String())
+	}
+
+	// No cameras is an empty array rather than null, so scripts can always iterate.
+	buf.Reset()
+	if err := writeCameras(&buf, "json", nil); err != nil || strings.TrimSpace(buf.String()) != "[]" {
+		t.Errorf("empty json output = %q, %v", buf.String(), err)
+	}
+
+	if err := writeCameras(&buf, "yaml", cameras); err == nil {
+		t.Error("unknown format: want an error")
+	}
+}
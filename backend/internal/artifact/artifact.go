@@ -0,0 +1,101 @@
+// Package artifact keeps uploaded files, such as firmware images, on local disk.
+//
+// Files are stored under the hex SHA-256 digest of their contents, so the same
+// file uploaded twice is only stored once, and a file read back can be trusted to be
+// the one that was uploaded. A file is written to a temporary name first and only
+// renamed into place once it's complete, so a failed or interrupted upload never
+// leaves a partial file where a reader could find it.
+package artifact
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+)
+
+// ErrNotFound is returned for a digest the store has no file for.
+var ErrNotFound = errors.New("artifact not found")
+
+var digestRxp = regexp.MustCompile(`^[0-9a-f]{64}$`)
+
+// Store is a directory of files named by their digest. It's safe for concurrent use,
+// including by several processes sharing the directory.
+type Store struct {
+	dir string
+}
+
+// NewStore returns a Store keeping its files in dir, creating it if need be.
+func NewStore(dir string) (*Store, error) {
+	if err := os.MkdirAll(dir, 0o750); err != nil {
+		return nil, err
+	}
+	return &Store{dir: dir}, nil
+}
+
+// Put stores the contents of r and returns their digest and size.
+func (s *Store) Put(r io.Reader) (digest string, size int64, err error) {
+	tmp, err := os.CreateTemp(s.dir, ".upload-*")
+	if err != nil {
+		return "", 0, err
+	}
+	defer func() {
+		if err != nil {
+			tmp.Close()
+			os.Remove(tmp.Name())
+		}
+	}()
+
+	hash := sha256.New()
+	size, err = io.Copy(io.MultiWriter(tmp, hash), r)
+	if err != nil {
+		return "", 0, err
+	}
+	if err = tmp.Sync(); err != nil {
+		return "", 0, err
+	}
+	if err = tmp.Close(); err != nil {
+		return "", 0, err
+	}
+
+	// Renaming over a file with the same digest replaces it with identical
+	// contents, so there's no need to check whether it's already stored.
+	digest = hex.EncodeToString(hash.Sum(nil))
+	if err = os.Rename(tmp.Name(), s.path(digest)); err != nil {
+		return "", 0, err
+	}
+	return digest, size, nil
+}
+
+// Open returns the file with the given digest for reading.
+func (s *Store) Open(digest string) (io.ReadCloser, error) {
+	if !digestRxp.MatchString(digest) {
+		return nil, fmt.Errorf("%w: invalid digest %q", ErrNotFound, digest)
+	}
+	f, err := os.Open(s.path(digest))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("%w: %s", ErrNotFound, digest)
+	}
+	return f, err
+}
+
+// Remove deletes the file with the given digest. Removing a file which isn't there
+// isn't an error.
+func (s *Store) Remove(digest string) error {
+	if !digestRxp.MatchString(digest) {
+		return fmt.Errorf("%w: invalid digest %q", ErrNotFound, digest)
+	}
+	err := os.Remove(s.path(digest))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	return err
+}
+
+func (s *Store) path(digest string) string {
+	return filepath.Join(s.dir, digest)
+}
@@ -0,0 +1,57 @@
+package artifact
+
+import (
+	"errors"
+	"io"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestStore(t *testing.T) {
+	dir := t.TempDir()
+	s, err := NewStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	digest, size, err := s.Put(strings.NewReader("11.1.66"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if digest != "26401c69441d733f19a0fc094933d907d3b17300a3d10fb32e3a9b8c1997d5d2" || size != 7 {
+		t.Errorf("Put = %s, %d", digest, size)
+	}
+
+	// Storing the same contents again gives the same file.
+	again, _, err := s.Put(strings.NewReader("11.1.66"))
+	if err != nil || again != digest {
+		t.Errorf("second Put = %s, %v; want %s", again, err, digest)
+	}
+	entries, _ := os.ReadDir(dir)
+	if len(entries) != 1 {
+		t.Errorf("store holds %d files; want one, and no temporary files", len(entries))
+	}
+
+	f, err := s.Open(digest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	contents, _ := io.ReadAll(f)
+	f.Close()
+	if string(contents) != "11.1.66" {
+		t.Errorf("Open read %q", contents)
+	}
+
+	if err := s.Remove(digest); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Remove(digest); err != nil {
+		t.Errorf("removing a missing file = %v; want nil", err)
+	}
+	for _, digest := range []string{digest, "../../etc/passwd"} {
+		if _, err := s.Open(digest); !errors.Is(err, ErrNotFound) {
+			t.Errorf("Open(%q) = %v; want ErrNotFound", digest, err)
+		}
+	}
+}
@@ -0,0 +1,240 @@
+package data
+
+import (
+	"math"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/chefgoldbloom/pnctool/backend/internal/validator"
+)
+
+// MaxReportDays is the longest period an availability report can cover.
+const MaxReportDays = 366
+
+// DefaultAvailabilityTarget is the availability, in percent, contracts require.
+const DefaultAvailabilityTarget = 99.5
+
+// AvailabilityReport is the availability of cameras, and of the sites they're at, over
+// a period. To is exclusive.
+type AvailabilityReport struct {
+	From    time.Time            `json:"from"`
+	To      time.Time            `json:"to"`
+	Target  float64              `json:"target"`
+	Sites   []SiteAvailability   `json:"sites"`
+	Cameras []CameraAvailability `json:"cameras"`
+}
+
+// AvailabilityStats is how long cameras were up and down over a report's period.
+//
+// Cameras which answer the poller are up, even if they reject its credentials, and
+// cameras which don't are down. Time before a camera was first polled is unknown,
+// and time in a maintenance window is maintenance; neither counts towards
+// availability, which is the percentage of the remaining time the camera was up. It
+// is null if none remains. An outage is a stretch of downtime outside maintenance;
+// the time to recovery of those which ended in the period is averaged into MTTR,
+// including any part before the period or in maintenance.
+type AvailabilityStats struct {
+	Availability       *float64 `json:"availability"`
+	MeetsTarget        *bool    `json:"meets_target"`
+	UpSeconds          int64    `json:"up_seconds"`
+	DownSeconds        int64    `json:"down_seconds"`
+	UnknownSeconds     int64    `json:"unknown_seconds"`
+	MaintenanceSeconds int64    `json:"maintenance_seconds"`
+	Outages            int      `json:"outages"`
+	MTTRSeconds        *float64 `json:"mttr_seconds"`
+
+	up, down, unknown, maintenance time.Duration
+	recovered                      int
+	recovery                       time.Duration
+}
+
+// CameraAvailability is the availability of one camera.
+type CameraAvailability struct {
+	CameraID int64  `json:"camera_id"`
+	Name     string `json:"name"`
+	SiteName string `json:"site_name"`
+	AvailabilityStats
+}
+
+// SiteAvailability is the availability of all the cameras at a site together.
+type SiteAvailability struct {
+	SiteName string `json:"site_name"`
+	Cameras  int    `json:"cameras"`
+	AvailabilityStats
+}
+
+func ValidateAvailabilityReport(v *validator.Validator, from, to time.Time, target float64) {
+	v.CheckCode(to.After(from), "to", validator.CodeOutOfRange, "must not be before from")
+	v.CheckCode(to.Sub(from) <= MaxReportDays*24*time.Hour, "to", validator.CodeOutOfRange, "must be at most 366 days after from")
+	v.CheckCode(target >= 0 && target <= 100, "target", validator.CodeOutOfRange, "must be between 0 and 100")
+}
+
+// NewAvailabilityReport works out the availability of each camera in histories
+// between from and to, leaving out the time in windows. Only time up to now is
+// measured, so a report for the current month covers the month so far.
+func NewAvailabilityReport(histories []CameraHistory, windows []*MaintenanceWindow, from, to, now time.Time, target float64) *AvailabilityReport {
+	report := &AvailabilityReport{From: from, To: to, Target: target, Sites: []SiteAvailability{}, Cameras: []CameraAvailability{}}
+	end := to
+	if now.Before(end) {
+		end = now
+	}
+
+	sites := map[string]*SiteAvailability{}
+	for _, h := range histories {
+		camera := CameraAvailability{CameraID: h.CameraID, Name: h.Name, SiteName: h.SiteName}
+		camera.measure(h.Changes, maintenanceAt(windows, h.SiteName, from, end), from, end)
+		camera.finish(target)
+		report.Cameras = append(report.Cameras, camera)
+
+		key := strings.ToLower(h.SiteName)
+		site, ok := sites[key]
+		if !ok {
+			site = &SiteAvailability{SiteName: h.SiteName}
+			sites[key] = site
+		}
+		site.Cameras++
+		site.add(&camera.AvailabilityStats)
+	}
+
+	for _, site := range sites {
+		site.finish(target)
+		report.Sites = append(report.Sites, *site)
+	}
+	slices.SortFunc(report.Sites, func(a, b SiteAvailability) int { return strings.Compare(a.SiteName, b.SiteName) })
+	slices.SortStableFunc(report.Cameras, func(a, b CameraAvailability) int { return strings.Compare(a.SiteName, b.SiteName) })
+	return report
+}
+
+// span is a period of time, end exclusive.
+type span struct {
+	start, end time.Time
+}
+
+// maintenanceAt returns the windows applying to site, clipped to from and end,
+// merged and in order.
+func maintenanceAt(windows []*MaintenanceWindow, site string, from, end time.Time) []span {
+	var spans []span
+	for _, w := range windows {
+		if !w.AppliesTo(site) {
+			continue
+		}
+		s := span{start: maxTime(w.StartsAt, from), end: minTime(w.EndsAt, end)}
+		if s.end.After(s.start) {
+			spans = append(spans, s)
+		}
+	}
+	slices.SortFunc(spans, func(a, b span) int { return a.start.Compare(b.start) })
+
+	var merged []span
+	for _, s := range spans {
+		if n := len(merged); n > 0 && !s.start.After(merged[n-1].end) {
+			merged[n-1].end = maxTime(merged[n-1].end, s.end)
+			continue
+		}
+		merged = append(merged, s)
+	}
+	return merged
+}
+
+// overlap returns how much of s falls in the maintenance spans.
+func overlap(s span, maintenance []span) time.Duration {
+	var d time.Duration
+	for _, m := range maintenance {
+		start, end := maxTime(s.start, m.start), minTime(s.end, m.end)
+		if end.After(start) {
+			d += end.Sub(start)
+		}
+	}
+	return d
+}
+
+// measure adds up the time spent in each status between from and end. changes may
+// start with the last change before from, which gives the status at from.
+func (a *AvailabilityStats) measure(changes []StatusChange, maintenance []span, from, end time.Time) {
+	status, since := StatusUnknown, from
+	var outageStart time.Time
+	var outageCounted bool
+
+	// add accounts for the time from since to t in the current status.
+	add := func(t time.Time) {
+		s := span{start: maxTime(since, from), end: minTime(t, end)}
+		if !s.end.After(s.start) {
+			return
+		}
+		inMaintenance := overlap(s, maintenance)
+		counted := s.end.Sub(s.start) - inMaintenance
+		a.maintenance += inMaintenance
+		switch status {
+		case StatusOnline, StatusUnauthorized:
+			a.up += counted
+		case StatusOffline:
+			a.down += counted
+			if counted > 0 && !outageCounted {
+				a.Outages++
+				outageCounted = true
+			}
+		default:
+			a.unknown += counted
+		}
+	}
+
+	for _, change := range changes {
+		if change.Status == status {
+			continue
+		}
+		add(change.ChangedAt)
+		if status == StatusOffline && outageCounted && change.ChangedAt.Before(end) {
+			a.recovered++
+			a.recovery += change.ChangedAt.Sub(outageStart)
+		}
+		if change.Status == StatusOffline {
+			outageStart, outageCounted = change.ChangedAt, false
+		}
+		status, since = change.Status, change.ChangedAt
+	}
+	add(end)
+}
+
+// add adds other's times and outages to a.
+func (a *AvailabilityStats) add(other *AvailabilityStats) {
+	a.up += other.up
+	a.down += other.down
+	a.unknown += other.unknown
+	a.maintenance += other.maintenance
+	a.Outages += other.Outages
+	a.recovered += other.recovered
+	a.recovery += other.recovery
+}
+
+// finish fills in the exported fields from the measured times.
+func (a *AvailabilityStats) finish(target float64) {
+	a.UpSeconds = int64(a.up.Seconds())
+	a.DownSeconds = int64(a.down.Seconds())
+	a.UnknownSeconds = int64(a.unknown.Seconds())
+	a.MaintenanceSeconds = int64(a.maintenance.Seconds())
+
+	if measured := a.up + a.down; measured > 0 {
+		percent := math.Round(100000*a.up.Seconds()/measured.Seconds()) / 1000
+		meets := percent >= target
+		a.Availability, a.MeetsTarget = &percent, &meets
+	}
+	if a.recovered > 0 {
+		mttr := math.Round(a.recovery.Seconds() / float64(a.recovered))
+		a.MTTRSeconds = &mttr
+	}
+}
+
+func minTime(a, b time.Time) time.Time {
+	if a.Before(b) {
+		return a
+	}
+	return b
+}
+
+func maxTime(a, b time.Time) time.Time {
+	if a.After(b) {
+		return a
+	}
+	return b
+}
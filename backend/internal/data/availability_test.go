@@ -0,0 +1,116 @@
+package data
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestNewAvailabilityReport(t *testing.T) {
+	day := time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC)
+	h := func(n int) time.Time { return day.Add(time.Duration(n) * time.Hour) }
+
+	histories := []CameraHistory{
+		// Down for an hour, and back.
+		{CameraID: 1, Name: "lobby", SiteName: "NYC-5th-GLH", Changes: []StatusChange{
+			{StatusOnline, h(-5)}, {StatusOffline, h(2)}, {StatusOnline, h(3)},
+		}},
+		// Never polled.
+		{CameraID: 2, Name: "dock", SiteName: "NYC-5th-GLH"},
+		// First polled at 06:00, and down only during the site's maintenance.
+		{CameraID: 3, Name: "gate", SiteName: "BOS-Main-OPS", Changes: []StatusChange{
+			{StatusOnline, h(6)}, {StatusOffline, h(20)}, {StatusUnauthorized, h(21)},
+		}},
+		// Down since the day before, then down again at the end.
+		{CameraID: 4, Name: "yard", SiteName: "BOS-Main-OPS", Changes: []StatusChange{
+			{StatusOffline, h(-2)}, {StatusOnline, h(1)}, {StatusOffline, h(23)},
+		}},
+	}
+	windows := []*MaintenanceWindow{
+		{StartsAt: h(12), EndsAt: h(13)},
+		{SiteName: "bos-main-ops", StartsAt: h(19), EndsAt: h(20)},
+		{SiteName: "BOS-Main-OPS", StartsAt: h(20), EndsAt: h(21)},
+		{SiteName: "NYC-5th-GLH", StartsAt: h(30), EndsAt: h(31)},
+	}
+
+	// availability, up, down, unknown, maintenance, outages, mttr
+	row := func(a AvailabilityStats) string {
+		f := func(p *float64) string {
+			if p == nil {
+				return "-"
+			}
+			return fmt.Sprint(*p)
+		}
+		return fmt.Sprintf("%s %d %d %d %d %d %s", f(a.Availability), a.UpSeconds/3600, a.DownSeconds/3600, a.UnknownSeconds/3600, a.MaintenanceSeconds/3600, a.Outages, f(a.MTTRSeconds))
+	}
+
+	tests := []struct {
+		name    string
+		windows []*MaintenanceWindow
+		now     time.Time
+		sites   []string
+		cameras []string
+	}{
+		{
+			name:    "maintenance excluded",
+			windows: windows,
+			now:     h(48),
+			sites:   []string{"BOS-Main-OPS 94.444 34 2 6 6 2 10800", "NYC-5th-GLH 95.652 22 1 23 2 1 3600"},
+			cameras: []string{"3 100 15 0 6 3 0 -", "4 90.476 19 2 0 3 2 10800", "1 95.652 22 1 0 1 1 3600", "2 - 0 0 23 1 0 -"},
+		},
+		{
+			name:    "maintenance included",
+			now:     h(48),
+			sites:   []string{"BOS-Main-OPS 92.857 39 3 6 0 3 7200", "NYC-5th-GLH 95.833 23 1 24 0 1 3600"},
+			cameras: []string{"3 94.444 17 1 6 0 1 3600", "4 91.667 22 2 0 0 2 10800", "1 95.833 23 1 0 0 1 3600", "2 - 0 0 24 0 0 -"},
+		},
+		{
+			name:    "period in progress",
+			windows: windows,
+			now:     h(12),
+			sites:   []string{"BOS-Main-OPS 94.444 17 1 6 0 1 10800", "NYC-5th-GLH 91.667 11 1 12 0 1 3600"},
+			cameras: []string{"3 100 6 0 6 0 0 -", "4 91.667 11 1 0 0 1 10800", "1 91.667 11 1 0 0 1 3600", "2 - 0 0 12 0 0 -"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			report := NewAvailabilityReport(histories, tt.windows, h(0), h(24), tt.now, 95)
+
+			var sites, cameras []string
+			for _, s := range report.Sites {
+				sites = append(sites, s.SiteName+" "+row(s.AvailabilityStats))
+			}
+			for _, c := range report.Cameras {
+				cameras = append(cameras, fmt.Sprint(c.CameraID)+" "+row(c.AvailabilityStats))
+			}
+			if fmt.Sprint(sites) != fmt.Sprint(tt.sites) {
+				t.Errorf("sites =\n%q\nwant\n%q", sites, tt.sites)
+			}
+			if fmt.Sprint(cameras) != fmt.Sprint(tt.cameras) {
+				t.Errorf("cameras =\n%q\nwant\n%q", cameras, tt.cameras)
+			}
+			for _, s := range report.Sites {
+				if s.Cameras != 2 {
+					t.Errorf("%s has %d cameras; want 2", s.SiteName, s.Cameras)
+				}
+			}
+		})
+	}
+}
+
+func TestAvailabilityMeetsTarget(t *testing.T) {
+	day := time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC)
+	histories := []CameraHistory{{CameraID: 1, SiteName: "NYC-5th-GLH", Changes: []StatusChange{
+		{StatusOnline, day}, {StatusOffline, day.Add(24*time.Hour - 432*time.Second)},
+	}}}
+
+	// 432 seconds down in a day is exactly 99.5% available.
+	for target, want := range map[float64]bool{99.5: true, 99.6: false} {
+		report := NewAvailabilityReport(histories, nil, day, day.AddDate(0, 0, 1), day.AddDate(0, 0, 2), target)
+		c := report.Cameras[0]
+		if *c.Availability != 99.5 || *c.MeetsTarget != want {
+			t.Errorf("target %v: availability %v, meets_target %v; want 99.5, %v", target, *c.Availability, *c.MeetsTarget, want)
+		}
+	}
+}
@@ -4,7 +4,9 @@ import (
 	"context"
 	"database/sql"
 	"errors"
+	"fmt"
 	"regexp"
+	"strings"
 	"time"
 
 	"github.com/chefgoldbloom/pnctool/backend/internal/validator"
@@ -12,6 +14,7 @@ import (
 
 var (
 	siteNameRxp = regexp.MustCompile(".*-.*-(OPS|COE|GLH)$")
+	addressRxp  = regexp.MustCompile(`^(https?://)?([^\s/:\[\]]+|\[[0-9A-Fa-f:.]+\])(:[0-9]{1,5})?/?$`)
 )
 
 type Camera struct {
@@ -23,21 +26,30 @@ type Camera struct {
 	Username   string    `json:"-"`           // camera username for admin account
 	Password   string    `json:"-"`           // Plaintext password, future: repo integration
 	ModelNo    string    `json:"model_no"`    // String with camera model number/name
+	Address    string    `json:"address"`     // Host, host:port or URL of the camera's management API
 	Version    int32     `json:"version"`     // record version
+
+	// Related resources, only loaded when a Projection includes them
+	Site   *Site         `json:"site,omitempty"`
+	Model  *ModelInfo    `json:"model,omitempty"`
+	Status *CameraStatus `json:"status,omitempty"`
+
+	// Set by GetAll when searching
+	Search *SearchMatch `json:"search,omitempty"`
 }
 
 type CameraModel struct {
-	DB *sql.DB
+	DB DBTX
 }
 
 // Insert creates a camera in database
 func (c CameraModel) Insert(camera *Camera) error {
 	query := `
-		insert into cameras (name, mac_address, site_name, model_no)
-		values ($1, $2, $3, $4)
+		insert into cameras (name, mac_address, site_name, model_no, address)
+		values ($1, $2, $3, $4, $5)
 		returning id, created_at, version
 	`
-	args := []any{camera.Name, camera.MacAddress, camera.SiteName, camera.ModelNo}
+	args := []any{camera.Name, camera.MacAddress, camera.SiteName, camera.ModelNo, camera.Address}
 
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
@@ -45,17 +57,196 @@ func (c CameraModel) Insert(camera *Camera) error {
 	return c.DB.QueryRowContext(ctx, query, args...).Scan(&camera.ID, &camera.CreatedAt, &camera.Version)
 }
 
+// CameraFilter restricts GetAll to cameras matching every non-empty field. Matches
+// are exact but case-insensitive. Status is the last polled status, "unknown" for
+// cameras never polled. Query, if set, must match as well, and Search ranks the
+// results by relevance for sorting on "relevance".
+type CameraFilter struct {
+	Name       string
+	MacAddress string
+	ModelNo    string
+	SiteName   string
+	Status     string
+	Query      *CameraQuery
+	Search     string
+}
+
+// where returns the filter as a condition on cameras c, appending its arguments to
+// args. score is the search relevance expression, or empty if there's no search.
+func (filter CameraFilter) where(args *[]any) (where, score string) {
+	conds := []string{
+		fmt.Sprintf("(lower(c.name) = lower(%[1]s) or %[1]s = '')", placeholder(args, filter.Name)),
+		fmt.Sprintf("(lower(c.mac_address) = lower(%[1]s) or %[1]s = '')", placeholder(args, filter.MacAddress)),
+		fmt.Sprintf("(lower(c.model_no) = lower(%[1]s) or %[1]s = '')", placeholder(args, filter.ModelNo)),
+		fmt.Sprintf("(lower(c.site_name) = lower(%[1]s) or %[1]s = '')", placeholder(args, filter.SiteName)),
+	}
+	if filter.Status != "" {
+		conds = append(conds, fmt.Sprintf("%s = lower(%s)", statusExpr, placeholder(args, filter.Status)))
+	}
+	if filter.Search != "" {
+		var cond string
+		cond, score = searchSQL(filter.Search, args)
+		conds = append(conds, cond)
+	}
+	if filter.Query != nil {
+		conds = append(conds, filter.Query.pred.sql(args))
+	}
+	return strings.Join(conds, "\n\t\tand "), score
+}
+
+// cameraRow holds one scanned row: the camera plus the nullable columns of any
+// LEFT JOINed related tables.
+type cameraRow struct {
+	camera                                 Camera
+	siteName, siteCity, siteStreet         sql.NullString
+	siteOffice, siteAddress, siteTimezone  sql.NullString
+	modelNo, modelVendor, modelDescription sql.NullString
+	status                                 sql.NullString
+	latency                                sql.NullInt32
+	lastSeenAt, checkedAt                  sql.NullTime
+	score                                  float64
+}
+
+// selectColumn pairs a select-list expression with the field it scans into.
+type selectColumn struct {
+	expr string
+	dest func(r *cameraRow) any
+}
+
+// cameraSelect builds the select list and joins for a projection. Only the requested
+// camera columns are selected and only the tables of included resources are joined.
+func cameraSelect(p Projection) ([]selectColumn, string) {
+	fields := []selectColumn{
+		{"c.id", func(r *cameraRow) any { return &r.camera.ID }},
+		{"c.created_at", func(r *cameraRow) any { return &r.camera.CreatedAt }},
+		{"c.name", func(r *cameraRow) any { return &r.camera.Name }},
+		{"c.mac_address", func(r *cameraRow) any { return &r.camera.MacAddress }},
+		{"c.site_name", func(r *cameraRow) any { return &r.camera.SiteName }},
+		{"c.model_no", func(r *cameraRow) any { return &r.camera.ModelNo }},
+		{"c.address", func(r *cameraRow) any { return &r.camera.Address }},
+		{"c.version", func(r *cameraRow) any { return &r.camera.Version }},
+	}
+
+	var cols []selectColumn
+	for _, f := range fields {
+		if p.loads(strings.TrimPrefix(f.expr, "c.")) {
+			cols = append(cols, f)
+		}
+	}
+
+	var joins []string
+	if p.includes("site") {
+		// The site name is needed to describe sites without a row in the sites table.
+		if !p.loads("site_name") {
+			cols = append(cols, fields[4])
+		}
+		joins = append(joins, "left join sites s on s.name = c.site_name")
+		cols = append(cols,
+			selectColumn{"s.name", func(r *cameraRow) any { return &r.siteName }},
+			selectColumn{"s.city", func(r *cameraRow) any { return &r.siteCity }},
+			selectColumn{"s.street", func(r *cameraRow) any { return &r.siteStreet }},
+			selectColumn{"s.office_type", func(r *cameraRow) any { return &r.siteOffice }},
+			selectColumn{"s.address", func(r *cameraRow) any { return &r.siteAddress }},
+			selectColumn{"s.timezone", func(r *cameraRow) any { return &r.siteTimezone }},
+		)
+	}
+	if p.includes("model") {
+		joins = append(joins, "left join camera_models m on m.model_no = c.model_no")
+		cols = append(cols,
+			selectColumn{"m.model_no", func(r *cameraRow) any { return &r.modelNo }},
+			selectColumn{"m.vendor", func(r *cameraRow) any { return &r.modelVendor }},
+			selectColumn{"m.description", func(r *cameraRow) any { return &r.modelDescription }},
+		)
+	}
+	if p.includes("status") {
+		joins = append(joins, "left join camera_status st on st.camera_id = c.id")
+		cols = append(cols,
+			selectColumn{"st.status", func(r *cameraRow) any { return &r.status }},
+			selectColumn{"st.latency_ms", func(r *cameraRow) any { return &r.latency }},
+			selectColumn{"st.last_seen_at", func(r *cameraRow) any { return &r.lastSeenAt }},
+			selectColumn{"st.checked_at", func(r *cameraRow) any { return &r.checkedAt }},
+		)
+	}
+
+	return cols, strings.Join(joins, "\n\t\t")
+}
+
+// selectList joins the expressions of cols for a select statement.
+func selectList(cols []selectColumn) string {
+	exprs := make([]string, len(cols))
+	for i, col := range cols {
+		exprs[i] = col.expr
+	}
+	return strings.Join(exprs, ", ")
+}
+
+// scanDest returns the scan destinations of cols for row.
+func scanDest(row *cameraRow, cols []selectColumn) []any {
+	dest := make([]any, len(cols))
+	for i, col := range cols {
+		dest[i] = col.dest(row)
+	}
+	return dest
+}
+
+// finish builds the embedded resources from the joined columns and drops the columns
+// which were only loaded to build them.
+func (row *cameraRow) finish(p Projection) *Camera {
+	camera := &row.camera
+
+	if p.includes("site") {
+		if row.siteName.Valid {
+			camera.Site = &Site{
+				Name:       row.siteName.String,
+				City:       row.siteCity.String,
+				Street:     row.siteStreet.String,
+				OfficeType: row.siteOffice.String,
+				Address:    row.siteAddress.String,
+				Timezone:   row.siteTimezone.String,
+			}
+		} else {
+			camera.Site = siteFromName(camera.SiteName)
+		}
+	}
+	if p.includes("model") && row.modelNo.Valid {
+		camera.Model = &ModelInfo{ModelNo: row.modelNo.String, Vendor: row.modelVendor.String, Description: row.modelDescription.String}
+	}
+	if p.includes("status") && row.status.Valid {
+		camera.Status = &CameraStatus{Status: row.status.String, CheckedAt: row.checkedAt.Time}
+		if row.latency.Valid {
+			latency := int(row.latency.Int32)
+			camera.Status.LatencyMS = &latency
+		}
+		if row.lastSeenAt.Valid {
+			camera.Status.LastSeenAt = &row.lastSeenAt.Time
+		}
+	}
+
+	p.apply(camera)
+	return camera
+}
+
 // Get retrieves camera from database
 func (c CameraModel) Get(id int64) (*Camera, error) {
+	return c.GetProjected(id, Projection{})
+}
+
+// GetProjected retrieves a camera from database, loading only the fields and related
+// resources selected by p
+func (c CameraModel) GetProjected(id int64, p Projection) (*Camera, error) {
 	if id < 1 {
 		return nil, ErrRecordNotFound
 	}
-	query := `
-		select id, created_at, name, mac_address, site_name, model_no
-		from cameras
-		where id = $1
-	`
-	var camera Camera
+
+	cols, joins := cameraSelect(p)
+	query := fmt.Sprintf(`
+		select %s
+		from cameras c
+		%s
+		where c.id = $1
+	`, selectList(cols), joins)
+
+	var row cameraRow
 
 	// Create context to terminate long sql queries
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
@@ -63,15 +254,7 @@ func (c CameraModel) Get(id int64) (*Camera, error) {
 	// defer cancel() to ensure context is cancelled prior to Get() returning
 	defer cancel()
 
-	err := c.DB.QueryRowContext(ctx, query, id).Scan(
-		&camera.ID,
-		&camera.CreatedAt,
-		&camera.Name,
-		&camera.MacAddress,
-		&camera.SiteName,
-		&camera.ModelNo,
-	)
-
+	err := c.DB.QueryRowContext(ctx, query, id).Scan(scanDest(&row, cols)...)
 	if err != nil {
 		switch {
 		case errors.Is(err, sql.ErrNoRows):
@@ -80,59 +263,84 @@ func (c CameraModel) Get(id int64) (*Camera, error) {
 			return nil, err
 		}
 	}
-	return &camera, nil
+	return row.finish(p), nil
 }
 
-// GetAll() retrieves all cameras from database
-func (c CameraModel) GetAll(name string, mac_address string, model_no string, site_name string, filters Filters) ([]*Camera, error) {
+// GetAll() retrieves a filtered, sorted page of cameras from database along with
+// pagination metadata. Only the fields and related resources selected by p are
+// loaded.
+func (c CameraModel) GetAll(filter CameraFilter, p Projection, filters Filters) ([]*Camera, Metadata, error) {
+	cols, joins := cameraSelect(p)
+
+	// The sort column comes from the validated safelist, so it is safe to interpolate.
+	// id is always a secondary sort so pages are stable.
 	query := `
-		select id, created_at, name, mac_address, site_name, model_no, version
-		from cameras
-		order by id
+		select count(*) over(), %s
+		from cameras c
+		%s
+		where %s
+		order by %s %s, c.id asc
+		limit %s offset %s
 	`
-	// ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
-	// defer cancel()
 
-	rows, err := c.DB.Query(query)
+	var args []any
+	where, score := filter.where(&args)
+
+	orderBy := "c." + filters.sortColumn()
+	if score != "" {
+		cols = append(cols, selectColumn{score, func(r *cameraRow) any { return &r.score }})
+		if orderBy == "c.relevance" {
+			orderBy = score
+		}
+	}
+	if orderBy == "c.relevance" {
+		orderBy = "c.id"
+	}
+	query = fmt.Sprintf(query, selectList(cols), joins, where, orderBy, filters.sortDirection(),
+		placeholder(&args, filters.limit()), placeholder(&args, filters.offset()))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := c.DB.QueryContext(ctx, query, args...)
 	if err != nil {
-		return nil, err
+		return nil, Metadata{}, err
 	}
 	defer rows.Close()
 
+	totalRecords := 0
 	cameras := []*Camera{}
 
 	for rows.Next() {
-		var camera Camera
-		err := rows.Scan(
-			&camera.ID,
-			&camera.CreatedAt,
-			&camera.Name,
-			&camera.MacAddress,
-			&camera.ModelNo,
-			&camera.SiteName,
-			&camera.Version,
-		)
+		var row cameraRow
+		err := rows.Scan(append([]any{&totalRecords}, scanDest(&row, cols)...)...)
 		if err != nil {
-			return nil, err
+			return nil, Metadata{}, err
+		}
+		camera := row.finish(p)
+		if filter.Search != "" {
+			camera.Search = &SearchMatch{Score: row.score, Highlight: highlight(camera, filter.Search)}
 		}
-		cameras = append(cameras, &camera)
+		cameras = append(cameras, camera)
 	}
 
 	if err = rows.Err(); err != nil {
-		return nil, err
+		return nil, Metadata{}, err
 	}
-	return cameras, nil
+
+	metadata := calculateMetadata(totalRecords, filters.Page, filters.PageSize)
+	return cameras, metadata, nil
 }
 
 // Update updates a camera in database
 func (c CameraModel) Update(camera *Camera) error {
 	query := `
 		UPDATE cameras
-		SET name = $1, mac_address = $2, site_name = $3, model_no = $4, version = version + 1
-		WHERE id = $5 AND version = $6
+		SET name = $1, mac_address = $2, site_name = $3, model_no = $4, address = $5, version = version + 1
+		WHERE id = $6 AND version = $7
 		RETURNING version
 	`
-	args := []any{camera.Name, camera.MacAddress, camera.SiteName, camera.ModelNo, camera.ID, camera.Version}
+	args := []any{camera.Name, camera.MacAddress, camera.SiteName, camera.ModelNo, camera.Address, camera.ID, camera.Version}
 
 	// Create context to terminate long sql queries
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
@@ -180,9 +388,51 @@ func (c CameraModel) Delete(id int64) error {
 	return nil
 }
 
+// DeleteVersion removes a camera entry from database only if it is still at the given
+// version. It returns ErrEditConflict if the camera exists at a different version.
+func (c CameraModel) DeleteVersion(id int64, version int32) error {
+	if id < 1 {
+		return ErrRecordNotFound
+	}
+	// The CTE reports whether the row exists at all, so a missing row and a stale
+	// version can be told apart in a single round trip.
+	query := `
+		WITH deleted AS (
+			DELETE FROM cameras
+			WHERE id = $1 AND version = $2
+			RETURNING id
+		)
+		SELECT (SELECT count(*) FROM deleted), EXISTS (SELECT 1 FROM cameras WHERE id = $1)
+	`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var (
+		deleted int
+		exists  bool
+	)
+	err := c.DB.QueryRowContext(ctx, query, id, version).Scan(&deleted, &exists)
+	if err != nil {
+		return err
+	}
+	switch {
+	case deleted > 0:
+		return nil
+	case exists:
+		return ErrEditConflict
+	default:
+		return ErrRecordNotFound
+	}
+}
+
 func ValidateCamera(v *validator.Validator, camera *Camera) {
-	v.Check(camera.Name != "", "name", "must be provided")
-	v.Check(len(camera.Name) <= 500, "name", "must not be more than 500 bytes long")
-	v.Check(len(camera.MacAddress) == 12, "mac_address", "must be 12 characters")
-	v.Check(validator.Matches(camera.SiteName, siteNameRxp), "site_name", "must be like 'City-Street_Number-Office_Type'")
+	v.CheckCode(camera.Name != "", "name", validator.CodeRequired, "must be provided")
+	v.CheckCode(len(camera.Name) <= 500, "name", validator.CodeTooLong, "must not be more than 500 bytes long")
+	v.CheckCode(len(camera.MacAddress) == 12, "mac_address", validator.CodeBadLength, "must be 12 characters")
+	v.CheckCode(validator.Matches(camera.SiteName, siteNameRxp), "site_name", validator.CodeBadFormat, "must be like 'City-Street_Number-Office_Type'")
+	// The address is optional; cameras without one aren't polled.
+	if camera.Address != "" {
+		v.CheckCode(len(camera.Address) <= 255, "address", validator.CodeTooLong, "must not be more than 255 bytes long")
+		v.CheckCode(validator.Matches(camera.Address, addressRxp), "address", validator.CodeBadFormat, "must be a host, host:port or http(s) URL")
+	}
 }
@@ -0,0 +1,285 @@
+package data
+
+import (
+	"cmp"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// MemoryCameraModel is an in-memory CameraRepository. It mirrors the behaviour of
+// CameraModel against Postgres: ids start at 1, new records are at version 1, every
+// Update bumps the version, and a stale version or missing record on Update is an
+// ErrEditConflict. Records are copied in and out so callers can't mutate the store.
+type MemoryCameraModel struct {
+	mu       sync.Mutex
+	nextID   int64
+	cameras  map[int64]Camera
+	statuses map[int64]CameraStatus
+	history  map[int64][]StatusChange
+}
+
+// NewMemoryCameraModel returns an empty MemoryCameraModel.
+func NewMemoryCameraModel() *MemoryCameraModel {
+	return &MemoryCameraModel{nextID: 1, cameras: make(map[int64]Camera), statuses: make(map[int64]CameraStatus), history: make(map[int64][]StatusChange)}
+}
+
+// clone returns an independent copy of the model's data.
+func (m *MemoryCameraModel) clone() *MemoryCameraModel {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	c := &MemoryCameraModel{
+		nextID:   m.nextID,
+		cameras:  make(map[int64]Camera, len(m.cameras)),
+		statuses: make(map[int64]CameraStatus, len(m.statuses)),
+		history:  make(map[int64][]StatusChange, len(m.history)),
+	}
+	for id, camera := range m.cameras {
+		c.cameras[id] = camera
+	}
+	for id, status := range m.statuses {
+		c.statuses[id] = status
+	}
+	for id, changes := range m.history {
+		c.history[id] = slices.Clone(changes)
+	}
+	return c
+}
+
+// restore replaces the model's data with a copy of from's.
+func (m *MemoryCameraModel) restore(from *MemoryCameraModel) {
+	c := from.clone()
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.nextID, m.cameras, m.statuses, m.history = c.nextID, c.cameras, c.statuses, c.history
+}
+
+// Insert stores a copy of camera and sets its ID, CreatedAt and Version.
+func (m *MemoryCameraModel) Insert(camera *Camera) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	camera.ID = m.nextID
+	// created_at is timestamp(0), so Postgres drops sub-second precision.
+	camera.CreatedAt = time.Now().Truncate(time.Second)
+	camera.Version = 1
+	m.nextID++
+
+	// The insert query doesn't set credentials, so the column defaults apply.
+	stored := *camera
+	stored.Username, stored.Password = "root", "pass"
+	m.cameras[camera.ID] = stored
+	return nil
+}
+
+// Get returns a copy of the camera with the given id.
+func (m *MemoryCameraModel) Get(id int64) (*Camera, error) {
+	return m.GetProjected(id, Projection{})
+}
+
+// GetProjected returns a copy of the camera with the given id, projected by p. There
+// are no site or model tables in memory, so included sites are described from the
+// site name and models are never embedded, which is what the SQL query returns
+// against empty tables. Statuses are those recorded with Record.
+func (m *MemoryCameraModel) GetProjected(id int64, p Projection) (*Camera, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	camera, ok := m.cameras[id]
+	if !ok {
+		return nil, ErrRecordNotFound
+	}
+	return m.project(m.withStatus(camera), p), nil
+}
+
+// withStatus returns camera with its recorded status, if any, so it can be matched
+// on status. It must be called with mu held.
+func (m *MemoryCameraModel) withStatus(camera Camera) Camera {
+	if status, ok := m.statuses[camera.ID]; ok {
+		camera.Status = &status
+	}
+	return camera
+}
+
+func (m *MemoryCameraModel) project(camera Camera, p Projection) *Camera {
+	if p.includes("site") {
+		camera.Site = siteFromName(camera.SiteName)
+	}
+	if !p.includes("status") {
+		camera.Status = nil
+	}
+	p.apply(&camera)
+	return &camera
+}
+
+// GetAll filters, sorts and paginates the stored cameras the same way the SQL query
+// does: case-insensitive equality on each non-empty filter, sorted on the filter
+// column then id. Searches are ranked by searchScore, which approximates the SQL
+// relevance score.
+func (m *MemoryCameraModel) GetAll(filter CameraFilter, p Projection, filters Filters) ([]*Camera, Metadata, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var all []*Camera
+	for _, camera := range m.cameras {
+		camera := m.withStatus(camera)
+		if filter.match(&camera) {
+			if filter.Search != "" {
+				camera.Search = &SearchMatch{Score: searchScore(&camera, filter.Search)}
+			}
+			all = append(all, &camera)
+		}
+	}
+
+	column, desc := filters.sortColumn(), filters.sortDirection() == "DESC"
+	slices.SortFunc(all, func(a, b *Camera) int {
+		c := compareColumn(a, b, column)
+		if desc {
+			c = -c
+		}
+		if c == 0 {
+			c = cmp.Compare(a.ID, b.ID)
+		}
+		return c
+	})
+
+	metadata := calculateMetadata(len(all), filters.Page, filters.PageSize)
+
+	start := min(filters.offset(), len(all))
+	end := min(start+filters.limit(), len(all))
+
+	page := []*Camera{}
+	for _, camera := range all[start:end] {
+		camera = m.project(*camera, p)
+		if camera.Search != nil {
+			camera.Search.Highlight = highlight(camera, filter.Search)
+		}
+		page = append(page, camera)
+	}
+	return page, metadata, nil
+}
+
+// match reports whether camera passes the filter, the in-memory version of where.
+func (filter CameraFilter) match(camera *Camera) bool {
+	matches := func(value, filter string) bool {
+		return filter == "" || strings.EqualFold(value, filter)
+	}
+	return matches(camera.Name, filter.Name) && matches(camera.MacAddress, filter.MacAddress) &&
+		matches(camera.ModelNo, filter.ModelNo) && matches(camera.SiteName, filter.SiteName) &&
+		matches(cameraStatusOf(camera), filter.Status) &&
+		(filter.Search == "" || searchScore(camera, filter.Search) > 0) &&
+		(filter.Query == nil || filter.Query.pred.match(camera))
+}
+
+func compareColumn(a, b *Camera, column string) int {
+	switch column {
+	case "name":
+		return cmp.Compare(a.Name, b.Name)
+	case "mac_address":
+		return cmp.Compare(a.MacAddress, b.MacAddress)
+	case "model_no":
+		return cmp.Compare(a.ModelNo, b.ModelNo)
+	case "site_name":
+		return cmp.Compare(a.SiteName, b.SiteName)
+	case "created_at":
+		return a.CreatedAt.Compare(b.CreatedAt)
+	case "relevance":
+		if a.Search != nil && b.Search != nil {
+			return cmp.Compare(a.Search.Score, b.Search.Score)
+		}
+		return cmp.Compare(a.ID, b.ID)
+	default:
+		return cmp.Compare(a.ID, b.ID)
+	}
+}
+
+// Update replaces the stored camera if its version matches, and bumps the version.
+func (m *MemoryCameraModel) Update(camera *Camera) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	stored, ok := m.cameras[camera.ID]
+	if !ok || stored.Version != camera.Version {
+		return ErrEditConflict
+	}
+
+	camera.Version++
+	camera.CreatedAt = stored.CreatedAt
+	camera.Username, camera.Password = stored.Username, stored.Password
+	m.cameras[camera.ID] = *camera
+	return nil
+}
+
+// Delete removes the camera with the given id.
+func (m *MemoryCameraModel) Delete(id int64) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.cameras[id]; !ok {
+		return ErrRecordNotFound
+	}
+	delete(m.cameras, id)
+	delete(m.statuses, id)
+	delete(m.history, id)
+	return nil
+}
+
+// DeleteVersion removes the camera with the given id if it is still at version.
+func (m *MemoryCameraModel) DeleteVersion(id int64, version int32) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	stored, ok := m.cameras[id]
+	switch {
+	case !ok:
+		return ErrRecordNotFound
+	case stored.Version != version:
+		return ErrEditConflict
+	}
+	delete(m.cameras, id)
+	delete(m.statuses, id)
+	delete(m.history, id)
+	return nil
+}
+
+// Suggest returns up to limit names, sites and models containing prefix, those which
+// start with it first. Trigram similarity is left to CameraModel.
+func (m *MemoryCameraModel) Suggest(prefix string, limit int) ([]Suggestion, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	prefix = strings.ToLower(strings.TrimSpace(prefix))
+
+	type key struct{ kind, text string }
+	counts := map[key]int{}
+	for _, camera := range m.cameras {
+		for kind, text := range map[string]string{"name": camera.Name, "site": camera.SiteName, "model": camera.ModelNo} {
+			if strings.Contains(strings.ToLower(text), prefix) {
+				counts[key{kind, text}]++
+			}
+		}
+	}
+
+	suggestions := []Suggestion{}
+	for k, n := range counts {
+		suggestions = append(suggestions, Suggestion{Text: k.text, Kind: k.kind, Cameras: n})
+	}
+	slices.SortFunc(suggestions, func(a, b Suggestion) int {
+		aPrefix := strings.HasPrefix(strings.ToLower(a.Text), prefix)
+		bPrefix := strings.HasPrefix(strings.ToLower(b.Text), prefix)
+		switch {
+		case aPrefix && !bPrefix:
+			return -1
+		case bPrefix && !aPrefix:
+			return 1
+		}
+		if c := cmp.Compare(a.Text, b.Text); c != 0 {
+			return c
+		}
+		return cmp.Compare(a.Kind, b.Kind)
+	})
+	return suggestions[:min(limit, len(suggestions))], nil
+}
@@ -0,0 +1,58 @@
+package data
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestMemoryCameraModelVersions(t *testing.T) {
+	m := NewMemoryCameraModel()
+
+	camera := &Camera{Name: "lobby-east", MacAddress: "ACCC8E000001", SiteName: "NYC-5th-OPS"}
+	if err := m.Insert(camera); err != nil {
+		t.Fatal(err)
+	}
+	if camera.ID != 1 || camera.Version != 1 {
+		t.Fatalf("inserted camera = %+v", camera)
+	}
+
+	first, _ := m.Get(camera.ID)
+	second, _ := m.Get(camera.ID)
+
+	first.Name = "first"
+	if err := m.Update(first); err != nil {
+		t.Fatal(err)
+	}
+	if first.Version != 2 {
+		t.Errorf("version after update = %d; want 2", first.Version)
+	}
+
+	second.Name = "second"
+	if err := m.Update(second); !errors.Is(err, ErrEditConflict) {
+		t.Errorf("stale update: err = %v; want ErrEditConflict", err)
+	}
+
+	stored, _ := m.Get(camera.ID)
+	if stored.Name != "first" {
+		t.Errorf("stored name = %q; want %q", stored.Name, "first")
+	}
+
+	// Mutating a returned camera must not change the store.
+	stored.Name = "mutated"
+	if again, _ := m.Get(camera.ID); again.Name != "first" {
+		t.Errorf("store was mutated through a returned pointer")
+	}
+
+	if err := m.Update(&Camera{ID: 99, Version: 1}); !errors.Is(err, ErrEditConflict) {
+		t.Errorf("update missing: err = %v; want ErrEditConflict", err)
+	}
+	if _, err := m.Get(99); !errors.Is(err, ErrRecordNotFound) {
+		t.Errorf("get missing: err = %v; want ErrRecordNotFound", err)
+	}
+	if err := m.Delete(camera.ID); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.Delete(camera.ID); !errors.Is(err, ErrRecordNotFound) {
+		t.Errorf("delete twice: err = %v; want ErrRecordNotFound", err)
+	}
+}
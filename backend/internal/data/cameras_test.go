@@ -0,0 +1,380 @@
+package data
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+)
+
+func newTestCamera(name, mac, site, model string) *Camera {
+	return &Camera{Name: name, MacAddress: mac, SiteName: site, ModelNo: model}
+}
+
+func TestCameraModelInsertGet(t *testing.T) {
+	m := CameraModel{DB: newTestDB(t)}
+
+	camera := newTestCamera("lobby-east", "ACCC8E000001", "NYC-5th-OPS", "P3245")
+	if err := m.Insert(camera); err != nil {
+		t.Fatal(err)
+	}
+	if camera.ID < 1 || camera.Version != 1 || camera.CreatedAt.IsZero() {
+		t.Fatalf("inserted camera = %+v", camera)
+	}
+
+	got, err := m.Get(camera.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !got.CreatedAt.Equal(camera.CreatedAt) {
+		t.Errorf("created_at = %v; want %v", got.CreatedAt, camera.CreatedAt)
+	}
+	got.CreatedAt = camera.CreatedAt
+	if *got != *camera {
+		t.Errorf("Get = %+v; want %+v", got, camera)
+	}
+
+	for _, id := range []int64{0, -1, camera.ID + 1} {
+		if _, err := m.Get(id); !errors.Is(err, ErrRecordNotFound) {
+			t.Errorf("Get(%d): err = %v; want ErrRecordNotFound", id, err)
+		}
+	}
+}
+
+func TestCameraModelGetAll(t *testing.T) {
+	m := CameraModel{DB: newTestDB(t)}
+
+	cameras := []*Camera{
+		newTestCamera("cam-a", "ACCC8E000001", "NYC-5th-OPS", "P3245"),
+		newTestCamera("cam-b", "ACCC8E000002", "NYC-5th-OPS", "P3265"),
+		newTestCamera("cam-c", "ACCC8E000003", "BOS-Main-GLH", "P3245"),
+	}
+	for _, c := range cameras {
+		if err := m.Insert(c); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	filters := func(sort string, page, pageSize int) Filters {
+		return Filters{Page: page, PageSize: pageSize, Sort: sort, SortSafelist: []string{"id", "name", "-name", "site_name"}}
+	}
+
+	got, metadata, err := m.GetAll(CameraFilter{}, Projection{}, filters("id", 1, 20))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 3 || metadata.TotalRecords != 3 || metadata.LastPage != 1 {
+		t.Fatalf("got %d cameras, metadata %+v", len(got), metadata)
+	}
+	// site_name and model_no must not come back swapped.
+	if got[0].SiteName != "NYC-5th-OPS" || got[0].ModelNo != "P3245" || got[0].Version != 1 {
+		t.Errorf("first camera = %+v", got[0])
+	}
+
+	tests := []struct {
+		name                         string
+		cameraName, mac, model, site string
+		filters                      Filters
+		want                         []string
+		total                        int
+	}{
+		{"site", "", "", "", "bos-main-glh", filters("id", 1, 20), []string{"cam-c"}, 1},
+		{"model", "", "", "P3245", "", filters("id", 1, 20), []string{"cam-a", "cam-c"}, 2},
+		{"mac", "", "accc8e000002", "", "", filters("id", 1, 20), []string{"cam-b"}, 1},
+		{"name desc", "", "", "", "", filters("-name", 1, 20), []string{"cam-c", "cam-b", "cam-a"}, 3},
+		{"page 2", "", "", "", "", filters("name", 2, 2), []string{"cam-c"}, 3},
+		{"none", "nope", "", "", "", filters("id", 1, 20), []string{}, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, metadata, err := m.GetAll(CameraFilter{Name: tt.cameraName, MacAddress: tt.mac, ModelNo: tt.model, SiteName: tt.site}, Projection{}, tt.filters)
+			if err != nil {
+				t.Fatal(err)
+			}
+			names := []string{}
+			for _, c := range got {
+				names = append(names, c.Name)
+			}
+			if fmt.Sprint(names) != fmt.Sprint(tt.want) {
+				t.Errorf("names = %v; want %v", names, tt.want)
+			}
+			if metadata.TotalRecords != tt.total {
+				t.Errorf("total_records = %d; want %d", metadata.TotalRecords, tt.total)
+			}
+		})
+	}
+}
+
+func TestCameraModelUpdate(t *testing.T) {
+	m := CameraModel{DB: newTestDB(t)}
+
+	camera := newTestCamera("lobby-east", "ACCC8E000001", "NYC-5th-OPS", "P3245")
+	if err := m.Insert(camera); err != nil {
+		t.Fatal(err)
+	}
+
+	loaded, err := m.Get(camera.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	loaded.Name = "lobby-west"
+	if err := m.Update(loaded); err != nil {
+		t.Fatal(err)
+	}
+	if loaded.Version != 2 {
+		t.Errorf("version = %d; want 2", loaded.Version)
+	}
+
+	// camera still holds version 1.
+	camera.Name = "stale"
+	if err := m.Update(camera); !errors.Is(err, ErrEditConflict) {
+		t.Errorf("stale update: err = %v; want ErrEditConflict", err)
+	}
+
+	stored, _ := m.Get(camera.ID)
+	if stored.Name != "lobby-west" || stored.Version != 2 {
+		t.Errorf("stored = %+v", stored)
+	}
+
+	if err := m.Update(&Camera{ID: camera.ID + 1, Version: 1}); !errors.Is(err, ErrEditConflict) {
+		t.Errorf("update missing: err = %v; want ErrEditConflict", err)
+	}
+}
+
+func TestCameraModelConcurrentUpdates(t *testing.T) {
+	m := CameraModel{DB: newTestDB(t)}
+
+	camera := newTestCamera("lobby-east", "ACCC8E000001", "NYC-5th-OPS", "P3245")
+	if err := m.Insert(camera); err != nil {
+		t.Fatal(err)
+	}
+
+	const writers = 8
+	var (
+		wg        sync.WaitGroup
+		mu        sync.Mutex
+		succeeded int
+		conflicts int
+	)
+	for i := 0; i < writers; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+
+			// Every writer starts from the same version 1 snapshot.
+			c := *camera
+			c.Name = fmt.Sprintf("writer-%d", i)
+			err := m.Update(&c)
+
+			mu.Lock()
+			defer mu.Unlock()
+			switch {
+			case err == nil:
+				succeeded++
+			case errors.Is(err, ErrEditConflict):
+				conflicts++
+			default:
+				t.Error(err)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	if succeeded != 1 || conflicts != writers-1 {
+		t.Errorf("succeeded = %d, conflicts = %d; want 1 and %d", succeeded, conflicts, writers-1)
+	}
+
+	stored, _ := m.Get(camera.ID)
+	if stored.Version != 2 {
+		t.Errorf("version = %d; want 2", stored.Version)
+	}
+}
+
+func TestCameraModelDelete(t *testing.T) {
+	m := CameraModel{DB: newTestDB(t)}
+
+	camera := newTestCamera("lobby-east", "ACCC8E000001", "NYC-5th-OPS", "P3245")
+	if err := m.Insert(camera); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := m.Delete(camera.ID); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.Delete(camera.ID); !errors.Is(err, ErrRecordNotFound) {
+		t.Errorf("second delete: err = %v; want ErrRecordNotFound", err)
+	}
+	if _, err := m.Get(camera.ID); !errors.Is(err, ErrRecordNotFound) {
+		t.Errorf("get deleted: err = %v; want ErrRecordNotFound", err)
+	}
+	if err := m.Delete(0); !errors.Is(err, ErrRecordNotFound) {
+		t.Errorf("delete 0: err = %v; want ErrRecordNotFound", err)
+	}
+}
+
+func TestCameraModelDeleteVersion(t *testing.T) {
+	m := CameraModel{DB: newTestDB(t)}
+
+	camera := newTestCamera("lobby-east", "ACCC8E000001", "NYC-5th-OPS", "P3245")
+	if err := m.Insert(camera); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := m.DeleteVersion(camera.ID, camera.Version+1); !errors.Is(err, ErrEditConflict) {
+		t.Errorf("stale version: err = %v; want ErrEditConflict", err)
+	}
+	if err := m.DeleteVersion(camera.ID, camera.Version); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.DeleteVersion(camera.ID, camera.Version); !errors.Is(err, ErrRecordNotFound) {
+		t.Errorf("deleted: err = %v; want ErrRecordNotFound", err)
+	}
+}
+
+func TestCameraModelProjection(t *testing.T) {
+	db := newTestDB(t)
+	m := CameraModel{DB: db}
+
+	camera := newTestCamera("lobby-east", "ACCC8E000001", "NYC-5th-OPS", "P3245")
+	if err := m.Insert(camera); err != nil {
+		t.Fatal(err)
+	}
+	_, err := db.Exec(`
+		insert into sites (name, city, street, office_type, address, timezone) values ('NYC-5th-OPS', 'New York', '5th', 'OPS', '1 5th Ave', 'America/New_York');
+		insert into camera_models (model_no, vendor) values ('P3245', 'Axis');`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := m.GetProjected(camera.ID, Projection{Fields: []string{"name"}, Include: []string{"site", "model", "status"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Name != "lobby-east" || got.MacAddress != "" || got.Version != 1 {
+		t.Errorf("sparse camera = %+v", got)
+	}
+	if got.Site == nil || got.Site.Timezone != "America/New_York" || got.Model == nil || got.Model.Vendor != "Axis" {
+		t.Errorf("site = %+v; model = %+v", got.Site, got.Model)
+	}
+	if got.Status != nil {
+		t.Errorf("status = %+v; want nil without a status row", got.Status)
+	}
+
+	// A site with no row is described from its name; a model with no row is omitted.
+	other := newTestCamera("dock", "ACCC8E000002", "BOS-Main-GLH", "M1065")
+	if err := m.Insert(other); err != nil {
+		t.Fatal(err)
+	}
+	cameras, _, err := m.GetAll(CameraFilter{SiteName: "bos-main-glh"}, Projection{Include: []string{"site", "model"}}, Filters{Page: 1, PageSize: 20, Sort: "id", SortSafelist: []string{"id"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(cameras) != 1 || cameras[0].Site == nil || cameras[0].Site.City != "BOS" || cameras[0].Model != nil {
+		t.Errorf("GetAll = %+v", cameras)
+	}
+}
+
+func TestCameraModelGetAllQuery(t *testing.T) {
+	db := newTestDB(t)
+	m := CameraModel{DB: db}
+
+	for _, c := range []*Camera{
+		newTestCamera("lobby", "ACCC8E000001", "NYC-5th-GLH", "P3245"),
+		newTestCamera("dock", "ACCC8E000002", "NYC-5th-GLH", "P3265"),
+		newTestCamera("gate", "ACCC8E000003", "BOS-Main-GLH", "M1065"),
+		newTestCamera("50%_off", "ACCC8E000004", "BOS-Main-OPS", "P3245"),
+	} {
+		if err := m.Insert(c); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := db.Exec(`insert into camera_status (camera_id, status) values (2, 'online')`); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		query string
+		names []string
+	}{
+		{"model_no:P32* site_name:*-GLH NOT status:online", []string{"lobby"}},
+		{"status:unknown", []string{"lobby", "gate", "50%_off"}},
+		{"name:50%* OR id:3", []string{"gate", "50%_off"}},
+		{"name:5*_off", []string{"50%_off"}},
+		{"name:5_*", []string{}},
+		{"created_at:>=2000-01-01 version:<2 -(site_name:BOS-* OR name:dock)", []string{"lobby"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			q, err := ParseCameraQuery(tt.query)
+			if err != nil {
+				t.Fatal(err)
+			}
+			cameras, _, err := m.GetAll(CameraFilter{Query: q}, Projection{}, Filters{Page: 1, PageSize: 20, Sort: "id", SortSafelist: []string{"id"}})
+			if err != nil {
+				t.Fatal(err)
+			}
+			names := []string{}
+			for _, c := range cameras {
+				names = append(names, c.Name)
+			}
+			if fmt.Sprint(names) != fmt.Sprint(tt.names) {
+				t.Errorf("names = %v; want %v", names, tt.names)
+			}
+		})
+	}
+}
+
+func TestCameraModelSearch(t *testing.T) {
+	m := CameraModel{DB: newTestDB(t)}
+
+	for _, c := range []*Camera{
+		newTestCamera("Lobby East", "ACCC8E000001", "NYC-5th-OPS", "P3245"),
+		newTestCamera("Loading Dock", "ACCC8E00AB12", "NYC-5th-OPS", "M1065"),
+		newTestCamera("Gate", "ACCC8E000003", "Lobbyton-Main-GLH", "P3245"),
+	} {
+		if err := m.Insert(c); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		search string
+		names  []string
+	}{
+		{"lobby east", []string{"Lobby East"}},
+		{"lob-e", []string{"Lobby East"}},
+		{"lobby", []string{"Lobby East", "Gate"}},
+		{"8e00ab", []string{"Loading Dock"}},
+		{"50%", []string{}},
+	}
+
+	sortRelevance := Filters{Page: 1, PageSize: 20, Sort: "-relevance", SortSafelist: []string{"-relevance"}}
+	for _, tt := range tests {
+		t.Run(tt.search, func(t *testing.T) {
+			cameras, _, err := m.GetAll(CameraFilter{Search: tt.search}, Projection{}, sortRelevance)
+			if err != nil {
+				t.Fatal(err)
+			}
+			names := []string{}
+			for _, c := range cameras {
+				names = append(names, c.Name)
+				if c.Search == nil || c.Search.Score <= 0 {
+					t.Errorf("%s: search = %+v", c.Name, c.Search)
+				}
+			}
+			if fmt.Sprint(names) != fmt.Sprint(tt.names) {
+				t.Errorf("names = %v; want %v", names, tt.names)
+			}
+		})
+	}
+
+	suggestions, err := m.Suggest("lob", 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Suggestion{{Text: "Lobby East", Kind: "name", Cameras: 1}, {Text: "Lobbyton-Main-GLH", Kind: "site", Cameras: 1}}
+	if fmt.Sprint(suggestions) != fmt.Sprint(want) {
+		t.Errorf("Suggest = %v; want %v", suggestions, want)
+	}
+}
@@ -0,0 +1,148 @@
+package data
+
+import (
+	"cmp"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/chefgoldbloom/pnctool/backend/internal/validator"
+)
+
+// Firmware compliance of a camera. A camera is rated against the catalog entry for
+// its model: vulnerable before the minimum version, outdated before the recommended
+// one and current otherwise. Cameras which haven't reported their firmware are
+// unknown, and those whose model isn't in the catalog are uncatalogued.
+const (
+	FirmwareVulnerable   = "vulnerable"
+	FirmwareOutdated     = "outdated"
+	FirmwareCurrent      = "current"
+	FirmwareUnknown      = "unknown"
+	FirmwareUncatalogued = "uncatalogued"
+)
+
+// FirmwareComplianceSafelist is every compliance, worst first.
+var FirmwareComplianceSafelist = []string{FirmwareVulnerable, FirmwareOutdated, FirmwareCurrent, FirmwareUnknown, FirmwareUncatalogued}
+
+// DefaultFirmwareCompliance is the compliance of the cameras a report lists unless
+// asked for others: those which need upgrading.
+var DefaultFirmwareCompliance = []string{FirmwareVulnerable, FirmwareOutdated}
+
+// FirmwareComplianceReport rates the firmware of cameras against the catalog, site by
+// site. Every camera is counted, but only those whose compliance is in Listed are
+// listed.
+type FirmwareComplianceReport struct {
+	Listed []string                 `json:"listed"`
+	Totals FirmwareCounts           `json:"totals"`
+	Sites  []SiteFirmwareCompliance `json:"sites"`
+}
+
+// FirmwareCounts is how many cameras have each compliance.
+type FirmwareCounts struct {
+	Total        int `json:"total"`
+	Vulnerable   int `json:"vulnerable"`
+	Outdated     int `json:"outdated"`
+	Current      int `json:"current"`
+	Unknown      int `json:"unknown"`
+	Uncatalogued int `json:"uncatalogued"`
+}
+
+// SiteFirmwareCompliance is the compliance of the cameras at a site, with the listed
+// cameras worst first.
+type SiteFirmwareCompliance struct {
+	SiteName string `json:"site_name"`
+	FirmwareCounts
+	Cameras []CameraFirmwareCompliance `json:"cameras"`
+}
+
+// CameraFirmwareCompliance is the compliance of one camera, with the versions from
+// its catalog entry.
+type CameraFirmwareCompliance struct {
+	CameraID           int64      `json:"camera_id"`
+	Name               string     `json:"name"`
+	SiteName           string     `json:"site_name"`
+	ModelNo            string     `json:"model_no"`
+	Firmware           string     `json:"firmware"`
+	CollectedAt        *time.Time `json:"collected_at"`
+	Compliance         string     `json:"compliance"`
+	RecommendedVersion string     `json:"recommended_version"`
+	MinimumVersion     string     `json:"minimum_version"`
+}
+
+func ValidateFirmwareComplianceReport(v *validator.Validator, listed []string) {
+	for _, compliance := range listed {
+		v.CheckCode(validator.PermittedValue(compliance, FirmwareComplianceSafelist...), "compliance", validator.CodeNotPermitted, "must only contain: "+strings.Join(FirmwareComplianceSafelist, ", "))
+	}
+}
+
+// NewFirmwareComplianceReport rates each camera in inventory against the catalog
+// entry for its model_no or, failing that, the model it reported, listing the
+// cameras whose compliance is in listed.
+func NewFirmwareComplianceReport(inventory []FirmwareInventory, catalog []*FirmwareCatalogEntry, listed []string) *FirmwareComplianceReport {
+	report := &FirmwareComplianceReport{Listed: listed, Sites: []SiteFirmwareCompliance{}}
+
+	entries := make(map[string]*FirmwareCatalogEntry, len(catalog))
+	for _, e := range catalog {
+		entries[strings.ToLower(e.ModelNo)] = e
+	}
+
+	sites := map[string]*SiteFirmwareCompliance{}
+	for _, i := range inventory {
+		camera := CameraFirmwareCompliance{CameraID: i.CameraID, Name: i.Name, SiteName: i.SiteName, ModelNo: i.ModelNo, Compliance: FirmwareUnknown}
+		entry := entries[strings.ToLower(i.ModelNo)]
+		if i.Firmware != nil {
+			camera.Firmware = i.Firmware.Firmware
+			camera.CollectedAt = &i.Firmware.CollectedAt
+			if entry == nil && i.Firmware.Model != "" {
+				entry = entries[strings.ToLower(i.Firmware.Model)]
+			}
+		}
+		if entry != nil {
+			camera.RecommendedVersion, camera.MinimumVersion = entry.RecommendedVersion, entry.MinimumVersion
+		}
+		switch {
+		case i.Firmware == nil:
+		case entry == nil:
+			camera.Compliance = FirmwareUncatalogued
+		default:
+			camera.Compliance = entry.Compliance(camera.Firmware)
+		}
+
+		key := strings.ToLower(i.SiteName)
+		site, ok := sites[key]
+		if !ok {
+			site = &SiteFirmwareCompliance{SiteName: i.SiteName, Cameras: []CameraFirmwareCompliance{}}
+			sites[key] = site
+		}
+		site.count(camera.Compliance)
+		report.Totals.count(camera.Compliance)
+		if slices.Contains(listed, camera.Compliance) {
+			site.Cameras = append(site.Cameras, camera)
+		}
+	}
+
+	for _, site := range sites {
+		slices.SortStableFunc(site.Cameras, func(a, b CameraFirmwareCompliance) int {
+			return cmp.Compare(slices.Index(FirmwareComplianceSafelist, a.Compliance), slices.Index(FirmwareComplianceSafelist, b.Compliance))
+		})
+		report.Sites = append(report.Sites, *site)
+	}
+	slices.SortFunc(report.Sites, func(a, b SiteFirmwareCompliance) int { return strings.Compare(a.SiteName, b.SiteName) })
+	return report
+}
+
+func (c *FirmwareCounts) count(compliance string) {
+	c.Total++
+	switch compliance {
+	case FirmwareVulnerable:
+		c.Vulnerable++
+	case FirmwareOutdated:
+		c.Outdated++
+	case FirmwareCurrent:
+		c.Current++
+	case FirmwareUnknown:
+		c.Unknown++
+	case FirmwareUncatalogued:
+		c.Uncatalogued++
+	}
+}
@@ -0,0 +1,75 @@
+package data
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestNewFirmwareComplianceReport(t *testing.T) {
+	at := time.Date(2026, 3, 2, 9, 0, 0, 0, time.UTC)
+	reported := func(model, firmware string) *CameraFirmware {
+		return &CameraFirmware{Model: model, Firmware: firmware, CollectedAt: at}
+	}
+
+	inventory := []FirmwareInventory{
+		{CameraID: 1, Name: "lobby", SiteName: "NYC-5th-GLH", ModelNo: "P3245-LV", Firmware: reported("P3245-LV", "10.12.114")},
+		{CameraID: 2, Name: "dock", SiteName: "NYC-5th-GLH", ModelNo: "p3245-lv", Firmware: reported("P3245-LV", "10.10.1")},
+		{CameraID: 3, Name: "gate", SiteName: "BOS-Main-OPS", ModelNo: "P3245-LV", Firmware: reported("P3245-LV", "9.80.1")},
+		// Not in the inventory's model_no, but the model it reports is catalogued.
+		{CameraID: 4, Name: "yard", SiteName: "BOS-Main-OPS", Firmware: reported("XNV-6080", "2.20.0")},
+		{CameraID: 5, Name: "roof", SiteName: "BOS-Main-OPS", ModelNo: "P3245-LV"},
+		{CameraID: 6, Name: "hall", SiteName: "nyc-5th-glh", ModelNo: "Q6135-LE", Firmware: reported("Q6135-LE", "11.0")},
+		{CameraID: 7, Name: "exit", SiteName: "NYC-5th-GLH", ModelNo: "P3245-LV", Firmware: reported("P3245-LV", "10.8")},
+	}
+	catalog := []*FirmwareCatalogEntry{
+		{ModelNo: "P3245-LV", RecommendedVersion: "10.12.114", MinimumVersion: "10.9"},
+		{ModelNo: "XNV-6080", RecommendedVersion: "2.21.02"},
+	}
+
+	counts := func(c FirmwareCounts) string {
+		return fmt.Sprintf("%d: %d vulnerable %d outdated %d current %d unknown %d uncatalogued", c.Total, c.Vulnerable, c.Outdated, c.Current, c.Unknown, c.Uncatalogued)
+	}
+	listed := func(s SiteFirmwareCompliance) string {
+		var got []string
+		for _, c := range s.Cameras {
+			got = append(got, fmt.Sprintf("%d:%s", c.CameraID, c.Compliance))
+		}
+		return fmt.Sprint(got)
+	}
+
+	report := NewFirmwareComplianceReport(inventory, catalog, DefaultFirmwareCompliance)
+	if got := counts(report.Totals); got != "7: 2 vulnerable 2 outdated 1 current 1 unknown 1 uncatalogued" {
+		t.Errorf("totals = %s", got)
+	}
+	if len(report.Sites) != 2 {
+		t.Fatalf("sites = %+v; want BOS-Main-OPS and NYC-5th-GLH", report.Sites)
+	}
+
+	bos, nyc := report.Sites[0], report.Sites[1]
+	if bos.SiteName != "BOS-Main-OPS" || counts(bos.FirmwareCounts) != "3: 1 vulnerable 1 outdated 0 current 1 unknown 0 uncatalogued" {
+		t.Errorf("first site = %s %s", bos.SiteName, counts(bos.FirmwareCounts))
+	}
+	if got := listed(bos); got != "[3:vulnerable 4:outdated]" {
+		t.Errorf("cameras listed at BOS-Main-OPS = %s", got)
+	}
+	if nyc.SiteName != "NYC-5th-GLH" || counts(nyc.FirmwareCounts) != "4: 1 vulnerable 1 outdated 1 current 0 unknown 1 uncatalogued" {
+		t.Errorf("second site = %s %s", nyc.SiteName, counts(nyc.FirmwareCounts))
+	}
+	if got := listed(nyc); got != "[7:vulnerable 2:outdated]" {
+		t.Errorf("cameras listed at NYC-5th-GLH = %s; want the worst first", got)
+	}
+
+	gate := bos.Cameras[0]
+	if gate.Name != "gate" || gate.Firmware != "9.80.1" || gate.RecommendedVersion != "10.12.114" || gate.MinimumVersion != "10.9" || gate.CollectedAt == nil || !gate.CollectedAt.Equal(at) {
+		t.Errorf("vulnerable camera = %+v", gate)
+	}
+
+	report = NewFirmwareComplianceReport(inventory, catalog, []string{FirmwareUnknown, FirmwareUncatalogued})
+	if got := listed(report.Sites[0]) + listed(report.Sites[1]); got != "[5:unknown][6:uncatalogued]" {
+		t.Errorf("cameras listed = %s; want the unknown and uncatalogued ones", got)
+	}
+	if roof := report.Sites[0].Cameras[0]; roof.Firmware != "" || roof.CollectedAt != nil || roof.RecommendedVersion != "10.12.114" {
+		t.Errorf("camera which hasn't reported = %+v", roof)
+	}
+}
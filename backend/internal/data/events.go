@@ -0,0 +1,252 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Event types. Camera events are published by the handlers which change the
+// inventory and by the status poller; webhook.ping is only sent to the one webhook
+// being tested.
+const (
+	EventCameraCreated         = "camera.created"
+	EventCameraUpdated         = "camera.updated"
+	EventCameraDeleted         = "camera.deleted"
+	EventCameraOffline         = "camera.offline"
+	EventCameraOnline          = "camera.online"
+	EventCameraFirmwareChanged = "camera.firmware_changed"
+	EventWebhookPing           = "webhook.ping"
+)
+
+// EventChannel is the Postgres notification channel on which the events table's
+// trigger announces each event as it's committed.
+const EventChannel = "pnc_events"
+
+// EventTypeSafelist is every event type which can be subscribed to.
+var EventTypeSafelist = []string{
+	EventCameraCreated, EventCameraUpdated, EventCameraDeleted,
+	EventCameraOffline, EventCameraOnline, EventCameraFirmwareChanged,
+}
+
+// Event is something which happened to a camera. Data is the event's payload: the
+// camera for inventory events, and what changed for the others.
+type Event struct {
+	ID         int64           `json:"id"`
+	Type       string          `json:"type"`
+	CameraID   int64           `json:"camera_id"`
+	SiteName   string          `json:"site_name"`
+	OccurredAt time.Time       `json:"occurred_at"`
+	Data       json.RawMessage `json:"data"`
+}
+
+// NewEvent returns an event of the given type about camera, with payload as its
+// data, which happened at.
+func NewEvent(eventType string, camera *Camera, payload any, at time.Time) (*Event, error) {
+	js, err := json.Marshal(payload)
+	if err != nil {
+		return nil, err
+	}
+	return &Event{
+		Type:       eventType,
+		CameraID:   camera.ID,
+		SiteName:   camera.SiteName,
+		OccurredAt: at.Truncate(time.Second),
+		Data:       js,
+	}, nil
+}
+
+// EventFilter selects events from the log. Empty fields match every event.
+type EventFilter struct {
+	SiteName string
+	Types    []string
+}
+
+// Matches reports whether the event is one the filter selects.
+func (filter EventFilter) Matches(event *Event) bool {
+	return (filter.SiteName == "" || strings.EqualFold(event.SiteName, filter.SiteName)) &&
+		(len(filter.Types) == 0 || slices.Contains(filter.Types, event.Type))
+}
+
+// EventRepository is the event log. EventModel implements it on top of Postgres and
+// MemoryEventModel implements it in memory for tests.
+type EventRepository interface {
+	// Insert appends the event to the log and sets its ID.
+	Insert(event *Event) error
+	// Get returns the event with the ID.
+	Get(id int64) (*Event, error)
+	// After returns up to limit events matching filter with IDs greater than id,
+	// oldest first.
+	After(id int64, filter EventFilter, limit int) ([]*Event, error)
+	// LastID returns the ID of the newest event, or 0 if the log is empty.
+	LastID() (int64, error)
+}
+
+type EventModel struct {
+	DB DBTX
+}
+
+func (m EventModel) Insert(event *Event) error {
+	query := `
+		insert into events (type, camera_id, site_name, occurred_at, data)
+		values ($1, $2, $3, $4, $5)
+		returning id
+	`
+	if event.Data == nil {
+		event.Data = json.RawMessage("{}")
+	}
+	args := []any{event.Type, event.CameraID, event.SiteName, event.OccurredAt, []byte(event.Data)}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	return m.DB.QueryRowContext(ctx, query, args...).Scan(&event.ID)
+}
+
+const eventColumns = "id, type, camera_id, site_name, occurred_at, data"
+
+func scanEvent(row interface{ Scan(...any) error }) (*Event, error) {
+	var (
+		event Event
+		data  []byte
+	)
+	if err := row.Scan(&event.ID, &event.Type, &event.CameraID, &event.SiteName, &event.OccurredAt, &data); err != nil {
+		return nil, err
+	}
+	event.Data = data
+	return &event, nil
+}
+
+func (m EventModel) Get(id int64) (*Event, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	event, err := scanEvent(m.DB.QueryRowContext(ctx, "select "+eventColumns+" from events where id = $1", id))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrRecordNotFound
+	}
+	return event, err
+}
+
+func (m EventModel) After(id int64, filter EventFilter, limit int) ([]*Event, error) {
+	args := []any{}
+	conds := []string{
+		"id > " + placeholder(&args, id),
+		fmt.Sprintf("(lower(site_name) = lower(%[1]s) or %[1]s = '')", placeholder(&args, filter.SiteName)),
+	}
+	if len(filter.Types) > 0 {
+		types := make([]string, len(filter.Types))
+		for n, eventType := range filter.Types {
+			types[n] = placeholder(&args, eventType)
+		}
+		conds = append(conds, "type in ("+strings.Join(types, ", ")+")")
+	}
+
+	query := fmt.Sprintf(`
+		select `+eventColumns+`
+		from events
+		where %s
+		order by id
+		limit %s
+	`, strings.Join(conds, "\n\t\tand "), placeholder(&args, limit))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	events := []*Event{}
+	for rows.Next() {
+		event, err := scanEvent(rows)
+		if err != nil {
+			return nil, err
+		}
+		events = append(events, event)
+	}
+	return events, rows.Err()
+}
+
+func (m EventModel) LastID() (int64, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var id int64
+	err := m.DB.QueryRowContext(ctx, `select coalesce(max(id), 0) from events`).Scan(&id)
+	return id, err
+}
+
+// MemoryEventModel is an in-memory EventRepository.
+type MemoryEventModel struct {
+	mu     sync.Mutex
+	events []Event
+}
+
+func NewMemoryEventModel() *MemoryEventModel {
+	return &MemoryEventModel{}
+}
+
+func (m *MemoryEventModel) Insert(event *Event) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	event.ID = int64(len(m.events) + 1)
+	event.OccurredAt = event.OccurredAt.Truncate(time.Second)
+	if event.Data == nil {
+		event.Data = json.RawMessage("{}")
+	}
+	stored := *event
+	stored.Data = slices.Clone(event.Data)
+	m.events = append(m.events, stored)
+	return nil
+}
+
+func (m *MemoryEventModel) Get(id int64) (*Event, error) {
+	event, ok := m.get(id)
+	if !ok {
+		return nil, ErrRecordNotFound
+	}
+	event.Data = slices.Clone(event.Data)
+	return &event, nil
+}
+
+func (m *MemoryEventModel) After(id int64, filter EventFilter, limit int) ([]*Event, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	events := []*Event{}
+	for i := max(id, 0); i < int64(len(m.events)) && len(events) < limit; i++ {
+		if filter.Matches(&m.events[i]) {
+			event := m.events[i]
+			event.Data = slices.Clone(event.Data)
+			events = append(events, &event)
+		}
+	}
+	return events, nil
+}
+
+func (m *MemoryEventModel) LastID() (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return int64(len(m.events)), nil
+}
+
+// get returns a copy of the event with the ID, or false if there isn't one.
+func (m *MemoryEventModel) get(id int64) (Event, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if id < 1 || id > int64(len(m.events)) {
+		return Event{}, false
+	}
+	return m.events[id-1], true
+}
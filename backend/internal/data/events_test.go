@@ -0,0 +1,162 @@
+package data
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+func testEventRepository(t *testing.T, repo EventRepository) {
+	if id, err := repo.LastID(); id != 0 || err != nil {
+		t.Errorf("LastID of an empty log = %d, %v; want 0", id, err)
+	}
+
+	at := time.Date(2026, 3, 2, 9, 0, 0, 0, time.UTC)
+	for i, e := range []struct{ eventType, site string }{
+		{EventCameraCreated, "NYC-5th-GLH"},
+		{EventCameraOffline, "NYC-5th-GLH"},
+		{EventWebhookPing, ""},
+		{EventCameraOffline, "BOS-Main-OPS"},
+		{EventCameraOnline, "NYC-5th-GLH"},
+	} {
+		event := &Event{Type: e.eventType, CameraID: int64(i), SiteName: e.site, OccurredAt: at.Add(time.Duration(i) * time.Minute)}
+		if i == 0 {
+			event.Data = json.RawMessage(`{"name":"lobby"}`)
+		}
+		if err := repo.Insert(event); err != nil {
+			t.Fatal(err)
+		}
+		if event.ID != int64(i+1) {
+			t.Fatalf("event %d has ID %d", i+1, event.ID)
+		}
+	}
+
+	if id, err := repo.LastID(); id != 5 || err != nil {
+		t.Errorf("LastID = %d, %v; want 5", id, err)
+	}
+	if event, err := repo.Get(4); err != nil || event.Type != EventCameraOffline || event.SiteName != "BOS-Main-OPS" || string(event.Data) != "{}" {
+		t.Errorf("Get(4) = %+v, %v", event, err)
+	}
+	if _, err := repo.Get(99); !errors.Is(err, ErrRecordNotFound) {
+		t.Errorf("Get of a missing event: err = %v; want ErrRecordNotFound", err)
+	}
+
+	ids := func(events []*Event) string {
+		got := []int64{}
+		for _, event := range events {
+			got = append(got, event.ID)
+		}
+		return fmt.Sprint(got)
+	}
+
+	tests := []struct {
+		name   string
+		after  int64
+		filter EventFilter
+		limit  int
+		want   string
+	}{
+		{"all", 0, EventFilter{}, 10, "[1 2 3 4 5]"},
+		{"after", 2, EventFilter{}, 10, "[3 4 5]"},
+		{"limit", 1, EventFilter{}, 2, "[2 3]"},
+		{"caught up", 5, EventFilter{}, 10, "[]"},
+		{"site", 0, EventFilter{SiteName: "nyc-5th-glh"}, 10, "[1 2 5]"},
+		{"types", 0, EventFilter{Types: []string{EventCameraOffline, EventCameraOnline}}, 10, "[2 4 5]"},
+		{"site and type", 2, EventFilter{SiteName: "NYC-5th-GLH", Types: []string{EventCameraOffline, EventCameraOnline}}, 10, "[5]"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			events, err := repo.After(tt.after, tt.filter, tt.limit)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := ids(events); got != tt.want {
+				t.Errorf("After(%d) = %s; want %s", tt.after, got, tt.want)
+			}
+		})
+	}
+
+	events, _ := repo.After(0, EventFilter{}, 2)
+	var payload struct{ Name string }
+	if err := json.Unmarshal(events[0].Data, &payload); err != nil || payload.Name != "lobby" {
+		t.Errorf("first event data = %s; want its payload", events[0].Data)
+	}
+	if string(events[1].Data) != "{}" || !events[1].OccurredAt.Equal(at.Add(time.Minute)) || events[1].SiteName != "NYC-5th-GLH" {
+		t.Errorf("second event = %+v", events[1])
+	}
+}
+
+func TestEventModel(t *testing.T) {
+	testEventRepository(t, EventModel{DB: newTestDB(t)})
+}
+
+// TestEventNotify checks that the events table's trigger announces each event, in
+// full unless it's too big for a notification.
+func TestEventNotify(t *testing.T) {
+	db := newTestDB(t)
+	dsn, _ := postgresDSN()
+
+	listener := pq.NewListener(dsn, time.Second, time.Second, nil)
+	defer listener.Close()
+	if err := listener.Listen(EventChannel); err != nil {
+		t.Fatal(err)
+	}
+
+	// Other tests' events are announced on the same channel, so look for these by ID.
+	next := func(id int64) map[string]json.RawMessage {
+		t.Helper()
+		timeout := time.After(5 * time.Second)
+		for {
+			select {
+			case n := <-listener.Notify:
+				if n == nil {
+					continue
+				}
+				var payload map[string]json.RawMessage
+				if err := json.Unmarshal([]byte(n.Extra), &payload); err != nil {
+					t.Fatalf("payload %q: %v", n.Extra, err)
+				}
+				if string(payload["id"]) == fmt.Sprint(id) {
+					return payload
+				}
+			case <-timeout:
+				t.Fatalf("no notification of event %d", id)
+			}
+		}
+	}
+
+	repo := EventModel{DB: db}
+	small := &Event{Type: EventCameraOffline, CameraID: 7, SiteName: "NYC-5th-GLH", OccurredAt: time.Date(2026, 3, 2, 9, 0, 0, 0, time.UTC), Data: json.RawMessage(`{"status":"offline"}`)}
+	if err := repo.Insert(small); err != nil {
+		t.Fatal(err)
+	}
+	var event Event
+	payload, _ := json.Marshal(next(small.ID))
+	if err := json.Unmarshal(payload, &event); err != nil {
+		t.Fatal(err)
+	}
+	var data struct{ Status string }
+	if err := json.Unmarshal(event.Data, &data); err != nil {
+		t.Fatal(err)
+	}
+	if event.Type != small.Type || event.CameraID != 7 || event.SiteName != small.SiteName || !event.OccurredAt.Equal(small.OccurredAt) || data.Status != "offline" {
+		t.Errorf("notified event = %+v; want %+v", event, small)
+	}
+
+	big := &Event{Type: EventCameraUpdated, OccurredAt: small.OccurredAt, Data: json.RawMessage(`{"notes":"` + strings.Repeat("x", 8000) + `"}`)}
+	if err := repo.Insert(big); err != nil {
+		t.Fatal(err)
+	}
+	if payload := next(big.ID); len(payload) != 1 {
+		t.Errorf("notification of a big event has %d fields; want only its id", len(payload))
+	}
+}
+
+func TestMemoryEventModel(t *testing.T) {
+	testEventRepository(t, NewMemoryEventModel())
+}
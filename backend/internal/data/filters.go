@@ -1,6 +1,9 @@
 package data
 
 import (
+	"math"
+	"strings"
+
 	"github.com/chefgoldbloom/pnctool/backend/internal/validator"
 )
 
@@ -11,11 +14,67 @@ type Filters struct {
 	SortSafelist []string
 }
 
+// sortColumn checks that the client-provided Sort field matches one of the entries in
+// the safelist and, if it does, extracts the column name by stripping the leading
+// hyphen character (if one exists).
+func (f Filters) sortColumn() string {
+	for _, safeValue := range f.SortSafelist {
+		if f.Sort == safeValue {
+			return strings.TrimPrefix(f.Sort, "-")
+		}
+	}
+	// ValidateFilters should already have rejected the value, so this is a
+	// programming error rather than bad input.
+	panic("unsafe sort parameter: " + f.Sort)
+}
+
+// sortDirection returns the sort direction ("ASC" or "DESC") depending on the prefix
+// character of the Sort field.
+func (f Filters) sortDirection() string {
+	if strings.HasPrefix(f.Sort, "-") {
+		return "DESC"
+	}
+	return "ASC"
+}
+
+func (f Filters) limit() int {
+	return f.PageSize
+}
+
+func (f Filters) offset() int {
+	return (f.Page - 1) * f.PageSize
+}
+
+// Metadata holds the pagination information returned alongside a page of records.
+type Metadata struct {
+	CurrentPage  int `json:"current_page,omitempty"`
+	PageSize     int `json:"page_size,omitempty"`
+	FirstPage    int `json:"first_page,omitempty"`
+	LastPage     int `json:"last_page,omitempty"`
+	TotalRecords int `json:"total_records,omitempty"`
+}
+
+// calculateMetadata works out the pagination metadata values given the total number
+// of records, current page and page size. An empty result set returns empty Metadata.
+func calculateMetadata(totalRecords, page, pageSize int) Metadata {
+	if totalRecords == 0 {
+		return Metadata{}
+	}
+
+	return Metadata{
+		CurrentPage:  page,
+		PageSize:     pageSize,
+		FirstPage:    1,
+		LastPage:     int(math.Ceil(float64(totalRecords) / float64(pageSize))),
+		TotalRecords: totalRecords,
+	}
+}
+
 func ValidateFilters(v *validator.Validator, f Filters) {
 	// Check page and page_size contain sensible values
-	v.Check(f.Page > 0, "page", "must be greater than zero")
-	v.Check(f.Page <= 10_000_000, "page", "10 million maximum")
-	v.Check(f.PageSize > 0, "page_size", "must be greater than zero")
-	v.Check(f.PageSize <= 100, "page_size", "100 maximum")
-	v.Check(validator.PermittedValue(f.Sort, f.SortSafelist...), "sort", "invalid sort value")
+	v.CheckCode(f.Page > 0, "page", validator.CodeOutOfRange, "must be greater than zero")
+	v.CheckCode(f.Page <= 10_000_000, "page", validator.CodeOutOfRange, "10 million maximum")
+	v.CheckCode(f.PageSize > 0, "page_size", validator.CodeOutOfRange, "must be greater than zero")
+	v.CheckCode(f.PageSize <= 100, "page_size", validator.CodeOutOfRange, "100 maximum")
+	v.CheckCode(validator.PermittedValue(f.Sort, f.SortSafelist...), "sort", validator.CodeNotPermitted, "invalid sort value")
 }
@@ -0,0 +1,320 @@
+package data
+
+import (
+	"cmp"
+	"context"
+	"database/sql"
+	"errors"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// CameraFirmware is what a camera last reported about its firmware to the firmware
+// collector. Model is the model the camera reports, which may be more specific than
+// the model_no in the inventory.
+type CameraFirmware struct {
+	Model       string    `json:"model"`
+	Firmware    string    `json:"firmware"`
+	CollectedAt time.Time `json:"collected_at"`
+}
+
+// FirmwareChange is a camera reporting different firmware, as seen by the collector.
+// The first firmware a camera reports counts as a change.
+type FirmwareChange struct {
+	Model     string    `json:"model"`
+	Firmware  string    `json:"firmware"`
+	ChangedAt time.Time `json:"changed_at"`
+}
+
+// FirmwareInventory is a camera and the firmware it last reported, which is nil if
+// it hasn't reported any.
+type FirmwareInventory struct {
+	CameraID int64
+	Name     string
+	SiteName string
+	ModelNo  string
+	Firmware *CameraFirmware
+}
+
+// FirmwareRepository is what the firmware collector writes and the firmware reports
+// read. FirmwareModel implements it on top of Postgres and MemoryFirmwareModel
+// implements it in memory.
+type FirmwareRepository interface {
+	// Record stores what a camera reported, adding a FirmwareChange to its history
+	// if the firmware differs from the last it reported. It returns the firmware the
+	// camera had before, which is empty if it had none, and ErrRecordNotFound if the
+	// camera has been deleted.
+	Record(id int64, firmware *CameraFirmware) (previous string, err error)
+
+	// Get returns what a camera last reported, or ErrRecordNotFound if it hasn't
+	// reported anything.
+	Get(id int64) (*CameraFirmware, error)
+
+	// History returns a camera's firmware changes, oldest first.
+	History(id int64) ([]FirmwareChange, error)
+
+	// Inventory returns every camera at site, or at every site if site is empty, with
+	// the firmware it last reported, in id order.
+	Inventory(site string) ([]FirmwareInventory, error)
+}
+
+// versionPartRxp matches the numbers in a firmware version.
+var versionPartRxp = regexp.MustCompile(`[0-9]+`)
+
+// CompareVersions compares two firmware versions number by number, so 10.12.114 is
+// after 10.9.2 and 2.21.02_20230209 after 2.21. Anything between the numbers is
+// ignored, and missing numbers count as 0. It returns -1, 0 or +1 like
+// strings.Compare.
+func CompareVersions(a, b string) int {
+	x, y := versionParts(a), versionParts(b)
+	for i := 0; i < max(len(x), len(y)); i++ {
+		p, q := "0", "0"
+		if i < len(x) {
+			p = x[i]
+		}
+		if i < len(y) {
+			q = y[i]
+		}
+		// Numbers without leading zeros compare by length first, however long they are.
+		if c := cmp.Compare(len(p), len(q)); c != 0 {
+			return c
+		}
+		if c := strings.Compare(p, q); c != 0 {
+			return c
+		}
+	}
+	return 0
+}
+
+func versionParts(version string) []string {
+	parts := versionPartRxp.FindAllString(version, -1)
+	for i, part := range parts {
+		if parts[i] = strings.TrimLeft(part, "0"); parts[i] == "" {
+			parts[i] = "0"
+		}
+	}
+	return parts
+}
+
+type FirmwareModel struct {
+	DB DBTX
+}
+
+func (m FirmwareModel) Record(id int64, firmware *CameraFirmware) (string, error) {
+	// Like StatusModel.Record, selecting from cameras means a camera deleted since
+	// Targets inserts nothing, and previous sees the firmware from before the upsert.
+	query := `
+		with previous as (
+			select firmware from camera_firmware where camera_id = $1
+		), upserted as (
+			insert into camera_firmware (camera_id, model, firmware, collected_at)
+			select id, $2::text, $3::text, $4::timestamptz from cameras where id = $1
+			on conflict (camera_id) do update
+			set model = excluded.model, firmware = excluded.firmware, collected_at = excluded.collected_at
+			returning camera_id
+		), changed as (
+			insert into firmware_history (camera_id, model, firmware, changed_at)
+			select camera_id, $2::text, $3::text, $4::timestamptz from upserted
+			where $3::text is distinct from (select firmware from previous)
+		)
+		select count(*), coalesce((select firmware from previous), '') from upserted
+	`
+	args := []any{id, firmware.Model, firmware.Firmware, firmware.CollectedAt}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var (
+		n        int
+		previous string
+	)
+	err := m.DB.QueryRowContext(ctx, query, args...).Scan(&n, &previous)
+	if err != nil {
+		return "", err
+	}
+	if n == 0 {
+		return "", ErrRecordNotFound
+	}
+	return previous, nil
+}
+
+func (m FirmwareModel) Get(id int64) (*CameraFirmware, error) {
+	query := `
+		select model, firmware, collected_at
+		from camera_firmware
+		where camera_id = $1
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var f CameraFirmware
+	err := m.DB.QueryRowContext(ctx, query, id).Scan(&f.Model, &f.Firmware, &f.CollectedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrRecordNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &f, nil
+}
+
+func (m FirmwareModel) History(id int64) ([]FirmwareChange, error) {
+	query := `
+		select model, firmware, changed_at
+		from firmware_history
+		where camera_id = $1
+		order by changed_at, id
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	changes := []FirmwareChange{}
+	for rows.Next() {
+		var c FirmwareChange
+		if err := rows.Scan(&c.Model, &c.Firmware, &c.ChangedAt); err != nil {
+			return nil, err
+		}
+		changes = append(changes, c)
+	}
+	return changes, rows.Err()
+}
+
+func (m FirmwareModel) Inventory(site string) ([]FirmwareInventory, error) {
+	query := `
+		select c.id, c.name, c.site_name, c.model_no, f.model, f.firmware, f.collected_at
+		from cameras c
+		left join camera_firmware f on f.camera_id = c.id
+		where lower(c.site_name) = lower($1) or $1 = ''
+		order by c.id
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, site)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	inventory := []FirmwareInventory{}
+	for rows.Next() {
+		var (
+			i               FirmwareInventory
+			model, firmware sql.NullString
+			collectedAt     sql.NullTime
+		)
+		err := rows.Scan(&i.CameraID, &i.Name, &i.SiteName, &i.ModelNo, &model, &firmware, &collectedAt)
+		if err != nil {
+			return nil, err
+		}
+		if firmware.Valid {
+			i.Firmware = &CameraFirmware{Model: model.String, Firmware: firmware.String, CollectedAt: collectedAt.Time}
+		}
+		inventory = append(inventory, i)
+	}
+	return inventory, rows.Err()
+}
+
+// MemoryFirmwareModel is an in-memory FirmwareRepository. It reads cameras from
+// cameras, and forgets the firmware of deleted cameras, like the foreign key cascade
+// of FirmwareModel.
+type MemoryFirmwareModel struct {
+	mu      sync.Mutex
+	cameras *MemoryCameraModel
+	current map[int64]CameraFirmware
+	history map[int64][]FirmwareChange
+}
+
+func NewMemoryFirmwareModel(cameras *MemoryCameraModel) *MemoryFirmwareModel {
+	return &MemoryFirmwareModel{
+		cameras: cameras,
+		current: make(map[int64]CameraFirmware),
+		history: make(map[int64][]FirmwareChange),
+	}
+}
+
+// exists reports whether the camera is still there, forgetting its firmware if it
+// isn't. It must be called with mu held.
+func (m *MemoryFirmwareModel) exists(id int64) bool {
+	if _, err := m.cameras.Get(id); err != nil {
+		delete(m.current, id)
+		delete(m.history, id)
+		return false
+	}
+	return true
+}
+
+// Record stores a copy of firmware for the camera, truncated to the second like the
+// timestamp(0) columns.
+func (m *MemoryFirmwareModel) Record(id int64, firmware *CameraFirmware) (string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if !m.exists(id) {
+		return "", ErrRecordNotFound
+	}
+	previous, ok := m.current[id]
+
+	stored := *firmware
+	stored.CollectedAt = stored.CollectedAt.Truncate(time.Second)
+	if !ok || previous.Firmware != stored.Firmware {
+		m.history[id] = append(m.history[id], FirmwareChange{Model: stored.Model, Firmware: stored.Firmware, ChangedAt: stored.CollectedAt})
+	}
+	m.current[id] = stored
+	return previous.Firmware, nil
+}
+
+func (m *MemoryFirmwareModel) Get(id int64) (*CameraFirmware, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	firmware, ok := m.current[id]
+	if !ok || !m.exists(id) {
+		return nil, ErrRecordNotFound
+	}
+	return &firmware, nil
+}
+
+func (m *MemoryFirmwareModel) History(id int64) ([]FirmwareChange, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if !m.exists(id) {
+		return []FirmwareChange{}, nil
+	}
+	return append([]FirmwareChange{}, m.history[id]...), nil
+}
+
+func (m *MemoryFirmwareModel) Inventory(site string) ([]FirmwareInventory, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.cameras.mu.Lock()
+	defer m.cameras.mu.Unlock()
+
+	inventory := []FirmwareInventory{}
+	for _, camera := range m.cameras.cameras {
+		if site != "" && !strings.EqualFold(camera.SiteName, site) {
+			continue
+		}
+		i := FirmwareInventory{CameraID: camera.ID, Name: camera.Name, SiteName: camera.SiteName, ModelNo: camera.ModelNo}
+		if firmware, ok := m.current[camera.ID]; ok {
+			i.Firmware = &firmware
+		}
+		inventory = append(inventory, i)
+	}
+	slices.SortFunc(inventory, func(a, b FirmwareInventory) int { return cmp.Compare(a.CameraID, b.CameraID) })
+	return inventory, nil
+}
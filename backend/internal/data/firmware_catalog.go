@@ -0,0 +1,285 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/chefgoldbloom/pnctool/backend/internal/validator"
+)
+
+// ErrDuplicateModelNo is returned when the firmware catalog already has an entry for
+// the model.
+var ErrDuplicateModelNo = errors.New("duplicate model number")
+
+// versionRxp matches firmware versions like 10.12.114 or 2.21.02_20230209.
+var versionRxp = regexp.MustCompile(`^[0-9]+(\.[0-9]+)*([._+-][0-9A-Za-z._+-]+)?$`)
+
+// FirmwareCatalogEntry is the firmware a camera model should run. Cameras on
+// firmware before RecommendedVersion are outdated, and those before MinimumVersion
+// are vulnerable. An empty MinimumVersion means no version is known to be
+// vulnerable.
+type FirmwareCatalogEntry struct {
+	ID                 int64     `json:"id"`
+	CreatedAt          time.Time `json:"created_at"`
+	UpdatedAt          time.Time `json:"updated_at"`
+	ModelNo            string    `json:"model_no"`
+	RecommendedVersion string    `json:"recommended_version"`
+	MinimumVersion     string    `json:"minimum_version"`
+	Notes              string    `json:"notes"`
+	Version            int32     `json:"version"`
+}
+
+// Compliance rates firmware against the entry: FirmwareVulnerable,
+// FirmwareOutdated or FirmwareCurrent.
+func (e *FirmwareCatalogEntry) Compliance(firmware string) string {
+	switch {
+	case e.MinimumVersion != "" && CompareVersions(firmware, e.MinimumVersion) < 0:
+		return FirmwareVulnerable
+	case CompareVersions(firmware, e.RecommendedVersion) < 0:
+		return FirmwareOutdated
+	default:
+		return FirmwareCurrent
+	}
+}
+
+func ValidateFirmwareCatalogEntry(v *validator.Validator, e *FirmwareCatalogEntry) {
+	v.CheckCode(e.ModelNo != "", "model_no", validator.CodeRequired, "must be provided")
+	v.CheckCode(len(e.ModelNo) <= 100, "model_no", validator.CodeTooLong, "must not be more than 100 bytes long")
+	v.CheckCode(e.RecommendedVersion != "", "recommended_version", validator.CodeRequired, "must be provided")
+	if e.RecommendedVersion != "" {
+		v.CheckCode(len(e.RecommendedVersion) <= 50, "recommended_version", validator.CodeTooLong, "must not be more than 50 bytes long")
+		v.CheckCode(validator.Matches(e.RecommendedVersion, versionRxp), "recommended_version", validator.CodeBadFormat, "must be a version like 10.12.114")
+	}
+	if e.MinimumVersion != "" {
+		v.CheckCode(len(e.MinimumVersion) <= 50, "minimum_version", validator.CodeTooLong, "must not be more than 50 bytes long")
+		v.CheckCode(validator.Matches(e.MinimumVersion, versionRxp), "minimum_version", validator.CodeBadFormat, "must be a version like 10.12.114")
+		v.CheckCode(CompareVersions(e.MinimumVersion, e.RecommendedVersion) <= 0, "minimum_version", validator.CodeOutOfRange, "must not be after recommended_version")
+	}
+	v.CheckCode(len(e.Notes) <= 1000, "notes", validator.CodeTooLong, "must not be more than 1000 bytes long")
+}
+
+// FirmwareCatalogRepository stores the firmware catalog, one entry per model number,
+// compared without regard to case. FirmwareCatalogModel implements it on top of
+// Postgres and MemoryFirmwareCatalogModel implements it in memory for tests.
+type FirmwareCatalogRepository interface {
+	Insert(entry *FirmwareCatalogEntry) error
+	Get(id int64) (*FirmwareCatalogEntry, error)
+
+	// GetAll returns every entry, ordered by model number.
+	GetAll() ([]*FirmwareCatalogEntry, error)
+
+	Update(entry *FirmwareCatalogEntry) error
+	Delete(id int64) error
+}
+
+type FirmwareCatalogModel struct {
+	DB DBTX
+}
+
+// isDuplicateModelNo reports whether err is the unique index on model_no rejecting
+// an entry.
+func isDuplicateModelNo(err error) bool {
+	return err != nil && strings.Contains(err.Error(), "firmware_catalog_model_no_idx")
+}
+
+func (m FirmwareCatalogModel) Insert(e *FirmwareCatalogEntry) error {
+	query := `
+		insert into firmware_catalog (model_no, recommended_version, minimum_version, notes)
+		values ($1, $2, $3, $4)
+		returning id, created_at, updated_at, version
+	`
+	args := []any{e.ModelNo, e.RecommendedVersion, e.MinimumVersion, e.Notes}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, args...).Scan(&e.ID, &e.CreatedAt, &e.UpdatedAt, &e.Version)
+	if isDuplicateModelNo(err) {
+		return ErrDuplicateModelNo
+	}
+	return err
+}
+
+const firmwareCatalogColumns = "id, created_at, updated_at, model_no, recommended_version, minimum_version, notes, version"
+
+func scanFirmwareCatalogEntry(row interface{ Scan(...any) error }) (*FirmwareCatalogEntry, error) {
+	var e FirmwareCatalogEntry
+	err := row.Scan(&e.ID, &e.CreatedAt, &e.UpdatedAt, &e.ModelNo, &e.RecommendedVersion, &e.MinimumVersion, &e.Notes, &e.Version)
+	if err != nil {
+		return nil, err
+	}
+	return &e, nil
+}
+
+func (m FirmwareCatalogModel) Get(id int64) (*FirmwareCatalogEntry, error) {
+	if id < 1 {
+		return nil, ErrRecordNotFound
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	e, err := scanFirmwareCatalogEntry(m.DB.QueryRowContext(ctx, "select "+firmwareCatalogColumns+" from firmware_catalog where id = $1", id))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrRecordNotFound
+	}
+	return e, err
+}
+
+func (m FirmwareCatalogModel) GetAll() ([]*FirmwareCatalogEntry, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, "select "+firmwareCatalogColumns+" from firmware_catalog order by lower(model_no)")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	entries := []*FirmwareCatalogEntry{}
+	for rows.Next() {
+		e, err := scanFirmwareCatalogEntry(rows)
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, e)
+	}
+	return entries, rows.Err()
+}
+
+func (m FirmwareCatalogModel) Update(e *FirmwareCatalogEntry) error {
+	query := `
+		update firmware_catalog
+		set model_no = $1, recommended_version = $2, minimum_version = $3, notes = $4,
+			updated_at = now(), version = version + 1
+		where id = $5 and version = $6
+		returning updated_at, version
+	`
+	args := []any{e.ModelNo, e.RecommendedVersion, e.MinimumVersion, e.Notes, e.ID, e.Version}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, args...).Scan(&e.UpdatedAt, &e.Version)
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		return ErrEditConflict
+	case isDuplicateModelNo(err):
+		return ErrDuplicateModelNo
+	}
+	return err
+}
+
+func (m FirmwareCatalogModel) Delete(id int64) error {
+	if id < 1 {
+		return ErrRecordNotFound
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, `delete from firmware_catalog where id = $1 returning id`, id).Scan(&id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrRecordNotFound
+	}
+	return err
+}
+
+// MemoryFirmwareCatalogModel is an in-memory FirmwareCatalogRepository.
+type MemoryFirmwareCatalogModel struct {
+	mu      sync.Mutex
+	nextID  int64
+	entries map[int64]FirmwareCatalogEntry
+}
+
+func NewMemoryFirmwareCatalogModel() *MemoryFirmwareCatalogModel {
+	return &MemoryFirmwareCatalogModel{nextID: 1, entries: make(map[int64]FirmwareCatalogEntry)}
+}
+
+// duplicate reports whether another entry has e's model number. It must be called
+// with mu held.
+func (m *MemoryFirmwareCatalogModel) duplicate(e *FirmwareCatalogEntry) bool {
+	for id, stored := range m.entries {
+		if id != e.ID && strings.EqualFold(stored.ModelNo, e.ModelNo) {
+			return true
+		}
+	}
+	return false
+}
+
+func (m *MemoryFirmwareCatalogModel) Insert(e *FirmwareCatalogEntry) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	e.ID = 0
+	if m.duplicate(e) {
+		return ErrDuplicateModelNo
+	}
+	e.ID = m.nextID
+	e.CreatedAt = time.Now().Truncate(time.Second)
+	e.UpdatedAt = e.CreatedAt
+	e.Version = 1
+	m.nextID++
+	m.entries[e.ID] = *e
+	return nil
+}
+
+func (m *MemoryFirmwareCatalogModel) Get(id int64) (*FirmwareCatalogEntry, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	e, ok := m.entries[id]
+	if !ok {
+		return nil, ErrRecordNotFound
+	}
+	return &e, nil
+}
+
+func (m *MemoryFirmwareCatalogModel) GetAll() ([]*FirmwareCatalogEntry, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	entries := []*FirmwareCatalogEntry{}
+	for _, e := range m.entries {
+		e := e
+		entries = append(entries, &e)
+	}
+	slices.SortFunc(entries, func(a, b *FirmwareCatalogEntry) int {
+		return strings.Compare(strings.ToLower(a.ModelNo), strings.ToLower(b.ModelNo))
+	})
+	return entries, nil
+}
+
+func (m *MemoryFirmwareCatalogModel) Update(e *FirmwareCatalogEntry) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	stored, ok := m.entries[e.ID]
+	if !ok || stored.Version != e.Version {
+		return ErrEditConflict
+	}
+	if m.duplicate(e) {
+		return ErrDuplicateModelNo
+	}
+	e.UpdatedAt = time.Now().Truncate(time.Second)
+	e.Version++
+	m.entries[e.ID] = *e
+	return nil
+}
+
+func (m *MemoryFirmwareCatalogModel) Delete(id int64) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.entries[id]; !ok {
+		return ErrRecordNotFound
+	}
+	delete(m.entries, id)
+	return nil
+}
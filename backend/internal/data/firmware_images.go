@@ -0,0 +1,219 @@
+package data
+
+import (
+	"cmp"
+	"context"
+	"database/sql"
+	"errors"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/chefgoldbloom/pnctool/backend/internal/validator"
+)
+
+var (
+	// ErrDuplicateFirmwareImage is returned when an image with the same contents has
+	// already been uploaded.
+	ErrDuplicateFirmwareImage = errors.New("duplicate firmware image")
+
+	// ErrFirmwareImageInUse is returned when deleting an image an upgrade campaign
+	// refers to.
+	ErrFirmwareImageInUse = errors.New("firmware image in use")
+)
+
+// FirmwareImage is an uploaded firmware file, kept in the artifact store under its
+// SHA256 digest. Firmware is the version the image installs, which the upgrade is
+// verified against.
+type FirmwareImage struct {
+	ID         int64     `json:"id"`
+	CreatedAt  time.Time `json:"created_at"`
+	UploadedBy string    `json:"uploaded_by"`
+	ModelNo    string    `json:"model_no"`
+	Firmware   string    `json:"firmware"`
+	Filename   string    `json:"filename"`
+	Size       int64     `json:"size"`
+	SHA256     string    `json:"sha256"`
+}
+
+func ValidateFirmwareImage(v *validator.Validator, image *FirmwareImage) {
+	v.CheckCode(image.ModelNo != "", "model_no", validator.CodeRequired, "must be provided")
+	v.CheckCode(len(image.ModelNo) <= 100, "model_no", validator.CodeTooLong, "must not be more than 100 bytes long")
+	v.CheckCode(image.Firmware != "", "firmware", validator.CodeRequired, "must be provided")
+	if image.Firmware != "" {
+		v.CheckCode(len(image.Firmware) <= 50, "firmware", validator.CodeTooLong, "must not be more than 50 bytes long")
+		v.CheckCode(validator.Matches(image.Firmware, versionRxp), "firmware", validator.CodeBadFormat, "must be a version like 10.12.114")
+	}
+	v.CheckCode(len(image.Filename) <= 255, "filename", validator.CodeTooLong, "must not be more than 255 bytes long")
+}
+
+// FirmwareImageRepository stores the details of uploaded firmware images; the files
+// themselves are in the artifact store. FirmwareImageModel implements it on top of
+// Postgres and MemoryFirmwareImageModel implements it in memory for tests.
+type FirmwareImageRepository interface {
+	// Insert returns ErrDuplicateFirmwareImage if an image with the same SHA256 has
+	// been uploaded.
+	Insert(image *FirmwareImage) error
+	Get(id int64) (*FirmwareImage, error)
+
+	// GetAll returns every image, newest first.
+	GetAll() ([]*FirmwareImage, error)
+
+	// Delete returns ErrFirmwareImageInUse if an upgrade campaign refers to the image.
+	Delete(id int64) error
+}
+
+type FirmwareImageModel struct {
+	DB DBTX
+}
+
+func (m FirmwareImageModel) Insert(image *FirmwareImage) error {
+	query := `
+		insert into firmware_images (uploaded_by, model_no, firmware, filename, size, sha256)
+		values ($1, $2, $3, $4, $5, $6)
+		returning id, created_at
+	`
+	args := []any{image.UploadedBy, image.ModelNo, image.Firmware, image.Filename, image.Size, image.SHA256}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, args...).Scan(&image.ID, &image.CreatedAt)
+	if err != nil && strings.Contains(err.Error(), "firmware_images_sha256_idx") {
+		return ErrDuplicateFirmwareImage
+	}
+	return err
+}
+
+const firmwareImageColumns = "id, created_at, uploaded_by, model_no, firmware, filename, size, sha256"
+
+func scanFirmwareImage(row interface{ Scan(...any) error }) (*FirmwareImage, error) {
+	var image FirmwareImage
+	err := row.Scan(&image.ID, &image.CreatedAt, &image.UploadedBy, &image.ModelNo, &image.Firmware, &image.Filename, &image.Size, &image.SHA256)
+	if err != nil {
+		return nil, err
+	}
+	return &image, nil
+}
+
+func (m FirmwareImageModel) Get(id int64) (*FirmwareImage, error) {
+	if id < 1 {
+		return nil, ErrRecordNotFound
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	image, err := scanFirmwareImage(m.DB.QueryRowContext(ctx, "select "+firmwareImageColumns+" from firmware_images where id = $1", id))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrRecordNotFound
+	}
+	return image, err
+}
+
+func (m FirmwareImageModel) GetAll() ([]*FirmwareImage, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, "select "+firmwareImageColumns+" from firmware_images order by id desc")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	images := []*FirmwareImage{}
+	for rows.Next() {
+		image, err := scanFirmwareImage(rows)
+		if err != nil {
+			return nil, err
+		}
+		images = append(images, image)
+	}
+	return images, rows.Err()
+}
+
+func (m FirmwareImageModel) Delete(id int64) error {
+	if id < 1 {
+		return ErrRecordNotFound
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, `delete from firmware_images where id = $1 returning id`, id).Scan(&id)
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		return ErrRecordNotFound
+	case err != nil && strings.Contains(err.Error(), "upgrade_campaigns_image_id_fkey"):
+		return ErrFirmwareImageInUse
+	}
+	return err
+}
+
+// MemoryFirmwareImageModel is an in-memory FirmwareImageRepository. The
+// MemoryUpgradeModel made with it tells it which images campaigns refer to.
+type MemoryFirmwareImageModel struct {
+	mu       sync.Mutex
+	nextID   int64
+	images   map[int64]FirmwareImage
+	upgrades *MemoryUpgradeModel
+}
+
+func NewMemoryFirmwareImageModel() *MemoryFirmwareImageModel {
+	return &MemoryFirmwareImageModel{nextID: 1, images: make(map[int64]FirmwareImage)}
+}
+
+func (m *MemoryFirmwareImageModel) Insert(image *FirmwareImage) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, stored := range m.images {
+		if stored.SHA256 == image.SHA256 {
+			return ErrDuplicateFirmwareImage
+		}
+	}
+	image.ID = m.nextID
+	image.CreatedAt = time.Now().Truncate(time.Second)
+	m.nextID++
+	m.images[image.ID] = *image
+	return nil
+}
+
+func (m *MemoryFirmwareImageModel) Get(id int64) (*FirmwareImage, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	image, ok := m.images[id]
+	if !ok {
+		return nil, ErrRecordNotFound
+	}
+	return &image, nil
+}
+
+func (m *MemoryFirmwareImageModel) GetAll() ([]*FirmwareImage, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	images := []*FirmwareImage{}
+	for _, image := range m.images {
+		image := image
+		images = append(images, &image)
+	}
+	slices.SortFunc(images, func(a, b *FirmwareImage) int { return cmp.Compare(b.ID, a.ID) })
+	return images, nil
+}
+
+func (m *MemoryFirmwareImageModel) Delete(id int64) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.images[id]; !ok {
+		return ErrRecordNotFound
+	}
+	if m.upgrades != nil && m.upgrades.usesImage(id) {
+		return ErrFirmwareImageInUse
+	}
+	delete(m.images, id)
+	return nil
+}
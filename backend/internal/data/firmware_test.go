@@ -0,0 +1,223 @@
+package data
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/chefgoldbloom/pnctool/backend/internal/validator"
+)
+
+// testFirmwareRepository records firmware through repo for cameras stored in cameras,
+// which must share its data.
+func testFirmwareRepository(t *testing.T, cameras CameraRepository, repo FirmwareRepository) {
+	for _, c := range []*Camera{
+		{Name: "lobby", MacAddress: "ACCC8E000001", SiteName: "NYC-5th-GLH", ModelNo: "P3245-LV"},
+		{Name: "gate", MacAddress: "ACCC8E000002", SiteName: "BOS-Main-GLH", ModelNo: "P3245-LV"},
+		{Name: "dock", MacAddress: "ACCC8E000003", SiteName: "NYC-5th-GLH"},
+	} {
+		if err := cameras.Insert(c); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	at := time.Date(2026, 3, 2, 9, 0, 0, 0, time.UTC)
+	record := func(id int64, firmware string, minutes int) string {
+		t.Helper()
+		previous, err := repo.Record(id, &CameraFirmware{Model: "P3245-LV", Firmware: firmware, CollectedAt: at.Add(time.Duration(minutes) * time.Minute)})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return previous
+	}
+
+	if previous := record(1, "10.9.2", 0); previous != "" {
+		t.Errorf("first Record: previous = %q; want none", previous)
+	}
+	if previous := record(1, "10.9.2", 60); previous != "10.9.2" {
+		t.Errorf("second Record: previous = %q; want 10.9.2", previous)
+	}
+	if previous := record(1, "10.12.114", 120); previous != "10.9.2" {
+		t.Errorf("Record after an upgrade: previous = %q; want 10.9.2", previous)
+	}
+	record(2, "9.80.1", 0)
+
+	if _, err := repo.Record(99, &CameraFirmware{Firmware: "1.0", CollectedAt: at}); !errors.Is(err, ErrRecordNotFound) {
+		t.Errorf("Record for a missing camera: err = %v; want ErrRecordNotFound", err)
+	}
+
+	firmware, err := repo.Get(1)
+	if err != nil || firmware.Firmware != "10.12.114" || firmware.Model != "P3245-LV" || !firmware.CollectedAt.Equal(at.Add(2*time.Hour)) {
+		t.Errorf("Get(1) = %+v, %v", firmware, err)
+	}
+	if _, err := repo.Get(3); !errors.Is(err, ErrRecordNotFound) {
+		t.Errorf("Get of a camera which hasn't reported: err = %v; want ErrRecordNotFound", err)
+	}
+
+	changes, err := repo.History(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(changes) != 2 || changes[0].Firmware != "10.9.2" || !changes[0].ChangedAt.Equal(at) ||
+		changes[1].Firmware != "10.12.114" || changes[1].Model != "P3245-LV" || !changes[1].ChangedAt.Equal(at.Add(2*time.Hour)) {
+		t.Errorf("History(1) = %+v; want the first firmware and the upgrade", changes)
+	}
+	if changes, err := repo.History(3); err != nil || len(changes) != 0 {
+		t.Errorf("History(3) = %v, %v; want no changes", changes, err)
+	}
+
+	inventory, err := repo.Inventory("nyc-5th-glh")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(inventory) != 2 || inventory[0].CameraID != 1 || inventory[0].Firmware == nil || inventory[0].Firmware.Firmware != "10.12.114" ||
+		inventory[1].CameraID != 3 || inventory[1].Firmware != nil || inventory[1].ModelNo != "" {
+		t.Errorf("Inventory(nyc-5th-glh) = %+v", inventory)
+	}
+	if inventory, _ := repo.Inventory(""); len(inventory) != 3 || inventory[1].Name != "gate" || inventory[1].ModelNo != "P3245-LV" {
+		t.Errorf("Inventory of every site = %+v", inventory)
+	}
+
+	// A deleted camera's firmware goes with it.
+	if err := cameras.Delete(1); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := repo.Get(1); !errors.Is(err, ErrRecordNotFound) {
+		t.Errorf("Get after deleting the camera: err = %v; want ErrRecordNotFound", err)
+	}
+	if changes, _ := repo.History(1); len(changes) != 0 {
+		t.Errorf("History after deleting the camera = %v", changes)
+	}
+}
+
+func TestFirmwareModel(t *testing.T) {
+	db := newTestDB(t)
+	testFirmwareRepository(t, CameraModel{DB: db}, FirmwareModel{DB: db})
+}
+
+func TestMemoryFirmwareModel(t *testing.T) {
+	cameras := NewMemoryCameraModel()
+	testFirmwareRepository(t, cameras, NewMemoryFirmwareModel(cameras))
+}
+
+func testFirmwareCatalogRepository(t *testing.T, repo FirmwareCatalogRepository) {
+	for _, e := range []*FirmwareCatalogEntry{
+		{ModelNo: "XNV-6080", RecommendedVersion: "2.21.02"},
+		{ModelNo: "P3245-LV", RecommendedVersion: "10.12.114", MinimumVersion: "10.9.0", Notes: "CVE-2025-0001"},
+	} {
+		if err := repo.Insert(e); err != nil {
+			t.Fatal(err)
+		}
+		if e.ID == 0 || e.CreatedAt.IsZero() || e.UpdatedAt.IsZero() || e.Version != 1 {
+			t.Fatalf("Insert didn't set id, timestamps and version: %+v", e)
+		}
+	}
+
+	if err := repo.Insert(&FirmwareCatalogEntry{ModelNo: "p3245-lv", RecommendedVersion: "11.0"}); !errors.Is(err, ErrDuplicateModelNo) {
+		t.Errorf("Insert of a model already in the catalog: err = %v; want ErrDuplicateModelNo", err)
+	}
+
+	entries, err := repo.GetAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 2 || entries[0].ModelNo != "P3245-LV" || entries[1].ModelNo != "XNV-6080" {
+		t.Errorf("GetAll = %+v; want the entries by model number", entries)
+	}
+
+	entry, err := repo.Get(2)
+	if err != nil || entry.MinimumVersion != "10.9.0" || entry.Notes != "CVE-2025-0001" {
+		t.Fatalf("Get(2) = %+v, %v", entry, err)
+	}
+	entry.RecommendedVersion = "11.1.66"
+	if err := repo.Update(entry); err != nil {
+		t.Fatal(err)
+	}
+	if entry.Version != 2 {
+		t.Errorf("version after Update = %d; want 2", entry.Version)
+	}
+	entry.Version = 1
+	if err := repo.Update(entry); !errors.Is(err, ErrEditConflict) {
+		t.Errorf("Update of a stale entry: err = %v; want ErrEditConflict", err)
+	}
+	entry.Version, entry.ModelNo = 2, "xnv-6080"
+	if err := repo.Update(entry); !errors.Is(err, ErrDuplicateModelNo) {
+		t.Errorf("Update to a model already in the catalog: err = %v; want ErrDuplicateModelNo", err)
+	}
+	if stored, _ := repo.Get(2); stored.RecommendedVersion != "11.1.66" || stored.ModelNo != "P3245-LV" {
+		t.Errorf("stored entry = %+v", stored)
+	}
+
+	if err := repo.Delete(1); err != nil {
+		t.Fatal(err)
+	}
+	if err := repo.Delete(1); !errors.Is(err, ErrRecordNotFound) {
+		t.Errorf("second Delete: err = %v; want ErrRecordNotFound", err)
+	}
+	if _, err := repo.Get(1); !errors.Is(err, ErrRecordNotFound) {
+		t.Errorf("Get after Delete: err = %v; want ErrRecordNotFound", err)
+	}
+}
+
+func TestFirmwareCatalogModel(t *testing.T) {
+	testFirmwareCatalogRepository(t, FirmwareCatalogModel{DB: newTestDB(t)})
+}
+
+func TestMemoryFirmwareCatalogModel(t *testing.T) {
+	testFirmwareCatalogRepository(t, NewMemoryFirmwareCatalogModel())
+}
+
+func TestCompareVersions(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want int
+	}{
+		{"10.12.114", "10.12.114", 0},
+		{"10.12.114", "10.9.2", 1},
+		{"9.80.1", "10.0", -1},
+		{"2.21", "2.21.0", 0},
+		{"2.21.02_20230209", "2.21.02", 1},
+		{"2.21.02", "2.21.2", 0},
+		{"7.80.0128", "7.80.129", -1},
+		{"1.0.99999999999999999999", "1.0.100000000000000000000", -1},
+		{"", "1.0", -1},
+	}
+
+	for _, tt := range tests {
+		if got := CompareVersions(tt.a, tt.b); got != tt.want {
+			t.Errorf("CompareVersions(%q, %q) = %d; want %d", tt.a, tt.b, got, tt.want)
+		}
+		if got := CompareVersions(tt.b, tt.a); got != -tt.want {
+			t.Errorf("CompareVersions(%q, %q) = %d; want %d", tt.b, tt.a, got, -tt.want)
+		}
+	}
+}
+
+func TestValidateFirmwareCatalogEntry(t *testing.T) {
+	tests := []struct {
+		name   string
+		entry  FirmwareCatalogEntry
+		fields string
+	}{
+		{"valid", FirmwareCatalogEntry{ModelNo: "P3245-LV", RecommendedVersion: "10.12.114", MinimumVersion: "10.9"}, "[]"},
+		{"vendor suffix", FirmwareCatalogEntry{ModelNo: "XNV-6080", RecommendedVersion: "2.21.02_20230209"}, "[]"},
+		{"missing", FirmwareCatalogEntry{}, "[model_no recommended_version]"},
+		{"bad versions", FirmwareCatalogEntry{ModelNo: "P3245-LV", RecommendedVersion: "latest", MinimumVersion: "v10"}, "[minimum_version recommended_version]"},
+		{"minimum after recommended", FirmwareCatalogEntry{ModelNo: "P3245-LV", RecommendedVersion: "10.9", MinimumVersion: "10.12.114"}, "[minimum_version]"},
+	}
+
+	for _, tt := range tests {
+		v := validator.New()
+		ValidateFirmwareCatalogEntry(v, &tt.entry)
+		var fields []string
+		for field := range v.Errors {
+			fields = append(fields, field)
+		}
+		slices.Sort(fields)
+		if got := fmt.Sprint(fields); got != tt.fields {
+			t.Errorf("%s: errors on %s; want %s", tt.name, got, tt.fields)
+		}
+	}
+}
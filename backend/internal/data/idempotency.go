@@ -0,0 +1,132 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+)
+
+// IdempotencyRecord is a POST request identified by its Idempotency-Key header and
+// the user who sent it, and the response it produced once it has completed. A record
+// without a Status is still being processed, until its lease runs out.
+type IdempotencyRecord struct {
+	Key            string
+	Method         string
+	Path           string
+	User           string // X-User of the request, or "" if it was anonymous
+	RequestHash    string // hex SHA-256 of the request, used to detect a reused key
+	Status         int
+	Header         http.Header
+	Body           []byte
+	ExpiresAt      time.Time
+	LeaseExpiresAt time.Time // a pending record past this was abandoned by its holder
+}
+
+// Completed reports whether the response has been stored.
+func (rec *IdempotencyRecord) Completed() bool {
+	return rec.Status != 0
+}
+
+// IdempotencyRepository stores idempotency records. Reserve claims a key for a new
+// request; if the key is already claimed and neither expired nor, while pending, past
+// its lease, it returns the existing record instead and leaves the store unchanged.
+type IdempotencyRepository interface {
+	Reserve(rec *IdempotencyRecord) (existing *IdempotencyRecord, err error)
+	Complete(rec *IdempotencyRecord) error
+	Release(rec *IdempotencyRecord) error
+}
+
+type IdempotencyModel struct {
+	DB *sql.DB
+}
+
+// Reserve inserts a pending record for rec, replacing an expired one or a pending one
+// whose lease has run out because its holder crashed. It returns nil if the key was
+// claimed, or the stored record if somebody else holds it.
+func (m IdempotencyModel) Reserve(rec *IdempotencyRecord) (*IdempotencyRecord, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	args := []any{rec.Key, rec.Method, rec.Path, rec.User}
+
+	_, err := m.DB.ExecContext(ctx, `
+		DELETE FROM idempotency_keys
+		WHERE key = $1 AND method = $2 AND path = $3 AND user_name = $4
+		AND (expires_at < NOW() OR (status IS NULL AND lease_expires_at < NOW()))
+	`, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	var claimed string
+	err = m.DB.QueryRowContext(ctx, `
+		INSERT INTO idempotency_keys (key, method, path, user_name, request_hash, expires_at, lease_expires_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		ON CONFLICT DO NOTHING
+		RETURNING key
+	`, rec.Key, rec.Method, rec.Path, rec.User, rec.RequestHash, rec.ExpiresAt, rec.LeaseExpiresAt).Scan(&claimed)
+	if err == nil {
+		return nil, nil
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return nil, err
+	}
+
+	existing := IdempotencyRecord{Key: rec.Key, Method: rec.Method, Path: rec.Path, User: rec.User}
+	var (
+		status  sql.NullInt64
+		headers []byte
+	)
+	err = m.DB.QueryRowContext(ctx, `
+		SELECT request_hash, status, headers, body, expires_at, lease_expires_at
+		FROM idempotency_keys
+		WHERE key = $1 AND method = $2 AND path = $3 AND user_name = $4
+	`, args...).Scan(&existing.RequestHash, &status, &headers, &existing.Body, &existing.ExpiresAt, &existing.LeaseExpiresAt)
+	if err != nil {
+		// The holder released the key between our insert and select, so the caller
+		// should simply try again.
+		if errors.Is(err, sql.ErrNoRows) {
+			return m.Reserve(rec)
+		}
+		return nil, err
+	}
+	existing.Status = int(status.Int64)
+	if err := json.Unmarshal(headers, &existing.Header); err != nil {
+		return nil, err
+	}
+	return &existing, nil
+}
+
+// Complete stores the response for a record previously claimed with Reserve.
+func (m IdempotencyModel) Complete(rec *IdempotencyRecord) error {
+	headers, err := json.Marshal(rec.Header)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err = m.DB.ExecContext(ctx, `
+		UPDATE idempotency_keys
+		SET status = $5, headers = $6, body = $7
+		WHERE key = $1 AND method = $2 AND path = $3 AND user_name = $4
+	`, rec.Key, rec.Method, rec.Path, rec.User, rec.Status, headers, rec.Body)
+	return err
+}
+
+// Release deletes a claimed record without storing a response, so the request can be
+// retried.
+func (m IdempotencyModel) Release(rec *IdempotencyRecord) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, `
+		DELETE FROM idempotency_keys
+		WHERE key = $1 AND method = $2 AND path = $3 AND user_name = $4 AND status IS NULL
+	`, rec.Key, rec.Method, rec.Path, rec.User)
+	return err
+}
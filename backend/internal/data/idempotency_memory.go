@@ -0,0 +1,51 @@
+package data
+
+import (
+	"sync"
+	"time"
+)
+
+// MemoryIdempotencyModel is an in-memory IdempotencyRepository with the same
+// semantics as IdempotencyModel.
+type MemoryIdempotencyModel struct {
+	mu      sync.Mutex
+	records map[[4]string]IdempotencyRecord
+}
+
+func NewMemoryIdempotencyModel() *MemoryIdempotencyModel {
+	return &MemoryIdempotencyModel{records: make(map[[4]string]IdempotencyRecord)}
+}
+
+func idempotencyKey(rec *IdempotencyRecord) [4]string {
+	return [4]string{rec.Key, rec.Method, rec.Path, rec.User}
+}
+
+func (m *MemoryIdempotencyModel) Reserve(rec *IdempotencyRecord) (*IdempotencyRecord, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now()
+	if existing, ok := m.records[idempotencyKey(rec)]; ok && existing.ExpiresAt.After(now) && (existing.Completed() || existing.LeaseExpiresAt.After(now)) {
+		return &existing, nil
+	}
+	m.records[idempotencyKey(rec)] = *rec
+	return nil, nil
+}
+
+func (m *MemoryIdempotencyModel) Complete(rec *IdempotencyRecord) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.records[idempotencyKey(rec)] = *rec
+	return nil
+}
+
+func (m *MemoryIdempotencyModel) Release(rec *IdempotencyRecord) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if existing, ok := m.records[idempotencyKey(rec)]; ok && !existing.Completed() {
+		delete(m.records, idempotencyKey(rec))
+	}
+	return nil
+}
@@ -0,0 +1,75 @@
+package data
+
+import (
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestIdempotencyModel(t *testing.T) {
+	m := IdempotencyModel{DB: newTestDB(t)}
+
+	rec := &IdempotencyRecord{Key: "k", Method: http.MethodPost, Path: "/v1/cameras", RequestHash: "abc", ExpiresAt: time.Now().Add(time.Hour), LeaseExpiresAt: time.Now().Add(time.Minute)}
+
+	existing, err := m.Reserve(rec)
+	if err != nil || existing != nil {
+		t.Fatalf("first reserve: existing = %v, err = %v", existing, err)
+	}
+
+	existing, err = m.Reserve(rec)
+	if err != nil || existing == nil || existing.Completed() {
+		t.Fatalf("pending reserve: existing = %+v, err = %v", existing, err)
+	}
+
+	rec.Status = http.StatusCreated
+	rec.Header = http.Header{"Location": []string{"/v1/cameras/1"}}
+	rec.Body = []byte(`{"camera":{}}`)
+	if err := m.Complete(rec); err != nil {
+		t.Fatal(err)
+	}
+
+	existing, err = m.Reserve(rec)
+	if err != nil || existing == nil || existing.Status != http.StatusCreated || string(existing.Body) != string(rec.Body) || existing.Header.Get("Location") != "/v1/cameras/1" {
+		t.Fatalf("completed reserve: existing = %+v, err = %v", existing, err)
+	}
+
+	// Release only removes pending records.
+	if err := m.Release(rec); err != nil {
+		t.Fatal(err)
+	}
+	if existing, _ := m.Reserve(rec); existing == nil {
+		t.Error("Release removed a completed record")
+	}
+
+	// Keys belong to the user sending them; another user's key is unrelated.
+	other := *rec
+	other.User = "ben"
+	other.Status, other.Header, other.Body = 0, nil, nil
+	if existing, err := m.Reserve(&other); err != nil || existing != nil {
+		t.Errorf("another user's reserve: existing = %+v, err = %v", existing, err)
+	}
+
+	expired := &IdempotencyRecord{Key: "old", Method: http.MethodPost, Path: "/v1/cameras", RequestHash: "abc", ExpiresAt: time.Now().Add(-time.Hour), LeaseExpiresAt: time.Now().Add(time.Minute)}
+	if _, err := m.Reserve(expired); err != nil {
+		t.Fatal(err)
+	}
+	expired.ExpiresAt = time.Now().Add(time.Hour)
+	if existing, err := m.Reserve(expired); err != nil || existing != nil {
+		t.Errorf("expired record was not replaced: existing = %+v, err = %v", existing, err)
+	}
+
+	// A pending record whose holder crashed is taken over once its lease runs out,
+	// as if the key had never been used.
+	abandoned := &IdempotencyRecord{Key: "crashed", Method: http.MethodPost, Path: "/v1/cameras", RequestHash: "abc", ExpiresAt: time.Now().Add(time.Hour), LeaseExpiresAt: time.Now().Add(-time.Minute)}
+	if _, err := m.Reserve(abandoned); err != nil {
+		t.Fatal(err)
+	}
+	retry := *abandoned
+	retry.LeaseExpiresAt = time.Now().Add(time.Minute)
+	if existing, err := m.Reserve(&retry); err != nil || existing != nil {
+		t.Errorf("abandoned record was not taken over: existing = %+v, err = %v", existing, err)
+	}
+	if existing, err := m.Reserve(&retry); err != nil || existing == nil || existing.Completed() {
+		t.Errorf("taken over record: existing = %+v, err = %v", existing, err)
+	}
+}
@@ -0,0 +1,369 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/chefgoldbloom/pnctool/backend/internal/validator"
+)
+
+// Incident states. An incident is opened by the status poller, may be acknowledged
+// by a user, and is resolved when the camera recovers or by a user. Resolved
+// incidents stay resolved.
+const (
+	IncidentOpen         = "open"
+	IncidentAcknowledged = "acknowledged"
+	IncidentResolved     = "resolved"
+)
+
+var IncidentStateSafelist = []string{IncidentOpen, IncidentAcknowledged, IncidentResolved}
+
+// Incident is an outage of one camera. CameraName and SiteName are the camera's
+// current ones. ResolvedBy is empty if the incident was resolved by the camera
+// recovering.
+type Incident struct {
+	ID             int64          `json:"id"`
+	CameraID       int64          `json:"camera_id"`
+	CameraName     string         `json:"camera_name"`
+	SiteName       string         `json:"site_name"`
+	State          string         `json:"state"`
+	Failures       int            `json:"failures"`
+	OpenedAt       time.Time      `json:"opened_at"`
+	AcknowledgedAt *time.Time     `json:"acknowledged_at"`
+	AcknowledgedBy string         `json:"acknowledged_by"`
+	ResolvedAt     *time.Time     `json:"resolved_at"`
+	ResolvedBy     string         `json:"resolved_by"`
+	Assignee       string         `json:"assignee"`
+	Notes          []IncidentNote `json:"notes,omitempty"`
+	Version        int32          `json:"version"`
+}
+
+// IncidentNote is a comment on an incident.
+type IncidentNote struct {
+	ID         int64     `json:"id"`
+	IncidentID int64     `json:"incident_id"`
+	CreatedAt  time.Time `json:"created_at"`
+	Author     string    `json:"author"`
+	Body       string    `json:"body"`
+}
+
+// SetState moves the incident to state on behalf of user. It doesn't check the
+// move is allowed; ValidateIncidentState does.
+func (i *Incident) SetState(state, user string, at time.Time) {
+	if state == i.State {
+		return
+	}
+	at = at.Truncate(time.Second)
+	switch state {
+	case IncidentAcknowledged:
+		i.AcknowledgedAt, i.AcknowledgedBy = &at, user
+	case IncidentResolved:
+		i.ResolvedAt, i.ResolvedBy = &at, user
+	}
+	i.State = state
+}
+
+// ValidateIncidentState checks that an incident in state from can move to state to.
+// Incidents only move forward: open, acknowledged, resolved.
+func ValidateIncidentState(v *validator.Validator, from, to string) {
+	if !validator.PermittedValue(to, IncidentStateSafelist...) {
+		v.AddErrorCode("state", validator.CodeNotPermitted, "must be one of: "+strings.Join(IncidentStateSafelist, ", "))
+		return
+	}
+	order := map[string]int{IncidentOpen: 0, IncidentAcknowledged: 1, IncidentResolved: 2}
+	v.CheckCode(to == from || order[to] > order[from], "state", validator.CodeNotPermitted, fmt.Sprintf("cannot change from %s to %s", from, to))
+}
+
+func ValidateIncident(v *validator.Validator, incident *Incident) {
+	v.CheckCode(len(incident.Assignee) <= 100, "assignee", validator.CodeTooLong, "must not be more than 100 bytes long")
+}
+
+func ValidateIncidentNote(v *validator.Validator, note *IncidentNote) {
+	v.CheckCode(strings.TrimSpace(note.Body) != "", "body", validator.CodeRequired, "must be provided")
+	v.CheckCode(len(note.Body) <= 2000, "body", validator.CodeTooLong, "must not be more than 2000 bytes long")
+}
+
+// IncidentFilter restricts GetAll to incidents matching every non-empty field. Sites
+// match case-insensitively. OpenedAfter and OpenedBefore are inclusive.
+type IncidentFilter struct {
+	SiteName     string
+	CameraID     int64
+	States       []string
+	OpenedAfter  time.Time
+	OpenedBefore time.Time
+}
+
+// IncidentRepository stores incidents. IncidentModel implements it on top of
+// Postgres and MemoryIncidentModel implements it in memory for tests.
+type IncidentRepository interface {
+	// Open opens an incident for the camera at, unless it has one which isn't
+	// resolved, and returns the camera's incident. opened reports whether it's new.
+	// It returns ErrRecordNotFound if the camera has been deleted.
+	Open(cameraID int64, failures int, at time.Time) (incident *Incident, opened bool, err error)
+
+	// Resolve resolves the incident at, as the camera has recovered. Incidents which
+	// are already resolved are left alone.
+	Resolve(id int64, at time.Time) error
+
+	// Unresolved returns the ID of the incident which isn't resolved of each camera
+	// with one, by camera ID.
+	Unresolved() (map[int64]int64, error)
+
+	// Get returns the incident with its notes, oldest first.
+	Get(id int64) (*Incident, error)
+	GetAll(filter IncidentFilter, filters Filters) ([]*Incident, Metadata, error)
+
+	// Update saves the incident's state and assignee if its version still matches.
+	Update(incident *Incident) error
+
+	// AddNote adds a note to the incident and sets its ID and CreatedAt. It returns
+	// ErrRecordNotFound if there's no such incident.
+	AddNote(note *IncidentNote) error
+}
+
+type IncidentModel struct {
+	DB DBTX
+}
+
+const incidentColumns = `i.id, i.camera_id, c.name, c.site_name, i.state, i.failures, i.opened_at,
+		i.acknowledged_at, i.acknowledged_by, i.resolved_at, i.resolved_by, i.assignee, i.version`
+
+func scanIncident(row interface{ Scan(...any) error }, dest ...any) (*Incident, error) {
+	var (
+		i                          Incident
+		acknowledgedAt, resolvedAt sql.NullTime
+	)
+	err := row.Scan(append(dest, &i.ID, &i.CameraID, &i.CameraName, &i.SiteName, &i.State, &i.Failures, &i.OpenedAt,
+		&acknowledgedAt, &i.AcknowledgedBy, &resolvedAt, &i.ResolvedBy, &i.Assignee, &i.Version)...)
+	if err != nil {
+		return nil, err
+	}
+	if acknowledgedAt.Valid {
+		i.AcknowledgedAt = &acknowledgedAt.Time
+	}
+	if resolvedAt.Valid {
+		i.ResolvedAt = &resolvedAt.Time
+	}
+	return &i, nil
+}
+
+func (m IncidentModel) Open(cameraID int64, failures int, at time.Time) (*Incident, bool, error) {
+	// The second select can't see the row the first inserts, so exactly one of them
+	// returns a row unless the camera is gone.
+	query := `
+		with inserted as (
+			insert into incidents (camera_id, failures, opened_at)
+			select id, $2::integer, $3::timestamptz from cameras where id = $1
+			on conflict (camera_id) where state <> 'resolved' do nothing
+			returning id
+		)
+		select id, true from inserted
+		union all
+		select id, false from incidents where camera_id = $1 and state <> 'resolved'
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var (
+		id     int64
+		opened bool
+	)
+	err := m.DB.QueryRowContext(ctx, query, cameraID, failures, at).Scan(&id, &opened)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, false, ErrRecordNotFound
+		}
+		return nil, false, err
+	}
+
+	incident, err := m.Get(id)
+	return incident, opened, err
+}
+
+func (m IncidentModel) Resolve(id int64, at time.Time) error {
+	query := `
+		update incidents
+		set state = 'resolved', resolved_at = $2, version = version + 1
+		where id = $1 and state <> 'resolved'
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, query, id, at)
+	return err
+}
+
+func (m IncidentModel) Unresolved() (map[int64]int64, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, `select camera_id, id from incidents where state <> 'resolved'`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	ids := map[int64]int64{}
+	for rows.Next() {
+		var cameraID, id int64
+		if err := rows.Scan(&cameraID, &id); err != nil {
+			return nil, err
+		}
+		ids[cameraID] = id
+	}
+	return ids, rows.Err()
+}
+
+func (m IncidentModel) Get(id int64) (*Incident, error) {
+	if id < 1 {
+		return nil, ErrRecordNotFound
+	}
+
+	query := `
+		select ` + incidentColumns + `
+		from incidents i
+		join cameras c on c.id = i.camera_id
+		where i.id = $1
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	incident, err := scanIncident(m.DB.QueryRowContext(ctx, query, id))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrRecordNotFound
+		}
+		return nil, err
+	}
+
+	rows, err := m.DB.QueryContext(ctx, `
+		select id, incident_id, created_at, author, body
+		from incident_notes
+		where incident_id = $1
+		order by id
+	`, id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var n IncidentNote
+		if err := rows.Scan(&n.ID, &n.IncidentID, &n.CreatedAt, &n.Author, &n.Body); err != nil {
+			return nil, err
+		}
+		incident.Notes = append(incident.Notes, n)
+	}
+	return incident, rows.Err()
+}
+
+// where returns the filter as a condition on incidents i joined to cameras c,
+// appending its arguments to args.
+func (filter IncidentFilter) where(args *[]any) string {
+	conds := []string{
+		fmt.Sprintf("(lower(c.site_name) = lower(%[1]s) or %[1]s = '')", placeholder(args, filter.SiteName)),
+	}
+	if filter.CameraID != 0 {
+		conds = append(conds, "i.camera_id = "+placeholder(args, filter.CameraID))
+	}
+	if len(filter.States) > 0 {
+		states := make([]string, len(filter.States))
+		for n, state := range filter.States {
+			states[n] = placeholder(args, state)
+		}
+		conds = append(conds, "i.state in ("+strings.Join(states, ", ")+")")
+	}
+	if !filter.OpenedAfter.IsZero() {
+		conds = append(conds, "i.opened_at >= "+placeholder(args, filter.OpenedAfter))
+	}
+	if !filter.OpenedBefore.IsZero() {
+		conds = append(conds, "i.opened_at <= "+placeholder(args, filter.OpenedBefore))
+	}
+	return strings.Join(conds, "\n\t\tand ")
+}
+
+func (m IncidentModel) GetAll(filter IncidentFilter, filters Filters) ([]*Incident, Metadata, error) {
+	// The sort column comes from the validated safelist, so it is safe to interpolate.
+	query := `
+		select count(*) over(), ` + incidentColumns + `
+		from incidents i
+		join cameras c on c.id = i.camera_id
+		where %s
+		order by i.%s %s, i.id asc
+		limit %s offset %s
+	`
+
+	var args []any
+	where := filter.where(&args)
+	query = fmt.Sprintf(query, where, filters.sortColumn(), filters.sortDirection(),
+		placeholder(&args, filters.limit()), placeholder(&args, filters.offset()))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+	defer rows.Close()
+
+	totalRecords := 0
+	incidents := []*Incident{}
+	for rows.Next() {
+		incident, err := scanIncident(rows, &totalRecords)
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+		incidents = append(incidents, incident)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, Metadata{}, err
+	}
+
+	return incidents, calculateMetadata(totalRecords, filters.Page, filters.PageSize), nil
+}
+
+func (m IncidentModel) Update(incident *Incident) error {
+	query := `
+		update incidents
+		set state = $1, acknowledged_at = $2, acknowledged_by = $3, resolved_at = $4, resolved_by = $5,
+			assignee = $6, version = version + 1
+		where id = $7 and version = $8
+		returning version
+	`
+	args := []any{incident.State, incident.AcknowledgedAt, incident.AcknowledgedBy, incident.ResolvedAt, incident.ResolvedBy,
+		incident.Assignee, incident.ID, incident.Version}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, args...).Scan(&incident.Version)
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrEditConflict
+	}
+	return err
+}
+
+func (m IncidentModel) AddNote(note *IncidentNote) error {
+	query := `
+		insert into incident_notes (incident_id, author, body)
+		select id, $2, $3 from incidents where id = $1
+		returning id, created_at
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, note.IncidentID, note.Author, note.Body).Scan(&note.ID, &note.CreatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrRecordNotFound
+	}
+	return err
+}
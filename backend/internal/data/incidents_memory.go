@@ -0,0 +1,193 @@
+package data
+
+import (
+	"cmp"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// MemoryIncidentModel is an in-memory IncidentRepository. It reads camera names and
+// sites from cameras, and treats the incidents of deleted cameras as deleted, like
+// the foreign key cascade of IncidentModel.
+type MemoryIncidentModel struct {
+	mu         sync.Mutex
+	cameras    *MemoryCameraModel
+	nextID     int64
+	nextNoteID int64
+	incidents  map[int64]Incident
+	notes      map[int64][]IncidentNote
+}
+
+func NewMemoryIncidentModel(cameras *MemoryCameraModel) *MemoryIncidentModel {
+	return &MemoryIncidentModel{
+		cameras:    cameras,
+		nextID:     1,
+		nextNoteID: 1,
+		incidents:  make(map[int64]Incident),
+		notes:      make(map[int64][]IncidentNote),
+	}
+}
+
+// load returns a copy of the incident with its camera's name and site, or false if
+// the incident or its camera is gone. It must be called with mu held.
+func (m *MemoryIncidentModel) load(id int64) (*Incident, bool) {
+	incident, ok := m.incidents[id]
+	if !ok {
+		return nil, false
+	}
+	camera, err := m.cameras.Get(incident.CameraID)
+	if err != nil {
+		delete(m.incidents, id)
+		delete(m.notes, id)
+		return nil, false
+	}
+	incident.CameraName, incident.SiteName = camera.Name, camera.SiteName
+	incident.Notes = nil
+	return &incident, true
+}
+
+func (m *MemoryIncidentModel) Open(cameraID int64, failures int, at time.Time) (*Incident, bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, err := m.cameras.Get(cameraID); err != nil {
+		return nil, false, err
+	}
+	for id, incident := range m.incidents {
+		if incident.CameraID == cameraID && incident.State != IncidentResolved {
+			existing, _ := m.load(id)
+			return existing, false, nil
+		}
+	}
+
+	m.incidents[m.nextID] = Incident{
+		ID:       m.nextID,
+		CameraID: cameraID,
+		State:    IncidentOpen,
+		Failures: failures,
+		OpenedAt: at.Truncate(time.Second),
+		Version:  1,
+	}
+	m.nextID++
+	incident, _ := m.load(m.nextID - 1)
+	return incident, true, nil
+}
+
+func (m *MemoryIncidentModel) Resolve(id int64, at time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	incident, ok := m.incidents[id]
+	if !ok || incident.State == IncidentResolved {
+		return nil
+	}
+	incident.SetState(IncidentResolved, "", at)
+	incident.Version++
+	m.incidents[id] = incident
+	return nil
+}
+
+func (m *MemoryIncidentModel) Unresolved() (map[int64]int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	ids := map[int64]int64{}
+	for id := range m.incidents {
+		if incident, ok := m.load(id); ok && incident.State != IncidentResolved {
+			ids[incident.CameraID] = id
+		}
+	}
+	return ids, nil
+}
+
+func (m *MemoryIncidentModel) Get(id int64) (*Incident, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	incident, ok := m.load(id)
+	if !ok {
+		return nil, ErrRecordNotFound
+	}
+	incident.Notes = slices.Clone(m.notes[id])
+	return incident, nil
+}
+
+func (m *MemoryIncidentModel) GetAll(filter IncidentFilter, filters Filters) ([]*Incident, Metadata, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var all []*Incident
+	for id := range m.incidents {
+		if incident, ok := m.load(id); ok && filter.match(incident) {
+			all = append(all, incident)
+		}
+	}
+
+	desc := filters.sortDirection() == "DESC"
+	slices.SortFunc(all, func(a, b *Incident) int {
+		var c int
+		if filters.sortColumn() == "opened_at" {
+			c = a.OpenedAt.Compare(b.OpenedAt)
+		} else {
+			c = cmp.Compare(a.ID, b.ID)
+		}
+		if desc {
+			c = -c
+		}
+		if c == 0 {
+			c = cmp.Compare(a.ID, b.ID)
+		}
+		return c
+	})
+
+	metadata := calculateMetadata(len(all), filters.Page, filters.PageSize)
+
+	start := min(filters.offset(), len(all))
+	end := min(start+filters.limit(), len(all))
+	return append([]*Incident{}, all[start:end]...), metadata, nil
+}
+
+// match reports whether incident passes the filter, the in-memory version of where.
+func (filter IncidentFilter) match(incident *Incident) bool {
+	return (filter.SiteName == "" || strings.EqualFold(incident.SiteName, filter.SiteName)) &&
+		(filter.CameraID == 0 || incident.CameraID == filter.CameraID) &&
+		(len(filter.States) == 0 || slices.Contains(filter.States, incident.State)) &&
+		(filter.OpenedAfter.IsZero() || !incident.OpenedAt.Before(filter.OpenedAfter)) &&
+		(filter.OpenedBefore.IsZero() || !incident.OpenedAt.After(filter.OpenedBefore))
+}
+
+func (m *MemoryIncidentModel) Update(incident *Incident) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	stored, ok := m.load(incident.ID)
+	if !ok || stored.Version != incident.Version {
+		return ErrEditConflict
+	}
+
+	stored.State = incident.State
+	stored.AcknowledgedAt, stored.AcknowledgedBy = incident.AcknowledgedAt, incident.AcknowledgedBy
+	stored.ResolvedAt, stored.ResolvedBy = incident.ResolvedAt, incident.ResolvedBy
+	stored.Assignee = incident.Assignee
+	stored.Version++
+	m.incidents[incident.ID] = *stored
+
+	incident.Version = stored.Version
+	return nil
+}
+
+func (m *MemoryIncidentModel) AddNote(note *IncidentNote) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.load(note.IncidentID); !ok {
+		return ErrRecordNotFound
+	}
+	note.ID = m.nextNoteID
+	note.CreatedAt = time.Now().Truncate(time.Second)
+	m.nextNoteID++
+	m.notes[note.IncidentID] = append(m.notes[note.IncidentID], *note)
+	return nil
+}
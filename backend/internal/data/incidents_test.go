@@ -0,0 +1,164 @@
+package data
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/chefgoldbloom/pnctool/backend/internal/validator"
+)
+
+// testIncidentRepository opens and works incidents through repo for cameras stored
+// in cameras, which must share its data.
+func testIncidentRepository(t *testing.T, cameras CameraRepository, repo IncidentRepository) {
+	for _, c := range []*Camera{
+		{Name: "lobby", MacAddress: "ACCC8E000001", SiteName: "NYC-5th-GLH"},
+		{Name: "gate", MacAddress: "ACCC8E000002", SiteName: "BOS-Main-GLH"},
+	} {
+		if err := cameras.Insert(c); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	at := time.Date(2026, 3, 2, 9, 0, 0, 0, time.UTC)
+	first, opened, err := repo.Open(1, 3, at)
+	if err != nil || !opened {
+		t.Fatalf("Open = %v, %v; want a new incident", opened, err)
+	}
+	if first.State != IncidentOpen || first.CameraName != "lobby" || first.SiteName != "NYC-5th-GLH" || first.Failures != 3 || !first.OpenedAt.Equal(at) || first.Version != 1 {
+		t.Errorf("incident = %+v", first)
+	}
+
+	// A camera has one unresolved incident at a time.
+	again, opened, err := repo.Open(1, 5, at.Add(time.Minute))
+	if err != nil || opened || again.ID != first.ID {
+		t.Errorf("second Open = %+v, %v, %v; want the first incident", again, opened, err)
+	}
+	if _, _, err := repo.Open(99, 3, at); !errors.Is(err, ErrRecordNotFound) {
+		t.Errorf("Open for a missing camera: err = %v; want ErrRecordNotFound", err)
+	}
+	gate, _, err := repo.Open(2, 3, at.Add(time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	unresolved, err := repo.Unresolved()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fmt.Sprint(unresolved) != fmt.Sprintf("map[1:%d 2:%d]", first.ID, gate.ID) {
+		t.Errorf("Unresolved = %v", unresolved)
+	}
+
+	// A user acknowledges and assigns the first; a stale copy can't be saved.
+	stale := *first
+	first.SetState(IncidentAcknowledged, "alice", at.Add(2*time.Minute))
+	first.Assignee = "bob"
+	if err := repo.Update(first); err != nil {
+		t.Fatal(err)
+	}
+	if err := repo.Update(&stale); !errors.Is(err, ErrEditConflict) {
+		t.Errorf("stale Update: err = %v; want ErrEditConflict", err)
+	}
+
+	note := &IncidentNote{IncidentID: first.ID, Author: "bob", Body: "switch port down"}
+	if err := repo.AddNote(note); err != nil {
+		t.Fatal(err)
+	}
+	if err := repo.AddNote(&IncidentNote{IncidentID: 99, Author: "bob", Body: "?"}); !errors.Is(err, ErrRecordNotFound) {
+		t.Errorf("AddNote to a missing incident: err = %v; want ErrRecordNotFound", err)
+	}
+
+	// The camera recovers.
+	if err := repo.Resolve(first.ID, at.Add(time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	if err := repo.Resolve(first.ID, at.Add(2*time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	got, err := repo.Get(first.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.State != IncidentResolved || got.ResolvedAt == nil || !got.ResolvedAt.Equal(at.Add(time.Hour)) || got.ResolvedBy != "" ||
+		got.AcknowledgedBy != "alice" || got.Assignee != "bob" || got.Version != 3 {
+		t.Errorf("resolved incident = %+v", got)
+	}
+	if len(got.Notes) != 1 || got.Notes[0].Body != "switch port down" || got.Notes[0].Author != "bob" {
+		t.Errorf("notes = %+v", got.Notes)
+	}
+
+	// With the first resolved, the camera can have a new incident.
+	if _, opened, err := repo.Open(1, 3, at.Add(3*time.Hour)); err != nil || !opened {
+		t.Errorf("Open after resolving = %v, %v; want a new incident", opened, err)
+	}
+
+	filters := Filters{Page: 1, PageSize: 10, Sort: "-opened_at", SortSafelist: []string{"-opened_at"}}
+	tests := []struct {
+		filter IncidentFilter
+		want   string
+	}{
+		{IncidentFilter{}, "[3 2 1]"},
+		{IncidentFilter{SiteName: "nyc-5th-glh"}, "[3 1]"},
+		{IncidentFilter{CameraID: 2}, "[2]"},
+		{IncidentFilter{States: []string{IncidentOpen, IncidentAcknowledged}}, "[3 2]"},
+		{IncidentFilter{States: []string{IncidentResolved}}, "[1]"},
+		{IncidentFilter{OpenedBefore: at.Add(time.Hour)}, "[2 1]"},
+		{IncidentFilter{OpenedAfter: at.Add(time.Minute)}, "[3 2]"},
+	}
+	for _, tt := range tests {
+		incidents, metadata, err := repo.GetAll(tt.filter, filters)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var ids []int64
+		for _, incident := range incidents {
+			ids = append(ids, incident.ID)
+		}
+		if fmt.Sprint(ids) != tt.want || metadata.TotalRecords != len(ids) {
+			t.Errorf("GetAll(%+v) = %v, %d total; want %s", tt.filter, ids, metadata.TotalRecords, tt.want)
+		}
+	}
+
+	// Deleting a camera deletes its incidents.
+	if err := cameras.Delete(1); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := repo.Get(first.ID); !errors.Is(err, ErrRecordNotFound) {
+		t.Errorf("Get after deleting the camera: err = %v; want ErrRecordNotFound", err)
+	}
+}
+
+func TestIncidentModel(t *testing.T) {
+	db := newTestDB(t)
+	testIncidentRepository(t, CameraModel{DB: db}, IncidentModel{DB: db})
+}
+
+func TestMemoryIncidentModel(t *testing.T) {
+	cameras := NewMemoryCameraModel()
+	testIncidentRepository(t, cameras, NewMemoryIncidentModel(cameras))
+}
+
+func TestValidateIncidentState(t *testing.T) {
+	tests := []struct {
+		from, to string
+		valid    bool
+	}{
+		{IncidentOpen, IncidentAcknowledged, true},
+		{IncidentOpen, IncidentResolved, true},
+		{IncidentAcknowledged, IncidentResolved, true},
+		{IncidentAcknowledged, IncidentAcknowledged, true},
+		{IncidentAcknowledged, IncidentOpen, false},
+		{IncidentResolved, IncidentAcknowledged, false},
+		{IncidentOpen, "closed", false},
+	}
+
+	for _, tt := range tests {
+		v := validator.New()
+		ValidateIncidentState(v, tt.from, tt.to)
+		if v.Valid() != tt.valid {
+			t.Errorf("%s to %s: valid = %v; want %v", tt.from, tt.to, v.Valid(), tt.valid)
+		}
+	}
+}
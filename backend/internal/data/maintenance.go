@@ -0,0 +1,170 @@
+package data
+
+import (
+	"cmp"
+	"context"
+	"database/sql"
+	"errors"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/chefgoldbloom/pnctool/backend/internal/validator"
+)
+
+// MaintenanceWindow is a period of planned downtime, at one site or, with an empty
+// SiteName, at every site. Availability reports leave it out of the measured time.
+type MaintenanceWindow struct {
+	ID        int64     `json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+	CreatedBy string    `json:"created_by"`
+	SiteName  string    `json:"site_name"`
+	StartsAt  time.Time `json:"starts_at"`
+	EndsAt    time.Time `json:"ends_at"`
+	Reason    string    `json:"reason"`
+}
+
+// AppliesTo reports whether the window covers cameras at site.
+func (w *MaintenanceWindow) AppliesTo(site string) bool {
+	return w.SiteName == "" || strings.EqualFold(w.SiteName, site)
+}
+
+func ValidateMaintenanceWindow(v *validator.Validator, w *MaintenanceWindow) {
+	if w.SiteName != "" {
+		v.CheckCode(validator.Matches(w.SiteName, siteNameRxp), "site_name", validator.CodeBadFormat, "must be like 'City-Street_Number-Office_Type'")
+	}
+	v.CheckCode(!w.StartsAt.IsZero(), "starts_at", validator.CodeRequired, "must be provided")
+	v.CheckCode(!w.EndsAt.IsZero(), "ends_at", validator.CodeRequired, "must be provided")
+	v.CheckCode(w.EndsAt.After(w.StartsAt), "ends_at", validator.CodeOutOfRange, "must be after starts_at")
+	v.CheckCode(len(w.Reason) <= 500, "reason", validator.CodeTooLong, "must not be more than 500 bytes long")
+}
+
+// MaintenanceRepository stores maintenance windows. MaintenanceModel implements it on
+// top of Postgres and MemoryMaintenanceModel implements it in memory for tests.
+type MaintenanceRepository interface {
+	Insert(w *MaintenanceWindow) error
+
+	// GetAll returns the windows overlapping from to to which apply to site, or to
+	// any site if site is empty, ordered by start time.
+	GetAll(site string, from, to time.Time) ([]*MaintenanceWindow, error)
+
+	Delete(id int64) error
+}
+
+type MaintenanceModel struct {
+	DB DBTX
+}
+
+func (m MaintenanceModel) Insert(w *MaintenanceWindow) error {
+	query := `
+		insert into maintenance_windows (created_by, site_name, starts_at, ends_at, reason)
+		values ($1, $2, $3, $4, $5)
+		returning id, created_at
+	`
+	args := []any{w.CreatedBy, w.SiteName, w.StartsAt, w.EndsAt, w.Reason}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	return m.DB.QueryRowContext(ctx, query, args...).Scan(&w.ID, &w.CreatedAt)
+}
+
+func (m MaintenanceModel) GetAll(site string, from, to time.Time) ([]*MaintenanceWindow, error) {
+	query := `
+		select id, created_at, created_by, site_name, starts_at, ends_at, reason
+		from maintenance_windows
+		where starts_at < $3 and ends_at > $2
+		and (site_name = '' or $1 = '' or lower(site_name) = lower($1))
+		order by starts_at, id
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, site, from, to)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	windows := []*MaintenanceWindow{}
+	for rows.Next() {
+		var w MaintenanceWindow
+		err := rows.Scan(&w.ID, &w.CreatedAt, &w.CreatedBy, &w.SiteName, &w.StartsAt, &w.EndsAt, &w.Reason)
+		if err != nil {
+			return nil, err
+		}
+		windows = append(windows, &w)
+	}
+	return windows, rows.Err()
+}
+
+func (m MaintenanceModel) Delete(id int64) error {
+	if id < 1 {
+		return ErrRecordNotFound
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, `delete from maintenance_windows where id = $1 returning id`, id).Scan(&id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrRecordNotFound
+	}
+	return err
+}
+
+// MemoryMaintenanceModel is an in-memory MaintenanceRepository.
+type MemoryMaintenanceModel struct {
+	mu      sync.Mutex
+	nextID  int64
+	windows map[int64]MaintenanceWindow
+}
+
+func NewMemoryMaintenanceModel() *MemoryMaintenanceModel {
+	return &MemoryMaintenanceModel{nextID: 1, windows: make(map[int64]MaintenanceWindow)}
+}
+
+func (m *MemoryMaintenanceModel) Insert(w *MaintenanceWindow) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	w.ID = m.nextID
+	w.CreatedAt = time.Now().Truncate(time.Second)
+	w.StartsAt, w.EndsAt = w.StartsAt.Truncate(time.Second), w.EndsAt.Truncate(time.Second)
+	m.nextID++
+	m.windows[w.ID] = *w
+	return nil
+}
+
+func (m *MemoryMaintenanceModel) GetAll(site string, from, to time.Time) ([]*MaintenanceWindow, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	windows := []*MaintenanceWindow{}
+	for _, w := range m.windows {
+		if w.StartsAt.Before(to) && w.EndsAt.After(from) && (site == "" || w.AppliesTo(site)) {
+			w := w
+			windows = append(windows, &w)
+		}
+	}
+	slices.SortFunc(windows, func(a, b *MaintenanceWindow) int {
+		if c := a.StartsAt.Compare(b.StartsAt); c != 0 {
+			return c
+		}
+		return cmp.Compare(a.ID, b.ID)
+	})
+	return windows, nil
+}
+
+func (m *MemoryMaintenanceModel) Delete(id int64) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.windows[id]; !ok {
+		return ErrRecordNotFound
+	}
+	delete(m.windows, id)
+	return nil
+}
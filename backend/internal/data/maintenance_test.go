@@ -0,0 +1,79 @@
+package data
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func testMaintenanceRepository(t *testing.T, repo MaintenanceRepository) {
+	day := time.Date(2026, 3, 7, 0, 0, 0, 0, time.UTC)
+	for _, w := range []*MaintenanceWindow{
+		{CreatedBy: "alice", SiteName: "NYC-5th-GLH", StartsAt: day.Add(22 * time.Hour), EndsAt: day.Add(26 * time.Hour), Reason: "switch upgrade"},
+		{StartsAt: day.Add(2 * time.Hour), EndsAt: day.Add(3 * time.Hour), Reason: "VMS patch"},
+		{SiteName: "BOS-Main-OPS", StartsAt: day.AddDate(0, 0, 7), EndsAt: day.AddDate(0, 0, 8)},
+	} {
+		if err := repo.Insert(w); err != nil {
+			t.Fatal(err)
+		}
+		if w.ID == 0 || w.CreatedAt.IsZero() {
+			t.Fatalf("Insert didn't set id and created_at: %+v", w)
+		}
+	}
+
+	tests := []struct {
+		site     string
+		from, to time.Time
+		want     []int64
+	}{
+		{"", day, day.AddDate(0, 0, 30), []int64{2, 1, 3}},
+		{"nyc-5th-glh", day, day.AddDate(0, 0, 30), []int64{2, 1}},
+		{"BOS-Main-OPS", day, day.AddDate(0, 0, 1), []int64{2}},
+		// Windows ending at from or starting at to don't overlap.
+		{"", day.Add(3 * time.Hour), day.Add(22 * time.Hour), []int64{}},
+	}
+
+	for _, tt := range tests {
+		windows, err := repo.GetAll(tt.site, tt.from, tt.to)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ids := []int64{}
+		for _, w := range windows {
+			ids = append(ids, w.ID)
+		}
+		if len(ids) != len(tt.want) {
+			t.Errorf("GetAll(%q) = %v; want %v", tt.site, ids, tt.want)
+			continue
+		}
+		for i := range ids {
+			if ids[i] != tt.want[i] {
+				t.Errorf("GetAll(%q) = %v; want %v", tt.site, ids, tt.want)
+				break
+			}
+		}
+	}
+
+	windows, err := repo.GetAll("NYC-5th-GLH", day.Add(22*time.Hour), day.Add(23*time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(windows) != 1 || windows[0].CreatedBy != "alice" {
+		t.Errorf("GetAll = %+v; want window 1 created by alice", windows)
+	}
+
+	if err := repo.Delete(1); err != nil {
+		t.Fatal(err)
+	}
+	if err := repo.Delete(1); !errors.Is(err, ErrRecordNotFound) {
+		t.Errorf("second Delete: err = %v; want ErrRecordNotFound", err)
+	}
+}
+
+func TestMaintenanceModel(t *testing.T) {
+	testMaintenanceRepository(t, MaintenanceModel{DB: newTestDB(t)})
+}
+
+func TestMemoryMaintenanceModel(t *testing.T) {
+	testMaintenanceRepository(t, NewMemoryMaintenanceModel())
+}
@@ -3,6 +3,7 @@ package data
 import (
 	"database/sql"
 	"errors"
+	"time"
 )
 
 // Define ErrRecordNotFound.  Will return this from Get() method when
@@ -12,14 +13,77 @@ var (
 	ErrEditConflict   = errors.New("edit conflict")
 )
 
-// Create a Models struct that wraps CameraModel
+// CameraRepository is the set of camera operations the handlers depend on. CameraModel
+// implements it on top of Postgres and MemoryCameraModel implements it in memory for
+// tests.
+type CameraRepository interface {
+	Insert(camera *Camera) error
+	Get(id int64) (*Camera, error)
+	GetProjected(id int64, p Projection) (*Camera, error)
+	GetAll(filter CameraFilter, p Projection, filters Filters) ([]*Camera, Metadata, error)
+	Update(camera *Camera) error
+	Delete(id int64) error
+	DeleteVersion(id int64, version int32) error
+	Suggest(prefix string, limit int) ([]Suggestion, error)
+	CountBy(filter CameraFilter, groupBy string, top int) (*GroupStats, error)
+	CountAddedByWeek(filter CameraFilter, from, to time.Time) (*TimeSeries, error)
+}
+
+// Create a Models struct that wraps the repositories
 type Models struct {
-	Cameras CameraModel
+	Cameras         CameraRepository
+	IdempotencyKeys IdempotencyRepository
+	Views           ViewRepository
+	Statuses        StatusRepository
+	Maintenance     MaintenanceRepository
+	Incidents       IncidentRepository
+	Events          EventRepository
+	Webhooks        WebhookRepository
+	Firmware        FirmwareRepository
+	FirmwareCatalog FirmwareCatalogRepository
+	FirmwareImages  FirmwareImageRepository
+	Upgrades        UpgradeRepository
+	Tx              Transactor
 }
 
 // Create a New() method that will instantiate Models
 func NewModels(db *sql.DB) Models {
 	return Models{
-		Cameras: CameraModel{DB: db},
+		Cameras:         CameraModel{DB: db},
+		IdempotencyKeys: IdempotencyModel{DB: db},
+		Views:           ViewModel{DB: db},
+		Statuses:        StatusModel{DB: db},
+		Maintenance:     MaintenanceModel{DB: db},
+		Incidents:       IncidentModel{DB: db},
+		Events:          EventModel{DB: db},
+		Webhooks:        WebhookModel{DB: db},
+		Firmware:        FirmwareModel{DB: db},
+		FirmwareCatalog: FirmwareCatalogModel{DB: db},
+		FirmwareImages:  FirmwareImageModel{DB: db},
+		Upgrades:        UpgradeModel{DB: db},
+		Tx:              SQLTransactor{DB: db},
+	}
+}
+
+// NewMemoryModels returns Models backed by in-memory repositories, for running the
+// application without a database.
+func NewMemoryModels() Models {
+	cameras := NewMemoryCameraModel()
+	events := NewMemoryEventModel()
+	images := NewMemoryFirmwareImageModel()
+	return Models{
+		Cameras:         cameras,
+		IdempotencyKeys: NewMemoryIdempotencyModel(),
+		Views:           NewMemoryViewModel(),
+		Statuses:        cameras,
+		Maintenance:     NewMemoryMaintenanceModel(),
+		Incidents:       NewMemoryIncidentModel(cameras),
+		Events:          events,
+		Webhooks:        NewMemoryWebhookModel(events),
+		Firmware:        NewMemoryFirmwareModel(cameras),
+		FirmwareCatalog: NewMemoryFirmwareCatalogModel(),
+		FirmwareImages:  images,
+		Upgrades:        NewMemoryUpgradeModel(cameras, images),
+		Tx:              NewMemoryTransactor(cameras),
 	}
 }
@@ -0,0 +1,104 @@
+package data
+
+import (
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/chefgoldbloom/pnctool/backend/internal/validator"
+)
+
+// Site is a camera's site, embedded with include=site. Sites without a row in the
+// sites table are described from the parts of their name.
+type Site struct {
+	Name       string `json:"name"`
+	City       string `json:"city"`
+	Street     string `json:"street"`
+	OfficeType string `json:"office_type"`
+	Address    string `json:"address,omitempty"`
+	Timezone   string `json:"timezone,omitempty"`
+}
+
+// ModelInfo describes a camera model, embedded with include=model.
+type ModelInfo struct {
+	ModelNo     string `json:"model_no"`
+	Vendor      string `json:"vendor"`
+	Description string `json:"description,omitempty"`
+}
+
+// CameraStatus is the last reachability check of a camera, embedded with
+// include=status.
+type CameraStatus struct {
+	Status     string     `json:"status"`
+	LatencyMS  *int       `json:"latency_ms"`
+	LastSeenAt *time.Time `json:"last_seen_at"`
+	CheckedAt  time.Time  `json:"checked_at"`
+}
+
+// siteFromName splits a "City-Street-OfficeType" site name into its parts.
+func siteFromName(name string) *Site {
+	site := &Site{Name: name}
+	parts := strings.Split(name, "-")
+	if len(parts) >= 3 {
+		site.City = parts[0]
+		site.Street = strings.Join(parts[1:len(parts)-1], "-")
+		site.OfficeType = parts[len(parts)-1]
+	}
+	return site
+}
+
+// Projection selects which camera fields are loaded and which related resources are
+// embedded. The zero value loads every field and embeds nothing.
+type Projection struct {
+	Fields  []string
+	Include []string
+}
+
+// CameraFieldSafelist is every camera field which can be requested with fields=.
+var CameraFieldSafelist = []string{"id", "created_at", "name", "mac_address", "site_name", "model_no", "address", "version"}
+
+// CameraIncludeSafelist is every related resource which can be embedded with include=.
+var CameraIncludeSafelist = []string{"site", "model", "status"}
+
+// loads reports whether the projection loads field. id and version are always loaded
+// so that links and ETags can be built from any projection.
+func (p Projection) loads(field string) bool {
+	return len(p.Fields) == 0 || field == "id" || field == "version" || slices.Contains(p.Fields, field)
+}
+
+// includes reports whether the projection embeds the named related resource.
+func (p Projection) includes(resource string) bool {
+	return slices.Contains(p.Include, resource)
+}
+
+// apply zeroes the fields of camera the projection doesn't load, so in-memory results
+// match what the SQL query returns.
+func (p Projection) apply(camera *Camera) {
+	if !p.loads("created_at") {
+		camera.CreatedAt = time.Time{}
+	}
+	if !p.loads("name") {
+		camera.Name = ""
+	}
+	if !p.loads("mac_address") {
+		camera.MacAddress = ""
+	}
+	if !p.loads("site_name") {
+		camera.SiteName = ""
+	}
+	if !p.loads("model_no") {
+		camera.ModelNo = ""
+	}
+	if !p.loads("address") {
+		camera.Address = ""
+	}
+}
+
+func ValidateProjection(v *validator.Validator, p Projection) {
+	for _, f := range p.Fields {
+		v.CheckCode(validator.PermittedValue(f, CameraFieldSafelist...), "fields", validator.CodeNotPermitted, "must only contain: "+strings.Join(CameraFieldSafelist, ", "))
+	}
+	for _, inc := range p.Include {
+		v.CheckCode(validator.PermittedValue(inc, CameraIncludeSafelist...), "include", validator.CodeNotPermitted, "must only contain: "+strings.Join(CameraIncludeSafelist, ", "))
+	}
+}
@@ -0,0 +1,487 @@
+package data
+
+import (
+	"context"
+	"fmt"
+	"html"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/chefgoldbloom/pnctool/backend/internal/query"
+	"github.com/chefgoldbloom/pnctool/backend/internal/validator"
+)
+
+// CameraQuery is a q= expression which has been parsed and checked against the camera
+// fields. It compiles to a parameterized SQL condition for CameraModel and to a
+// predicate for MemoryCameraModel, so both give the same results.
+type CameraQuery struct {
+	pred cameraPredicate
+	text string
+}
+
+// ParseCameraQuery parses and type-checks a q= expression. Errors are of type
+// *query.Error and give the position of the offending character.
+func ParseCameraQuery(s string) (*CameraQuery, error) {
+	n, err := query.Parse(s)
+	if err != nil {
+		return nil, err
+	}
+	pred, err := compileCameraQuery(n)
+	if err != nil {
+		return nil, err
+	}
+	return &CameraQuery{pred: pred, text: n.String()}, nil
+}
+
+// String returns the query in canonical form.
+func (q *CameraQuery) String() string {
+	return q.text
+}
+
+// CameraQueryFields lists the fields a q= expression can filter on.
+var CameraQueryFields = []string{"id", "created_at", "name", "mac_address", "site_name", "model_no", "version", "status"}
+
+// cameraPredicate is a compiled query node. sql appends its arguments to args and
+// returns a condition which refers to them by position.
+type cameraPredicate interface {
+	sql(args *[]any) string
+	match(c *Camera) bool
+}
+
+type (
+	andPredicate struct{ left, right cameraPredicate }
+	orPredicate  struct{ left, right cameraPredicate }
+	notPredicate struct{ x cameraPredicate }
+)
+
+func (p andPredicate) sql(args *[]any) string {
+	return "(" + p.left.sql(args) + " and " + p.right.sql(args) + ")"
+}
+
+func (p andPredicate) match(c *Camera) bool { return p.left.match(c) && p.right.match(c) }
+
+func (p orPredicate) sql(args *[]any) string {
+	return "(" + p.left.sql(args) + " or " + p.right.sql(args) + ")"
+}
+
+func (p orPredicate) match(c *Camera) bool { return p.left.match(c) || p.right.match(c) }
+
+func (p notPredicate) sql(args *[]any) string { return "not " + p.x.sql(args) }
+
+func (p notPredicate) match(c *Camera) bool { return !p.x.match(c) }
+
+// placeholder appends value to args and returns its $n placeholder.
+func placeholder(args *[]any, value any) string {
+	*args = append(*args, value)
+	return "$" + strconv.Itoa(len(*args))
+}
+
+// statusExpr is the camera's last polled status. Cameras which have never been polled
+// are "unknown".
+const statusExpr = "coalesce((select st.status from camera_status st where st.camera_id = c.id), 'unknown')"
+
+func cameraStatusOf(c *Camera) string {
+	if c.Status == nil {
+		return "unknown"
+	}
+	return c.Status.Status
+}
+
+// stringPredicate matches a text field case-insensitively. A * in the value matches any
+// run of characters.
+type stringPredicate struct {
+	expr  string
+	get   func(*Camera) string
+	value string
+	re    *regexp.Regexp // set when value has wildcards
+}
+
+func (p stringPredicate) sql(args *[]any) string {
+	if p.re == nil {
+		return fmt.Sprintf("lower(%s) = lower(%s)", p.expr, placeholder(args, p.value))
+	}
+	// Escape LIKE's own wildcards so only * matches more than itself.
+	pattern := strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`, `*`, `%`).Replace(p.value)
+	return fmt.Sprintf("%s ilike %s", p.expr, placeholder(args, pattern))
+}
+
+func (p stringPredicate) match(c *Camera) bool {
+	if p.re == nil {
+		return strings.EqualFold(p.get(c), p.value)
+	}
+	return p.re.MatchString(p.get(c))
+}
+
+// comparison is a SQL comparison operator and the matching test on the result of a
+// three-way compare.
+type comparison struct {
+	op   string
+	test func(int) bool
+}
+
+var comparisons = map[query.Op]comparison{
+	query.Match: {"=", func(c int) bool { return c == 0 }},
+	query.Lt:    {"<", func(c int) bool { return c < 0 }},
+	query.Le:    {"<=", func(c int) bool { return c <= 0 }},
+	query.Gt:    {">", func(c int) bool { return c > 0 }},
+	query.Ge:    {">=", func(c int) bool { return c >= 0 }},
+}
+
+type intPredicate struct {
+	expr  string
+	get   func(*Camera) int64
+	cmp   comparison
+	value int64
+}
+
+func (p intPredicate) sql(args *[]any) string {
+	return fmt.Sprintf("%s %s %s", p.expr, p.cmp.op, placeholder(args, p.value))
+}
+
+func (p intPredicate) match(c *Camera) bool {
+	v := p.get(c)
+	switch {
+	case v < p.value:
+		return p.cmp.test(-1)
+	case v > p.value:
+		return p.cmp.test(1)
+	}
+	return p.cmp.test(0)
+}
+
+type timePredicate struct {
+	expr  string
+	cmp   comparison
+	value time.Time
+}
+
+func (p timePredicate) sql(args *[]any) string {
+	return fmt.Sprintf("%s %s %s", p.expr, p.cmp.op, placeholder(args, p.value))
+}
+
+func (p timePredicate) match(c *Camera) bool {
+	return p.cmp.test(c.CreatedAt.Compare(p.value))
+}
+
+// dayPredicate compares created_at with a whole UTC day: created_at:2026-01-02 matches
+// any time that day, and created_at:>2026-01-02 only times after it.
+func dayPredicate(expr string, op query.Op, day time.Time) cameraPredicate {
+	next := day.AddDate(0, 0, 1)
+	switch op {
+	case query.Lt:
+		return timePredicate{expr, comparisons[query.Lt], day}
+	case query.Le:
+		return timePredicate{expr, comparisons[query.Lt], next}
+	case query.Gt:
+		return timePredicate{expr, comparisons[query.Ge], next}
+	case query.Ge:
+		return timePredicate{expr, comparisons[query.Ge], day}
+	}
+	return andPredicate{
+		timePredicate{expr, comparisons[query.Ge], day},
+		timePredicate{expr, comparisons[query.Lt], next},
+	}
+}
+
+func compileCameraQuery(n query.Node) (cameraPredicate, error) {
+	switch n := n.(type) {
+	case *query.And:
+		left, right, err := compileBoth(n.Left, n.Right)
+		if err != nil {
+			return nil, err
+		}
+		return andPredicate{left, right}, nil
+	case *query.Or:
+		left, right, err := compileBoth(n.Left, n.Right)
+		if err != nil {
+			return nil, err
+		}
+		return orPredicate{left, right}, nil
+	case *query.Not:
+		x, err := compileCameraQuery(n.X)
+		if err != nil {
+			return nil, err
+		}
+		return notPredicate{x}, nil
+	case *query.Term:
+		return compileCameraTerm(n)
+	}
+	return nil, query.Errorf(n.Pos(), "unsupported expression")
+}
+
+func compileBoth(l, r query.Node) (cameraPredicate, cameraPredicate, error) {
+	left, err := compileCameraQuery(l)
+	if err != nil {
+		return nil, nil, err
+	}
+	right, err := compileCameraQuery(r)
+	if err != nil {
+		return nil, nil, err
+	}
+	return left, right, nil
+}
+
+func compileCameraTerm(t *query.Term) (cameraPredicate, error) {
+	switch t.Field {
+	case "id":
+		return compileInt(t, "c.id", func(c *Camera) int64 { return c.ID })
+	case "version":
+		return compileInt(t, "c.version", func(c *Camera) int64 { return int64(c.Version) })
+	case "created_at":
+		return compileTime(t, "c.created_at")
+	case "name":
+		return compileString(t, "c.name", func(c *Camera) string { return c.Name })
+	case "mac_address":
+		return compileString(t, "c.mac_address", func(c *Camera) string { return c.MacAddress })
+	case "site_name":
+		return compileString(t, "c.site_name", func(c *Camera) string { return c.SiteName })
+	case "model_no":
+		return compileString(t, "c.model_no", func(c *Camera) string { return c.ModelNo })
+	case "status":
+		return compileString(t, statusExpr, cameraStatusOf)
+	}
+	return nil, query.Errorf(t.FieldPos, "unknown field %q, must be one of: %s", t.Field, strings.Join(CameraQueryFields, ", "))
+}
+
+func compileString(t *query.Term, expr string, get func(*Camera) string) (cameraPredicate, error) {
+	if t.Op != query.Match {
+		return nil, query.Errorf(t.OpPos, "field %q can only be matched with :", t.Field)
+	}
+	p := stringPredicate{expr: expr, get: get, value: t.Value}
+	if strings.Contains(t.Value, "*") {
+		pattern := strings.ReplaceAll(regexp.QuoteMeta(t.Value), `\*`, ".*")
+		p.re = regexp.MustCompile("(?is)^" + pattern + "$")
+	}
+	return p, nil
+}
+
+func compileInt(t *query.Term, expr string, get func(*Camera) int64) (cameraPredicate, error) {
+	value, err := strconv.ParseInt(t.Value, 10, 64)
+	if err != nil {
+		return nil, query.Errorf(t.ValuePos, "value for %q must be an integer", t.Field)
+	}
+	return intPredicate{expr: expr, get: get, cmp: comparisons[t.Op], value: value}, nil
+}
+
+func compileTime(t *query.Term, expr string) (cameraPredicate, error) {
+	if day, err := time.Parse(time.DateOnly, t.Value); err == nil {
+		return dayPredicate(expr, t.Op, day), nil
+	}
+	value, err := time.Parse(time.RFC3339, t.Value)
+	if err != nil {
+		return nil, query.Errorf(t.ValuePos, "value for %q must be a date like 2006-01-02 or an RFC 3339 timestamp", t.Field)
+	}
+	return timePredicate{expr: expr, cmp: comparisons[t.Op], value: value}, nil
+}
+
+// SearchMatch is how well a camera matched a search= parameter. Highlight holds the
+// fields containing a search term, HTML-escaped with the terms wrapped in <mark>.
+type SearchMatch struct {
+	Score     float64           `json:"score"`
+	Highlight map[string]string `json:"highlight,omitempty"`
+}
+
+// searchText is the text the trigram index covers. It must match the index expression
+// in the migrations exactly.
+const searchText = "lower(c.name || ' ' || c.site_name || ' ' || c.model_no || ' ' || c.mac_address)"
+
+// MaxSearchLength is the longest search= parameter accepted, in bytes.
+const MaxSearchLength = 200
+
+// searchTerms splits a search into lower-cased runs of letters and digits, so "lob-e"
+// searches for "lob" and "e".
+func searchTerms(s string) []string {
+	return strings.FieldsFunc(strings.ToLower(s), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
+
+// ValidateSearch checks a search= parameter.
+func ValidateSearch(v *validator.Validator, search string) {
+	v.CheckCode(len(search) <= MaxSearchLength, "search", validator.CodeTooLong, fmt.Sprintf("must not be more than %d bytes long", MaxSearchLength))
+	v.CheckCode(len(searchTerms(search)) > 0, "search", validator.CodeInvalid, "must contain a letter or digit")
+}
+
+// likeEscape escapes LIKE's wildcards in s.
+var likeEscape = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+
+// searchSQL returns the condition and relevance score expression for a search. A camera
+// matches if every term prefixes a word in its tsvector, if the search is similar to a
+// run of its text, or if the search appears in it verbatim (for partial MACs). Each of
+// these can use the full-text or trigram index.
+func searchSQL(search string, args *[]any) (where, score string) {
+	terms := searchTerms(search)
+	tsquery := fmt.Sprintf("to_tsquery('simple', %s)", placeholder(args, strings.Join(terms, ":* & ")+":*"))
+	raw := placeholder(args, strings.ToLower(search))
+	pattern := placeholder(args, "%"+likeEscape.Replace(strings.ToLower(search))+"%")
+
+	where = fmt.Sprintf("(c.search_vector @@ %s or %s <%% %s or %s like %s)", tsquery, raw, searchText, searchText, pattern)
+	score = fmt.Sprintf("ts_rank(c.search_vector, %s) + word_similarity(%s, %s)", tsquery, raw, searchText)
+	return where, score
+}
+
+// searchWeights mirrors the tsvector weights: a term found in the name counts for more
+// than one found in the MAC address.
+var searchWeights = []struct {
+	field  string
+	weight float64
+	get    func(*Camera) string
+}{
+	{"name", 1, func(c *Camera) string { return c.Name }},
+	{"site_name", 0.4, func(c *Camera) string { return c.SiteName }},
+	{"model_no", 0.2, func(c *Camera) string { return c.ModelNo }},
+	{"mac_address", 0.1, func(c *Camera) string { return c.MacAddress }},
+}
+
+// searchScore approximates the SQL relevance score for MemoryCameraModel. Each term
+// scores the weight of the best field with a word it prefixes, or a small amount if it
+// is long enough to stand for a trigram match and only appears inside a word. Zero
+// means no match.
+func searchScore(c *Camera, search string) float64 {
+	terms := searchTerms(search)
+
+	var total float64
+	for _, term := range terms {
+		best := 0.0
+		for _, w := range searchWeights {
+			value := strings.ToLower(w.get(c))
+			for _, word := range searchTerms(value) {
+				if strings.HasPrefix(word, term) {
+					best = max(best, w.weight)
+				}
+			}
+			if best == 0 && len(term) >= 3 && strings.Contains(value, term) {
+				best = 0.05
+			}
+		}
+		if best == 0 {
+			return 0
+		}
+		total += best
+	}
+	return total / float64(len(terms))
+}
+
+// highlight returns the searchable fields of c containing a search term, HTML-escaped
+// with each term wrapped in <mark>.
+func highlight(c *Camera, search string) map[string]string {
+	terms := searchTerms(search)
+
+	out := map[string]string{}
+	for _, w := range searchWeights {
+		if h, ok := markTerms(w.get(c), terms); ok {
+			out[w.field] = h
+		}
+	}
+	if len(out) == 0 {
+		return nil
+	}
+	return out
+}
+
+// markTerms wraps every case-insensitive occurrence of terms in value with <mark>,
+// merging overlapping matches. It reports whether anything was marked.
+func markTerms(value string, terms []string) (string, bool) {
+	lower := strings.ToLower(value)
+	if len(lower) != len(value) {
+		// Lower-casing changed byte offsets, so they can't be mapped back.
+		return "", false
+	}
+
+	marked := make([]bool, len(value))
+	found := false
+	for _, term := range terms {
+		for i := 0; ; {
+			j := strings.Index(lower[i:], term)
+			if j < 0 {
+				break
+			}
+			for k := i + j; k < i+j+len(term); k++ {
+				marked[k] = true
+			}
+			found = true
+			i += j + 1
+		}
+	}
+	if !found {
+		return "", false
+	}
+
+	var b strings.Builder
+	for i := 0; i < len(value); {
+		j := i
+		for j < len(value) && marked[j] == marked[i] {
+			j++
+		}
+		if marked[i] {
+			b.WriteString("<mark>" + html.EscapeString(value[i:j]) + "</mark>")
+		} else {
+			b.WriteString(html.EscapeString(value[i:j]))
+		}
+		i = j
+	}
+	return b.String(), true
+}
+
+// Suggestion is a typeahead completion: a camera name, site or model, and how many
+// cameras have it.
+type Suggestion struct {
+	Text    string `json:"text"`
+	Kind    string `json:"kind"`
+	Cameras int    `json:"cameras"`
+}
+
+// ValidateSuggest checks the prefix and limit of a suggestion request.
+func ValidateSuggest(v *validator.Validator, prefix string, limit int) {
+	v.CheckCode(strings.TrimSpace(prefix) != "", "q", validator.CodeRequired, "must be provided")
+	v.CheckCode(len(prefix) <= 100, "q", validator.CodeTooLong, "must not be more than 100 bytes long")
+	v.CheckCode(limit > 0 && limit <= 25, "limit", validator.CodeOutOfRange, "must be between 1 and 25")
+}
+
+// Suggest returns up to limit names, sites and models starting with or similar to
+// prefix. Prefix matches come first, then the closest.
+func (c CameraModel) Suggest(prefix string, limit int) ([]Suggestion, error) {
+	query := `
+		select kind, value, count(*), max(sim)
+		from (
+			select 'name' as kind, name as value, word_similarity($1, lower(name)) as sim
+			from cameras where $1 <% lower(name) or lower(name) like $2
+			union all
+			select 'site', site_name, word_similarity($1, lower(site_name))
+			from cameras where $1 <% lower(site_name) or lower(site_name) like $2
+			union all
+			select 'model', model_no, word_similarity($1, lower(model_no))
+			from cameras where $1 <% lower(model_no) or lower(model_no) like $2
+		) matches
+		group by kind, value
+		order by bool_or(lower(value) like $2) desc, max(sim) desc, value, kind
+		limit $3
+	`
+	prefix = strings.ToLower(strings.TrimSpace(prefix))
+	args := []any{prefix, likeEscape.Replace(prefix) + "%", limit}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := c.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	suggestions := []Suggestion{}
+	for rows.Next() {
+		var (
+			s   Suggestion
+			sim float64
+		)
+		if err := rows.Scan(&s.Kind, &s.Text, &s.Cameras, &sim); err != nil {
+			return nil, err
+		}
+		suggestions = append(suggestions, s)
+	}
+	return suggestions, rows.Err()
+}
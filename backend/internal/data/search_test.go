@@ -0,0 +1,167 @@
+package data
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/chefgoldbloom/pnctool/backend/internal/query"
+)
+
+func TestParseCameraQueryErrors(t *testing.T) {
+	tests := []struct {
+		query string
+		pos   int
+		msg   string
+	}{
+		{"serial:123", 1, "unknown field"},
+		{"name:a id:abc", 11, "must be an integer"},
+		{"name:>a", 5, "can only be matched with :"},
+		{"version:<1 created_at:yesterday", 23, "must be a date"},
+		{"name:a (", 9, "unexpected end of query"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			_, err := ParseCameraQuery(tt.query)
+			var qerr *query.Error
+			if !errors.As(err, &qerr) {
+				t.Fatalf("err = %v; want *query.Error", err)
+			}
+			if qerr.Pos != tt.pos || !strings.Contains(qerr.Msg, tt.msg) {
+				t.Errorf("err = %v; want position %d and %q", qerr, tt.pos, tt.msg)
+			}
+		})
+	}
+}
+
+func TestCameraQuerySQL(t *testing.T) {
+	day := time.Date(2026, 1, 2, 0, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		query string
+		sql   string
+		args  []any
+	}{
+		{"name:Lobby", "lower(c.name) = lower($1)", []any{"Lobby"}},
+		{"model_no:P32*", "c.model_no ilike $1", []any{"P32%"}},
+		{`name:"50%_off*"`, "c.name ilike $1", []any{`50\%\_off%`}},
+		{"id:>3 -version:1", "(c.id > $1 and not c.version = $2)", []any{int64(3), int64(1)}},
+		{"created_at:2026-01-02", "(c.created_at >= $1 and c.created_at < $2)", []any{day, day.AddDate(0, 0, 1)}},
+		{"created_at:>2026-01-02", "c.created_at >= $1", []any{day.AddDate(0, 0, 1)}},
+		{"status:online OR name:a", "(lower(" + statusExpr + ") = lower($1) or lower(c.name) = lower($2))", []any{"online", "a"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			q, err := ParseCameraQuery(tt.query)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var args []any
+			if sql := q.pred.sql(&args); sql != tt.sql {
+				t.Errorf("sql = %s; want %s", sql, tt.sql)
+			}
+			if fmt.Sprint(args) != fmt.Sprint(tt.args) {
+				t.Errorf("args = %v; want %v", args, tt.args)
+			}
+		})
+	}
+}
+
+func TestCameraQueryMatch(t *testing.T) {
+	created := time.Date(2026, 3, 14, 15, 9, 26, 0, time.UTC)
+	camera := &Camera{
+		ID: 7, CreatedAt: created, Name: "Lobby East", MacAddress: "ACCC8E000001",
+		SiteName: "NYC-5th-GLH", ModelNo: "P3245", Version: 2,
+	}
+
+	tests := []struct {
+		query string
+		want  bool
+	}{
+		{"name:lobby*", true},
+		{`name:"lobby east"`, true},
+		{"name:lobby", false},
+		{"model_no:P32* site_name:*-GLH created_at:>=2026-01-01 NOT status:online", true},
+		{"model_no:P32* site_name:*-OPS", false},
+		{"site_name:*-OPS OR id:7", true},
+		{"id:>=7 id:<=7 version:>1 version:<3", true},
+		{"created_at:2026-03-14", true},
+		{"created_at:>2026-03-14", false},
+		{"created_at:<=2026-03-14", true},
+		{"created_at:<2026-03-14T15:09:26Z", false},
+		{"status:unknown", true},
+		{"mac_address:accc8e*01", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			q, err := ParseCameraQuery(tt.query)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := q.pred.match(camera); got != tt.want {
+				t.Errorf("match = %t; want %t", got, tt.want)
+			}
+		})
+	}
+}
+
+func FuzzParseCameraQuery(f *testing.F) {
+	f.Add("model_no:P32* site_name:*-GLH created_at:>=2026-01-01 NOT status:online")
+	f.Add("id:>3 OR (version:1 name:\"a b\")")
+	f.Add("created_at:2026-01-02T03:04:05Z")
+
+	camera := &Camera{ID: 1, Name: "lobby", CreatedAt: time.Now()}
+	f.Fuzz(func(t *testing.T, s string) {
+		q, err := ParseCameraQuery(s)
+		if err != nil {
+			var qerr *query.Error
+			if !errors.As(err, &qerr) {
+				t.Fatalf("ParseCameraQuery(%q) returned %T, want *query.Error", s, err)
+			}
+			return
+		}
+
+		// Every argument must be used by a placeholder, and no part of the query text
+		// may reach the SQL other than through an argument.
+		var args []any
+		sql := q.pred.sql(&args)
+		for i := range args {
+			if !strings.Contains(sql, fmt.Sprintf("$%d", i+1)) {
+				t.Fatalf("ParseCameraQuery(%q): $%d unused in %s", s, i+1, sql)
+			}
+		}
+		if strings.ContainsAny(strings.ReplaceAll(sql, statusExpr, ""), `'";`) {
+			t.Fatalf("ParseCameraQuery(%q): literal in %s", s, sql)
+		}
+		q.pred.match(camera)
+	})
+}
+
+func TestHighlight(t *testing.T) {
+	camera := &Camera{Name: "Lobby <East>", SiteName: "NYC-5th-OPS", ModelNo: "P3245", MacAddress: "ACCC8E000001"}
+
+	tests := []struct {
+		search string
+		want   map[string]string
+	}{
+		{"lobby east", map[string]string{"name": "<mark>Lobby</mark> &lt;<mark>East</mark>&gt;"}},
+		{"lob-e", map[string]string{"name": "<mark>Lob</mark>by &lt;<mark>E</mark>ast&gt;", "mac_address": "ACCC8<mark>E</mark>000001"}},
+		{"p32 8e00", map[string]string{"model_no": "<mark>P32</mark>45", "mac_address": "ACCC<mark>8E00</mark>0001"}},
+		{"nyc 5th", map[string]string{"site_name": "<mark>NYC</mark>-<mark>5th</mark>-OPS"}},
+		{"00 000", map[string]string{"mac_address": "ACCC8E<mark>00000</mark>1"}},
+		{"parking", nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.search, func(t *testing.T) {
+			if got := highlight(camera, tt.search); fmt.Sprint(got) != fmt.Sprint(tt.want) {
+				t.Errorf("highlight = %v; want %v", got, tt.want)
+			}
+		})
+	}
+}
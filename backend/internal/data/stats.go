@@ -0,0 +1,214 @@
+package data
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/chefgoldbloom/pnctool/backend/internal/validator"
+)
+
+// statsGroups maps each group_by value to the expression cameras c are grouped on.
+// Sites and models without a row in their table fall back to what the camera itself
+// says, the same way include=site and include=model do.
+var statsGroups = map[string]string{
+	"site_name": "c.site_name",
+	"model_no":  "c.model_no",
+	"office_type": `coalesce(nullif(s.office_type, ''),
+		case when c.site_name ~ '-.*-' then substring(c.site_name from '[^-]*$') end, 'unknown')`,
+	"vendor":        "coalesce(nullif(m.vendor, ''), 'unknown')",
+	"status":        statusExpr,
+	"created_month": "to_char(c.created_at at time zone 'UTC', 'YYYY-MM')",
+}
+
+// StatsGroupSafelist is every value accepted by group_by.
+var StatsGroupSafelist = []string{"site_name", "model_no", "office_type", "vendor", "status", "created_month"}
+
+// MaxStatsWeeks is the longest time series, in weeks, which can be requested.
+const MaxStatsWeeks = 520
+
+// GroupStats counts cameras by one attribute. With a top-N limit the smaller groups
+// are folded into Other.
+type GroupStats struct {
+	GroupBy string       `json:"group_by"`
+	Total   int64        `json:"total"`
+	Groups  []GroupCount `json:"groups"`
+	Other   *OtherCount  `json:"other,omitempty"`
+}
+
+// GroupCount is the number of cameras in one group and their share of the total.
+type GroupCount struct {
+	Key     string  `json:"key"`
+	Count   int64   `json:"count"`
+	Percent float64 `json:"percent"`
+}
+
+// OtherCount is the cameras in the groups left out of a top-N result.
+type OtherCount struct {
+	Groups  int64   `json:"groups"`
+	Count   int64   `json:"count"`
+	Percent float64 `json:"percent"`
+}
+
+// TimeSeries counts cameras added per week. Weeks start on Monday, in UTC; From is the
+// first week and To is the Monday after the last.
+type TimeSeries struct {
+	Interval string        `json:"interval"`
+	From     time.Time     `json:"from"`
+	To       time.Time     `json:"to"`
+	Series   []WeeklyCount `json:"series"`
+}
+
+// WeeklyCount is the number of cameras added in a week, and the running total at the
+// end of it.
+type WeeklyCount struct {
+	Week  time.Time `json:"week"`
+	Added int64     `json:"added"`
+	Total int64     `json:"total"`
+}
+
+// weekStart returns midnight UTC on the Monday of t's week.
+func weekStart(t time.Time) time.Time {
+	t = t.UTC()
+	day := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+	return day.AddDate(0, 0, -(int(day.Weekday())+6)%7)
+}
+
+// WeekRange returns the weeks covering the days from and to, inclusive.
+func WeekRange(from, to time.Time) (start, end time.Time) {
+	return weekStart(from), weekStart(to).AddDate(0, 0, 7)
+}
+
+// ValidateGroupStats checks the grouping and top-N limit of a statistics request.
+func ValidateGroupStats(v *validator.Validator, groupBy string, top int) {
+	v.CheckCode(groupBy != "", "group_by", validator.CodeRequired, "must be provided")
+	v.CheckCode(groupBy == "" || validator.PermittedValue(groupBy, StatsGroupSafelist...), "group_by", validator.CodeNotPermitted, "invalid group_by value")
+	v.CheckCode(top >= 0 && top <= 1000, "top", validator.CodeOutOfRange, "must be between 0 and 1000")
+}
+
+// ValidateTimeSeries checks the date range of a time series request.
+func ValidateTimeSeries(v *validator.Validator, from, to time.Time) {
+	v.CheckCode(!from.After(to), "from", validator.CodeOutOfRange, "must not be after to")
+	start, end := WeekRange(from, to)
+	v.CheckCode(end.Sub(start) <= MaxStatsWeeks*7*24*time.Hour, "to", validator.CodeOutOfRange, fmt.Sprintf("must be within %d weeks of from", MaxStatsWeeks))
+}
+
+// statsJoins are the tables the group expressions may refer to.
+const statsJoins = `
+		left join sites s on s.name = c.site_name
+		left join camera_models m on m.model_no = c.model_no`
+
+// CountBy counts the cameras matching filter grouped by groupBy, largest group first.
+// If top is positive only that many groups are returned and the rest are summed into
+// Other.
+func (c CameraModel) CountBy(filter CameraFilter, groupBy string, top int) (*GroupStats, error) {
+	expr, ok := statsGroups[groupBy]
+	if !ok {
+		// ValidateGroupStats should already have rejected the value.
+		panic("unsafe group_by parameter: " + groupBy)
+	}
+
+	var args []any
+	where, _ := filter.where(&args)
+	limit := placeholder(&args, top)
+
+	// Groups are ranked in the same query that counts them, so folding the tail into
+	// the null bucket doesn't need a second pass. min(rn) keeps that bucket last.
+	query := fmt.Sprintf(`
+		with counts as (
+			select %s as key, count(*) as n
+			from cameras c %s
+			where %s
+			group by 1
+		), ranked as (
+			select key, n, sum(n) over () as total, row_number() over (order by n desc, key) as rn
+			from counts
+		)
+		select case when %[4]s = 0 or rn <= %[4]s then key end as bucket,
+			count(*), sum(n)::bigint, round(100.0 * sum(n) / max(total), 2)::float8, max(total)::bigint
+		from ranked
+		group by bucket
+		order by min(rn)
+	`, expr, statsJoins, where, limit)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := c.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	stats := &GroupStats{GroupBy: groupBy, Groups: []GroupCount{}}
+	for rows.Next() {
+		var (
+			key    *string
+			groups int64
+			g      GroupCount
+		)
+		if err := rows.Scan(&key, &groups, &g.Count, &g.Percent, &stats.Total); err != nil {
+			return nil, err
+		}
+		if key == nil {
+			stats.Other = &OtherCount{Groups: groups, Count: g.Count, Percent: g.Percent}
+			continue
+		}
+		g.Key = *key
+		stats.Groups = append(stats.Groups, g)
+	}
+	return stats, rows.Err()
+}
+
+// CountAddedByWeek counts the cameras matching filter added in each week from the
+// week of from to the week of to, including weeks where none were added.
+func (c CameraModel) CountAddedByWeek(filter CameraFilter, from, to time.Time) (*TimeSeries, error) {
+	start, end := WeekRange(from, to)
+
+	var args []any
+	where, _ := filter.where(&args)
+	startArg, endArg := placeholder(&args, start), placeholder(&args, end)
+
+	// Weeks are generated as UTC timestamps so a daylight saving change in the
+	// session's time zone can't shift them.
+	query := fmt.Sprintf(`
+		with weeks as (
+			select generate_series(%[3]s::timestamptz at time zone 'UTC', %[4]s::timestamptz at time zone 'UTC' - interval '1 week', interval '1 week') as week
+		), added as (
+			select date_trunc('week', c.created_at at time zone 'UTC') as week, count(*) as n
+			from cameras c %[1]s
+			where %[2]s
+			and c.created_at >= %[3]s and c.created_at < %[4]s
+			group by 1
+		), before as (
+			select count(*) as n
+			from cameras c %[1]s
+			where %[2]s
+			and c.created_at < %[3]s
+		)
+		select w.week, coalesce(a.n, 0), ((select n from before) + sum(coalesce(a.n, 0)) over (order by w.week))::bigint
+		from weeks w
+		left join added a on a.week = w.week
+		order by w.week
+	`, statsJoins, where, startArg, endArg)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := c.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	series := &TimeSeries{Interval: "week", From: start, To: end, Series: []WeeklyCount{}}
+	for rows.Next() {
+		var w WeeklyCount
+		if err := rows.Scan(&w.Week, &w.Added, &w.Total); err != nil {
+			return nil, err
+		}
+		w.Week = time.Date(w.Week.Year(), w.Week.Month(), w.Week.Day(), 0, 0, 0, 0, time.UTC)
+		series.Series = append(series.Series, w)
+	}
+	return series, rows.Err()
+}
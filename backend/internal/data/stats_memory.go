@@ -0,0 +1,104 @@
+package data
+
+import (
+	"cmp"
+	"math"
+	"slices"
+	"time"
+)
+
+// statsKeys computes the group_by values in memory. There are no site or model tables
+// in memory, so office types come from the site name and vendors are unknown.
+var statsKeys = map[string]func(*Camera) string{
+	"site_name": func(c *Camera) string { return c.SiteName },
+	"model_no":  func(c *Camera) string { return c.ModelNo },
+	"office_type": func(c *Camera) string {
+		if office := siteFromName(c.SiteName).OfficeType; office != "" {
+			return office
+		}
+		return "unknown"
+	},
+	"vendor":        func(c *Camera) string { return "unknown" },
+	"status":        cameraStatusOf,
+	"created_month": func(c *Camera) string { return c.CreatedAt.UTC().Format("2006-01") },
+}
+
+// percent returns n as a percentage of total, rounded to two places like the SQL.
+func percent(n, total int64) float64 {
+	return math.Round(10000*float64(n)/float64(total)) / 100
+}
+
+// CountBy counts the stored cameras the same way the SQL query does.
+func (m *MemoryCameraModel) CountBy(filter CameraFilter, groupBy string, top int) (*GroupStats, error) {
+	key, ok := statsKeys[groupBy]
+	if !ok {
+		panic("unsafe group_by parameter: " + groupBy)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	stats := &GroupStats{GroupBy: groupBy, Groups: []GroupCount{}}
+	counts := map[string]int64{}
+	for _, camera := range m.cameras {
+		camera := m.withStatus(camera)
+		if filter.match(&camera) {
+			counts[key(&camera)]++
+			stats.Total++
+		}
+	}
+
+	var groups []GroupCount
+	for k, n := range counts {
+		groups = append(groups, GroupCount{Key: k, Count: n, Percent: percent(n, stats.Total)})
+	}
+	slices.SortFunc(groups, func(a, b GroupCount) int {
+		if c := cmp.Compare(b.Count, a.Count); c != 0 {
+			return c
+		}
+		return cmp.Compare(a.Key, b.Key)
+	})
+
+	if top > 0 && len(groups) > top {
+		other := &OtherCount{Groups: int64(len(groups) - top)}
+		for _, g := range groups[top:] {
+			other.Count += g.Count
+		}
+		other.Percent = percent(other.Count, stats.Total)
+		stats.Other = other
+		groups = groups[:top]
+	}
+	stats.Groups = append(stats.Groups, groups...)
+	return stats, nil
+}
+
+// CountAddedByWeek counts the stored cameras added per week the same way the SQL
+// query does.
+func (m *MemoryCameraModel) CountAddedByWeek(filter CameraFilter, from, to time.Time) (*TimeSeries, error) {
+	start, end := WeekRange(from, to)
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	series := &TimeSeries{Interval: "week", From: start, To: end, Series: []WeeklyCount{}}
+	added := map[time.Time]int64{}
+	var total int64
+	for _, camera := range m.cameras {
+		camera := m.withStatus(camera)
+		if !filter.match(&camera) {
+			continue
+		}
+		switch {
+		case camera.CreatedAt.Before(start):
+			total++
+		case camera.CreatedAt.Before(end):
+			added[weekStart(camera.CreatedAt)]++
+		}
+	}
+
+	for week := start; week.Before(end); week = week.AddDate(0, 0, 7) {
+		total += added[week]
+		series.Series = append(series.Series, WeeklyCount{Week: week, Added: added[week], Total: total})
+	}
+	return series, nil
+}
@@ -0,0 +1,104 @@
+package data
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestWeekRange(t *testing.T) {
+	day := func(s string) time.Time {
+		d, _ := time.Parse(time.DateOnly, s)
+		return d
+	}
+
+	tests := []struct {
+		from, to   string
+		start, end string
+	}{
+		{"2026-01-05", "2026-01-05", "2026-01-05", "2026-01-12"},
+		{"2026-01-04", "2026-01-06", "2025-12-29", "2026-01-12"},
+		{"2026-01-11", "2026-03-01", "2026-01-05", "2026-03-02"},
+	}
+
+	for _, tt := range tests {
+		start, end := WeekRange(day(tt.from), day(tt.to))
+		if !start.Equal(day(tt.start)) || !end.Equal(day(tt.end)) {
+			t.Errorf("WeekRange(%s, %s) = %s, %s; want %s, %s", tt.from, tt.to, start, end, tt.start, tt.end)
+		}
+	}
+}
+
+func TestCameraModelStats(t *testing.T) {
+	db := newTestDB(t)
+	m := CameraModel{DB: db}
+
+	for _, c := range []*Camera{
+		newTestCamera("lobby", "ACCC8E000001", "NYC-5th-GLH", "P3245"),
+		newTestCamera("dock", "ACCC8E000002", "NYC-5th-GLH", "P3265"),
+		newTestCamera("gate", "ACCC8E000003", "BOS-Main-GLH", "M1065"),
+		newTestCamera("roof", "ACCC8E000004", "BOS-Main-OPS", "P3245"),
+	} {
+		if err := m.Insert(c); err != nil {
+			t.Fatal(err)
+		}
+	}
+	_, err := db.Exec(`
+		update cameras set created_at = '2026-01-05T10:00:00Z' where id in (1, 2);
+		update cameras set created_at = '2026-01-21T10:00:00Z' where id = 3;
+		update cameras set created_at = '2025-12-01T10:00:00Z' where id = 4;
+		insert into camera_models (model_no, vendor) values ('P3245', 'Axis');
+		insert into camera_status (camera_id, status) values (2, 'online');`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		groupBy string
+		top     int
+		groups  string
+		other   string
+	}{
+		{"site_name", 0, "[{NYC-5th-GLH 2 50} {BOS-Main-GLH 1 25} {BOS-Main-OPS 1 25}]", "<nil>"},
+		{"office_type", 0, "[{GLH 3 75} {OPS 1 25}]", "<nil>"},
+		{"vendor", 0, "[{Axis 2 50} {unknown 2 50}]", "<nil>"},
+		{"status", 0, "[{unknown 3 75} {online 1 25}]", "<nil>"},
+		{"created_month", 0, "[{2026-01 3 75} {2025-12 1 25}]", "<nil>"},
+		{"model_no", 1, "[{P3245 2 50}]", "&{2 2 50}"},
+	}
+
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf("%s top %d", tt.groupBy, tt.top), func(t *testing.T) {
+			stats, err := m.CountBy(CameraFilter{}, tt.groupBy, tt.top)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if stats.Total != 4 || fmt.Sprint(stats.Groups) != tt.groups || fmt.Sprint(stats.Other) != tt.other {
+				t.Errorf("stats = %d %v %v; want 4 %s %s", stats.Total, stats.Groups, stats.Other, tt.groups, tt.other)
+			}
+		})
+	}
+
+	from := time.Date(2026, 1, 7, 0, 0, 0, 0, time.UTC)
+	to := time.Date(2026, 1, 19, 0, 0, 0, 0, time.UTC)
+	series, err := m.CountAddedByWeek(CameraFilter{SiteName: "nyc-5th-glh"}, from, to)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "[{2026-01-05 2 2} {2026-01-12 0 2} {2026-01-19 0 2}]"
+	got := []string{}
+	for _, w := range series.Series {
+		got = append(got, fmt.Sprintf("{%s %d %d}", w.Week.Format(time.DateOnly), w.Added, w.Total))
+	}
+	if fmt.Sprint(got) != want {
+		t.Errorf("series = %v; want %s", got, want)
+	}
+
+	series, err = m.CountAddedByWeek(CameraFilter{}, from.AddDate(0, 0, 7), to)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(series.Series) != 2 || series.Series[0].Total != 3 || series.Series[1].Added != 1 || series.Series[1].Total != 4 {
+		t.Errorf("series = %+v", series.Series)
+	}
+}
@@ -0,0 +1,263 @@
+package data
+
+import (
+	"cmp"
+	"context"
+	"database/sql"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/chefgoldbloom/pnctool/backend/internal/validator"
+)
+
+// Camera statuses recorded by the status poller. Cameras which have never been
+// polled are StatusUnknown.
+const (
+	StatusOnline       = "online"
+	StatusOffline      = "offline"
+	StatusUnauthorized = "unauthorized"
+	StatusUnknown      = "unknown"
+)
+
+// StatusSafelist is every value accepted by the status filter.
+var StatusSafelist = []string{StatusOnline, StatusOffline, StatusUnauthorized, StatusUnknown}
+
+// StatusRepository is what the status poller reads and writes. StatusModel
+// implements it on top of Postgres and MemoryCameraModel implements it in memory.
+type StatusRepository interface {
+	// Targets returns every camera with an address, credentials included, in id
+	// order.
+	Targets() ([]*Camera, error)
+
+	// Record stores the result of checking a camera, adding a StatusChange to its
+	// history if the status differs from the last one. A nil LastSeenAt keeps the
+	// time the camera was last seen. It returns the status the camera had before,
+	// StatusUnknown if it had none, and ErrRecordNotFound if the camera has been
+	// deleted.
+	Record(id int64, status *CameraStatus) (previous string, err error)
+
+	// History returns the status changes between from and to of every camera at
+	// site, or at every site if site is empty, in id order. Each camera's changes
+	// start with the last one before from, if any, which gives its status at from.
+	History(site string, from, to time.Time) ([]CameraHistory, error)
+}
+
+// StatusChange is a camera's status changing, as seen by the poller.
+type StatusChange struct {
+	Status    string    `json:"status"`
+	ChangedAt time.Time `json:"changed_at"`
+}
+
+// CameraHistory is one camera's status changes, oldest first.
+type CameraHistory struct {
+	CameraID int64
+	Name     string
+	SiteName string
+	Changes  []StatusChange
+}
+
+type StatusModel struct {
+	DB DBTX
+}
+
+func (m StatusModel) Targets() ([]*Camera, error) {
+	query := `
+		select id, name, mac_address, site_name, model_no, address, username, password, version
+		from cameras
+		where address <> ''
+		order by id
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	cameras := []*Camera{}
+	for rows.Next() {
+		var c Camera
+		err := rows.Scan(&c.ID, &c.Name, &c.MacAddress, &c.SiteName, &c.ModelNo, &c.Address, &c.Username, &c.Password, &c.Version)
+		if err != nil {
+			return nil, err
+		}
+		cameras = append(cameras, &c)
+	}
+	return cameras, rows.Err()
+}
+
+func (m StatusModel) Record(id int64, status *CameraStatus) (string, error) {
+	// Selecting from cameras rather than inserting values means a camera deleted
+	// since Targets inserts nothing, instead of failing the foreign key. previous
+	// sees the status from before the upsert, so a change is logged to the history
+	// in the same statement.
+	query := `
+		with previous as (
+			select status from camera_status where camera_id = $1
+		), upserted as (
+			insert into camera_status (camera_id, status, latency_ms, last_seen_at, checked_at)
+			select id, $2::text, $3::integer, $4::timestamptz, $5::timestamptz from cameras where id = $1
+			on conflict (camera_id) do update
+			set status = excluded.status, latency_ms = excluded.latency_ms,
+				last_seen_at = coalesce(excluded.last_seen_at, camera_status.last_seen_at),
+				checked_at = excluded.checked_at
+			returning camera_id
+		), changed as (
+			insert into camera_status_history (camera_id, status, changed_at)
+			select camera_id, $2::text, $5::timestamptz from upserted
+			where $2::text is distinct from (select status from previous)
+		)
+		select count(*), coalesce((select status from previous), 'unknown') from upserted
+	`
+	var latency sql.NullInt32
+	if status.LatencyMS != nil {
+		latency = sql.NullInt32{Int32: int32(*status.LatencyMS), Valid: true}
+	}
+	args := []any{id, status.Status, latency, status.LastSeenAt, status.CheckedAt}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var (
+		n        int
+		previous string
+	)
+	err := m.DB.QueryRowContext(ctx, query, args...).Scan(&n, &previous)
+	if err != nil {
+		return "", err
+	}
+	if n == 0 {
+		return "", ErrRecordNotFound
+	}
+	return previous, nil
+}
+
+func (m StatusModel) History(site string, from, to time.Time) ([]CameraHistory, error) {
+	// Every camera at the site is returned, with or without changes, so cameras
+	// which have never been polled show up in reports as unmonitored.
+	query := `
+		select c.id, c.name, c.site_name, h.status, h.changed_at
+		from cameras c
+		left join camera_status_history h on h.camera_id = c.id and h.changed_at < $3 and (
+			h.changed_at >= $2 or h.changed_at = (
+				select max(p.changed_at) from camera_status_history p
+				where p.camera_id = c.id and p.changed_at < $2))
+		where lower(c.site_name) = lower($1) or $1 = ''
+		order by c.id, h.changed_at, h.id
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, site, from, to)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	histories := []CameraHistory{}
+	for rows.Next() {
+		var (
+			h         CameraHistory
+			status    sql.NullString
+			changedAt sql.NullTime
+		)
+		err := rows.Scan(&h.CameraID, &h.Name, &h.SiteName, &status, &changedAt)
+		if err != nil {
+			return nil, err
+		}
+		if n := len(histories); n == 0 || histories[n-1].CameraID != h.CameraID {
+			histories = append(histories, h)
+		}
+		if status.Valid {
+			last := &histories[len(histories)-1]
+			last.Changes = append(last.Changes, StatusChange{Status: status.String, ChangedAt: changedAt.Time})
+		}
+	}
+	return histories, rows.Err()
+}
+
+// Targets returns copies of the cameras with an address.
+func (m *MemoryCameraModel) Targets() ([]*Camera, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	cameras := []*Camera{}
+	for _, camera := range m.cameras {
+		if camera.Address != "" {
+			camera := camera
+			cameras = append(cameras, &camera)
+		}
+	}
+	slices.SortFunc(cameras, func(a, b *Camera) int { return cmp.Compare(a.ID, b.ID) })
+	return cameras, nil
+}
+
+// Record stores a copy of status for the camera, truncated to the second like the
+// timestamp(0) columns.
+func (m *MemoryCameraModel) Record(id int64, status *CameraStatus) (string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.cameras[id]; !ok {
+		return "", ErrRecordNotFound
+	}
+	previous := StatusUnknown
+	if stored, ok := m.statuses[id]; ok {
+		previous = stored.Status
+	}
+
+	stored := *status
+	stored.CheckedAt = stored.CheckedAt.Truncate(time.Second)
+	if stored.LastSeenAt != nil {
+		seen := stored.LastSeenAt.Truncate(time.Second)
+		stored.LastSeenAt = &seen
+	} else if previous, ok := m.statuses[id]; ok {
+		stored.LastSeenAt = previous.LastSeenAt
+	}
+	if stored.LatencyMS != nil {
+		latency := *stored.LatencyMS
+		stored.LatencyMS = &latency
+	}
+	if previous, ok := m.statuses[id]; !ok || previous.Status != stored.Status {
+		m.history[id] = append(m.history[id], StatusChange{Status: stored.Status, ChangedAt: stored.CheckedAt})
+	}
+	m.statuses[id] = stored
+	return previous, nil
+}
+
+// History returns copies of the recorded status changes.
+func (m *MemoryCameraModel) History(site string, from, to time.Time) ([]CameraHistory, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	histories := []CameraHistory{}
+	for _, camera := range m.cameras {
+		if site != "" && !strings.EqualFold(camera.SiteName, site) {
+			continue
+		}
+		h := CameraHistory{CameraID: camera.ID, Name: camera.Name, SiteName: camera.SiteName}
+		for _, change := range m.history[camera.ID] {
+			switch {
+			case !change.ChangedAt.Before(to):
+			case change.ChangedAt.Before(from):
+				// Only the last change before from is kept.
+				h.Changes = append(h.Changes[:0], change)
+			default:
+				h.Changes = append(h.Changes, change)
+			}
+		}
+		histories = append(histories, h)
+	}
+	slices.SortFunc(histories, func(a, b CameraHistory) int { return cmp.Compare(a.CameraID, b.CameraID) })
+	return histories, nil
+}
+
+// ValidateStatus checks a status filter value.
+func ValidateStatus(v *validator.Validator, status string) {
+	v.CheckCode(validator.PermittedValue(strings.ToLower(status), StatusSafelist...), "status", validator.CodeNotPermitted, "must be one of: "+strings.Join(StatusSafelist, ", "))
+}
@@ -0,0 +1,125 @@
+package data
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// testStatusRepository records statuses through repo and reads them back through
+// cameras, which must share its data.
+func testStatusRepository(t *testing.T, cameras CameraRepository, repo StatusRepository) {
+	for _, c := range []*Camera{
+		{Name: "lobby", MacAddress: "ACCC8E000001", SiteName: "NYC-5th-GLH", Address: "10.0.0.1"},
+		{Name: "dock", MacAddress: "ACCC8E000002", SiteName: "NYC-5th-GLH"},
+		{Name: "gate", MacAddress: "ACCC8E000003", SiteName: "BOS-Main-GLH", Address: "https://10.0.0.3"},
+	} {
+		if err := cameras.Insert(c); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	targets, err := repo.Targets()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(targets) != 2 || targets[0].ID != 1 || targets[1].ID != 3 || targets[0].Password != "pass" {
+		t.Fatalf("targets = %+v; want cameras 1 and 3 with credentials", targets)
+	}
+
+	seen := time.Date(2026, 3, 2, 9, 0, 0, 0, time.UTC)
+	latency := 12
+	previous, err := repo.Record(1, &CameraStatus{Status: StatusOnline, LatencyMS: &latency, LastSeenAt: &seen, CheckedAt: seen})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if previous != StatusUnknown {
+		t.Errorf("first Record: previous = %q; want %q", previous, StatusUnknown)
+	}
+	if _, err := repo.Record(3, &CameraStatus{Status: StatusOnline, CheckedAt: seen}); err != nil {
+		t.Fatal(err)
+	}
+	// Going offline keeps the time the camera was last seen.
+	later := seen.Add(time.Minute)
+	previous, err = repo.Record(1, &CameraStatus{Status: StatusOffline, CheckedAt: later})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if previous != StatusOnline {
+		t.Errorf("second Record: previous = %q; want %q", previous, StatusOnline)
+	}
+	if _, err := repo.Record(99, &CameraStatus{Status: StatusOnline, CheckedAt: later}); !errors.Is(err, ErrRecordNotFound) {
+		t.Errorf("Record for a missing camera: err = %v; want ErrRecordNotFound", err)
+	}
+
+	camera, err := cameras.GetProjected(1, Projection{Include: []string{"status"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := camera.Status
+	if s == nil || s.Status != StatusOffline || s.LatencyMS != nil || s.LastSeenAt == nil || !s.LastSeenAt.Equal(seen) || !s.CheckedAt.Equal(later) {
+		t.Errorf("status = %+v; want offline, last seen %v, checked %v", s, seen, later)
+	}
+
+	// Only changes are kept in the history, and each camera's starts with the last
+	// change before from. Camera 2 has never been polled.
+	if _, err := repo.Record(3, &CameraStatus{Status: StatusOnline, CheckedAt: later}); err != nil {
+		t.Fatal(err)
+	}
+	histories, err := repo.History("nyc-5th-glh", seen.Add(30*time.Second), later.Add(time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []CameraHistory{
+		{CameraID: 1, Name: "lobby", SiteName: "NYC-5th-GLH", Changes: []StatusChange{{StatusOnline, seen}, {StatusOffline, later}}},
+		{CameraID: 2, Name: "dock", SiteName: "NYC-5th-GLH"},
+	}
+	if !reflect.DeepEqual(normalizeHistories(histories), want) {
+		t.Errorf("History = %+v; want %+v", histories, want)
+	}
+	histories, err = repo.History("", later.Add(time.Second), later.Add(time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(histories) != 3 || len(histories[0].Changes) != 1 || histories[0].Changes[0].Status != StatusOffline || len(histories[2].Changes) != 1 {
+		t.Errorf("History for every site = %+v; want the status at from of cameras 1 and 3", histories)
+	}
+
+	filters := Filters{Page: 1, PageSize: 10, Sort: "id", SortSafelist: []string{"id"}}
+	for status, want := range map[string]int{"online": 1, "OFFLINE": 1, "unknown": 1, "unauthorized": 0} {
+		got, _, err := cameras.GetAll(CameraFilter{Status: status}, Projection{}, filters)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(got) != want {
+			t.Errorf("status %s: got %d cameras; want %d", status, len(got), want)
+		}
+		for _, c := range got {
+			if c.Status != nil {
+				t.Errorf("status %s: status embedded without include=status", status)
+			}
+		}
+	}
+}
+
+func TestStatusModel(t *testing.T) {
+	db := newTestDB(t)
+	testStatusRepository(t, CameraModel{DB: db}, StatusModel{DB: db})
+}
+
+func TestMemoryStatusModel(t *testing.T) {
+	m := NewMemoryCameraModel()
+	testStatusRepository(t, m, m)
+}
+
+// normalizeHistories puts times in UTC, as Postgres returns them in the session's
+// time zone.
+func normalizeHistories(histories []CameraHistory) []CameraHistory {
+	for i := range histories {
+		for j := range histories[i].Changes {
+			histories[i].Changes[j].ChangedAt = histories[i].Changes[j].ChangedAt.UTC()
+		}
+	}
+	return histories
+}
@@ -0,0 +1,183 @@
+package data
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	_ "github.com/lib/pq"
+)
+
+// The integration tests run against PNC_TEST_DB_DSN when it is set. Otherwise, if
+// initdb and pg_ctl are on the PATH, a throwaway Postgres cluster is started in a
+// temporary directory for the test run. If neither is available the tests are
+// skipped. Each test gets its own schema with the migrations applied, so tests can
+// run in parallel and never see each other's rows.
+var (
+	pgOnce    sync.Once
+	pgDSN     string
+	pgErr     error
+	pgCleanup func()
+)
+
+func TestMain(m *testing.M) {
+	code := m.Run()
+	if pgCleanup != nil {
+		pgCleanup()
+	}
+	os.Exit(code)
+}
+
+// postgresDSN returns the DSN of the test server, starting an ephemeral one on first
+// use if needed.
+func postgresDSN() (string, error) {
+	pgOnce.Do(func() {
+		if dsn := os.Getenv("PNC_TEST_DB_DSN"); dsn != "" {
+			pgDSN = dsn
+			return
+		}
+		pgDSN, pgCleanup, pgErr = startEphemeralPostgres()
+	})
+	return pgDSN, pgErr
+}
+
+func startEphemeralPostgres() (string, func(), error) {
+	initdb, err := exec.LookPath("initdb")
+	if err != nil {
+		return "", nil, fmt.Errorf("set PNC_TEST_DB_DSN or install Postgres: %w", err)
+	}
+	pgCtl, err := exec.LookPath("pg_ctl")
+	if err != nil {
+		return "", nil, fmt.Errorf("set PNC_TEST_DB_DSN or install Postgres: %w", err)
+	}
+
+	dir, err := os.MkdirTemp("", "pnctool-pg-")
+	if err != nil {
+		return "", nil, err
+	}
+	cleanup := func() { os.RemoveAll(dir) }
+
+	dataDir := filepath.Join(dir, "data")
+	out, err := exec.Command(initdb, "-D", dataDir, "-U", "postgres", "--auth=trust", "--no-sync").CombinedOutput()
+	if err != nil {
+		cleanup()
+		return "", nil, fmt.Errorf("initdb: %v\n%s", err, out)
+	}
+
+	// Grab a free port; only the unix socket in dir is used to connect, but Postgres
+	// still names the socket after the port.
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		cleanup()
+		return "", nil, err
+	}
+	port := l.Addr().(*net.TCPAddr).Port
+	l.Close()
+
+	opts := fmt.Sprintf("-p %d -k %s -c listen_addresses='' -c fsync=off", port, dir)
+	out, err = exec.Command(pgCtl, "-D", dataDir, "-o", opts, "-l", filepath.Join(dir, "log"), "-w", "start").CombinedOutput()
+	if err != nil {
+		cleanup()
+		return "", nil, fmt.Errorf("pg_ctl start: %v\n%s", err, out)
+	}
+
+	stop := func() {
+		exec.Command(pgCtl, "-D", dataDir, "-m", "immediate", "stop").Run()
+		cleanup()
+	}
+	dsn := fmt.Sprintf("host=%s port=%d user=postgres dbname=postgres sslmode=disable", dir, port)
+	return dsn, stop, nil
+}
+
+// withSearchPath adds a search_path run-time parameter to a URL or key=value DSN.
+func withSearchPath(dsn, schema string) string {
+	if strings.HasPrefix(dsn, "postgres://") || strings.HasPrefix(dsn, "postgresql://") {
+		u, err := url.Parse(dsn)
+		if err == nil {
+			q := u.Query()
+			q.Set("search_path", schema)
+			u.RawQuery = q.Encode()
+			return u.String()
+		}
+	}
+	return dsn + " search_path=" + schema
+}
+
+// newTestDB returns a connection pool whose search_path points at a fresh schema with
+// every migration applied. The schema is dropped when the test finishes.
+func newTestDB(t *testing.T) *sql.DB {
+	t.Helper()
+
+	dsn, err := postgresDSN()
+	if err != nil {
+		t.Skipf("postgres unavailable: %v", err)
+	}
+
+	admin, err := sql.Open("postgres", dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer admin.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	b := make([]byte, 6)
+	rand.Read(b)
+	schema := "test_" + hex.EncodeToString(b)
+	if _, err := admin.ExecContext(ctx, "CREATE SCHEMA "+schema); err != nil {
+		t.Fatal(err)
+	}
+
+	// public stays on the path for extensions such as pg_trgm.
+	db, err := sql.Open("postgres", withSearchPath(dsn, schema+",public"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		db.Close()
+		if admin, err := sql.Open("postgres", dsn); err == nil {
+			admin.Exec("DROP SCHEMA " + schema + " CASCADE")
+			admin.Close()
+		}
+	})
+
+	applyMigrations(t, db)
+	return db
+}
+
+// applyMigrations runs every *.up.sql file in the migrations directory in order.
+func applyMigrations(t *testing.T, db *sql.DB) {
+	t.Helper()
+
+	files, err := filepath.Glob(filepath.Join("..", "..", "migrations", "*.up.sql"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) == 0 {
+		t.Fatal("no migrations found")
+	}
+	sort.Strings(files)
+
+	for _, f := range files {
+		b, err := os.ReadFile(f)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := db.Exec(string(b)); err != nil {
+			t.Fatalf("applying %s: %v", filepath.Base(f), err)
+		}
+	}
+}
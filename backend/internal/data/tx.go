@@ -0,0 +1,132 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"regexp"
+	"sync"
+)
+
+// DBTX is the subset of *sql.DB and *sql.Tx used by the models, so the same model
+// code runs inside or outside a transaction.
+type DBTX interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+}
+
+// Tx gives access to repositories which all operate inside one transaction, plus
+// savepoints for undoing part of the transaction.
+type Tx interface {
+	Cameras() CameraRepository
+	Savepoint(name string) error
+	RollbackTo(name string) error
+}
+
+// Transactor runs functions inside a transaction. If fn returns an error (or panics)
+// the transaction is rolled back, otherwise it is committed.
+type Transactor interface {
+	InTx(ctx context.Context, fn func(tx Tx) error) error
+}
+
+var savepointRxp = regexp.MustCompile(`^[a-z_][a-z0-9_]*$`)
+
+// SQLTransactor is a Transactor backed by a Postgres transaction.
+type SQLTransactor struct {
+	DB *sql.DB
+}
+
+func (t SQLTransactor) InTx(ctx context.Context, fn func(tx Tx) error) (err error) {
+	tx, err := t.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if p := recover(); p != nil {
+			tx.Rollback()
+			panic(p)
+		}
+		if err != nil {
+			tx.Rollback()
+			return
+		}
+		err = tx.Commit()
+	}()
+
+	return fn(sqlTx{tx: tx})
+}
+
+type sqlTx struct {
+	tx *sql.Tx
+}
+
+func (t sqlTx) Cameras() CameraRepository {
+	return CameraModel{DB: t.tx}
+}
+
+// Savepoint names can't be passed as query parameters, so they are restricted to
+// plain identifiers before being interpolated.
+func (t sqlTx) Savepoint(name string) error {
+	if !savepointRxp.MatchString(name) {
+		return fmt.Errorf("invalid savepoint name %q", name)
+	}
+	_, err := t.tx.Exec("SAVEPOINT " + name)
+	return err
+}
+
+func (t sqlTx) RollbackTo(name string) error {
+	if !savepointRxp.MatchString(name) {
+		return fmt.Errorf("invalid savepoint name %q", name)
+	}
+	_, err := t.tx.Exec("ROLLBACK TO SAVEPOINT " + name)
+	return err
+}
+
+// MemoryTransactor is a Transactor for the in-memory models. Transactions run one at a
+// time against a copy of the data which replaces the original on commit. Writes made
+// outside a transaction while one is running are lost when it commits, which is fine
+// for tests but is the reason this isn't a general purpose store.
+type MemoryTransactor struct {
+	mu      sync.Mutex
+	cameras *MemoryCameraModel
+}
+
+func NewMemoryTransactor(cameras *MemoryCameraModel) *MemoryTransactor {
+	return &MemoryTransactor{cameras: cameras}
+}
+
+func (t *MemoryTransactor) InTx(ctx context.Context, fn func(tx Tx) error) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	tx := &memoryTx{cameras: t.cameras.clone(), savepoints: map[string]*MemoryCameraModel{}}
+	if err := fn(tx); err != nil {
+		return err
+	}
+	t.cameras.restore(tx.cameras)
+	return nil
+}
+
+type memoryTx struct {
+	cameras    *MemoryCameraModel
+	savepoints map[string]*MemoryCameraModel
+}
+
+func (t *memoryTx) Cameras() CameraRepository {
+	return t.cameras
+}
+
+func (t *memoryTx) Savepoint(name string) error {
+	t.savepoints[name] = t.cameras.clone()
+	return nil
+}
+
+func (t *memoryTx) RollbackTo(name string) error {
+	sp, ok := t.savepoints[name]
+	if !ok {
+		return fmt.Errorf("savepoint %q does not exist", name)
+	}
+	t.cameras.restore(sp)
+	return nil
+}
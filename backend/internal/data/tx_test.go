@@ -0,0 +1,54 @@
+package data
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestSQLTransactor(t *testing.T) {
+	db := newTestDB(t)
+	tr := SQLTransactor{DB: db}
+	cameras := CameraModel{DB: db}
+
+	// A failed transaction leaves nothing behind.
+	errBoom := errors.New("boom")
+	err := tr.InTx(context.Background(), func(tx Tx) error {
+		if err := tx.Cameras().Insert(newTestCamera("a", "ACCC8E000001", "NYC-5th-OPS", "")); err != nil {
+			return err
+		}
+		return errBoom
+	})
+	if !errors.Is(err, errBoom) {
+		t.Fatalf("err = %v; want errBoom", err)
+	}
+
+	// Rolling back to a savepoint undoes only the later work.
+	err = tr.InTx(context.Background(), func(tx Tx) error {
+		if err := tx.Cameras().Insert(newTestCamera("kept", "ACCC8E000001", "NYC-5th-OPS", "")); err != nil {
+			return err
+		}
+		if err := tx.Savepoint("sp"); err != nil {
+			return err
+		}
+		if err := tx.Cameras().Insert(newTestCamera("undone", "ACCC8E000002", "NYC-5th-OPS", "")); err != nil {
+			return err
+		}
+		return tx.RollbackTo("sp")
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got, _, err := cameras.GetAll(CameraFilter{}, Projection{}, Filters{Page: 1, PageSize: 10, Sort: "id", SortSafelist: []string{"id"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 1 || got[0].Name != "kept" {
+		t.Errorf("cameras = %v; want only %q", got, "kept")
+	}
+
+	if err := tr.InTx(context.Background(), func(tx Tx) error { return tx.Savepoint("bad; drop table cameras") }); err == nil {
+		t.Error("unsafe savepoint name was accepted")
+	}
+}
@@ -0,0 +1,618 @@
+package data
+
+import (
+	"cmp"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/chefgoldbloom/pnctool/backend/internal/validator"
+)
+
+// Upgrade campaign states. A campaign runs until every camera is done, when it's
+// completed. It can be paused and resumed, and is halted by the runner when more
+// upgrades fail than it allows; raising max_failures and resuming carries on from
+// there. Cancelling a campaign skips the cameras it hasn't started on. Completed
+// and cancelled campaigns stay that way.
+const (
+	CampaignRunning   = "running"
+	CampaignPaused    = "paused"
+	CampaignHalted    = "halted"
+	CampaignCompleted = "completed"
+	CampaignCancelled = "cancelled"
+)
+
+var CampaignStateSafelist = []string{CampaignRunning, CampaignPaused, CampaignHalted, CampaignCompleted, CampaignCancelled}
+
+// Upgrade target states. A target is upgrading from when a runner claims it until
+// the camera has come back on the new firmware, or the upgrade has failed. Cameras
+// already running the image's firmware, without an address, or not started before
+// the campaign was cancelled are skipped.
+const (
+	TargetPending   = "pending"
+	TargetUpgrading = "upgrading"
+	TargetSucceeded = "succeeded"
+	TargetFailed    = "failed"
+	TargetSkipped   = "skipped"
+)
+
+var TargetStateSafelist = []string{TargetPending, TargetUpgrading, TargetSucceeded, TargetFailed, TargetSkipped}
+
+// UpgradeSelectionSafelist is every camera listing filter a campaign can select its
+// cameras with.
+var UpgradeSelectionSafelist = []string{"name", "mac_address", "model_no", "site_name", "status", "q", "search"}
+
+// campaignMoves is where a campaign in each state can be moved by a user.
+var campaignMoves = map[string][]string{
+	CampaignRunning: {CampaignPaused, CampaignCancelled},
+	CampaignPaused:  {CampaignRunning, CampaignCancelled},
+	CampaignHalted:  {CampaignRunning, CampaignCancelled},
+}
+
+// UpgradeCampaign installs a firmware image on the cameras its selection matched
+// when it was created. Cameras are upgraded in waves of WaveSize, in camera ID
+// order, with at most SiteConcurrency at any one site at once, counting the upgrades
+// of every campaign there; a wave starts when every camera of the one before is done. The campaign is halted once more than
+// MaxFailures upgrades have failed.
+type UpgradeCampaign struct {
+	ID              int64           `json:"id"`
+	CreatedAt       time.Time       `json:"created_at"`
+	CreatedBy       string          `json:"created_by"`
+	Name            string          `json:"name"`
+	Image           FirmwareImage   `json:"image"`
+	Selection       ViewParams      `json:"selection"`
+	WaveSize        int             `json:"wave_size"`
+	SiteConcurrency int             `json:"site_concurrency"`
+	MaxFailures     int             `json:"max_failures"`
+	State           string          `json:"state"`
+	StateReason     string          `json:"state_reason"`
+	FinishedAt      *time.Time      `json:"finished_at"`
+	Progress        UpgradeProgress `json:"progress"`
+	Version         int32           `json:"version"`
+}
+
+// UpgradeProgress counts a campaign's targets by state. Wave is the wave being
+// rolled out, or 0 once every camera is done.
+type UpgradeProgress struct {
+	Total     int `json:"total"`
+	Pending   int `json:"pending"`
+	Upgrading int `json:"upgrading"`
+	Succeeded int `json:"succeeded"`
+	Failed    int `json:"failed"`
+	Skipped   int `json:"skipped"`
+	Wave      int `json:"wave"`
+	Waves     int `json:"waves"`
+}
+
+// UpgradeTarget is one camera of a campaign. Name and SiteName are the camera's
+// when the campaign was created. PreviousFirmware is what the camera ran before the
+// upgrade and Firmware what it reported last.
+type UpgradeTarget struct {
+	CampaignID       int64      `json:"campaign_id"`
+	CameraID         int64      `json:"camera_id"`
+	Name             string     `json:"name"`
+	SiteName         string     `json:"site_name"`
+	Wave             int        `json:"wave"`
+	State            string     `json:"state"`
+	Attempts         int        `json:"attempts"`
+	PreviousFirmware string     `json:"previous_firmware"`
+	Firmware         string     `json:"firmware"`
+	Error            string     `json:"error"`
+	StartedAt        *time.Time `json:"started_at"`
+	FinishedAt       *time.Time `json:"finished_at"`
+}
+
+// ClaimedTarget is a target leased to a runner, with the camera to upgrade and the
+// image to install.
+type ClaimedTarget struct {
+	UpgradeTarget
+	Camera Camera
+	Image  FirmwareImage
+}
+
+// SetState moves the campaign to state, giving reason. It doesn't check the move is
+// allowed; ValidateUpgradeCampaignState does.
+func (c *UpgradeCampaign) SetState(state, reason string, at time.Time) {
+	if state == c.State {
+		return
+	}
+	c.State, c.StateReason = state, reason
+	c.FinishedAt = nil
+	if state == CampaignCompleted || state == CampaignCancelled {
+		at = at.Truncate(time.Second)
+		c.FinishedAt = &at
+	}
+}
+
+// settle returns the state a running campaign with the given progress should be
+// in, and why: halted if more upgrades failed than it allows, completed if no
+// cameras are left, and otherwise still running.
+func (c *UpgradeCampaign) settle(p UpgradeProgress) (state, reason string) {
+	switch {
+	case p.Failed > c.MaxFailures:
+		return CampaignHalted, fmt.Sprintf("failed upgrades (%d) exceeded max_failures (%d)", p.Failed, c.MaxFailures)
+	case p.Pending+p.Upgrading == 0:
+		return CampaignCompleted, ""
+	default:
+		return CampaignRunning, c.StateReason
+	}
+}
+
+// ValidateUpgradeCampaignState checks that a campaign in state from can be moved to
+// state to by a user.
+func ValidateUpgradeCampaignState(v *validator.Validator, from, to string) {
+	if !validator.PermittedValue(to, CampaignStateSafelist...) {
+		v.AddErrorCode("state", validator.CodeNotPermitted, "must be one of: "+strings.Join(CampaignStateSafelist, ", "))
+		return
+	}
+	v.CheckCode(to == from || slices.Contains(campaignMoves[from], to), "state", validator.CodeNotPermitted, fmt.Sprintf("cannot change from %s to %s", from, to))
+}
+
+func ValidateUpgradeCampaign(v *validator.Validator, c *UpgradeCampaign) {
+	v.CheckCode(c.Name != "", "name", validator.CodeRequired, "must be provided")
+	v.CheckCode(len(c.Name) <= 100, "name", validator.CodeTooLong, "must not be more than 100 bytes long")
+	v.CheckCode(c.WaveSize >= 1 && c.WaveSize <= 1000, "wave_size", validator.CodeOutOfRange, "must be between 1 and 1000")
+	v.CheckCode(c.SiteConcurrency >= 1 && c.SiteConcurrency <= 100, "site_concurrency", validator.CodeOutOfRange, "must be between 1 and 100")
+	v.CheckCode(c.MaxFailures >= 0 && c.MaxFailures <= 10_000, "max_failures", validator.CodeOutOfRange, "must be between 0 and 10000")
+	for key, value := range c.Selection {
+		v.CheckCode(slices.Contains(UpgradeSelectionSafelist, key), "selection", validator.CodeNotPermitted, "must only contain: "+strings.Join(UpgradeSelectionSafelist, ", "))
+		v.CheckCode(len(value) <= 1024, "selection."+key, validator.CodeTooLong, "must not be more than 1024 bytes long")
+	}
+}
+
+// newUpgradeTargets returns a target for each camera, in order, in waves of
+// waveSize. Cameras without an address can't be upgraded, so they're skipped.
+func newUpgradeTargets(campaignID int64, cameras []*Camera, waveSize int) []UpgradeTarget {
+	targets := make([]UpgradeTarget, len(cameras))
+	for i, camera := range cameras {
+		targets[i] = UpgradeTarget{
+			CampaignID: campaignID,
+			CameraID:   camera.ID,
+			Name:       camera.Name,
+			SiteName:   camera.SiteName,
+			Wave:       i/waveSize + 1,
+			State:      TargetPending,
+		}
+		if camera.Address == "" {
+			targets[i].State, targets[i].Error = TargetSkipped, "the camera has no address"
+		}
+	}
+	return targets
+}
+
+// newUpgradeProgress counts targets by state.
+func newUpgradeProgress(targets []UpgradeTarget) UpgradeProgress {
+	p := UpgradeProgress{Total: len(targets)}
+	for _, t := range targets {
+		switch t.State {
+		case TargetPending:
+			p.Pending++
+		case TargetUpgrading:
+			p.Upgrading++
+		case TargetSucceeded:
+			p.Succeeded++
+		case TargetFailed:
+			p.Failed++
+		case TargetSkipped:
+			p.Skipped++
+		}
+		if (t.State == TargetPending || t.State == TargetUpgrading) && (p.Wave == 0 || t.Wave < p.Wave) {
+			p.Wave = t.Wave
+		}
+		p.Waves = max(p.Waves, t.Wave)
+	}
+	return p
+}
+
+// UpgradeRepository stores upgrade campaigns and hands their cameras out to runners.
+// UpgradeModel implements it on top of Postgres and MemoryUpgradeModel implements
+// it in memory for tests.
+type UpgradeRepository interface {
+	// Insert creates a running campaign of the cameras, which should be in ID order,
+	// and sets its ID, CreatedAt, State, Progress and Version.
+	Insert(campaign *UpgradeCampaign, cameras []*Camera) error
+
+	// Get returns a campaign with its image and progress.
+	Get(id int64) (*UpgradeCampaign, error)
+
+	// GetAll returns every campaign, newest first.
+	GetAll() ([]*UpgradeCampaign, error)
+
+	// Targets returns a campaign's targets in any of states, or all of them if
+	// states is empty, in the order they're upgraded.
+	Targets(id int64, states []string) ([]*UpgradeTarget, error)
+
+	// Update saves the campaign's name, limits and state if its version still
+	// matches. Cancelling skips the targets which haven't started. A campaign which
+	// is running afterwards is halted or completed straight away if it should be.
+	Update(campaign *UpgradeCampaign) error
+
+	// Claim leases up to limit targets of running campaigns to the caller until
+	// now+lease and returns them. Only targets of a campaign's earliest unfinished
+	// wave are claimed, no more than its site concurrency at any site counting the
+	// targets of every campaign already leased there, and targets whose lease has run
+	// out are claimed again.
+	Claim(now time.Time, lease time.Duration, limit int) ([]*ClaimedTarget, error)
+
+	// Finish records the outcome of a claimed target, then halts its campaign if too
+	// many upgrades have failed or completes it if no cameras are left. It returns
+	// ErrEditConflict if the target has been claimed again since.
+	Finish(target *UpgradeTarget, at time.Time) error
+}
+
+// UpgradeModel needs a *sql.DB rather than a DBTX, as claims and changes of state
+// run in transactions of their own.
+type UpgradeModel struct {
+	DB *sql.DB
+}
+
+func (m UpgradeModel) Insert(c *UpgradeCampaign, cameras []*Camera) error {
+	selection, err := json.Marshal(c.Selection)
+	if err != nil {
+		return err
+	}
+	targets := newUpgradeTargets(0, cameras, c.WaveSize)
+	rows, err := json.Marshal(targets)
+	if err != nil {
+		return err
+	}
+
+	// Joining cameras leaves out any deleted since they were selected, instead of
+	// failing the foreign key.
+	query := `
+		with campaign as (
+			insert into upgrade_campaigns (created_by, name, image_id, selection, wave_size, site_concurrency, max_failures)
+			values ($1, $2, $3, $4, $5, $6, $7)
+			returning id, created_at, state, version
+		), targets as (
+			insert into upgrade_targets (campaign_id, camera_id, name, site_name, wave, state, error)
+			select campaign.id, t.camera_id, t.name, t.site_name, t.wave, t.state, t.error
+			from campaign, jsonb_to_recordset($8) as t(camera_id bigint, name text, site_name text, wave integer, state text, error text)
+			join cameras on cameras.id = t.camera_id
+		)
+		select id, created_at, state, version from campaign
+	`
+	args := []any{c.CreatedBy, c.Name, c.Image.ID, selection, c.WaveSize, c.SiteConcurrency, c.MaxFailures, rows}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err = m.DB.QueryRowContext(ctx, query, args...).Scan(&c.ID, &c.CreatedAt, &c.State, &c.Version)
+	if err != nil {
+		return err
+	}
+	c.StateReason, c.FinishedAt = "", nil
+	c.Progress = newUpgradeProgress(targets)
+	return nil
+}
+
+// campaignQuery selects campaigns c with their image and progress.
+const campaignQuery = `
+	select c.id, c.created_at, c.created_by, c.name, c.selection, c.wave_size, c.site_concurrency,
+		c.max_failures, c.state, c.state_reason, c.finished_at, c.version,
+		i.id, i.created_at, i.uploaded_by, i.model_no, i.firmware, i.filename, i.size, i.sha256,
+		p.total, p.pending, p.upgrading, p.succeeded, p.failed, p.skipped, p.wave, p.waves
+	from upgrade_campaigns c
+	join firmware_images i on i.id = c.image_id
+	cross join lateral (
+		select count(*) as total,
+			count(*) filter (where t.state = 'pending') as pending,
+			count(*) filter (where t.state = 'upgrading') as upgrading,
+			count(*) filter (where t.state = 'succeeded') as succeeded,
+			count(*) filter (where t.state = 'failed') as failed,
+			count(*) filter (where t.state = 'skipped') as skipped,
+			coalesce(min(t.wave) filter (where t.state in ('pending', 'upgrading')), 0) as wave,
+			coalesce(max(t.wave), 0) as waves
+		from upgrade_targets t
+		where t.campaign_id = c.id
+	) p
+`
+
+func scanCampaign(row interface{ Scan(...any) error }) (*UpgradeCampaign, error) {
+	var (
+		c         UpgradeCampaign
+		selection []byte
+		finished  sql.NullTime
+	)
+	i, p := &c.Image, &c.Progress
+	err := row.Scan(&c.ID, &c.CreatedAt, &c.CreatedBy, &c.Name, &selection, &c.WaveSize, &c.SiteConcurrency,
+		&c.MaxFailures, &c.State, &c.StateReason, &finished, &c.Version,
+		&i.ID, &i.CreatedAt, &i.UploadedBy, &i.ModelNo, &i.Firmware, &i.Filename, &i.Size, &i.SHA256,
+		&p.Total, &p.Pending, &p.Upgrading, &p.Succeeded, &p.Failed, &p.Skipped, &p.Wave, &p.Waves)
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(selection, &c.Selection); err != nil {
+		return nil, err
+	}
+	if finished.Valid {
+		c.FinishedAt = &finished.Time
+	}
+	return &c, nil
+}
+
+func (m UpgradeModel) Get(id int64) (*UpgradeCampaign, error) {
+	if id < 1 {
+		return nil, ErrRecordNotFound
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	c, err := scanCampaign(m.DB.QueryRowContext(ctx, campaignQuery+" where c.id = $1", id))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrRecordNotFound
+	}
+	return c, err
+}
+
+func (m UpgradeModel) GetAll() ([]*UpgradeCampaign, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, campaignQuery+" order by c.id desc")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	campaigns := []*UpgradeCampaign{}
+	for rows.Next() {
+		c, err := scanCampaign(rows)
+		if err != nil {
+			return nil, err
+		}
+		campaigns = append(campaigns, c)
+	}
+	return campaigns, rows.Err()
+}
+
+const targetColumns = `t.campaign_id, t.camera_id, t.name, t.site_name, t.wave, t.state, t.attempts,
+	t.previous_firmware, t.firmware, t.error, t.started_at, t.finished_at`
+
+func scanTarget(row interface{ Scan(...any) error }, dest ...any) (*UpgradeTarget, error) {
+	var (
+		t                 UpgradeTarget
+		started, finished sql.NullTime
+	)
+	err := row.Scan(append([]any{&t.CampaignID, &t.CameraID, &t.Name, &t.SiteName, &t.Wave, &t.State, &t.Attempts,
+		&t.PreviousFirmware, &t.Firmware, &t.Error, &started, &finished}, dest...)...)
+	if err != nil {
+		return nil, err
+	}
+	if started.Valid {
+		t.StartedAt = &started.Time
+	}
+	if finished.Valid {
+		t.FinishedAt = &finished.Time
+	}
+	return &t, nil
+}
+
+func (m UpgradeModel) Targets(id int64, states []string) ([]*UpgradeTarget, error) {
+	args := []any{id}
+	query := "select " + targetColumns + " from upgrade_targets t where t.campaign_id = $1"
+	if len(states) > 0 {
+		placeholders := make([]string, len(states))
+		for n, state := range states {
+			placeholders[n] = placeholder(&args, state)
+		}
+		query += " and t.state in (" + strings.Join(placeholders, ", ") + ")"
+	}
+	query += " order by t.wave, t.camera_id"
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	targets := []*UpgradeTarget{}
+	for rows.Next() {
+		t, err := scanTarget(rows)
+		if err != nil {
+			return nil, err
+		}
+		targets = append(targets, t)
+	}
+	return targets, rows.Err()
+}
+
+// settleCampaign halts or completes a running campaign if it should be, the way
+// UpgradeCampaign.settle decides.
+func settleCampaign(ctx context.Context, db DBTX, id int64, at time.Time) error {
+	query := `
+		update upgrade_campaigns c
+		set state = case when p.failed > c.max_failures then 'halted' else 'completed' end,
+			state_reason = case when p.failed > c.max_failures
+				then format('failed upgrades (%s) exceeded max_failures (%s)', p.failed, c.max_failures)
+				else '' end,
+			finished_at = case when p.failed > c.max_failures then null else $2::timestamptz end,
+			version = c.version + 1
+		from (
+			select count(*) filter (where state = 'failed') as failed,
+				count(*) filter (where state in ('pending', 'upgrading')) as unfinished
+			from upgrade_targets
+			where campaign_id = $1
+		) p
+		where c.id = $1 and c.state = 'running' and (p.failed > c.max_failures or p.unfinished = 0)
+	`
+	_, err := db.ExecContext(ctx, query, id, at)
+	return err
+}
+
+func (m UpgradeModel) Update(c *UpgradeCampaign) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	query := `
+		update upgrade_campaigns
+		set name = $1, site_concurrency = $2, max_failures = $3, state = $4, state_reason = $5, finished_at = $6,
+			version = version + 1
+		where id = $7 and version = $8
+		returning version
+	`
+	args := []any{c.Name, c.SiteConcurrency, c.MaxFailures, c.State, c.StateReason, c.FinishedAt, c.ID, c.Version}
+
+	err = tx.QueryRowContext(ctx, query, args...).Scan(&c.Version)
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrEditConflict
+	}
+	if err != nil {
+		return err
+	}
+
+	switch c.State {
+	case CampaignCancelled:
+		_, err = tx.ExecContext(ctx, `
+			update upgrade_targets set state = 'skipped', error = 'the campaign was cancelled'
+			where campaign_id = $1 and state = 'pending'
+		`, c.ID)
+	case CampaignRunning:
+		err = settleCampaign(ctx, tx, c.ID, time.Now())
+	}
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (m UpgradeModel) Claim(now time.Time, lease time.Duration, limit int) ([]*ClaimedTarget, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	// Locking the running campaigns makes a runner on another replica wait until
+	// these claims are committed, so it counts them against each site's concurrency.
+	_, err = tx.ExecContext(ctx, `select id from upgrade_campaigns where state = 'running' order by id for update`)
+	if err != nil {
+		return nil, err
+	}
+
+	// slot numbers each claimable target of a site, across campaigns, after the
+	// upgrades of any campaign still leased there, so only targets within the site's
+	// concurrency are claimed.
+	query := `
+		with leased as (
+			select lower(site_name) as site, count(*) as n
+			from upgrade_targets
+			where state = 'upgrading' and lease_until > $1
+			group by lower(site_name)
+		), waves as (
+			select t.campaign_id, min(t.wave) as wave
+			from upgrade_targets t
+			join upgrade_campaigns c on c.id = t.campaign_id
+			where c.state = 'running' and t.state in ('pending', 'upgrading')
+			group by t.campaign_id
+		), claimable as (
+			select t.campaign_id, t.camera_id, c.site_concurrency,
+				coalesce(l.n, 0) + row_number() over (partition by lower(t.site_name) order by t.campaign_id, t.camera_id) as slot
+			from upgrade_targets t
+			join waves w on w.campaign_id = t.campaign_id and w.wave = t.wave
+			join upgrade_campaigns c on c.id = t.campaign_id
+			left join leased l on l.site = lower(t.site_name)
+			where t.state = 'pending' or t.state = 'upgrading' and t.lease_until <= $1
+		), claimed as (
+			select campaign_id, camera_id
+			from claimable
+			where slot <= site_concurrency
+			order by campaign_id, camera_id
+			limit $3
+		)
+		update upgrade_targets t
+		set state = 'upgrading', attempts = t.attempts + 1, lease_until = $2, started_at = coalesce(t.started_at, $1)
+		from claimed, cameras cam, upgrade_campaigns c, firmware_images i
+		where t.campaign_id = claimed.campaign_id and t.camera_id = claimed.camera_id
+			and cam.id = t.camera_id and c.id = t.campaign_id and i.id = c.image_id
+		returning ` + targetColumns + `,
+			cam.id, cam.name, cam.mac_address, cam.site_name, cam.model_no, cam.address, cam.username, cam.password, cam.version,
+			i.id, i.created_at, i.uploaded_by, i.model_no, i.firmware, i.filename, i.size, i.sha256
+	`
+
+	rows, err := tx.QueryContext(ctx, query, now, now.Add(lease), limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	claimed := []*ClaimedTarget{}
+	for rows.Next() {
+		var (
+			ct  ClaimedTarget
+			cam = &ct.Camera
+			i   = &ct.Image
+		)
+		t, err := scanTarget(rows, &cam.ID, &cam.Name, &cam.MacAddress, &cam.SiteName, &cam.ModelNo, &cam.Address, &cam.Username, &cam.Password, &cam.Version,
+			&i.ID, &i.CreatedAt, &i.UploadedBy, &i.ModelNo, &i.Firmware, &i.Filename, &i.Size, &i.SHA256)
+		if err != nil {
+			return nil, err
+		}
+		ct.UpgradeTarget = *t
+		claimed = append(claimed, &ct)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	slices.SortFunc(claimed, func(a, b *ClaimedTarget) int {
+		if c := cmp.Compare(a.CampaignID, b.CampaignID); c != 0 {
+			return c
+		}
+		return cmp.Compare(a.CameraID, b.CameraID)
+	})
+	return claimed, tx.Commit()
+}
+
+func (m UpgradeModel) Finish(t *UpgradeTarget, at time.Time) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	// attempts changes whenever the target is claimed, so a runner whose lease ran
+	// out can't overwrite the outcome of the one which took over.
+	query := `
+		update upgrade_targets
+		set state = $4, previous_firmware = $5, firmware = $6, error = $7, finished_at = $8, lease_until = null
+		where campaign_id = $1 and camera_id = $2 and attempts = $3 and state = 'upgrading'
+		returning finished_at
+	`
+	args := []any{t.CampaignID, t.CameraID, t.Attempts, t.State, t.PreviousFirmware, t.Firmware, t.Error, at}
+
+	var finished time.Time
+	err = tx.QueryRowContext(ctx, query, args...).Scan(&finished)
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrEditConflict
+	}
+	if err != nil {
+		return err
+	}
+	t.FinishedAt = &finished
+
+	if err := settleCampaign(ctx, tx, t.CampaignID, at); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
@@ -0,0 +1,289 @@
+package data
+
+import (
+	"cmp"
+	"maps"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// MemoryUpgradeModel is an in-memory UpgradeRepository. It reads cameras from
+// cameras and images from images, and forgets the targets of deleted cameras, like
+// the foreign key cascade of UpgradeModel.
+type MemoryUpgradeModel struct {
+	mu        sync.Mutex
+	cameras   *MemoryCameraModel
+	images    *MemoryFirmwareImageModel
+	nextID    int64
+	campaigns map[int64]*memoryCampaign
+}
+
+// memoryCampaign is a stored campaign and its targets, in the order they're
+// upgraded.
+type memoryCampaign struct {
+	campaign UpgradeCampaign
+	targets  []memoryTarget
+}
+
+type memoryTarget struct {
+	UpgradeTarget
+	leaseUntil time.Time
+}
+
+func NewMemoryUpgradeModel(cameras *MemoryCameraModel, images *MemoryFirmwareImageModel) *MemoryUpgradeModel {
+	m := &MemoryUpgradeModel{cameras: cameras, images: images, nextID: 1, campaigns: make(map[int64]*memoryCampaign)}
+	images.upgrades = m
+	return m
+}
+
+// usesImage reports whether a campaign refers to the image.
+func (m *MemoryUpgradeModel) usesImage(id int64) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, mc := range m.campaigns {
+		if mc.campaign.Image.ID == id {
+			return true
+		}
+	}
+	return false
+}
+
+// prune forgets the targets of deleted cameras. It must be called with mu held.
+func (m *MemoryUpgradeModel) prune(mc *memoryCampaign) {
+	mc.targets = slices.DeleteFunc(mc.targets, func(t memoryTarget) bool {
+		_, err := m.cameras.Get(t.CameraID)
+		return err != nil
+	})
+}
+
+// upgradeTargets returns copies of the campaign's targets.
+func (mc *memoryCampaign) upgradeTargets() []UpgradeTarget {
+	targets := make([]UpgradeTarget, len(mc.targets))
+	for i, t := range mc.targets {
+		targets[i] = *storedTarget(t.UpgradeTarget)
+	}
+	return targets
+}
+
+// storedTarget copies t, truncating its times to the second like the timestamp(0)
+// columns.
+func storedTarget(t UpgradeTarget) *UpgradeTarget {
+	truncate := func(t *time.Time) *time.Time {
+		if t == nil {
+			return nil
+		}
+		truncated := t.Truncate(time.Second)
+		return &truncated
+	}
+	t.StartedAt = truncate(t.StartedAt)
+	t.FinishedAt = truncate(t.FinishedAt)
+	return &t
+}
+
+// get returns a copy of the campaign with its progress. It must be called with mu
+// held.
+func (m *MemoryUpgradeModel) get(mc *memoryCampaign) *UpgradeCampaign {
+	m.prune(mc)
+	c := mc.campaign
+	c.Selection = maps.Clone(c.Selection)
+	c.Progress = newUpgradeProgress(mc.upgradeTargets())
+	return &c
+}
+
+// settle halts or completes a running campaign if it should be. It must be called
+// with mu held.
+func (m *MemoryUpgradeModel) settle(mc *memoryCampaign, at time.Time) {
+	c := &mc.campaign
+	if c.State != CampaignRunning {
+		return
+	}
+	state, reason := c.settle(newUpgradeProgress(mc.upgradeTargets()))
+	if state != c.State {
+		c.SetState(state, reason, at)
+		c.Version++
+	}
+}
+
+func (m *MemoryUpgradeModel) Insert(c *UpgradeCampaign, cameras []*Camera) error {
+	image, err := m.images.Get(c.Image.ID)
+	if err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	c.ID = m.nextID
+	c.CreatedAt = time.Now().Truncate(time.Second)
+	c.Image = *image
+	c.State, c.StateReason, c.FinishedAt = CampaignRunning, "", nil
+	c.Version = 1
+	m.nextID++
+
+	mc := &memoryCampaign{campaign: *c}
+	mc.campaign.Selection = maps.Clone(c.Selection)
+	for _, t := range newUpgradeTargets(c.ID, cameras, c.WaveSize) {
+		mc.targets = append(mc.targets, memoryTarget{UpgradeTarget: t})
+	}
+	m.prune(mc)
+	m.campaigns[c.ID] = mc
+	c.Progress = newUpgradeProgress(mc.upgradeTargets())
+	return nil
+}
+
+func (m *MemoryUpgradeModel) Get(id int64) (*UpgradeCampaign, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	mc, ok := m.campaigns[id]
+	if !ok {
+		return nil, ErrRecordNotFound
+	}
+	return m.get(mc), nil
+}
+
+func (m *MemoryUpgradeModel) GetAll() ([]*UpgradeCampaign, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	campaigns := []*UpgradeCampaign{}
+	for _, mc := range m.campaigns {
+		campaigns = append(campaigns, m.get(mc))
+	}
+	slices.SortFunc(campaigns, func(a, b *UpgradeCampaign) int { return cmp.Compare(b.ID, a.ID) })
+	return campaigns, nil
+}
+
+func (m *MemoryUpgradeModel) Targets(id int64, states []string) ([]*UpgradeTarget, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	targets := []*UpgradeTarget{}
+	mc, ok := m.campaigns[id]
+	if !ok {
+		return targets, nil
+	}
+	m.prune(mc)
+	for _, t := range mc.targets {
+		if len(states) == 0 || slices.Contains(states, t.State) {
+			targets = append(targets, storedTarget(t.UpgradeTarget))
+		}
+	}
+	return targets, nil
+}
+
+func (m *MemoryUpgradeModel) Update(c *UpgradeCampaign) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	mc, ok := m.campaigns[c.ID]
+	if !ok || mc.campaign.Version != c.Version {
+		return ErrEditConflict
+	}
+	c.Version++
+
+	stored := &mc.campaign
+	stored.Name, stored.SiteConcurrency, stored.MaxFailures = c.Name, c.SiteConcurrency, c.MaxFailures
+	stored.State, stored.StateReason, stored.FinishedAt = c.State, c.StateReason, c.FinishedAt
+	stored.Version = c.Version
+
+	switch c.State {
+	case CampaignCancelled:
+		for i := range mc.targets {
+			if t := &mc.targets[i]; t.State == TargetPending {
+				t.State, t.Error = TargetSkipped, "the campaign was cancelled"
+			}
+		}
+	case CampaignRunning:
+		m.prune(mc)
+		m.settle(mc, time.Now())
+	}
+	return nil
+}
+
+func (m *MemoryUpgradeModel) Claim(now time.Time, lease time.Duration, limit int) ([]*ClaimedTarget, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	ids := make([]int64, 0, len(m.campaigns))
+	for id := range m.campaigns {
+		ids = append(ids, id)
+	}
+	slices.Sort(ids)
+
+	// A site's concurrency counts the upgrades of every campaign there, including
+	// those still finishing for a campaign which has since stopped.
+	leased := make(map[string]int)
+	for _, id := range ids {
+		mc := m.campaigns[id]
+		m.prune(mc)
+		for _, t := range mc.targets {
+			if t.State == TargetUpgrading && t.leaseUntil.After(now) {
+				leased[strings.ToLower(t.SiteName)]++
+			}
+		}
+	}
+
+	claimed := []*ClaimedTarget{}
+	for _, id := range ids {
+		mc := m.campaigns[id]
+		if mc.campaign.State != CampaignRunning {
+			continue
+		}
+
+		wave := newUpgradeProgress(mc.upgradeTargets()).Wave
+
+		for i := range mc.targets {
+			if len(claimed) == limit {
+				return claimed, nil
+			}
+			t := &mc.targets[i]
+			site := strings.ToLower(t.SiteName)
+			expired := t.State == TargetUpgrading && !t.leaseUntil.After(now)
+			if t.Wave != wave || t.State != TargetPending && !expired || leased[site] >= mc.campaign.SiteConcurrency {
+				continue
+			}
+			camera, err := m.cameras.Get(t.CameraID)
+			if err != nil {
+				continue
+			}
+
+			leased[site]++
+			t.State, t.leaseUntil = TargetUpgrading, now.Add(lease)
+			t.Attempts++
+			if t.StartedAt == nil {
+				started := now
+				t.StartedAt = &started
+			}
+			claimed = append(claimed, &ClaimedTarget{UpgradeTarget: *storedTarget(t.UpgradeTarget), Camera: *camera, Image: mc.campaign.Image})
+		}
+	}
+	return claimed, nil
+}
+
+func (m *MemoryUpgradeModel) Finish(target *UpgradeTarget, at time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	mc, ok := m.campaigns[target.CampaignID]
+	if !ok {
+		return ErrEditConflict
+	}
+	m.prune(mc)
+	i := slices.IndexFunc(mc.targets, func(t memoryTarget) bool { return t.CameraID == target.CameraID })
+	if i < 0 || mc.targets[i].Attempts != target.Attempts || mc.targets[i].State != TargetUpgrading {
+		return ErrEditConflict
+	}
+
+	t := &mc.targets[i]
+	t.State, t.PreviousFirmware, t.Firmware, t.Error = target.State, target.PreviousFirmware, target.Firmware, target.Error
+	finished := at.Truncate(time.Second)
+	t.FinishedAt, t.leaseUntil = &finished, time.Time{}
+	target.FinishedAt = &finished
+
+	m.settle(mc, at)
+	return nil
+}
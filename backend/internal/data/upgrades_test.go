@@ -0,0 +1,352 @@
+package data
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/chefgoldbloom/pnctool/backend/internal/validator"
+)
+
+// testUpgradeRepository runs campaigns through repo of cameras stored in cameras and
+// images stored in images, which must share its data.
+func testUpgradeRepository(t *testing.T, cameras CameraRepository, images FirmwareImageRepository, repo UpgradeRepository) {
+	var selected []*Camera
+	for _, c := range []*Camera{
+		{Name: "lobby", MacAddress: "ACCC8E000001", SiteName: "NYC-5th-GLH", ModelNo: "P3245-LV", Address: "10.0.0.1"},
+		{Name: "hall", MacAddress: "ACCC8E000002", SiteName: "NYC-5th-GLH", ModelNo: "P3245-LV", Address: "10.0.0.2"},
+		{Name: "gate", MacAddress: "ACCC8E000003", SiteName: "BOS-Main-GLH", ModelNo: "P3245-LV", Address: "10.0.1.1"},
+		{Name: "dock", MacAddress: "ACCC8E000004", SiteName: "nyc-5th-glh", ModelNo: "P3245-LV"},
+		{Name: "yard", MacAddress: "ACCC8E000005", SiteName: "BOS-Main-GLH", ModelNo: "P3245-LV", Address: "10.0.1.2"},
+	} {
+		if err := cameras.Insert(c); err != nil {
+			t.Fatal(err)
+		}
+		selected = append(selected, c)
+	}
+
+	image := &FirmwareImage{UploadedBy: "alice", ModelNo: "P3245-LV", Firmware: "11.1.66", Filename: "P3245-LV_11_1_66.bin", Size: 7, SHA256: "26401c69441d733f19a0fc094933d907d3b17300a3d10fb32e3a9b8c1997d5d2"}
+	if err := images.Insert(image); err != nil {
+		t.Fatal(err)
+	}
+	if err := images.Insert(&FirmwareImage{UploadedBy: "bob", ModelNo: "P3245-LV", Firmware: "11.1.66", SHA256: image.SHA256}); !errors.Is(err, ErrDuplicateFirmwareImage) {
+		t.Errorf("Insert of the same image again: err = %v; want ErrDuplicateFirmwareImage", err)
+	}
+	if got, err := images.Get(image.ID); err != nil || *got != *image {
+		t.Errorf("Get image = %+v, %v; want %+v", got, err, image)
+	}
+
+	// Three cameras to a wave, and one camera at a time at each site.
+	c := &UpgradeCampaign{CreatedBy: "alice", Name: "spring", Image: FirmwareImage{ID: image.ID}, Selection: ViewParams{"model_no": "P3245-LV"}, WaveSize: 3, SiteConcurrency: 1}
+	if err := repo.Insert(c, selected); err != nil {
+		t.Fatal(err)
+	}
+	want := UpgradeProgress{Total: 5, Pending: 4, Skipped: 1, Wave: 1, Waves: 2}
+	if c.State != CampaignRunning || c.Version != 1 || c.Progress != want {
+		t.Errorf("Insert: state %s, version %d, progress %+v; want running, 1, %+v", c.State, c.Version, c.Progress, want)
+	}
+	if err := images.Delete(image.ID); !errors.Is(err, ErrFirmwareImageInUse) {
+		t.Errorf("Delete of an image in use: err = %v; want ErrFirmwareImageInUse", err)
+	}
+
+	got, err := repo.Get(c.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Image.SHA256 != image.SHA256 || got.Selection["model_no"] != "P3245-LV" || got.Progress != want || got.FinishedAt != nil {
+		t.Errorf("Get = %+v", got)
+	}
+	if _, err := repo.Get(99); !errors.Is(err, ErrRecordNotFound) {
+		t.Errorf("Get of a missing campaign: err = %v; want ErrRecordNotFound", err)
+	}
+	if targets, err := repo.Targets(c.ID, []string{TargetSkipped}); err != nil || len(targets) != 1 || targets[0].CameraID != 4 || targets[0].Error == "" {
+		t.Errorf("Targets(skipped) = %v, %v; want the camera without an address", targets, err)
+	}
+
+	at := time.Date(2026, 3, 2, 9, 0, 0, 0, time.UTC)
+	claim := func(now time.Time, limit int) string {
+		t.Helper()
+		claimed, err := repo.Claim(now, 10*time.Minute, limit)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var ids []int64
+		for _, ct := range claimed {
+			ids = append(ids, ct.CameraID)
+			if ct.Camera.ID != ct.CameraID || ct.Camera.Address == "" || ct.Camera.Username != "root" || ct.Image.ID != image.ID || ct.State != TargetUpgrading {
+				t.Errorf("claimed %+v", ct)
+			}
+		}
+		return fmt.Sprint(ids)
+	}
+	finish := func(cameraID int64, attempts int, state string) error {
+		t.Helper()
+		target := &UpgradeTarget{CampaignID: c.ID, CameraID: cameraID, Attempts: attempts, State: state, PreviousFirmware: "10.12.114", Firmware: "11.1.66"}
+		if state == TargetFailed {
+			target.Firmware, target.Error = "10.12.114", "the camera didn't come back on 11.1.66"
+		}
+		return repo.Finish(target, at)
+	}
+
+	if ids := claim(at, 1); ids != "[1]" {
+		t.Errorf("Claim with a limit of 1 = %s; want [1]", ids)
+	}
+	// hall waits for lobby at the same site, in any case.
+	if ids := claim(at, 10); ids != "[3]" {
+		t.Errorf("Claim = %s; want [3]", ids)
+	}
+	if ids := claim(at, 10); ids != "[]" {
+		t.Errorf("Claim with every site busy = %s; want []", ids)
+	}
+
+	if err := finish(1, 1, TargetSucceeded); err != nil {
+		t.Fatal(err)
+	}
+	if err := finish(1, 1, TargetSucceeded); !errors.Is(err, ErrEditConflict) {
+		t.Errorf("Finish of a finished target: err = %v; want ErrEditConflict", err)
+	}
+	if ids := claim(at, 10); ids != "[2]" {
+		t.Errorf("Claim after lobby finished = %s; want [2]", ids)
+	}
+
+	// Leases which run out are claimed again, and the runner which lost gate can't
+	// finish it any more.
+	if ids := claim(at.Add(11*time.Minute), 10); ids != "[2 3]" {
+		t.Errorf("Claim after the leases ran out = %s; want [2 3]", ids)
+	}
+	if err := finish(3, 1, TargetSucceeded); !errors.Is(err, ErrEditConflict) {
+		t.Errorf("Finish of a target claimed again: err = %v; want ErrEditConflict", err)
+	}
+	if err := finish(3, 2, TargetSucceeded); err != nil {
+		t.Fatal(err)
+	}
+
+	// One failure is more than the campaign allows.
+	if err := finish(2, 2, TargetFailed); err != nil {
+		t.Fatal(err)
+	}
+	got, err = repo.Get(c.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want = UpgradeProgress{Total: 5, Pending: 1, Succeeded: 2, Failed: 1, Skipped: 1, Wave: 2, Waves: 2}
+	if got.State != CampaignHalted || got.StateReason != "failed upgrades (1) exceeded max_failures (0)" || got.Progress != want {
+		t.Errorf("after a failure: state %s (%s), progress %+v; want halted, %+v", got.State, got.StateReason, got.Progress, want)
+	}
+	if ids := claim(at.Add(12*time.Minute), 10); ids != "[]" {
+		t.Errorf("Claim of a halted campaign = %s; want []", ids)
+	}
+	if targets, _ := repo.Targets(c.ID, []string{TargetFailed}); len(targets) != 1 || targets[0].CameraID != 2 || targets[0].Attempts != 2 ||
+		targets[0].Firmware != "10.12.114" || targets[0].StartedAt == nil || targets[0].FinishedAt == nil {
+		t.Errorf("Targets(failed) = %+v", targets)
+	}
+
+	// Allowing a failure and resuming carries on with the next wave, unless paused.
+	got.MaxFailures = 1
+	got.SetState(CampaignPaused, "paused by alice", at)
+	if err := repo.Update(got); err != nil {
+		t.Fatal(err)
+	}
+	stale := *got
+	stale.Version--
+	if err := repo.Update(&stale); !errors.Is(err, ErrEditConflict) {
+		t.Errorf("Update of a stale version: err = %v; want ErrEditConflict", err)
+	}
+	if ids := claim(at.Add(12*time.Minute), 10); ids != "[]" {
+		t.Errorf("Claim of a paused campaign = %s; want []", ids)
+	}
+	got.SetState(CampaignRunning, "resumed by alice", at)
+	if err := repo.Update(got); err != nil {
+		t.Fatal(err)
+	}
+	if ids := claim(at.Add(12*time.Minute), 10); ids != "[5]" {
+		t.Errorf("Claim of the second wave = %s; want [5]", ids)
+	}
+	if err := finish(5, 1, TargetSucceeded); err != nil {
+		t.Fatal(err)
+	}
+	got, _ = repo.Get(c.ID)
+	if got.State != CampaignCompleted || got.FinishedAt == nil || got.Progress.Wave != 0 || got.Progress.Succeeded != 3 {
+		t.Errorf("after the last camera: %+v; want completed", got)
+	}
+
+	targets, err := repo.Targets(c.ID, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var order []int64
+	for _, target := range targets {
+		order = append(order, target.CameraID)
+	}
+	if fmt.Sprint(order) != "[1 2 3 4 5]" || targets[0].Name != "lobby" || targets[0].Wave != 1 || targets[4].Wave != 2 {
+		t.Errorf("Targets = %+v", targets)
+	}
+
+	// Cancelling skips the cameras which haven't started.
+	cancelled := &UpgradeCampaign{CreatedBy: "bob", Name: "autumn", Image: FirmwareImage{ID: image.ID}, Selection: ViewParams{}, WaveSize: 10, SiteConcurrency: 1}
+	if err := repo.Insert(cancelled, selected[:3]); err != nil {
+		t.Fatal(err)
+	}
+	if ids := claim(at, 10); ids != "[1 3]" {
+		t.Errorf("Claim of the second campaign = %s; want [1 3]", ids)
+	}
+	cancelled.SetState(CampaignCancelled, "cancelled by bob", at)
+	if err := repo.Update(cancelled); err != nil {
+		t.Fatal(err)
+	}
+	got, _ = repo.Get(cancelled.ID)
+	want = UpgradeProgress{Total: 3, Upgrading: 2, Skipped: 1, Wave: 1, Waves: 1}
+	if got.State != CampaignCancelled || got.FinishedAt == nil || got.Progress != want {
+		t.Errorf("after cancelling: state %s, progress %+v; want cancelled, %+v", got.State, got.Progress, want)
+	}
+	if campaigns, err := repo.GetAll(); err != nil || len(campaigns) != 2 || campaigns[0].ID != cancelled.ID {
+		t.Errorf("GetAll = %v, %v; want both campaigns, newest first", campaigns, err)
+	}
+
+	// A deleted camera's targets go with it.
+	if err := cameras.Delete(1); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := repo.Get(c.ID); got.Progress.Total != 4 {
+		t.Errorf("progress after deleting a camera = %+v; want 4 targets", got.Progress)
+	}
+}
+
+// testUpgradeSiteConcurrency checks that a site's concurrency limits the upgrades of
+// every campaign running there together, not each campaign on its own.
+func testUpgradeSiteConcurrency(t *testing.T, cameras CameraRepository, images FirmwareImageRepository, repo UpgradeRepository) {
+	var site []*Camera
+	for i := 1; i <= 4; i++ {
+		c := &Camera{Name: fmt.Sprintf("cam-%d", i), MacAddress: fmt.Sprintf("ACCC8E00000%d", i), SiteName: "NYC-5th-GLH", ModelNo: "P3245-LV", Address: fmt.Sprintf("10.0.0.%d", i)}
+		if err := cameras.Insert(c); err != nil {
+			t.Fatal(err)
+		}
+		site = append(site, c)
+	}
+	image := &FirmwareImage{UploadedBy: "alice", ModelNo: "P3245-LV", Firmware: "11.1.66", Filename: "P3245-LV_11_1_66.bin", Size: 7, SHA256: "26401c69441d733f19a0fc094933d907d3b17300a3d10fb32e3a9b8c1997d5d2"}
+	if err := images.Insert(image); err != nil {
+		t.Fatal(err)
+	}
+
+	// Two campaigns of two cameras each at the same site, two at a time.
+	var campaigns []*UpgradeCampaign
+	for _, cameras := range [][]*Camera{site[:2], site[2:]} {
+		c := &UpgradeCampaign{CreatedBy: "alice", Name: "spring", Image: FirmwareImage{ID: image.ID}, Selection: ViewParams{"site_name": "NYC-5th-GLH"}, WaveSize: 10, SiteConcurrency: 2}
+		if err := repo.Insert(c, cameras); err != nil {
+			t.Fatal(err)
+		}
+		campaigns = append(campaigns, c)
+	}
+
+	at := time.Date(2026, 3, 2, 9, 0, 0, 0, time.UTC)
+	claim := func() string {
+		t.Helper()
+		claimed, err := repo.Claim(at, 10*time.Minute, 10)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var ids []int64
+		for _, ct := range claimed {
+			ids = append(ids, ct.CameraID)
+		}
+		return fmt.Sprint(ids)
+	}
+
+	if ids := claim(); ids != "[1 2]" {
+		t.Errorf("Claim = %s; want [1 2], leaving the second campaign to wait", ids)
+	}
+	if ids := claim(); ids != "[]" {
+		t.Errorf("Claim with the site busy = %s; want []", ids)
+	}
+
+	target := &UpgradeTarget{CampaignID: campaigns[0].ID, CameraID: 1, Attempts: 1, State: TargetSucceeded, PreviousFirmware: "10.12.114", Firmware: "11.1.66"}
+	if err := repo.Finish(target, at); err != nil {
+		t.Fatal(err)
+	}
+	if ids := claim(); ids != "[3]" {
+		t.Errorf("Claim after one upgrade finished = %s; want [3]", ids)
+	}
+
+	// Upgrades still finishing for a campaign which was paused keep their slots.
+	campaigns[0].SetState(CampaignPaused, "paused by alice", at)
+	if err := repo.Update(campaigns[0]); err != nil {
+		t.Fatal(err)
+	}
+	if ids := claim(); ids != "[]" {
+		t.Errorf("Claim with a paused campaign still upgrading = %s; want []", ids)
+	}
+}
+
+func TestUpgradeModel(t *testing.T) {
+	db := newTestDB(t)
+	testUpgradeRepository(t, CameraModel{DB: db}, FirmwareImageModel{DB: db}, UpgradeModel{DB: db})
+}
+
+func TestUpgradeModelSiteConcurrency(t *testing.T) {
+	db := newTestDB(t)
+	testUpgradeSiteConcurrency(t, CameraModel{DB: db}, FirmwareImageModel{DB: db}, UpgradeModel{DB: db})
+}
+
+func TestMemoryUpgradeModel(t *testing.T) {
+	cameras := NewMemoryCameraModel()
+	images := NewMemoryFirmwareImageModel()
+	testUpgradeRepository(t, cameras, images, NewMemoryUpgradeModel(cameras, images))
+}
+
+func TestMemoryUpgradeModelSiteConcurrency(t *testing.T) {
+	cameras := NewMemoryCameraModel()
+	images := NewMemoryFirmwareImageModel()
+	testUpgradeSiteConcurrency(t, cameras, images, NewMemoryUpgradeModel(cameras, images))
+}
+
+func TestValidateUpgradeCampaign(t *testing.T) {
+	tests := []struct {
+		name     string
+		campaign UpgradeCampaign
+		fields   string
+	}{
+		{"valid", UpgradeCampaign{Name: "spring", Selection: ViewParams{"site_name": "NYC-5th-GLH"}, WaveSize: 10, SiteConcurrency: 2}, "[]"},
+		{"missing", UpgradeCampaign{MaxFailures: -1}, "[max_failures name site_concurrency wave_size]"},
+		{"unknown selection", UpgradeCampaign{Name: "spring", Selection: ViewParams{"sort": "name"}, WaveSize: 10, SiteConcurrency: 2}, "[selection]"},
+	}
+
+	for _, tt := range tests {
+		v := validator.New()
+		ValidateUpgradeCampaign(v, &tt.campaign)
+		var fields []string
+		for field := range v.Errors {
+			fields = append(fields, field)
+		}
+		slices.Sort(fields)
+		if got := fmt.Sprint(fields); got != tt.fields {
+			t.Errorf("%s: errors on %s; want %s", tt.name, got, tt.fields)
+		}
+	}
+}
+
+func TestValidateUpgradeCampaignState(t *testing.T) {
+	tests := []struct {
+		from, to string
+		valid    bool
+	}{
+		{CampaignRunning, CampaignPaused, true},
+		{CampaignPaused, CampaignRunning, true},
+		{CampaignHalted, CampaignRunning, true},
+		{CampaignRunning, CampaignCancelled, true},
+		{CampaignRunning, CampaignRunning, true},
+		{CampaignRunning, CampaignHalted, false},
+		{CampaignCompleted, CampaignRunning, false},
+		{CampaignCancelled, CampaignRunning, false},
+		{CampaignRunning, "stopped", false},
+	}
+
+	for _, tt := range tests {
+		v := validator.New()
+		ValidateUpgradeCampaignState(v, tt.from, tt.to)
+		if v.Valid() != tt.valid {
+			t.Errorf("%s to %s: errors = %v; want valid %t", tt.from, tt.to, v.Errors, tt.valid)
+		}
+	}
+}
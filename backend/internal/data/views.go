@@ -0,0 +1,263 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/chefgoldbloom/pnctool/backend/internal/validator"
+)
+
+// ErrDuplicateViewName is returned when an owner already has a view with the name.
+var ErrDuplicateViewName = errors.New("duplicate view name")
+
+// View visibilities. Private views are only visible to their owner, team views to
+// everybody in the owner's team.
+const (
+	ViewPrivate = "private"
+	ViewTeam    = "team"
+)
+
+// ViewSyntaxVersion is the version of the camera listing parameters new views are
+// saved with. Bump it, and add an entry to viewUpgrades, whenever a change to the
+// parameters or the q= language would change what an existing view returns.
+const ViewSyntaxVersion = 1
+
+// viewUpgrades rewrites parameters saved with syntax version n so they mean the same
+// thing under version n+1. Views are upgraded when they're read, so old views keep
+// working without a data migration.
+var viewUpgrades = map[int]func(ViewParams) (ViewParams, error){}
+
+// ViewParamSafelist is every camera listing parameter a view can save. Pagination
+// other than page_size is left to the caller.
+var ViewParamSafelist = []string{"name", "mac_address", "model_no", "site_name", "status", "q", "search", "sort", "fields", "include", "page_size"}
+
+// ViewParams are the query string parameters of a saved camera listing.
+type ViewParams map[string]string
+
+// Values returns the parameters as a query string.
+func (p ViewParams) Values() url.Values {
+	qs := url.Values{}
+	for k, v := range p {
+		qs.Set(k, v)
+	}
+	return qs
+}
+
+// View is a saved camera listing: filters, sort and field selection which can be
+// rerun by name.
+type View struct {
+	ID         int64      `json:"id"`
+	CreatedAt  time.Time  `json:"created_at"`
+	Owner      string     `json:"owner"`
+	Team       string     `json:"team,omitempty"`
+	Name       string     `json:"name"`
+	Visibility string     `json:"visibility"`
+	Params     ViewParams `json:"params"`
+	Syntax     int        `json:"syntax"`
+	Pinned     bool       `json:"pinned"`
+	Version    int32      `json:"version"`
+}
+
+// VisibleTo reports whether user, a member of team, can see the view.
+func (view *View) VisibleTo(user, team string) bool {
+	return view.Owner == user || view.Visibility == ViewTeam && team != "" && view.Team == team
+}
+
+// Upgrade rewrites the view's parameters to the current syntax version.
+func (view *View) Upgrade() error {
+	if view.Syntax > ViewSyntaxVersion {
+		return fmt.Errorf("view %d has syntax version %d, newer than %d", view.ID, view.Syntax, ViewSyntaxVersion)
+	}
+	for ; view.Syntax < ViewSyntaxVersion; view.Syntax++ {
+		upgrade, ok := viewUpgrades[view.Syntax]
+		if !ok {
+			continue
+		}
+		params, err := upgrade(view.Params)
+		if err != nil {
+			return fmt.Errorf("upgrading view %d from syntax version %d: %w", view.ID, view.Syntax, err)
+		}
+		view.Params = params
+	}
+	return nil
+}
+
+// ValidateView checks the fields of a view. The parameters themselves are checked by
+// running them through the camera listing.
+func ValidateView(v *validator.Validator, view *View) {
+	v.CheckCode(view.Name != "", "name", validator.CodeRequired, "must be provided")
+	v.CheckCode(len(view.Name) <= 100, "name", validator.CodeTooLong, "must not be more than 100 bytes long")
+	v.CheckCode(validator.PermittedValue(view.Visibility, ViewPrivate, ViewTeam), "visibility", validator.CodeNotPermitted, "must be private or team")
+	v.CheckCode(view.Visibility != ViewTeam || view.Team != "", "visibility", validator.CodeNotPermitted, "team views need the owner to belong to a team")
+	for key, value := range view.Params {
+		v.CheckCode(slices.Contains(ViewParamSafelist, key), "params", validator.CodeNotPermitted, "must only contain: "+strings.Join(ViewParamSafelist, ", "))
+		v.CheckCode(len(value) <= 1024, "params."+key, validator.CodeTooLong, "must not be more than 1024 bytes long")
+	}
+}
+
+// ViewRepository stores saved views. Saving a pinned view unpins the owner's other
+// views, so each user has at most one default.
+type ViewRepository interface {
+	Insert(view *View) error
+	Get(id int64) (*View, error)
+	GetAllFor(user, team string) ([]*View, error)
+	Update(view *View) error
+	Delete(id int64) error
+}
+
+type ViewModel struct {
+	DB DBTX
+}
+
+// Insert creates a view in database
+func (m ViewModel) Insert(view *View) error {
+	params, err := json.Marshal(view.Params)
+	if err != nil {
+		return err
+	}
+
+	query := `
+		with unpinned as (
+			update saved_views set pinned = false
+			where $7 and owner = $1 and pinned
+		)
+		insert into saved_views (owner, team, name, visibility, params, syntax, pinned)
+		values ($1, $2, $3, $4, $5, $6, $7)
+		returning id, created_at, version
+	`
+	args := []any{view.Owner, view.Team, view.Name, view.Visibility, params, view.Syntax, view.Pinned}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err = m.DB.QueryRowContext(ctx, query, args...).Scan(&view.ID, &view.CreatedAt, &view.Version)
+	if err != nil && strings.Contains(err.Error(), "saved_views_owner_name_key") {
+		return ErrDuplicateViewName
+	}
+	return err
+}
+
+const viewColumns = "id, created_at, owner, team, name, visibility, params, syntax, pinned, version"
+
+func scanView(row interface{ Scan(...any) error }) (*View, error) {
+	var (
+		view   View
+		params []byte
+	)
+	err := row.Scan(&view.ID, &view.CreatedAt, &view.Owner, &view.Team, &view.Name, &view.Visibility, &params, &view.Syntax, &view.Pinned, &view.Version)
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(params, &view.Params); err != nil {
+		return nil, err
+	}
+	return &view, nil
+}
+
+// Get retrieves a view from database
+func (m ViewModel) Get(id int64) (*View, error) {
+	if id < 1 {
+		return nil, ErrRecordNotFound
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	view, err := scanView(m.DB.QueryRowContext(ctx, "select "+viewColumns+" from saved_views where id = $1", id))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrRecordNotFound
+	}
+	return view, err
+}
+
+// GetAllFor retrieves every view user can see: their own and their team's shared
+// views. The user's pinned view comes first, then the rest by name.
+func (m ViewModel) GetAllFor(user, team string) ([]*View, error) {
+	query := `
+		select ` + viewColumns + `
+		from saved_views
+		where owner = $1 or (visibility = 'team' and team = $2 and $2 <> '')
+		order by (owner = $1 and pinned) desc, name, id
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, user, team)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	views := []*View{}
+	for rows.Next() {
+		view, err := scanView(rows)
+		if err != nil {
+			return nil, err
+		}
+		views = append(views, view)
+	}
+	return views, rows.Err()
+}
+
+// Update updates a view in database if its version still matches
+func (m ViewModel) Update(view *View) error {
+	params, err := json.Marshal(view.Params)
+	if err != nil {
+		return err
+	}
+
+	query := `
+		with unpinned as (
+			update saved_views set pinned = false
+			where $6 and owner = $7 and id <> $8 and pinned
+		)
+		update saved_views
+		set name = $1, visibility = $2, team = $3, params = $4, syntax = $5, pinned = $6, version = version + 1
+		where id = $8 and version = $9
+		returning version
+	`
+	args := []any{view.Name, view.Visibility, view.Team, params, view.Syntax, view.Pinned, view.Owner, view.ID, view.Version}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err = m.DB.QueryRowContext(ctx, query, args...).Scan(&view.Version)
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		return ErrEditConflict
+	case err != nil && strings.Contains(err.Error(), "saved_views_owner_name_key"):
+		return ErrDuplicateViewName
+	}
+	return err
+}
+
+// Delete removes a view from database
+func (m ViewModel) Delete(id int64) error {
+	if id < 1 {
+		return ErrRecordNotFound
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	res, err := m.DB.ExecContext(ctx, "delete from saved_views where id = $1", id)
+	if err != nil {
+		return err
+	}
+	rows, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return ErrRecordNotFound
+	}
+	return nil
+}
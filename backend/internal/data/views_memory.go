@@ -0,0 +1,137 @@
+package data
+
+import (
+	"cmp"
+	"maps"
+	"slices"
+	"sync"
+	"time"
+)
+
+// MemoryViewModel is an in-memory ViewRepository with the same semantics as
+// ViewModel.
+type MemoryViewModel struct {
+	mu     sync.Mutex
+	nextID int64
+	views  map[int64]View
+}
+
+func NewMemoryViewModel() *MemoryViewModel {
+	return &MemoryViewModel{nextID: 1, views: make(map[int64]View)}
+}
+
+// stored copies view so that callers can't change the store through a pointer.
+func storedView(view View) *View {
+	view.Params = maps.Clone(view.Params)
+	return &view
+}
+
+func (m *MemoryViewModel) nameTaken(view *View) bool {
+	for _, other := range m.views {
+		if other.ID != view.ID && other.Owner == view.Owner && other.Name == view.Name {
+			return true
+		}
+	}
+	return false
+}
+
+// unpinOthers unpins the owner's views other than view.
+func (m *MemoryViewModel) unpinOthers(view *View) {
+	for id, other := range m.views {
+		if id != view.ID && other.Owner == view.Owner && other.Pinned {
+			other.Pinned = false
+			m.views[id] = other
+		}
+	}
+}
+
+func (m *MemoryViewModel) Insert(view *View) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.nameTaken(view) {
+		return ErrDuplicateViewName
+	}
+
+	view.ID = m.nextID
+	view.CreatedAt = time.Now().Truncate(time.Second)
+	view.Version = 1
+	m.nextID++
+
+	if view.Pinned {
+		m.unpinOthers(view)
+	}
+	m.views[view.ID] = *storedView(*view)
+	return nil
+}
+
+func (m *MemoryViewModel) Get(id int64) (*View, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	view, ok := m.views[id]
+	if !ok {
+		return nil, ErrRecordNotFound
+	}
+	return storedView(view), nil
+}
+
+func (m *MemoryViewModel) GetAllFor(user, team string) ([]*View, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	views := []*View{}
+	for _, view := range m.views {
+		if view.VisibleTo(user, team) {
+			views = append(views, storedView(view))
+		}
+	}
+
+	pinnedFirst := func(v *View) int {
+		if v.Owner == user && v.Pinned {
+			return 0
+		}
+		return 1
+	}
+	slices.SortFunc(views, func(a, b *View) int {
+		if c := cmp.Compare(pinnedFirst(a), pinnedFirst(b)); c != 0 {
+			return c
+		}
+		if c := cmp.Compare(a.Name, b.Name); c != 0 {
+			return c
+		}
+		return cmp.Compare(a.ID, b.ID)
+	})
+	return views, nil
+}
+
+func (m *MemoryViewModel) Update(view *View) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	stored, ok := m.views[view.ID]
+	if !ok || stored.Version != view.Version {
+		return ErrEditConflict
+	}
+	if m.nameTaken(view) {
+		return ErrDuplicateViewName
+	}
+
+	view.Version++
+	if view.Pinned {
+		m.unpinOthers(view)
+	}
+	m.views[view.ID] = *storedView(*view)
+	return nil
+}
+
+func (m *MemoryViewModel) Delete(id int64) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.views[id]; !ok {
+		return ErrRecordNotFound
+	}
+	delete(m.views, id)
+	return nil
+}
@@ -0,0 +1,86 @@
+package data
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestViewUpgrade(t *testing.T) {
+	// Pretend syntax version 0 called the q= parameter "filter".
+	viewUpgrades[0] = func(p ViewParams) (ViewParams, error) {
+		p["q"] = p["filter"]
+		delete(p, "filter")
+		return p, nil
+	}
+	defer delete(viewUpgrades, 0)
+
+	view := &View{ID: 1, Syntax: 0, Params: ViewParams{"filter": "name:a"}}
+	if err := view.Upgrade(); err != nil {
+		t.Fatal(err)
+	}
+	if view.Syntax != ViewSyntaxVersion || view.Params["q"] != "name:a" || len(view.Params) != 1 {
+		t.Errorf("upgraded view = %+v", view)
+	}
+
+	future := &View{ID: 2, Syntax: ViewSyntaxVersion + 1}
+	if err := future.Upgrade(); err == nil {
+		t.Errorf("upgrading a view from a newer syntax succeeded")
+	}
+}
+
+func TestViewModel(t *testing.T) {
+	m := ViewModel{DB: newTestDB(t)}
+
+	glh := &View{Owner: "ana", Team: "east", Name: "GLH", Visibility: ViewTeam, Params: ViewParams{"q": "site_name:*-GLH"}, Syntax: 1, Pinned: true}
+	mine := &View{Owner: "ana", Name: "Mine", Visibility: ViewPrivate, Params: ViewParams{}, Syntax: 1}
+	for _, v := range []*View{glh, mine} {
+		if err := m.Insert(v); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := m.Insert(&View{Owner: "ana", Name: "GLH", Visibility: ViewPrivate, Syntax: 1}); !errors.Is(err, ErrDuplicateViewName) {
+		t.Errorf("duplicate insert: err = %v; want ErrDuplicateViewName", err)
+	}
+
+	got, err := m.Get(glh.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Params["q"] != "site_name:*-GLH" || !got.Pinned || got.Version != 1 {
+		t.Errorf("Get = %+v", got)
+	}
+
+	views, err := m.GetAllFor("ben", "east")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(views) != 1 || views[0].ID != glh.ID {
+		t.Errorf("ben's views = %+v", views)
+	}
+
+	// Pinning Mine unpins GLH in the same statement.
+	mine.Pinned = true
+	if err := m.Update(mine); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := m.Get(glh.ID); got.Pinned {
+		t.Errorf("GLH still pinned after pinning Mine")
+	}
+	views, _ = m.GetAllFor("ana", "east")
+	if len(views) != 2 || views[0].ID != mine.ID {
+		t.Errorf("ana's views = %+v; want Mine first", views)
+	}
+
+	stale := *mine
+	stale.Version = 1
+	if err := m.Update(&stale); !errors.Is(err, ErrEditConflict) {
+		t.Errorf("stale update: err = %v; want ErrEditConflict", err)
+	}
+
+	if err := m.Delete(mine.ID); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.Delete(mine.ID); !errors.Is(err, ErrRecordNotFound) {
+		t.Errorf("delete twice: err = %v; want ErrRecordNotFound", err)
+	}
+}
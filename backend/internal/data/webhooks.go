@@ -0,0 +1,474 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/chefgoldbloom/pnctool/backend/internal/validator"
+)
+
+// Delivery states. A delivery is pending until the receiver accepts it or it runs
+// out of attempts, when it's dead. Dead deliveries stay until they're redelivered.
+const (
+	DeliveryPending   = "pending"
+	DeliveryDelivered = "delivered"
+	DeliveryDead      = "dead"
+)
+
+var DeliveryStateSafelist = []string{DeliveryPending, DeliveryDelivered, DeliveryDead}
+
+// Webhook is a subscription to events, which are POSTed to URL signed with Secret.
+// An empty EventTypes subscribes to every type. Inactive webhooks aren't sent new
+// events.
+type Webhook struct {
+	ID          int64     `json:"id"`
+	CreatedAt   time.Time `json:"created_at"`
+	URL         string    `json:"url"`
+	Secret      string    `json:"secret,omitempty"`
+	EventTypes  []string  `json:"event_types"`
+	Description string    `json:"description"`
+	Active      bool      `json:"active"`
+	Version     int32     `json:"version"`
+}
+
+// Subscribed reports whether the webhook wants events of the type.
+func (w *Webhook) Subscribed(eventType string) bool {
+	return w.Active && (len(w.EventTypes) == 0 || slices.Contains(w.EventTypes, eventType))
+}
+
+// WebhookDelivery is one event on its way to one webhook.
+type WebhookDelivery struct {
+	ID             int64      `json:"id"`
+	WebhookID      int64      `json:"webhook_id"`
+	EventID        int64      `json:"event_id"`
+	EventType      string     `json:"event_type"`
+	State          string     `json:"state"`
+	Attempts       int        `json:"attempts"`
+	NextAttemptAt  *time.Time `json:"next_attempt_at"`
+	LastAttemptAt  *time.Time `json:"last_attempt_at"`
+	LastStatusCode *int       `json:"last_status_code"`
+	LastError      string     `json:"last_error"`
+	CreatedAt      time.Time  `json:"created_at"`
+	DeliveredAt    *time.Time `json:"delivered_at"`
+}
+
+// PendingDelivery is a delivery claimed by a dispatcher, with the webhook it goes to
+// and the event it carries.
+type PendingDelivery struct {
+	WebhookDelivery
+	URL    string
+	Secret string
+	Event  Event
+}
+
+func ValidateWebhook(v *validator.Validator, w *Webhook) {
+	v.CheckCode(w.URL != "", "url", validator.CodeRequired, "must be provided")
+	v.CheckCode(len(w.URL) <= 2000, "url", validator.CodeTooLong, "must not be more than 2000 bytes long")
+	if w.URL != "" {
+		u, err := url.Parse(w.URL)
+		v.CheckCode(err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != "", "url", validator.CodeBadFormat, "must be an absolute http or https URL")
+	}
+	v.CheckCode(len(w.Secret) >= 16, "secret", validator.CodeBadLength, "must be at least 16 bytes long")
+	v.CheckCode(len(w.Secret) <= 200, "secret", validator.CodeTooLong, "must not be more than 200 bytes long")
+	for _, eventType := range w.EventTypes {
+		v.CheckCode(validator.PermittedValue(eventType, EventTypeSafelist...), "event_types", validator.CodeNotPermitted, "must only contain: "+strings.Join(EventTypeSafelist, ", "))
+	}
+	v.CheckCode(len(w.Description) <= 500, "description", validator.CodeTooLong, "must not be more than 500 bytes long")
+}
+
+// DeliveryFilter restricts GetAllDeliveries to deliveries matching every non-empty
+// field.
+type DeliveryFilter struct {
+	WebhookID int64
+	State     string
+}
+
+// WebhookRepository stores webhooks and the queue of deliveries to them. WebhookModel
+// implements it on top of Postgres and MemoryWebhookModel implements it in memory
+// for tests.
+type WebhookRepository interface {
+	Insert(webhook *Webhook) error
+	Get(id int64) (*Webhook, error)
+	GetAll() ([]*Webhook, error)
+	Update(webhook *Webhook) error
+	Delete(id int64) error
+
+	// Enqueue queues a delivery of the event, due when it occurred, to every webhook
+	// subscribed to its type, and returns how many were queued.
+	Enqueue(event *Event) (int, error)
+
+	// EnqueueTo queues a delivery of the event to one webhook, whatever it's
+	// subscribed to. It returns ErrRecordNotFound if there's no such webhook.
+	EnqueueTo(id int64, event *Event) (*WebhookDelivery, error)
+
+	// Claim returns up to limit pending deliveries which are due at now, oldest
+	// first, and puts their next attempt back by lease so nothing else claims them
+	// while they're being made.
+	Claim(now time.Time, lease time.Duration, limit int) ([]*PendingDelivery, error)
+
+	// SaveAttempt saves the outcome of an attempt at a delivery: its state,
+	// attempts, next and last attempt, status code, error and delivery time.
+	SaveAttempt(delivery *WebhookDelivery) error
+
+	GetDelivery(id int64) (*WebhookDelivery, error)
+	GetAllDeliveries(filter DeliveryFilter, filters Filters) ([]*WebhookDelivery, Metadata, error)
+
+	// Redeliver puts a delivery back in the queue, due at now, with its attempts
+	// reset.
+	Redeliver(id int64, now time.Time) (*WebhookDelivery, error)
+}
+
+type WebhookModel struct {
+	DB DBTX
+}
+
+func (m WebhookModel) Insert(w *Webhook) error {
+	eventTypes, err := json.Marshal(w.EventTypes)
+	if err != nil {
+		return err
+	}
+
+	query := `
+		insert into webhook_subscriptions (url, secret, event_types, description, active)
+		values ($1, $2, $3, $4, $5)
+		returning id, created_at, version
+	`
+	args := []any{w.URL, w.Secret, eventTypes, w.Description, w.Active}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	return m.DB.QueryRowContext(ctx, query, args...).Scan(&w.ID, &w.CreatedAt, &w.Version)
+}
+
+const webhookColumns = "id, created_at, url, secret, event_types, description, active, version"
+
+func scanWebhook(row interface{ Scan(...any) error }) (*Webhook, error) {
+	var (
+		w          Webhook
+		eventTypes []byte
+	)
+	err := row.Scan(&w.ID, &w.CreatedAt, &w.URL, &w.Secret, &eventTypes, &w.Description, &w.Active, &w.Version)
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(eventTypes, &w.EventTypes); err != nil {
+		return nil, err
+	}
+	return &w, nil
+}
+
+func (m WebhookModel) Get(id int64) (*Webhook, error) {
+	if id < 1 {
+		return nil, ErrRecordNotFound
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	w, err := scanWebhook(m.DB.QueryRowContext(ctx, "select "+webhookColumns+" from webhook_subscriptions where id = $1", id))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrRecordNotFound
+	}
+	return w, err
+}
+
+func (m WebhookModel) GetAll() ([]*Webhook, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, "select "+webhookColumns+" from webhook_subscriptions order by id")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	webhooks := []*Webhook{}
+	for rows.Next() {
+		w, err := scanWebhook(rows)
+		if err != nil {
+			return nil, err
+		}
+		webhooks = append(webhooks, w)
+	}
+	return webhooks, rows.Err()
+}
+
+func (m WebhookModel) Update(w *Webhook) error {
+	eventTypes, err := json.Marshal(w.EventTypes)
+	if err != nil {
+		return err
+	}
+
+	query := `
+		update webhook_subscriptions
+		set url = $1, secret = $2, event_types = $3, description = $4, active = $5, version = version + 1
+		where id = $6 and version = $7
+		returning version
+	`
+	args := []any{w.URL, w.Secret, eventTypes, w.Description, w.Active, w.ID, w.Version}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err = m.DB.QueryRowContext(ctx, query, args...).Scan(&w.Version)
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrEditConflict
+	}
+	return err
+}
+
+func (m WebhookModel) Delete(id int64) error {
+	if id < 1 {
+		return ErrRecordNotFound
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, `delete from webhook_subscriptions where id = $1 returning id`, id).Scan(&id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrRecordNotFound
+	}
+	return err
+}
+
+func (m WebhookModel) Enqueue(event *Event) (int, error) {
+	query := `
+		insert into webhook_deliveries (subscription_id, event_id, next_attempt_at)
+		select id, $1, $3 from webhook_subscriptions
+		where active and (jsonb_array_length(event_types) = 0 or event_types ? $2)
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, query, event.ID, event.Type, event.OccurredAt)
+	if err != nil {
+		return 0, err
+	}
+	n, err := result.RowsAffected()
+	return int(n), err
+}
+
+func (m WebhookModel) EnqueueTo(id int64, event *Event) (*WebhookDelivery, error) {
+	query := `
+		insert into webhook_deliveries (subscription_id, event_id, next_attempt_at)
+		select id, $2, $3 from webhook_subscriptions where id = $1
+		returning id
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var deliveryID int64
+	err := m.DB.QueryRowContext(ctx, query, id, event.ID, event.OccurredAt).Scan(&deliveryID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrRecordNotFound
+		}
+		return nil, err
+	}
+	return m.GetDelivery(deliveryID)
+}
+
+const deliveryColumns = `d.id, d.subscription_id, d.event_id, e.type, d.state, d.attempts, d.next_attempt_at,
+		d.last_attempt_at, d.last_status_code, d.last_error, d.created_at, d.delivered_at`
+
+func scanDelivery(row interface{ Scan(...any) error }, dest ...any) (*WebhookDelivery, error) {
+	var (
+		d                                       WebhookDelivery
+		nextAttemptAt, lastAttemptAt, delivered sql.NullTime
+		statusCode                              sql.NullInt32
+	)
+	err := row.Scan(append([]any{&d.ID, &d.WebhookID, &d.EventID, &d.EventType, &d.State, &d.Attempts, &nextAttemptAt,
+		&lastAttemptAt, &statusCode, &d.LastError, &d.CreatedAt, &delivered}, dest...)...)
+	if err != nil {
+		return nil, err
+	}
+	if nextAttemptAt.Valid {
+		d.NextAttemptAt = &nextAttemptAt.Time
+	}
+	if lastAttemptAt.Valid {
+		d.LastAttemptAt = &lastAttemptAt.Time
+	}
+	if statusCode.Valid {
+		code := int(statusCode.Int32)
+		d.LastStatusCode = &code
+	}
+	if delivered.Valid {
+		d.DeliveredAt = &delivered.Time
+	}
+	return &d, nil
+}
+
+func (m WebhookModel) Claim(now time.Time, lease time.Duration, limit int) ([]*PendingDelivery, error) {
+	// skip locked lets dispatchers on other replicas claim the deliveries this one
+	// doesn't, instead of waiting for it.
+	query := `
+		update webhook_deliveries d
+		set next_attempt_at = $2
+		from webhook_subscriptions s, events e
+		where d.id in (
+			select id from webhook_deliveries
+			where state = 'pending' and next_attempt_at <= $1
+			order by next_attempt_at, id
+			limit $3
+			for update skip locked
+		) and s.id = d.subscription_id and e.id = d.event_id
+		returning ` + deliveryColumns + `, s.url, s.secret, e.camera_id, e.site_name, e.occurred_at, e.data
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, now, now.Add(lease), limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	pending := []*PendingDelivery{}
+	for rows.Next() {
+		var (
+			p    PendingDelivery
+			data []byte
+		)
+		d, err := scanDelivery(rows, &p.URL, &p.Secret, &p.Event.CameraID, &p.Event.SiteName, &p.Event.OccurredAt, &data)
+		if err != nil {
+			return nil, err
+		}
+		p.WebhookDelivery = *d
+		p.Event.ID, p.Event.Type, p.Event.Data = d.EventID, d.EventType, data
+		pending = append(pending, &p)
+	}
+	return pending, rows.Err()
+}
+
+func (m WebhookModel) SaveAttempt(d *WebhookDelivery) error {
+	query := `
+		update webhook_deliveries
+		set state = $2, attempts = $3, next_attempt_at = $4, last_attempt_at = $5, last_status_code = $6,
+			last_error = $7, delivered_at = $8
+		where id = $1
+	`
+	var statusCode sql.NullInt32
+	if d.LastStatusCode != nil {
+		statusCode = sql.NullInt32{Int32: int32(*d.LastStatusCode), Valid: true}
+	}
+	args := []any{d.ID, d.State, d.Attempts, d.NextAttemptAt, d.LastAttemptAt, statusCode, d.LastError, d.DeliveredAt}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, query, args...)
+	return err
+}
+
+func (m WebhookModel) GetDelivery(id int64) (*WebhookDelivery, error) {
+	if id < 1 {
+		return nil, ErrRecordNotFound
+	}
+
+	query := `
+		select ` + deliveryColumns + `
+		from webhook_deliveries d
+		join events e on e.id = d.event_id
+		where d.id = $1
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	d, err := scanDelivery(m.DB.QueryRowContext(ctx, query, id))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrRecordNotFound
+	}
+	return d, err
+}
+
+// where returns the filter as a condition on webhook_deliveries d, appending its
+// arguments to args.
+func (filter DeliveryFilter) where(args *[]any) string {
+	conds := []string{"true"}
+	if filter.WebhookID != 0 {
+		conds = append(conds, "d.subscription_id = "+placeholder(args, filter.WebhookID))
+	}
+	if filter.State != "" {
+		conds = append(conds, "d.state = "+placeholder(args, filter.State))
+	}
+	return strings.Join(conds, "\n\t\tand ")
+}
+
+func (m WebhookModel) GetAllDeliveries(filter DeliveryFilter, filters Filters) ([]*WebhookDelivery, Metadata, error) {
+	// The sort column comes from the validated safelist, so it is safe to interpolate.
+	query := `
+		select ` + deliveryColumns + `, count(*) over()
+		from webhook_deliveries d
+		join events e on e.id = d.event_id
+		where %s
+		order by d.%s %s, d.id asc
+		limit %s offset %s
+	`
+
+	var args []any
+	where := filter.where(&args)
+	query = fmt.Sprintf(query, where, filters.sortColumn(), filters.sortDirection(),
+		placeholder(&args, filters.limit()), placeholder(&args, filters.offset()))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+	defer rows.Close()
+
+	totalRecords := 0
+	deliveries := []*WebhookDelivery{}
+	for rows.Next() {
+		d, err := scanDelivery(rows, &totalRecords)
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+		deliveries = append(deliveries, d)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, Metadata{}, err
+	}
+
+	return deliveries, calculateMetadata(totalRecords, filters.Page, filters.PageSize), nil
+}
+
+func (m WebhookModel) Redeliver(id int64, now time.Time) (*WebhookDelivery, error) {
+	if id < 1 {
+		return nil, ErrRecordNotFound
+	}
+
+	query := `
+		update webhook_deliveries
+		set state = 'pending', attempts = 0, next_attempt_at = $2, delivered_at = null
+		where id = $1
+		returning id
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, id, now).Scan(&id)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrRecordNotFound
+		}
+		return nil, err
+	}
+	return m.GetDelivery(id)
+}
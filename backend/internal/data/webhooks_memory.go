@@ -0,0 +1,264 @@
+package data
+
+import (
+	"cmp"
+	"slices"
+	"sync"
+	"time"
+)
+
+// MemoryWebhookModel is an in-memory WebhookRepository. It reads the events it
+// delivers from events.
+type MemoryWebhookModel struct {
+	mu             sync.Mutex
+	events         *MemoryEventModel
+	nextID         int64
+	nextDeliveryID int64
+	webhooks       map[int64]Webhook
+	deliveries     map[int64]WebhookDelivery
+}
+
+func NewMemoryWebhookModel(events *MemoryEventModel) *MemoryWebhookModel {
+	return &MemoryWebhookModel{
+		events:         events,
+		nextID:         1,
+		nextDeliveryID: 1,
+		webhooks:       make(map[int64]Webhook),
+		deliveries:     make(map[int64]WebhookDelivery),
+	}
+}
+
+// storedWebhook copies w so that callers can't change the store through a pointer.
+func storedWebhook(w Webhook) *Webhook {
+	w.EventTypes = slices.Clone(w.EventTypes)
+	if w.EventTypes == nil {
+		w.EventTypes = []string{}
+	}
+	return &w
+}
+
+// storedDelivery copies d, truncating its times to the second like the timestamp(0)
+// columns.
+func storedDelivery(d WebhookDelivery) *WebhookDelivery {
+	truncate := func(t *time.Time) *time.Time {
+		if t == nil {
+			return nil
+		}
+		truncated := t.Truncate(time.Second)
+		return &truncated
+	}
+	d.NextAttemptAt = truncate(d.NextAttemptAt)
+	d.LastAttemptAt = truncate(d.LastAttemptAt)
+	d.DeliveredAt = truncate(d.DeliveredAt)
+	if d.LastStatusCode != nil {
+		code := *d.LastStatusCode
+		d.LastStatusCode = &code
+	}
+	return &d
+}
+
+func (m *MemoryWebhookModel) Insert(w *Webhook) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	w.ID = m.nextID
+	w.CreatedAt = time.Now().Truncate(time.Second)
+	w.Version = 1
+	m.nextID++
+	m.webhooks[w.ID] = *storedWebhook(*w)
+	return nil
+}
+
+func (m *MemoryWebhookModel) Get(id int64) (*Webhook, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	w, ok := m.webhooks[id]
+	if !ok {
+		return nil, ErrRecordNotFound
+	}
+	return storedWebhook(w), nil
+}
+
+func (m *MemoryWebhookModel) GetAll() ([]*Webhook, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	webhooks := []*Webhook{}
+	for _, w := range m.webhooks {
+		webhooks = append(webhooks, storedWebhook(w))
+	}
+	slices.SortFunc(webhooks, func(a, b *Webhook) int { return cmp.Compare(a.ID, b.ID) })
+	return webhooks, nil
+}
+
+func (m *MemoryWebhookModel) Update(w *Webhook) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	stored, ok := m.webhooks[w.ID]
+	if !ok || stored.Version != w.Version {
+		return ErrEditConflict
+	}
+	w.Version++
+	m.webhooks[w.ID] = *storedWebhook(*w)
+	return nil
+}
+
+func (m *MemoryWebhookModel) Delete(id int64) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.webhooks[id]; !ok {
+		return ErrRecordNotFound
+	}
+	delete(m.webhooks, id)
+	for deliveryID, d := range m.deliveries {
+		if d.WebhookID == id {
+			delete(m.deliveries, deliveryID)
+		}
+	}
+	return nil
+}
+
+// enqueue adds a delivery of event to the webhook. It must be called with mu held.
+func (m *MemoryWebhookModel) enqueue(webhookID int64, event *Event) *WebhookDelivery {
+	due := event.OccurredAt
+	d := WebhookDelivery{
+		ID:            m.nextDeliveryID,
+		WebhookID:     webhookID,
+		EventID:       event.ID,
+		EventType:     event.Type,
+		State:         DeliveryPending,
+		NextAttemptAt: &due,
+		CreatedAt:     time.Now().Truncate(time.Second),
+	}
+	m.nextDeliveryID++
+	m.deliveries[d.ID] = *storedDelivery(d)
+	return storedDelivery(d)
+}
+
+func (m *MemoryWebhookModel) Enqueue(event *Event) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	n := 0
+	for _, w := range m.webhooks {
+		if w.Subscribed(event.Type) {
+			m.enqueue(w.ID, event)
+			n++
+		}
+	}
+	return n, nil
+}
+
+func (m *MemoryWebhookModel) EnqueueTo(id int64, event *Event) (*WebhookDelivery, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.webhooks[id]; !ok {
+		return nil, ErrRecordNotFound
+	}
+	return m.enqueue(id, event), nil
+}
+
+func (m *MemoryWebhookModel) Claim(now time.Time, lease time.Duration, limit int) ([]*PendingDelivery, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var due []WebhookDelivery
+	for _, d := range m.deliveries {
+		if d.State == DeliveryPending && !d.NextAttemptAt.After(now) {
+			due = append(due, d)
+		}
+	}
+	slices.SortFunc(due, func(a, b WebhookDelivery) int {
+		if c := a.NextAttemptAt.Compare(*b.NextAttemptAt); c != 0 {
+			return c
+		}
+		return cmp.Compare(a.ID, b.ID)
+	})
+
+	pending := []*PendingDelivery{}
+	for _, d := range due[:min(limit, len(due))] {
+		event, ok := m.events.get(d.EventID)
+		if !ok {
+			continue
+		}
+		leased := now.Add(lease)
+		d.NextAttemptAt = &leased
+		m.deliveries[d.ID] = *storedDelivery(d)
+
+		w := m.webhooks[d.WebhookID]
+		pending = append(pending, &PendingDelivery{WebhookDelivery: *storedDelivery(d), URL: w.URL, Secret: w.Secret, Event: event})
+	}
+	return pending, nil
+}
+
+func (m *MemoryWebhookModel) SaveAttempt(d *WebhookDelivery) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	stored, ok := m.deliveries[d.ID]
+	if !ok {
+		return nil
+	}
+	stored.State, stored.Attempts = d.State, d.Attempts
+	stored.NextAttemptAt, stored.LastAttemptAt = d.NextAttemptAt, d.LastAttemptAt
+	stored.LastStatusCode, stored.LastError = d.LastStatusCode, d.LastError
+	stored.DeliveredAt = d.DeliveredAt
+	m.deliveries[d.ID] = *storedDelivery(stored)
+	return nil
+}
+
+func (m *MemoryWebhookModel) GetDelivery(id int64) (*WebhookDelivery, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	d, ok := m.deliveries[id]
+	if !ok {
+		return nil, ErrRecordNotFound
+	}
+	return storedDelivery(d), nil
+}
+
+func (m *MemoryWebhookModel) GetAllDeliveries(filter DeliveryFilter, filters Filters) ([]*WebhookDelivery, Metadata, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var all []*WebhookDelivery
+	for _, d := range m.deliveries {
+		if (filter.WebhookID == 0 || d.WebhookID == filter.WebhookID) && (filter.State == "" || d.State == filter.State) {
+			all = append(all, storedDelivery(d))
+		}
+	}
+
+	desc := filters.sortDirection() == "DESC"
+	slices.SortFunc(all, func(a, b *WebhookDelivery) int {
+		c := cmp.Compare(a.ID, b.ID)
+		if desc {
+			c = -c
+		}
+		return c
+	})
+
+	metadata := calculateMetadata(len(all), filters.Page, filters.PageSize)
+
+	start := min(filters.offset(), len(all))
+	end := min(start+filters.limit(), len(all))
+	return append([]*WebhookDelivery{}, all[start:end]...), metadata, nil
+}
+
+func (m *MemoryWebhookModel) Redeliver(id int64, now time.Time) (*WebhookDelivery, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	d, ok := m.deliveries[id]
+	if !ok {
+		return nil, ErrRecordNotFound
+	}
+	d.State, d.Attempts = DeliveryPending, 0
+	d.NextAttemptAt, d.DeliveredAt = &now, nil
+	m.deliveries[id] = *storedDelivery(d)
+	return storedDelivery(d), nil
+}
@@ -0,0 +1,192 @@
+package data
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/chefgoldbloom/pnctool/backend/internal/validator"
+)
+
+// testWebhookRepository queues deliveries through repo of events logged in events,
+// which must share its data.
+func testWebhookRepository(t *testing.T, events EventRepository, repo WebhookRepository) {
+	all := &Webhook{URL: "https://example.com/all", Secret: "0123456789abcdef", EventTypes: []string{}, Active: true}
+	offline := &Webhook{URL: "https://example.com/offline", Secret: "0123456789abcdef", EventTypes: []string{EventCameraOffline}, Active: true}
+	inactive := &Webhook{URL: "https://example.com/inactive", Secret: "0123456789abcdef", EventTypes: []string{}, Active: false}
+	for _, w := range []*Webhook{all, offline, inactive} {
+		if err := repo.Insert(w); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	got, err := repo.Get(offline.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.URL != offline.URL || got.Secret != offline.Secret || fmt.Sprint(got.EventTypes) != "[camera.offline]" || !got.Active || got.Version != 1 {
+		t.Errorf("Get = %+v", got)
+	}
+	if _, err := repo.Get(99); !errors.Is(err, ErrRecordNotFound) {
+		t.Errorf("Get of a missing webhook: err = %v; want ErrRecordNotFound", err)
+	}
+	if webhooks, err := repo.GetAll(); err != nil || len(webhooks) != 3 || webhooks[0].ID != all.ID {
+		t.Errorf("GetAll = %v, %v; want the three webhooks in id order", webhooks, err)
+	}
+
+	got.Description = "paging"
+	if err := repo.Update(got); err != nil || got.Version != 2 {
+		t.Fatalf("Update = %v, version %d; want version 2", err, got.Version)
+	}
+	got.Version = 1
+	if err := repo.Update(got); !errors.Is(err, ErrEditConflict) {
+		t.Errorf("Update of a stale version: err = %v; want ErrEditConflict", err)
+	}
+
+	// Only active webhooks subscribed to the event's type get a delivery.
+	at := time.Date(2026, 3, 2, 9, 0, 0, 0, time.UTC)
+	created := &Event{Type: EventCameraCreated, CameraID: 1, SiteName: "NYC-5th-GLH", OccurredAt: at, Data: json.RawMessage(`{"id":1}`)}
+	down := &Event{Type: EventCameraOffline, CameraID: 1, SiteName: "NYC-5th-GLH", OccurredAt: at.Add(time.Minute), Data: json.RawMessage(`{"status":"offline"}`)}
+	for _, event := range []*Event{created, down} {
+		if err := events.Insert(event); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if n, err := repo.Enqueue(created); n != 1 || err != nil {
+		t.Errorf("Enqueue(camera.created) = %d, %v; want 1", n, err)
+	}
+	if n, err := repo.Enqueue(down); n != 2 || err != nil {
+		t.Errorf("Enqueue(camera.offline) = %d, %v; want 2", n, err)
+	}
+	ping, err := repo.EnqueueTo(inactive.ID, created)
+	if err != nil || ping.WebhookID != inactive.ID || ping.State != DeliveryPending {
+		t.Errorf("EnqueueTo = %+v, %v; want a pending delivery to the inactive webhook", ping, err)
+	}
+	if _, err := repo.EnqueueTo(99, created); !errors.Is(err, ErrRecordNotFound) {
+		t.Errorf("EnqueueTo a missing webhook: err = %v; want ErrRecordNotFound", err)
+	}
+
+	// Deliveries are claimed once they're due, oldest first, and not again until
+	// their lease runs out.
+	claimed, err := repo.Claim(at, time.Hour, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(claimed) != 2 {
+		t.Fatalf("Claim at %v = %d deliveries; want the 2 of camera.created", at, len(claimed))
+	}
+	first := claimed[0]
+	var payload struct{ ID int64 }
+	if err := json.Unmarshal(first.Event.Data, &payload); err != nil {
+		t.Fatal(err)
+	}
+	if first.URL != all.URL || first.Secret != all.Secret || first.Event.ID != created.ID || first.Event.Type != EventCameraCreated ||
+		first.Event.SiteName != "NYC-5th-GLH" || payload.ID != 1 {
+		t.Errorf("claimed = %+v", first)
+	}
+	if again, _ := repo.Claim(at.Add(time.Minute), time.Minute, 10); len(again) != 2 {
+		t.Errorf("Claim a minute later = %d deliveries; want only the 2 of camera.offline", len(again))
+	}
+	if limited, _ := repo.Claim(at.Add(3*time.Minute), time.Minute, 1); len(limited) != 1 {
+		t.Errorf("Claim with limit 1 = %d deliveries; want 1", len(limited))
+	}
+
+	// Record a failed attempt, and then the delivery running out of attempts.
+	attempted := at.Add(10 * time.Minute)
+	next := attempted.Add(30 * time.Second)
+	status := 500
+	d := first.WebhookDelivery
+	d.Attempts, d.LastAttemptAt, d.NextAttemptAt, d.LastStatusCode, d.LastError = 1, &attempted, &next, &status, "receiver answered 500"
+	if err := repo.SaveAttempt(&d); err != nil {
+		t.Fatal(err)
+	}
+	stored, err := repo.GetDelivery(d.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stored.Attempts != 1 || stored.State != DeliveryPending || !stored.NextAttemptAt.Equal(next) || *stored.LastStatusCode != 500 || stored.EventType != EventCameraCreated {
+		t.Errorf("after a failed attempt delivery = %+v", stored)
+	}
+	d.State, d.Attempts, d.NextAttemptAt, d.DeliveredAt = DeliveryDead, 8, nil, nil
+	if err := repo.SaveAttempt(&d); err != nil {
+		t.Fatal(err)
+	}
+
+	filters := Filters{Page: 1, PageSize: 10, Sort: "-id", SortSafelist: []string{"id", "-id"}}
+	dead, metadata, err := repo.GetAllDeliveries(DeliveryFilter{State: DeliveryDead}, filters)
+	if err != nil || len(dead) != 1 || dead[0].ID != d.ID || metadata.TotalRecords != 1 {
+		t.Errorf("dead deliveries = %v, %+v, %v; want delivery %d", dead, metadata, err, d.ID)
+	}
+	toOffline, _, _ := repo.GetAllDeliveries(DeliveryFilter{WebhookID: offline.ID}, filters)
+	if len(toOffline) != 1 || toOffline[0].EventType != EventCameraOffline {
+		t.Errorf("deliveries to the offline webhook = %v; want its camera.offline delivery", toOffline)
+	}
+	if everything, _, _ := repo.GetAllDeliveries(DeliveryFilter{}, filters); len(everything) != 4 || everything[0].ID < everything[3].ID {
+		t.Errorf("all deliveries = %v; want 4, newest first", everything)
+	}
+
+	// Redelivering a dead delivery queues it again with its attempts reset.
+	later := at.Add(time.Hour)
+	redelivered, err := repo.Redeliver(d.ID, later)
+	if err != nil || redelivered.State != DeliveryPending || redelivered.Attempts != 0 || !redelivered.NextAttemptAt.Equal(later) {
+		t.Errorf("Redeliver = %+v, %v; want pending again at %v", redelivered, err, later)
+	}
+	if _, err := repo.Redeliver(99, later); !errors.Is(err, ErrRecordNotFound) {
+		t.Errorf("Redeliver of a missing delivery: err = %v; want ErrRecordNotFound", err)
+	}
+
+	// Deleting a webhook deletes its deliveries.
+	if err := repo.Delete(all.ID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := repo.GetDelivery(d.ID); !errors.Is(err, ErrRecordNotFound) {
+		t.Errorf("GetDelivery after deleting the webhook: err = %v; want ErrRecordNotFound", err)
+	}
+	if err := repo.Delete(all.ID); !errors.Is(err, ErrRecordNotFound) {
+		t.Errorf("second Delete: err = %v; want ErrRecordNotFound", err)
+	}
+}
+
+func TestWebhookModel(t *testing.T) {
+	db := newTestDB(t)
+	testWebhookRepository(t, EventModel{DB: db}, WebhookModel{DB: db})
+}
+
+func TestMemoryWebhookModel(t *testing.T) {
+	events := NewMemoryEventModel()
+	testWebhookRepository(t, events, NewMemoryWebhookModel(events))
+}
+
+func TestValidateWebhook(t *testing.T) {
+	tests := []struct {
+		name    string
+		webhook Webhook
+		field   string
+	}{
+		{"valid", Webhook{URL: "https://example.com/hook", Secret: "0123456789abcdef", EventTypes: []string{EventCameraOnline}}, ""},
+		{"missing url", Webhook{Secret: "0123456789abcdef"}, "url"},
+		{"relative url", Webhook{URL: "/hook", Secret: "0123456789abcdef"}, "url"},
+		{"other scheme", Webhook{URL: "ftp://example.com/hook", Secret: "0123456789abcdef"}, "url"},
+		{"short secret", Webhook{URL: "https://example.com/hook", Secret: "short"}, "secret"},
+		{"unknown event type", Webhook{URL: "https://example.com/hook", Secret: "0123456789abcdef", EventTypes: []string{"camera.exploded"}}, "event_types"},
+		{"ping", Webhook{URL: "https://example.com/hook", Secret: "0123456789abcdef", EventTypes: []string{EventWebhookPing}}, "event_types"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v := validator.New()
+			ValidateWebhook(v, &tt.webhook)
+			if tt.field == "" {
+				if !v.Valid() {
+					t.Errorf("errors = %v; want none", v.Errors)
+				}
+				return
+			}
+			if _, ok := v.Errors[tt.field]; !ok || len(v.Errors) != 1 {
+				t.Errorf("errors = %v; want one for %s", v.Errors, tt.field)
+			}
+		})
+	}
+}
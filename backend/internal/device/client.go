@@ -0,0 +1,260 @@
+package device
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Client sends drivers' requests to cameras. It is safe for concurrent use.
+type Client struct {
+	http    *http.Client
+	timeout time.Duration
+
+	mu         sync.Mutex
+	challenges map[string]*challenge // last digest challenge per address and user
+}
+
+// NewClient returns a Client whose requests give up after timeout, unless their
+// context has a deadline of its own. The timeout covers reading the response body,
+// so calls which need longer, like firmware uploads, set their own deadline.
+func NewClient(timeout time.Duration) *Client {
+	return &Client{
+		http:       &http.Client{},
+		timeout:    timeout,
+		challenges: make(map[string]*challenge),
+	}
+}
+
+// baseURL returns the device's address as a URL without a trailing slash.
+func (d Device) baseURL() string {
+	addr := strings.TrimSuffix(d.Addr, "/")
+	if !strings.Contains(addr, "://") {
+		addr = "http://" + addr
+	}
+	return addr
+}
+
+// authorization returns the Authorization header for a request to d, answering the
+// last challenge d's address sent, or "" if there hasn't been one.
+func (c *Client) authorization(d Device, method, uri string) string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	ch, ok := c.challenges[d.Addr+"\x00"+d.Username]
+	if !ok {
+		return ""
+	}
+	return ch.authorize(d.Username, d.Password, method, uri)
+}
+
+func (c *Client) setChallenge(d Device, ch *challenge) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.challenges[d.Addr+"\x00"+d.Username] = ch
+}
+
+// unreachable reports whether err means the camera couldn't be reached at all, as
+// opposed to it answering in a way the driver didn't expect.
+func unreachable(err error) bool {
+	var uerr *url.Error
+	return errors.Is(err, ErrTimeout) || errors.As(err, &uerr)
+}
+
+// do sends a request to the device, answering its digest challenge. The challenge is
+// kept so later requests can authenticate up front. The body is a byte slice rather
+// than a reader so it can be sent again after a challenge. Any error is an *Error for
+// op. If ctx has no deadline, the client's timeout applies until the response body is
+// closed.
+func (c *Client) do(ctx context.Context, d Device, op, method, path, contentType string, body []byte) (*http.Response, error) {
+	open := func() (io.Reader, error) { return bytes.NewReader(body), nil }
+	return c.withTimeout(ctx, func(ctx context.Context) (*http.Response, error) {
+		return c.send(ctx, d, op, method, path, contentType, open, int64(len(body)))
+	})
+}
+
+// upload sends a request whose body is streamed from r, which may be too big to hold
+// in memory. A bodiless request to path fetches a fresh digest challenge first, so
+// the body normally goes out once, already authenticated. If the camera challenges
+// it anyway, it's only sent again if r is an io.Seeker. The Content-Length is
+// prefix, r's remaining size and suffix together if r is an io.Seeker; otherwise the
+// body is chunked.
+func (c *Client) upload(ctx context.Context, d Device, op, method, path, contentType string, prefix []byte, r io.Reader, suffix []byte) (*http.Response, error) {
+	image, size := rewinder(r)
+	open := func() (io.Reader, error) {
+		r, err := image()
+		if err != nil {
+			return nil, err
+		}
+		return io.MultiReader(bytes.NewReader(prefix), r, bytes.NewReader(suffix)), nil
+	}
+	if size >= 0 {
+		size += int64(len(prefix) + len(suffix))
+	}
+
+	return c.withTimeout(ctx, func(ctx context.Context) (*http.Response, error) {
+		if err := c.fetchChallenge(ctx, d, op, path); err != nil {
+			return nil, err
+		}
+		return c.send(ctx, d, op, method, path, contentType, open, size)
+	})
+}
+
+// rewinder returns a function returning r, rewound to where it is now each time
+// after the first, and r's remaining size. If r isn't an io.Seeker the size is -1
+// and it can only be returned once.
+func rewinder(r io.Reader) (func() (io.Reader, error), int64) {
+	once := func() func() (io.Reader, error) {
+		sent := false
+		return func() (io.Reader, error) {
+			if sent {
+				return nil, errors.New("the body can't be sent again")
+			}
+			sent = true
+			return r, nil
+		}
+	}
+
+	s, ok := r.(io.Seeker)
+	if !ok {
+		return once(), -1
+	}
+	start, err := s.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return once(), -1
+	}
+	end, err := s.Seek(0, io.SeekEnd)
+	if err == nil {
+		_, err = s.Seek(start, io.SeekStart)
+	}
+	if err != nil {
+		return once(), -1
+	}
+	return func() (io.Reader, error) {
+		_, err := s.Seek(start, io.SeekStart)
+		return r, err
+	}, end - start
+}
+
+// fetchChallenge asks for path without credentials and keeps the digest challenge the
+// camera answers with. An answer other than 401 Unauthorized is ignored; the request
+// which follows deals with it.
+func (c *Client) fetchChallenge(ctx context.Context, d Device, op, path string) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, d.baseURL()+path, nil)
+	if err != nil {
+		return &Error{Op: op, Addr: d.Addr, Err: err}
+	}
+	res, err := c.http.Do(req)
+	if err != nil {
+		return &Error{Op: op, Addr: d.Addr, Err: httpError(err)}
+	}
+	io.Copy(io.Discard, res.Body)
+	res.Body.Close()
+
+	if res.StatusCode == http.StatusUnauthorized {
+		if ch, err := parseChallenge(res.Header.Get("WWW-Authenticate")); err == nil {
+			c.setChallenge(d, ch)
+		}
+	}
+	return nil
+}
+
+// cancelBody is a response body which releases its request's context when closed.
+type cancelBody struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (b cancelBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.cancel()
+	return err
+}
+
+// withTimeout calls send with ctx, giving it the client's timeout if ctx has no
+// deadline. The timeout lasts until the response body is closed.
+func (c *Client) withTimeout(ctx context.Context, send func(context.Context) (*http.Response, error)) (*http.Response, error) {
+	if _, ok := ctx.Deadline(); ok || c.timeout <= 0 {
+		return send(ctx)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, c.timeout)
+	res, err := send(ctx)
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	res.Body = cancelBody{ReadCloser: res.Body, cancel: cancel}
+	return res, nil
+}
+
+// httpError marks an error from sending a request which timed out with ErrTimeout.
+func httpError(err error) error {
+	var netErr net.Error
+	if errors.Is(err, context.DeadlineExceeded) || errors.As(err, &netErr) && netErr.Timeout() {
+		return fmt.Errorf("%w: %v", ErrTimeout, err)
+	}
+	return err
+}
+
+// send sends a request with the body open returns, answering the camera's digest
+// challenge, and opening the body again for each attempt. size is the body's length,
+// or -1 if it isn't known.
+func (c *Client) send(ctx context.Context, d Device, op, method, path, contentType string, open func() (io.Reader, error), size int64) (*http.Response, error) {
+	fail := func(err error) (*http.Response, error) {
+		return nil, &Error{Op: op, Addr: d.Addr, Err: err}
+	}
+
+	authorized := false
+	for attempt := 0; attempt < 3; attempt++ {
+		body, err := open()
+		if err != nil {
+			return fail(err)
+		}
+		req, err := http.NewRequestWithContext(ctx, method, d.baseURL()+path, body)
+		if err != nil {
+			return fail(err)
+		}
+		req.ContentLength = size
+		if size == 0 {
+			req.Body = http.NoBody
+		}
+		if contentType != "" {
+			req.Header.Set("Content-Type", contentType)
+		}
+		if auth := c.authorization(d, method, req.URL.RequestURI()); auth != "" {
+			req.Header.Set("Authorization", auth)
+			authorized = true
+		}
+
+		res, err := c.http.Do(req)
+		if err != nil {
+			return fail(httpError(err))
+		}
+		if res.StatusCode != http.StatusUnauthorized {
+			return res, nil
+		}
+		io.Copy(io.Discard, res.Body)
+		res.Body.Close()
+
+		ch, err := parseChallenge(res.Header.Get("WWW-Authenticate"))
+		if err != nil {
+			return fail(fmt.Errorf("%w: %v", ErrUnauthorized, err))
+		}
+		// A stale nonce only means it expired, so the same credentials are worth
+		// another try. Otherwise they were rejected.
+		if authorized && !ch.stale {
+			break
+		}
+		c.setChallenge(d, ch)
+	}
+	return fail(ErrUnauthorized)
+}
@@ -0,0 +1,104 @@
+package device_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/chefgoldbloom/pnctool/backend/internal/device"
+	"github.com/chefgoldbloom/pnctool/backend/internal/device/devicetest"
+)
+
+var testInfo = device.Info{Vendor: "AXIS", Model: "P3245-LV", Serial: "ACCC8E000001", Firmware: "10.12.114", Hostname: "axis-accc8e000001"}
+
+func TestClientInfo(t *testing.T) {
+	camera := devicetest.NewCamera(testInfo)
+	defer camera.Close()
+
+	driver := device.NewVAPIX(device.NewClient(time.Second))
+	info, err := driver.Info(context.Background(), camera.Device())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if *info != testInfo {
+		t.Errorf("info = %+v; want %+v", *info, testInfo)
+	}
+
+	// The first call answers a challenge; later calls reuse it.
+	before := camera.Requests()
+	if _, err := driver.Info(context.Background(), camera.Device()); err != nil {
+		t.Fatal(err)
+	}
+	if n := camera.Requests() - before; n != 2 {
+		t.Errorf("second Info made %d requests; want 2", n)
+	}
+
+	// An expired nonce is renewed without failing the call.
+	camera.ExpireNonces()
+	if _, err := driver.Info(context.Background(), camera.Device()); err != nil {
+		t.Errorf("after expiring nonces: %v", err)
+	}
+}
+
+func TestClientErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		setup   func(*devicetest.Camera, *device.Device)
+		want    error
+		timeout time.Duration
+	}{
+		{"wrong password", func(c *devicetest.Camera, d *device.Device) { d.Password = "wrong" }, device.ErrUnauthorized, time.Second},
+		{"wrong user", func(c *devicetest.Camera, d *device.Device) { d.Username = "admin" }, device.ErrUnauthorized, time.Second},
+		{"slow", func(c *devicetest.Camera, d *device.Device) { c.SetDelay(time.Second) }, device.ErrTimeout, 50 * time.Millisecond},
+		{"old firmware", func(c *devicetest.Camera, d *device.Device) { c.Disable("/axis-cgi/basicdeviceinfo.cgi") }, device.ErrUnsupportedModel, time.Second},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			camera := devicetest.NewCamera(testInfo)
+			defer camera.Close()
+
+			d := camera.Device()
+			tt.setup(camera, &d)
+
+			_, err := device.NewVAPIX(device.NewClient(tt.timeout)).Info(context.Background(), d)
+			if !errors.Is(err, tt.want) {
+				t.Fatalf("err = %v; want %v", err, tt.want)
+			}
+			var derr *device.Error
+			if !errors.As(err, &derr) || derr.Op != "info" || derr.Addr != d.Addr {
+				t.Errorf("err = %#v; want *device.Error for info on %s", err, d.Addr)
+			}
+		})
+	}
+}
+
+func TestClientContextDeadline(t *testing.T) {
+	camera := devicetest.NewCamera(testInfo)
+	defer camera.Close()
+	camera.SetDelay(time.Second)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	_, err := device.NewVAPIX(device.NewClient(time.Minute)).Info(ctx, camera.Device())
+	if !errors.Is(err, device.ErrTimeout) {
+		t.Errorf("err = %v; want ErrTimeout", err)
+	}
+}
+
+func TestClientBasicAuthOnly(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("WWW-Authenticate", `Basic realm="camera"`)
+		w.WriteHeader(http.StatusUnauthorized)
+	}))
+	defer srv.Close()
+
+	_, err := device.NewVAPIX(device.NewClient(time.Second)).Info(context.Background(), device.Device{Addr: srv.URL, Username: "root", Password: "pass"})
+	if !errors.Is(err, device.ErrUnauthorized) {
+		t.Errorf("err = %v; want ErrUnauthorized", err)
+	}
+}
@@ -0,0 +1,114 @@
+// Package device talks to cameras over their HTTP management APIs.
+//
+// Each vendor's API is a Driver. A Registry picks the driver for a camera from its
+// MAC address's OUI or its model number, so adding a vendor only means registering
+// another driver. Drivers share a Client, which handles the HTTP digest
+// authentication cameras use and reuses connections and challenges between calls.
+// Each call names the camera it's for with a Device, which carries the address and
+// the credentials stored in the inventory:
+//
+//	drivers := device.NewRegistry(device.NewClient(5 * time.Second))
+//	d := device.Device{Addr: "10.0.0.7", Username: "root", Password: "pass", MacAddress: "ACCC8E000001"}
+//	driver, err := drivers.Lookup(d)
+//	...
+//	info, err := driver.Info(ctx, d)
+//
+// Errors are of type *Error. Authentication failures, timeouts, unsupported models
+// and unsupported operations can be told apart with errors.Is and ErrUnauthorized,
+// ErrTimeout, ErrUnsupportedModel and ErrUnsupported.
+package device
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+)
+
+var (
+	// ErrUnauthorized is returned when the camera rejects the credentials.
+	ErrUnauthorized = errors.New("unauthorized")
+
+	// ErrTimeout is returned when the camera doesn't answer in time.
+	ErrTimeout = errors.New("timed out")
+
+	// ErrUnsupportedModel is returned for a camera whose model, or firmware, doesn't
+	// provide the API the client needs.
+	ErrUnsupportedModel = errors.New("unsupported model")
+
+	// ErrUnsupported is returned for an operation or setting a driver doesn't have.
+	ErrUnsupported = errors.New("not supported")
+)
+
+// Device is a camera to talk to. Addr is a host, host:port or base URL; plain hosts
+// are reached over HTTP.
+type Device struct {
+	Addr       string
+	Username   string
+	Password   string
+	ModelNo    string
+	MacAddress string
+}
+
+// Info is what a camera reports about itself.
+type Info struct {
+	Vendor   string `json:"vendor"`
+	Model    string `json:"model"`
+	Serial   string `json:"serial"`
+	Firmware string `json:"firmware"`
+	Hostname string `json:"hostname"`
+}
+
+// Settings every driver understands in Config and SetConfig. Drivers may accept
+// their own vendor-specific names as well.
+const (
+	ConfigHostname  = "hostname"
+	ConfigNTPServer = "ntp_server"
+)
+
+// Driver speaks one vendor's camera API.
+type Driver interface {
+	// Name identifies the driver, like "vapix".
+	Name() string
+
+	// Identify reports whether the camera at d.Addr speaks the driver's API. It
+	// doesn't need credentials, so it can place cameras the registry can't.
+	Identify(ctx context.Context, d Device) (bool, error)
+
+	// Info reads the camera's model, serial number, firmware version and hostname.
+	Info(ctx context.Context, d Device) (*Info, error)
+
+	// Reboot restarts the camera. It returns once the camera has accepted the
+	// request, not once it's back.
+	Reboot(ctx context.Context, d Device) error
+
+	// Config reads the named settings.
+	Config(ctx context.Context, d Device, keys ...string) (map[string]string, error)
+
+	// SetConfig changes the given settings.
+	SetConfig(ctx context.Context, d Device, values map[string]string) error
+
+	// UpgradeFirmware uploads a firmware image and starts the upgrade. The camera
+	// reboots when it's done. The image is streamed to the camera; if it's an
+	// io.Seeker, like a file, its size is sent up front and it can be sent again
+	// should the camera ask for credentials a second time.
+	UpgradeFirmware(ctx context.Context, d Device, image io.Reader) error
+
+	// Snapshot returns a JPEG image from the camera.
+	Snapshot(ctx context.Context, d Device) ([]byte, error)
+}
+
+// Error records a failed operation on a camera.
+type Error struct {
+	Op   string
+	Addr string
+	Err  error
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("device %s: %s: %v", e.Addr, e.Op, e.Err)
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
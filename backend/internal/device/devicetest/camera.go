@@ -0,0 +1,261 @@
+// Package devicetest provides fake cameras for testing code which uses package
+// device, in the spirit of net/http/httptest. NewCamera simulates an Axis camera
+// speaking VAPIX and NewONVIFCamera a camera managed through ONVIF.
+package devicetest
+
+import (
+	"crypto/md5"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/chefgoldbloom/pnctool/backend/internal/device"
+)
+
+// JPEG is the image the fake cameras return as a snapshot.
+var JPEG = []byte("\xff\xd8\xff\xe0\x00\x10JFIF\x00\x01\x01\x00\x00\x01\x00\x01\x00\x00\xff\xd9")
+
+// Settings both simulators store, by their VAPIX names.
+const (
+	paramHostname  = "root.Network.HostName"
+	paramNTPServer = "root.Time.NTP.Server"
+)
+
+// Camera is a fake camera. Its credentials are the inventory defaults, root and pass,
+// until changed with SetPassword. Requests to its HTTP endpoints need digest
+// authentication.
+type Camera struct {
+	*httptest.Server
+
+	mu       sync.Mutex
+	info     device.Info
+	params   map[string]string
+	username string
+	password string
+	realm    string
+	nonces   map[string]int // issued digest nonces and the last nc used with each
+	delay    time.Duration
+	disabled map[string]bool
+	requests int
+	reboots  int
+	closed   chan struct{}
+}
+
+func newCamera(info device.Info, routes func(*Camera, *http.ServeMux)) *Camera {
+	c := &Camera{
+		info:     info,
+		params:   map[string]string{paramHostname: info.Hostname, paramNTPServer: "pool.ntp.org"},
+		username: "root",
+		password: "pass",
+		realm:    info.Vendor + "_" + info.Serial,
+		nonces:   make(map[string]int),
+		disabled: make(map[string]bool),
+		closed:   make(chan struct{}),
+	}
+
+	mux := http.NewServeMux()
+	routes(c, mux)
+	c.Server = httptest.NewServer(c.handle(mux))
+	return c
+}
+
+// Device returns the device.Device for talking to the camera with its current
+// credentials.
+func (c *Camera) Device() device.Device {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return device.Device{Addr: c.URL, Username: c.username, Password: c.password, ModelNo: c.info.Model}
+}
+
+// Close shuts the camera down, cutting short any delayed responses.
+func (c *Camera) Close() {
+	close(c.closed)
+	c.Server.Close()
+}
+
+// Info returns what the camera currently reports about itself.
+func (c *Camera) Info() device.Info {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	info := c.info
+	info.Hostname = c.params[paramHostname]
+	return info
+}
+
+// Param returns one of the camera's settings by its VAPIX name.
+func (c *Camera) Param(name string) string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.params[name]
+}
+
+// SetPassword changes the password the camera accepts.
+func (c *Camera) SetPassword(password string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.password = password
+}
+
+// SetDelay makes the camera wait before answering each request.
+func (c *Camera) SetDelay(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.delay = d
+}
+
+// Disable makes the camera answer 404 Not Found for path, as older firmware does for
+// APIs it doesn't have.
+func (c *Camera) Disable(path string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.disabled[path] = true
+}
+
+// ExpireNonces makes every digest nonce issued so far stale, as a camera does after
+// a while.
+func (c *Camera) ExpireNonces() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for nonce := range c.nonces {
+		c.nonces[nonce] = -1
+	}
+}
+
+// Requests returns the number of requests the camera has received.
+func (c *Camera) Requests() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.requests
+}
+
+// Reboots returns the number of times the camera has been rebooted, including by
+// firmware upgrades.
+func (c *Camera) Reboots() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.reboots
+}
+
+// upgrade installs a firmware image. The fake treats the image's contents as the new
+// firmware version.
+func (c *Camera) upgrade(image []byte) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.info.Firmware = strings.TrimSpace(string(image))
+	c.reboots++
+}
+
+// handle applies the configured delay and disabled paths before passing the request
+// on to next.
+func (c *Camera) handle(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		c.mu.Lock()
+		c.requests++
+		delay, disabled := c.delay, c.disabled[r.URL.Path]
+		c.mu.Unlock()
+
+		select {
+		case <-time.After(delay):
+		case <-r.Context().Done():
+			return
+		case <-c.closed:
+			return
+		}
+
+		if disabled {
+			http.NotFound(w, r)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// digest wraps a handler so it needs digest authentication.
+func (c *Camera) digest(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		c.mu.Lock()
+		ok, stale := c.authenticate(r)
+		c.mu.Unlock()
+
+		if !ok {
+			c.challenge(w, stale)
+			return
+		}
+		next(w, r)
+	}
+}
+
+// authenticate checks the request's digest credentials. It must be called with mu
+// held.
+func (c *Camera) authenticate(r *http.Request) (ok, stale bool) {
+	scheme, header, _ := strings.Cut(r.Header.Get("Authorization"), " ")
+	if scheme != "Digest" {
+		return false, false
+	}
+
+	params := make(map[string]string)
+	for _, p := range strings.Split(header, ",") {
+		key, value, _ := strings.Cut(strings.TrimSpace(p), "=")
+		params[key] = strings.Trim(value, `"`)
+	}
+
+	nc, known := c.nonces[params["nonce"]]
+	if !known || params["username"] != c.username || params["uri"] != r.URL.RequestURI() {
+		return false, false
+	}
+	if nc < 0 {
+		return false, true
+	}
+
+	var count int
+	if _, err := fmt.Sscanf(params["nc"], "%x", &count); err != nil || count <= nc {
+		return false, false
+	}
+
+	ha1 := md5Hex(c.username + ":" + c.realm + ":" + c.password)
+	ha2 := md5Hex(r.Method + ":" + params["uri"])
+	want := md5Hex(strings.Join([]string{ha1, params["nonce"], params["nc"], params["cnonce"], params["qop"], ha2}, ":"))
+	if params["qop"] != "auth" || params["response"] != want {
+		return false, false
+	}
+	c.nonces[params["nonce"]] = count
+	return true, false
+}
+
+// challenge sends a 401 with a new nonce.
+func (c *Camera) challenge(w http.ResponseWriter, stale bool) {
+	c.mu.Lock()
+	nonce := randomHex(16)
+	c.nonces[nonce] = 0
+	realm := c.realm
+	c.mu.Unlock()
+
+	header := fmt.Sprintf(`Digest realm=%q, nonce=%q, algorithm=MD5, qop="auth"`, realm, nonce)
+	if stale {
+		header += ", stale=true"
+	}
+	w.Header().Set("WWW-Authenticate", header)
+	http.Error(w, "Unauthorized", http.StatusUnauthorized)
+}
+
+// snapshot serves JPEG.
+func (c *Camera) snapshot(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "image/jpeg")
+	w.Write(JPEG)
+}
+
+func md5Hex(s string) string {
+	sum := md5.Sum([]byte(s))
+	return hex.EncodeToString(sum[:])
+}
+
+func randomHex(n int) string {
+	b := make([]byte, n)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
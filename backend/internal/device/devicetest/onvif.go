@@ -0,0 +1,192 @@
+package devicetest
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/chefgoldbloom/pnctool/backend/internal/device"
+)
+
+// The address the fake ONVIF camera puts in the URIs it hands out, as a camera behind
+// NAT would: clients must use the address they reached it on instead.
+const onvifInternalAddr = "http://192.0.2.10"
+
+// NewONVIFCamera starts a fake camera speaking the parts of the ONVIF device and
+// media services the ONVIF driver uses, describing itself with info. SOAP requests
+// are authenticated with a WS-Security UsernameToken; uploads and snapshots with
+// HTTP digest. The caller should call Close when finished, to shut it down.
+func NewONVIFCamera(info device.Info) *Camera {
+	return newCamera(info, func(c *Camera, mux *http.ServeMux) {
+		mux.HandleFunc("/onvif/device_service", c.onvif)
+		mux.HandleFunc("/onvif/media_service", c.onvif)
+		mux.HandleFunc("/onvif/firmware", c.digest(c.firmwareUpload))
+		mux.HandleFunc("/onvif/snapshot", c.digest(c.snapshot))
+	})
+}
+
+type usernameToken struct {
+	Username string `xml:"Username"`
+	Password string `xml:"Password"`
+	Nonce    string `xml:"Nonce"`
+	Created  string `xml:"Created"`
+}
+
+// onvif dispatches a SOAP request on the name of its body's element.
+func (c *Camera) onvif(w http.ResponseWriter, r *http.Request) {
+	var env struct {
+		Token *usernameToken `xml:"Header>Security>UsernameToken"`
+		Body  struct {
+			Content []byte `xml:",innerxml"`
+		} `xml:"Body"`
+	}
+	if r.Method != http.MethodPost || xml.NewDecoder(r.Body).Decode(&env) != nil {
+		soapFault(w, "Sender", "ter:WellFormed", "malformed request")
+		return
+	}
+
+	dec := xml.NewDecoder(bytes.NewReader(env.Body.Content))
+	var start xml.StartElement
+	for {
+		tok, err := dec.Token()
+		if err != nil {
+			soapFault(w, "Sender", "ter:WellFormed", "empty body")
+			return
+		}
+		if se, ok := tok.(xml.StartElement); ok {
+			start = se
+			break
+		}
+	}
+
+	// Only the clock can be read without credentials.
+	if start.Name.Local != "GetSystemDateAndTime" && !c.checkToken(env.Token) {
+		soapFault(w, "Sender", "ter:NotAuthorized", "Sender not Authorized")
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	switch start.Name.Local {
+	case "GetSystemDateAndTime":
+		now := time.Now().UTC()
+		soapResponse(w, fmt.Sprintf(`<tds:GetSystemDateAndTimeResponse><tds:SystemDateAndTime><tt:DateTimeType>NTP</tt:DateTimeType><tt:UTCDateTime><tt:Date><tt:Year>%d</tt:Year><tt:Month>%d</tt:Month><tt:Day>%d</tt:Day></tt:Date></tt:UTCDateTime></tds:SystemDateAndTime></tds:GetSystemDateAndTimeResponse>`,
+			now.Year(), now.Month(), now.Day()))
+	case "GetDeviceInformation":
+		soapResponse(w, fmt.Sprintf(`<tds:GetDeviceInformationResponse><tds:Manufacturer>%s</tds:Manufacturer><tds:Model>%s</tds:Model><tds:FirmwareVersion>%s</tds:FirmwareVersion><tds:SerialNumber>%s</tds:SerialNumber><tds:HardwareId>1</tds:HardwareId></tds:GetDeviceInformationResponse>`,
+			escape(c.info.Vendor), escape(c.info.Model), escape(c.info.Firmware), escape(c.info.Serial)))
+	case "GetHostname":
+		soapResponse(w, fmt.Sprintf(`<tds:GetHostnameResponse><tds:HostnameInformation><tt:FromDHCP>false</tt:FromDHCP><tt:Name>%s</tt:Name></tds:HostnameInformation></tds:GetHostnameResponse>`,
+			escape(c.params[paramHostname])))
+	case "SetHostname":
+		var req struct {
+			Name string `xml:"Name"`
+		}
+		dec.DecodeElement(&req, &start)
+		c.params[paramHostname] = req.Name
+		soapResponse(w, `<tds:SetHostnameResponse/>`)
+	case "GetNTP":
+		soapResponse(w, fmt.Sprintf(`<tds:GetNTPResponse><tds:NTPInformation><tt:FromDHCP>false</tt:FromDHCP><tt:NTPManual><tt:Type>DNS</tt:Type><tt:DNSname>%s</tt:DNSname></tt:NTPManual></tds:NTPInformation></tds:GetNTPResponse>`,
+			escape(c.params[paramNTPServer])))
+	case "SetNTP":
+		var req struct {
+			DNSname     string `xml:"NTPManual>DNSname"`
+			IPv4Address string `xml:"NTPManual>IPv4Address"`
+		}
+		dec.DecodeElement(&req, &start)
+		c.params[paramNTPServer] = req.DNSname + req.IPv4Address
+		soapResponse(w, `<tds:SetNTPResponse/>`)
+	case "SystemReboot":
+		c.reboots++
+		soapResponse(w, `<tds:SystemRebootResponse><tds:Message>Rebooting in 30 seconds</tds:Message></tds:SystemRebootResponse>`)
+	case "StartFirmwareUpgrade":
+		soapResponse(w, `<tds:StartFirmwareUpgradeResponse><tds:UploadUri>`+onvifInternalAddr+`/onvif/firmware</tds:UploadUri><tds:UploadDelay>PT2S</tds:UploadDelay><tds:ExpectedDownTime>PT120S</tds:ExpectedDownTime></tds:StartFirmwareUpgradeResponse>`)
+	case "GetProfiles":
+		soapResponse(w, `<trt:GetProfilesResponse><trt:Profiles token="profile_1" fixed="true"><tt:Name>mainStream</tt:Name></trt:Profiles></trt:GetProfilesResponse>`)
+	case "GetSnapshotUri":
+		var req struct {
+			ProfileToken string `xml:"ProfileToken"`
+		}
+		dec.DecodeElement(&req, &start)
+		if req.ProfileToken != "profile_1" {
+			soapFault(w, "Sender", "ter:InvalidArgVal", "no such profile")
+			return
+		}
+		soapResponse(w, `<trt:GetSnapshotUriResponse><trt:MediaUri><tt:Uri>`+onvifInternalAddr+`/onvif/snapshot?profile=profile_1</tt:Uri><tt:InvalidAfterConnect>false</tt:InvalidAfterConnect><tt:InvalidAfterReboot>false</tt:InvalidAfterReboot><tt:Timeout>PT0S</tt:Timeout></trt:MediaUri></trt:GetSnapshotUriResponse>`)
+	default:
+		soapFault(w, "Receiver", "ter:ActionNotSupported", "Optional Action Not Implemented")
+	}
+}
+
+// checkToken verifies a WS-Security password digest, rejecting reused nonces and
+// timestamps more than five minutes off.
+func (c *Camera) checkToken(token *usernameToken) bool {
+	if token == nil {
+		return false
+	}
+	created, err := time.Parse(time.RFC3339, token.Created)
+	if err != nil || time.Since(created).Abs() > 5*time.Minute {
+		return false
+	}
+	nonce, err := base64.StdEncoding.DecodeString(token.Nonce)
+	if err != nil {
+		return false
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	key := "wsse:" + token.Nonce
+	if _, used := c.nonces[key]; used || token.Username != c.username {
+		return false
+	}
+	h := sha1.New()
+	h.Write(nonce)
+	h.Write([]byte(token.Created))
+	h.Write([]byte(c.password))
+	if base64.StdEncoding.EncodeToString(h.Sum(nil)) != token.Password {
+		return false
+	}
+	c.nonces[key] = 0
+	return true
+}
+
+func (c *Camera) firmwareUpload(w http.ResponseWriter, r *http.Request) {
+	image, err := io.ReadAll(r.Body)
+	if r.Method != http.MethodPost || err != nil || len(image) == 0 {
+		http.Error(w, "invalid firmware", http.StatusBadRequest)
+		return
+	}
+	c.upgrade(image)
+	w.WriteHeader(http.StatusOK)
+}
+
+func escape(s string) string {
+	var b bytes.Buffer
+	xml.EscapeText(&b, []byte(s))
+	return b.String()
+}
+
+const soapHeader = `<?xml version="1.0" encoding="UTF-8"?><SOAP-ENV:Envelope xmlns:SOAP-ENV="http://www.w3.org/2003/05/soap-envelope" xmlns:tt="http://www.onvif.org/ver10/schema" xmlns:tds="http://www.onvif.org/ver10/device/wsdl" xmlns:trt="http://www.onvif.org/ver10/media/wsdl" xmlns:ter="http://www.onvif.org/ver10/error">`
+
+func soapResponse(w http.ResponseWriter, body string) {
+	w.Header().Set("Content-Type", "application/soap+xml; charset=utf-8")
+	fmt.Fprintf(w, "%s<SOAP-ENV:Body>%s</SOAP-ENV:Body></SOAP-ENV:Envelope>", soapHeader, body)
+}
+
+func soapFault(w http.ResponseWriter, code, subcode, reason string) {
+	w.Header().Set("Content-Type", "application/soap+xml; charset=utf-8")
+	status := http.StatusBadRequest
+	if code == "Receiver" {
+		status = http.StatusInternalServerError
+	}
+	w.WriteHeader(status)
+	fmt.Fprintf(w, `%s<SOAP-ENV:Body><SOAP-ENV:Fault><SOAP-ENV:Code><SOAP-ENV:Value>SOAP-ENV:%s</SOAP-ENV:Value><SOAP-ENV:Subcode><SOAP-ENV:Value>%s</SOAP-ENV:Value></SOAP-ENV:Subcode></SOAP-ENV:Code><SOAP-ENV:Reason><SOAP-ENV:Text xml:lang="en">%s</SOAP-ENV:Text></SOAP-ENV:Reason></SOAP-ENV:Fault></SOAP-ENV:Body></SOAP-ENV:Envelope>`,
+		soapHeader, code, subcode, escape(reason))
+}
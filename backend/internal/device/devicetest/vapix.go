@@ -0,0 +1,143 @@
+package devicetest
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/chefgoldbloom/pnctool/backend/internal/device"
+)
+
+// NewCamera starts a fake Axis camera speaking the parts of VAPIX the VAPIX driver
+// uses, describing itself with info. The caller should call Close when finished, to
+// shut it down.
+func NewCamera(info device.Info) *Camera {
+	return newCamera(info, func(c *Camera, mux *http.ServeMux) {
+		mux.HandleFunc("/axis-cgi/basicdeviceinfo.cgi", c.basicDeviceInfo)
+		mux.HandleFunc("/axis-cgi/param.cgi", c.digest(c.param))
+		mux.HandleFunc("/axis-cgi/restart.cgi", c.digest(c.restart))
+		mux.HandleFunc("/axis-cgi/firmwaremanagement.cgi", c.digest(c.firmwareManagement))
+		mux.HandleFunc("/axis-cgi/jpg/image.cgi", c.digest(c.snapshot))
+	})
+}
+
+// basicDeviceInfo serves getAllUnrestrictedProperties to anybody and
+// getAllProperties after authentication, as Axis cameras do.
+func (c *Camera) basicDeviceInfo(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Method string `json:"method"`
+	}
+	if r.Method != http.MethodPost || json.NewDecoder(r.Body).Decode(&req) != nil {
+		vapixError(w, 4000, "invalid request")
+		return
+	}
+
+	info := c.Info()
+	props := map[string]string{
+		"Brand":        info.Vendor,
+		"ProdNbr":      info.Model,
+		"ProdFullName": strings.TrimSpace(info.Vendor + " " + info.Model + " Network Camera"),
+		"Version":      info.Firmware,
+	}
+	switch req.Method {
+	case "getAllUnrestrictedProperties":
+		writeVAPIX(w, map[string]any{"propertyList": props})
+	case "getAllProperties":
+		c.digest(func(w http.ResponseWriter, r *http.Request) {
+			props["SerialNumber"] = info.Serial
+			writeVAPIX(w, map[string]any{"propertyList": props})
+		})(w, r)
+	default:
+		vapixError(w, 4002, "method not supported")
+	}
+}
+
+func writeVAPIX(w http.ResponseWriter, data any) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]any{"apiVersion": "1.0", "data": data})
+}
+
+func vapixError(w http.ResponseWriter, code int, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]any{"apiVersion": "1.0", "error": map[string]any{"code": code, "message": message}})
+}
+
+// param lists and updates parameters. Only parameters the camera has can be
+// updated, like on a real camera.
+func (c *Camera) param(w http.ResponseWriter, r *http.Request) {
+	qs := r.URL.Query()
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	switch qs.Get("action") {
+	case "list":
+		var lines []string
+		for _, group := range strings.Split(qs.Get("group"), ",") {
+			found := false
+			for name, value := range c.params {
+				if name == group || strings.HasPrefix(name, group+".") {
+					lines = append(lines, name+"="+value)
+					found = true
+				}
+			}
+			if !found {
+				fmt.Fprintf(w, "# Error: Error -1 getting param in group '%s'\n", group)
+				return
+			}
+		}
+		sort.Strings(lines)
+		fmt.Fprint(w, strings.Join(lines, "\n")+"\n")
+	case "update":
+		for name := range qs {
+			if _, ok := c.params[name]; name != "action" && !ok {
+				fmt.Fprintf(w, "# Error: Error setting '%s' to '%s'!\n", name, qs.Get(name))
+				return
+			}
+		}
+		for name := range qs {
+			if name != "action" {
+				c.params[name] = qs.Get(name)
+			}
+		}
+		fmt.Fprintln(w, "OK")
+	default:
+		fmt.Fprintln(w, "# Error: Invalid action")
+	}
+}
+
+func (c *Camera) restart(w http.ResponseWriter, r *http.Request) {
+	c.mu.Lock()
+	c.reboots++
+	c.mu.Unlock()
+	fmt.Fprintln(w, "Restarting.")
+}
+
+func (c *Camera) firmwareManagement(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseMultipartForm(32 << 20); err != nil {
+		vapixError(w, 1000, "invalid request")
+		return
+	}
+	var req struct {
+		Method string `json:"method"`
+	}
+	if json.Unmarshal([]byte(r.FormValue("json")), &req) != nil || req.Method != "upgrade" {
+		vapixError(w, 1001, "method not supported")
+		return
+	}
+	file, _, err := r.FormFile("file")
+	if err != nil {
+		vapixError(w, 1002, "no firmware file")
+		return
+	}
+	image, err := io.ReadAll(file)
+	if err != nil || len(image) == 0 {
+		vapixError(w, 1003, "invalid firmware file")
+		return
+	}
+
+	c.upgrade(image)
+	writeVAPIX(w, map[string]any{"firmwareVersion": c.Info().Firmware})
+}
@@ -0,0 +1,150 @@
+package device
+
+import (
+	"crypto/md5"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"strings"
+)
+
+// challenge is a digest authentication challenge from a WWW-Authenticate header, as
+// described in RFC 7616. nc counts the requests made with its nonce.
+type challenge struct {
+	realm     string
+	nonce     string
+	opaque    string
+	algorithm string
+	qop       string
+	stale     bool
+	nc        int
+}
+
+// parseChallenge parses the Digest challenge of a WWW-Authenticate header.
+func parseChallenge(header string) (*challenge, error) {
+	scheme, params, _ := strings.Cut(strings.TrimSpace(header), " ")
+	if !strings.EqualFold(scheme, "Digest") {
+		return nil, fmt.Errorf("camera asked for %q authentication, not Digest", scheme)
+	}
+
+	ch := &challenge{algorithm: "MD5"}
+	for _, p := range splitParams(params) {
+		key, value, _ := strings.Cut(p, "=")
+		value = unquote(strings.TrimSpace(value))
+		switch strings.ToLower(strings.TrimSpace(key)) {
+		case "realm":
+			ch.realm = value
+		case "nonce":
+			ch.nonce = value
+		case "opaque":
+			ch.opaque = value
+		case "algorithm":
+			ch.algorithm = strings.ToUpper(value)
+		case "qop":
+			// Only auth is supported, which every camera we've seen offers.
+			for _, q := range strings.Split(value, ",") {
+				if strings.TrimSpace(q) == "auth" {
+					ch.qop = "auth"
+				}
+			}
+		case "stale":
+			ch.stale = strings.EqualFold(value, "true")
+		}
+	}
+
+	if ch.nonce == "" {
+		return nil, errors.New("digest challenge has no nonce")
+	}
+	if ch.algorithm != "MD5" && ch.algorithm != "SHA-256" {
+		return nil, fmt.Errorf("unsupported digest algorithm %q", ch.algorithm)
+	}
+	return ch, nil
+}
+
+// splitParams splits comma-separated auth parameters, ignoring commas inside quoted
+// strings.
+func splitParams(s string) []string {
+	var (
+		params []string
+		quoted bool
+		start  int
+	)
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			i++
+		case '"':
+			quoted = !quoted
+		case ',':
+			if !quoted {
+				params = append(params, s[start:i])
+				start = i + 1
+			}
+		}
+	}
+	return append(params, s[start:])
+}
+
+func unquote(s string) string {
+	if len(s) < 2 || s[0] != '"' || s[len(s)-1] != '"' {
+		return s
+	}
+	var b strings.Builder
+	for i := 1; i < len(s)-1; i++ {
+		if s[i] == '\\' && i+1 < len(s)-1 {
+			i++
+		}
+		b.WriteByte(s[i])
+	}
+	return b.String()
+}
+
+func (ch *challenge) hash(s string) string {
+	var h hash.Hash
+	if ch.algorithm == "SHA-256" {
+		h = sha256.New()
+	} else {
+		h = md5.New()
+	}
+	h.Write([]byte(s))
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// authorize returns the Authorization header answering the challenge for a request.
+// It isn't safe for concurrent use, as it counts the nonce's uses.
+func (ch *challenge) authorize(username, password, method, uri string) string {
+	ha1 := ch.hash(username + ":" + ch.realm + ":" + password)
+	ha2 := ch.hash(method + ":" + uri)
+
+	fields := []string{
+		fmt.Sprintf("username=%q", username),
+		fmt.Sprintf("realm=%q", ch.realm),
+		fmt.Sprintf("nonce=%q", ch.nonce),
+		fmt.Sprintf("uri=%q", uri),
+		"algorithm=" + ch.algorithm,
+	}
+	if ch.qop == "" {
+		fields = append(fields, fmt.Sprintf("response=%q", ch.hash(ha1+":"+ch.nonce+":"+ha2)))
+	} else {
+		ch.nc++
+		nc := fmt.Sprintf("%08x", ch.nc)
+		cnonce := newCnonce()
+		response := ch.hash(strings.Join([]string{ha1, ch.nonce, nc, cnonce, ch.qop, ha2}, ":"))
+		fields = append(fields, "qop="+ch.qop, "nc="+nc, fmt.Sprintf("cnonce=%q", cnonce), fmt.Sprintf("response=%q", response))
+	}
+	if ch.opaque != "" {
+		fields = append(fields, fmt.Sprintf("opaque=%q", ch.opaque))
+	}
+	return "Digest " + strings.Join(fields, ", ")
+}
+
+func newCnonce() string {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,47 @@
+package device
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseChallenge(t *testing.T) {
+	ch, err := parseChallenge(`Digest realm="AXIS_ACCC8E000001", nonce="abc,def", qop="auth-int,auth", opaque="xyz", algorithm=SHA-256, stale=TRUE`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ch.realm != "AXIS_ACCC8E000001" || ch.nonce != "abc,def" || ch.qop != "auth" || ch.opaque != "xyz" || ch.algorithm != "SHA-256" || !ch.stale {
+		t.Errorf("challenge = %+v", *ch)
+	}
+
+	for _, header := range []string{
+		`Basic realm="camera"`,
+		`Digest realm="camera"`,
+		`Digest realm="camera", nonce="n", algorithm=MD5-sess`,
+	} {
+		if _, err := parseChallenge(header); err == nil {
+			t.Errorf("parseChallenge(%s) succeeded; want an error", header)
+		}
+	}
+}
+
+// The example from RFC 2617, section 3.5.
+func TestAuthorize(t *testing.T) {
+	ch := &challenge{realm: "testrealm@host.com", nonce: "dcd98b7102dd2f0e8b11d0f600bfb0c093", opaque: "5ccc069c403ebaf9f0171e9517f40e41", algorithm: "MD5"}
+
+	got := ch.authorize("Mufasa", "Circle Of Life", "GET", "/dir/index.html")
+	if !strings.Contains(got, `response="670fd8c2df070c60b045671b8b24ff02"`) {
+		t.Errorf("authorize = %s", got)
+	}
+
+	ch.qop = "auth"
+	got = ch.authorize("Mufasa", "Circle Of Life", "GET", "/dir/index.html")
+	for _, want := range []string{"qop=auth", "nc=00000001", `opaque="5ccc069c403ebaf9f0171e9517f40e41"`} {
+		if !strings.Contains(got, want) {
+			t.Errorf("authorize = %s; want %s", got, want)
+		}
+	}
+	if got = ch.authorize("Mufasa", "Circle Of Life", "GET", "/"); !strings.Contains(got, "nc=00000002") {
+		t.Errorf("second authorize = %s; want nc=00000002", got)
+	}
+}
@@ -0,0 +1,218 @@
+package device_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/chefgoldbloom/pnctool/backend/internal/device"
+	"github.com/chefgoldbloom/pnctool/backend/internal/device/devicetest"
+)
+
+// driverTests pairs each driver with its simulator.
+var driverTests = []struct {
+	name   string
+	driver func(*device.Client) device.Driver
+	camera func(device.Info) *devicetest.Camera
+	info   device.Info
+}{
+	{"vapix", func(c *device.Client) device.Driver { return device.NewVAPIX(c) }, devicetest.NewCamera,
+		device.Info{Vendor: "AXIS", Model: "P3245-LV", Serial: "ACCC8E000001", Firmware: "10.12.114", Hostname: "axis-accc8e000001"}},
+	{"onvif", func(c *device.Client) device.Driver { return device.NewONVIF(c) }, devicetest.NewONVIFCamera,
+		device.Info{Vendor: "Hanwha Vision", Model: "XNV-6080", Serial: "ZC7N70GF300012A", Firmware: "2.21.02", Hostname: "xnv-6080-lobby"}},
+}
+
+func TestDrivers(t *testing.T) {
+	ctx := context.Background()
+
+	for _, tt := range driverTests {
+		t.Run(tt.name, func(t *testing.T) {
+			camera := tt.camera(tt.info)
+			defer camera.Close()
+			d := camera.Device()
+			driver := tt.driver(device.NewClient(time.Second))
+
+			if ok, err := driver.Identify(ctx, device.Device{Addr: d.Addr}); !ok || err != nil {
+				t.Errorf("Identify = %t, %v; want true", ok, err)
+			}
+
+			info, err := driver.Info(ctx, d)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if *info != tt.info {
+				t.Errorf("Info = %+v; want %+v", *info, tt.info)
+			}
+
+			err = driver.SetConfig(ctx, d, map[string]string{device.ConfigHostname: "renamed", device.ConfigNTPServer: "10.0.0.1"})
+			if err != nil {
+				t.Fatal(err)
+			}
+			config, err := driver.Config(ctx, d, device.ConfigHostname, device.ConfigNTPServer)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if config[device.ConfigHostname] != "renamed" || config[device.ConfigNTPServer] != "10.0.0.1" {
+				t.Errorf("Config = %v", config)
+			}
+			if _, err := driver.Config(ctx, d, "serial_port"); !errors.Is(err, device.ErrUnsupported) {
+				t.Errorf("Config(serial_port): err = %v; want ErrUnsupported", err)
+			}
+
+			image, err := driver.Snapshot(ctx, d)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(image, devicetest.JPEG) {
+				t.Errorf("Snapshot = %q", image)
+			}
+
+			if err := driver.Reboot(ctx, d); err != nil {
+				t.Fatal(err)
+			}
+			if err := driver.UpgradeFirmware(ctx, d, strings.NewReader("99.1.0")); err != nil {
+				t.Fatal(err)
+			}
+			if got := camera.Info(); got.Firmware != "99.1.0" || camera.Reboots() != 2 {
+				t.Errorf("after upgrade: firmware = %q, reboots = %d; want 99.1.0 and 2", got.Firmware, camera.Reboots())
+			}
+
+			d.Password = "wrong"
+			if _, err := driver.Info(ctx, d); !errors.Is(err, device.ErrUnauthorized) {
+				t.Errorf("wrong password: err = %v; want ErrUnauthorized", err)
+			}
+		})
+	}
+}
+
+func TestDriversIdentifyOtherVendors(t *testing.T) {
+	client := device.NewClient(time.Second)
+
+	// Each driver must not claim the other's simulator.
+	for i, tt := range driverTests {
+		other := driverTests[1-i]
+		camera := other.camera(other.info)
+		defer camera.Close()
+
+		ok, err := tt.driver(client).Identify(context.Background(), device.Device{Addr: camera.URL})
+		if ok || err != nil {
+			t.Errorf("%s.Identify(%s camera) = %t, %v; want false", tt.name, other.name, ok, err)
+		}
+	}
+}
+
+func TestRegistryLookup(t *testing.T) {
+	r := device.NewRegistry(device.NewClient(time.Second))
+
+	tests := []struct {
+		mac, model string
+		want       string
+	}{
+		{"ACCC8E000001", "", "vapix"},
+		{"ac:cc:8e:00:00:01", "XNV-6080", "vapix"},
+		{"", "P3245", "vapix"},
+		{"", "AXIS Q6135-LE", "vapix"},
+		{"000918123456", "", "onvif"},
+		{"00-07-5F-12-34-56", "", "onvif"},
+		{"", "XNV-6080", "onvif"},
+		{"", "NDE-3502-AL", "onvif"},
+		{"123456000001", "XNV-6080", "onvif"},
+		{"123456000001", "", ""},
+		{"", "DS-2CD2143G2", ""},
+	}
+
+	for _, tt := range tests {
+		driver, err := r.Lookup(device.Device{MacAddress: tt.mac, ModelNo: tt.model})
+		if tt.want == "" {
+			if !errors.Is(err, device.ErrUnsupportedModel) {
+				t.Errorf("Lookup(%q, %q): err = %v; want ErrUnsupportedModel", tt.mac, tt.model, err)
+			}
+			continue
+		}
+		if err != nil || driver.Name() != tt.want {
+			t.Errorf("Lookup(%q, %q) = %v, %v; want %s", tt.mac, tt.model, driver, err, tt.want)
+		}
+	}
+}
+
+func TestRegistryProbe(t *testing.T) {
+	r := device.NewRegistry(device.NewClient(time.Second))
+
+	for _, tt := range driverTests {
+		camera := tt.camera(tt.info)
+		defer camera.Close()
+
+		driver, err := r.Probe(context.Background(), device.Device{Addr: camera.URL})
+		if err != nil || driver.Name() != tt.name {
+			t.Errorf("Probe(%s camera) = %v, %v", tt.name, driver, err)
+		}
+	}
+}
+
+func TestRegistryDispatch(t *testing.T) {
+	r := device.NewRegistry(device.NewClient(time.Second))
+
+	for _, tt := range driverTests {
+		camera := tt.camera(tt.info)
+		defer camera.Close()
+
+		// Without a model number the camera is placed by asking it.
+		d := camera.Device()
+		d.ModelNo = ""
+		info, err := r.Info(context.Background(), d)
+		if err != nil || *info != tt.info {
+			t.Errorf("Info(%s camera) = %+v, %v; want %+v", tt.name, info, err, tt.info)
+		}
+
+		if err := r.UpgradeFirmware(context.Background(), d, strings.NewReader("12.0.1")); err != nil {
+			t.Errorf("UpgradeFirmware(%s camera) = %v", tt.name, err)
+		}
+		if got := camera.Info().Firmware; got != "12.0.1" || camera.Reboots() != 1 {
+			t.Errorf("%s camera runs %s after %d reboots; want 12.0.1 after one", tt.name, got, camera.Reboots())
+		}
+	}
+}
+
+// onlyReader hides any io.Seeker, so an image can only be read once.
+type onlyReader struct {
+	io.Reader
+}
+
+func TestUpgradeFirmwareStreamed(t *testing.T) {
+	ctx := context.Background()
+
+	for _, tt := range driverTests {
+		t.Run(tt.name, func(t *testing.T) {
+			camera := tt.camera(tt.info)
+			defer camera.Close()
+			d := camera.Device()
+			driver := tt.driver(device.NewClient(time.Second))
+
+			// An image read once is sent once, authenticated up front, even when the
+			// nonce the client last had has expired.
+			for i, firmware := range []string{"99.1.0", "99.2.0"} {
+				if err := driver.UpgradeFirmware(ctx, d, onlyReader{strings.NewReader(firmware)}); err != nil {
+					t.Fatalf("upgrade %d: %v", i, err)
+				}
+				if got := camera.Info().Firmware; got != firmware {
+					t.Errorf("upgrade %d: firmware = %q; want %q", i, got, firmware)
+				}
+				camera.ExpireNonces()
+			}
+
+			// An image which can be rewound is sent with its length.
+			image := strings.NewReader("skip:99.3.0")
+			image.Seek(5, io.SeekStart)
+			if err := driver.UpgradeFirmware(ctx, d, image); err != nil {
+				t.Fatal(err)
+			}
+			if got := camera.Info().Firmware; got != "99.3.0" {
+				t.Errorf("firmware = %q; want 99.3.0", got)
+			}
+		})
+	}
+}
@@ -0,0 +1,114 @@
+package device
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+)
+
+// Registry picks the Driver for a camera. Drivers are registered once at start-up;
+// a Registry is safe for concurrent lookups but not for registering concurrently
+// with them.
+type Registry struct {
+	entries []registration
+}
+
+type registration struct {
+	driver Driver
+	ouis   []string
+	models *regexp.Regexp
+}
+
+// NewRegistry returns a Registry of the built-in drivers, sending their requests
+// through client: VAPIX for Axis cameras, and ONVIF for Hanwha and Bosch.
+func NewRegistry(client *Client) *Registry {
+	r := &Registry{}
+	r.Register(NewVAPIX(client), axisOUIs, vapixModelRxp)
+	r.Register(NewONVIF(client), append(append([]string{}, hanwhaOUIs...), boschOUIs...), onvifModelRxp)
+	return r
+}
+
+// Register adds a driver for cameras whose MAC address starts with one of ouis, given
+// as six hex digits, or whose model number matches models, which may be nil.
+func (r *Registry) Register(driver Driver, ouis []string, models *regexp.Regexp) {
+	normalized := make([]string, len(ouis))
+	for i, oui := range ouis {
+		normalized[i] = normalizeMAC(oui)
+	}
+	r.entries = append(r.entries, registration{driver: driver, ouis: normalized, models: models})
+}
+
+// normalizeMAC strips separators from a MAC address and upper-cases it.
+func normalizeMAC(mac string) string {
+	return strings.ToUpper(strings.NewReplacer(":", "", "-", "", ".", "").Replace(mac))
+}
+
+// Lookup returns the driver for d. The MAC address's OUI is tried first, since it
+// names the manufacturer unambiguously, then the model number. A camera matching
+// neither is ErrUnsupportedModel.
+func (r *Registry) Lookup(d Device) (Driver, error) {
+	if mac := normalizeMAC(d.MacAddress); len(mac) >= 6 {
+		for _, e := range r.entries {
+			for _, oui := range e.ouis {
+				if mac[:6] == oui {
+					return e.driver, nil
+				}
+			}
+		}
+	}
+	if d.ModelNo != "" {
+		for _, e := range r.entries {
+			if e.models != nil && e.models.MatchString(d.ModelNo) {
+				return e.driver, nil
+			}
+		}
+	}
+	return nil, &Error{Op: "lookup", Addr: d.Addr, Err: fmt.Errorf("%w: no driver for MAC address %q or model %q", ErrUnsupportedModel, d.MacAddress, d.ModelNo)}
+}
+
+// Probe asks the camera which driver speaks its API, for cameras Lookup can't place.
+// Drivers are asked in the order they were registered.
+func (r *Registry) Probe(ctx context.Context, d Device) (Driver, error) {
+	for _, e := range r.entries {
+		ok, err := e.driver.Identify(ctx, d)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			return e.driver, nil
+		}
+	}
+	return nil, &Error{Op: "probe", Addr: d.Addr, Err: fmt.Errorf("%w: no driver recognises the camera", ErrUnsupportedModel)}
+}
+
+// Info reads d's device information through its driver.
+func (r *Registry) Info(ctx context.Context, d Device) (*Info, error) {
+	driver, err := r.driver(ctx, d)
+	if err != nil {
+		return nil, err
+	}
+	return driver.Info(ctx, d)
+}
+
+// UpgradeFirmware uploads a firmware image to d through its driver and starts the
+// upgrade.
+func (r *Registry) UpgradeFirmware(ctx context.Context, d Device, image io.Reader) error {
+	driver, err := r.driver(ctx, d)
+	if err != nil {
+		return err
+	}
+	return driver.UpgradeFirmware(ctx, d, image)
+}
+
+// driver returns d's driver, asking the camera which driver to use if Lookup can't
+// place it.
+func (r *Registry) driver(ctx context.Context, d Device) (Driver, error) {
+	driver, err := r.Lookup(d)
+	if errors.Is(err, ErrUnsupportedModel) {
+		driver, err = r.Probe(ctx, d)
+	}
+	return driver, err
+}
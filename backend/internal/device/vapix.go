@@ -0,0 +1,282 @@
+package device
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+// Axis's OUIs, the first half of the MAC address of every camera it makes.
+var axisOUIs = []string{"ACCC8E", "00408C", "B8A44F", "E82725"}
+
+// vapixModelRxp matches the model numbers of cameras which speak VAPIX: a product
+// letter or two and four digits, like P3245 or AXIS Q6135-LE.
+var vapixModelRxp = regexp.MustCompile(`^(?i:AXIS )?[A-Z]{1,2}\d{4}`)
+
+// vapixParams maps the common settings to VAPIX parameter names.
+var vapixParams = map[string]string{
+	ConfigHostname:  "root.Network.HostName",
+	ConfigNTPServer: "root.Time.NTP.Server",
+}
+
+// VAPIX is the Driver for Axis cameras, which speak VAPIX: JSON APIs for newer
+// features and param.cgi for settings. Besides the common settings it accepts any
+// VAPIX parameter name, like root.Image.I0.Appearance.Resolution.
+type VAPIX struct {
+	client *Client
+}
+
+// NewVAPIX returns a VAPIX driver sending its requests through client.
+func NewVAPIX(client *Client) *VAPIX {
+	return &VAPIX{client: client}
+}
+
+func (v *VAPIX) Name() string {
+	return "vapix"
+}
+
+// vapixError is the error member of a VAPIX JSON response.
+type vapixError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+// call calls a VAPIX JSON API method and decodes its data member into dest. A camera
+// without the API is reported as ErrUnsupportedModel.
+func (v *VAPIX) call(ctx context.Context, d Device, op, path, method string, params any, dest any) error {
+	req := map[string]any{"apiVersion": "1.0", "method": method}
+	if params != nil {
+		req["params"] = params
+	}
+	body, err := json.Marshal(req)
+	if err != nil {
+		return &Error{Op: op, Addr: d.Addr, Err: err}
+	}
+
+	res, err := v.client.do(ctx, d, op, http.MethodPost, path, "application/json", body)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	return v.decode(d, op, path, res, dest)
+}
+
+// decode reads a VAPIX JSON API response.
+func (v *VAPIX) decode(d Device, op, path string, res *http.Response, dest any) error {
+	if res.StatusCode == http.StatusNotFound {
+		return &Error{Op: op, Addr: d.Addr, Err: fmt.Errorf("%w: %s not found", ErrUnsupportedModel, path)}
+	}
+	if res.StatusCode != http.StatusOK {
+		return &Error{Op: op, Addr: d.Addr, Err: fmt.Errorf("unexpected status %s", res.Status)}
+	}
+
+	var envelope struct {
+		Data  json.RawMessage `json:"data"`
+		Error *vapixError     `json:"error"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&envelope); err != nil {
+		return &Error{Op: op, Addr: d.Addr, Err: fmt.Errorf("decoding response: %w", err)}
+	}
+	if envelope.Error != nil {
+		return &Error{Op: op, Addr: d.Addr, Err: fmt.Errorf("camera error %d: %s", envelope.Error.Code, envelope.Error.Message)}
+	}
+	if dest == nil {
+		return nil
+	}
+	if err := json.Unmarshal(envelope.Data, dest); err != nil {
+		return &Error{Op: op, Addr: d.Addr, Err: fmt.Errorf("decoding response: %w", err)}
+	}
+	return nil
+}
+
+// cgi sends a request to a plain text CGI and returns its lines. Lines starting with
+// "# Error:" are how VAPIX reports errors.
+func (v *VAPIX) cgi(ctx context.Context, d Device, op, path string) ([]string, error) {
+	res, err := v.client.do(ctx, d, op, http.MethodGet, path, "", nil)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return nil, &Error{Op: op, Addr: d.Addr, Err: fmt.Errorf("unexpected status %s", res.Status)}
+	}
+
+	var lines []string
+	scanner := bufio.NewScanner(res.Body)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if strings.HasPrefix(line, "# Error:") {
+			return nil, &Error{Op: op, Addr: d.Addr, Err: fmt.Errorf("camera error: %s", strings.TrimSpace(line[len("# Error:"):]))}
+		}
+		lines = append(lines, line)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, &Error{Op: op, Addr: d.Addr, Err: err}
+	}
+	return lines, nil
+}
+
+// Identify asks for the properties Axis cameras give out without credentials.
+func (v *VAPIX) Identify(ctx context.Context, d Device) (bool, error) {
+	err := v.call(ctx, Device{Addr: d.Addr}, "identify", "/axis-cgi/basicdeviceinfo.cgi", "getAllUnrestrictedProperties", nil, nil)
+	if err != nil && unreachable(err) {
+		return false, err
+	}
+	return err == nil, nil
+}
+
+func (v *VAPIX) Info(ctx context.Context, d Device) (*Info, error) {
+	var props struct {
+		PropertyList struct {
+			Brand        string
+			ProdNbr      string
+			SerialNumber string
+			Version      string
+		} `json:"propertyList"`
+	}
+	err := v.call(ctx, d, "info", "/axis-cgi/basicdeviceinfo.cgi", "getAllProperties", nil, &props)
+	if err != nil {
+		return nil, err
+	}
+
+	params, err := v.params(ctx, d, "info", []string{vapixParams[ConfigHostname]})
+	if err != nil {
+		return nil, err
+	}
+
+	return &Info{
+		Vendor:   props.PropertyList.Brand,
+		Model:    props.PropertyList.ProdNbr,
+		Serial:   props.PropertyList.SerialNumber,
+		Firmware: props.PropertyList.Version,
+		Hostname: params[vapixParams[ConfigHostname]],
+	}, nil
+}
+
+func (v *VAPIX) Reboot(ctx context.Context, d Device) error {
+	_, err := v.cgi(ctx, d, "reboot", "/axis-cgi/restart.cgi")
+	return err
+}
+
+// paramName returns the VAPIX parameter for a setting.
+func (v *VAPIX) paramName(d Device, op, key string) (string, error) {
+	if name, ok := vapixParams[key]; ok {
+		return name, nil
+	}
+	if strings.HasPrefix(key, "root.") {
+		return key, nil
+	}
+	return "", &Error{Op: op, Addr: d.Addr, Err: fmt.Errorf("%w: setting %q", ErrUnsupported, key)}
+}
+
+// params reads VAPIX parameters as a map of full parameter names to values.
+func (v *VAPIX) params(ctx context.Context, d Device, op string, names []string) (map[string]string, error) {
+	lines, err := v.cgi(ctx, d, op, "/axis-cgi/param.cgi?action=list&group="+url.QueryEscape(strings.Join(names, ",")))
+	if err != nil {
+		return nil, err
+	}
+
+	params := make(map[string]string)
+	for _, line := range lines {
+		if key, value, ok := strings.Cut(line, "="); ok {
+			params[key] = value
+		}
+	}
+	return params, nil
+}
+
+func (v *VAPIX) Config(ctx context.Context, d Device, keys ...string) (map[string]string, error) {
+	names := make([]string, len(keys))
+	for i, key := range keys {
+		name, err := v.paramName(d, "config", key)
+		if err != nil {
+			return nil, err
+		}
+		names[i] = name
+	}
+
+	params, err := v.params(ctx, d, "config", names)
+	if err != nil {
+		return nil, err
+	}
+
+	config := make(map[string]string, len(keys))
+	for i, key := range keys {
+		config[key] = params[names[i]]
+	}
+	return config, nil
+}
+
+func (v *VAPIX) SetConfig(ctx context.Context, d Device, values map[string]string) error {
+	qs := url.Values{"action": {"update"}}
+	for key, value := range values {
+		name, err := v.paramName(d, "set config", key)
+		if err != nil {
+			return err
+		}
+		qs.Set(name, value)
+	}
+	_, err := v.cgi(ctx, d, "set config", "/axis-cgi/param.cgi?"+qs.Encode())
+	return err
+}
+
+// UpgradeFirmware posts the image to the firmware management API. The image is
+// streamed between the multipart form's other parts rather than read into memory.
+func (v *VAPIX) UpgradeFirmware(ctx context.Context, d Device, image io.Reader) error {
+	var head bytes.Buffer
+	mw := multipart.NewWriter(&head)
+	part, err := mw.CreateFormField("json")
+	if err == nil {
+		_, err = part.Write([]byte(`{"apiVersion":"1.0","method":"upgrade"}`))
+	}
+	if err == nil {
+		_, err = mw.CreateFormFile("file", "firmware.bin")
+	}
+	if err != nil {
+		return &Error{Op: "upgrade firmware", Addr: d.Addr, Err: err}
+	}
+	// What mw.Close would write after the file.
+	tail := "\r\n--" + mw.Boundary() + "--\r\n"
+
+	path := "/axis-cgi/firmwaremanagement.cgi"
+	res, err := v.client.upload(ctx, d, "upgrade firmware", http.MethodPost, path, mw.FormDataContentType(), head.Bytes(), image, []byte(tail))
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	return v.decode(d, "upgrade firmware", path, res, nil)
+}
+
+func (v *VAPIX) Snapshot(ctx context.Context, d Device) ([]byte, error) {
+	res, err := v.client.do(ctx, d, "snapshot", http.MethodGet, "/axis-cgi/jpg/image.cgi", "", nil)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	return readImage(d, "snapshot", res)
+}
+
+// readImage reads a JPEG response.
+func readImage(d Device, op string, res *http.Response) ([]byte, error) {
+	if res.StatusCode != http.StatusOK {
+		return nil, &Error{Op: op, Addr: d.Addr, Err: fmt.Errorf("unexpected status %s", res.Status)}
+	}
+	if mediaType, _, _ := mime.ParseMediaType(res.Header.Get("Content-Type")); mediaType != "image/jpeg" {
+		return nil, &Error{Op: op, Addr: d.Addr, Err: fmt.Errorf("unexpected content type %q", mediaType)}
+	}
+	image, err := io.ReadAll(res.Body)
+	if err != nil {
+		return nil, &Error{Op: op, Addr: d.Addr, Err: err}
+	}
+	return image, nil
+}
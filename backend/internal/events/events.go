@@ -0,0 +1,72 @@
+// Package events publishes what happens to cameras: inventory changes made through
+// the API, status changes seen by the status poller, and firmware changes seen by
+// the firmware collector.
+//
+// A Bus appends each event to the event log, which gives it its ID, and then hands
+// it to every subscriber in turn. The webhook dispatcher subscribes to queue
+// deliveries of the event.
+//
+// When several API instances share a database, an event published on one is only
+// on that instance's Bus. The log announces each event with Postgres NOTIFY, and a
+// Listener in every instance passes on the events from all of them: to a Hub, for
+// clients streaming events, and to wake the webhook dispatcher for deliveries
+// queued elsewhere.
+package events
+
+import (
+	"sync"
+
+	"github.com/chefgoldbloom/pnctool/backend/internal/data"
+)
+
+// Publisher is where events are published.
+type Publisher interface {
+	Publish(event *data.Event) error
+}
+
+// Bus is a Publisher which logs events in a data.EventRepository and passes them on
+// to its subscribers.
+type Bus struct {
+	log         data.EventRepository
+	subscribers subscribers
+}
+
+func NewBus(log data.EventRepository) *Bus {
+	return &Bus{log: log}
+}
+
+// Subscribe calls fn with every event published from now on. Subscribers are called
+// one after the other by the publisher, so they should hand off anything slow.
+func (b *Bus) Subscribe(fn func(event *data.Event)) {
+	b.subscribers.add(fn)
+}
+
+// Publish appends the event to the log and, once it's there, passes it to the
+// subscribers. Events which couldn't be logged aren't passed on.
+func (b *Bus) Publish(event *data.Event) error {
+	if err := b.log.Insert(event); err != nil {
+		return err
+	}
+	b.subscribers.publish(event)
+	return nil
+}
+
+// subscribers is a list of functions to call with each event.
+type subscribers struct {
+	mu  sync.RWMutex
+	fns []func(event *data.Event)
+}
+
+func (s *subscribers) add(fn func(event *data.Event)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.fns = append(s.fns, fn)
+}
+
+func (s *subscribers) publish(event *data.Event) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	for _, fn := range s.fns {
+		fn(event)
+	}
+}
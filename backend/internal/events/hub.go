@@ -0,0 +1,100 @@
+package events
+
+import (
+	"sync"
+
+	"github.com/chefgoldbloom/pnctool/backend/internal/data"
+)
+
+// Hub fans events out to any number of Subscriptions, such as clients streaming
+// events over HTTP. Subscribe Hub.Publish to a Listener, or a Bus, to feed it.
+//
+// Publishing never waits for a subscriber. One which falls too far behind is
+// dropped, and is expected to catch up from the event log before subscribing again.
+type Hub struct {
+	mu     sync.Mutex
+	subs   map[*Subscription]struct{}
+	closed bool
+}
+
+func NewHub() *Hub {
+	return &Hub{subs: make(map[*Subscription]struct{})}
+}
+
+// Subscription receives the events published to a Hub on C, which is closed when
+// the subscription ends: when Close is called, when the Hub is closed, or when the
+// subscriber is dropped for falling behind, in which case Lagged reports true.
+type Subscription struct {
+	C <-chan *data.Event
+
+	hub    *Hub
+	c      chan *data.Event
+	lagged bool
+}
+
+// Subscribe returns a subscription to every event published from now on, buffering
+// up to buffer events. It returns a closed subscription if the Hub has been closed.
+func (h *Hub) Subscribe(buffer int) *Subscription {
+	c := make(chan *data.Event, buffer)
+	s := &Subscription{C: c, hub: h, c: c}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.closed {
+		close(c)
+	} else {
+		h.subs[s] = struct{}{}
+	}
+	return s
+}
+
+// Publish hands the event to every subscription, dropping any whose buffer is full.
+func (h *Hub) Publish(event *data.Event) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for s := range h.subs {
+		select {
+		case s.c <- event:
+		default:
+			s.lagged = true
+			h.remove(s)
+		}
+	}
+}
+
+// Close ends every subscription, and any made later. It's called on shutdown so
+// that long-lived streams finish.
+func (h *Hub) Close() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.closed = true
+	for s := range h.subs {
+		h.remove(s)
+	}
+}
+
+// Close ends the subscription. It's safe to call more than once.
+func (s *Subscription) Close() {
+	s.hub.mu.Lock()
+	defer s.hub.mu.Unlock()
+	s.hub.remove(s)
+}
+
+// Lagged reports whether the subscription was dropped for falling behind, rather
+// than closed. It's only meaningful once C has been closed.
+func (s *Subscription) Lagged() bool {
+	s.hub.mu.Lock()
+	defer s.hub.mu.Unlock()
+	return s.lagged
+}
+
+// remove closes the subscription's channel if it's still subscribed. The caller
+// holds h.mu.
+func (h *Hub) remove(s *Subscription) {
+	if _, ok := h.subs[s]; ok {
+		delete(h.subs, s)
+		close(s.c)
+	}
+}
@@ -0,0 +1,49 @@
+package events
+
+import (
+	"testing"
+
+	"github.com/chefgoldbloom/pnctool/backend/internal/data"
+)
+
+func TestHub(t *testing.T) {
+	hub := NewHub()
+	fast := hub.Subscribe(10)
+	slow := hub.Subscribe(1)
+
+	for id := int64(1); id <= 3; id++ {
+		hub.Publish(&data.Event{ID: id})
+	}
+
+	// The slow subscriber is dropped once its buffer is full, keeping what it had.
+	if event := <-slow.C; event.ID != 1 {
+		t.Errorf("slow subscriber got event %d; want 1", event.ID)
+	}
+	if _, ok := <-slow.C; ok || !slow.Lagged() {
+		t.Errorf("slow subscriber wasn't dropped for lagging")
+	}
+	for id := int64(1); id <= 3; id++ {
+		if event := <-fast.C; event.ID != id {
+			t.Errorf("fast subscriber got event %d; want %d", event.ID, id)
+		}
+	}
+
+	// Closing a subscription stops its events; closing it again is harmless.
+	fast.Close()
+	fast.Close()
+	hub.Publish(&data.Event{ID: 4})
+	if _, ok := <-fast.C; ok || fast.Lagged() {
+		t.Error("closed subscription got an event or was marked as lagging")
+	}
+
+	// Closing the hub ends every subscription, including later ones.
+	open := hub.Subscribe(10)
+	hub.Close()
+	if _, ok := <-open.C; ok || open.Lagged() {
+		t.Error("subscription is still open after the hub was closed")
+	}
+	if _, ok := <-hub.Subscribe(10).C; ok {
+		t.Error("subscription made after the hub was closed is open")
+	}
+	hub.Publish(&data.Event{ID: 5})
+}
@@ -0,0 +1,167 @@
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"time"
+
+	"github.com/chefgoldbloom/pnctool/backend/internal/data"
+	"github.com/lib/pq"
+)
+
+const (
+	// Reconnection attempts start minReconnect apart, doubling up to maxReconnect.
+	minReconnect = time.Second
+	maxReconnect = time.Minute
+	// pingInterval is how often the connection is checked, since a quiet one can't
+	// otherwise be told from a dead one.
+	pingInterval = 90 * time.Second
+	// catchUpPage is how many events are read from the log at a time when catching
+	// up after a reconnect.
+	catchUpPage = 100
+)
+
+// Listener passes on the events announced on data.EventChannel by the events table's
+// trigger, whichever instance published them. The trigger sends events too big for
+// a notification as just their IDs, and the Listener fetches them from the log.
+//
+// Notifications sent while the Listener is disconnected are lost, so once it has
+// reconnected it reads the events it missed from the log.
+type Listener struct {
+	dsn         string
+	log         data.EventRepository
+	logger      *slog.Logger
+	subscribers subscribers
+
+	// lastID is the newest event passed on, or -1 until the Listener knows where the
+	// log ends. It's only used by the goroutine running Run.
+	lastID int64
+}
+
+func NewListener(dsn string, log data.EventRepository, logger *slog.Logger) *Listener {
+	return &Listener{dsn: dsn, log: log, logger: logger, lastID: -1}
+}
+
+// Subscribe calls fn with every event announced from now on. Subscribers are called
+// one after the other, so they should hand off anything slow.
+func (l *Listener) Subscribe(fn func(event *data.Event)) {
+	l.subscribers.add(fn)
+}
+
+// Run listens for events until ctx is cancelled, reconnecting whenever the
+// connection is lost.
+func (l *Listener) Run(ctx context.Context) {
+	pl := pq.NewListener(l.dsn, minReconnect, maxReconnect, l.connectionChanged)
+	defer pl.Close()
+
+	// Listen waits for a connection, however long that takes, so closing the
+	// listener is the only way to stop it.
+	stop := context.AfterFunc(ctx, func() { pl.Close() })
+	defer stop()
+
+	if err := pl.Listen(data.EventChannel); err != nil {
+		if ctx.Err() == nil {
+			l.logger.Error("listening for events", "error", err)
+		}
+		return
+	}
+
+	l.start()
+	l.receive(ctx, pl.Notify, func() { go pl.Ping() })
+}
+
+// start records where the log ends. Every event after it is announced, so after a
+// reconnect the Listener knows where to catch up from.
+func (l *Listener) start() {
+	id, err := l.log.LastID()
+	if err != nil {
+		l.logger.Error("reading the event log", "error", err)
+		return
+	}
+	l.lastID = id
+}
+
+// receive passes on the events announced on notifications until it's closed or ctx
+// is cancelled, calling ping every pingInterval.
+func (l *Listener) receive(ctx context.Context, notifications <-chan *pq.Notification, ping func()) {
+	ticker := time.NewTicker(pingInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case n, ok := <-notifications:
+			if !ok {
+				return
+			}
+			// A nil notification means the connection was lost and has come back.
+			if n == nil {
+				l.catchUp()
+				continue
+			}
+			l.handle(n.Extra)
+		case <-ticker.C:
+			ping()
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// handle passes on the event in a notification's payload, fetching it from the log
+// if the payload only has its ID.
+func (l *Listener) handle(payload string) {
+	var event data.Event
+	if err := json.Unmarshal([]byte(payload), &event); err != nil {
+		l.logger.Error("decoding event notification", "payload", payload, "error", err)
+		return
+	}
+
+	if event.Type == "" {
+		logged, err := l.log.Get(event.ID)
+		if err != nil {
+			l.logger.Error("fetching announced event", "event_id", event.ID, "error", err)
+			return
+		}
+		event = *logged
+	}
+	l.pass(&event)
+}
+
+// catchUp passes on the events logged after the newest one passed on.
+func (l *Listener) catchUp() {
+	if l.lastID < 0 {
+		l.start()
+		return
+	}
+
+	for {
+		events, err := l.log.After(l.lastID, data.EventFilter{}, catchUpPage)
+		if err != nil {
+			l.logger.Error("catching up on the event log", "after_id", l.lastID, "error", err)
+			return
+		}
+		for _, event := range events {
+			l.pass(event)
+		}
+		if len(events) < catchUpPage {
+			return
+		}
+	}
+}
+
+func (l *Listener) pass(event *data.Event) {
+	l.lastID = max(l.lastID, event.ID)
+	l.subscribers.publish(event)
+}
+
+func (l *Listener) connectionChanged(event pq.ListenerEventType, err error) {
+	switch event {
+	case pq.ListenerEventDisconnected:
+		l.logger.Error("lost connection listening for events", "error", err)
+	case pq.ListenerEventConnectionAttemptFailed:
+		l.logger.Error("reconnecting to listen for events", "error", err)
+	case pq.ListenerEventReconnected:
+		l.logger.Info("reconnected to listen for events")
+	}
+}
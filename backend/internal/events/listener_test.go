@@ -0,0 +1,91 @@
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"testing"
+	"time"
+
+	"github.com/chefgoldbloom/pnctool/backend/internal/data"
+	"github.com/lib/pq"
+)
+
+func TestListener(t *testing.T) {
+	log := data.NewMemoryEventModel()
+	logEvent := func(eventType string) *data.Event {
+		t.Helper()
+		event := &data.Event{Type: eventType, CameraID: 1, SiteName: "NYC-5th-OPS", OccurredAt: time.Date(2026, 3, 2, 9, 0, 0, 0, time.UTC)}
+		if err := log.Insert(event); err != nil {
+			t.Fatal(err)
+		}
+		return event
+	}
+	notification := func(payload any) *pq.Notification {
+		t.Helper()
+		js, err := json.Marshal(payload)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return &pq.Notification{Channel: data.EventChannel, Extra: string(js)}
+	}
+
+	// Events logged before the listener starts aren't passed on.
+	logEvent(data.EventCameraCreated)
+	logEvent(data.EventCameraUpdated)
+
+	l := NewListener("", log, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	received := make(chan *data.Event, 10)
+	l.Subscribe(func(event *data.Event) { received <- event })
+	l.start()
+
+	notifications := make(chan *pq.Notification)
+	done := make(chan struct{})
+	go func() {
+		l.receive(context.Background(), notifications, func() {})
+		close(done)
+	}()
+
+	expect := func(ids ...int64) {
+		t.Helper()
+		for _, id := range ids {
+			select {
+			case event := <-received:
+				if event.ID != id || event.Type == "" || event.SiteName != "NYC-5th-OPS" {
+					t.Errorf("received %+v; want event %d", event, id)
+				}
+			case <-time.After(time.Second):
+				t.Fatalf("event %d wasn't passed on", id)
+			}
+		}
+	}
+
+	// An event announced in full.
+	notifications <- notification(logEvent(data.EventCameraOffline))
+	expect(3)
+
+	// One announced by ID only is fetched from the log.
+	big := logEvent(data.EventCameraUpdated)
+	notifications <- notification(map[string]int64{"id": big.ID})
+	expect(4)
+
+	// Events announced while the connection was down are read from the log once it
+	// comes back.
+	logEvent(data.EventCameraOnline)
+	logEvent(data.EventCameraDeleted)
+	notifications <- nil
+	expect(5, 6)
+
+	// Notifications which can't be used are skipped.
+	notifications <- &pq.Notification{Channel: data.EventChannel, Extra: "{"}
+	notifications <- notification(map[string]int64{"id": 99})
+	notifications <- notification(logEvent(data.EventCameraOffline))
+	expect(7)
+
+	close(notifications)
+	<-done
+	if len(received) != 0 {
+		t.Errorf("%d events were passed on twice", len(received))
+	}
+}
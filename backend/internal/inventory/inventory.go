@@ -0,0 +1,198 @@
+// Package inventory collects the firmware cameras run.
+//
+// A Collector asks every camera with an address for its device information once per
+// interval, a few at a time, and records the firmware it reports. Each change of
+// firmware is kept in the camera's history, and published as an event when the
+// camera had reported different firmware before. Firmware changes rarely, so
+// cameras are asked far less often than the status poller checks them, and a camera
+// which doesn't answer is simply asked again next time.
+package inventory
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/chefgoldbloom/pnctool/backend/internal/data"
+	"github.com/chefgoldbloom/pnctool/backend/internal/device"
+	"github.com/chefgoldbloom/pnctool/backend/internal/events"
+)
+
+// A Reader reads a camera's device information. device.Registry is one, going
+// through the camera's driver.
+type Reader interface {
+	Info(ctx context.Context, d device.Device) (*device.Info, error)
+}
+
+// Config controls how often and how many cameras a Collector asks. Zero values are
+// replaced by the defaults of DefaultConfig.
+type Config struct {
+	Interval    time.Duration // between collections
+	Timeout     time.Duration // for asking one camera
+	Concurrency int           // cameras asked at once
+}
+
+// DefaultConfig asks each camera every six hours, four at a time.
+var DefaultConfig = Config{
+	Interval:    6 * time.Hour,
+	Timeout:     10 * time.Second,
+	Concurrency: 4,
+}
+
+// Collector records the firmware of the cameras in a data.StatusRepository's targets.
+type Collector struct {
+	cfg     Config
+	targets data.StatusRepository
+	store   data.FirmwareRepository
+	events  events.Publisher
+	reader  Reader
+	logger  *slog.Logger
+
+	// now is replaced in tests.
+	now func() time.Time
+}
+
+// New returns a Collector which asks the cameras in targets with reader and records
+// their firmware in store. If publisher is nil no events are published.
+func New(targets data.StatusRepository, store data.FirmwareRepository, publisher events.Publisher, reader Reader, logger *slog.Logger, cfg Config) *Collector {
+	if cfg.Interval <= 0 {
+		cfg.Interval = DefaultConfig.Interval
+	}
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = DefaultConfig.Timeout
+	}
+	if cfg.Concurrency <= 0 {
+		cfg.Concurrency = DefaultConfig.Concurrency
+	}
+
+	return &Collector{
+		cfg:     cfg,
+		targets: targets,
+		store:   store,
+		events:  publisher,
+		reader:  reader,
+		logger:  logger,
+		now:     time.Now,
+	}
+}
+
+// Run collects firmware straight away and then once per interval until ctx is
+// cancelled. It returns once the cameras being asked have answered or given up.
+func (c *Collector) Run(ctx context.Context) {
+	ticker := time.NewTicker(c.cfg.Interval)
+	defer ticker.Stop()
+
+	for {
+		n, err := c.Collect(ctx)
+		switch {
+		case ctx.Err() != nil:
+		case err != nil:
+			c.logger.Error("collecting firmware", "error", err)
+		default:
+			c.logger.Info("firmware collected", "cameras", n)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Collect asks every camera for its firmware, waiting for them to answer, and
+// returns how many cameras' firmware was recorded.
+func (c *Collector) Collect(ctx context.Context) (int, error) {
+	cameras, err := c.targets.Targets()
+	if err != nil {
+		return 0, err
+	}
+
+	var (
+		mu       sync.Mutex
+		recorded int
+		wg       sync.WaitGroup
+	)
+	sem := make(chan struct{}, c.cfg.Concurrency)
+	for _, camera := range cameras {
+		select {
+		case sem <- struct{}{}:
+		case <-ctx.Done():
+			wg.Wait()
+			return recorded, ctx.Err()
+		}
+		wg.Add(1)
+		go func(camera *data.Camera) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+			if c.collect(ctx, camera) {
+				mu.Lock()
+				recorded++
+				mu.Unlock()
+			}
+		}(camera)
+	}
+	wg.Wait()
+	return recorded, nil
+}
+
+// collect asks one camera for its firmware and records it, reporting whether it did.
+func (c *Collector) collect(ctx context.Context, camera *data.Camera) bool {
+	d := device.Device{
+		Addr:       camera.Address,
+		Username:   camera.Username,
+		Password:   camera.Password,
+		ModelNo:    camera.ModelNo,
+		MacAddress: camera.MacAddress,
+	}
+
+	readCtx, cancel := context.WithTimeout(ctx, c.cfg.Timeout)
+	info, err := c.reader.Info(readCtx, d)
+	cancel()
+	if ctx.Err() != nil {
+		return false
+	}
+	if err != nil {
+		// Whether the camera is up is the status poller's business, so this is only
+		// worth a warning.
+		c.logger.Warn("reading camera firmware", "camera_id", camera.ID, "error", err)
+		return false
+	}
+	if info.Firmware == "" {
+		return false
+	}
+
+	at := c.now()
+	previous, err := c.store.Record(camera.ID, &data.CameraFirmware{Model: info.Model, Firmware: info.Firmware, CollectedAt: at})
+	switch {
+	case errors.Is(err, data.ErrRecordNotFound):
+		return false
+	case err != nil:
+		c.logger.Error("recording camera firmware", "camera_id", camera.ID, "error", err)
+		return false
+	}
+
+	if previous != "" && previous != info.Firmware {
+		c.publish(camera, info, previous, at)
+	}
+	return true
+}
+
+// publish sends camera.firmware_changed, logging any failure.
+func (c *Collector) publish(camera *data.Camera, info *device.Info, previous string, at time.Time) {
+	if c.events == nil {
+		return
+	}
+	event, err := data.NewEvent(data.EventCameraFirmwareChanged, camera, map[string]string{
+		"name": camera.Name, "model": info.Model, "firmware": info.Firmware, "previous_firmware": previous,
+	}, at)
+	if err == nil {
+		err = c.events.Publish(event)
+	}
+	if err != nil {
+		c.logger.Error("publishing event", "type", data.EventCameraFirmwareChanged, "camera_id", camera.ID, "error", err)
+	}
+}
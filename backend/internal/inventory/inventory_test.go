@@ -0,0 +1,102 @@
+package inventory
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/chefgoldbloom/pnctool/backend/internal/data"
+	"github.com/chefgoldbloom/pnctool/backend/internal/device"
+	"github.com/chefgoldbloom/pnctool/backend/internal/device/devicetest"
+)
+
+// fakePublisher collects published events.
+type fakePublisher struct {
+	mu     sync.Mutex
+	events []*data.Event
+}
+
+func (f *fakePublisher) Publish(event *data.Event) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.events = append(f.events, event)
+	return nil
+}
+
+func TestCollector(t *testing.T) {
+	axis := devicetest.NewCamera(device.Info{Vendor: "AXIS", Model: "P3245-LV", Serial: "ACCC8E000001", Firmware: "10.9.2", Hostname: "lobby"})
+	defer axis.Close()
+	hanwha := devicetest.NewONVIFCamera(device.Info{Vendor: "Hanwha Vision", Model: "XNV-6080", Serial: "ZC7N70GF300012A", Firmware: "2.21.02", Hostname: "gate"})
+	defer hanwha.Close()
+	gone := devicetest.NewCamera(device.Info{Vendor: "AXIS", Model: "P3245-LV", Firmware: "10.9.2"})
+	gone.Close()
+
+	cameras := data.NewMemoryCameraModel()
+	for _, c := range []*data.Camera{
+		{Name: "lobby", MacAddress: "ACCC8E000001", SiteName: "NYC-5th-GLH", ModelNo: "P3245-LV", Address: axis.URL},
+		// Placed by asking it, since neither its MAC address nor model is known.
+		{Name: "gate", MacAddress: "000000000002", SiteName: "NYC-5th-GLH", Address: hanwha.URL},
+		{Name: "dock", MacAddress: "ACCC8E000003", SiteName: "NYC-5th-GLH", ModelNo: "P3245-LV", Address: gone.URL},
+		{Name: "roof", MacAddress: "ACCC8E000004", SiteName: "NYC-5th-GLH", ModelNo: "P3245-LV"},
+	} {
+		if err := cameras.Insert(c); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	drivers := device.NewRegistry(device.NewClient(time.Second))
+	firmware := data.NewMemoryFirmwareModel(cameras)
+	publisher := &fakePublisher{}
+	c := New(cameras, firmware, publisher, drivers, slog.New(slog.NewTextHandler(io.Discard, nil)), Config{Timeout: time.Second})
+
+	if n, err := c.Collect(context.Background()); n != 2 || err != nil {
+		t.Fatalf("Collect = %d, %v; want the two cameras which answered", n, err)
+	}
+	for id, want := range map[int64]string{1: "10.9.2", 2: "2.21.02"} {
+		if got, err := firmware.Get(id); err != nil || got.Firmware != want {
+			t.Errorf("camera %d firmware = %+v, %v; want %s", id, got, err, want)
+		}
+	}
+	if _, err := firmware.Get(3); err == nil {
+		t.Error("firmware recorded for the camera which didn't answer")
+	}
+	if len(publisher.events) != 0 {
+		t.Errorf("first collection published %d events; want none", len(publisher.events))
+	}
+
+	driver, err := drivers.Lookup(axis.Device())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := driver.UpgradeFirmware(context.Background(), axis.Device(), strings.NewReader("11.1.66")); err != nil {
+		t.Fatal(err)
+	}
+
+	if n, err := c.Collect(context.Background()); n != 2 || err != nil {
+		t.Fatalf("second Collect = %d, %v", n, err)
+	}
+	if len(publisher.events) != 1 {
+		t.Fatalf("upgrade published %d events; want one", len(publisher.events))
+	}
+	event := publisher.events[0]
+	var payload map[string]string
+	if err := json.Unmarshal(event.Data, &payload); err != nil {
+		t.Fatal(err)
+	}
+	if event.Type != data.EventCameraFirmwareChanged || event.CameraID != 1 || payload["firmware"] != "11.1.66" || payload["previous_firmware"] != "10.9.2" {
+		t.Errorf("event = %+v with %v", event, payload)
+	}
+
+	changes, _ := firmware.History(1)
+	if len(changes) != 2 || changes[1].Firmware != "11.1.66" {
+		t.Errorf("camera 1 history = %+v; want the upgrade", changes)
+	}
+	if changes, _ := firmware.History(2); len(changes) != 1 {
+		t.Errorf("camera 2 history = %+v; want only the first firmware", changes)
+	}
+}
@@ -0,0 +1,465 @@
+// Package jsonpatch applies JSON Merge Patch (RFC 7396) and JSON Patch (RFC 6902)
+// documents to JSON values.
+package jsonpatch
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+var (
+	// ErrInvalidPatch is matched by errors for malformed patch documents, bad paths
+	// and operations on locations which don't exist.
+	ErrInvalidPatch = errors.New("invalid patch")
+
+	// ErrTestFailed is matched by the error returned when a "test" operation's value
+	// doesn't equal the target location.
+	ErrTestFailed = errors.New("patch test failed")
+)
+
+// Error describes the JSON Patch operation which could not be applied.
+type Error struct {
+	Index int    // zero-based position of the operation in the patch
+	Op    string // operation name
+	Path  string // the operation's path
+	Msg   string
+	kind  error
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("operation %d (%s %s): %s", e.Index, e.Op, e.Path, e.Msg)
+}
+
+func (e *Error) Unwrap() error {
+	return e.kind
+}
+
+// MergePatch applies an RFC 7396 merge patch to doc and returns the result. Members of
+// a patch object replace the matching members of doc, and null members remove them.
+// A patch which is not an object replaces doc entirely.
+func MergePatch(doc, patch []byte) ([]byte, error) {
+	target, err := decode(doc)
+	if err != nil {
+		return nil, err
+	}
+	p, err := decode(patch)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidPatch, err)
+	}
+	return json.Marshal(mergePatch(target, p))
+}
+
+func mergePatch(target, patch any) any {
+	p, ok := patch.(map[string]any)
+	if !ok {
+		return patch
+	}
+	t, ok := target.(map[string]any)
+	if !ok {
+		t = map[string]any{}
+	}
+	for k, v := range p {
+		if v == nil {
+			delete(t, k)
+		} else {
+			t[k] = mergePatch(t[k], v)
+		}
+	}
+	return t
+}
+
+// operation is one entry of an RFC 6902 patch. Value is kept raw so a missing value
+// can be told apart from an explicit null.
+type operation struct {
+	Op    string          `json:"op"`
+	Path  *string         `json:"path"`
+	From  *string         `json:"from"`
+	Value json.RawMessage `json:"value"`
+}
+
+// Apply applies an RFC 6902 JSON Patch to doc and returns the result. Operations are
+// applied in order and the whole patch fails if any operation fails, including a
+// "test" which doesn't match; the error then matches ErrTestFailed.
+func Apply(doc, patch []byte) ([]byte, error) {
+	target, err := decode(doc)
+	if err != nil {
+		return nil, err
+	}
+
+	// Members an operation doesn't define are ignored, as RFC 6902 section 4 requires.
+	var ops []operation
+	if err := json.Unmarshal(patch, &ops); err != nil {
+		return nil, fmt.Errorf("%w: patch must be an array of operations: %v", ErrInvalidPatch, err)
+	}
+
+	for i, op := range ops {
+		target, err = applyOp(target, op)
+		if err != nil {
+			var e *Error
+			if errors.As(err, &e) {
+				e.Index = i
+			}
+			return nil, err
+		}
+	}
+	return json.Marshal(target)
+}
+
+func applyOp(doc any, op operation) (any, error) {
+	fail := func(kind error, format string, args ...any) error {
+		path := ""
+		if op.Path != nil {
+			path = *op.Path
+		}
+		return &Error{Op: op.Op, Path: path, Msg: fmt.Sprintf(format, args...), kind: kind}
+	}
+
+	if op.Path == nil {
+		return nil, fail(ErrInvalidPatch, `missing "path"`)
+	}
+	path, err := parsePointer(*op.Path)
+	if err != nil {
+		return nil, fail(ErrInvalidPatch, "%v", err)
+	}
+
+	value := func() (any, error) {
+		if op.Value == nil {
+			return nil, fail(ErrInvalidPatch, `missing "value"`)
+		}
+		v, err := decode(op.Value)
+		if err != nil {
+			return nil, fail(ErrInvalidPatch, "%v", err)
+		}
+		return v, nil
+	}
+	from := func() ([]string, error) {
+		if op.From == nil {
+			return nil, fail(ErrInvalidPatch, `missing "from"`)
+		}
+		f, err := parsePointer(*op.From)
+		if err != nil {
+			return nil, fail(ErrInvalidPatch, "%v", err)
+		}
+		return f, nil
+	}
+
+	switch op.Op {
+	case "add":
+		v, err := value()
+		if err != nil {
+			return nil, err
+		}
+		doc, err = add(doc, path, v)
+		if err != nil {
+			return nil, fail(ErrInvalidPatch, "%v", err)
+		}
+		return doc, nil
+
+	case "remove":
+		doc, _, err = remove(doc, path)
+		if err != nil {
+			return nil, fail(ErrInvalidPatch, "%v", err)
+		}
+		return doc, nil
+
+	case "replace":
+		v, err := value()
+		if err != nil {
+			return nil, err
+		}
+		doc, _, err = remove(doc, path)
+		if err == nil {
+			doc, err = add(doc, path, v)
+		}
+		if err != nil {
+			return nil, fail(ErrInvalidPatch, "%v", err)
+		}
+		return doc, nil
+
+	case "move":
+		f, err := from()
+		if err != nil {
+			return nil, err
+		}
+		if isPrefix(f, path) && len(f) < len(path) {
+			return nil, fail(ErrInvalidPatch, "cannot move a value into one of its children")
+		}
+		var v any
+		doc, v, err = remove(doc, f)
+		if err == nil {
+			doc, err = add(doc, path, v)
+		}
+		if err != nil {
+			return nil, fail(ErrInvalidPatch, "%v", err)
+		}
+		return doc, nil
+
+	case "copy":
+		f, err := from()
+		if err != nil {
+			return nil, err
+		}
+		v, err := get(doc, f)
+		if err == nil {
+			doc, err = add(doc, path, deepCopy(v))
+		}
+		if err != nil {
+			return nil, fail(ErrInvalidPatch, "%v", err)
+		}
+		return doc, nil
+
+	case "test":
+		v, err := value()
+		if err != nil {
+			return nil, err
+		}
+		current, err := get(doc, path)
+		if err != nil {
+			return nil, fail(ErrTestFailed, "%v", err)
+		}
+		if !equal(current, v) {
+			return nil, fail(ErrTestFailed, "value does not match")
+		}
+		return doc, nil
+
+	default:
+		return nil, fail(ErrInvalidPatch, "unknown operation %q", op.Op)
+	}
+}
+
+// decode unmarshals a JSON value, keeping numbers as json.Number so large integers
+// such as ids survive the round trip unchanged.
+func decode(b []byte) (any, error) {
+	dec := json.NewDecoder(bytes.NewReader(b))
+	dec.UseNumber()
+	var v any
+	if err := dec.Decode(&v); err != nil {
+		return nil, err
+	}
+	if dec.More() {
+		return nil, errors.New("unexpected data after JSON value")
+	}
+	return v, nil
+}
+
+// parsePointer splits an RFC 6901 JSON Pointer into unescaped reference tokens.
+func parsePointer(p string) ([]string, error) {
+	if p == "" {
+		return nil, nil
+	}
+	if !strings.HasPrefix(p, "/") {
+		return nil, fmt.Errorf("pointer %q must start with /", p)
+	}
+	tokens := strings.Split(p[1:], "/")
+	for i, t := range tokens {
+		tokens[i] = strings.NewReplacer("~1", "/", "~0", "~").Replace(t)
+	}
+	return tokens, nil
+}
+
+func isPrefix(prefix, path []string) bool {
+	if len(prefix) > len(path) {
+		return false
+	}
+	for i := range prefix {
+		if prefix[i] != path[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// arrayIndex parses an array reference token. "-" (one past the end) is only valid
+// when allowEnd is set, for "add".
+func arrayIndex(token string, length int, allowEnd bool) (int, error) {
+	if token == "-" && allowEnd {
+		return length, nil
+	}
+	if token == "" || (len(token) > 1 && token[0] == '0') {
+		return 0, fmt.Errorf("invalid array index %q", token)
+	}
+	i, err := strconv.Atoi(token)
+	if err != nil || i < 0 {
+		return 0, fmt.Errorf("invalid array index %q", token)
+	}
+	max := length - 1
+	if allowEnd {
+		max = length
+	}
+	if i > max {
+		return 0, fmt.Errorf("array index %d out of range", i)
+	}
+	return i, nil
+}
+
+func get(doc any, path []string) (any, error) {
+	for _, token := range path {
+		switch node := doc.(type) {
+		case map[string]any:
+			v, ok := node[token]
+			if !ok {
+				return nil, fmt.Errorf("member %q does not exist", token)
+			}
+			doc = v
+		case []any:
+			i, err := arrayIndex(token, len(node), false)
+			if err != nil {
+				return nil, err
+			}
+			doc = node[i]
+		default:
+			return nil, fmt.Errorf("cannot index into a scalar with %q", token)
+		}
+	}
+	return doc, nil
+}
+
+// add sets the value at path, inserting into arrays, and returns the (possibly new)
+// root document.
+func add(doc any, path []string, value any) (any, error) {
+	if len(path) == 0 {
+		return value, nil
+	}
+	parent, err := get(doc, path[:len(path)-1])
+	if err != nil {
+		return nil, err
+	}
+	last := path[len(path)-1]
+
+	switch node := parent.(type) {
+	case map[string]any:
+		node[last] = value
+		return doc, nil
+	case []any:
+		i, err := arrayIndex(last, len(node), true)
+		if err != nil {
+			return nil, err
+		}
+		node = append(node, nil)
+		copy(node[i+1:], node[i:])
+		node[i] = value
+		return replaceParent(doc, path[:len(path)-1], node)
+	default:
+		return nil, fmt.Errorf("cannot add to a scalar")
+	}
+}
+
+// remove deletes the value at path and returns the new root and the removed value.
+func remove(doc any, path []string) (any, any, error) {
+	if len(path) == 0 {
+		return nil, doc, nil
+	}
+	parent, err := get(doc, path[:len(path)-1])
+	if err != nil {
+		return nil, nil, err
+	}
+	last := path[len(path)-1]
+
+	switch node := parent.(type) {
+	case map[string]any:
+		v, ok := node[last]
+		if !ok {
+			return nil, nil, fmt.Errorf("member %q does not exist", last)
+		}
+		delete(node, last)
+		return doc, v, nil
+	case []any:
+		i, err := arrayIndex(last, len(node), false)
+		if err != nil {
+			return nil, nil, err
+		}
+		v := node[i]
+		node = append(node[:i:i], node[i+1:]...)
+		doc, err = replaceParent(doc, path[:len(path)-1], node)
+		return doc, v, err
+	default:
+		return nil, nil, fmt.Errorf("cannot remove from a scalar")
+	}
+}
+
+// replaceParent stores a resized array back at path, since appending to or shrinking
+// a slice may not be visible through the parent's copy of the slice header.
+func replaceParent(doc any, path []string, arr []any) (any, error) {
+	if len(path) == 0 {
+		return arr, nil
+	}
+	grandparent, err := get(doc, path[:len(path)-1])
+	if err != nil {
+		return nil, err
+	}
+	last := path[len(path)-1]
+	switch node := grandparent.(type) {
+	case map[string]any:
+		node[last] = arr
+	case []any:
+		i, _ := arrayIndex(last, len(node), false)
+		node[i] = arr
+	}
+	return doc, nil
+}
+
+func deepCopy(v any) any {
+	switch node := v.(type) {
+	case map[string]any:
+		m := make(map[string]any, len(node))
+		for k, v := range node {
+			m[k] = deepCopy(v)
+		}
+		return m
+	case []any:
+		a := make([]any, len(node))
+		for i, v := range node {
+			a[i] = deepCopy(v)
+		}
+		return a
+	default:
+		return v
+	}
+}
+
+// equal compares two decoded JSON values as RFC 6902 "test" requires: numbers by
+// value, objects regardless of member order.
+func equal(a, b any) bool {
+	switch x := a.(type) {
+	case map[string]any:
+		y, ok := b.(map[string]any)
+		if !ok || len(x) != len(y) {
+			return false
+		}
+		for k, v := range x {
+			w, ok := y[k]
+			if !ok || !equal(v, w) {
+				return false
+			}
+		}
+		return true
+	case []any:
+		y, ok := b.([]any)
+		if !ok || len(x) != len(y) {
+			return false
+		}
+		for i := range x {
+			if !equal(x[i], y[i]) {
+				return false
+			}
+		}
+		return true
+	case json.Number:
+		y, ok := b.(json.Number)
+		if !ok {
+			return false
+		}
+		if x == y {
+			return true
+		}
+		fx, errx := x.Float64()
+		fy, erry := y.Float64()
+		return errx == nil && erry == nil && fx == fy
+	default:
+		return a == b
+	}
+}
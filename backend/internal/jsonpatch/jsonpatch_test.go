@@ -0,0 +1,121 @@
+package jsonpatch
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+)
+
+// jsonEqual compares two JSON documents semantically.
+func jsonEqual(t *testing.T, got []byte, want string) bool {
+	t.Helper()
+
+	g, err := decode(got)
+	if err != nil {
+		t.Fatalf("result is not JSON: %v", err)
+	}
+	w, err := decode([]byte(want))
+	if err != nil {
+		t.Fatalf("want is not JSON: %v", err)
+	}
+	return equal(g, w)
+}
+
+func TestMergePatch(t *testing.T) {
+	// Examples from RFC 7396 appendix A.
+	tests := []struct {
+		doc, patch, want string
+	}{
+		{`{"a":"b"}`, `{"a":"c"}`, `{"a":"c"}`},
+		{`{"a":"b"}`, `{"b":"c"}`, `{"a":"b","b":"c"}`},
+		{`{"a":"b"}`, `{"a":null}`, `{}`},
+		{`{"a":"b","b":"c"}`, `{"a":null}`, `{"b":"c"}`},
+		{`{"a":["b"]}`, `{"a":"c"}`, `{"a":"c"}`},
+		{`{"a":"c"}`, `{"a":["b"]}`, `{"a":["b"]}`},
+		{`{"a":{"b":"c"}}`, `{"a":{"b":"d","c":null}}`, `{"a":{"b":"d"}}`},
+		{`{"a":[{"b":"c"}]}`, `{"a":[1]}`, `{"a":[1]}`},
+		{`["a","b"]`, `["c","d"]`, `["c","d"]`},
+		{`{"a":"b"}`, `["c"]`, `["c"]`},
+		{`{"a":"foo"}`, `null`, `null`},
+		{`{"e":null}`, `{"a":1}`, `{"e":null,"a":1}`},
+		{`[1,2]`, `{"a":"b","c":null}`, `{"a":"b"}`},
+		{`{}`, `{"a":{"bb":{"ccc":null}}}`, `{"a":{"bb":{}}}`},
+	}
+
+	for _, tt := range tests {
+		got, err := MergePatch([]byte(tt.doc), []byte(tt.patch))
+		if err != nil {
+			t.Errorf("MergePatch(%s, %s): %v", tt.doc, tt.patch, err)
+			continue
+		}
+		if !jsonEqual(t, got, tt.want) {
+			t.Errorf("MergePatch(%s, %s) = %s; want %s", tt.doc, tt.patch, got, tt.want)
+		}
+	}
+}
+
+func TestApply(t *testing.T) {
+	// Mostly examples from RFC 6902 appendix A.
+	tests := []struct {
+		name, doc, patch, want string
+		err                    error
+	}{
+		{"add member", `{"foo":"bar"}`, `[{"op":"add","path":"/baz","value":"qux"}]`, `{"baz":"qux","foo":"bar"}`, nil},
+		{"add element", `{"foo":["bar","baz"]}`, `[{"op":"add","path":"/foo/1","value":"qux"}]`, `{"foo":["bar","qux","baz"]}`, nil},
+		{"append", `{"foo":["bar"]}`, `[{"op":"add","path":"/foo/-","value":["abc","def"]}]`, `{"foo":["bar",["abc","def"]]}`, nil},
+		{"remove member", `{"baz":"qux","foo":"bar"}`, `[{"op":"remove","path":"/baz"}]`, `{"foo":"bar"}`, nil},
+		{"remove element", `{"foo":["bar","qux","baz"]}`, `[{"op":"remove","path":"/foo/1"}]`, `{"foo":["bar","baz"]}`, nil},
+		{"replace", `{"baz":"qux","foo":"bar"}`, `[{"op":"replace","path":"/baz","value":"boo"}]`, `{"baz":"boo","foo":"bar"}`, nil},
+		{"move member", `{"foo":{"bar":"baz","waldo":"fred"},"qux":{"corge":"grault"}}`, `[{"op":"move","from":"/foo/waldo","path":"/qux/thud"}]`, `{"foo":{"bar":"baz"},"qux":{"corge":"grault","thud":"fred"}}`, nil},
+		{"move element", `{"foo":["all","grass","cows","eat"]}`, `[{"op":"move","from":"/foo/1","path":"/foo/3"}]`, `{"foo":["all","cows","eat","grass"]}`, nil},
+		{"copy", `{"a":{"b":1}}`, `[{"op":"copy","from":"/a","path":"/c"}]`, `{"a":{"b":1},"c":{"b":1}}`, nil},
+		{"test success", `{"baz":"qux","foo":["a",2,"c"]}`, `[{"op":"test","path":"/baz","value":"qux"},{"op":"test","path":"/foo/1","value":2}]`, `{"baz":"qux","foo":["a",2,"c"]}`, nil},
+		{"test number forms", `{"n":10}`, `[{"op":"test","path":"/n","value":1e1}]`, `{"n":10}`, nil},
+		{"extra members", `{"foo":"bar"}`, `[{"op":"add","path":"/baz","value":"qux","xyz":123,"from":"/foo"}]`, `{"baz":"qux","foo":"bar"}`, nil},
+		{"escaped pointer", `{"/":9,"~1":10}`, `[{"op":"test","path":"/~01","value":10},{"op":"remove","path":"/~1"}]`, `{"~1":10}`, nil},
+		{"test failure", `{"baz":"qux"}`, `[{"op":"test","path":"/baz","value":"bar"}]`, "", ErrTestFailed},
+		{"test missing", `{"baz":"qux"}`, `[{"op":"test","path":"/nope","value":"bar"}]`, "", ErrTestFailed},
+		{"remove missing", `{"foo":"bar"}`, `[{"op":"remove","path":"/baz"}]`, "", ErrInvalidPatch},
+		{"replace missing", `{"foo":"bar"}`, `[{"op":"replace","path":"/baz","value":1}]`, "", ErrInvalidPatch},
+		{"add to missing parent", `{"foo":"bar"}`, `[{"op":"add","path":"/baz/bat","value":"qux"}]`, "", ErrInvalidPatch},
+		{"index out of range", `{"foo":["bar"]}`, `[{"op":"add","path":"/foo/5","value":"x"}]`, "", ErrInvalidPatch},
+		{"leading zero index", `{"foo":["bar","baz"]}`, `[{"op":"remove","path":"/foo/01"}]`, "", ErrInvalidPatch},
+		{"missing value", `{}`, `[{"op":"add","path":"/a"}]`, "", ErrInvalidPatch},
+		{"unknown op", `{}`, `[{"op":"frobnicate","path":"/a"}]`, "", ErrInvalidPatch},
+		{"move into child", `{"a":{"b":1}}`, `[{"op":"move","from":"/a","path":"/a/c"}]`, "", ErrInvalidPatch},
+		{"not an array", `{}`, `{"op":"add"}`, "", ErrInvalidPatch},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Apply([]byte(tt.doc), []byte(tt.patch))
+			if tt.err != nil {
+				if !errors.Is(err, tt.err) {
+					t.Fatalf("err = %v; want %v", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !jsonEqual(t, got, tt.want) {
+				t.Errorf("got %s; want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestApplyIsAtomic(t *testing.T) {
+	doc := []byte(`{"name":"lobby-east","version":3}`)
+	_, err := Apply(doc, []byte(`[{"op":"replace","path":"/name","value":"x"},{"op":"test","path":"/version","value":2}]`))
+
+	var e *Error
+	if !errors.As(err, &e) || e.Index != 1 {
+		t.Fatalf("err = %v; want failure at operation 1", err)
+	}
+	var v map[string]any
+	json.Unmarshal(doc, &v)
+	if v["name"] != "lobby-east" {
+		t.Errorf("input document was modified")
+	}
+}
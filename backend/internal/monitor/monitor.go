@@ -0,0 +1,418 @@
+// Package monitor checks whether cameras are reachable and records the results as
+// their status.
+//
+// A Poller checks every camera with an address once per interval, a few at a time.
+// Checks are spread out with random jitter so cameras added together aren't all
+// checked together, and cameras which stay offline are checked less and less often,
+// up to a limit, so a dead site doesn't take up the poller. How a camera is checked
+// is up to a Prober: ICMP echo, a TCP connect, or a request through its device
+// driver.
+//
+// Given an IncidentRepository, the poller also opens an incident once a camera has
+// failed a few checks in a row, and resolves it when the camera comes back. Cameras
+// which keep bouncing between up and down are flapping: while they are, incidents
+// are neither opened nor resolved for them, so one bad link doesn't turn into a
+// stream of incidents.
+//
+// Given an events.Publisher, the poller publishes an event whenever a camera goes
+// offline or comes back.
+package monitor
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/chefgoldbloom/pnctool/backend/internal/data"
+	"github.com/chefgoldbloom/pnctool/backend/internal/device"
+	"github.com/chefgoldbloom/pnctool/backend/internal/events"
+)
+
+// Config controls how often and how many cameras a Poller checks. Zero values are
+// replaced by the defaults of DefaultConfig.
+type Config struct {
+	Interval    time.Duration // between checks of a camera which is up
+	MaxBackoff  time.Duration // longest interval between checks of a camera which is down
+	Timeout     time.Duration // for one check
+	Tick        time.Duration // how often the poller looks for cameras which are due
+	Concurrency int           // checks in flight at once
+	Jitter      float64       // fraction of each interval to randomize, from 0 to 1
+	OpenAfter   int           // failed checks in a row before an incident is opened
+	FlapWindow  time.Duration // how long changes between up and down count towards flapping
+	FlapChanges int           // changes within FlapWindow which make a camera flapping
+}
+
+// DefaultConfig checks each camera once a minute, eight at a time, and opens an
+// incident after three failed checks unless the camera has gone up or down four
+// times in the last half hour.
+var DefaultConfig = Config{
+	Interval:    time.Minute,
+	MaxBackoff:  30 * time.Minute,
+	Timeout:     5 * time.Second,
+	Tick:        time.Second,
+	Concurrency: 8,
+	Jitter:      0.2,
+	OpenAfter:   3,
+	FlapWindow:  30 * time.Minute,
+	FlapChanges: 4,
+}
+
+// Poller checks cameras on a schedule and records their status in a
+// data.StatusRepository.
+type Poller struct {
+	cfg       Config
+	store     data.StatusRepository
+	incidents data.IncidentRepository
+	events    events.Publisher
+	prober    Prober
+	logger    *slog.Logger
+
+	// now and rand are replaced in tests.
+	now  func() time.Time
+	rand func() float64
+
+	mu    sync.Mutex
+	state map[int64]*schedule
+
+	// open is the incident which isn't resolved of each camera with one, by camera
+	// ID. It's loaded from incidents by the first Poll.
+	open map[int64]int64
+}
+
+// schedule is when a camera is next due, how many checks in a row have found it
+// offline, and when it last went up or down, within FlapWindow.
+type schedule struct {
+	next     time.Time
+	failures int
+	checked  bool
+	changes  []time.Time
+}
+
+// New returns a Poller which checks the cameras in store with prober. If incidents
+// is nil, no incidents are opened, and if publisher is nil no events are published.
+func New(store data.StatusRepository, incidents data.IncidentRepository, publisher events.Publisher, prober Prober, logger *slog.Logger, cfg Config) *Poller {
+	if cfg.Interval <= 0 {
+		cfg.Interval = DefaultConfig.Interval
+	}
+	if cfg.MaxBackoff < cfg.Interval {
+		cfg.MaxBackoff = max(DefaultConfig.MaxBackoff, cfg.Interval)
+	}
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = DefaultConfig.Timeout
+	}
+	if cfg.Tick <= 0 {
+		cfg.Tick = DefaultConfig.Tick
+	}
+	if cfg.Concurrency <= 0 {
+		cfg.Concurrency = DefaultConfig.Concurrency
+	}
+	cfg.Jitter = min(max(cfg.Jitter, 0), 1)
+	if cfg.OpenAfter <= 0 {
+		cfg.OpenAfter = DefaultConfig.OpenAfter
+	}
+	if cfg.FlapWindow <= 0 {
+		cfg.FlapWindow = DefaultConfig.FlapWindow
+	}
+	if cfg.FlapChanges <= 0 {
+		cfg.FlapChanges = DefaultConfig.FlapChanges
+	}
+
+	return &Poller{
+		cfg:       cfg,
+		store:     store,
+		incidents: incidents,
+		events:    publisher,
+		prober:    prober,
+		logger:    logger,
+		now:       time.Now,
+		rand:      rand.Float64,
+		state:     make(map[int64]*schedule),
+	}
+}
+
+// Run checks cameras as they fall due until ctx is cancelled. It returns once the
+// checks in flight have finished, so the caller can wait for it before closing the
+// database.
+func (p *Poller) Run(ctx context.Context) {
+	ticker := time.NewTicker(p.cfg.Tick)
+	defer ticker.Stop()
+
+	for {
+		if _, err := p.Poll(ctx); err != nil && ctx.Err() == nil {
+			p.logger.Error("polling camera status", "error", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Poll checks every camera which is due, waiting for the checks to finish, and
+// returns how many were checked. Cameras the poller hasn't seen before are scheduled
+// at a random point in the next interval instead of being checked straight away.
+func (p *Poller) Poll(ctx context.Context) (int, error) {
+	if err := p.loadIncidents(); err != nil {
+		return 0, err
+	}
+
+	cameras, err := p.store.Targets()
+	if err != nil {
+		return 0, err
+	}
+
+	due := p.due(cameras)
+
+	sem := make(chan struct{}, p.cfg.Concurrency)
+	var wg sync.WaitGroup
+	for _, camera := range due {
+		select {
+		case sem <- struct{}{}:
+		case <-ctx.Done():
+			wg.Wait()
+			return 0, ctx.Err()
+		}
+		wg.Add(1)
+		go func(camera *data.Camera) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+			p.check(ctx, camera)
+		}(camera)
+	}
+	wg.Wait()
+	return len(due), nil
+}
+
+// due returns the cameras whose next check has come, scheduling newly seen cameras
+// and forgetting those which are gone.
+func (p *Poller) due(cameras []*data.Camera) []*data.Camera {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	now := p.now()
+	seen := make(map[int64]bool, len(cameras))
+	var due []*data.Camera
+	for _, camera := range cameras {
+		seen[camera.ID] = true
+		s, ok := p.state[camera.ID]
+		if !ok {
+			offset := time.Duration(p.rand() * float64(p.cfg.Interval))
+			p.state[camera.ID] = &schedule{next: now.Add(offset)}
+			continue
+		}
+		if !now.Before(s.next) {
+			due = append(due, camera)
+		}
+	}
+	for id := range p.state {
+		if !seen[id] {
+			delete(p.state, id)
+		}
+	}
+	return due
+}
+
+// check probes one camera and records the result. Nothing is recorded if ctx is
+// cancelled during the probe, since the failure says nothing about the camera.
+func (p *Poller) check(ctx context.Context, camera *data.Camera) {
+	d := device.Device{
+		Addr:       camera.Address,
+		Username:   camera.Username,
+		Password:   camera.Password,
+		ModelNo:    camera.ModelNo,
+		MacAddress: camera.MacAddress,
+	}
+
+	probeCtx, cancel := context.WithTimeout(ctx, p.cfg.Timeout)
+	start := p.now()
+	err := p.prober.Probe(probeCtx, d)
+	end := p.now()
+	cancel()
+
+	if ctx.Err() != nil {
+		return
+	}
+
+	status := &data.CameraStatus{Status: Classify(err), CheckedAt: end}
+	if status.Status != data.StatusOffline {
+		latency := int(end.Sub(start).Milliseconds())
+		status.LatencyMS = &latency
+		status.LastSeenAt = &end
+	}
+
+	failures, flapping := p.reschedule(camera.ID, status.Status == data.StatusOffline)
+
+	previous, err := p.store.Record(camera.ID, status)
+	switch {
+	case errors.Is(err, data.ErrRecordNotFound):
+		p.forget(camera.ID)
+		return
+	case err != nil:
+		p.logger.Error("recording camera status", "camera_id", camera.ID, "error", err)
+	default:
+		p.statusChanged(camera, previous, status.Status, end)
+	}
+
+	p.track(camera.ID, failures, flapping, end)
+}
+
+// statusChanged publishes camera.offline when a camera stops answering, and
+// camera.online when one which was offline answers again.
+func (p *Poller) statusChanged(camera *data.Camera, previous, current string, at time.Time) {
+	var eventType string
+	switch {
+	case current == data.StatusOffline && previous != data.StatusOffline:
+		eventType = data.EventCameraOffline
+	case current != data.StatusOffline && previous == data.StatusOffline:
+		eventType = data.EventCameraOnline
+	default:
+		return
+	}
+	p.publish(eventType, camera, map[string]string{"name": camera.Name, "status": current, "previous_status": previous}, at)
+}
+
+// publish sends an event about camera, logging any failure.
+func (p *Poller) publish(eventType string, camera *data.Camera, payload any, at time.Time) {
+	if p.events == nil {
+		return
+	}
+	event, err := data.NewEvent(eventType, camera, payload, at)
+	if err == nil {
+		err = p.events.Publish(event)
+	}
+	if err != nil {
+		p.logger.Error("publishing event", "type", eventType, "camera_id", camera.ID, "error", err)
+	}
+}
+
+// Classify maps the result of a probe to a camera status. A camera which rejects
+// its credentials is reachable, so it isn't offline.
+func Classify(err error) string {
+	switch {
+	case err == nil:
+		return data.StatusOnline
+	case errors.Is(err, device.ErrUnauthorized):
+		return data.StatusUnauthorized
+	default:
+		return data.StatusOffline
+	}
+}
+
+// reschedule sets the camera's next check one interval away, doubled for each check
+// in a row which found it offline, up to MaxBackoff. It returns how many checks in a
+// row have found the camera offline and whether it's flapping.
+func (p *Poller) reschedule(id int64, offline bool) (failures int, flapping bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	now := p.now()
+	s, ok := p.state[id]
+	if !ok {
+		s = &schedule{}
+		p.state[id] = s
+	}
+	if s.checked && offline != (s.failures > 0) {
+		s.changes = append(s.changes, now)
+	}
+	for len(s.changes) > 0 && now.Sub(s.changes[0]) > p.cfg.FlapWindow {
+		s.changes = s.changes[1:]
+	}
+	s.checked = true
+
+	if offline {
+		s.failures++
+	} else {
+		s.failures = 0
+	}
+	s.next = now.Add(p.delay(s.failures))
+	return s.failures, len(s.changes) >= p.cfg.FlapChanges
+}
+
+// delay is the interval before the next check after failures offline checks in a
+// row, with jitter applied. It must be called with mu held, for rand.
+func (p *Poller) delay(failures int) time.Duration {
+	d := p.cfg.Interval
+	for i := 0; i < failures && d < p.cfg.MaxBackoff; i++ {
+		d *= 2
+	}
+	d = min(d, p.cfg.MaxBackoff)
+
+	// Spread checks over d ± Jitter/2 so they don't stay in lockstep.
+	spread := p.cfg.Jitter * float64(d)
+	return d + time.Duration((p.rand()-0.5)*spread)
+}
+
+func (p *Poller) forget(id int64) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	delete(p.state, id)
+	delete(p.open, id)
+}
+
+// loadIncidents finds out which cameras have an incident open, the first time it's
+// called.
+func (p *Poller) loadIncidents() error {
+	if p.incidents == nil {
+		return nil
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.open != nil {
+		return nil
+	}
+	open, err := p.incidents.Unresolved()
+	if err != nil {
+		return err
+	}
+	p.open = open
+	return nil
+}
+
+// track opens an incident for a camera which has failed OpenAfter checks in a row,
+// and resolves it once the camera is back. Nothing changes while the camera is
+// flapping. An incident resolved by a user while the camera is still down isn't
+// reopened until the camera has come back and gone down again.
+func (p *Poller) track(id int64, failures int, flapping bool, at time.Time) {
+	if p.incidents == nil || flapping {
+		return
+	}
+
+	p.mu.Lock()
+	incidentID, open := p.open[id]
+	p.mu.Unlock()
+
+	switch {
+	case failures >= p.cfg.OpenAfter && !open:
+		incident, opened, err := p.incidents.Open(id, failures, at)
+		if err != nil {
+			if !errors.Is(err, data.ErrRecordNotFound) {
+				p.logger.Error("opening incident", "camera_id", id, "error", err)
+			}
+			return
+		}
+		p.mu.Lock()
+		p.open[id] = incident.ID
+		p.mu.Unlock()
+		if opened {
+			p.logger.Info("incident opened", "incident_id", incident.ID, "camera_id", id, "failures", failures)
+		}
+
+	case failures == 0 && open:
+		if err := p.incidents.Resolve(incidentID, at); err != nil {
+			p.logger.Error("resolving incident", "incident_id", incidentID, "camera_id", id, "error", err)
+			return
+		}
+		p.mu.Lock()
+		delete(p.open, id)
+		p.mu.Unlock()
+		p.logger.Info("incident resolved", "incident_id", incidentID, "camera_id", id)
+	}
+}
@@ -0,0 +1,416 @@
+package monitor
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/chefgoldbloom/pnctool/backend/internal/data"
+	"github.com/chefgoldbloom/pnctool/backend/internal/device"
+)
+
+// fakeProber answers probes with the error set for each address, counting probes and
+// how many were in flight at once.
+type fakeProber struct {
+	mu       sync.Mutex
+	errs     map[string]error
+	delay    time.Duration
+	probes   int
+	inFlight int
+	maxSeen  int
+}
+
+func (f *fakeProber) Probe(ctx context.Context, d device.Device) error {
+	f.mu.Lock()
+	f.probes++
+	f.inFlight++
+	f.maxSeen = max(f.maxSeen, f.inFlight)
+	err := f.errs[d.Addr]
+	f.mu.Unlock()
+
+	defer func() {
+		f.mu.Lock()
+		f.inFlight--
+		f.mu.Unlock()
+	}()
+
+	select {
+	case <-time.After(f.delay):
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (f *fakeProber) set(addr string, err error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.errs[addr] = err
+}
+
+// testPoller returns a poller over a fresh in-memory store, with a clock the test
+// moves and no jitter.
+func testPoller(t *testing.T, cfg Config, addrs ...string) (*Poller, *data.MemoryCameraModel, *fakeProber, *time.Time) {
+	t.Helper()
+
+	store := data.NewMemoryCameraModel()
+	for i, addr := range addrs {
+		camera := &data.Camera{Name: addr, MacAddress: "ACCC8E00000" + string(rune('0'+i)), SiteName: "NYC-5th-OPS", Address: addr}
+		if err := store.Insert(camera); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// A camera without an address is never polled.
+	store.Insert(&data.Camera{Name: "no-address", MacAddress: "ACCC8E0000FF", SiteName: "NYC-5th-OPS"})
+
+	prober := &fakeProber{errs: map[string]error{}}
+	p := New(store, nil, nil, prober, slog.New(slog.NewTextHandler(io.Discard, nil)), cfg)
+
+	now := time.Date(2026, 3, 2, 9, 0, 0, 0, time.UTC)
+	p.now = func() time.Time { return now }
+	p.rand = func() float64 { return 0.5 }
+	return p, store, prober, &now
+}
+
+func status(t *testing.T, store *data.MemoryCameraModel, id int64) *data.CameraStatus {
+	t.Helper()
+	camera, err := store.GetProjected(id, data.Projection{Include: []string{"status"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return camera.Status
+}
+
+func TestPollerSchedule(t *testing.T) {
+	p, store, prober, now := testPoller(t, Config{Interval: time.Minute, MaxBackoff: 5 * time.Minute}, "10.0.0.1", "10.0.0.2")
+	ctx := context.Background()
+	poll := func() int {
+		t.Helper()
+		n, err := p.Poll(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return n
+	}
+
+	// New cameras are spread over the first interval rather than checked at once.
+	if n := poll(); n != 0 {
+		t.Fatalf("first poll checked %d cameras; want 0", n)
+	}
+	*now = now.Add(30 * time.Second)
+	if n := poll(); n != 2 {
+		t.Fatalf("poll after 30s checked %d cameras; want 2", n)
+	}
+	if n := poll(); n != 0 {
+		t.Errorf("immediate poll checked %d cameras; want 0", n)
+	}
+
+	if s := status(t, store, 1); s == nil || s.Status != data.StatusOnline || s.LatencyMS == nil || s.LastSeenAt == nil {
+		t.Fatalf("status = %+v; want online with latency and last seen", s)
+	}
+	seen := *status(t, store, 1).LastSeenAt
+
+	// An offline camera is checked half as often each time, up to MaxBackoff. The
+	// online one stays on the interval.
+	prober.set("10.0.0.1", device.ErrTimeout)
+	var checks []int
+	for i := 0; i < 10; i++ {
+		*now = now.Add(time.Minute)
+		checks = append(checks, poll())
+	}
+	// Camera 1 is found offline at minute 1, then checked again after 2, 4 and 5
+	// minutes; 5 rather than 8 because of MaxBackoff.
+	want := []int{2, 1, 2, 1, 1, 1, 2, 1, 1, 1}
+	for i := range want {
+		if checks[i] != want[i] {
+			t.Fatalf("checks per minute = %v; want %v", checks, want)
+		}
+	}
+
+	s := status(t, store, 1)
+	if s.Status != data.StatusOffline || s.LatencyMS != nil {
+		t.Errorf("status = %+v; want offline without latency", s)
+	}
+	if s.LastSeenAt == nil || !s.LastSeenAt.Equal(seen) {
+		t.Errorf("last_seen_at = %v; want it kept at %v", s.LastSeenAt, seen)
+	}
+
+	// Coming back resets the backoff.
+	prober.set("10.0.0.1", nil)
+	*now = now.Add(5 * time.Minute)
+	poll()
+	*now = now.Add(time.Minute)
+	if n := poll(); n != 2 {
+		t.Errorf("after recovery checked %d cameras; want 2", n)
+	}
+}
+
+func TestPollerStatuses(t *testing.T) {
+	p, store, prober, now := testPoller(t, Config{}, "up", "locked", "down")
+	prober.set("locked", &device.Error{Op: "info", Addr: "locked", Err: device.ErrUnauthorized})
+	prober.set("down", &device.Error{Op: "info", Addr: "down", Err: errors.New("connection refused")})
+
+	p.Poll(context.Background())
+	*now = now.Add(time.Minute)
+	if n, err := p.Poll(context.Background()); n != 3 || err != nil {
+		t.Fatalf("Poll = %d, %v; want 3", n, err)
+	}
+
+	for id, want := range map[int64]string{1: data.StatusOnline, 2: data.StatusUnauthorized, 3: data.StatusOffline} {
+		if s := status(t, store, id); s == nil || s.Status != want {
+			t.Errorf("camera %d status = %+v; want %s", id, s, want)
+		}
+	}
+	if s := status(t, store, 4); s != nil {
+		t.Errorf("camera without address has status %+v", s)
+	}
+
+	// Deleted cameras are dropped from the schedule.
+	store.Delete(3)
+	*now = now.Add(time.Minute)
+	if n, _ := p.Poll(context.Background()); n != 2 {
+		t.Errorf("after delete checked %d cameras; want 2", n)
+	}
+	if _, ok := p.state[3]; ok {
+		t.Error("deleted camera is still scheduled")
+	}
+}
+
+func TestPollerConcurrency(t *testing.T) {
+	addrs := []string{"a", "b", "c", "d", "e", "f", "g", "h"}
+	p, _, prober, now := testPoller(t, Config{Concurrency: 3}, addrs...)
+	prober.delay = 20 * time.Millisecond
+
+	p.Poll(context.Background())
+	*now = now.Add(time.Minute)
+	if n, err := p.Poll(context.Background()); n != len(addrs) || err != nil {
+		t.Fatalf("Poll = %d, %v; want %d", n, err, len(addrs))
+	}
+	if prober.maxSeen != 3 {
+		t.Errorf("max probes in flight = %d; want 3", prober.maxSeen)
+	}
+}
+
+func TestPollerRunStops(t *testing.T) {
+	p, store, prober, _ := testPoller(t, Config{Tick: time.Millisecond}, "slow")
+	prober.delay = time.Hour
+	p.now = time.Now
+	p.rand = func() float64 { return 0 }
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		p.Run(ctx)
+		close(done)
+	}()
+
+	// Wait for the probe to start, then shut down mid-probe.
+	for deadline := time.Now().Add(time.Second); ; time.Sleep(time.Millisecond) {
+		prober.mu.Lock()
+		started := prober.probes > 0
+		prober.mu.Unlock()
+		if started {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("probe never started")
+		}
+	}
+	cancel()
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Run didn't return after cancel")
+	}
+	if s := status(t, store, 1); s != nil {
+		t.Errorf("interrupted probe recorded %+v", s)
+	}
+}
+
+func TestPollerJitter(t *testing.T) {
+	p := New(data.NewMemoryCameraModel(), nil, nil, &fakeProber{}, slog.New(slog.NewTextHandler(io.Discard, nil)), Config{Interval: time.Minute, Jitter: 0.5})
+
+	for _, r := range []float64{0, 0.25, 0.5, 0.999} {
+		p.rand = func() float64 { return r }
+		d := p.delay(0)
+		if d < 45*time.Second || d > 75*time.Second {
+			t.Errorf("delay with rand %v = %v; want within 60s ± 15s", r, d)
+		}
+	}
+}
+
+// incidents returns the states of the camera's incidents, oldest first.
+func incidents(t *testing.T, repo data.IncidentRepository) []string {
+	t.Helper()
+	all, _, err := repo.GetAll(data.IncidentFilter{}, data.Filters{Page: 1, PageSize: 100, Sort: "id", SortSafelist: []string{"id"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var states []string
+	for _, incident := range all {
+		states = append(states, incident.State)
+	}
+	return states
+}
+
+func TestPollerIncidents(t *testing.T) {
+	p, store, prober, now := testPoller(t, Config{Interval: time.Minute, MaxBackoff: time.Minute, OpenAfter: 3}, "10.0.0.1")
+	repo := data.NewMemoryIncidentModel(store)
+	p.incidents = repo
+
+	// step moves on a minute and checks the camera, failing if err is set.
+	step := func(err error) {
+		t.Helper()
+		prober.set("10.0.0.1", err)
+		*now = now.Add(time.Minute)
+		if n, err := p.Poll(context.Background()); n != 1 || err != nil {
+			t.Fatalf("Poll = %d, %v; want 1", n, err)
+		}
+	}
+
+	p.Poll(context.Background())
+	step(nil)
+	step(device.ErrTimeout)
+	step(device.ErrTimeout)
+	if got := incidents(t, repo); len(got) != 0 {
+		t.Fatalf("incidents after 2 failures = %v; want none", got)
+	}
+	step(device.ErrTimeout)
+	step(device.ErrTimeout)
+	if got := fmt.Sprint(incidents(t, repo)); got != "[open]" {
+		t.Fatalf("incidents after 4 failures = %s; want [open]", got)
+	}
+	if incident, _ := repo.Get(1); incident.Failures != 3 || !incident.OpenedAt.Equal(now.Add(-time.Minute)) {
+		t.Errorf("incident = %+v; want opened after 3 failures", incident)
+	}
+
+	// Recovering resolves the incident, and going down again opens another.
+	step(&device.Error{Op: "info", Addr: "10.0.0.1", Err: device.ErrUnauthorized})
+	if incident, _ := repo.Get(1); incident.State != data.IncidentResolved || incident.ResolvedBy != "" || !incident.ResolvedAt.Equal(*now) {
+		t.Errorf("incident = %+v; want resolved automatically", incident)
+	}
+	for i := 0; i < 3; i++ {
+		step(device.ErrTimeout)
+	}
+	if got := fmt.Sprint(incidents(t, repo)); got != "[resolved open]" {
+		t.Errorf("incidents = %s; want [resolved open]", got)
+	}
+
+	// A restarted poller picks up the open incident.
+	restarted := New(store, repo, nil, prober, p.logger, p.cfg)
+	restarted.now, restarted.rand = p.now, p.rand
+	prober.set("10.0.0.1", nil)
+	restarted.Poll(context.Background())
+	*now = now.Add(time.Minute)
+	restarted.Poll(context.Background())
+	if got := fmt.Sprint(incidents(t, repo)); got != "[resolved resolved]" {
+		t.Errorf("incidents after restart = %s; want [resolved resolved]", got)
+	}
+}
+
+func TestPollerFlapping(t *testing.T) {
+	p, store, prober, now := testPoller(t, Config{Interval: time.Minute, MaxBackoff: time.Minute, OpenAfter: 1, FlapWindow: 10 * time.Minute, FlapChanges: 3}, "10.0.0.1")
+	repo := data.NewMemoryIncidentModel(store)
+	p.incidents = repo
+
+	p.Poll(context.Background())
+	*now = now.Add(time.Minute)
+	p.Poll(context.Background())
+
+	// The camera bounces: the first outage opens an incident and recovering resolves
+	// it, but from the third change on it's flapping and nothing more is opened.
+	for i, up := range []bool{false, true, false, true, false} {
+		if up {
+			prober.set("10.0.0.1", nil)
+		} else {
+			prober.set("10.0.0.1", device.ErrTimeout)
+		}
+		*now = now.Add(time.Minute)
+		p.Poll(context.Background())
+
+		want := "[open]"
+		if i > 0 {
+			want = "[resolved]"
+		}
+		if got := fmt.Sprint(incidents(t, repo)); got != want {
+			t.Fatalf("after change %d incidents = %s; want %s", i+1, got, want)
+		}
+	}
+
+	// Once it has stayed down long enough for the changes to age out of the window,
+	// an incident is opened after all.
+	var opened int
+	for i := 1; i <= 10; i++ {
+		*now = now.Add(time.Minute)
+		p.Poll(context.Background())
+		if got := fmt.Sprint(incidents(t, repo)); got == "[resolved open]" {
+			opened = i
+			break
+		}
+	}
+	if opened != 9 {
+		t.Errorf("incident opened %d minutes into the outage; want 9", opened)
+	}
+}
+
+// fakePublisher collects published events.
+type fakePublisher struct {
+	mu     sync.Mutex
+	events []*data.Event
+}
+
+func (f *fakePublisher) Publish(event *data.Event) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.events = append(f.events, event)
+	return nil
+}
+
+// take returns the events published since it was last called, as "type:camera_id".
+func (f *fakePublisher) take() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var got []string
+	for _, event := range f.events {
+		got = append(got, fmt.Sprintf("%s:%d", event.Type, event.CameraID))
+	}
+	f.events = nil
+	return got
+}
+
+func TestPollerEvents(t *testing.T) {
+	p, _, fake, now := testPoller(t, Config{}, "a", "b")
+	publisher := &fakePublisher{}
+	p.events = publisher
+
+	poll := func() []string {
+		t.Helper()
+		*now = now.Add(time.Minute)
+		p.Poll(context.Background())
+		return publisher.take()
+	}
+
+	// Coming online for the first time isn't an event.
+	if got := poll(); len(got) != 0 {
+		t.Errorf("first poll published %v; want nothing", got)
+	}
+
+	fake.set("b", errors.New("connection refused"))
+	if got := fmt.Sprint(poll()); got != "[camera.offline:2]" {
+		t.Errorf("camera going down published %v", got)
+	}
+	if got := poll(); len(got) != 0 {
+		t.Errorf("camera staying down published %v; want nothing", got)
+	}
+
+	fake.set("b", nil)
+	if got := fmt.Sprint(poll()); got != "[camera.online:2]" {
+		t.Errorf("recovery published %v", got)
+	}
+}
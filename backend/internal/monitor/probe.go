@@ -0,0 +1,155 @@
+package monitor
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/chefgoldbloom/pnctool/backend/internal/device"
+)
+
+// A Prober checks whether a camera is reachable. It returns nil if it is, an error
+// wrapping device.ErrUnauthorized if it answered but rejected the credentials, and
+// any other error if it couldn't be reached.
+type Prober interface {
+	Probe(ctx context.Context, d device.Device) error
+}
+
+// NewProber returns the prober named by kind: "icmp", "tcp" or "http". HTTP probes go
+// through the camera's driver in drivers.
+func NewProber(kind string, drivers *device.Registry) (Prober, error) {
+	switch kind {
+	case "icmp":
+		return ICMPProber{}, nil
+	case "tcp":
+		return TCPProber{}, nil
+	case "http":
+		return HTTPProber{Drivers: drivers}, nil
+	default:
+		return nil, fmt.Errorf("unknown probe %q, must be one of: icmp, tcp, http", kind)
+	}
+}
+
+// HTTPProber reads the camera's device information through its driver, which
+// checks the credentials as well as the management API. Cameras the registry can't
+// place by MAC address or model are identified by asking them.
+type HTTPProber struct {
+	Drivers *device.Registry
+}
+
+func (p HTTPProber) Probe(ctx context.Context, d device.Device) error {
+	_, err := p.Drivers.Info(ctx, d)
+	return err
+}
+
+// TCPProber connects to the camera's management port: the port in its address, or
+// 80, or 443 for https addresses.
+type TCPProber struct{}
+
+func (TCPProber) Probe(ctx context.Context, d device.Device) error {
+	host, port, err := splitAddr(d.Addr)
+	if err != nil {
+		return err
+	}
+
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "tcp", net.JoinHostPort(host, port))
+	if err != nil {
+		return err
+	}
+	return conn.Close()
+}
+
+// ICMPProber sends the camera an ICMP echo request and waits for the reply. It needs
+// a raw socket, so the server must run as root or with CAP_NET_RAW. Only IPv4 is
+// supported.
+type ICMPProber struct{}
+
+func (ICMPProber) Probe(ctx context.Context, d device.Device) error {
+	host, _, err := splitAddr(d.Addr)
+	if err != nil {
+		return err
+	}
+
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "ip4:icmp", host)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		deadline = time.Now().Add(DefaultConfig.Timeout)
+	}
+	conn.SetDeadline(deadline)
+
+	id, seq := uint16(os.Getpid()), uint16(time.Now().UnixNano())
+	if _, err := conn.Write(echoRequest(id, seq)); err != nil {
+		return err
+	}
+
+	// The socket sees every ICMP message from the host, so skip anything which isn't
+	// the reply to our request.
+	buf := make([]byte, 1500)
+	for {
+		n, _, err := conn.(*net.IPConn).ReadFrom(buf)
+		if err != nil {
+			if errors.Is(err, os.ErrDeadlineExceeded) {
+				return device.ErrTimeout
+			}
+			return err
+		}
+		reply := buf[:n]
+		if len(reply) >= 8 && reply[0] == 0 && reply[1] == 0 &&
+			binary.BigEndian.Uint16(reply[4:]) == id && binary.BigEndian.Uint16(reply[6:]) == seq {
+			return nil
+		}
+	}
+}
+
+// echoRequest builds an ICMP echo request message.
+func echoRequest(id, seq uint16) []byte {
+	msg := make([]byte, 16)
+	msg[0] = 8 // echo request, code 0
+	binary.BigEndian.PutUint16(msg[4:], id)
+	binary.BigEndian.PutUint16(msg[6:], seq)
+	copy(msg[8:], "pnctool!")
+
+	var sum uint32
+	for i := 0; i < len(msg); i += 2 {
+		sum += uint32(binary.BigEndian.Uint16(msg[i:]))
+	}
+	sum = sum>>16 + sum&0xffff
+	sum += sum >> 16
+	binary.BigEndian.PutUint16(msg[2:], ^uint16(sum))
+	return msg
+}
+
+// splitAddr returns the host and port of a device address: a host, host:port or
+// base URL. The port defaults to that of the scheme, or 80.
+func splitAddr(addr string) (host, port string, err error) {
+	raw := addr
+	if !strings.Contains(raw, "://") {
+		raw = "http://" + raw
+	}
+	u, err := url.Parse(raw)
+	if err != nil || u.Hostname() == "" {
+		return "", "", fmt.Errorf("invalid device address %q", addr)
+	}
+
+	port = u.Port()
+	if port == "" {
+		port = "80"
+		if u.Scheme == "https" {
+			port = "443"
+		}
+	}
+	return u.Hostname(), port, nil
+}
@@ -0,0 +1,125 @@
+package monitor
+
+import (
+	"context"
+	"errors"
+	"net"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/chefgoldbloom/pnctool/backend/internal/data"
+	"github.com/chefgoldbloom/pnctool/backend/internal/device"
+	"github.com/chefgoldbloom/pnctool/backend/internal/device/devicetest"
+)
+
+var testInfo = device.Info{Vendor: "AXIS", Model: "P3245-LV", Serial: "ACCC8E000001", Firmware: "10.12.114", Hostname: "axis-accc8e000001"}
+
+func TestHTTPProber(t *testing.T) {
+	prober, err := NewProber("http", device.NewRegistry(device.NewClient(time.Second)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	camera := devicetest.NewCamera(testInfo)
+	defer camera.Close()
+
+	// The simulator's model is enough for the registry to pick VAPIX; without it the
+	// camera is identified by asking it.
+	known := camera.Device()
+	unknown := camera.Device()
+	unknown.ModelNo = ""
+	locked := camera.Device()
+	locked.Password = "wrong"
+
+	gone := devicetest.NewCamera(testInfo)
+	gone.Close()
+
+	tests := []struct {
+		name string
+		d    device.Device
+		want string
+	}{
+		{"known model", known, data.StatusOnline},
+		{"unknown model", unknown, data.StatusOnline},
+		{"wrong password", locked, data.StatusUnauthorized},
+		{"unreachable", gone.Device(), data.StatusOffline},
+	}
+
+	for _, tt := range tests {
+		if got := Classify(prober.Probe(context.Background(), tt.d)); got != tt.want {
+			t.Errorf("%s: status = %s; want %s", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestTCPProber(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := ln.Addr().String()
+
+	if err := (TCPProber{}).Probe(context.Background(), device.Device{Addr: "http://" + addr}); err != nil {
+		t.Errorf("open port: %v", err)
+	}
+
+	ln.Close()
+	if err := (TCPProber{}).Probe(context.Background(), device.Device{Addr: addr}); err == nil {
+		t.Error("closed port: err = nil")
+	}
+}
+
+func TestICMPProber(t *testing.T) {
+	err := (ICMPProber{}).Probe(context.Background(), device.Device{Addr: "127.0.0.1"})
+	if errors.Is(err, os.ErrPermission) {
+		t.Skip("ICMP needs a raw socket:", err)
+	}
+	if err != nil {
+		t.Error(err)
+	}
+}
+
+func TestNewProberUnknown(t *testing.T) {
+	if _, err := NewProber("snmp", nil); err == nil {
+		t.Error("err = nil; want an error for an unknown probe")
+	}
+}
+
+func TestSplitAddr(t *testing.T) {
+	tests := []struct {
+		addr, host, port string
+	}{
+		{"10.0.0.7", "10.0.0.7", "80"},
+		{"10.0.0.7:8080", "10.0.0.7", "8080"},
+		{"cam-7.example.net", "cam-7.example.net", "80"},
+		{"https://cam-7.example.net/", "cam-7.example.net", "443"},
+		{"http://[fd00::7]:81", "fd00::7", "81"},
+	}
+
+	for _, tt := range tests {
+		host, port, err := splitAddr(tt.addr)
+		if err != nil || host != tt.host || port != tt.port {
+			t.Errorf("splitAddr(%q) = %q, %q, %v; want %q, %q", tt.addr, host, port, err, tt.host, tt.port)
+		}
+	}
+
+	if _, _, err := splitAddr(""); err == nil {
+		t.Error(`splitAddr(""): err = nil`)
+	}
+}
+
+func TestEchoRequestChecksum(t *testing.T) {
+	// A message with a correct checksum sums to all ones.
+	msg := echoRequest(0x1234, 0x0001)
+	var sum uint32
+	for i := 0; i < len(msg); i += 2 {
+		sum += uint32(msg[i])<<8 | uint32(msg[i+1])
+	}
+	for sum > 0xffff {
+		sum = sum>>16 + sum&0xffff
+	}
+	if sum != 0xffff {
+		t.Errorf("checksum doesn't verify: sum = %#x", sum)
+	}
+}
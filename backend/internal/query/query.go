@@ -0,0 +1,422 @@
+// Package query parses the filter language accepted by the q= parameter of list
+// endpoints.
+//
+// A query is a sequence of terms combined with AND, OR, NOT and parentheses. Terms
+// next to each other are ANDed, AND binds tighter than OR, and a leading - is a short
+// form of NOT:
+//
+//	model_no:P32* site_name:*-GLH created_at:>=2026-01-01 -status:online
+//	(site_name:NYC-* OR site_name:BOS-*) AND NOT version:1
+//
+// A term is a field name, an operator and a value. The operators are : (matches),
+// and the comparisons >, >=, < and <=, which may also be written after the colon
+// (created_at:>2026-01-01). Values are bare words or double-quoted strings with \"
+// and \\ escapes. The parser only checks syntax: which fields exist and what their
+// values mean is up to the caller.
+package query
+
+import (
+	"fmt"
+	"strings"
+	"unicode/utf8"
+)
+
+const (
+	// MaxLength is the longest query, in bytes, which Parse accepts.
+	MaxLength = 1024
+
+	// MaxDepth is the deepest nesting of parentheses and NOTs which Parse accepts.
+	MaxDepth = 32
+)
+
+// Error is returned for a query which can't be parsed or, by callers, for a term which
+// can't be evaluated. Pos is the 1-based character position the problem was found at.
+type Error struct {
+	Pos int
+	Msg string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("at position %d: %s", e.Pos, e.Msg)
+}
+
+// Errorf returns an *Error at pos.
+func Errorf(pos int, format string, args ...any) *Error {
+	return &Error{Pos: pos, Msg: fmt.Sprintf(format, args...)}
+}
+
+// Op is the comparison a Term makes.
+type Op int
+
+const (
+	Match Op = iota // field:value
+	Lt              // field:<value
+	Le              // field:<=value
+	Gt              // field:>value
+	Ge              // field:>=value
+)
+
+func (op Op) String() string {
+	switch op {
+	case Lt:
+		return "<"
+	case Le:
+		return "<="
+	case Gt:
+		return ">"
+	case Ge:
+		return ">="
+	default:
+		return ":"
+	}
+}
+
+// Node is a parsed query expression: *And, *Or, *Not or *Term. String returns the
+// expression in a canonical form which parses back to an equal tree.
+type Node interface {
+	Pos() int
+	String() string
+}
+
+// And matches when both sides match.
+type And struct {
+	Left, Right Node
+}
+
+// Or matches when either side matches.
+type Or struct {
+	Left, Right Node
+}
+
+// Not matches when X doesn't.
+type Not struct {
+	X      Node
+	NotPos int
+}
+
+// Term compares a field with a value.
+type Term struct {
+	Field    string
+	Op       Op
+	Value    string
+	FieldPos int
+	OpPos    int
+	ValuePos int
+}
+
+func (n *And) Pos() int  { return n.Left.Pos() }
+func (n *Or) Pos() int   { return n.Left.Pos() }
+func (n *Not) Pos() int  { return n.NotPos }
+func (n *Term) Pos() int { return n.FieldPos }
+
+// Parentheses are only written where precedence needs them, so a query's canonical
+// form is never nested deeper than the query itself.
+func (n *And) String() string {
+	left, right := n.Left.String(), n.Right.String()
+	if _, ok := n.Left.(*Or); ok {
+		left = "(" + left + ")"
+	}
+	switch n.Right.(type) {
+	case *And, *Or:
+		right = "(" + right + ")"
+	}
+	return left + " AND " + right
+}
+
+func (n *Or) String() string {
+	right := n.Right.String()
+	if _, ok := n.Right.(*Or); ok {
+		right = "(" + right + ")"
+	}
+	return n.Left.String() + " OR " + right
+}
+
+func (n *Not) String() string {
+	switch n.X.(type) {
+	case *And, *Or:
+		return "NOT (" + n.X.String() + ")"
+	}
+	return "NOT " + n.X.String()
+}
+
+func (n *Term) String() string {
+	op := ":"
+	if n.Op != Match {
+		op += n.Op.String()
+	}
+	return n.Field + op + quote(n.Value)
+}
+
+// quote returns value as a bare word if it would parse back unchanged, otherwise as a
+// quoted string.
+func quote(value string) string {
+	if value != "" && !strings.ContainsAny(value, " \t\r\n()\"\\<>=") {
+		return value
+	}
+	var b strings.Builder
+	b.WriteByte('"')
+	for _, r := range value {
+		if r == '"' || r == '\\' {
+			b.WriteByte('\\')
+		}
+		b.WriteRune(r)
+	}
+	b.WriteByte('"')
+	return b.String()
+}
+
+// Parse parses a query. Errors are of type *Error.
+func Parse(s string) (Node, error) {
+	if len(s) > MaxLength {
+		return nil, Errorf(utf8.RuneCountInString(s[:MaxLength])+1, "query must not be more than %d bytes long", MaxLength)
+	}
+	if !utf8.ValidString(s) {
+		return nil, Errorf(1, "query must be valid UTF-8")
+	}
+
+	p := &parser{src: s}
+	p.skipSpace()
+	if p.eof() {
+		return nil, p.errorf("empty query")
+	}
+
+	n, err := p.parseOr(0)
+	if err != nil {
+		return nil, err
+	}
+	if !p.eof() {
+		if p.peek() == ')' {
+			return nil, p.errorf("unexpected )")
+		}
+		return nil, p.errorf("expected AND, OR or end of query")
+	}
+	return n, nil
+}
+
+type parser struct {
+	src string
+	off int // byte offset of the next unread character
+}
+
+// pos converts a byte offset to a 1-based character position.
+func (p *parser) pos(off int) int {
+	return utf8.RuneCountInString(p.src[:off]) + 1
+}
+
+func (p *parser) errorf(format string, args ...any) *Error {
+	return Errorf(p.pos(p.off), format, args...)
+}
+
+func (p *parser) eof() bool {
+	return p.off >= len(p.src)
+}
+
+func (p *parser) peek() byte {
+	return p.src[p.off]
+}
+
+func isSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\r' || c == '\n'
+}
+
+func (p *parser) skipSpace() {
+	for !p.eof() && isSpace(p.peek()) {
+		p.off++
+	}
+}
+
+// keyword reports whether the next word is kw, in any case, standing on its own. It
+// doesn't consume anything.
+func (p *parser) keyword(kw string) bool {
+	end := p.off + len(kw)
+	if end > len(p.src) || !strings.EqualFold(p.src[p.off:end], kw) {
+		return false
+	}
+	return end == len(p.src) || isSpace(p.src[end]) || p.src[end] == '('
+}
+
+func (p *parser) parseOr(depth int) (Node, error) {
+	left, err := p.parseAnd(depth)
+	if err != nil {
+		return nil, err
+	}
+	for p.keyword("OR") {
+		p.off += len("OR")
+		p.skipSpace()
+		right, err := p.parseAnd(depth)
+		if err != nil {
+			return nil, err
+		}
+		left = &Or{Left: left, Right: right}
+	}
+	return left, nil
+}
+
+func (p *parser) parseAnd(depth int) (Node, error) {
+	left, err := p.parseUnary(depth)
+	if err != nil {
+		return nil, err
+	}
+	for !p.eof() && p.peek() != ')' && !p.keyword("OR") {
+		if p.keyword("AND") {
+			p.off += len("AND")
+			p.skipSpace()
+		}
+		right, err := p.parseUnary(depth)
+		if err != nil {
+			return nil, err
+		}
+		left = &And{Left: left, Right: right}
+	}
+	return left, nil
+}
+
+func (p *parser) parseUnary(depth int) (Node, error) {
+	if depth >= MaxDepth {
+		return nil, p.errorf("query is nested more than %d levels deep", MaxDepth)
+	}
+	if p.eof() {
+		return nil, p.errorf("unexpected end of query")
+	}
+
+	start := p.off
+	switch {
+	case p.keyword("NOT"):
+		p.off += len("NOT")
+	case p.peek() == '-':
+		p.off++
+	case p.peek() == '(':
+		p.off++
+		p.skipSpace()
+		n, err := p.parseOr(depth + 1)
+		if err != nil {
+			return nil, err
+		}
+		if p.eof() || p.peek() != ')' {
+			return nil, p.errorf("expected )")
+		}
+		p.off++
+		p.skipSpace()
+		return n, nil
+	default:
+		return p.parseTerm()
+	}
+
+	p.skipSpace()
+	x, err := p.parseUnary(depth + 1)
+	if err != nil {
+		return nil, err
+	}
+	return &Not{X: x, NotPos: p.pos(start)}, nil
+}
+
+func isFieldChar(c byte, first bool) bool {
+	return c == '_' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || !first && c >= '0' && c <= '9'
+}
+
+func (p *parser) parseTerm() (Node, error) {
+	t := &Term{FieldPos: p.pos(p.off)}
+
+	start := p.off
+	for !p.eof() && isFieldChar(p.peek(), p.off == start) {
+		p.off++
+	}
+	if p.off == start {
+		return nil, p.errorf("expected a field name")
+	}
+	t.Field = strings.ToLower(p.src[start:p.off])
+
+	t.OpPos = p.pos(p.off)
+	if err := p.parseOp(t); err != nil {
+		return nil, err
+	}
+
+	t.ValuePos = p.pos(p.off)
+	value, err := p.parseValue()
+	if err != nil {
+		return nil, err
+	}
+	t.Value = value
+
+	p.skipSpace()
+	return t, nil
+}
+
+// parseOp reads ":" optionally followed by a comparison, or a bare comparison.
+func (p *parser) parseOp(t *Term) error {
+	colon := !p.eof() && p.peek() == ':'
+	if colon {
+		p.off++
+	}
+
+	rest := p.src[p.off:]
+	switch {
+	case strings.HasPrefix(rest, ">="):
+		t.Op = Ge
+	case strings.HasPrefix(rest, "<="):
+		t.Op = Le
+	case strings.HasPrefix(rest, ">"):
+		t.Op = Gt
+	case strings.HasPrefix(rest, "<"):
+		t.Op = Lt
+	case colon:
+		t.Op = Match
+		return nil
+	default:
+		return p.errorf("expected :, <, <=, > or >= after field %q", t.Field)
+	}
+	p.off += len(t.Op.String())
+	return nil
+}
+
+// parseValue reads a quoted string or a bare word, which runs to the next space or
+// closing parenthesis.
+func (p *parser) parseValue() (string, error) {
+	if p.eof() || isSpace(p.peek()) || p.peek() == ')' {
+		return "", p.errorf("expected a value")
+	}
+
+	if p.peek() == '"' {
+		return p.parseQuoted()
+	}
+
+	start := p.off
+	for !p.eof() && !isSpace(p.peek()) && p.peek() != ')' {
+		switch p.peek() {
+		case '(', '"', '\\':
+			return "", p.errorf("unexpected %q in value, quote the value to use it", p.peek())
+		}
+		p.off++
+	}
+	return p.src[start:p.off], nil
+}
+
+func (p *parser) parseQuoted() (string, error) {
+	open := p.off
+	p.off++
+
+	var b strings.Builder
+	for !p.eof() {
+		c := p.peek()
+		switch c {
+		case '"':
+			p.off++
+			return b.String(), nil
+		case '\\':
+			p.off++
+			if p.eof() || p.peek() != '"' && p.peek() != '\\' {
+				return "", p.errorf("invalid escape, only \\\" and \\\\ are allowed")
+			}
+			c = p.peek()
+		}
+		b.WriteByte(c)
+		p.off++
+	}
+	return "", Errorf(p.pos(open), "unterminated quoted value")
+}
+
+// Quote returns value as it must be written in a query: as is if it's a bare word,
+// otherwise as a quoted string.
+func Quote(value string) string {
+	return quote(value)
+}
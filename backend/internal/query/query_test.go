@@ -0,0 +1,141 @@
+package query
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name  string
+		query string
+		want  string
+	}{
+		{"term", "name:lobby", "name:lobby"},
+		{"field case", "Name:lobby", "name:lobby"},
+		{"implicit and", "name:lobby site_name:NYC-5th-OPS", "name:lobby AND site_name:NYC-5th-OPS"},
+		{"explicit and", "name:a and name:b", "name:a AND name:b"},
+		{"or", "name:a OR name:b", "name:a OR name:b"},
+		{"and binds tighter", "name:a OR name:b name:c", "name:a OR name:b AND name:c"},
+		{"parentheses", "(name:a OR name:b) name:c", "(name:a OR name:b) AND name:c"},
+		{"right nested", "name:a (name:b name:c)", "name:a AND (name:b AND name:c)"},
+		{"not", "NOT status:online", "NOT status:online"},
+		{"minus", "-status:online", "NOT status:online"},
+		{"not group", "not (name:a or name:b)", "NOT (name:a OR name:b)"},
+		{"comparisons", "created_at:>=2026-01-01 version<3 id:>1 version<=2 id>0",
+			"created_at:>=2026-01-01 AND version:<3 AND id:>1 AND version:<=2 AND id:>0"},
+		{"timestamp value", "created_at:>2026-01-01T10:00:00Z", "created_at:>2026-01-01T10:00:00Z"},
+		{"wildcards", "model_no:P32* site_name:*-GLH", "model_no:P32* AND site_name:*-GLH"},
+		{"quoted", `name:"lobby east"`, `name:"lobby east"`},
+		{"escapes", `name:"say \"hi\" \\"`, `name:"say \"hi\" \\"`},
+		{"empty quoted", `name:""`, `name:""`},
+		{"keyword as field", "or:1 not:2", "or:1 AND not:2"},
+		{"spacing", "  ( name:a )  ", "name:a"},
+		{"example", "model_no:P32* site_name:*-GLH created_at:>=2026-01-01 NOT status:online",
+			"model_no:P32* AND site_name:*-GLH AND created_at:>=2026-01-01 AND NOT status:online"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			n, err := Parse(tt.query)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := n.String(); got != tt.want {
+				t.Errorf("String() = %s; want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseTermPositions(t *testing.T) {
+	n, err := Parse(`name:é name:>="x"`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	term := n.(*And).Right.(*Term)
+	if term.FieldPos != 8 || term.OpPos != 12 || term.ValuePos != 15 || term.Op != Ge || term.Value != "x" {
+		t.Errorf("term = %#v", *term)
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	tests := []struct {
+		name  string
+		query string
+		pos   int
+		msg   string
+	}{
+		{"empty", "", 1, "empty query"},
+		{"blank", "   ", 4, "empty query"},
+		{"no operator", "name", 5, "expected :"},
+		{"no value", "name: site_name:x", 6, "expected a value"},
+		{"no field", ":x", 1, "expected a field name"},
+		{"dangling and", "name:a AND", 11, "unexpected end of query"},
+		{"dangling or", "name:a OR ", 11, "unexpected end of query"},
+		{"dangling not", "NOT", 4, "unexpected end of query"},
+		{"unclosed paren", "(name:a", 8, "expected )"},
+		{"extra paren", "name:a)", 7, "unexpected )"},
+		{"empty parens", "()", 2, "expected a field name"},
+		{"unterminated quote", `name:"abc`, 6, "unterminated"},
+		{"bad escape", `name:"a\n"`, 9, "invalid escape"},
+		{"quote in value", `name:a"b`, 7, "unexpected"},
+		{"position counts characters", "name:é ?", 8, "expected a field name"},
+		{"too deep", strings.Repeat("(", MaxDepth+1) + "a:1" + strings.Repeat(")", MaxDepth+1), MaxDepth + 1, "nested"},
+		{"too long", "name:" + strings.Repeat("a", MaxLength), MaxLength + 1, "must not be more than"},
+		{"invalid utf8", "name:\xff", 1, "UTF-8"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Parse(tt.query)
+			var qerr *Error
+			if !errors.As(err, &qerr) {
+				t.Fatalf("err = %v; want *Error", err)
+			}
+			if qerr.Pos != tt.pos || !strings.Contains(qerr.Msg, tt.msg) {
+				t.Errorf("err = %v; want position %d and %q", qerr, tt.pos, tt.msg)
+			}
+		})
+	}
+}
+
+func FuzzParse(f *testing.F) {
+	for _, seed := range []string{
+		"name:lobby",
+		"model_no:P32* site_name:*-GLH created_at:>=2026-01-01 NOT status:online",
+		"(name:a OR name:b) AND -version:<3",
+		`name:"say \"hi\""`,
+		"not (a:1 or (b:2 c:>3))",
+		"a:1)",
+		`a:"`,
+	} {
+		f.Add(seed)
+	}
+
+	f.Fuzz(func(t *testing.T, s string) {
+		n, err := Parse(s)
+		if err != nil {
+			var qerr *Error
+			if !errors.As(err, &qerr) {
+				t.Fatalf("Parse(%q) returned %T, want *Error", s, err)
+			}
+			if qerr.Pos < 1 || qerr.Pos > utf8.RuneCountInString(s)+1 {
+				t.Fatalf("Parse(%q): position %d out of range", s, qerr.Pos)
+			}
+			return
+		}
+
+		// The canonical form must parse back to the same tree.
+		canonical := n.String()
+		again, err := Parse(canonical)
+		if err != nil {
+			t.Fatalf("Parse(%q) = %s, which doesn't parse: %v", s, canonical, err)
+		}
+		if again.String() != canonical {
+			t.Fatalf("Parse(%q) = %s, which parses to %s", s, canonical, again)
+		}
+	})
+}
@@ -0,0 +1,351 @@
+// Package upgrade rolls firmware upgrade campaigns out to cameras.
+//
+// A Runner claims the cameras of running campaigns from a data.UpgradeRepository,
+// wave by wave and within each campaign's per-site concurrency, which counts the
+// upgrades of every campaign at the site, and upgrades each one: it reads the
+// camera's firmware, uploads the image from the artifact store if the camera isn't
+// already on it, and then asks the camera for its firmware every
+// PollInterval until it reports the image's version or VerifyTimeout passes. The
+// outcome is recorded with the target, which halts the campaign once too many
+// upgrades have failed.
+//
+// Claims are leased for long enough to cover a whole upgrade, so runners on several
+// replicas share the work, and a camera whose runner went away mid-upgrade is
+// picked up again once its lease runs out. A camera found on the new firmware when
+// it's tried again counts as upgraded.
+package upgrade
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/chefgoldbloom/pnctool/backend/internal/data"
+	"github.com/chefgoldbloom/pnctool/backend/internal/device"
+	"github.com/chefgoldbloom/pnctool/backend/internal/events"
+)
+
+// Devices reads cameras' device information and upgrades their firmware.
+// device.Registry is one, going through each camera's driver.
+type Devices interface {
+	Info(ctx context.Context, d device.Device) (*device.Info, error)
+	UpgradeFirmware(ctx context.Context, d device.Device, image io.Reader) error
+}
+
+// Artifacts opens firmware images by their SHA256 digest. artifact.Store is one.
+type Artifacts interface {
+	Open(digest string) (io.ReadCloser, error)
+}
+
+// Config controls how many cameras a Runner upgrades at once and how long it gives
+// them. Zero values are replaced by the defaults of DefaultConfig.
+type Config struct {
+	Tick           time.Duration // how often the runner looks for cameras to upgrade
+	Concurrency    int           // upgrades in flight at once, across every campaign
+	Timeout        time.Duration // for reading a camera's device information
+	UpgradeTimeout time.Duration // for uploading an image and starting the upgrade
+	VerifyTimeout  time.Duration // for the camera to come back on the new firmware
+	PollInterval   time.Duration // between checks while waiting for it
+}
+
+// DefaultConfig upgrades up to eight cameras at once and gives each ten minutes to
+// take the image and ten more to come back on it.
+var DefaultConfig = Config{
+	Tick:           5 * time.Second,
+	Concurrency:    8,
+	Timeout:        10 * time.Second,
+	UpgradeTimeout: 10 * time.Minute,
+	VerifyTimeout:  10 * time.Minute,
+	PollInterval:   15 * time.Second,
+}
+
+// maxErrorLength caps the error kept with a failed upgrade.
+const maxErrorLength = 500
+
+// Runner upgrades the cameras of the campaigns in a data.UpgradeRepository.
+type Runner struct {
+	cfg       Config
+	store     data.UpgradeRepository
+	firmware  data.FirmwareRepository
+	artifacts Artifacts
+	devices   Devices
+	events    events.Publisher
+	logger    *slog.Logger
+	wake      chan struct{}
+
+	// slots holds a token for each upgrade in flight, and wg waits for them.
+	slots chan struct{}
+	wg    sync.WaitGroup
+
+	// now is replaced in tests.
+	now func() time.Time
+}
+
+// New returns a Runner for the campaigns in store, which installs images from
+// artifacts with devices and records the firmware cameras come back on in firmware.
+// If publisher is nil no events are published.
+func New(store data.UpgradeRepository, firmware data.FirmwareRepository, artifacts Artifacts, devices Devices, publisher events.Publisher, logger *slog.Logger, cfg Config) *Runner {
+	if cfg.Tick <= 0 {
+		cfg.Tick = DefaultConfig.Tick
+	}
+	if cfg.Concurrency <= 0 {
+		cfg.Concurrency = DefaultConfig.Concurrency
+	}
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = DefaultConfig.Timeout
+	}
+	if cfg.UpgradeTimeout <= 0 {
+		cfg.UpgradeTimeout = DefaultConfig.UpgradeTimeout
+	}
+	if cfg.VerifyTimeout <= 0 {
+		cfg.VerifyTimeout = DefaultConfig.VerifyTimeout
+	}
+	if cfg.PollInterval <= 0 {
+		cfg.PollInterval = DefaultConfig.PollInterval
+	}
+
+	return &Runner{
+		cfg:       cfg,
+		store:     store,
+		firmware:  firmware,
+		artifacts: artifacts,
+		devices:   devices,
+		events:    publisher,
+		logger:    logger,
+		wake:      make(chan struct{}, 1),
+		slots:     make(chan struct{}, cfg.Concurrency),
+		now:       time.Now,
+	}
+}
+
+// Wake makes a running runner look for cameras to upgrade straight away instead of
+// at its next tick.
+func (r *Runner) Wake() {
+	select {
+	case r.wake <- struct{}{}:
+	default:
+	}
+}
+
+// Run upgrades cameras as campaigns make them available until ctx is cancelled. It
+// returns once the upgrades in flight have stopped; those cameras are picked up
+// again when their leases run out.
+func (r *Runner) Run(ctx context.Context) {
+	ticker := time.NewTicker(r.cfg.Tick)
+	defer ticker.Stop()
+	defer r.wg.Wait()
+
+	for {
+		if _, err := r.Advance(ctx); err != nil && ctx.Err() == nil {
+			r.logger.Error("advancing upgrade campaigns", "error", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-r.wake:
+		}
+	}
+}
+
+// Advance claims as many cameras as there are free upgrade slots and starts
+// upgrading them, returning how many it started. The upgrades carry on after it
+// returns; each wakes the runner when it's done, so the next camera is claimed
+// without waiting for the rest.
+func (r *Runner) Advance(ctx context.Context) (int, error) {
+	free := cap(r.slots) - len(r.slots)
+	if free == 0 || ctx.Err() != nil {
+		return 0, ctx.Err()
+	}
+
+	lease := r.cfg.Timeout + r.cfg.UpgradeTimeout + r.cfg.VerifyTimeout + r.cfg.Tick
+	claimed, err := r.store.Claim(r.now(), lease, free)
+	if err != nil {
+		return 0, err
+	}
+
+	for _, ct := range claimed {
+		r.slots <- struct{}{}
+		r.wg.Add(1)
+		go func(ct *data.ClaimedTarget) {
+			defer func() {
+				<-r.slots
+				r.wg.Done()
+				r.Wake()
+			}()
+			r.upgrade(ctx, ct)
+		}(ct)
+	}
+	return len(claimed), nil
+}
+
+// Wait waits for the upgrades started by Advance to stop.
+func (r *Runner) Wait() {
+	r.wg.Wait()
+}
+
+// upgrade upgrades one camera and records the outcome. Nothing is recorded if ctx
+// is cancelled during the upgrade; the camera is claimed again once its lease runs
+// out.
+func (r *Runner) upgrade(ctx context.Context, ct *data.ClaimedTarget) {
+	target := ct.UpgradeTarget
+	model, err := r.install(ctx, ct, &target)
+	if ctx.Err() != nil {
+		return
+	}
+
+	if err != nil {
+		target.State, target.Error = data.TargetFailed, truncate(err.Error())
+		r.logger.Warn("camera upgrade failed", "campaign_id", target.CampaignID, "camera_id", target.CameraID, "error", err)
+	}
+
+	at := r.now()
+	switch err := r.store.Finish(&target, at); {
+	case errors.Is(err, data.ErrEditConflict):
+		r.logger.Warn("camera upgrade claimed again before it finished", "campaign_id", target.CampaignID, "camera_id", target.CameraID)
+		return
+	case err != nil:
+		r.logger.Error("recording camera upgrade", "campaign_id", target.CampaignID, "camera_id", target.CameraID, "error", err)
+		return
+	}
+
+	if target.State == data.TargetSucceeded {
+		r.record(ct, &target, model, at)
+	}
+}
+
+// install brings the camera onto the image's firmware, filling in target's state and
+// the firmware the camera reported, or returns why it couldn't. It returns the model
+// the camera reports.
+func (r *Runner) install(ctx context.Context, ct *data.ClaimedTarget, target *data.UpgradeTarget) (string, error) {
+	d := device.Device{
+		Addr:       ct.Camera.Address,
+		Username:   ct.Camera.Username,
+		Password:   ct.Camera.Password,
+		ModelNo:    ct.Camera.ModelNo,
+		MacAddress: ct.Camera.MacAddress,
+	}
+	image := ct.Image
+
+	info, err := r.info(ctx, d)
+	if err != nil {
+		return "", fmt.Errorf("reading the camera's firmware: %w", err)
+	}
+	// The camera's model is only checked when it reports one, as not every driver
+	// does; installing another model's image can leave a camera unusable.
+	if info.Model != "" && !strings.Contains(strings.ToUpper(info.Model), strings.ToUpper(image.ModelNo)) {
+		return info.Model, fmt.Errorf("the camera reports model %s, but the image is for %s", info.Model, image.ModelNo)
+	}
+	if target.PreviousFirmware == "" {
+		target.PreviousFirmware = info.Firmware
+	}
+	target.Firmware = info.Firmware
+
+	if data.CompareVersions(info.Firmware, image.Firmware) == 0 {
+		// On a later attempt, the earlier one got as far as installing the image.
+		if target.Attempts > 1 {
+			target.State = data.TargetSucceeded
+		} else {
+			target.State, target.Error = data.TargetSkipped, "the camera already runs "+image.Firmware
+		}
+		return info.Model, nil
+	}
+
+	if err := r.send(ctx, d, image); err != nil {
+		return info.Model, fmt.Errorf("uploading the image: %w", err)
+	}
+
+	// The camera reboots into the new firmware, so it's expected not to answer for a
+	// while.
+	deadline := time.NewTimer(r.cfg.VerifyTimeout)
+	defer deadline.Stop()
+	ticker := time.NewTicker(r.cfg.PollInterval)
+	defer ticker.Stop()
+
+	answered := false
+	for {
+		select {
+		case <-ctx.Done():
+			return info.Model, ctx.Err()
+		case <-deadline.C:
+			if !answered {
+				return info.Model, fmt.Errorf("the camera didn't answer within %s of the upgrade", r.cfg.VerifyTimeout)
+			}
+			return info.Model, fmt.Errorf("the camera still reports %s %s after the upgrade", target.Firmware, r.cfg.VerifyTimeout)
+		case <-ticker.C:
+		}
+
+		after, err := r.info(ctx, d)
+		if err != nil {
+			continue
+		}
+		answered = true
+		target.Firmware = after.Firmware
+		if data.CompareVersions(after.Firmware, image.Firmware) == 0 {
+			target.State = data.TargetSucceeded
+			return after.Model, nil
+		}
+	}
+}
+
+// info reads the camera's device information, giving it Timeout to answer.
+func (r *Runner) info(ctx context.Context, d device.Device) (*device.Info, error) {
+	ctx, cancel := context.WithTimeout(ctx, r.cfg.Timeout)
+	defer cancel()
+	return r.devices.Info(ctx, d)
+}
+
+// send uploads the image to the camera, giving it UpgradeTimeout to take it.
+func (r *Runner) send(ctx context.Context, d device.Device, image data.FirmwareImage) error {
+	f, err := r.artifacts.Open(image.SHA256)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	ctx, cancel := context.WithTimeout(ctx, r.cfg.UpgradeTimeout)
+	defer cancel()
+	return r.devices.UpgradeFirmware(ctx, d, f)
+}
+
+// record keeps the firmware an upgraded camera came back on in its history and
+// publishes camera.firmware_changed, logging any failure.
+func (r *Runner) record(ct *data.ClaimedTarget, target *data.UpgradeTarget, model string, at time.Time) {
+	camera := &ct.Camera
+	previous, err := r.firmware.Record(camera.ID, &data.CameraFirmware{Model: model, Firmware: target.Firmware, CollectedAt: at})
+	switch {
+	case errors.Is(err, data.ErrRecordNotFound):
+		return
+	case err != nil:
+		r.logger.Error("recording camera firmware", "camera_id", camera.ID, "error", err)
+		return
+	}
+	if previous == "" {
+		previous = target.PreviousFirmware
+	}
+	if r.events == nil || previous == target.Firmware {
+		return
+	}
+
+	event, err := data.NewEvent(data.EventCameraFirmwareChanged, camera, map[string]string{
+		"name": camera.Name, "model": model, "firmware": target.Firmware, "previous_firmware": previous,
+	}, at)
+	if err == nil {
+		err = r.events.Publish(event)
+	}
+	if err != nil {
+		r.logger.Error("publishing event", "type", data.EventCameraFirmwareChanged, "camera_id", camera.ID, "error", err)
+	}
+}
+
+func truncate(s string) string {
+	if len(s) > maxErrorLength {
+		return s[:maxErrorLength]
+	}
+	return s
+}
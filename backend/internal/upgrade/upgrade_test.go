@@ -0,0 +1,225 @@
+package upgrade
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/chefgoldbloom/pnctool/backend/internal/artifact"
+	"github.com/chefgoldbloom/pnctool/backend/internal/data"
+	"github.com/chefgoldbloom/pnctool/backend/internal/device"
+	"github.com/chefgoldbloom/pnctool/backend/internal/device/devicetest"
+)
+
+// fakePublisher collects published events.
+type fakePublisher struct {
+	mu     sync.Mutex
+	events []*data.Event
+}
+
+func (f *fakePublisher) Publish(event *data.Event) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.events = append(f.events, event)
+	return nil
+}
+
+func TestRunner(t *testing.T) {
+	lobby := devicetest.NewCamera(device.Info{Vendor: "AXIS", Model: "P3245-LV", Firmware: "10.9.2"})
+	defer lobby.Close()
+	hall := devicetest.NewCamera(device.Info{Vendor: "AXIS", Model: "P3245-LV", Firmware: "11.1.66"})
+	defer hall.Close()
+	gate := devicetest.NewCamera(device.Info{Vendor: "AXIS", Model: "P1375", Firmware: "10.9.2"})
+	defer gate.Close()
+	dock := devicetest.NewCamera(device.Info{Vendor: "AXIS", Model: "P3245-LV", Firmware: "10.9.2"})
+	dock.Close()
+
+	cameras := data.NewMemoryCameraModel()
+	var selected []*data.Camera
+	for _, c := range []*data.Camera{
+		{Name: "lobby", MacAddress: "ACCC8E000001", SiteName: "NYC-5th-GLH", ModelNo: "P3245-LV", Address: lobby.URL},
+		{Name: "hall", MacAddress: "ACCC8E000002", SiteName: "NYC-5th-GLH", ModelNo: "P3245-LV", Address: hall.URL},
+		// Recorded as the image's model, but it says otherwise.
+		{Name: "gate", MacAddress: "ACCC8E000003", SiteName: "NYC-5th-GLH", ModelNo: "P3245-LV", Address: gate.URL},
+		{Name: "dock", MacAddress: "ACCC8E000004", SiteName: "NYC-5th-GLH", ModelNo: "P3245-LV", Address: dock.URL},
+	} {
+		if err := cameras.Insert(c); err != nil {
+			t.Fatal(err)
+		}
+		selected = append(selected, c)
+	}
+
+	store, err := artifact.NewStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	images := data.NewMemoryFirmwareImageModel()
+	upgrades := data.NewMemoryUpgradeModel(cameras, images)
+	upload := func(contents, firmware string) int64 {
+		t.Helper()
+		digest, size, err := store.Put(strings.NewReader(contents))
+		if err != nil {
+			t.Fatal(err)
+		}
+		image := &data.FirmwareImage{ModelNo: "P3245-LV", Firmware: firmware, Size: size, SHA256: digest}
+		if err := images.Insert(image); err != nil {
+			t.Fatal(err)
+		}
+		return image.ID
+	}
+
+	firmware := data.NewMemoryFirmwareModel(cameras)
+	publisher := &fakePublisher{}
+	drivers := device.NewRegistry(device.NewClient(time.Second))
+	cfg := Config{Timeout: time.Second, VerifyTimeout: 300 * time.Millisecond, PollInterval: 10 * time.Millisecond}
+	r := New(upgrades, firmware, store, drivers, publisher, slog.New(slog.NewTextHandler(io.Discard, nil)), cfg)
+
+	c := &data.UpgradeCampaign{Name: "spring", Image: data.FirmwareImage{ID: upload("11.1.66\n", "11.1.66")}, Selection: data.ViewParams{}, WaveSize: 10, SiteConcurrency: 10, MaxFailures: 1}
+	if err := upgrades.Insert(c, selected); err != nil {
+		t.Fatal(err)
+	}
+	if n, err := r.Advance(context.Background()); n != 4 || err != nil {
+		t.Fatalf("Advance = %d, %v; want every camera started", n, err)
+	}
+	r.Wait()
+
+	targets, err := upgrades.Targets(c.ID, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, want := range []struct{ state, firmware, err string }{
+		{data.TargetSucceeded, "11.1.66", ""},
+		{data.TargetSkipped, "11.1.66", "the camera already runs 11.1.66"},
+		{data.TargetFailed, "", "the camera reports model P1375, but the image is for P3245-LV"},
+		{data.TargetFailed, "", "reading the camera's firmware"},
+	} {
+		got := targets[i]
+		if got.State != want.state || got.Firmware != want.firmware || !strings.HasPrefix(got.Error, want.err) || got.FinishedAt == nil {
+			t.Errorf("%s: %+v; want %s on %q, error %q", got.Name, got, want.state, want.firmware, want.err)
+		}
+	}
+	if targets[0].PreviousFirmware != "10.9.2" || lobby.Reboots() != 1 || hall.Reboots() != 0 || gate.Reboots() != 0 {
+		t.Errorf("lobby upgraded from %q; reboots %d, %d, %d; want 10.9.2 and only lobby rebooted",
+			targets[0].PreviousFirmware, lobby.Reboots(), hall.Reboots(), gate.Reboots())
+	}
+
+	got, _ := upgrades.Get(c.ID)
+	if got.State != data.CampaignHalted || got.StateReason != "failed upgrades (2) exceeded max_failures (1)" {
+		t.Errorf("campaign %s (%s); want halted", got.State, got.StateReason)
+	}
+	if recorded, err := firmware.Get(1); err != nil || recorded.Firmware != "11.1.66" || recorded.Model != "P3245-LV" {
+		t.Errorf("lobby's recorded firmware = %+v, %v", recorded, err)
+	}
+	if len(publisher.events) != 1 || publisher.events[0].Type != data.EventCameraFirmwareChanged || publisher.events[0].CameraID != 1 ||
+		!strings.Contains(string(publisher.events[0].Data), `"previous_firmware":"10.9.2"`) {
+		t.Errorf("published %+v; want lobby's firmware change", publisher.events)
+	}
+
+	// An image which doesn't install the version it claims to never verifies.
+	c = &data.UpgradeCampaign{Name: "autumn", Image: data.FirmwareImage{ID: upload("11.1.65", "11.1.67")}, Selection: data.ViewParams{}, WaveSize: 10, SiteConcurrency: 1}
+	if err := upgrades.Insert(c, selected[:1]); err != nil {
+		t.Fatal(err)
+	}
+	if n, err := r.Advance(context.Background()); n != 1 || err != nil {
+		t.Fatalf("Advance = %d, %v; want lobby started", n, err)
+	}
+	r.Wait()
+	targets, _ = upgrades.Targets(c.ID, nil)
+	if targets[0].State != data.TargetFailed || targets[0].Firmware != "11.1.65" || targets[0].Error != "the camera still reports 11.1.65 300ms after the upgrade" {
+		t.Errorf("lobby: %+v; want failed on 11.1.65", targets[0])
+	}
+	if n, _ := r.Advance(context.Background()); n != 0 {
+		t.Errorf("Advance of halted campaigns started %d upgrades", n)
+	}
+}
+
+func TestRunnerCancelled(t *testing.T) {
+	lobby := devicetest.NewCamera(device.Info{Vendor: "AXIS", Model: "P3245-LV", Firmware: "10.9.2"})
+	defer lobby.Close()
+	lobby.SetDelay(time.Second)
+
+	cameras := data.NewMemoryCameraModel()
+	camera := &data.Camera{Name: "lobby", MacAddress: "ACCC8E000001", SiteName: "NYC-5th-GLH", ModelNo: "P3245-LV", Address: lobby.URL}
+	if err := cameras.Insert(camera); err != nil {
+		t.Fatal(err)
+	}
+	images := data.NewMemoryFirmwareImageModel()
+	upgrades := data.NewMemoryUpgradeModel(cameras, images)
+	image := &data.FirmwareImage{ModelNo: "P3245-LV", Firmware: "11.1.66", SHA256: strings.Repeat("0", 64)}
+	if err := images.Insert(image); err != nil {
+		t.Fatal(err)
+	}
+	c := &data.UpgradeCampaign{Name: "spring", Image: *image, Selection: data.ViewParams{}, WaveSize: 10, SiteConcurrency: 1}
+	if err := upgrades.Insert(c, []*data.Camera{camera}); err != nil {
+		t.Fatal(err)
+	}
+
+	store, err := artifact.NewStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := New(upgrades, data.NewMemoryFirmwareModel(cameras), store, device.NewRegistry(device.NewClient(5*time.Second)), nil,
+		slog.New(slog.NewTextHandler(io.Discard, nil)), Config{})
+
+	// Stopping the runner mid-upgrade leaves the camera to be claimed again.
+	ctx, cancel := context.WithCancel(context.Background())
+	if n, err := r.Advance(ctx); n != 1 || err != nil {
+		t.Fatalf("Advance = %d, %v", n, err)
+	}
+	time.AfterFunc(50*time.Millisecond, cancel)
+	r.Wait()
+
+	targets, _ := upgrades.Targets(c.ID, nil)
+	if targets[0].State != data.TargetUpgrading || targets[0].FinishedAt != nil {
+		t.Errorf("after stopping: %+v; want still upgrading", targets[0])
+	}
+}
+
+// A camera slower than the device client's own timeout is still upgraded, as the
+// runner's deadlines replace it.
+func TestRunnerSlowCamera(t *testing.T) {
+	lobby := devicetest.NewCamera(device.Info{Vendor: "AXIS", Model: "P3245-LV", Firmware: "10.9.2"})
+	defer lobby.Close()
+	lobby.SetDelay(100 * time.Millisecond)
+
+	cameras := data.NewMemoryCameraModel()
+	camera := &data.Camera{Name: "lobby", MacAddress: "ACCC8E000001", SiteName: "NYC-5th-GLH", ModelNo: "P3245-LV", Address: lobby.URL}
+	if err := cameras.Insert(camera); err != nil {
+		t.Fatal(err)
+	}
+	store, err := artifact.NewStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	digest, size, err := store.Put(strings.NewReader("11.1.66\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	images := data.NewMemoryFirmwareImageModel()
+	image := &data.FirmwareImage{ModelNo: "P3245-LV", Firmware: "11.1.66", Size: size, SHA256: digest}
+	if err := images.Insert(image); err != nil {
+		t.Fatal(err)
+	}
+	upgrades := data.NewMemoryUpgradeModel(cameras, images)
+	c := &data.UpgradeCampaign{Name: "spring", Image: *image, Selection: data.ViewParams{}, WaveSize: 10, SiteConcurrency: 1}
+	if err := upgrades.Insert(c, []*data.Camera{camera}); err != nil {
+		t.Fatal(err)
+	}
+
+	drivers := device.NewRegistry(device.NewClient(20 * time.Millisecond))
+	cfg := Config{Timeout: time.Second, UpgradeTimeout: time.Second, VerifyTimeout: time.Second, PollInterval: 10 * time.Millisecond}
+	r := New(upgrades, data.NewMemoryFirmwareModel(cameras), store, drivers, nil, slog.New(slog.NewTextHandler(io.Discard, nil)), cfg)
+	if n, err := r.Advance(context.Background()); n != 1 || err != nil {
+		t.Fatalf("Advance = %d, %v", n, err)
+	}
+	r.Wait()
+
+	targets, _ := upgrades.Targets(c.ID, nil)
+	if targets[0].State != data.TargetSucceeded || lobby.Reboots() != 1 {
+		t.Errorf("lobby: %+v, %d reboots; want upgraded", targets[0], lobby.Reboots())
+	}
+}
@@ -11,14 +11,31 @@ var (
 	siteNameRxp = regexp.MustCompile(".*-.*-(OPS|COE|GLH)$")
 )
 
-// Define Validator type which contains a map of validation errors
+// Machine-readable codes recorded alongside validation messages. Clients should
+// switch on these rather than on the human-readable message text.
+const (
+	CodeInvalid      = "invalid"
+	CodeRequired     = "required"
+	CodeTooLong      = "too_long"
+	CodeBadLength    = "bad_length"
+	CodeBadFormat    = "bad_format"
+	CodeOutOfRange   = "out_of_range"
+	CodeNotPermitted = "not_permitted"
+	CodeNotInteger   = "not_integer"
+	CodeReadOnly     = "read_only"
+	CodeDuplicate    = "duplicate"
+)
+
+// Define Validator type which contains a map of validation errors and a parallel
+// map of error codes keyed by the same field name
 type Validator struct {
 	Errors map[string]string
+	Codes  map[string]string
 }
 
-// New is a helper that creates a new Validator instance with an empty errors map
+// New is a helper that creates a new Validator instance with empty errors and codes maps
 func New() *Validator {
-	return &Validator{Errors: make(map[string]string)}
+	return &Validator{Errors: make(map[string]string), Codes: make(map[string]string)}
 }
 
 // Valid returns true if the errors map doesn't contain any entries.
@@ -27,18 +44,40 @@ func (v *Validator) Valid() bool {
 }
 
 // AddError adds an error message to the map (so long as no entry already exists
-// for the given key)
+// for the given key). The error is recorded with the generic CodeInvalid code.
 func (v *Validator) AddError(key, errMsg string) {
+	v.AddErrorCode(key, CodeInvalid, errMsg)
+}
+
+// AddErrorCode adds an error message and its machine-readable code to the maps (so
+// long as no entry already exists for the given key)
+func (v *Validator) AddErrorCode(key, code, errMsg string) {
 	if _, ok := v.Errors[key]; !ok {
 		v.Errors[key] = errMsg
+		v.Codes[key] = code
 	}
 }
 
 // Check adds an error message to the map only if a validation check is not 'ok'
 func (v *Validator) Check(ok bool, key, message string) {
+	v.CheckCode(ok, key, CodeInvalid, message)
+}
+
+// CheckCode adds an error message and code to the maps only if a validation check
+// is not 'ok'
+func (v *Validator) CheckCode(ok bool, key, code, message string) {
 	if !ok {
-		v.AddError(key, message)
+		v.AddErrorCode(key, code, message)
+	}
+}
+
+// Code returns the machine-readable code recorded for key, falling back to
+// CodeInvalid for errors added directly to the Errors map.
+func (v *Validator) Code(key string) string {
+	if code, ok := v.Codes[key]; ok {
+		return code
 	}
+	return CodeInvalid
 }
 
 // Generic function which returns true if specific value is in a list of permitted
@@ -0,0 +1,55 @@
+package validator
+
+import "testing"
+
+func TestCodes(t *testing.T) {
+	tests := []struct {
+		name  string
+		check func(v *Validator)
+		valid bool
+		code  string
+		msg   string
+	}{
+		{"passing check", func(v *Validator) { v.Check(true, "name", "must be provided") }, true, "", ""},
+		{"passing check code", func(v *Validator) { v.CheckCode(true, "name", CodeRequired, "must be provided") }, true, "", ""},
+		{"check", func(v *Validator) { v.Check(false, "name", "must be provided") }, false, CodeInvalid, "must be provided"},
+		{"check code", func(v *Validator) { v.CheckCode(false, "name", CodeRequired, "must be provided") }, false, CodeRequired, "must be provided"},
+		{"add error", func(v *Validator) { v.AddError("name", "is wrong") }, false, CodeInvalid, "is wrong"},
+		{"add error code", func(v *Validator) { v.AddErrorCode("name", CodeTooLong, "is too long") }, false, CodeTooLong, "is too long"},
+		{"first error wins", func(v *Validator) {
+			v.CheckCode(false, "name", CodeRequired, "must be provided")
+			v.CheckCode(false, "name", CodeTooLong, "is too long")
+		}, false, CodeRequired, "must be provided"},
+		{"passing check keeps error", func(v *Validator) {
+			v.CheckCode(false, "name", CodeBadFormat, "is badly formatted")
+			v.CheckCode(true, "name", CodeRequired, "must be provided")
+		}, false, CodeBadFormat, "is badly formatted"},
+		{"errors map only", func(v *Validator) { v.Errors["name"] = "is wrong" }, false, CodeInvalid, "is wrong"},
+	}
+
+	for _, tt := range tests {
+		v := New()
+		tt.check(v)
+		if v.Valid() != tt.valid {
+			t.Errorf("%s: Valid = %t; want %t", tt.name, v.Valid(), tt.valid)
+		}
+		if tt.valid {
+			if len(v.Codes) != 0 {
+				t.Errorf("%s: Codes = %v; want none", tt.name, v.Codes)
+			}
+			continue
+		}
+		if got := v.Code("name"); got != tt.code {
+			t.Errorf("%s: Code = %q; want %q", tt.name, got, tt.code)
+		}
+		if got := v.Errors["name"]; got != tt.msg {
+			t.Errorf("%s: error = %q; want %q", tt.name, got, tt.msg)
+		}
+	}
+}
+
+func TestCodeUnknownKey(t *testing.T) {
+	if got := New().Code("name"); got != CodeInvalid {
+		t.Errorf("Code = %q; want %q", got, CodeInvalid)
+	}
+}
@@ -0,0 +1,262 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/chefgoldbloom/pnctool/backend/internal/data"
+)
+
+// Config controls how a Dispatcher makes deliveries. Zero values are replaced by the
+// defaults of DefaultConfig.
+type Config struct {
+	Tick        time.Duration // how often the dispatcher looks for deliveries which are due
+	Timeout     time.Duration // for one attempt
+	Concurrency int           // attempts in flight at once
+	Batch       int           // deliveries claimed at once
+	MaxAttempts int           // attempts before a delivery is dead
+	Backoff     time.Duration // before the first retry, doubled for each one after
+	MaxBackoff  time.Duration // longest wait between attempts
+}
+
+// DefaultConfig makes four deliveries at a time and tries each eight times over
+// about an hour before giving up on it.
+var DefaultConfig = Config{
+	Tick:        time.Second,
+	Timeout:     10 * time.Second,
+	Concurrency: 4,
+	Batch:       20,
+	MaxAttempts: 8,
+	Backoff:     30 * time.Second,
+	MaxBackoff:  time.Hour,
+}
+
+// maxErrorLength caps the error kept with a failed delivery.
+const maxErrorLength = 500
+
+// Dispatcher makes the deliveries queued in a data.WebhookRepository.
+type Dispatcher struct {
+	cfg    Config
+	store  data.WebhookRepository
+	client *http.Client
+	logger *slog.Logger
+	wake   chan struct{}
+
+	// now is replaced in tests.
+	now func() time.Time
+}
+
+// New returns a Dispatcher for the deliveries in store.
+func New(store data.WebhookRepository, logger *slog.Logger, cfg Config) *Dispatcher {
+	if cfg.Tick <= 0 {
+		cfg.Tick = DefaultConfig.Tick
+	}
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = DefaultConfig.Timeout
+	}
+	if cfg.Concurrency <= 0 {
+		cfg.Concurrency = DefaultConfig.Concurrency
+	}
+	if cfg.Batch <= 0 {
+		cfg.Batch = DefaultConfig.Batch
+	}
+	if cfg.MaxAttempts <= 0 {
+		cfg.MaxAttempts = DefaultConfig.MaxAttempts
+	}
+	if cfg.Backoff <= 0 {
+		cfg.Backoff = DefaultConfig.Backoff
+	}
+	if cfg.MaxBackoff < cfg.Backoff {
+		cfg.MaxBackoff = max(DefaultConfig.MaxBackoff, cfg.Backoff)
+	}
+
+	return &Dispatcher{
+		cfg:   cfg,
+		store: store,
+		// Receivers are expected to answer at the URL they gave, so redirects are
+		// reported as failures rather than followed.
+		client: &http.Client{
+			CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse },
+		},
+		logger: logger,
+		wake:   make(chan struct{}, 1),
+		now:    time.Now,
+	}
+}
+
+// Enqueue queues deliveries of the event to the webhooks subscribed to it and wakes
+// the dispatcher. It's meant to subscribe to an events.Bus, so errors are logged.
+func (d *Dispatcher) Enqueue(event *data.Event) {
+	n, err := d.store.Enqueue(event)
+	if err != nil {
+		d.logger.Error("queueing webhook deliveries", "event_id", event.ID, "type", event.Type, "error", err)
+		return
+	}
+	if n > 0 {
+		d.Wake()
+	}
+}
+
+// Wake makes a running dispatcher look for deliveries straight away instead of at
+// its next tick.
+func (d *Dispatcher) Wake() {
+	select {
+	case d.wake <- struct{}{}:
+	default:
+	}
+}
+
+// Run makes deliveries as they fall due until ctx is cancelled. It returns once the
+// attempts in flight have finished.
+func (d *Dispatcher) Run(ctx context.Context) {
+	ticker := time.NewTicker(d.cfg.Tick)
+	defer ticker.Stop()
+
+	for {
+		if _, err := d.Dispatch(ctx); err != nil && ctx.Err() == nil {
+			d.logger.Error("dispatching webhooks", "error", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-d.wake:
+		}
+	}
+}
+
+// Dispatch makes every delivery which is due, waiting for the attempts to finish,
+// and returns how many were made.
+func (d *Dispatcher) Dispatch(ctx context.Context) (int, error) {
+	// A claimed delivery isn't claimed again until its lease runs out, which leaves
+	// time for the attempt if a dispatcher on another replica is looking too.
+	lease := 2*d.cfg.Timeout + d.cfg.Tick
+
+	total := 0
+	for {
+		pending, err := d.store.Claim(d.now(), lease, d.cfg.Batch)
+		if err != nil {
+			return total, err
+		}
+
+		sem := make(chan struct{}, d.cfg.Concurrency)
+		var wg sync.WaitGroup
+		for _, p := range pending {
+			select {
+			case sem <- struct{}{}:
+			case <-ctx.Done():
+				wg.Wait()
+				return total, ctx.Err()
+			}
+			wg.Add(1)
+			go func(p *data.PendingDelivery) {
+				defer func() {
+					<-sem
+					wg.Done()
+				}()
+				d.attempt(ctx, p)
+			}(p)
+		}
+		wg.Wait()
+
+		total += len(pending)
+		if len(pending) < d.cfg.Batch || ctx.Err() != nil {
+			return total, ctx.Err()
+		}
+	}
+}
+
+// attempt POSTs one delivery and records the outcome. Nothing is recorded if ctx is
+// cancelled during the attempt; the delivery is claimed again once its lease runs
+// out.
+func (d *Dispatcher) attempt(ctx context.Context, p *data.PendingDelivery) {
+	statusCode, err := d.post(ctx, p)
+	if ctx.Err() != nil {
+		return
+	}
+
+	now := d.now()
+	delivery := p.WebhookDelivery
+	delivery.Attempts++
+	delivery.LastAttemptAt = &now
+	delivery.LastStatusCode = nil
+	if statusCode != 0 {
+		delivery.LastStatusCode = &statusCode
+	}
+
+	switch {
+	case err == nil:
+		delivery.State, delivery.LastError = data.DeliveryDelivered, ""
+		delivery.NextAttemptAt, delivery.DeliveredAt = nil, &now
+	case delivery.Attempts >= d.cfg.MaxAttempts:
+		delivery.State, delivery.LastError = data.DeliveryDead, truncate(err.Error())
+		delivery.NextAttemptAt = nil
+		d.logger.Warn("webhook delivery dead", "delivery_id", delivery.ID, "webhook_id", delivery.WebhookID, "attempts", delivery.Attempts, "error", err)
+	default:
+		next := now.Add(d.backoff(delivery.Attempts))
+		delivery.LastError, delivery.NextAttemptAt = truncate(err.Error()), &next
+	}
+
+	if err := d.store.SaveAttempt(&delivery); err != nil {
+		d.logger.Error("saving webhook delivery", "delivery_id", delivery.ID, "error", err)
+	}
+}
+
+// post sends the delivery and returns the receiver's status code, or 0 if there was
+// no response. Any status but 2xx is an error.
+func (d *Dispatcher) post(ctx context.Context, p *data.PendingDelivery) (int, error) {
+	body, err := json.Marshal(p.Event)
+	if err != nil {
+		return 0, err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, d.cfg.Timeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, p.URL, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "pnctool-webhook/1.0")
+	req.Header.Set(HeaderEvent, p.Event.Type)
+	req.Header.Set(HeaderDelivery, strconv.FormatInt(p.ID, 10))
+	req.Header.Set(HeaderSignature, Sign(p.Secret, d.now(), body))
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return resp.StatusCode, fmt.Errorf("receiver answered %s", resp.Status)
+	}
+	return resp.StatusCode, nil
+}
+
+// backoff is the wait before the next attempt after the given number of failed
+// ones: Backoff, doubled for each failure after the first, up to MaxBackoff.
+func (d *Dispatcher) backoff(attempts int) time.Duration {
+	wait := d.cfg.Backoff
+	for i := 1; i < attempts && wait < d.cfg.MaxBackoff; i++ {
+		wait *= 2
+	}
+	return min(wait, d.cfg.MaxBackoff)
+}
+
+func truncate(s string) string {
+	if len(s) > maxErrorLength {
+		return s[:maxErrorLength]
+	}
+	return s
+}
@@ -0,0 +1,167 @@
+package webhook
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/chefgoldbloom/pnctool/backend/internal/data"
+	"github.com/chefgoldbloom/pnctool/backend/internal/webhook/webhooktest"
+)
+
+const testSecret = "whsec_0123456789abcdef"
+
+// testDispatcher returns a dispatcher over fresh in-memory stores, with a clock the
+// test moves, and a receiver subscribed to every event.
+func testDispatcher(t *testing.T, cfg Config) (*Dispatcher, *data.MemoryEventModel, *data.MemoryWebhookModel, *webhooktest.Receiver, *time.Time) {
+	t.Helper()
+
+	receiver := webhooktest.NewReceiver(testSecret)
+	t.Cleanup(receiver.Close)
+
+	events := data.NewMemoryEventModel()
+	store := data.NewMemoryWebhookModel(events)
+	if err := store.Insert(&data.Webhook{URL: receiver.URL, Secret: testSecret, Active: true}); err != nil {
+		t.Fatal(err)
+	}
+
+	d := New(store, slog.New(slog.NewTextHandler(io.Discard, nil)), cfg)
+	now := time.Date(2026, 3, 2, 9, 0, 0, 0, time.UTC)
+	d.now = func() time.Time { return now }
+	return d, events, store, receiver, &now
+}
+
+// publish logs an event at now and queues it, as the bus does.
+func publish(t *testing.T, d *Dispatcher, events *data.MemoryEventModel, eventType string, now time.Time) *data.Event {
+	t.Helper()
+	camera := &data.Camera{ID: 1, Name: "lobby", SiteName: "NYC-5th-OPS"}
+	event, err := data.NewEvent(eventType, camera, camera, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := events.Insert(event); err != nil {
+		t.Fatal(err)
+	}
+	d.Enqueue(event)
+	return event
+}
+
+func TestDispatcherDelivers(t *testing.T) {
+	d, events, store, receiver, now := testDispatcher(t, Config{})
+	event := publish(t, d, events, data.EventCameraOffline, *now)
+
+	if n, err := d.Dispatch(context.Background()); n != 1 || err != nil {
+		t.Fatalf("Dispatch = %d, %v; want 1", n, err)
+	}
+
+	got := receiver.Deliveries()
+	if len(got) != 1 {
+		t.Fatalf("receiver got %d deliveries; want 1", len(got))
+	}
+	if !got[0].Signed || got[0].Event != data.EventCameraOffline || got[0].ID != "1" || got[0].Status != http.StatusNoContent {
+		t.Errorf("delivery = %+v; want a signed camera.offline delivery 1", got[0])
+	}
+	var body data.Event
+	if err := json.Unmarshal(got[0].Body, &body); err != nil {
+		t.Fatal(err)
+	}
+	if body.ID != event.ID || body.Type != event.Type || body.SiteName != "NYC-5th-OPS" || !body.OccurredAt.Equal(event.OccurredAt) {
+		t.Errorf("body = %+v; want event %+v", body, event)
+	}
+
+	delivery, err := store.GetDelivery(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if delivery.State != data.DeliveryDelivered || delivery.Attempts != 1 || *delivery.LastStatusCode != http.StatusNoContent || !delivery.DeliveredAt.Equal(*now) || delivery.NextAttemptAt != nil {
+		t.Errorf("delivery = %+v; want delivered on the first attempt", delivery)
+	}
+
+	// Nothing is left to do.
+	if n, _ := d.Dispatch(context.Background()); n != 0 {
+		t.Errorf("second Dispatch = %d; want 0", n)
+	}
+}
+
+func TestDispatcherRetries(t *testing.T) {
+	d, events, store, receiver, now := testDispatcher(t, Config{MaxAttempts: 4, Backoff: time.Minute, MaxBackoff: 3 * time.Minute})
+	publish(t, d, events, data.EventCameraCreated, *now)
+	receiver.Fail(10, http.StatusInternalServerError)
+
+	// Each failure puts the next attempt back further: 1, 2, then 3 minutes, capped
+	// by MaxBackoff. The fourth failure is the last.
+	for i, wait := range []time.Duration{time.Minute, 2 * time.Minute, 3 * time.Minute} {
+		if n, _ := d.Dispatch(context.Background()); n != 1 {
+			t.Fatalf("attempt %d: Dispatch = %d; want 1", i+1, n)
+		}
+		delivery, _ := store.GetDelivery(1)
+		if delivery.State != data.DeliveryPending || delivery.Attempts != i+1 || *delivery.LastStatusCode != 500 ||
+			delivery.LastError != "receiver answered 500 Internal Server Error" || !delivery.NextAttemptAt.Equal(now.Add(wait)) {
+			t.Fatalf("after attempt %d delivery = %+v; want another attempt in %v", i+1, delivery, wait)
+		}
+
+		// Not due yet.
+		*now = now.Add(wait - time.Second)
+		if n, _ := d.Dispatch(context.Background()); n != 0 {
+			t.Fatalf("Dispatch before the retry is due = %d; want 0", n)
+		}
+		*now = now.Add(time.Second)
+	}
+
+	d.Dispatch(context.Background())
+	delivery, _ := store.GetDelivery(1)
+	if delivery.State != data.DeliveryDead || delivery.Attempts != 4 || delivery.NextAttemptAt != nil {
+		t.Fatalf("after the last attempt delivery = %+v; want dead", delivery)
+	}
+	if n, _ := d.Dispatch(context.Background()); n != 0 {
+		t.Errorf("Dispatch of a dead delivery = %d; want 0", n)
+	}
+
+	// Once the receiver is fixed, a redelivery goes through.
+	receiver.Fail(0, 0)
+	if _, err := store.Redeliver(1, *now); err != nil {
+		t.Fatal(err)
+	}
+	d.Dispatch(context.Background())
+	delivery, _ = store.GetDelivery(1)
+	if delivery.State != data.DeliveryDelivered || delivery.Attempts != 1 || delivery.LastError != "" {
+		t.Errorf("after redelivery delivery = %+v; want delivered", delivery)
+	}
+	if got := len(receiver.Deliveries()); got != 5 {
+		t.Errorf("receiver got %d requests; want 5", got)
+	}
+}
+
+func TestDispatcherUnreachable(t *testing.T) {
+	d, events, store, receiver, now := testDispatcher(t, Config{Timeout: time.Second})
+	receiver.Close()
+	publish(t, d, events, data.EventCameraOnline, *now)
+
+	d.Dispatch(context.Background())
+	delivery, _ := store.GetDelivery(1)
+	if delivery.State != data.DeliveryPending || delivery.Attempts != 1 || delivery.LastStatusCode != nil || delivery.LastError == "" {
+		t.Errorf("delivery = %+v; want a failed attempt without a status code", delivery)
+	}
+}
+
+func TestDispatcherWrongSecret(t *testing.T) {
+	d, events, store, receiver, now := testDispatcher(t, Config{})
+	w, _ := store.Get(1)
+	w.Secret = "whsec_not-the-receivers"
+	if err := store.Update(w); err != nil {
+		t.Fatal(err)
+	}
+	publish(t, d, events, data.EventCameraDeleted, *now)
+
+	d.Dispatch(context.Background())
+	if got := receiver.Deliveries(); len(got) != 1 || got[0].Signed || got[0].Status != http.StatusUnauthorized {
+		t.Errorf("receiver got %+v; want one unsigned delivery refused", got)
+	}
+	if delivery, _ := store.GetDelivery(1); delivery.State != data.DeliveryPending || *delivery.LastStatusCode != http.StatusUnauthorized {
+		t.Errorf("delivery = %+v; want to retry after 401", delivery)
+	}
+}
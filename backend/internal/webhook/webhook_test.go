@@ -0,0 +1,45 @@
+package webhook
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSignVerify(t *testing.T) {
+	secret := "whsec_0123456789abcdef"
+	body := []byte(`{"id":1,"type":"camera.offline"}`)
+	signedAt := time.Date(2026, 3, 2, 9, 0, 0, 0, time.UTC)
+	header := Sign(secret, signedAt, body)
+
+	if !strings.HasPrefix(header, "t=1772442000,v1=") {
+		t.Errorf("header = %q; want t=1772442000,v1=...", header)
+	}
+
+	tests := []struct {
+		name   string
+		secret string
+		header string
+		body   string
+		now    time.Time
+		want   error
+	}{
+		{"valid", secret, header, string(body), signedAt.Add(time.Minute), nil},
+		{"other secret", "whsec_fedcba9876543210", header, string(body), signedAt, ErrBadSignature},
+		{"changed body", secret, header, `{"id":2,"type":"camera.offline"}`, signedAt, ErrBadSignature},
+		{"changed timestamp", secret, strings.Replace(header, "t=1772442000", "t=1772442060", 1), string(body), signedAt, ErrBadSignature},
+		{"missing", secret, "", string(body), signedAt, ErrBadSignature},
+		{"malformed", secret, "v1=abc", string(body), signedAt, ErrBadSignature},
+		{"too old", secret, header, string(body), signedAt.Add(time.Hour), ErrExpiredSignature},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := Verify(tt.secret, tt.header, []byte(tt.body), tt.now, 5*time.Minute)
+			if !errors.Is(err, tt.want) {
+				t.Errorf("Verify = %v; want %v", err, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,14 @@
+CREATE TABLE IF NOT EXISTS idempotency_keys(
+    key text NOT NULL,
+    method text NOT NULL,
+    path text NOT NULL,
+    request_hash text NOT NULL,
+    status integer,
+    headers jsonb NOT NULL DEFAULT '{}',
+    body bytea,
+    created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    expires_at timestamp(0) with time zone NOT NULL,
+    PRIMARY KEY (key, method, path)
+);
+
+CREATE INDEX IF NOT EXISTS idempotency_keys_expires_at_idx ON idempotency_keys (expires_at);
@@ -0,0 +1,5 @@
+DROP INDEX IF EXISTS cameras_model_no_idx;
+DROP INDEX IF EXISTS cameras_site_name_idx;
+DROP TABLE IF EXISTS camera_status;
+DROP TABLE IF EXISTS camera_models;
+DROP TABLE IF EXISTS sites;
@@ -0,0 +1,27 @@
+CREATE TABLE IF NOT EXISTS sites(
+    name text PRIMARY KEY,
+    city text NOT NULL DEFAULT '',
+    street text NOT NULL DEFAULT '',
+    office_type text NOT NULL DEFAULT '',
+    address text NOT NULL DEFAULT '',
+    timezone text NOT NULL DEFAULT 'UTC',
+    created_at timestamp(0) with time zone NOT NULL DEFAULT NOW()
+);
+
+CREATE TABLE IF NOT EXISTS camera_models(
+    model_no text PRIMARY KEY,
+    vendor text NOT NULL DEFAULT '',
+    description text NOT NULL DEFAULT '',
+    created_at timestamp(0) with time zone NOT NULL DEFAULT NOW()
+);
+
+CREATE TABLE IF NOT EXISTS camera_status(
+    camera_id bigint PRIMARY KEY REFERENCES cameras ON DELETE CASCADE,
+    status text NOT NULL DEFAULT 'unknown',
+    latency_ms integer,
+    last_seen_at timestamp(0) with time zone,
+    checked_at timestamp(0) with time zone NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS cameras_site_name_idx ON cameras (site_name);
+CREATE INDEX IF NOT EXISTS cameras_model_no_idx ON cameras (model_no);
@@ -0,0 +1,6 @@
+DROP INDEX IF EXISTS cameras_model_no_trgm_idx;
+DROP INDEX IF EXISTS cameras_site_name_trgm_idx;
+DROP INDEX IF EXISTS cameras_name_trgm_idx;
+DROP INDEX IF EXISTS cameras_search_text_trgm_idx;
+DROP INDEX IF EXISTS cameras_search_vector_idx;
+ALTER TABLE cameras DROP COLUMN IF EXISTS search_vector;
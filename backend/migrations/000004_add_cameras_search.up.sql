@@ -0,0 +1,20 @@
+-- pg_trgm lives in public so every schema on the search_path can use its operators.
+CREATE EXTENSION IF NOT EXISTS pg_trgm WITH SCHEMA public;
+
+ALTER TABLE cameras ADD COLUMN IF NOT EXISTS search_vector tsvector GENERATED ALWAYS AS (
+    setweight(to_tsvector('simple', name), 'A') ||
+    setweight(to_tsvector('simple', replace(site_name, '-', ' ')), 'B') ||
+    setweight(to_tsvector('simple', model_no), 'C') ||
+    setweight(to_tsvector('simple', mac_address), 'D')
+) STORED;
+
+CREATE INDEX IF NOT EXISTS cameras_search_vector_idx ON cameras USING GIN (search_vector);
+
+-- Must match searchText in internal/data/search.go for the planner to use it.
+CREATE INDEX IF NOT EXISTS cameras_search_text_trgm_idx ON cameras
+    USING GIN (lower(name || ' ' || site_name || ' ' || model_no || ' ' || mac_address) gin_trgm_ops);
+
+-- Typeahead suggestions match each column on its own.
+CREATE INDEX IF NOT EXISTS cameras_name_trgm_idx ON cameras USING GIN (lower(name) gin_trgm_ops);
+CREATE INDEX IF NOT EXISTS cameras_site_name_trgm_idx ON cameras USING GIN (lower(site_name) gin_trgm_ops);
+CREATE INDEX IF NOT EXISTS cameras_model_no_trgm_idx ON cameras USING GIN (lower(model_no) gin_trgm_ops);
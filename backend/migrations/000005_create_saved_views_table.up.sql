@@ -0,0 +1,15 @@
+CREATE TABLE IF NOT EXISTS saved_views(
+    id bigserial PRIMARY KEY,
+    created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    owner text NOT NULL,
+    team text NOT NULL DEFAULT '',
+    name text NOT NULL,
+    visibility text NOT NULL CHECK (visibility IN ('private', 'team')),
+    params jsonb NOT NULL DEFAULT '{}',
+    syntax integer NOT NULL,
+    pinned boolean NOT NULL DEFAULT false,
+    version integer NOT NULL DEFAULT 1,
+    CONSTRAINT saved_views_owner_name_key UNIQUE (owner, name)
+);
+
+CREATE INDEX IF NOT EXISTS saved_views_team_idx ON saved_views (team) WHERE visibility = 'team';
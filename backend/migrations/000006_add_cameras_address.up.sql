@@ -0,0 +1 @@
+ALTER TABLE cameras ADD COLUMN IF NOT EXISTS address text NOT NULL DEFAULT '';
@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS maintenance_windows;
+DROP TABLE IF EXISTS camera_status_history;
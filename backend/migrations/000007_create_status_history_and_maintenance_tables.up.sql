@@ -0,0 +1,21 @@
+CREATE TABLE IF NOT EXISTS camera_status_history(
+    id bigserial PRIMARY KEY,
+    camera_id bigint NOT NULL REFERENCES cameras ON DELETE CASCADE,
+    status text NOT NULL,
+    changed_at timestamp(0) with time zone NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS camera_status_history_camera_id_changed_at_idx ON camera_status_history (camera_id, changed_at);
+
+-- An empty site_name means the window applies to every site.
+CREATE TABLE IF NOT EXISTS maintenance_windows(
+    id bigserial PRIMARY KEY,
+    created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    site_name text NOT NULL DEFAULT '',
+    starts_at timestamp(0) with time zone NOT NULL,
+    ends_at timestamp(0) with time zone NOT NULL,
+    reason text NOT NULL DEFAULT '',
+    CHECK (ends_at > starts_at)
+);
+
+CREATE INDEX IF NOT EXISTS maintenance_windows_starts_at_idx ON maintenance_windows (starts_at);
@@ -0,0 +1,27 @@
+CREATE TABLE IF NOT EXISTS incidents(
+    id bigserial PRIMARY KEY,
+    camera_id bigint NOT NULL REFERENCES cameras ON DELETE CASCADE,
+    state text NOT NULL DEFAULT 'open' CHECK (state IN ('open', 'acknowledged', 'resolved')),
+    failures integer NOT NULL,
+    opened_at timestamp(0) with time zone NOT NULL,
+    acknowledged_at timestamp(0) with time zone,
+    acknowledged_by text NOT NULL DEFAULT '',
+    resolved_at timestamp(0) with time zone,
+    resolved_by text NOT NULL DEFAULT '',
+    assignee text NOT NULL DEFAULT '',
+    version integer NOT NULL DEFAULT 1
+);
+
+-- A camera has at most one incident which isn't resolved.
+CREATE UNIQUE INDEX IF NOT EXISTS incidents_camera_id_unresolved_idx ON incidents (camera_id) WHERE state <> 'resolved';
+CREATE INDEX IF NOT EXISTS incidents_opened_at_idx ON incidents (opened_at);
+
+CREATE TABLE IF NOT EXISTS incident_notes(
+    id bigserial PRIMARY KEY,
+    incident_id bigint NOT NULL REFERENCES incidents ON DELETE CASCADE,
+    created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    author text NOT NULL,
+    body text NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS incident_notes_incident_id_idx ON incident_notes (incident_id);
@@ -0,0 +1,42 @@
+-- events is the log of everything which happened to cameras. camera_id isn't a
+-- foreign key, so the events of deleted cameras are kept.
+CREATE TABLE IF NOT EXISTS events(
+    id bigserial PRIMARY KEY,
+    type text NOT NULL,
+    camera_id bigint NOT NULL DEFAULT 0,
+    site_name text NOT NULL DEFAULT '',
+    occurred_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    data jsonb NOT NULL DEFAULT '{}'
+);
+
+CREATE INDEX IF NOT EXISTS events_occurred_at_idx ON events (occurred_at);
+
+-- An empty event_types array subscribes to every event type.
+CREATE TABLE IF NOT EXISTS webhook_subscriptions(
+    id bigserial PRIMARY KEY,
+    created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    url text NOT NULL,
+    secret text NOT NULL,
+    event_types jsonb NOT NULL DEFAULT '[]',
+    description text NOT NULL DEFAULT '',
+    active boolean NOT NULL DEFAULT true,
+    version integer NOT NULL DEFAULT 1
+);
+
+CREATE TABLE IF NOT EXISTS webhook_deliveries(
+    id bigserial PRIMARY KEY,
+    subscription_id bigint NOT NULL REFERENCES webhook_subscriptions ON DELETE CASCADE,
+    event_id bigint NOT NULL REFERENCES events ON DELETE CASCADE,
+    state text NOT NULL DEFAULT 'pending' CHECK (state IN ('pending', 'delivered', 'dead')),
+    attempts integer NOT NULL DEFAULT 0,
+    next_attempt_at timestamp(0) with time zone,
+    last_attempt_at timestamp(0) with time zone,
+    last_status_code integer,
+    last_error text NOT NULL DEFAULT '',
+    created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    delivered_at timestamp(0) with time zone
+);
+
+-- The dispatcher only looks for pending deliveries which are due.
+CREATE INDEX IF NOT EXISTS webhook_deliveries_due_idx ON webhook_deliveries (next_attempt_at) WHERE state = 'pending';
+CREATE INDEX IF NOT EXISTS webhook_deliveries_subscription_id_idx ON webhook_deliveries (subscription_id);
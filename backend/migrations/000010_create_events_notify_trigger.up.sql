@@ -0,0 +1,27 @@
+-- Every event is announced on the pnc_events channel when its transaction commits,
+-- so that each API instance can pass on events published by the others. The
+-- payload is the event as JSON, or just its id if that wouldn't fit in a
+-- notification, which must be under 8000 bytes.
+CREATE OR REPLACE FUNCTION notify_event() RETURNS trigger AS $$
+DECLARE
+    payload text;
+BEGIN
+    payload := json_build_object(
+        'id', NEW.id,
+        'type', NEW.type,
+        'camera_id', NEW.camera_id,
+        'site_name', NEW.site_name,
+        'occurred_at', NEW.occurred_at,
+        'data', NEW.data
+    )::text;
+    IF octet_length(payload) >= 8000 THEN
+        payload := json_build_object('id', NEW.id)::text;
+    END IF;
+    PERFORM pg_notify('pnc_events', payload);
+    RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS events_notify ON events;
+CREATE TRIGGER events_notify AFTER INSERT ON events
+    FOR EACH ROW EXECUTE FUNCTION notify_event();
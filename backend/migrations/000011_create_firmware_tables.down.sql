@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS firmware_catalog;
+DROP TABLE IF EXISTS firmware_history;
+DROP TABLE IF EXISTS camera_firmware;
@@ -0,0 +1,30 @@
+CREATE TABLE IF NOT EXISTS camera_firmware(
+    camera_id bigint PRIMARY KEY REFERENCES cameras ON DELETE CASCADE,
+    model text NOT NULL DEFAULT '',
+    firmware text NOT NULL,
+    collected_at timestamp(0) with time zone NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS firmware_history(
+    id bigserial PRIMARY KEY,
+    camera_id bigint NOT NULL REFERENCES cameras ON DELETE CASCADE,
+    model text NOT NULL DEFAULT '',
+    firmware text NOT NULL,
+    changed_at timestamp(0) with time zone NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS firmware_history_camera_id_changed_at_idx ON firmware_history (camera_id, changed_at);
+
+-- An empty minimum_version means no version is known to be vulnerable.
+CREATE TABLE IF NOT EXISTS firmware_catalog(
+    id bigserial PRIMARY KEY,
+    created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    updated_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    model_no text NOT NULL,
+    recommended_version text NOT NULL,
+    minimum_version text NOT NULL DEFAULT '',
+    notes text NOT NULL DEFAULT '',
+    version integer NOT NULL DEFAULT 1
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS firmware_catalog_model_no_idx ON firmware_catalog (lower(model_no));
@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS upgrade_targets;
+DROP TABLE IF EXISTS upgrade_campaigns;
+DROP TABLE IF EXISTS firmware_images;
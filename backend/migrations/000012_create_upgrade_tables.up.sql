@@ -0,0 +1,55 @@
+-- Images are kept in the artifact store under their sha256 digest, so each file is
+-- only uploaded once.
+CREATE TABLE IF NOT EXISTS firmware_images(
+    id bigserial PRIMARY KEY,
+    created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    uploaded_by text NOT NULL DEFAULT '',
+    model_no text NOT NULL,
+    firmware text NOT NULL,
+    filename text NOT NULL DEFAULT '',
+    size bigint NOT NULL,
+    sha256 text NOT NULL
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS firmware_images_sha256_idx ON firmware_images (sha256);
+
+-- An image can't be deleted while a campaign refers to it.
+CREATE TABLE IF NOT EXISTS upgrade_campaigns(
+    id bigserial PRIMARY KEY,
+    created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    created_by text NOT NULL DEFAULT '',
+    name text NOT NULL,
+    image_id bigint NOT NULL REFERENCES firmware_images ON DELETE RESTRICT,
+    selection jsonb NOT NULL DEFAULT '{}',
+    wave_size integer NOT NULL,
+    site_concurrency integer NOT NULL,
+    max_failures integer NOT NULL,
+    state text NOT NULL DEFAULT 'running' CHECK (state IN ('running', 'paused', 'halted', 'completed', 'cancelled')),
+    state_reason text NOT NULL DEFAULT '',
+    finished_at timestamp(0) with time zone,
+    version integer NOT NULL DEFAULT 1
+);
+
+-- One row per camera a campaign upgrades. name and site_name are the camera's when
+-- the campaign was created. An upgrading target is leased to one runner until
+-- lease_until, after which another may take it over.
+CREATE TABLE IF NOT EXISTS upgrade_targets(
+    campaign_id bigint NOT NULL REFERENCES upgrade_campaigns ON DELETE CASCADE,
+    camera_id bigint NOT NULL REFERENCES cameras ON DELETE CASCADE,
+    name text NOT NULL,
+    site_name text NOT NULL,
+    wave integer NOT NULL,
+    state text NOT NULL DEFAULT 'pending' CHECK (state IN ('pending', 'upgrading', 'succeeded', 'failed', 'skipped')),
+    attempts integer NOT NULL DEFAULT 0,
+    lease_until timestamp(0) with time zone,
+    previous_firmware text NOT NULL DEFAULT '',
+    firmware text NOT NULL DEFAULT '',
+    error text NOT NULL DEFAULT '',
+    started_at timestamp(0) with time zone,
+    finished_at timestamp(0) with time zone,
+    PRIMARY KEY (campaign_id, camera_id)
+);
+
+-- The runner only looks at targets which aren't finished.
+CREATE INDEX IF NOT EXISTS upgrade_targets_open_idx ON upgrade_targets (campaign_id, wave) WHERE state IN ('pending', 'upgrading');
+CREATE INDEX IF NOT EXISTS upgrade_targets_camera_id_idx ON upgrade_targets (camera_id);
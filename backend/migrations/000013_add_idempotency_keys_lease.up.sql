@@ -0,0 +1 @@
+ALTER TABLE idempotency_keys ADD COLUMN IF NOT EXISTS lease_expires_at timestamp(0) with time zone NOT NULL DEFAULT NOW();
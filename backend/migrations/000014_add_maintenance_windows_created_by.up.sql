@@ -0,0 +1 @@
+ALTER TABLE maintenance_windows ADD COLUMN IF NOT EXISTS created_by text NOT NULL DEFAULT '';
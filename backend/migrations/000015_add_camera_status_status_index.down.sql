@@ -0,0 +1 @@
+DROP INDEX IF EXISTS camera_status_status_idx;
@@ -0,0 +1 @@
+CREATE INDEX IF NOT EXISTS camera_status_status_idx ON camera_status (status);
@@ -0,0 +1,4 @@
+ALTER TABLE idempotency_keys DROP CONSTRAINT IF EXISTS idempotency_keys_pkey;
+DELETE FROM idempotency_keys WHERE user_name <> '';
+ALTER TABLE idempotency_keys ADD PRIMARY KEY (key, method, path);
+ALTER TABLE idempotency_keys DROP COLUMN IF EXISTS user_name;
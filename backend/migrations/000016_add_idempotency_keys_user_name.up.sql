@@ -0,0 +1,4 @@
+ALTER TABLE idempotency_keys ADD COLUMN IF NOT EXISTS user_name text NOT NULL DEFAULT '';
+
+ALTER TABLE idempotency_keys DROP CONSTRAINT IF EXISTS idempotency_keys_pkey;
+ALTER TABLE idempotency_keys ADD PRIMARY KEY (key, method, path, user_name);
@@ -0,0 +1,258 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/chefgoldbloom/pnctool/backend/internal/data"
+)
+
+// Camera is the camera resource exactly as the API serves it.
+type Camera = data.Camera
+
+// Metadata is the pagination information returned with a page of cameras.
+type Metadata = data.Metadata
+
+// Suggestion is a typeahead completion returned by Suggest.
+type Suggestion = data.Suggestion
+
+// CameraInput holds the fields for creating a camera.
+type CameraInput struct {
+	Name       string `json:"name"`
+	MacAddress string `json:"mac_address"`
+	SiteName   string `json:"site_name"`
+	ModelNo    string `json:"model_no"`
+	Address    string `json:"address,omitempty"`
+}
+
+// CameraPatch holds the fields for a partial update. Nil fields are left unchanged.
+type CameraPatch struct {
+	Name       *string `json:"name,omitempty"`
+	MacAddress *string `json:"mac_address,omitempty"`
+	SiteName   *string `json:"site_name,omitempty"`
+	ModelNo    *string `json:"model_no,omitempty"`
+	Address    *string `json:"address,omitempty"`
+}
+
+// ListOptions filters, sorts and paginates a camera listing. Zero values are omitted
+// so the server defaults apply.
+type ListOptions struct {
+	Name       string
+	MacAddress string
+	ModelNo    string
+	SiteName   string
+	Status     string // last polled status: online, offline, unauthorized or unknown
+	Query      string // q= filter expression
+	Search     string // fuzzy search, ranked by relevance unless Sort is set
+	Sort       string
+	Page       int
+	PageSize   int
+	// Fields and Include select a sparse fieldset and related resources to embed.
+	Fields  []string
+	Include []string
+}
+
+func (o ListOptions) values() url.Values {
+	qs := url.Values{}
+	set := func(key, value string) {
+		if value != "" {
+			qs.Set(key, value)
+		}
+	}
+	set("name", o.Name)
+	set("mac_address", o.MacAddress)
+	set("model_no", o.ModelNo)
+	set("site_name", o.SiteName)
+	set("status", o.Status)
+	set("q", o.Query)
+	set("search", o.Search)
+	set("sort", o.Sort)
+	set("fields", strings.Join(o.Fields, ","))
+	set("include", strings.Join(o.Include, ","))
+	if o.Page > 0 {
+		qs.Set("page", strconv.Itoa(o.Page))
+	}
+	if o.PageSize > 0 {
+		qs.Set("page_size", strconv.Itoa(o.PageSize))
+	}
+	return qs
+}
+
+func cameraPath(id int64) string {
+	return fmt.Sprintf("/v1/cameras/%d", id)
+}
+
+type cameraEnvelope struct {
+	Camera *Camera `json:"camera"`
+}
+
+// ListCameras fetches a single page of cameras.
+func (c *Client) ListCameras(ctx context.Context, opts ListOptions) ([]*Camera, Metadata, error) {
+	var env struct {
+		Cameras  []*Camera `json:"cameras"`
+		Metadata Metadata  `json:"metadata"`
+	}
+	_, err := c.Do(ctx, http.MethodGet, "/v1/cameras", opts.values(), nil, nil, &env)
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+	return env.Cameras, env.Metadata, nil
+}
+
+// Suggest returns up to limit camera names, sites and models matching what has been
+// typed so far. A limit of zero uses the server default.
+func (c *Client) Suggest(ctx context.Context, prefix string, limit int) ([]Suggestion, error) {
+	qs := url.Values{"q": {prefix}}
+	if limit > 0 {
+		qs.Set("limit", strconv.Itoa(limit))
+	}
+	var env struct {
+		Suggestions []Suggestion `json:"suggestions"`
+	}
+	_, err := c.Do(ctx, http.MethodGet, "/v1/search/suggest", qs, nil, nil, &env)
+	if err != nil {
+		return nil, err
+	}
+	return env.Suggestions, nil
+}
+
+// GetCamera fetches the camera with the given id. It returns an error matching
+// ErrNotFound if there is no such camera.
+func (c *Client) GetCamera(ctx context.Context, id int64) (*Camera, error) {
+	var env cameraEnvelope
+	_, err := c.Do(ctx, http.MethodGet, cameraPath(id), nil, nil, nil, &env)
+	if err != nil {
+		return nil, err
+	}
+	return env.Camera, nil
+}
+
+// CreateCamera creates a camera. It returns an error matching ErrValidation if the
+// server rejects the input.
+func (c *Client) CreateCamera(ctx context.Context, input CameraInput) (*Camera, error) {
+	var env cameraEnvelope
+	_, err := c.Do(ctx, http.MethodPost, "/v1/cameras", nil, input, nil, &env)
+	if err != nil {
+		return nil, err
+	}
+	return env.Camera, nil
+}
+
+// UpdateCamera applies patch to the camera with the given id, whatever its current
+// version. Use UpdateCameraVersion to guard against concurrent edits.
+func (c *Client) UpdateCamera(ctx context.Context, id int64, patch CameraPatch) (*Camera, error) {
+	var env cameraEnvelope
+	_, err := c.Do(ctx, http.MethodPatch, cameraPath(id), nil, patch, nil, &env)
+	if err != nil {
+		return nil, err
+	}
+	return env.Camera, nil
+}
+
+// UpdateCameraVersion applies patch only if the camera is still at the given version,
+// typically the Version of a Camera previously returned by GetCamera. The check is
+// made by the server through If-Match, so it is safe against concurrent edits. It
+// returns an error matching ErrEditConflict if somebody else changed the camera in the
+// meantime.
+func (c *Client) UpdateCameraVersion(ctx context.Context, id int64, version int32, patch CameraPatch) (*Camera, error) {
+	var env cameraEnvelope
+	_, err := c.Do(ctx, http.MethodPatch, cameraPath(id), nil, patch, ifMatch(id, version), &env)
+	if err != nil {
+		return nil, err
+	}
+	return env.Camera, nil
+}
+
+// ifMatch returns an If-Match header for the given camera version. It must agree with
+// the server's ETag format.
+func ifMatch(id int64, version int32) http.Header {
+	return http.Header{"If-Match": []string{fmt.Sprintf(`"%d-%d"`, id, version)}}
+}
+
+// ReplaceCamera replaces every writable field of the camera with input.
+func (c *Client) ReplaceCamera(ctx context.Context, id int64, input CameraInput) (*Camera, error) {
+	var env cameraEnvelope
+	_, err := c.Do(ctx, http.MethodPut, cameraPath(id), nil, input, nil, &env)
+	if err != nil {
+		return nil, err
+	}
+	return env.Camera, nil
+}
+
+// DeleteCamera deletes the camera with the given id.
+func (c *Client) DeleteCamera(ctx context.Context, id int64) error {
+	_, err := c.Do(ctx, http.MethodDelete, cameraPath(id), nil, nil, nil, nil)
+	return err
+}
+
+// DeleteCameraVersion deletes the camera only if it is still at the given version. It
+// returns an error matching ErrEditConflict if the camera has changed.
+func (c *Client) DeleteCameraVersion(ctx context.Context, id int64, version int32) error {
+	_, err := c.Do(ctx, http.MethodDelete, cameraPath(id), nil, nil, ifMatch(id, version), nil)
+	return err
+}
+
+// CameraIterator walks every camera matching a ListOptions, fetching pages lazily.
+//
+//	it := c.Cameras(ctx, client.ListOptions{SiteName: "NYC-5th-OPS"})
+//	for it.Next() {
+//		cam := it.Camera()
+//	}
+//	if err := it.Err(); err != nil { ... }
+type CameraIterator struct {
+	ctx    context.Context
+	client *Client
+	opts   ListOptions
+	page   []*Camera
+	idx    int
+	done   bool
+	err    error
+}
+
+// Cameras returns an iterator over every camera matching opts, starting at opts.Page
+// (or the first page).
+func (c *Client) Cameras(ctx context.Context, opts ListOptions) *CameraIterator {
+	if opts.Page < 1 {
+		opts.Page = 1
+	}
+	return &CameraIterator{ctx: ctx, client: c, opts: opts, idx: -1}
+}
+
+// Next advances to the next camera, fetching the next page when needed. It returns
+// false when there are no more cameras or an error occurred.
+func (it *CameraIterator) Next() bool {
+	if it.err != nil {
+		return false
+	}
+	it.idx++
+	for it.idx >= len(it.page) {
+		if it.done {
+			return false
+		}
+		page, meta, err := it.client.ListCameras(it.ctx, it.opts)
+		if err != nil {
+			it.err = err
+			return false
+		}
+		it.page, it.idx = page, 0
+		if len(page) == 0 || it.opts.Page >= meta.LastPage {
+			it.done = true
+		}
+		it.opts.Page++
+	}
+	return true
+}
+
+// Camera returns the current camera. It is only valid after Next returns true.
+func (it *CameraIterator) Camera() *Camera {
+	return it.page[it.idx]
+}
+
+// Err returns the first error encountered while iterating.
+func (it *CameraIterator) Err() error {
+	return it.err
+}
@@ -0,0 +1,251 @@
+// Package client is a Go SDK for the pnctool camera API. It wraps the JSON endpoints
+// under /v1 with typed methods, retries requests the server asks us to retry, and
+// turns error responses into *APIError values.
+package client
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	defaultMaxRetries = 3
+	defaultBackoff    = 250 * time.Millisecond
+	maxBackoff        = 10 * time.Second
+)
+
+// Client talks to a single pnctool API server. A Client is safe for concurrent use.
+type Client struct {
+	baseURL    *url.URL
+	httpClient *http.Client
+	token      string
+	user       string
+	team       string
+	userAgent  string
+	maxRetries int
+	backoff    time.Duration
+}
+
+// Option configures a Client.
+type Option func(*Client)
+
+// WithHTTPClient sets the underlying *http.Client. The default is a client with a
+// 30 second timeout.
+func WithHTTPClient(hc *http.Client) Option {
+	return func(c *Client) {
+		c.httpClient = hc
+	}
+}
+
+// WithToken sets a bearer token which is sent in the Authorization header of every
+// request.
+func WithToken(token string) Option {
+	return func(c *Client) {
+		c.token = token
+	}
+}
+
+// WithUser sets the user sent in the X-User header of every request. The server
+// answers requests without one with 401 Unauthorized wherever it needs to know who is
+// asking, like saved views, webhooks and upgrade campaigns.
+func WithUser(user string) Option {
+	return func(c *Client) {
+		c.user = user
+	}
+}
+
+// WithTeam sets the team sent in the X-Team header of every request, which saved
+// views can be shared with.
+func WithTeam(team string) Option {
+	return func(c *Client) {
+		c.team = team
+	}
+}
+
+// WithUserAgent sets the User-Agent header sent with every request.
+func WithUserAgent(ua string) Option {
+	return func(c *Client) {
+		c.userAgent = ua
+	}
+}
+
+// WithRetries sets how many times a request answered with 429 Too Many Requests or
+// 503 Service Unavailable is retried, and the initial backoff between attempts. The
+// backoff doubles on each attempt unless the server sends a Retry-After header.
+func WithRetries(maxRetries int, backoff time.Duration) Option {
+	return func(c *Client) {
+		c.maxRetries = maxRetries
+		c.backoff = backoff
+	}
+}
+
+// New returns a Client for the API server at baseURL, e.g. "http://localhost:4001".
+func New(baseURL string, opts ...Option) (*Client, error) {
+	u, err := url.Parse(baseURL)
+	if err != nil {
+		return nil, fmt.Errorf("client: invalid base URL: %w", err)
+	}
+	if u.Scheme == "" || u.Host == "" {
+		return nil, fmt.Errorf("client: base URL %q must be absolute", baseURL)
+	}
+	u.Path = strings.TrimSuffix(u.Path, "/")
+
+	c := &Client{
+		baseURL:    u,
+		httpClient: &http.Client{Timeout: 30 * time.Second},
+		userAgent:  "pnctool-client",
+		maxRetries: defaultMaxRetries,
+		backoff:    defaultBackoff,
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c, nil
+}
+
+// Do sends a request to path (relative to the base URL, e.g. "/v1/cameras") and
+// decodes the JSON response into dest, which may be nil. body, if non-nil, is encoded
+// as JSON. headers are added to the request and may be nil. Do is exported so that
+// endpoints without a typed method can still be reached through the same retry and
+// error handling. The response headers are returned on success.
+func (c *Client) Do(ctx context.Context, method, path string, query url.Values, body any, headers http.Header, dest any) (http.Header, error) {
+	var payload []byte
+	if body != nil {
+		var err error
+		payload, err = json.Marshal(body)
+		if err != nil {
+			return nil, fmt.Errorf("client: encoding request body: %w", err)
+		}
+	}
+
+	u := *c.baseURL
+	u.Path += path
+	u.RawQuery = query.Encode()
+
+	// Give every POST an Idempotency-Key, so retrying after a dropped connection or
+	// a 503 can't create the same resource twice.
+	if method == http.MethodPost && headers.Get("Idempotency-Key") == "" {
+		headers = headers.Clone()
+		if headers == nil {
+			headers = make(http.Header)
+		}
+		headers.Set("Idempotency-Key", newIdempotencyKey())
+	}
+
+	for attempt := 0; ; attempt++ {
+		req, err := http.NewRequestWithContext(ctx, method, u.String(), bytes.NewReader(payload))
+		if err != nil {
+			return nil, err
+		}
+		for k, v := range headers {
+			req.Header[k] = v
+		}
+		req.Header.Set("Accept", "application/json, application/problem+json")
+		req.Header.Set("User-Agent", c.userAgent)
+		if payload != nil {
+			req.Header.Set("Content-Type", "application/json")
+		}
+		if c.token != "" {
+			req.Header.Set("Authorization", "Bearer "+c.token)
+		}
+		if c.user != "" {
+			req.Header.Set("X-User", c.user)
+		}
+		if c.team != "" {
+			req.Header.Set("X-Team", c.team)
+		}
+
+		res, err := c.httpClient.Do(req)
+		if err != nil {
+			return nil, err
+		}
+
+		if retryable(res.StatusCode) && attempt < c.maxRetries {
+			wait := c.retryDelay(res, attempt)
+			drain(res)
+			select {
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			case <-time.After(wait):
+			}
+			continue
+		}
+
+		return res.Header, c.decode(res, dest)
+	}
+}
+
+func (c *Client) decode(res *http.Response, dest any) error {
+	defer drain(res)
+
+	if res.StatusCode >= 400 {
+		return newAPIError(res)
+	}
+	if dest == nil || res.StatusCode == http.StatusNoContent || res.StatusCode == http.StatusNotModified {
+		return nil
+	}
+
+	err := json.NewDecoder(res.Body).Decode(dest)
+	if err != nil {
+		return fmt.Errorf("client: decoding %s response: %w", res.Request.URL.Path, err)
+	}
+	return nil
+}
+
+func retryable(status int) bool {
+	return status == http.StatusTooManyRequests || status == http.StatusServiceUnavailable
+}
+
+// retryDelay honours a Retry-After header given in seconds, falling back to
+// exponential backoff.
+func (c *Client) retryDelay(res *http.Response, attempt int) time.Duration {
+	if s := res.Header.Get("Retry-After"); s != "" {
+		if secs, err := strconv.Atoi(s); err == nil && secs >= 0 {
+			return min(time.Duration(secs)*time.Second, maxBackoff)
+		}
+	}
+	return min(c.backoff<<attempt, maxBackoff)
+}
+
+// drain reads and closes the response body so the connection can be reused.
+func drain(res *http.Response) {
+	io.Copy(io.Discard, io.LimitReader(res.Body, 1<<20))
+	res.Body.Close()
+}
+
+// newIdempotencyKey returns a random version 4 UUID.
+func newIdempotencyKey() string {
+	var b [16]byte
+	rand.Read(b[:])
+	b[6] = b[6]&0x0f | 0x40
+	b[8] = b[8]&0x3f | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:])
+}
+
+// Healthcheck returns the server's status, environment and version.
+func (c *Client) Healthcheck(ctx context.Context) (*Health, error) {
+	var health Health
+	_, err := c.Do(ctx, http.MethodGet, "/v1/healthcheck", nil, nil, nil, &health)
+	if err != nil {
+		return nil, err
+	}
+	return &health, nil
+}
+
+// Health is the body of the healthcheck endpoint.
+type Health struct {
+	Status     string `json:"status"`
+	SystemInfo struct {
+		Environment string `json:"environment"`
+		Version     string `json:"version"`
+	} `json:"system_info"`
+}
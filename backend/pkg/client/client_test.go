@@ -0,0 +1,156 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func newTestClient(t *testing.T, h http.HandlerFunc) *Client {
+	t.Helper()
+
+	srv := httptest.NewServer(h)
+	t.Cleanup(srv.Close)
+
+	c, err := New(srv.URL, WithRetries(3, time.Millisecond), WithToken("s3cret"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+func TestRetryOnUnavailable(t *testing.T) {
+	var calls atomic.Int32
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer s3cret" {
+			t.Errorf("Authorization = %q", r.Header.Get("Authorization"))
+		}
+		if calls.Add(1) < 3 {
+			w.Header().Set("Retry-After", "0")
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.Write([]byte(`{"status":"available","system_info":{"environment":"testing","version":"1.0.0"}}`))
+	})
+
+	health, err := c.Healthcheck(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if health.Status != "available" || calls.Load() != 3 {
+		t.Errorf("status = %q after %d calls", health.Status, calls.Load())
+	}
+}
+
+func TestRetriesExhausted(t *testing.T) {
+	var calls atomic.Int32
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		w.WriteHeader(http.StatusTooManyRequests)
+	})
+
+	_, err := c.GetCamera(context.Background(), 1)
+
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusTooManyRequests {
+		t.Fatalf("err = %v; want 429 APIError", err)
+	}
+	if calls.Load() != 4 {
+		t.Errorf("calls = %d; want 4", calls.Load())
+	}
+}
+
+func TestTypedErrors(t *testing.T) {
+	tests := []struct {
+		name   string
+		status int
+		body   string
+		target error
+	}{
+		{"not found", http.StatusNotFound, `{"code":"not_found","detail":"the requested resource could not be found"}`, ErrNotFound},
+		{"conflict", http.StatusConflict, `{"code":"edit_conflict","detail":"conflict"}`, ErrEditConflict},
+		{"validation", http.StatusUnprocessableEntity, `{"code":"validation_failed","errors":[{"field":"name","code":"required","detail":"must be provided"}]}`, ErrValidation},
+		{"legacy validation", http.StatusUnprocessableEntity, `{"code":"validation_failed","error":{"name":"must be provided"}}`, ErrValidation},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(tt.status)
+				w.Write([]byte(tt.body))
+			})
+
+			_, err := c.CreateCamera(context.Background(), CameraInput{})
+			if !errors.Is(err, tt.target) {
+				t.Fatalf("err = %v; want %v", err, tt.target)
+			}
+			if tt.target == ErrValidation {
+				var apiErr *APIError
+				errors.As(err, &apiErr)
+				if apiErr.Fields["name"] != "must be provided" {
+					t.Errorf("Fields = %v", apiErr.Fields)
+				}
+			}
+		})
+	}
+}
+
+func TestCameraIterator(t *testing.T) {
+	const total, pageSize = 5, 2
+
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		page, _ := strconv.Atoi(r.URL.Query().Get("page"))
+		var cameras []*Camera
+		for id := (page-1)*pageSize + 1; id <= min(page*pageSize, total); id++ {
+			cameras = append(cameras, &Camera{ID: int64(id)})
+		}
+		json.NewEncoder(w).Encode(map[string]any{
+			"cameras":  cameras,
+			"metadata": Metadata{CurrentPage: page, PageSize: pageSize, FirstPage: 1, LastPage: 3, TotalRecords: total},
+		})
+	})
+
+	var ids []int64
+	it := c.Cameras(context.Background(), ListOptions{PageSize: pageSize})
+	for it.Next() {
+		ids = append(ids, it.Camera().ID)
+	}
+	if err := it.Err(); err != nil {
+		t.Fatal(err)
+	}
+	if len(ids) != total || ids[0] != 1 || ids[total-1] != total {
+		t.Errorf("ids = %v", ids)
+	}
+}
+
+func TestUpdateCameraVersion(t *testing.T) {
+	var calls atomic.Int32
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		if r.Method != http.MethodPatch || r.URL.Path != "/v1/cameras/7" {
+			t.Errorf("request = %s %s; want PATCH /v1/cameras/7", r.Method, r.URL.Path)
+		}
+		if got := r.Header.Get("If-Match"); got != `"7-3"` {
+			t.Errorf("If-Match = %q; want %q", got, `"7-3"`)
+		}
+		w.WriteHeader(http.StatusPreconditionFailed)
+		w.Write([]byte(`{"code":"precondition_failed","detail":"the camera has been modified"}`))
+	})
+
+	// The version is checked by the server in the same request, never by reading the
+	// camera first.
+	name := "lobby-west"
+	_, err := c.UpdateCameraVersion(context.Background(), 7, 3, CameraPatch{Name: &name})
+	if !errors.Is(err, ErrEditConflict) {
+		t.Errorf("err = %v; want ErrEditConflict", err)
+	}
+	if calls.Load() != 1 {
+		t.Errorf("calls = %d; want 1", calls.Load())
+	}
+}
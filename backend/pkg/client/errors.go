@@ -0,0 +1,97 @@
+package client
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+)
+
+// Sentinel errors which an *APIError matches through errors.Is, so callers can write
+// errors.Is(err, client.ErrNotFound) without inspecting status codes.
+var (
+	ErrNotFound     = errors.New("not found")
+	ErrEditConflict = errors.New("edit conflict")
+	ErrValidation   = errors.New("validation failed")
+)
+
+// APIError is returned for any response with a 4xx or 5xx status code.
+type APIError struct {
+	StatusCode int               // HTTP status code
+	Code       string            // machine-readable error code, e.g. "not_found"
+	Message    string            // human-readable detail
+	Fields     map[string]string // per-field validation messages, for 422 responses
+	FieldCodes map[string]string // per-field validation codes, for 422 responses
+}
+
+func (e *APIError) Error() string {
+	if len(e.Fields) > 0 {
+		return fmt.Sprintf("pnctool: %d %s: %s %v", e.StatusCode, e.Code, e.Message, e.Fields)
+	}
+	return fmt.Sprintf("pnctool: %d %s: %s", e.StatusCode, e.Code, e.Message)
+}
+
+// Is reports whether e matches one of the sentinel errors.
+func (e *APIError) Is(target error) bool {
+	switch target {
+	case ErrNotFound:
+		return e.StatusCode == http.StatusNotFound
+	case ErrEditConflict:
+		return e.StatusCode == http.StatusConflict || e.StatusCode == http.StatusPreconditionFailed
+	case ErrValidation:
+		return e.StatusCode == http.StatusUnprocessableEntity
+	}
+	return false
+}
+
+// problem is the subset of an RFC 7807 response (and the legacy {"error": ...} shape)
+// that we decode.
+type problem struct {
+	Detail string          `json:"detail"`
+	Code   string          `json:"code"`
+	Error  json.RawMessage `json:"error"`
+	Errors []struct {
+		Field  string `json:"field"`
+		Code   string `json:"code"`
+		Detail string `json:"detail"`
+	} `json:"errors"`
+}
+
+func newAPIError(res *http.Response) *APIError {
+	apiErr := &APIError{StatusCode: res.StatusCode, Message: http.StatusText(res.StatusCode)}
+
+	body, err := io.ReadAll(io.LimitReader(res.Body, 1<<20))
+	if err != nil {
+		return apiErr
+	}
+
+	var p problem
+	if json.Unmarshal(body, &p) != nil {
+		return apiErr
+	}
+
+	apiErr.Code = p.Code
+	if p.Detail != "" {
+		apiErr.Message = p.Detail
+	}
+	// Legacy responses carry either a string or a field -> message map in "error".
+	var msg string
+	if json.Unmarshal(p.Error, &msg) == nil && msg != "" {
+		apiErr.Message = msg
+	}
+	var fields map[string]string
+	if json.Unmarshal(p.Error, &fields) == nil && len(fields) > 0 {
+		apiErr.Fields = fields
+	}
+
+	if len(p.Errors) > 0 {
+		apiErr.Fields = make(map[string]string, len(p.Errors))
+		apiErr.FieldCodes = make(map[string]string, len(p.Errors))
+		for _, fe := range p.Errors {
+			apiErr.Fields[fe.Field] = fe.Detail
+			apiErr.FieldCodes[fe.Field] = fe.Code
+		}
+	}
+	return apiErr
+}